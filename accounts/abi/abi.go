@@ -17,13 +17,15 @@
 package abi
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"reflect"
-	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
 // The ABI holds information about a contract's context and available
@@ -109,41 +111,23 @@ func (abi ABI) Unpack(v interface{}, name string, output []byte) error {
 		// struct will match named return values to the struct's field
 		// names
 		case reflect.Struct:
-			for i := 0; i < len(method.Outputs); i++ {
-				marshalledValue, err := toGoType(i, method.Outputs[i], output)
-				if err != nil {
-					return err
-				}
-				reflectValue := reflect.ValueOf(marshalledValue)
-
-				for j := 0; j < typ.NumField(); j++ {
-					field := typ.Field(j)
-					// TODO read tags: `abi:"fieldName"`
-					if field.Name == strings.ToUpper(method.Outputs[i].Name[:1])+method.Outputs[i].Name[1:] {
-						if err := set(value.Field(j), reflectValue, method.Outputs[i]); err != nil {
-							return err
-						}
-					}
-				}
-			}
+			return unpackStruct(value, method.Outputs, output)
 		case reflect.Slice:
 			if !value.Type().AssignableTo(r_interSlice) {
 				return fmt.Errorf("abi: cannot marshal tuple in to slice %T (only []interface{} is supported)", v)
 			}
 
+			values, err := unpackValues(method.Outputs, output)
+			if err != nil {
+				return err
+			}
 			// if the slice already contains values, set those instead of the interface slice itself.
 			if value.Len() > 0 {
 				if len(method.Outputs) > value.Len() {
 					return fmt.Errorf("abi: cannot marshal in to slices of unequal size (require: %v, got: %v)", len(method.Outputs), value.Len())
 				}
-
-				for i := 0; i < len(method.Outputs); i++ {
-					marshalledValue, err := toGoType(i, method.Outputs[i], output)
-					if err != nil {
-						return err
-					}
-					reflectValue := reflect.ValueOf(marshalledValue)
-					if err := set(value.Index(i).Elem(), reflectValue, method.Outputs[i]); err != nil {
+				for i, marshalledValue := range values {
+					if err := set(value.Index(i).Elem(), reflect.ValueOf(marshalledValue), method.Outputs[i].Type); err != nil {
 						return err
 					}
 				}
@@ -153,11 +137,7 @@ func (abi ABI) Unpack(v interface{}, name string, output []byte) error {
 			// create a new slice and start appending the unmarshalled
 			// values to the new interface slice.
 			z := reflect.MakeSlice(typ, 0, len(method.Outputs))
-			for i := 0; i < len(method.Outputs); i++ {
-				marshalledValue, err := toGoType(i, method.Outputs[i], output)
-				if err != nil {
-					return err
-				}
+			for _, marshalledValue := range values {
 				z = reflect.Append(z, reflect.ValueOf(marshalledValue))
 			}
 			value.Set(z)
@@ -166,15 +146,118 @@ func (abi ABI) Unpack(v interface{}, name string, output []byte) error {
 		}
 
 	} else {
-		marshalledValue, err := toGoType(0, method.Outputs[0], output)
+		marshalledValue, err := toGoType(0, method.Outputs[0].Type, output)
 		if err != nil {
 			return err
 		}
-		if err := set(value, reflect.ValueOf(marshalledValue), method.Outputs[0]); err != nil {
+		if err := set(value, reflect.ValueOf(marshalledValue), method.Outputs[0].Type); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnpackEvent unpacks the data of a log emitted by the named event into the
+// struct v, setting the fields matching the non-indexed event inputs by name.
+// Indexed inputs are stored in the topics of the log instead and are skipped.
+func (abi ABI) UnpackEvent(v interface{}, name string, data []byte) error {
+	event, ok := abi.Events[name]
+	if !ok {
+		return fmt.Errorf("abi: event '%s' not found", name)
+	}
+	valueOf := reflect.ValueOf(v)
+	if valueOf.Kind() != reflect.Ptr || valueOf.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("abi: UnpackEvent(non-struct pointer %T)", v)
+	}
+	var inputs []Argument
+	for _, input := range event.Inputs {
+		if !input.Indexed {
+			inputs = append(inputs, input)
+		}
+	}
+	return unpackStruct(valueOf.Elem(), inputs, data)
+}
+
+// UnpackLog unpacks a log emitted by the named event into the struct v, with
+// the non-indexed inputs decoded from the data and the indexed ones from the
+// topics. Unless the event is anonymous, the first topic must be the event
+// signature.
+func (abi ABI) UnpackLog(v interface{}, name string, topics []common.Hash, data []byte) error {
+	event, ok := abi.Events[name]
+	if !ok {
+		return fmt.Errorf("abi: event '%s' not found", name)
+	}
+	if !event.Anonymous {
+		if len(topics) == 0 {
+			return errNoEventSignature
+		}
+		if topics[0] != event.Id() {
+			return fmt.Errorf("abi: event signature mismatch: have %x, want %x", topics[0], event.Id())
+		}
+		topics = topics[1:]
+	}
+	if len(data) > 0 {
+		if err := abi.UnpackEvent(v, name, data); err != nil {
 			return err
 		}
 	}
+	var indexed []Argument
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
+	}
+	return ParseTopics(v, indexed, topics)
+}
+
+// EventByID looks up the event whose signature hash is the given topic. Anonymous
+// events don't log their signature and can't be found this way.
+func (abi ABI) EventByID(topic common.Hash) (*Event, error) {
+	for _, event := range abi.Events {
+		if !event.Anonymous && event.Id() == topic {
+			return &event, nil
+		}
+	}
+	return nil, fmt.Errorf("abi: no event with id %x", topic)
+}
+
+// unpackValues unpacks the output of a list of arguments into their Go values,
+// keeping track of the offsets of the in place encoded arrays and tuples.
+func unpackValues(args []Argument, output []byte) ([]interface{}, error) {
+	values := make([]interface{}, len(args))
+	offset := 0
+	for i, arg := range args {
+		marshalledValue, err := toGoType(offset, arg.Type, output)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = marshalledValue
+		offset += getTypeSize(arg.Type)
+	}
+	return values, nil
+}
 
+// unpackStruct unpacks the output of a list of arguments into the fields of a
+// struct, matching the argument names to the `abi:"name"` tags of the fields
+// or to their names if untagged.
+func unpackStruct(value reflect.Value, args []Argument, output []byte) error {
+	values, err := unpackValues(args, output)
+	if err != nil {
+		return err
+	}
+	for i, arg := range args {
+		if arg.Name == "" {
+			continue
+		}
+		field := fieldIndexByABIName(value.Type(), arg.Name)
+		if field < 0 {
+			continue
+		}
+		if err := set(value.Field(field), reflect.ValueOf(values[i]), arg.Type); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -220,3 +303,27 @@ func (abi *ABI) UnmarshalJSON(data []byte) error {
 
 	return nil
 }
+
+// revertSelector is the method id of the Solidity Error(string) function, used
+// to encode the reason of a reverted execution.
+var revertSelector = crypto.Keccak256([]byte("Error(string)"))[:4]
+
+// UnpackRevert resolves the abi-encoded revert reason. Solidity encodes the
+// reason given to revert as if it were a call to a function `Error(string)`.
+func UnpackRevert(data []byte) (string, error) {
+	if len(data) < 4 {
+		return "", errors.New("invalid data for unpacking")
+	}
+	if !bytes.Equal(data[:4], revertSelector) {
+		return "", errors.New("invalid data for unpacking")
+	}
+	typ, err := NewType("string")
+	if err != nil {
+		return "", err
+	}
+	unpacked, err := toGoType(0, typ, data[4:])
+	if err != nil {
+		return "", err
+	}
+	return unpacked.(string), nil
+}
@@ -18,6 +18,7 @@ package abi
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
@@ -437,3 +438,33 @@ func TestBareEvents(t *testing.T) {
 		}
 	}
 }
+
+func TestUnpackRevert(t *testing.T) {
+	var cases = []struct {
+		input     string
+		expect    string
+		expectErr error
+	}{
+		{"", "", errors.New("invalid data for unpacking")},
+		{"08c379a1", "", errors.New("invalid data for unpacking")},
+		{"08c379a00000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000000d72657665727420726561736f6e00000000000000000000000000000000000000", "revert reason", nil},
+	}
+	for index, c := range cases {
+		got, err := UnpackRevert(common.Hex2Bytes(c.input))
+		if c.expectErr != nil {
+			if err == nil {
+				t.Fatalf("Expected non-nil error")
+			}
+			if err.Error() != c.expectErr.Error() {
+				t.Fatalf("Expected error mismatch, want %v, got %v", c.expectErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", index, err)
+		}
+		if c.expect != got {
+			t.Fatalf("Output mismatch, want %v, got %v", c.expect, got)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package backends
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that gas estimation finds the exact requirement of successful calls and
+// rejects calls which fail regardless of the gas allowance.
+func TestSimulatedBackendEstimateGas(t *testing.T) {
+	var (
+		sender  = common.Address{0x01}
+		failing = common.Address{0x02}
+	)
+	sim := NewSimulatedBackend(core.GenesisAlloc{
+		sender:  {Balance: big.NewInt(params.Ether)},
+		failing: {Balance: new(big.Int), Code: []byte{0xfe}}, // invalid opcode
+	})
+	transfer := ethereum.CallMsg{From: sender, To: &common.Address{0x03}, Value: big.NewInt(1)}
+	gas, err := sim.EstimateGas(context.Background(), transfer)
+	if err != nil {
+		t.Fatalf("failed to estimate transfer: %v", err)
+	}
+	if gas.Uint64() != params.TxGas {
+		t.Errorf("transfer estimate mismatch: have %v, want %d", gas, params.TxGas)
+	}
+	if _, err := sim.EstimateGas(context.Background(), ethereum.CallMsg{From: sender, To: &failing}); err == nil {
+		t.Errorf("always failing call estimated successfully")
+	}
+}
+
+// Tests that logs emitted by committed transactions can be both streamed live
+// and retrieved afterwards via one-off filter queries.
+func TestSimulatedBackendLogs(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+
+	sim := NewSimulatedBackend(core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}})
+
+	// Assemble an init code emitting a single log and deploying nothing
+	topic := common.HexToHash("0x0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+
+	code := []byte{0x60, 0x2a, 0x60, 0x00, 0x52, 0x7f} // mstore(0, 42); push32
+	code = append(code, topic[:]...)
+	code = append(code, 0x60, 0x20, 0x60, 0x00, 0xa1, 0x00) // log1(0, 32, topic); stop
+
+	tx, _ := types.SignTx(types.NewContractCreation(0, new(big.Int), big.NewInt(100000), big.NewInt(1), code), types.NewEIP155Signer(params.AllProtocolChanges.ChainId), key)
+	query := ethereum.FilterQuery{Topics: [][]common.Hash{{topic}}}
+
+	// Subscribe to the logs and commit the emitting transaction
+	logs := make(chan types.Log, 1)
+	sub, err := sim.SubscribeFilterLogs(context.Background(), query, logs)
+	if err != nil {
+		t.Fatalf("failed to subscribe to logs: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	if err := sim.SendTransaction(context.Background(), tx); err != nil {
+		t.Fatalf("failed to send transaction: %v", err)
+	}
+	sim.Commit()
+
+	want := common.LeftPadBytes([]byte{42}, 32)
+	select {
+	case log := <-logs:
+		if !bytes.Equal(log.Data, want) {
+			t.Errorf("streamed log data mismatch: have %x, want %x", log.Data, want)
+		}
+	case err := <-sub.Err():
+		t.Fatalf("log subscription failed: %v", err)
+	case <-time.After(time.Second):
+		t.Fatalf("log not streamed")
+	}
+	// Retrieve the same log from the chain
+	found, err := sim.FilterLogs(context.Background(), query)
+	if err != nil {
+		t.Fatalf("failed to filter logs: %v", err)
+	}
+	if len(found) != 1 {
+		t.Fatalf("filtered log count mismatch: have %d, want 1", len(found))
+	}
+	if !bytes.Equal(found[0].Data, want) {
+		t.Errorf("filtered log data mismatch: have %x, want %x", found[0].Data, want)
+	}
+	if found[0].TxHash != tx.Hash() {
+		t.Errorf("filtered log transaction mismatch: have %x, want %x", found[0].TxHash, tx.Hash())
+	}
+}
+
+// Tests that the simulated clock can be moved forward for the pending block, and
+// that the adjustment is only retained until the block is committed.
+func TestSimulatedBackendAdjustTime(t *testing.T) {
+	sim := NewSimulatedBackend(core.GenesisAlloc{})
+
+	parent := sim.blockchain.CurrentBlock()
+	if err := sim.AdjustTime(time.Hour); err != nil {
+		t.Fatalf("failed to adjust time: %v", err)
+	}
+	sim.Commit()
+
+	head := sim.blockchain.CurrentBlock()
+	if diff := head.Time().Uint64() - parent.Time().Uint64(); diff < 3600 {
+		t.Errorf("block time not adjusted: have %ds, want at least %ds", diff, 3600)
+	}
+	sim.Commit()
+	if diff := sim.blockchain.CurrentBlock().Time().Uint64() - head.Time().Uint64(); diff >= 3600 {
+		t.Errorf("time adjustment retained after commit: %ds", diff)
+	}
+	if err := sim.AdjustTime(-time.Second); err == nil {
+		t.Errorf("negative time adjustment accepted")
+	}
+}
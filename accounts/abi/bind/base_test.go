@@ -0,0 +1,69 @@
+// Copyright 2016 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind_test
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that transactions are signed replay protected if a chain ID is set in
+// the transaction options, and that they are executed by the backend.
+func TestTransactReplayProtection(t *testing.T) {
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{
+		crypto.PubkeyToAddress(testKey.PublicKey): {Balance: big.NewInt(10000000000)},
+	})
+	parsed, err := abi.JSON(strings.NewReader("[]"))
+	if err != nil {
+		t.Fatalf("failed to parse abi: %v", err)
+	}
+	for i, chainID := range []*big.Int{nil, params.AllProtocolChanges.ChainId} {
+		opts := bind.NewKeyedTransactor(testKey)
+		opts.ChainID = chainID
+		opts.GasLimit = big.NewInt(3000000)
+
+		address, tx, _, err := bind.DeployContract(opts, parsed, common.FromHex(`6060604052600a8060106000396000f360606040526008565b00`), backend)
+		if err != nil {
+			t.Fatalf("test %d: failed to deploy contract: %v", i, err)
+		}
+		if protected := chainID != nil; tx.Protected() != protected {
+			t.Fatalf("test %d: replay protection mismatch: have %v, want %v", i, tx.Protected(), protected)
+		}
+		if chainID != nil && tx.ChainId().Cmp(chainID) != 0 {
+			t.Fatalf("test %d: chain id mismatch: have %v, want %v", i, tx.ChainId(), chainID)
+		}
+		if from, _ := types.Sender(types.NewEIP155Signer(params.AllProtocolChanges.ChainId), tx); from != opts.From {
+			t.Fatalf("test %d: sender mismatch: have %x, want %x", i, from, opts.From)
+		}
+		backend.Commit()
+
+		if code, err := backend.CodeAt(context.Background(), address, nil); err != nil || len(code) == 0 {
+			t.Fatalf("test %d: contract not deployed: code %x, err %v", i, code, err)
+		}
+	}
+}
@@ -53,6 +53,9 @@ var bindTests = []struct {
 			if b, err := NewEmptyTransactor(common.Address{}, nil); b == nil || err != nil {
 				t.Fatalf("transactor binding (%v) nil or error (%v) not nil", b, nil)
 			}
+			if b, err := NewEmptyFilterer(common.Address{}, nil); b == nil || err != nil {
+				t.Fatalf("filterer binding (%v) nil or error (%v) not nil", b, nil)
+			}
 		`,
 	},
 	// Test that all the official sample contracts bind correctly
@@ -447,6 +450,86 @@ var bindTests = []struct {
 			}
 		`,
 	},
+	// Test that events can be filtered from past blocks and watched in new ones
+	{
+		`Eventer`,
+		`
+			contract Eventer {
+				event Emitted(address indexed who, uint value);
+
+				function() payable {
+					Emitted(msg.sender, msg.value);
+				}
+			}
+		`, `602c80600b6000396000f334600052337f6d7747ff9aaba238de658957a12a32c8a94f6ec3aa0508441fe400ca79ed457c60206000a200`,
+		`[{"payable":true,"type":"fallback"},{"anonymous":false,"inputs":[{"indexed":true,"name":"who","type":"address"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Emitted","type":"event"}]`,
+		`
+			// Generate a new random account and a funded simulator
+			key, _ := crypto.GenerateKey()
+			auth := bind.NewKeyedTransactor(key)
+			sim := backends.NewSimulatedBackend(core.GenesisAlloc{auth.From: {Balance: big.NewInt(10000000000)}})
+
+			// Deploy an eventer contract and start watching for its events
+			_, _, eventer, err := DeployEventer(auth, sim)
+			if err != nil {
+				t.Fatalf("Failed to deploy eventer contract: %v", err)
+			}
+			sim.Commit()
+
+			sink := make(chan *EventerEmitted, 1)
+			sub, err := eventer.WatchEmitted(nil, sink, nil)
+			if err != nil {
+				t.Fatalf("Failed to watch events: %v", err)
+			}
+			defer sub.Unsubscribe()
+
+			// Emit an event by transferring funds to the contract
+			auth.Value = big.NewInt(42)
+			if _, err := (&EventerRaw{eventer}).Transfer(auth); err != nil {
+				t.Fatalf("Failed to emit event: %v", err)
+			}
+			sim.Commit()
+
+			select {
+			case event := <-sink:
+				if event.Who != auth.From || event.Value.Cmp(big.NewInt(42)) != 0 {
+					t.Fatalf("Watched event mismatch: have %x/%v, want %x/%v", event.Who, event.Value, auth.From, 42)
+				}
+			case err := <-sub.Err():
+				t.Fatalf("Watch failed: %v", err)
+			case <-time.After(time.Second):
+				t.Fatalf("Event not delivered")
+			}
+			// Filter the past events, both matching and not the emitter
+			it, err := eventer.FilterEmitted(nil, []common.Address{auth.From})
+			if err != nil {
+				t.Fatalf("Failed to filter events: %v", err)
+			}
+			defer it.Close()
+
+			if !it.Next() {
+				t.Fatalf("Filtered event missing: %v", it.Error())
+			}
+			if it.Event.Who != auth.From || it.Event.Value.Cmp(big.NewInt(42)) != 0 {
+				t.Fatalf("Filtered event mismatch: have %x/%v, want %x/%v", it.Event.Who, it.Event.Value, auth.From, 42)
+			}
+			if it.Next() {
+				t.Fatalf("Unexpected filtered event: %+v", it.Event)
+			}
+			if err := it.Error(); err != nil {
+				t.Fatalf("Filtering failed: %v", err)
+			}
+			other, err := eventer.FilterEmitted(nil, []common.Address{{1}})
+			if err != nil {
+				t.Fatalf("Failed to filter events: %v", err)
+			}
+			defer other.Close()
+
+			if other.Next() {
+				t.Fatalf("Unexpected filtered event: %+v", other.Event)
+			}
+		`,
+	},
 }
 
 // Tests that packages generated by the binder can be successfully compiled and
@@ -23,7 +23,8 @@ import (
 )
 
 var (
-	errBadBool = errors.New("abi: improperly encoded boolean value")
+	errBadBool          = errors.New("abi: improperly encoded boolean value")
+	errNoEventSignature = errors.New("abi: no event signature")
 )
 
 // formatSliceString formats the reflection kind with the given slice size
@@ -45,12 +46,11 @@ func sliceTypeCheck(t Type, val reflect.Value) error {
 		return typeErr(formatSliceString(t.Elem.Kind, t.SliceSize), formatSliceString(val.Type().Elem().Kind(), val.Len()))
 	}
 
-	if t.Elem.IsSlice {
+	if t.Elem.IsSlice || t.Elem.IsArray {
 		if val.Len() > 0 {
 			return sliceTypeCheck(*t.Elem, val.Index(0))
 		}
-	} else if t.Elem.IsArray {
-		return sliceTypeCheck(*t.Elem, val.Index(0))
+		return nil
 	}
 
 	if elemKind := val.Type().Elem().Kind(); elemKind != t.Elem.Kind {
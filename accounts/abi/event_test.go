@@ -17,6 +17,7 @@
 package abi
 
 import (
+	"math/big"
 	"strings"
 	"testing"
 
@@ -54,3 +55,105 @@ func TestEventId(t *testing.T) {
 		}
 	}
 }
+
+func TestEventUnpack(t *testing.T) {
+	const definition = `[{ "type" : "event", "name" : "transfer", "inputs": [
+		{ "name" : "from", "type": "address", "indexed": true },
+		{ "name" : "value", "type": "uint256" },
+		{ "name" : "to", "type": "address" }
+	]}]`
+
+	abi, err := JSON(strings.NewReader(definition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	to := common.HexToAddress("0x0102030405060708090a0b0c0d0e0f1011121314")
+	data := append(common.LeftPadBytes(big.NewInt(1000).Bytes(), 32), common.LeftPadBytes(to[:], 32)...)
+
+	var event struct {
+		From  common.Address
+		Value *big.Int
+		To    common.Address
+	}
+	if err := abi.UnpackEvent(&event, "transfer", data); err != nil {
+		t.Fatalf("failed to unpack event: %v", err)
+	}
+	if event.From != (common.Address{}) {
+		t.Errorf("indexed field unpacked from data: %x", event.From)
+	}
+	if event.Value.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("value mismatch: have %v, want %v", event.Value, 1000)
+	}
+	if event.To != to {
+		t.Errorf("to mismatch: have %x, want %x", event.To, to)
+	}
+	if err := abi.UnpackEvent(&event, "missing", data); err == nil {
+		t.Errorf("unknown event unpacked")
+	}
+}
+
+// Tests that logs are unpacked from both their data and topics, with dynamic
+// indexed arguments kept as hashes and anonymous events lacking the signature.
+func TestUnpackLog(t *testing.T) {
+	const definition = `[
+	{ "type" : "event", "name" : "named", "inputs": [
+		{ "name" : "who", "type": "address", "indexed": true },
+		{ "name" : "tags", "type": "string[]", "indexed": true },
+		{ "name" : "value", "type": "uint256" }
+	]},
+	{ "type" : "event", "name" : "anon", "anonymous": true, "inputs": [
+		{ "name" : "who", "type": "address", "indexed": true },
+		{ "name" : "value", "type": "uint256" }
+	]}]`
+
+	abi, err := JSON(strings.NewReader(definition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	who := common.HexToAddress("0x0102030405060708090a0b0c0d0e0f1011121314")
+	topics, err := MakeTopics([]interface{}{who})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := crypto.Keccak256Hash([]byte("tags"))
+	data := common.LeftPadBytes(big.NewInt(1000).Bytes(), 32)
+
+	var named struct {
+		Owner common.Address `abi:"who"`
+		Tags  common.Hash
+		Value *big.Int
+	}
+	if err := abi.UnpackLog(&named, "named", []common.Hash{abi.Events["named"].Id(), topics[0][0], tags}, data); err != nil {
+		t.Fatalf("failed to unpack named log: %v", err)
+	}
+	if named.Owner != who || named.Tags != tags || named.Value.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("named log mismatch: have %x %x %v", named.Owner, named.Tags, named.Value)
+	}
+	if event, err := abi.EventByID(abi.Events["named"].Id()); err != nil || event.Name != "named" {
+		t.Errorf("event lookup mismatch: have %v, %v", event, err)
+	}
+	if err := abi.UnpackLog(&named, "named", []common.Hash{tags, topics[0][0], tags}, data); err == nil {
+		t.Errorf("log with mismatching signature unpacked")
+	}
+	var badTags struct {
+		Who  common.Address
+		Tags []string
+	}
+	if err := abi.UnpackLog(&badTags, "named", []common.Hash{abi.Events["named"].Id(), topics[0][0], tags}, data); err == nil {
+		t.Errorf("hashed indexed argument unpacked in to non-hash field")
+	}
+
+	var anon struct {
+		Who   common.Address
+		Value *big.Int
+	}
+	if err := abi.UnpackLog(&anon, "anon", []common.Hash{topics[0][0]}, data); err != nil {
+		t.Fatalf("failed to unpack anonymous log: %v", err)
+	}
+	if anon.Who != who || anon.Value.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("anonymous log mismatch: have %x %v", anon.Who, anon.Value)
+	}
+	if _, err := abi.EventByID(abi.Events["anon"].Id()); err == nil {
+		t.Errorf("anonymous event found by id")
+	}
+}
@@ -44,37 +44,16 @@ func (method Method) pack(args ...interface{}) ([]byte, error) {
 	if len(args) != len(method.Inputs) {
 		return nil, fmt.Errorf("argument count mismatch: %d for %d", len(args), len(method.Inputs))
 	}
-	// variable input is the output appended at the end of packed
-	// output. This is used for strings and bytes types input.
-	var variableInput []byte
-
-	var ret []byte
+	types := make([]*Type, len(args))
+	values := make([]reflect.Value, len(args))
 	for i, a := range args {
-		input := method.Inputs[i]
-		// pack the input
-		packed, err := input.Type.pack(reflect.ValueOf(a))
-		if err != nil {
-			return nil, fmt.Errorf("`%s` %v", method.Name, err)
-		}
-
-		// check for a slice type (string, bytes, slice)
-		if input.Type.requiresLengthPrefix() {
-			// calculate the offset
-			offset := len(method.Inputs)*32 + len(variableInput)
-			// set the offset
-			ret = append(ret, packNum(reflect.ValueOf(offset))...)
-			// Append the packed output to the variable input. The variable input
-			// will be appended at the end of the input.
-			variableInput = append(variableInput, packed...)
-		} else {
-			// append the packed value to the input
-			ret = append(ret, packed...)
-		}
+		types[i], values[i] = &method.Inputs[i].Type, reflect.ValueOf(a)
 	}
-	// append the variable input at the end of the packed input
-	ret = append(ret, variableInput...)
-
-	return ret, nil
+	packed, err := packTuple(types, values)
+	if err != nil {
+		return nil, fmt.Errorf("`%s` %v", method.Name, err)
+	}
+	return packed, nil
 }
 
 // Sig returns the methods string signature according to the ABI spec.
@@ -116,3 +95,12 @@ func (m Method) String() string {
 func (m Method) Id() []byte {
 	return crypto.Keccak256([]byte(m.Sig()))[:4]
 }
+
+// UnpackInputs unpacks the arguments of a call to the method, given without the
+// leading method id, into their Go values.
+func (m Method) UnpackInputs(data []byte) ([]interface{}, error) {
+	if len(data)%32 != 0 {
+		return nil, fmt.Errorf("abi: improperly formatted call data of length %d", len(data))
+	}
+	return unpackValues(m.Inputs, data)
+}
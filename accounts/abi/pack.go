@@ -31,6 +31,30 @@ func packBytesSlice(bytes []byte, l int) []byte {
 	return append(len, common.RightPadBytes(bytes, (l+31)/32*32)...)
 }
 
+// packTuple packs the values as a tuple of the given types: static values are
+// encoded in place while dynamic ones are appended after the head, which holds
+// their offsets instead.
+func packTuple(types []*Type, values []reflect.Value) ([]byte, error) {
+	headSize := 0
+	for _, typ := range types {
+		headSize += getTypeSize(*typ)
+	}
+	var head, tail []byte
+	for i, typ := range types {
+		packed, err := typ.pack(values[i])
+		if err != nil {
+			return nil, err
+		}
+		if isDynamicType(*typ) {
+			head = append(head, packNum(reflect.ValueOf(headSize+len(tail)))...)
+			tail = append(tail, packed...)
+		} else {
+			head = append(head, packed...)
+		}
+	}
+	return append(head, tail...), nil
+}
+
 // packElement packs the given reflect value according to the abi specification in
 // t.
 func packElement(t Type, reflectValue reflect.Value) []byte {
@@ -403,6 +403,59 @@ func TestMethodPack(t *testing.T) {
 	}
 }
 
+// Tests that nested arrays and tuples are packed with their dynamic parts in
+// the tail of the enclosing encoding.
+func TestPackNested(t *testing.T) {
+	const definition = `[
+	{ "name" : "nested", "inputs": [ { "name": "a", "type": "uint8[2][]" }, { "name": "b", "type": "string[]" } ] },
+	{ "name" : "tuple", "inputs": [ { "name": "t", "type": "tuple", "components": [ { "name": "x", "type": "uint256" }, { "name": "y", "type": "bytes" } ] }, { "name": "z", "type": "bool" } ] }]`
+
+	abi, err := JSON(strings.NewReader(definition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig := abi.Methods["tuple"].Sig(); sig != "tuple((uint256,bytes),bool)" {
+		t.Errorf("tuple signature mismatch: have %s, want %s", sig, "tuple((uint256,bytes),bool)")
+	}
+	word := func(n byte) []byte { return common.LeftPadBytes([]byte{n}, 32) }
+
+	want := abi.Methods["nested"].Id()
+	for _, n := range []byte{0x40, 0xe0, 2, 1, 2, 3, 4, 2, 0x40, 0x80, 2} {
+		want = append(want, word(n)...)
+	}
+	want = append(want, common.RightPadBytes([]byte("ab"), 32)...)
+	want = append(want, word(1)...)
+	want = append(want, common.RightPadBytes([]byte("c"), 32)...)
+
+	packed, err := abi.Pack("nested", [][2]uint8{{1, 2}, {3, 4}}, []string{"ab", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(packed, want) {
+		t.Errorf("nested pack mismatch:\nhave %x\nwant %x", packed, want)
+	}
+
+	want = abi.Methods["tuple"].Id()
+	for _, n := range []byte{0x40, 1, 7, 0x40, 1} {
+		want = append(want, word(n)...)
+	}
+	want = append(want, common.RightPadBytes([]byte{0xff}, 32)...)
+
+	tuple := struct {
+		X *big.Int
+		Y []byte `abi:"y"`
+	}{big.NewInt(7), []byte{0xff}}
+	if packed, err = abi.Pack("tuple", tuple, true); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(packed, want) {
+		t.Errorf("tuple pack mismatch:\nhave %x\nwant %x", packed, want)
+	}
+	if _, err = abi.Pack("tuple", struct{ X *big.Int }{big.NewInt(7)}, true); err == nil {
+		t.Errorf("expected error for missing tuple field")
+	}
+}
+
 func TestPackNumber(t *testing.T) {
 	tests := []struct {
 		value  reflect.Value
@@ -19,6 +19,7 @@ package abi
 import (
 	"fmt"
 	"reflect"
+	"strings"
 )
 
 // indirect recursively dereferences the value until it either gets the value
@@ -66,11 +67,38 @@ func mustArrayToByteSlice(value reflect.Value) reflect.Value {
 	return slice
 }
 
+// capitalise makes the first character of a string upper case, mapping abi
+// argument names to exported Go field names.
+func capitalise(name string) string {
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// fieldIndexByABIName returns the index of the struct field an abi argument or
+// tuple component is stored in, or -1 if there's none. Fields tagged with
+// `abi:"name"` take precedence over the ones matching the capitalised name.
+func fieldIndexByABIName(typ reflect.Type, name string) int {
+	for i := 0; i < typ.NumField(); i++ {
+		if typ.Field(i).Tag.Get("abi") == name {
+			return i
+		}
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		if field := typ.Field(i); field.Tag.Get("abi") == "" && field.Name == capitalise(name) {
+			return i
+		}
+	}
+	return -1
+}
+
 // set attempts to assign src to dst by either setting, copying or otherwise.
 //
 // set is a bit more lenient when it comes to assignment and doesn't force an as
-// strict ruleset as bare `reflect` does.
-func set(dst, src reflect.Value, output Argument) error {
+// strict ruleset as bare `reflect` does. Nested arrays and tuples are assigned
+// element by element, so they may be unpacked into Go arrays and tagged structs.
+func set(dst, src reflect.Value, t Type) error {
 	dstType := dst.Type()
 	srcType := src.Type()
 
@@ -78,16 +106,57 @@ func set(dst, src reflect.Value, output Argument) error {
 	case dstType.AssignableTo(src.Type()):
 		dst.Set(src)
 	case dstType.Kind() == reflect.Array && srcType.Kind() == reflect.Slice:
-		if dst.Len() < output.Type.SliceSize {
-			return fmt.Errorf("abi: cannot unmarshal src (len=%d) in to dst (len=%d)", output.Type.SliceSize, dst.Len())
+		size := t.SliceSize
+		if t.IsSlice {
+			size = src.Len()
+		}
+		if dst.Len() < size {
+			return fmt.Errorf("abi: cannot unmarshal src (len=%d) in to dst (len=%d)", size, dst.Len())
+		}
+		if srcType.Elem().AssignableTo(dstType.Elem()) {
+			reflect.Copy(dst, src)
+			return nil
+		}
+		return setElems(dst, src, t)
+	case dstType.Kind() == reflect.Slice && srcType.Kind() == reflect.Slice && t.isArray():
+		slice := reflect.MakeSlice(dstType, src.Len(), src.Len())
+		if err := setElems(slice, src, t); err != nil {
+			return err
+		}
+		dst.Set(slice)
+	case dstType.Kind() == reflect.Struct && t.T == TupleTy && !t.isArray():
+		for i, name := range t.TupleRawNames {
+			field := fieldIndexByABIName(dstType, name)
+			if field < 0 {
+				return fmt.Errorf("abi: field %s can't be found in the given value of type %v", name, dstType)
+			}
+			if err := set(dst.Field(field), src.Field(i), *t.TupleElems[i]); err != nil {
+				return err
+			}
 		}
-		reflect.Copy(dst, src)
 	case dstType.Kind() == reflect.Interface:
 		dst.Set(src)
 	case dstType.Kind() == reflect.Ptr:
-		return set(dst.Elem(), src, output)
+		if dst.IsNil() {
+			dst.Set(reflect.New(dstType.Elem()))
+		}
+		return set(dst.Elem(), src, t)
 	default:
 		return fmt.Errorf("abi: cannot unmarshal %v in to %v", src.Type(), dst.Type())
 	}
 	return nil
 }
+
+// setElems assigns the elements of the unpacked array src to the elements of
+// dst one by one.
+func setElems(dst, src reflect.Value, t Type) error {
+	if !t.isArray() {
+		return fmt.Errorf("abi: cannot unmarshal %v in to %v", src.Type(), dst.Type())
+	}
+	for i := 0; i < src.Len(); i++ {
+		if err := set(dst.Index(i), src.Index(i), *t.Elem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
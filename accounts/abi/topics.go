@@ -0,0 +1,215 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package abi
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// MakeTopics converts a filter query argument list into a filter topic set. Each
+// query position lists the accepted values of the matching indexed argument,
+// with empty positions matching anything. Dynamic values (strings and byte
+// slices) are hashed, the same way they are stored in the log topics.
+func MakeTopics(query ...[]interface{}) ([][]common.Hash, error) {
+	topics := make([][]common.Hash, len(query))
+	for i, filter := range query {
+		// Unconstrained positions match anything, signalled by the zero hash
+		if len(filter) == 0 {
+			topics[i] = []common.Hash{{}}
+			continue
+		}
+		for _, rule := range filter {
+			var topic common.Hash
+
+			// Try to generate the topic based on simple types
+			switch rule := rule.(type) {
+			case common.Hash:
+				copy(topic[:], rule[:])
+			case common.Address:
+				copy(topic[common.HashLength-common.AddressLength:], rule[:])
+			case *big.Int:
+				blob := math.U256(new(big.Int).Set(rule)).Bytes()
+				copy(topic[common.HashLength-len(blob):], blob)
+			case bool:
+				if rule {
+					topic[common.HashLength-1] = 1
+				}
+			case int8:
+				blob := math.U256(big.NewInt(int64(rule))).Bytes()
+				copy(topic[common.HashLength-len(blob):], blob)
+			case int16:
+				blob := math.U256(big.NewInt(int64(rule))).Bytes()
+				copy(topic[common.HashLength-len(blob):], blob)
+			case int32:
+				blob := math.U256(big.NewInt(int64(rule))).Bytes()
+				copy(topic[common.HashLength-len(blob):], blob)
+			case int64:
+				blob := math.U256(big.NewInt(rule)).Bytes()
+				copy(topic[common.HashLength-len(blob):], blob)
+			case uint8:
+				blob := new(big.Int).SetUint64(uint64(rule)).Bytes()
+				copy(topic[common.HashLength-len(blob):], blob)
+			case uint16:
+				blob := new(big.Int).SetUint64(uint64(rule)).Bytes()
+				copy(topic[common.HashLength-len(blob):], blob)
+			case uint32:
+				blob := new(big.Int).SetUint64(uint64(rule)).Bytes()
+				copy(topic[common.HashLength-len(blob):], blob)
+			case uint64:
+				blob := new(big.Int).SetUint64(rule).Bytes()
+				copy(topic[common.HashLength-len(blob):], blob)
+			case string:
+				hash := crypto.Keccak256Hash([]byte(rule))
+				copy(topic[:], hash[:])
+			case []byte:
+				hash := crypto.Keccak256Hash(rule)
+				copy(topic[:], hash[:])
+
+			default:
+				// Attempt to generate the topic from funky types
+				val := reflect.ValueOf(rule)
+
+				switch {
+				case val.Kind() == reflect.Array && reflect.TypeOf(rule).Elem().Kind() == reflect.Uint8:
+					reflect.Copy(reflect.ValueOf(topic[:val.Len()]), val)
+
+				default:
+					return nil, fmt.Errorf("unsupported indexed type: %T", rule)
+				}
+			}
+			topics[i] = append(topics[i], topic)
+		}
+	}
+	return topics, nil
+}
+
+// ParseTopics converts the indexed topic fields into actual log field values,
+// storing them into the fields of the struct out matching the argument names.
+//
+// Note, dynamic types cannot be reconstructed since they get mapped to Keccak256
+// hashes as the topic value! Their fields must be of type common.Hash instead.
+func ParseTopics(out interface{}, fields []Argument, topics []common.Hash) error {
+	// Sanity check that the fields and topics match up
+	if len(fields) != len(topics) {
+		return errors.New("topic/field count mismatch")
+	}
+	// Iterate over all the fields and reconstruct them from topics
+	for _, arg := range fields {
+		if !arg.Indexed {
+			return errors.New("non-indexed field in topic reconstruction")
+		}
+		if arg.Name == "" {
+			topics = topics[1:]
+			continue
+		}
+		value := reflect.ValueOf(out)
+		if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+			return fmt.Errorf("abi: ParseTopics(non-struct pointer %T)", out)
+		}
+		index := fieldIndexByABIName(value.Elem().Type(), arg.Name)
+		if index < 0 {
+			return fmt.Errorf("abi: field %s can't be found in the given value", capitalise(arg.Name))
+		}
+		field := value.Elem().Field(index)
+
+		// Dynamic types and arrays are stored as the hash of their encoding
+		if arg.Type.isArray() || isDynamicType(arg.Type) || arg.Type.T == TupleTy {
+			if field.Type() != hash_t {
+				return fmt.Errorf("abi: cannot unmarshal hashed indexed %v in to %v", arg.Type, field.Type())
+			}
+			field.Set(reflect.ValueOf(topics[0]))
+			topics = topics[1:]
+			continue
+		}
+		// Try to parse the topic back into the fields based on primitive types
+		switch field.Kind() {
+		case reflect.Bool:
+			if topics[0][common.HashLength-1] == 1 {
+				field.Set(reflect.ValueOf(true))
+			}
+		case reflect.Int8:
+			num := math.S256(new(big.Int).SetBytes(topics[0][:]))
+			field.Set(reflect.ValueOf(int8(num.Int64())))
+
+		case reflect.Int16:
+			num := math.S256(new(big.Int).SetBytes(topics[0][:]))
+			field.Set(reflect.ValueOf(int16(num.Int64())))
+
+		case reflect.Int32:
+			num := math.S256(new(big.Int).SetBytes(topics[0][:]))
+			field.Set(reflect.ValueOf(int32(num.Int64())))
+
+		case reflect.Int64:
+			num := math.S256(new(big.Int).SetBytes(topics[0][:]))
+			field.Set(reflect.ValueOf(num.Int64()))
+
+		case reflect.Uint8:
+			num := new(big.Int).SetBytes(topics[0][:])
+			field.Set(reflect.ValueOf(uint8(num.Uint64())))
+
+		case reflect.Uint16:
+			num := new(big.Int).SetBytes(topics[0][:])
+			field.Set(reflect.ValueOf(uint16(num.Uint64())))
+
+		case reflect.Uint32:
+			num := new(big.Int).SetBytes(topics[0][:])
+			field.Set(reflect.ValueOf(uint32(num.Uint64())))
+
+		case reflect.Uint64:
+			num := new(big.Int).SetBytes(topics[0][:])
+			field.Set(reflect.ValueOf(num.Uint64()))
+
+		default:
+			// Ran out of plain primitive types, try custom types
+			switch field.Type() {
+			case hash_t:
+				field.Set(reflect.ValueOf(topics[0]))
+
+			case address_t:
+				var addr common.Address
+				copy(addr[:], topics[0][common.HashLength-common.AddressLength:])
+				field.Set(reflect.ValueOf(addr))
+
+			case reflect.PtrTo(big_t):
+				num := new(big.Int).SetBytes(topics[0][:])
+				if arg.Type.T == IntTy {
+					num = math.S256(num)
+				}
+				field.Set(reflect.ValueOf(num))
+
+			default:
+				// Ran out of custom types, try the crazies
+				switch {
+				case field.Kind() == reflect.Array && field.Type().Elem().Kind() == reflect.Uint8:
+					reflect.Copy(field, reflect.ValueOf(topics[0][:field.Len()]))
+
+				default:
+					return fmt.Errorf("unsupported indexed type: %v", arg.Type)
+				}
+			}
+		}
+		topics = topics[1:]
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package abi
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Tests that indexed event arguments converted into filter topics can be parsed
+// back into their original values.
+func TestTopicsRoundtrip(t *testing.T) {
+	const definition = `[{ "type" : "event", "name" : "test", "inputs": [
+		{ "name" : "small", "type": "int8", "indexed": true },
+		{ "name" : "big", "type": "int256", "indexed": true },
+		{ "name" : "who", "type": "address", "indexed": true },
+		{ "name" : "flag", "type": "bool", "indexed": true },
+		{ "name" : "id", "type": "bytes4", "indexed": true },
+		{ "name" : "name", "type": "string", "indexed": true }
+	]}]`
+
+	parsed, err := JSON(strings.NewReader(definition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	who := common.HexToAddress("0x0102030405060708090a0b0c0d0e0f1011121314")
+
+	topics, err := MakeTopics([]interface{}{int8(-3)}, []interface{}{big.NewInt(-1000)}, []interface{}{who}, []interface{}{true}, []interface{}{[4]byte{1, 2, 3, 4}}, []interface{}{"geth"})
+	if err != nil {
+		t.Fatalf("failed to make topics: %v", err)
+	}
+	flat := make([]common.Hash, len(topics))
+	for i, topic := range topics {
+		flat[i] = topic[0]
+	}
+	var event struct {
+		Small int8
+		Big   *big.Int
+		Who   common.Address
+		Flag  bool
+		Id    [4]byte
+		Name  common.Hash
+	}
+	if err := ParseTopics(&event, parsed.Events["test"].Inputs, flat); err != nil {
+		t.Fatalf("failed to parse topics: %v", err)
+	}
+	if event.Small != -3 {
+		t.Errorf("int8 mismatch: have %d, want %d", event.Small, -3)
+	}
+	if event.Big.Cmp(big.NewInt(-1000)) != 0 {
+		t.Errorf("int256 mismatch: have %v, want %d", event.Big, -1000)
+	}
+	if event.Who != who {
+		t.Errorf("address mismatch: have %x, want %x", event.Who, who)
+	}
+	if !event.Flag {
+		t.Errorf("bool mismatch: have %v, want %v", event.Flag, true)
+	}
+	if event.Id != [4]byte{1, 2, 3, 4} {
+		t.Errorf("bytes4 mismatch: have %x, want %x", event.Id, [4]byte{1, 2, 3, 4})
+	}
+	if want := crypto.Keccak256Hash([]byte("geth")); event.Name != want {
+		t.Errorf("string hash mismatch: have %x, want %x", event.Name, want)
+	}
+	if wild, _ := MakeTopics(nil); len(wild) != 1 || len(wild[0]) != 1 || wild[0][0] != (common.Hash{}) {
+		t.Errorf("unconstrained topic not wildcarded: %x", wild)
+	}
+	if _, err := MakeTopics([]interface{}{struct{}{}}); err == nil {
+		t.Errorf("unsupported topic type accepted")
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"reflect"
 	"regexp"
 	"strconv"
+	"strings"
 )
 
 const (
@@ -35,6 +36,7 @@ const (
 	HashTy
 	FixedPointTy
 	FunctionTy
+	TupleTy
 )
 
 // Type is the reflection of the supported argument type
@@ -49,58 +51,77 @@ type Type struct {
 	Size int
 	T    byte // Our own type checking
 
+	TupleElems    []*Type  // Type information of all tuple fields
+	TupleRawNames []string // Raw field names of all tuple fields
+
 	stringKind string // holds the unparsed string for deriving signatures
 }
 
 var (
-	// fullTypeRegex parses the abi types
+	// typeRegex parses the abi sub types
 	//
 	// Types can be in the format of:
 	//
-	// 	Input  = Type [ "[" [ Number ] "]" ] Name .
 	// 	Type   = [ "u" ] "int" [ Number ] [ x ] [ Number ].
 	//
 	// Examples:
 	//
 	//      string     int       uint       fixed
-	//      string32   int8      uint8      uint[]
-	//      address    int256    uint256    fixed128x128[2]
-	fullTypeRegex = regexp.MustCompile(`([a-zA-Z0-9]+)(\[([0-9]*)\])?`)
-	// typeRegex parses the abi sub types
+	//      string32   int8      uint8      fixed128x128
+	//      address    int256    uint256    bytes32
+	//
+	// Arrays and slices are suffixed to the element type and parsed before.
 	typeRegex = regexp.MustCompile("([a-zA-Z]+)(([0-9]+)(x([0-9]+))?)?")
 )
 
 // NewType creates a new reflection type of abi type given in t.
-func NewType(t string) (typ Type, err error) {
-	res := fullTypeRegex.FindAllStringSubmatch(t, -1)[0]
-	// check if type is slice and parse type.
-	switch {
-	case res[3] != "":
-		// err is ignored. Already checked for number through the regexp
-		typ.SliceSize, _ = strconv.Atoi(res[3])
-		typ.IsArray = true
-	case res[2] != "":
-		typ.IsSlice, typ.SliceSize = true, -1
-	case res[0] == "":
-		return Type{}, fmt.Errorf("abi: type parse error: %s", t)
-	}
-	if typ.IsArray || typ.IsSlice {
-		sliceType, err := NewType(res[1])
+func NewType(t string) (Type, error) {
+	return newType(t, nil)
+}
+
+// newType creates a new reflection type of abi type given in t, using the
+// components to define the fields if the type is a tuple.
+func newType(t string, components []argumentMarshaling) (typ Type, err error) {
+	// check if type is slice and parse the element type. The last dimension
+	// is the outermost one, i.e. uint8[2][] is a slice of uint8[2] arrays.
+	if strings.HasSuffix(t, "]") {
+		i := strings.LastIndex(t, "[")
+		if i <= 0 {
+			return Type{}, fmt.Errorf("abi: type parse error: %s", t)
+		}
+		if size := t[i+1 : len(t)-1]; size == "" {
+			typ.IsSlice, typ.SliceSize = true, -1
+		} else {
+			if typ.SliceSize, err = strconv.Atoi(size); err != nil || typ.SliceSize <= 0 {
+				return Type{}, fmt.Errorf("abi: invalid array size in type: %s", t)
+			}
+			typ.IsArray = true
+		}
+		elem, err := newType(t[:i], components)
 		if err != nil {
 			return Type{}, err
 		}
-		typ.Elem = &sliceType
-		typ.stringKind = sliceType.stringKind + t[len(res[1]):]
+		typ.Elem = &elem
+		typ.stringKind = elem.stringKind + t[i:]
+
 		// Although we know that this is an array, we cannot return
 		// as we don't know the type of the element, however, if it
 		// is still an array, then don't determine the type.
-		if typ.Elem.IsArray || typ.Elem.IsSlice {
+		if elem.IsArray || elem.IsSlice {
 			return typ, nil
 		}
+		typ.Kind, typ.Type, typ.Size, typ.T = elem.Kind, elem.Type, elem.Size, elem.T
+		return typ, nil
+	}
+	if t == "tuple" {
+		return newTupleType(components)
 	}
-
 	// parse the type and size of the abi-type.
-	parsedType := typeRegex.FindAllStringSubmatch(res[1], -1)[0]
+	matches := typeRegex.FindAllStringSubmatch(t, -1)
+	if len(matches) != 1 || matches[0][0] != t {
+		return Type{}, fmt.Errorf("abi: type parse error: %s", t)
+	}
+	parsedType := matches[0]
 	// varSize is the size of the variable
 	var varSize int
 	if len(parsedType[3]) > 0 {
@@ -117,12 +138,7 @@ func NewType(t string) (typ Type, err error) {
 		varSize = 256
 		t += "256"
 	}
-
-	// only set stringKind if not array or slice, as for those,
-	// the correct string type has been set
-	if !(typ.IsArray || typ.IsSlice) {
-		typ.stringKind = t
-	}
+	typ.stringKind = t
 
 	switch varType {
 	case "int":
@@ -170,6 +186,42 @@ func NewType(t string) (typ Type, err error) {
 	return
 }
 
+// newTupleType creates the reflection type of a tuple, which unpacks into an
+// anonymous struct with a field for each of the components.
+func newTupleType(components []argumentMarshaling) (Type, error) {
+	if len(components) == 0 {
+		return Type{}, fmt.Errorf("abi: tuple type without components")
+	}
+	var (
+		typ    = Type{Kind: reflect.Struct, T: TupleTy}
+		fields = make([]reflect.StructField, 0, len(components))
+		names  = make(map[string]bool)
+		kinds  = make([]string, 0, len(components))
+	)
+	for _, c := range components {
+		elem, err := newType(c.Type, c.Components)
+		if err != nil {
+			return Type{}, err
+		}
+		if c.Name == "" {
+			return Type{}, fmt.Errorf("abi: unnamed tuple component of type %s", c.Type)
+		}
+		name := capitalise(c.Name)
+		if names[name] {
+			return Type{}, fmt.Errorf("abi: duplicate tuple component %s", c.Name)
+		}
+		names[name] = true
+
+		fields = append(fields, reflect.StructField{Name: name, Type: elem.goType()})
+		kinds = append(kinds, elem.stringKind)
+		typ.TupleElems = append(typ.TupleElems, &elem)
+		typ.TupleRawNames = append(typ.TupleRawNames, c.Name)
+	}
+	typ.Type = reflect.StructOf(fields)
+	typ.stringKind = "(" + strings.Join(kinds, ",") + ")"
+	return typ, nil
+}
+
 // String implements Stringer
 func (t Type) String() (out string) {
 	return t.stringKind
@@ -183,28 +235,104 @@ func (t Type) pack(v reflect.Value) ([]byte, error) {
 		return nil, err
 	}
 
-	if (t.IsSlice || t.IsArray) && t.T != BytesTy && t.T != FixedBytesTy && t.T != FunctionTy {
-		var packed []byte
+	switch {
+	case t.isArray():
+		// arrays are encoded as a tuple of their elements, slices are
+		// additionally prefixed with the number of elements.
+		types := make([]*Type, v.Len())
+		values := make([]reflect.Value, v.Len())
+		for i := range types {
+			types[i], values[i] = t.Elem, v.Index(i)
+		}
+		packed, err := packTuple(types, values)
+		if err != nil {
+			return nil, err
+		}
+		if t.IsSlice {
+			return append(packNum(reflect.ValueOf(v.Len())), packed...), nil
+		}
+		return packed, nil
 
-		for i := 0; i < v.Len(); i++ {
-			val, err := t.Elem.pack(v.Index(i))
-			if err != nil {
-				return nil, err
+	case t.T == TupleTy:
+		values := make([]reflect.Value, len(t.TupleElems))
+		for i, name := range t.TupleRawNames {
+			field := fieldIndexByABIName(v.Type(), name)
+			if field < 0 {
+				return nil, fmt.Errorf("abi: field %s can't be found in the given value of type %v", name, v.Type())
 			}
-			packed = append(packed, val...)
+			values[i] = v.Field(field)
 		}
-		if t.IsSlice {
-			return packBytesSlice(packed, v.Len()), nil
-		} else if t.IsArray {
-			return packed, nil
+		return packTuple(t.TupleElems, values)
+	}
+	return packElement(t, v), nil
+}
+
+// isArray returns whether the type is an array or slice of elements, as opposed
+// to the byte based types which are encoded as a single value.
+func (t Type) isArray() bool {
+	return (t.IsSlice || t.IsArray) && t.T != BytesTy && t.T != FixedBytesTy && t.T != FunctionTy
+}
+
+// goType returns the Go type values of t are unpacked into.
+func (t Type) goType() reflect.Type {
+	switch {
+	case t.isArray():
+		return reflect.SliceOf(t.Elem.goType())
+	case t.T == IntTy || t.T == UintTy:
+		if t.Kind == reflect.Ptr {
+			return reflect.PtrTo(t.Type)
 		}
+		return t.Type
+	case t.T == BoolTy:
+		return reflect.TypeOf(false)
+	case t.T == StringTy:
+		return reflect.TypeOf("")
+	case t.T == AddressTy:
+		return address_t
+	case t.T == HashTy:
+		return hash_t
+	case t.T == TupleTy:
+		return t.Type
 	}
+	return byte_ts
+}
 
-	return packElement(t, v), nil
+// isDynamicType returns whether the encoding of the type is of variable size,
+// in which case it is placed in the tail of the enclosing tuple and referenced
+// by its offset.
+func isDynamicType(t Type) bool {
+	if t.isArray() {
+		return t.IsSlice || isDynamicType(*t.Elem)
+	}
+	switch t.T {
+	case StringTy, BytesTy:
+		return true
+	case TupleTy:
+		for _, elem := range t.TupleElems {
+			if isDynamicType(*elem) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
-// requireLengthPrefix returns whether the type requires any sort of length
-// prefixing.
-func (t Type) requiresLengthPrefix() bool {
-	return t.T != FixedBytesTy && (t.T == StringTy || t.T == BytesTy || t.IsSlice)
+// getTypeSize returns the number of bytes the type occupies in the head of the
+// enclosing tuple. Static arrays and tuples are encoded in place, everything
+// else takes up a single word.
+func getTypeSize(t Type) int {
+	if isDynamicType(t) {
+		return 32
+	}
+	switch {
+	case t.isArray():
+		return t.SliceSize * getTypeSize(*t.Elem)
+	case t.T == TupleTy:
+		size := 0
+		for _, elem := range t.TupleElems {
+			size += getTypeSize(*elem)
+		}
+		return size
+	}
+	return 32
 }
@@ -78,6 +78,8 @@ func TestTypeRegexp(t *testing.T) {
 		{"address", Type{Kind: reflect.Array, Type: address_t, Size: 20, T: AddressTy, stringKind: "address"}},
 		{"address[]", Type{IsSlice: true, SliceSize: -1, Kind: reflect.Array, Type: address_t, T: AddressTy, Size: 20, Elem: &Type{Kind: reflect.Array, Type: address_t, Size: 20, T: AddressTy, stringKind: "address"}, stringKind: "address[]"}},
 		{"address[2]", Type{IsArray: true, SliceSize: 2, Kind: reflect.Array, Type: address_t, T: AddressTy, Size: 20, Elem: &Type{Kind: reflect.Array, Type: address_t, Size: 20, T: AddressTy, stringKind: "address"}, stringKind: "address[2]"}},
+		{"uint8[2][]", Type{IsSlice: true, SliceSize: -1, Elem: &Type{IsArray: true, SliceSize: 2, Kind: reflect.Uint8, Type: uint8_t, Size: 8, T: UintTy, Elem: &Type{Kind: reflect.Uint8, Type: uint8_t, Size: 8, T: UintTy, stringKind: "uint8"}, stringKind: "uint8[2]"}, stringKind: "uint8[2][]"}},
+		{"string[][3]", Type{IsArray: true, SliceSize: 3, Elem: &Type{IsSlice: true, SliceSize: -1, Kind: reflect.String, T: StringTy, Size: -1, Elem: &Type{Kind: reflect.String, T: StringTy, Size: -1, stringKind: "string"}, stringKind: "string[]"}, stringKind: "string[][3]"}},
 
 		// TODO when fixed types are implemented properly
 		// {"fixed", Type{}},
@@ -98,6 +100,15 @@ func TestTypeRegexp(t *testing.T) {
 	}
 }
 
+// Tests that malformed type strings are rejected by the type parser.
+func TestTypeParseErrors(t *testing.T) {
+	for _, blob := range []string{"", "[]", "uint8]", "uint8[x]", "uint8[0]", "uint8[-1]", "uint8 ", "tuple", "foo"} {
+		if _, err := NewType(blob); err == nil {
+			t.Errorf("type %q: expected parse error", blob)
+		}
+	}
+}
+
 func TestTypeCheck(t *testing.T) {
 	for i, test := range []struct {
 		typ   string
@@ -132,6 +143,9 @@ func TestTypeCheck(t *testing.T) {
 		{"string", "hello world", ""},
 		{"bytes32[]", [][32]byte{{}}, ""},
 		{"function", [24]byte{}, ""},
+		{"uint8[2][]", [][2]uint8{{1, 2}}, ""},
+		{"uint8[2][]", [][2]uint16{{1, 2}}, "abi: cannot use [2]uint16 as type [2]uint8 as argument"},
+		{"bytes32[]", [][32]byte{}, ""},
 	} {
 		typ, err := NewType(test.typ)
 		if err != nil {
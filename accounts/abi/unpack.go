@@ -25,118 +25,93 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 )
 
-// toGoSliceType parses the input and casts it to the proper slice defined by the ABI
-// argument in T.
-func toGoSlice(i int, t Argument, output []byte) (interface{}, error) {
-	index := i * 32
-	// The slice must, at very least be large enough for the index+32 which is exactly the size required
-	// for the [offset in output, size of offset].
-	if index+32 > len(output) {
-		return nil, fmt.Errorf("abi: cannot marshal in to go slice: insufficient size output %d require %d", len(output), index+32)
-	}
-	elem := t.Type.Elem
-
-	// first we need to create a slice of the type
-	var refSlice reflect.Value
-	switch elem.T {
-	case IntTy, UintTy, BoolTy:
-		// create a new reference slice matching the element type
-		switch t.Type.Kind {
-		case reflect.Bool:
-			refSlice = reflect.ValueOf([]bool(nil))
-		case reflect.Uint8:
-			refSlice = reflect.ValueOf([]uint8(nil))
-		case reflect.Uint16:
-			refSlice = reflect.ValueOf([]uint16(nil))
-		case reflect.Uint32:
-			refSlice = reflect.ValueOf([]uint32(nil))
-		case reflect.Uint64:
-			refSlice = reflect.ValueOf([]uint64(nil))
-		case reflect.Int8:
-			refSlice = reflect.ValueOf([]int8(nil))
-		case reflect.Int16:
-			refSlice = reflect.ValueOf([]int16(nil))
-		case reflect.Int32:
-			refSlice = reflect.ValueOf([]int32(nil))
-		case reflect.Int64:
-			refSlice = reflect.ValueOf([]int64(nil))
-		default:
-			refSlice = reflect.ValueOf([]*big.Int(nil))
-		}
-	case AddressTy: // address must be of slice Address
-		refSlice = reflect.ValueOf([]common.Address(nil))
-	case HashTy: // hash must be of slice hash
-		refSlice = reflect.ValueOf([]common.Hash(nil))
-	case FixedBytesTy:
-		refSlice = reflect.ValueOf([][]byte(nil))
-	default: // no other types are supported
-		return nil, fmt.Errorf("abi: unsupported slice type %v", elem.T)
-	}
-
-	var slice []byte
-	var size int
-	var offset int
-	if t.Type.IsSlice {
+// toGoSlice parses the input and casts it to the proper slice defined by the
+// ABI type in t. Both arrays and slices are unpacked into Go slices, with the
+// elements decoded recursively, so arrays may be nested arbitrarily deep.
+func toGoSlice(index int, t Type, output []byte) (interface{}, error) {
+	var (
+		start, size int
+		err         error
+	)
+	if t.IsSlice {
 		// get the offset which determines the start of this array ...
-		offset = int(binary.BigEndian.Uint64(output[index+24 : index+32]))
+		offset, err := readLength(output, index)
+		if err != nil {
+			return nil, err
+		}
 		if offset+32 > len(output) {
-			return nil, fmt.Errorf("abi: cannot marshal in to go slice: offset %d would go over slice boundary (len=%d)", len(output), offset+32)
+			return nil, fmt.Errorf("abi: cannot marshal in to go slice: offset %d would go over slice boundary (len=%d)", offset+32, len(output))
 		}
-
-		slice = output[offset:]
-		// ... starting with the size of the array in elements ...
-		size = int(binary.BigEndian.Uint64(slice[24:32]))
-		slice = slice[32:]
-		// ... and make sure that we've at the very least the amount of bytes
-		// available in the buffer.
-		if size*32 > len(slice) {
-			return nil, fmt.Errorf("abi: cannot marshal in to go slice: insufficient size output %d require %d", len(output), offset+32+size*32)
+		// ... starting with the size of the array in elements.
+		if size, err = readLength(output, offset); err != nil {
+			return nil, err
 		}
-
-		// reslice to match the required size
-		slice = slice[:size*32]
-	} else if t.Type.IsArray {
-		//get the number of elements in the array
-		size = t.Type.SliceSize
-
-		//check to make sure array size matches up
-		if index+32*size > len(output) {
-			return nil, fmt.Errorf("abi: cannot marshal in to go array: offset %d would go over slice boundary (len=%d)", len(output), index+32*size)
+		start = offset + 32
+	} else {
+		// arrays are stored in place, unless their elements are dynamic
+		size, start = t.SliceSize, index
+		if isDynamicType(t) {
+			if start, err = readLength(output, index); err != nil {
+				return nil, err
+			}
 		}
-		//slice is there for a fixed amount of times
-		slice = output[index : index+size*32]
 	}
-
+	// make sure that we've at the very least the amount of bytes available
+	// in the buffer for the heads of all the elements.
+	elemSize := getTypeSize(*t.Elem)
+	if size > (len(output)-start)/elemSize {
+		return nil, fmt.Errorf("abi: cannot marshal in to go slice: insufficient size output %d require %d", len(output), start+size*elemSize)
+	}
+	refSlice := reflect.MakeSlice(reflect.SliceOf(t.Elem.goType()), size, size)
 	for i := 0; i < size; i++ {
-		var (
-			inter        interface{}             // interface type
-			returnOutput = slice[i*32 : i*32+32] // the return output
-			err          error
-		)
-		// set inter to the correct type (cast)
-		switch elem.T {
-		case IntTy, UintTy:
-			inter = readInteger(t.Type.Kind, returnOutput)
-		case BoolTy:
-			inter, err = readBool(returnOutput)
-			if err != nil {
-				return nil, err
-			}
-		case AddressTy:
-			inter = common.BytesToAddress(returnOutput)
-		case HashTy:
-			inter = common.BytesToHash(returnOutput)
-		case FixedBytesTy:
-			inter = returnOutput
+		inter, err := toGoType(i*elemSize, *t.Elem, output[start:])
+		if err != nil {
+			return nil, err
 		}
-		// append the item to our reflect slice
-		refSlice = reflect.Append(refSlice, reflect.ValueOf(inter))
+		refSlice.Index(i).Set(reflect.ValueOf(inter))
 	}
-
-	// return the interface
 	return refSlice.Interface(), nil
 }
 
+// toGoTuple parses the input and casts it to the anonymous struct defined by
+// the ABI tuple type in t.
+func toGoTuple(index int, t Type, output []byte) (interface{}, error) {
+	start := index
+	if isDynamicType(t) {
+		var err error
+		if start, err = readLength(output, index); err != nil {
+			return nil, err
+		}
+	}
+	tuple := reflect.New(t.Type).Elem()
+	offset := 0
+	for i, elem := range t.TupleElems {
+		inter, err := toGoType(offset, *elem, output[start:])
+		if err != nil {
+			return nil, err
+		}
+		tuple.Field(i).Set(reflect.ValueOf(inter))
+		offset += getTypeSize(*elem)
+	}
+	return tuple.Interface(), nil
+}
+
+// readLength reads the word at index as an offset or a length prefix, making
+// sure it doesn't point beyond the output.
+func readLength(output []byte, index int) (int, error) {
+	word := output[index : index+32]
+	for _, b := range word[:24] {
+		if b != 0 {
+			return 0, fmt.Errorf("abi: cannot marshal in to go type: offset or length 0x%x overflows", word)
+		}
+	}
+	length := binary.BigEndian.Uint64(word[24:])
+	if length > uint64(len(output)) {
+		return 0, fmt.Errorf("abi: cannot marshal in to go type: offset or length %d exceeds output size %d", length, len(output))
+	}
+	return int(length), nil
+}
+
 func readInteger(kind reflect.Kind, b []byte) interface{} {
 	switch kind {
 	case reflect.Uint8:
@@ -181,31 +156,38 @@ func readBool(word []byte) (bool, error) {
 
 }
 
-// toGoType parses the input and casts it to the proper type defined by the ABI
-// argument in T.
-func toGoType(i int, t Argument, output []byte) (interface{}, error) {
-	// we need to treat slices differently
-	if (t.Type.IsSlice || t.Type.IsArray) && t.Type.T != BytesTy && t.Type.T != StringTy && t.Type.T != FixedBytesTy && t.Type.T != FunctionTy {
-		return toGoSlice(i, t, output)
-	}
-
-	index := i * 32
+// toGoType parses the input at the given byte offset and casts it to the
+// proper type defined by the ABI type in t.
+func toGoType(index int, t Type, output []byte) (interface{}, error) {
 	if index+32 > len(output) {
 		return nil, fmt.Errorf("abi: cannot marshal in to go type: length insufficient %d require %d", len(output), index+32)
 	}
+	// we need to treat slices and tuples differently
+	switch {
+	case t.isArray():
+		return toGoSlice(index, t, output)
+	case t.T == TupleTy:
+		return toGoTuple(index, t, output)
+	}
 
 	// Parse the given index output and check whether we need to read
 	// a different offset and length based on the type (i.e. string, bytes)
 	var returnOutput []byte
-	switch t.Type.T {
+	switch t.T {
 	case StringTy, BytesTy: // variable arrays are written at the end of the return bytes
 		// parse offset from which we should start reading
-		offset := int(binary.BigEndian.Uint64(output[index+24 : index+32]))
+		offset, err := readLength(output, index)
+		if err != nil {
+			return nil, err
+		}
 		if offset+32 > len(output) {
 			return nil, fmt.Errorf("abi: cannot marshal in to go type: length insufficient %d require %d", len(output), offset+32)
 		}
 		// parse the size up until we should be reading
-		size := int(binary.BigEndian.Uint64(output[offset+24 : offset+32]))
+		size, err := readLength(output, offset)
+		if err != nil {
+			return nil, err
+		}
 		if offset+32+size > len(output) {
 			return nil, fmt.Errorf("abi: cannot marshal in to go type: length insufficient %d require %d", len(output), offset+32+size)
 		}
@@ -217,9 +199,9 @@ func toGoType(i int, t Argument, output []byte) (interface{}, error) {
 	}
 
 	// convert the bytes to whatever is specified by the ABI.
-	switch t.Type.T {
+	switch t.T {
 	case IntTy, UintTy:
-		return readInteger(t.Type.Kind, returnOutput), nil
+		return readInteger(t.Kind, returnOutput), nil
 	case BoolTy:
 		return readBool(returnOutput)
 	case AddressTy:
@@ -231,5 +213,5 @@ func toGoType(i int, t Argument, output []byte) (interface{}, error) {
 	case StringTy:
 		return string(returnOutput), nil
 	}
-	return nil, fmt.Errorf("abi: unknown type %v", t.Type.T)
+	return nil, fmt.Errorf("abi: unknown type %v", t.T)
 }
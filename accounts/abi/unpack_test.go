@@ -679,3 +679,95 @@ func TestUnmarshal(t *testing.T) {
 		t.Fatal("expected error:", err)
 	}
 }
+
+// Tests that nested arrays and tuples are unpacked recursively, into both the
+// generated anonymous structs and user defined tagged ones.
+func TestUnpackNested(t *testing.T) {
+	const definition = `[
+	{ "name" : "f", "inputs": [
+		{ "name": "a", "type": "uint8[2][]" },
+		{ "name": "b", "type": "tuple[]", "components": [ { "name": "x", "type": "uint256" }, { "name": "y", "type": "string[]" } ] },
+		{ "name": "c", "type": "tuple", "components": [ { "name": "addr", "type": "address" }, { "name": "id", "type": "uint64[2]" } ] } ],
+	  "outputs": [
+		{ "name": "a", "type": "uint8[2][]" },
+		{ "name": "b", "type": "tuple[]", "components": [ { "name": "x", "type": "uint256" }, { "name": "y", "type": "string[]" } ] },
+		{ "name": "c", "type": "tuple", "components": [ { "name": "addr", "type": "address" }, { "name": "id", "type": "uint64[2]" } ] } ] }]`
+
+	abi, err := JSON(strings.NewReader(definition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type inner struct {
+		X     *big.Int
+		Names []string `abi:"y"`
+	}
+	type static struct {
+		Owner common.Address `abi:"addr"`
+		ID    [2]uint64      `abi:"id"`
+	}
+	type result struct {
+		A [][2]uint8
+		B []inner
+		C static
+	}
+	in := result{
+		A: [][2]uint8{{1, 2}, {3, 4}},
+		B: []inner{{big.NewInt(1), []string{"a", "bc"}}, {big.NewInt(2), nil}},
+		C: static{common.Address{1}, [2]uint64{5, 6}},
+	}
+	packed, err := abi.Pack("f", in.A, in.B, in.C)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out result
+	if err := abi.Unpack(&out, "f", packed[4:]); err != nil {
+		t.Fatal(err)
+	}
+	in.B[1].Names = []string{}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("struct roundtrip mismatch:\nhave %+v\nwant %+v", out, in)
+	}
+	// Unpacking into an interface slice yields the generated types
+	var values []interface{}
+	if err := abi.Unpack(&values, "f", packed[4:]); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := reflect.TypeOf(values[1]).String(), "[]struct { X *big.Int; Y []string }"; have != want {
+		t.Errorf("tuple slice type mismatch: have %s, want %s", have, want)
+	}
+	if have := reflect.ValueOf(values[2]).Field(1).Interface(); !reflect.DeepEqual(have, []uint64{5, 6}) {
+		t.Errorf("static tuple field mismatch: have %v, want %v", have, []uint64{5, 6})
+	}
+}
+
+// Tests that offsets and lengths pointing outside of the output are rejected
+// instead of being truncated or overflowing.
+func TestUnpackLengthValidation(t *testing.T) {
+	abi, err := JSON(strings.NewReader(`[
+	{ "name" : "bytes", "outputs": [ { "type": "bytes" } ] },
+	{ "name" : "nested", "outputs": [ { "type": "uint256[][]" } ] }]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		method string
+		output string
+		err    string
+	}{
+		{"bytes", "0000000000000000000000000000000000000000000000000000000000000020" + "0000000000000000000000000000000000000000000000000000000000000021" + "0000000000000000000000000000000000000000000000000000000000000000",
+			"abi: cannot marshal in to go type: length insufficient 96 require 97"},
+		{"bytes", "0000000000000000000000000000000000000000000000000000000000000020" + "0000000000000000000000000000000000000000000000000000000000000100",
+			"abi: cannot marshal in to go type: offset or length 256 exceeds output size 64"},
+		{"bytes", "0000000000000000000000000000000000000000000000010000000000000020" + "0000000000000000000000000000000000000000000000000000000000000000",
+			"abi: cannot marshal in to go type: offset or length 0x0000000000000000000000000000000000000000000000010000000000000020 overflows"},
+		{"nested", "0000000000000000000000000000000000000000000000000000000000000020" + "0000000000000000000000000000000000000000000000000000000000000001" + "0000000000000000000000000000000000000000000000000000000000000020" + "0000000000000000000000000000000000000000000000000000000000000002",
+			"abi: cannot marshal in to go slice: insufficient size output 64 require 128"},
+	}
+	for i, test := range tests {
+		var out interface{}
+		err := abi.Unpack(&out, test.method, common.Hex2Bytes(test.output))
+		if err == nil || err.Error() != test.err {
+			t.Errorf("test %d: error mismatch: have %v, want %s", i, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package external implements an account backend forwarding all signing requests
+// to an external signer process, keeping the private keys out of the node.
+//
+// The signer is reached over IPC or HTTP and has to serve the following methods,
+// each of which it may reject after asking its user for approval:
+//
+//	account_version()                  returns the version of the signer
+//	account_list()                     returns the addresses of the available accounts
+//	account_signData(address, hash)    returns a [R || S || V] signature of the hash
+//	account_signTransaction(args)      returns {"raw": <signed transaction>}
+package external
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Scheme is the URL scheme of wallets served by external signers.
+const Scheme = "extapi"
+
+// errSignerMismatch is returned if an external signer hands back a transaction
+// that isn't the one requested, or isn't signed by the requested account.
+var errSignerMismatch = errors.New("external signer returned a different transaction")
+
+// Backend is an account backend with a single wallet, backed by an external
+// signer.
+type Backend struct {
+	signers []accounts.Wallet
+}
+
+// NewBackend connects to the external signer at the given endpoint, which is
+// either the path of an IPC socket or an HTTP URL.
+func NewBackend(endpoint string) (*Backend, error) {
+	client, err := rpc.Dial(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	backend, err := NewBackendFromClient(client, endpoint)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return backend, nil
+}
+
+// NewBackendFromClient creates a backend over an established connection to an
+// external signer, the endpoint only naming the wallet.
+func NewBackendFromClient(client *rpc.Client, endpoint string) (*Backend, error) {
+	signer, err := newSigner(client, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &Backend{signers: []accounts.Wallet{signer}}, nil
+}
+
+// Wallets implements accounts.Backend, returning the external signer.
+func (b *Backend) Wallets() []accounts.Wallet {
+	return b.signers
+}
+
+// Subscribe implements accounts.Backend. External signers never come or go, so
+// no events are ever sent.
+func (b *Backend) Subscribe(sink chan<- accounts.WalletEvent) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
+// Signer is a wallet whose accounts and keys are managed by an external signer.
+type Signer struct {
+	client   *rpc.Client
+	endpoint string
+	version  string
+
+	lock     sync.Mutex
+	accounts []accounts.Account // Accounts last listed by the signer, nil if never listed
+}
+
+// newSigner creates a wallet over a connection to an external signer, checking
+// that the signer is reachable.
+func newSigner(client *rpc.Client, endpoint string) (*Signer, error) {
+	signer := &Signer{client: client, endpoint: endpoint}
+	if err := client.Call(&signer.version, "account_version"); err != nil {
+		return nil, fmt.Errorf("external signer unreachable: %v", err)
+	}
+	log.Info("Connected to external signer", "endpoint", endpoint, "version", signer.version)
+	return signer, nil
+}
+
+// URL implements accounts.Wallet, returning the endpoint of the signer.
+func (s *Signer) URL() accounts.URL {
+	return accounts.URL{Scheme: Scheme, Path: s.endpoint}
+}
+
+// Status implements accounts.Wallet, returning the version of the signer.
+func (s *Signer) Status() string {
+	return fmt.Sprintf("ok [version=%s]", s.version)
+}
+
+// Open implements accounts.Wallet. The connection is established on creation,
+// so this is a noop.
+func (s *Signer) Open(passphrase string) error {
+	return nil
+}
+
+// Close implements accounts.Wallet, closing the connection to the signer.
+func (s *Signer) Close() error {
+	s.client.Close()
+	return nil
+}
+
+// Accounts implements accounts.Wallet, retrieving the accounts the signer has
+// available.
+func (s *Signer) Accounts() []accounts.Account {
+	var addrs []common.Address
+	if err := s.client.Call(&addrs, "account_list"); err != nil {
+		log.Warn("Failed to list external signer accounts", "err", err)
+
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		return s.accounts
+	}
+	list := make([]accounts.Account, len(addrs))
+	for i, addr := range addrs {
+		list[i] = accounts.Account{Address: addr, URL: s.URL()}
+	}
+	s.lock.Lock()
+	s.accounts = list
+	s.lock.Unlock()
+
+	return list
+}
+
+// Contains implements accounts.Wallet, returning whether the signer has the
+// given account. The signer is only asked again if the account isn't among the
+// ones listed previously.
+func (s *Signer) Contains(account accounts.Account) bool {
+	s.lock.Lock()
+	cached := s.accounts
+	s.lock.Unlock()
+
+	if containsAccount(cached, account) {
+		return true
+	}
+	return containsAccount(s.Accounts(), account)
+}
+
+// containsAccount reports whether an account is in a list, matching addresses
+// only if the account has no URL.
+func containsAccount(list []accounts.Account, account accounts.Account) bool {
+	for _, acc := range list {
+		if acc.Address == account.Address && (account.URL == (accounts.URL{}) || acc.URL == account.URL) {
+			return true
+		}
+	}
+	return false
+}
+
+// Derive implements accounts.Wallet, but is not supported by external signers.
+func (s *Signer) Derive(path accounts.DerivationPath, pin bool) (accounts.Account, error) {
+	return accounts.Account{}, accounts.ErrNotSupported
+}
+
+// SelfDerive implements accounts.Wallet, but is a noop for external signers.
+func (s *Signer) SelfDerive(base accounts.DerivationPath, chain ethereum.ChainStateReader) {
+}
+
+// SignHash implements accounts.Wallet, requesting the signer to sign the given
+// hash. The returned signature has a V value of 0 or 1.
+func (s *Signer) SignHash(account accounts.Account, hash []byte) ([]byte, error) {
+	var sig hexutil.Bytes
+	if err := s.client.Call(&sig, "account_signData", account.Address, hexutil.Bytes(hash)); err != nil {
+		return nil, err
+	}
+	if len(sig) != 65 {
+		return nil, fmt.Errorf("external signer returned %d byte signature", len(sig))
+	}
+	if sig[64] >= 27 {
+		sig[64] -= 27 // Transform yellow paper V from 27/28 to 0/1
+	}
+	return sig, nil
+}
+
+// signTxArgs are the fields of a transaction to sign, in the format understood
+// by external signers.
+type signTxArgs struct {
+	From                 common.Address    `json:"from"`
+	To                   *common.Address   `json:"to"`
+	Gas                  *hexutil.Big      `json:"gas"`
+	GasPrice             *hexutil.Big      `json:"gasPrice,omitempty"`
+	MaxFeePerGas         *hexutil.Big      `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *hexutil.Big      `json:"maxPriorityFeePerGas,omitempty"`
+	Value                *hexutil.Big      `json:"value"`
+	Nonce                hexutil.Uint64    `json:"nonce"`
+	Data                 hexutil.Bytes     `json:"data"`
+	AccessList           *types.AccessList `json:"accessList,omitempty"`
+	ChainID              *hexutil.Big      `json:"chainId,omitempty"`
+}
+
+// signTxResult is the response of an external signer to a transaction signing
+// request.
+type signTxResult struct {
+	Raw hexutil.Bytes `json:"raw"`
+}
+
+// SignTx implements accounts.Wallet, requesting the signer to sign the given
+// transaction. The transaction returned by the signer is checked to be the one
+// requested, signed by the given account.
+func (s *Signer) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	args := signTxArgs{
+		From:  account.Address,
+		To:    tx.To(),
+		Gas:   (*hexutil.Big)(tx.Gas()),
+		Value: (*hexutil.Big)(tx.Value()),
+		Nonce: hexutil.Uint64(tx.Nonce()),
+		Data:  tx.Data(),
+	}
+	if tx.Type() == types.DynamicFeeTxType {
+		args.MaxFeePerGas = (*hexutil.Big)(tx.GasFeeCap())
+		args.MaxPriorityFeePerGas = (*hexutil.Big)(tx.GasTipCap())
+	} else {
+		args.GasPrice = (*hexutil.Big)(tx.GasPrice())
+	}
+	if tx.Type() != types.LegacyTxType {
+		list := tx.AccessList()
+		args.AccessList = &list
+	}
+	if chainID != nil {
+		args.ChainID = (*hexutil.Big)(chainID)
+	}
+	var res signTxResult
+	if err := s.client.Call(&res, "account_signTransaction", &args); err != nil {
+		return nil, err
+	}
+	signed := new(types.Transaction)
+	if err := signed.UnmarshalBinary(res.Raw); err != nil {
+		return nil, err
+	}
+	// Make sure the signer didn't alter the transaction
+	var signer types.Signer = types.HomesteadSigner{}
+	if chainID != nil {
+		signer = types.NewLondonSigner(chainID)
+	}
+	if signed.Type() != tx.Type() || signer.Hash(signed) != signer.Hash(tx) {
+		return nil, errSignerMismatch
+	}
+	if from, err := types.Sender(signer, signed); err != nil || from != account.Address {
+		return nil, errSignerMismatch
+	}
+	return signed, nil
+}
+
+// SignHashWithPassphrase implements accounts.Wallet, but passphrases are handled
+// by the external signer itself.
+func (s *Signer) SignHashWithPassphrase(account accounts.Account, passphrase string, hash []byte) ([]byte, error) {
+	return nil, accounts.ErrNotSupported
+}
+
+// SignTxWithPassphrase implements accounts.Wallet, but passphrases are handled
+// by the external signer itself.
+func (s *Signer) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return nil, accounts.ErrNotSupported
+}
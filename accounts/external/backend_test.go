@@ -0,0 +1,174 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package external
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// MockSigner is an external signer holding a single key, approving all requests
+// unless told to reject them. It can also be told to tamper with transactions.
+type MockSigner struct {
+	key    *ecdsa.PrivateKey
+	reject bool
+	tamper bool
+}
+
+// The RPC server only serves methods with exported argument and result types.
+type (
+	SignTxArgs   signTxArgs
+	SignTxResult signTxResult
+)
+
+func (s *MockSigner) Version() string { return "1.0.0" }
+
+func (s *MockSigner) List() []common.Address {
+	return []common.Address{crypto.PubkeyToAddress(s.key.PublicKey)}
+}
+
+func (s *MockSigner) SignData(addr common.Address, hash hexutil.Bytes) (hexutil.Bytes, error) {
+	if s.reject {
+		return nil, errors.New("request denied")
+	}
+	sig, err := crypto.Sign(hash, s.key)
+	if err != nil {
+		return nil, err
+	}
+	sig[64] += 27
+	return sig, nil
+}
+
+func (s *MockSigner) SignTransaction(args SignTxArgs) (*SignTxResult, error) {
+	if s.reject {
+		return nil, errors.New("request denied")
+	}
+	nonce := uint64(args.Nonce)
+	if s.tamper {
+		nonce++
+	}
+	tx := types.NewTransaction(nonce, *args.To, args.Value.ToInt(), args.Gas.ToInt(), args.GasPrice.ToInt(), args.Data)
+	signed, err := types.SignTx(tx, types.NewLondonSigner(args.ChainID.ToInt()), s.key)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := signed.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &SignTxResult{Raw: raw}, nil
+}
+
+func newTestSigner(t *testing.T) (*Signer, *MockSigner) {
+	key, _ := crypto.GenerateKey()
+	backend := &MockSigner{key: key}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", backend); err != nil {
+		t.Fatalf("failed to register signer: %v", err)
+	}
+	signer, err := newSigner(rpc.DialInProc(server), "test.ipc")
+	if err != nil {
+		t.Fatalf("failed to connect to signer: %v", err)
+	}
+	return signer, backend
+}
+
+// Tests that accounts are listed by the external signer.
+func TestSignerAccounts(t *testing.T) {
+	signer, backend := newTestSigner(t)
+	defer signer.Close()
+
+	addr := crypto.PubkeyToAddress(backend.key.PublicKey)
+	if list := signer.Accounts(); len(list) != 1 || list[0].Address != addr || list[0].URL != signer.URL() {
+		t.Errorf("account list mismatch: have %v, want %x", list, addr)
+	}
+	if !signer.Contains(accounts.Account{Address: addr}) {
+		t.Errorf("signer account not contained")
+	}
+	if signer.Contains(accounts.Account{Address: common.Address{0x01}}) {
+		t.Errorf("unknown account contained")
+	}
+	if have, want := signer.Status(), "ok [version=1.0.0]"; have != want {
+		t.Errorf("status mismatch: have %s, want %s", have, want)
+	}
+}
+
+// Tests that hashes are signed by the external signer, with the signature using
+// the same V values as local wallets, and that rejections are surfaced.
+func TestSignerSignHash(t *testing.T) {
+	signer, backend := newTestSigner(t)
+	defer signer.Close()
+
+	account := accounts.Account{Address: crypto.PubkeyToAddress(backend.key.PublicKey)}
+	hash := crypto.Keccak256([]byte("hello"))
+
+	sig, err := signer.SignHash(account, hash)
+	if err != nil {
+		t.Fatalf("failed to sign hash: %v", err)
+	}
+	pub, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		t.Fatalf("failed to recover signer: %v", err)
+	}
+	if crypto.PubkeyToAddress(*pub) != account.Address {
+		t.Errorf("signer mismatch: have %x, want %x", crypto.PubkeyToAddress(*pub), account.Address)
+	}
+	backend.reject = true
+	if _, err := signer.SignHash(account, hash); err == nil || err.Error() != "request denied" {
+		t.Errorf("rejection error mismatch: %v", err)
+	}
+	if _, err := signer.SignHashWithPassphrase(account, "", hash); err != accounts.ErrNotSupported {
+		t.Errorf("passphrase signing error mismatch: %v", err)
+	}
+}
+
+// Tests that transactions are signed by the external signer, and that altered
+// transactions are rejected.
+func TestSignerSignTx(t *testing.T) {
+	signer, backend := newTestSigner(t)
+	defer signer.Close()
+
+	var (
+		account = accounts.Account{Address: crypto.PubkeyToAddress(backend.key.PublicKey)}
+		chainID = big.NewInt(1)
+		tx      = types.NewTransaction(3, common.Address{0x02}, big.NewInt(1), big.NewInt(21000), big.NewInt(1), nil)
+	)
+	signed, err := signer.SignTx(account, tx, chainID)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	if from, _ := types.Sender(types.NewLondonSigner(chainID), signed); from != account.Address {
+		t.Errorf("sender mismatch: have %x, want %x", from, account.Address)
+	}
+	if signed.Nonce() != tx.Nonce() {
+		t.Errorf("nonce mismatch: have %d, want %d", signed.Nonce(), tx.Nonce())
+	}
+	backend.tamper = true
+	if _, err := signer.SignTx(account, tx, chainID); err != errSignerMismatch {
+		t.Errorf("tampered transaction error mismatch: have %v, want %v", err, errSignerMismatch)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package hdwallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// hardenedOffset is the first index of hardened child keys.
+const hardenedOffset = 0x80000000
+
+// errInvalidKey is returned in the astronomically unlikely case of a derivation
+// producing an invalid key, the next index has to be used instead.
+var errInvalidKey = errors.New("derived key invalid")
+
+// extendedKey is a BIP-32 extended private key.
+type extendedKey struct {
+	key       *big.Int
+	chainCode []byte
+}
+
+// newMasterKey derives the root of the key tree from a seed.
+func newMasterKey(seed []byte) (*extendedKey, error) {
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	key := new(big.Int).SetBytes(sum[:32])
+	if key.Sign() == 0 || key.Cmp(crypto.S256().Params().N) >= 0 {
+		return nil, errInvalidKey
+	}
+	return &extendedKey{key: key, chainCode: sum[32:]}, nil
+}
+
+// child derives the child key at the given index, hardened if the index is at
+// least 2^31.
+func (k *extendedKey) child(index uint32) (*extendedKey, error) {
+	var data []byte
+	if index >= hardenedOffset {
+		data = append([]byte{0x00}, math.PaddedBigBytes(k.key, 32)...)
+	} else {
+		data = k.publicKey()
+	}
+	data = append(data, make([]byte, 4)...)
+	binary.BigEndian.PutUint32(data[len(data)-4:], index)
+
+	mac := hmac.New(sha512.New, k.chainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	n := crypto.S256().Params().N
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(n) >= 0 {
+		return nil, errInvalidKey
+	}
+	key := tweak.Add(tweak, k.key)
+	key.Mod(key, n)
+	if key.Sign() == 0 {
+		return nil, errInvalidKey
+	}
+	return &extendedKey{key: key, chainCode: sum[32:]}, nil
+}
+
+// derive derives the key at the given path below this one.
+func (k *extendedKey) derive(path accounts.DerivationPath) (*extendedKey, error) {
+	var err error
+	for _, index := range path {
+		if k, err = k.child(index); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// publicKey returns the compressed public key of the extended key.
+func (k *extendedKey) publicKey() []byte {
+	x, y := crypto.S256().ScalarBaseMult(math.PaddedBigBytes(k.key, 32))
+	return append([]byte{0x02 + byte(y.Bit(0))}, math.PaddedBigBytes(x, 32)...)
+}
+
+// privateKey returns the extended key as an ECDSA private key.
+func (k *extendedKey) privateKey() (*ecdsa.PrivateKey, error) {
+	return crypto.ToECDSA(math.PaddedBigBytes(k.key, 32))
+}
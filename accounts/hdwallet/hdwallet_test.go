@@ -0,0 +1,237 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package hdwallet
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+// Tests that the wordlist matches the English list of the BIP-39 specification.
+func TestWordlist(t *testing.T) {
+	sum := sha256.Sum256([]byte(strings.Join(wordlist, "\n") + "\n"))
+	if have, want := hex.EncodeToString(sum[:]), "2f5eed53a4727b4bf8880d8f3f199efc90e58503646d9ff8eff3a2ed3b24dbda"; have != want {
+		t.Errorf("wordlist hash mismatch: have %s, want %s", have, want)
+	}
+}
+
+// Tests mnemonic encoding and seed generation against the BIP-39 test vectors.
+func TestMnemonicSeed(t *testing.T) {
+	tests := []struct {
+		entropy  string
+		mnemonic string
+		seed     string
+	}{
+		{
+			"00000000000000000000000000000000",
+			testMnemonic,
+			"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+		},
+		{
+			"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+			"legal winner thank year wave sausage worth useful legal winner thank yellow",
+			"2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+		},
+		{
+			"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+			"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote",
+			"dd48c104698c30cfe2b6142103248622fb7bb0ff692eebb00089b32d22484e1613912f0a5b694407be899ffd31ed3992c456cdf60f5d4564b8ba3f05a69890ad",
+		},
+	}
+	for i, tt := range tests {
+		entropy := common.FromHex(tt.entropy)
+		if mnemonic := entropyToMnemonic(entropy); mnemonic != tt.mnemonic {
+			t.Errorf("test %d: mnemonic mismatch: have %q, want %q", i, mnemonic, tt.mnemonic)
+		}
+		decoded, err := mnemonicToEntropy(tt.mnemonic)
+		if err != nil || hex.EncodeToString(decoded) != tt.entropy {
+			t.Errorf("test %d: entropy mismatch: have %x, want %s (err %v)", i, decoded, tt.entropy, err)
+		}
+		seed, err := NewSeed(tt.mnemonic, "TREZOR")
+		if err != nil || hex.EncodeToString(seed) != tt.seed {
+			t.Errorf("test %d: seed mismatch: have %x, want %s (err %v)", i, seed, tt.seed, err)
+		}
+	}
+}
+
+// Tests that invalid mnemonics are rejected.
+func TestMnemonicValidation(t *testing.T) {
+	tests := []struct {
+		mnemonic string
+		err      string
+	}{
+		{"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon", "invalid mnemonic checksum"},
+		{"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon", "invalid mnemonic length 11"},
+		{"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon ethereum", `unknown mnemonic word "ethereum"`},
+	}
+	for i, tt := range tests {
+		if err := ValidateMnemonic(tt.mnemonic); err == nil || err.Error() != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %s", i, err, tt.err)
+		}
+	}
+	for _, words := range []int{12, 15, 18, 21, 24} {
+		mnemonic, err := NewMnemonic(words)
+		if err != nil {
+			t.Fatalf("failed to generate %d word mnemonic: %v", words, err)
+		}
+		if err := ValidateMnemonic(mnemonic); err != nil || len(strings.Fields(mnemonic)) != words {
+			t.Errorf("generated mnemonic %q invalid: %v", mnemonic, err)
+		}
+	}
+	if _, err := NewMnemonic(13); err == nil {
+		t.Errorf("generated mnemonic of invalid length")
+	}
+}
+
+// Tests BIP-32 derivation against the first BIP-32 test vector.
+func TestDerivation(t *testing.T) {
+	master, err := newMasterKey(common.FromHex("000102030405060708090a0b0c0d0e0f"))
+	if err != nil {
+		t.Fatalf("failed to create master key: %v", err)
+	}
+	tests := []struct {
+		path accounts.DerivationPath
+		key  string
+	}{
+		{accounts.DerivationPath{}, "e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35"},
+		{accounts.DerivationPath{0x80000000}, "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea"},
+		{accounts.DerivationPath{0x80000000, 1}, "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368"},
+		{accounts.DerivationPath{0x80000000, 1, 0x80000002, 2, 1000000000}, "471b76e389e528d6de6d816857e012c5455051cad6660850e58372a6c3e6e7c8"},
+	}
+	for i, tt := range tests {
+		child, err := master.derive(tt.path)
+		if err != nil {
+			t.Fatalf("test %d: failed to derive key: %v", i, err)
+		}
+		if have := hex.EncodeToString(child.key.Bytes()); have != tt.key {
+			t.Errorf("test %d: key mismatch: have %s, want %s", i, have, tt.key)
+		}
+	}
+}
+
+// Tests that wallets derive the standard Ethereum accounts and sign with them.
+func TestWallet(t *testing.T) {
+	hub := NewHub()
+	wallet, err := hub.Import(testMnemonic, "")
+	if err != nil {
+		t.Fatalf("failed to import wallet: %v", err)
+	}
+	if again, _ := hub.Import(testMnemonic, ""); again != wallet || len(hub.Wallets()) != 1 {
+		t.Errorf("reimported wallet duplicated")
+	}
+	if other, _ := hub.Import(testMnemonic, "TREZOR"); other == wallet || len(hub.Wallets()) != 2 {
+		t.Errorf("wallet with passphrase not separated")
+	}
+	path, _ := accounts.ParseDerivationPath("m/44'/60'/0'/0/0")
+	account, err := wallet.Derive(path, true)
+	if err != nil {
+		t.Fatalf("failed to derive account: %v", err)
+	}
+	if want := common.HexToAddress("0x9858EfFD232B4033E47d90003D41EC34EcaEda94"); account.Address != want {
+		t.Errorf("derived address mismatch: have %x, want %x", account.Address, want)
+	}
+	if !wallet.Contains(account) {
+		t.Errorf("pinned account not contained")
+	}
+	hash := crypto.Keccak256([]byte("hello"))
+	sig, err := wallet.SignHash(account, hash)
+	if err != nil {
+		t.Fatalf("failed to sign hash: %v", err)
+	}
+	if pub, err := crypto.SigToPub(hash, sig); err != nil || crypto.PubkeyToAddress(*pub) != account.Address {
+		t.Errorf("hash signer mismatch: %v", err)
+	}
+	chainID := big.NewInt(1)
+	tx, err := wallet.SignTx(account, types.NewTransaction(0, common.Address{}, new(big.Int), big.NewInt(21000), new(big.Int), nil), chainID)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	if from, _ := types.Sender(types.NewLondonSigner(chainID), tx); from != account.Address {
+		t.Errorf("transaction sender mismatch: have %x, want %x", from, account.Address)
+	}
+	if _, err := wallet.SignHash(accounts.Account{Address: common.Address{0x01}}, hash); err != accounts.ErrUnknownAccount {
+		t.Errorf("unknown account error mismatch: have %v, want %v", err, accounts.ErrUnknownAccount)
+	}
+}
+
+// testChain is a chain state reader reporting the nonces of used accounts.
+type testChain map[common.Address]uint64
+
+func (c testChain) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	return new(big.Int), nil
+}
+
+func (c testChain) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error) {
+	return nil, nil
+}
+
+func (c testChain) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	return nil, nil
+}
+
+func (c testChain) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	return c[account], nil
+}
+
+// Tests that self-derivation discovers the used accounts and the first unused.
+func TestSelfDerive(t *testing.T) {
+	seed, _ := NewSeed(testMnemonic, "")
+	wallet, err := newWallet(seed)
+	if err != nil {
+		t.Fatalf("failed to create wallet: %v", err)
+	}
+	var (
+		chain = make(testChain)
+		addrs []common.Address
+	)
+	for i := 0; i < 4; i++ {
+		path := append(accounts.DerivationPath{}, accounts.DefaultBaseDerivationPath...)
+		path[len(path)-1] = uint32(i)
+
+		account, err := wallet.Derive(path, false)
+		if err != nil {
+			t.Fatalf("failed to derive account %d: %v", i, err)
+		}
+		addrs = append(addrs, account.Address)
+	}
+	chain[addrs[0]], chain[addrs[1]] = 1, 5
+
+	wallet.SelfDerive(accounts.DefaultBaseDerivationPath, chain)
+	if have := wallet.Accounts(); len(have) != 3 || have[0].Address != addrs[0] || have[2].Address != addrs[2] {
+		t.Fatalf("discovered accounts mismatch: have %v, want %x", have, addrs[:3])
+	}
+	// Use the next account and make sure it's discovered once the throttling passes
+	chain[addrs[2]] = 1
+	if have := wallet.Accounts(); len(have) != 3 {
+		t.Errorf("discovery not throttled: have %d accounts", len(have))
+	}
+	wallet.deriveTime = wallet.deriveTime.Add(-selfDeriveThrottling)
+	if have := wallet.Accounts(); len(have) != 4 || have[3].Address != addrs[3] {
+		t.Errorf("newly used account not discovered: have %v", have)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package hdwallet implements software hierarchical deterministic wallets, with
+// the accounts derived as per BIP-32 from a BIP-39 mnemonic seed phrase.
+//
+// The seeds are only held in memory, wallets have to be imported again from
+// their mnemonic after each restart.
+package hdwallet
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+// Scheme is the protocol scheme prefixing HD wallet and account URLs.
+const Scheme = "hd"
+
+// HubType is the reflect type of an HD wallet backend.
+var HubType = reflect.TypeOf(&Hub{})
+
+// Hub is an account backend holding the HD wallets imported into it.
+type Hub struct {
+	wallets []accounts.Wallet // HD wallets imported, sorted by URL
+
+	updateFeed  event.Feed              // Event feed to notify wallet additions
+	updateScope event.SubscriptionScope // Subscription scope tracking current live listeners
+
+	lock sync.RWMutex
+}
+
+// NewHub creates an HD wallet backend without any wallets.
+func NewHub() *Hub {
+	return new(Hub)
+}
+
+// Wallets implements accounts.Backend, returning the imported wallets.
+func (hub *Hub) Wallets() []accounts.Wallet {
+	hub.lock.RLock()
+	defer hub.lock.RUnlock()
+
+	cpy := make([]accounts.Wallet, len(hub.wallets))
+	copy(cpy, hub.wallets)
+	return cpy
+}
+
+// Subscribe implements accounts.Backend, creating an async subscription to
+// receive notifications on the import of wallets.
+func (hub *Hub) Subscribe(sink chan<- accounts.WalletEvent) event.Subscription {
+	return hub.updateScope.Track(hub.updateFeed.Subscribe(sink))
+}
+
+// Import creates a wallet from a BIP-39 mnemonic and an optional passphrase. If
+// the wallet was already imported, the existing one is returned.
+func (hub *Hub) Import(mnemonic string, passphrase string) (accounts.Wallet, error) {
+	seed, err := NewSeed(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return hub.ImportSeed(seed)
+}
+
+// ImportSeed creates a wallet from a BIP-32 seed. If the wallet was already
+// imported, the existing one is returned.
+func (hub *Hub) ImportSeed(seed []byte) (accounts.Wallet, error) {
+	wallet, err := newWallet(seed)
+	if err != nil {
+		return nil, err
+	}
+	hub.lock.Lock()
+	for _, known := range hub.wallets {
+		if known.URL() == wallet.URL() {
+			hub.lock.Unlock()
+			return known, nil
+		}
+	}
+	n := sort.Search(len(hub.wallets), func(i int) bool { return hub.wallets[i].URL().Cmp(wallet.URL()) >= 0 })
+	hub.wallets = append(hub.wallets[:n], append([]accounts.Wallet{wallet}, hub.wallets[n:]...)...)
+	hub.lock.Unlock()
+
+	hub.updateFeed.Send(accounts.WalletEvent{Wallet: wallet, Arrive: true})
+	return wallet, nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package hdwallet
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// seedIterations is the number of PBKDF2 rounds stretching a mnemonic into a seed.
+const seedIterations = 2048
+
+var errInvalidChecksum = errors.New("invalid mnemonic checksum")
+
+// wordIndex maps the words of the wordlist to their index.
+var wordIndex = make(map[string]int, len(wordlist))
+
+func init() {
+	for i, word := range wordlist {
+		wordIndex[word] = i
+	}
+}
+
+// NewMnemonic generates a random BIP-39 mnemonic with the given number of words,
+// which must be 12, 15, 18, 21 or 24.
+func NewMnemonic(words int) (string, error) {
+	if words < 12 || words > 24 || words%3 != 0 {
+		return "", fmt.Errorf("invalid mnemonic length %d", words)
+	}
+	entropy := make([]byte, words/3*4)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", err
+	}
+	return entropyToMnemonic(entropy), nil
+}
+
+// entropyToMnemonic encodes entropy into words of 11 bits, the entropy being
+// followed by a checksum of one bit per 32 bits of entropy.
+func entropyToMnemonic(entropy []byte) string {
+	bits := len(entropy) * 8
+	sum := sha256.Sum256(entropy)
+
+	data := new(big.Int).SetBytes(entropy)
+	data.Lsh(data, uint(bits/32))
+	data.Or(data, big.NewInt(int64(sum[0]>>(8-uint(bits/32)))))
+
+	words := make([]string, (bits+bits/32)/11)
+	mask := big.NewInt(2047)
+	for i := len(words) - 1; i >= 0; i-- {
+		words[i] = wordlist[new(big.Int).And(data, mask).Int64()]
+		data.Rsh(data, 11)
+	}
+	return strings.Join(words, " ")
+}
+
+// mnemonicToEntropy decodes the entropy a mnemonic was created from, verifying
+// its checksum.
+func mnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return nil, fmt.Errorf("invalid mnemonic length %d", len(words))
+	}
+	data := new(big.Int)
+	for _, word := range words {
+		index, ok := wordIndex[word]
+		if !ok {
+			return nil, fmt.Errorf("unknown mnemonic word %q", word)
+		}
+		data.Lsh(data, 11)
+		data.Or(data, big.NewInt(int64(index)))
+	}
+	checksumBits := uint(len(words) / 3)
+	checksum := new(big.Int).And(data, big.NewInt(1<<checksumBits-1))
+	data.Rsh(data, checksumBits)
+
+	entropy := make([]byte, len(words)/3*4)
+	blob := data.Bytes()
+	copy(entropy[len(entropy)-len(blob):], blob)
+
+	sum := sha256.Sum256(entropy)
+	if checksum.Int64() != int64(sum[0]>>(8-checksumBits)) {
+		return nil, errInvalidChecksum
+	}
+	return entropy, nil
+}
+
+// ValidateMnemonic checks that a mnemonic consists of words of the wordlist and
+// that its checksum is valid.
+func ValidateMnemonic(mnemonic string) error {
+	_, err := mnemonicToEntropy(mnemonic)
+	return err
+}
+
+// NewSeed validates a mnemonic and stretches it into a BIP-32 seed, protected by
+// an optional passphrase. Passphrases are used as given, they are expected to be
+// in Unicode NFKD form.
+func NewSeed(mnemonic string, passphrase string) ([]byte, error) {
+	if err := ValidateMnemonic(mnemonic); err != nil {
+		return nil, err
+	}
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+	return pbkdf2.Key([]byte(mnemonic), []byte("mnemonic"+passphrase), seedIterations, 64, sha512.New), nil
+}
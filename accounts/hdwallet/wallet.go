@@ -0,0 +1,257 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package hdwallet
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// selfDeriveThrottling is the minimum time between two account discoveries.
+const selfDeriveThrottling = time.Second
+
+// wallet is a software hierarchical deterministic wallet, deriving its accounts
+// from a BIP-32 seed held in memory.
+type wallet struct {
+	url    accounts.URL
+	master *extendedKey
+
+	stateLock sync.RWMutex
+	accounts  []accounts.Account                         // Accounts pinned to the wallet
+	paths     map[common.Address]accounts.DerivationPath // Derivation paths of the pinned accounts
+
+	deriveNextPath accounts.DerivationPath   // Next derivation path for account auto-discovery
+	deriveChain    ethereum.ChainStateReader // Blockchain state reader to discover used account with
+	deriveTime     time.Time                 // Time of the last account discovery
+}
+
+// newWallet creates a wallet from a BIP-32 seed. The wallet is identified by a
+// fingerprint of its master key, which reveals nothing about its accounts.
+func newWallet(seed []byte) (*wallet, error) {
+	master, err := newMasterKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	return &wallet{
+		url:    accounts.URL{Scheme: Scheme, Path: fmt.Sprintf("%x", crypto.Keccak256(master.publicKey())[:8])},
+		master: master,
+		paths:  make(map[common.Address]accounts.DerivationPath),
+	}, nil
+}
+
+// URL implements accounts.Wallet, returning the fingerprint of the wallet.
+func (w *wallet) URL() accounts.URL {
+	return w.url
+}
+
+// Status implements accounts.Wallet, the seed being always available.
+func (w *wallet) Status() string {
+	return "Unlocked"
+}
+
+// Open implements accounts.Wallet, but is a noop since the seed is decoded when
+// importing the wallet.
+func (w *wallet) Open(passphrase string) error { return nil }
+
+// Close implements accounts.Wallet, but is a noop since the wallet only lives in
+// memory.
+func (w *wallet) Close() error { return nil }
+
+// Accounts implements accounts.Wallet, returning the pinned accounts, extended
+// with any used accounts discovered if self-derivation is enabled.
+func (w *wallet) Accounts() []accounts.Account {
+	w.selfDerive()
+
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	cpy := make([]accounts.Account, len(w.accounts))
+	copy(cpy, w.accounts)
+	return cpy
+}
+
+// selfDerive pins the accounts following the self-derivation path up to and
+// including the first one without any balance or nonce.
+func (w *wallet) selfDerive() {
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	if w.deriveChain == nil || time.Since(w.deriveTime) < selfDeriveThrottling {
+		return
+	}
+	w.deriveTime = time.Now()
+
+	for {
+		path := make(accounts.DerivationPath, len(w.deriveNextPath))
+		copy(path, w.deriveNextPath)
+
+		addr, err := w.address(path)
+		if err != nil {
+			log.Warn("HD wallet account derivation failed", "path", path, "err", err)
+			return
+		}
+		balance, err := w.deriveChain.BalanceAt(context.Background(), addr, nil)
+		if err != nil {
+			log.Warn("HD wallet balance retrieval failed", "err", err)
+			return
+		}
+		nonce, err := w.deriveChain.NonceAt(context.Background(), addr, nil)
+		if err != nil {
+			log.Warn("HD wallet nonce retrieval failed", "err", err)
+			return
+		}
+		if _, known := w.paths[addr]; !known {
+			log.Info("HD wallet discovered new account", "address", addr, "path", path, "balance", balance, "nonce", nonce)
+			w.pin(addr, path)
+		}
+		// Stop at the first unused account, checking it again next time
+		if balance.Sign() == 0 && nonce == 0 {
+			return
+		}
+		w.deriveNextPath[len(w.deriveNextPath)-1]++
+	}
+}
+
+// Contains implements accounts.Wallet, returning whether an account is pinned
+// to the wallet.
+func (w *wallet) Contains(account accounts.Account) bool {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	_, exists := w.paths[account.Address]
+	return exists
+}
+
+// Derive implements accounts.Wallet, deriving the account at the given path and
+// pinning it to the wallet if requested.
+func (w *wallet) Derive(path accounts.DerivationPath, pin bool) (accounts.Account, error) {
+	addr, err := w.address(path)
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	account := accounts.Account{Address: addr, URL: w.accountURL(path)}
+	if !pin {
+		return account, nil
+	}
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	if _, ok := w.paths[addr]; !ok {
+		w.pin(addr, path)
+	}
+	return account, nil
+}
+
+// SelfDerive implements accounts.Wallet, discovering the used accounts following
+// the base path based on the chain state. Discovery runs when listing accounts.
+func (w *wallet) SelfDerive(base accounts.DerivationPath, chain ethereum.ChainStateReader) {
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	w.deriveNextPath = make(accounts.DerivationPath, len(base))
+	copy(w.deriveNextPath, base)
+
+	w.deriveChain = chain
+	w.deriveTime = time.Time{}
+}
+
+// SignHash implements accounts.Wallet, signing a hash with the key of a pinned
+// account.
+func (w *wallet) SignHash(account accounts.Account, hash []byte) ([]byte, error) {
+	key, err := w.key(account)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Sign(hash, key)
+}
+
+// SignTx implements accounts.Wallet, signing a transaction with the key of a
+// pinned account.
+func (w *wallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	key, err := w.key(account)
+	if err != nil {
+		return nil, err
+	}
+	// Depending on the presence of the chain ID, sign with EIP1559/EIP2930/EIP155 or homestead
+	if chainID != nil {
+		return types.SignTx(tx, types.NewLondonSigner(chainID), key)
+	}
+	return types.SignTx(tx, types.HomesteadSigner{}, key)
+}
+
+// SignHashWithPassphrase implements accounts.Wallet, but HD wallets have no
+// passphrase once imported.
+func (w *wallet) SignHashWithPassphrase(account accounts.Account, passphrase string, hash []byte) ([]byte, error) {
+	return nil, accounts.ErrNotSupported
+}
+
+// SignTxWithPassphrase implements accounts.Wallet, but HD wallets have no
+// passphrase once imported.
+func (w *wallet) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return nil, accounts.ErrNotSupported
+}
+
+// pin adds an account to the tracked ones. The caller must hold the state lock.
+func (w *wallet) pin(addr common.Address, path accounts.DerivationPath) {
+	w.accounts = append(w.accounts, accounts.Account{Address: addr, URL: w.accountURL(path)})
+	w.paths[addr] = path
+}
+
+// accountURL returns the URL of the account at the given path.
+func (w *wallet) accountURL(path accounts.DerivationPath) accounts.URL {
+	return accounts.URL{Scheme: w.url.Scheme, Path: fmt.Sprintf("%s/%s", w.url.Path, path)}
+}
+
+// address derives the address of the account at the given path.
+func (w *wallet) address(path accounts.DerivationPath) (common.Address, error) {
+	child, err := w.master.derive(path)
+	if err != nil {
+		return common.Address{}, err
+	}
+	key, err := child.privateKey()
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(key.PublicKey), nil
+}
+
+// key derives the private key of a pinned account.
+func (w *wallet) key(account accounts.Account) (*ecdsa.PrivateKey, error) {
+	w.stateLock.RLock()
+	path, ok := w.paths[account.Address]
+	w.stateLock.RUnlock()
+
+	if !ok {
+		return nil, accounts.ErrUnknownAccount
+	}
+	child, err := w.master.derive(path)
+	if err != nil {
+		return nil, err
+	}
+	return child.privateKey()
+}
@@ -20,7 +20,6 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
@@ -69,6 +68,7 @@ type accountCache struct {
 	mu       sync.Mutex
 	all      accountsByURL
 	byAddr   map[common.Address][]accounts.Account
+	files    fileCache
 	throttle *time.Timer
 	notify   chan struct{}
 }
@@ -103,6 +103,12 @@ func (ac *accountCache) add(newAccount accounts.Account) {
 	ac.mu.Lock()
 	defer ac.mu.Unlock()
 
+	ac.insert(newAccount)
+}
+
+// insert adds an account to the cache, keeping it sorted by URL.
+// Callers must hold ac.mu.
+func (ac *accountCache) insert(newAccount accounts.Account) {
 	i := sort.Search(len(ac.all), func(i int) bool { return ac.all[i].URL.Cmp(newAccount.URL) >= 0 })
 	if i < len(ac.all) && ac.all[i] == newAccount {
 		return
@@ -119,6 +125,24 @@ func (ac *accountCache) delete(removed accounts.Account) {
 	ac.mu.Lock()
 	defer ac.mu.Unlock()
 
+	ac.remove(removed)
+}
+
+// deleteByFile removes the account stored in the given key file, returning it
+// if it was cached. Callers must hold ac.mu.
+func (ac *accountCache) deleteByFile(path string) (accounts.Account, bool) {
+	for _, a := range ac.all {
+		if a.URL.Path == path {
+			ac.remove(a)
+			return a, true
+		}
+	}
+	return accounts.Account{}, false
+}
+
+// remove drops an account from both the sorted list and the address index.
+// Callers must hold ac.mu.
+func (ac *accountCache) remove(removed accounts.Account) {
 	ac.all = removeAccount(ac.all, removed)
 	if ba := removeAccount(ac.byAddr[removed.Address], removed); len(ba) == 0 {
 		delete(ac.byAddr, removed.Address)
@@ -205,70 +229,70 @@ func (ac *accountCache) close() {
 	ac.mu.Unlock()
 }
 
-// reload caches addresses of existing accounts.
+// reload updates the cache with the key files created, deleted or modified
+// since the last reload, leaving the accounts of untouched files as they are.
 // Callers must hold ac.mu.
 func (ac *accountCache) reload() {
-	accounts, err := ac.scan()
+	creates, deletes, updates, err := ac.files.scan(ac.keydir)
 	if err != nil {
 		log.Debug("Failed to reload keystore contents", "err", err)
 	}
-	ac.all = accounts
-	sort.Sort(ac.all)
-	for k := range ac.byAddr {
-		delete(ac.byAddr, k)
+	if len(creates) == 0 && len(deletes) == 0 && len(updates) == 0 {
+		return
+	}
+	for _, path := range deletes {
+		ac.deleteByFile(path)
 	}
-	for _, a := range accounts {
-		ac.byAddr[a.Address] = append(ac.byAddr[a.Address], a)
+	for _, path := range creates {
+		if a, ok := readAccount(path); ok {
+			ac.insert(a)
+		}
+	}
+	for _, path := range updates {
+		// Key files are written atomically and never modified in place, so any
+		// change to a known key file is either a replacement or tampering.
+		old, known := ac.deleteByFile(path)
+		a, ok := readAccount(path)
+		if known && (!ok || a.Address != old.Address) {
+			log.Warn("Keystore file content changed", "path", path, "old", old.Address, "new", a.Address)
+		}
+		if ok {
+			ac.insert(a)
+		}
 	}
 	select {
 	case ac.notify <- struct{}{}:
 	default:
 	}
-	log.Debug("Reloaded keystore contents", "accounts", len(ac.all))
+	log.Debug("Reloaded keystore contents", "accounts", len(ac.all), "created", len(creates), "deleted", len(deletes), "updated", len(updates))
 }
 
-func (ac *accountCache) scan() ([]accounts.Account, error) {
-	files, err := ioutil.ReadDir(ac.keydir)
+// readAccount parses the address out of a key file, returning false if the file
+// cannot be read or does not contain a valid key.
+func readAccount(path string) (accounts.Account, bool) {
+	logger := log.New("path", path)
+
+	fd, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		logger.Trace("Failed to open keystore file", "err", err)
+		return accounts.Account{}, false
 	}
+	defer fd.Close()
 
-	var (
-		buf     = new(bufio.Reader)
-		addrs   []accounts.Account
-		keyJSON struct {
-			Address string `json:"address"`
-		}
-	)
-	for _, fi := range files {
-		path := filepath.Join(ac.keydir, fi.Name())
-		if skipKeyFile(fi) {
-			log.Trace("Ignoring file on account scan", "path", path)
-			continue
-		}
-		logger := log.New("path", path)
-
-		fd, err := os.Open(path)
-		if err != nil {
-			logger.Trace("Failed to open keystore file", "err", err)
-			continue
-		}
-		buf.Reset(fd)
-		// Parse the address.
-		keyJSON.Address = ""
-		err = json.NewDecoder(buf).Decode(&keyJSON)
-		addr := common.HexToAddress(keyJSON.Address)
-		switch {
-		case err != nil:
-			logger.Debug("Failed to decode keystore key", "err", err)
-		case (addr == common.Address{}):
-			logger.Debug("Failed to decode keystore key", "err", "missing or zero address")
-		default:
-			addrs = append(addrs, accounts.Account{Address: addr, URL: accounts.URL{Scheme: KeyStoreScheme, Path: path}})
-		}
-		fd.Close()
+	var keyJSON struct {
+		Address string `json:"address"`
+	}
+	err = json.NewDecoder(bufio.NewReader(fd)).Decode(&keyJSON)
+	addr := common.HexToAddress(keyJSON.Address)
+	switch {
+	case err != nil:
+		logger.Debug("Failed to decode keystore key", "err", err)
+	case (addr == common.Address{}):
+		logger.Debug("Failed to decode keystore key", "err", "missing or zero address")
+	default:
+		return accounts.Account{Address: addr, URL: accounts.URL{Scheme: KeyStoreScheme, Path: path}}, true
 	}
-	return addrs, err
+	return accounts.Account{}, false
 }
 
 func skipKeyFile(fi os.FileInfo) bool {
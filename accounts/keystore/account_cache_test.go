@@ -18,6 +18,7 @@ package keystore
 
 import (
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
@@ -139,6 +140,79 @@ func TestCacheInitialReload(t *testing.T) {
 	}
 }
 
+// Tests that reloads pick up key files created, replaced and deleted since the
+// previous reload, keeping the cache sorted.
+func TestCacheReloadChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eth-keystore-reload-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache, notify := newAccountCache(dir)
+	cache.watcher.running = true // prevent unexpected reloads
+
+	reload := func() []accounts.Account {
+		cache.mu.Lock()
+		cache.reload()
+		cache.mu.Unlock()
+		return cache.accounts()
+	}
+	account := func(i int, name string) accounts.Account {
+		return accounts.Account{Address: cachetestAccounts[i].Address, URL: accounts.URL{Scheme: KeyStoreScheme, Path: filepath.Join(dir, name)}}
+	}
+	write := func(name string, i int) {
+		content, err := ioutil.ReadFile(cachetestAccounts[i].URL.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), content, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Create a few key files and an invalid one, ensuring only keys are cached
+	write("zzz", 0)
+	write("aaa", 1)
+	if err := ioutil.WriteFile(filepath.Join(dir, "bbb"), []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	want := []accounts.Account{account(1, "aaa"), account(0, "zzz")}
+	if list := reload(); !reflect.DeepEqual(list, want) {
+		t.Fatalf("created accounts mismatch: have %s, want %s", spew.Sdump(list), spew.Sdump(want))
+	}
+	select {
+	case <-notify:
+	default:
+		t.Fatalf("wasn't notified of new accounts")
+	}
+	// Reloading without changes must not notify
+	reload()
+	select {
+	case <-notify:
+		t.Fatalf("notified without changes")
+	default:
+	}
+	// Replace the content of a key file, fix the invalid one and delete another
+	write("zzz", 2)
+	write("bbb", 0)
+	future := time.Now().Add(time.Minute)
+	for _, name := range []string{"zzz", "bbb"} {
+		if err := os.Chtimes(filepath.Join(dir, name), future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Remove(filepath.Join(dir, "aaa")); err != nil {
+		t.Fatal(err)
+	}
+	want = []accounts.Account{account(0, "bbb"), account(2, "zzz")}
+	if list := reload(); !reflect.DeepEqual(list, want) {
+		t.Fatalf("updated accounts mismatch: have %s, want %s", spew.Sdump(list), spew.Sdump(want))
+	}
+	if cache.hasAddress(cachetestAccounts[1].Address) {
+		t.Errorf("deleted account still cached")
+	}
+}
+
 func TestCacheAddDeleteOrder(t *testing.T) {
 	cache, _ := newAccountCache("testdata/no-such-dir")
 	cache.watcher.running = true // prevent unexpected reloads
@@ -0,0 +1,68 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package keystore
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// fileStat is the part of a key file's metadata used to detect modifications.
+type fileStat struct {
+	modTime time.Time
+	size    int64
+}
+
+// fileCache tracks the key files of a keystore folder, so that reloads only need
+// to parse the files that changed since the previous scan.
+type fileCache struct {
+	all map[string]fileStat // Metadata of the key files seen during the last scan
+}
+
+// scan lists the key files in keyDir, returning the paths of the ones created,
+// deleted and modified since the previous scan. An unreadable folder is treated
+// as empty, dropping the files of a removed keystore.
+func (fc *fileCache) scan(keyDir string) (creates, deletes, updates []string, err error) {
+	files, err := ioutil.ReadDir(keyDir)
+
+	all := make(map[string]fileStat, len(files))
+	for _, fi := range files {
+		path := filepath.Join(keyDir, fi.Name())
+		if skipKeyFile(fi) {
+			log.Trace("Ignoring file on account scan", "path", path)
+			continue
+		}
+		stat := fileStat{modTime: fi.ModTime(), size: fi.Size()}
+		all[path] = stat
+
+		if old, ok := fc.all[path]; !ok {
+			creates = append(creates, path)
+		} else if !old.modTime.Equal(stat.modTime) || old.size != stat.size {
+			updates = append(updates, path)
+		}
+	}
+	for path := range fc.all {
+		if _, ok := all[path]; !ok {
+			deletes = append(deletes, path)
+		}
+	}
+	fc.all = all
+	return creates, deletes, updates, err
+}
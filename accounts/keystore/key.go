@@ -205,6 +205,13 @@ func writeKeyFile(file string, content []byte) error {
 		os.Remove(f.Name())
 		return err
 	}
+	// Flush the content to disk before the rename, otherwise a crash could
+	// leave an empty key file behind in place of the real one.
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
 	f.Close()
 	return os.Rename(f.Name(), file)
 }
@@ -22,7 +22,9 @@ package keystore
 
 import (
 	"crypto/ecdsa"
+	"crypto/hmac"
 	crand "crypto/rand"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"math/big"
@@ -37,6 +39,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/randentropy"
 	"github.com/ethereum/go-ethereum/event"
 )
 
@@ -61,6 +64,7 @@ type KeyStore struct {
 	cache    *accountCache                // In-memory account cache over the filesystem storage
 	changes  chan struct{}                // Channel receiving change notifications from the cache
 	unlocked map[common.Address]*unlocked // Currently unlocked account (decrypted private keys)
+	authKey  []byte                       // Random secret keying the passphrase digests of unlocked accounts
 
 	wallets     []accounts.Wallet       // Wallet wrappers around the individual key files
 	updateFeed  event.Feed              // Event feed to notify wallet additions/removals
@@ -72,6 +76,7 @@ type KeyStore struct {
 
 type unlocked struct {
 	*Key
+	auth  []byte // Keyed digest of the passphrase the account was unlocked with
 	abort chan struct{}
 }
 
@@ -99,6 +104,7 @@ func (ks *KeyStore) init(keydir string) {
 
 	// Initialize the set of unlocked keys and the account cache
 	ks.unlocked = make(map[common.Address]*unlocked)
+	ks.authKey = randentropy.GetEntropyCSPRNG(32)
 	ks.cache, ks.changes = newAccountCache(keydir)
 
 	// TODO: In order for this finalizer to work, there must be no references
@@ -277,9 +283,9 @@ func (ks *KeyStore) SignTx(a accounts.Account, tx *types.Transaction, chainID *b
 	if !found {
 		return nil, ErrLocked
 	}
-	// Depending on the presence of the chain ID, sign with EIP155 or homestead
+	// Depending on the presence of the chain ID, sign with EIP1559/EIP2930/EIP155 or homestead
 	if chainID != nil {
-		return types.SignTx(tx, types.NewEIP155Signer(chainID), unlockedKey.PrivateKey)
+		return types.SignTx(tx, types.NewLondonSigner(chainID), unlockedKey.PrivateKey)
 	}
 	return types.SignTx(tx, types.HomesteadSigner{}, unlockedKey.PrivateKey)
 }
@@ -288,7 +294,7 @@ func (ks *KeyStore) SignTx(a accounts.Account, tx *types.Transaction, chainID *b
 // can be decrypted with the given passphrase. The produced signature is in the
 // [R || S || V] format where V is 0 or 1.
 func (ks *KeyStore) SignHashWithPassphrase(a accounts.Account, passphrase string, hash []byte) (signature []byte, err error) {
-	_, key, err := ks.getDecryptedKey(a, passphrase)
+	_, key, err := ks.getUnlockedOrDecryptedKey(a, passphrase)
 	if err != nil {
 		return nil, err
 	}
@@ -299,15 +305,15 @@ func (ks *KeyStore) SignHashWithPassphrase(a accounts.Account, passphrase string
 // SignTxWithPassphrase signs the transaction if the private key matching the
 // given address can be decrypted with the given passphrase.
 func (ks *KeyStore) SignTxWithPassphrase(a accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
-	_, key, err := ks.getDecryptedKey(a, passphrase)
+	_, key, err := ks.getUnlockedOrDecryptedKey(a, passphrase)
 	if err != nil {
 		return nil, err
 	}
 	defer zeroKey(key.PrivateKey)
 
-	// Depending on the presence of the chain ID, sign with EIP155 or homestead
+	// Depending on the presence of the chain ID, sign with EIP1559/EIP2930/EIP155 or homestead
 	if chainID != nil {
-		return types.SignTx(tx, types.NewEIP155Signer(chainID), key.PrivateKey)
+		return types.SignTx(tx, types.NewLondonSigner(chainID), key.PrivateKey)
 	}
 	return types.SignTx(tx, types.HomesteadSigner{}, key.PrivateKey)
 }
@@ -337,7 +343,7 @@ func (ks *KeyStore) Lock(addr common.Address) error {
 // shortens the active unlock timeout. If the address was previously unlocked
 // indefinitely the timeout is not altered.
 func (ks *KeyStore) TimedUnlock(a accounts.Account, passphrase string, timeout time.Duration) error {
-	a, key, err := ks.getDecryptedKey(a, passphrase)
+	a, key, err := ks.getUnlockedOrDecryptedKey(a, passphrase)
 	if err != nil {
 		return err
 	}
@@ -352,14 +358,16 @@ func (ks *KeyStore) TimedUnlock(a accounts.Account, passphrase string, timeout t
 			zeroKey(key.PrivateKey)
 			return nil
 		}
-		// Terminate the expire goroutine and replace it below.
+		// Terminate the expire goroutine and replace it below, wiping
+		// the superseded copy of the key from memory.
 		close(u.abort)
+		zeroKey(u.PrivateKey)
 	}
 	if timeout > 0 {
-		u = &unlocked{Key: key, abort: make(chan struct{})}
+		u = &unlocked{Key: key, auth: ks.authDigest(passphrase), abort: make(chan struct{})}
 		go ks.expire(a.Address, u, timeout)
 	} else {
-		u = &unlocked{Key: key}
+		u = &unlocked{Key: key, auth: ks.authDigest(passphrase)}
 	}
 	ks.unlocked[a.Address] = u
 	return nil
@@ -383,6 +391,36 @@ func (ks *KeyStore) getDecryptedKey(a accounts.Account, auth string) (accounts.A
 	return a, key, err
 }
 
+// getUnlockedOrDecryptedKey is like getDecryptedKey, but if the account is
+// currently unlocked with the same passphrase, it returns a copy of the cached
+// key instead of running the expensive key derivation function again. The
+// returned key is owned by the caller and may be zeroed.
+func (ks *KeyStore) getUnlockedOrDecryptedKey(a accounts.Account, auth string) (accounts.Account, *Key, error) {
+	ks.mu.RLock()
+	if u, found := ks.unlocked[a.Address]; found && hmac.Equal(u.auth, ks.authDigest(auth)) {
+		key := &Key{
+			Id:      u.Id,
+			Address: u.Address,
+			PrivateKey: &ecdsa.PrivateKey{
+				PublicKey: u.PrivateKey.PublicKey,
+				D:         new(big.Int).Set(u.PrivateKey.D),
+			},
+		}
+		ks.mu.RUnlock()
+		return a, key, nil
+	}
+	ks.mu.RUnlock()
+	return ks.getDecryptedKey(a, auth)
+}
+
+// authDigest computes the keyed digest of a passphrase, used to verify it against
+// unlocked accounts without retaining the passphrase itself in memory.
+func (ks *KeyStore) authDigest(auth string) []byte {
+	mac := hmac.New(sha256.New, ks.authKey)
+	mac.Write([]byte(auth))
+	return mac.Sum(nil)
+}
+
 func (ks *KeyStore) expire(addr common.Address, u *unlocked, timeout time.Duration) {
 	t := time.NewTimer(timeout)
 	defer t.Stop()
@@ -419,17 +457,27 @@ func (ks *KeyStore) NewAccount(passphrase string) (accounts.Account, error) {
 
 // Export exports as a JSON key, encrypted with newPassphrase.
 func (ks *KeyStore) Export(a accounts.Account, passphrase, newPassphrase string) (keyJSON []byte, err error) {
-	_, key, err := ks.getDecryptedKey(a, passphrase)
-	if err != nil {
-		return nil, err
-	}
 	var N, P int
 	if store, ok := ks.storage.(*keyStorePassphrase); ok {
 		N, P = store.scryptN, store.scryptP
 	} else {
 		N, P = StandardScryptN, StandardScryptP
 	}
-	return EncryptKey(key, newPassphrase, N, P)
+	return ks.ExportScrypt(a, passphrase, newPassphrase, N, P)
+}
+
+// ExportScrypt exports as a JSON key like Export, but encrypts it with the given
+// scrypt parameters instead of the ones used by the keystore.
+func (ks *KeyStore) ExportScrypt(a accounts.Account, passphrase, newPassphrase string, scryptN, scryptP int) (keyJSON []byte, err error) {
+	if err := ValidateScryptParams(scryptN, scryptP); err != nil {
+		return nil, err
+	}
+	_, key, err := ks.getDecryptedKey(a, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroKey(key.PrivateKey)
+	return EncryptKey(key, newPassphrase, scryptN, scryptP)
 }
 
 // Import stores the given encrypted JSON key into the key directory.
@@ -106,6 +106,24 @@ func (ks keyStorePassphrase) JoinPath(filename string) string {
 	}
 }
 
+// ValidateScryptParams checks whether a custom scrypt N and P pair is usable for
+// key encryption: N must be a power of two larger than one and at most
+// StandardScryptN, as the derivation allocates 128*r*N bytes of memory, and P
+// must be positive and small enough for the derivation to stay within scrypt's
+// limits.
+func ValidateScryptParams(scryptN, scryptP int) error {
+	if scryptN <= 1 || scryptN&(scryptN-1) != 0 {
+		return fmt.Errorf("invalid scrypt N %d: must be a power of two larger than 1", scryptN)
+	}
+	if scryptN > StandardScryptN {
+		return fmt.Errorf("invalid scrypt N %d: must be at most %d", scryptN, StandardScryptN)
+	}
+	if scryptP <= 0 || uint64(scryptR)*uint64(scryptP) >= 1<<30 {
+		return fmt.Errorf("invalid scrypt P %d: must be positive and below %d", scryptP, (1<<30)/scryptR)
+	}
+	return nil
+}
+
 // EncryptKey encrypts a key using the specified scrypt parameters into a json
 // blob that can be decrypted later on.
 func EncryptKey(key *Key, auth string, scryptN, scryptP int) ([]byte, error) {
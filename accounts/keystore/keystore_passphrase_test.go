@@ -58,3 +58,28 @@ func TestKeyEncryptDecrypt(t *testing.T) {
 		}
 	}
 }
+
+// Tests that custom scrypt parameters are validated before being used.
+func TestValidateScryptParams(t *testing.T) {
+	tests := []struct {
+		n, p int
+		ok   bool
+	}{
+		{StandardScryptN, StandardScryptP, true},
+		{LightScryptN, LightScryptP, true},
+		{veryLightScryptN, veryLightScryptP, true},
+		{1, 1, false},
+		{0, 1, false},
+		{3000, 1, false},
+		{StandardScryptN << 1, 1, false},
+		{1 << 30, 1, false},
+		{1 << 10, 0, false},
+		{1 << 10, -1, false},
+		{1 << 10, 1 << 27, false},
+	}
+	for i, tt := range tests {
+		if err := ValidateScryptParams(tt.n, tt.p); (err == nil) != tt.ok {
+			t.Errorf("test %d: N=%d P=%d: validity mismatch: have error %v, want ok %v", i, tt.n, tt.p, err, tt.ok)
+		}
+	}
+}
@@ -17,6 +17,7 @@
 package keystore
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"math/rand"
 	"os"
@@ -113,6 +114,62 @@ func TestSignWithPassphrase(t *testing.T) {
 	}
 }
 
+// countingStorage is a key storage backend counting the keys it decrypts.
+type countingStorage struct {
+	keyStore
+	decrypts int
+}
+
+func (s *countingStorage) GetKey(addr common.Address, filename string, auth string) (*Key, error) {
+	s.decrypts++
+	return s.keyStore.GetKey(addr, filename, auth)
+}
+
+// Tests that signing with the passphrase of an unlocked account reuses the
+// cached key instead of decrypting the key file again, but still rejects wrong
+// passphrases and falls back to decryption once the account is relocked.
+func TestSignWithPassphraseUnlocked(t *testing.T) {
+	dir, ks := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir)
+
+	pass := "passwd"
+	acc, err := ks.NewAccount(pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := &countingStorage{keyStore: ks.storage}
+	ks.storage = storage
+
+	if err := ks.TimedUnlock(acc, pass, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := ks.SignHashWithPassphrase(acc, pass, testSigData); err != nil {
+			t.Fatalf("sign %d: failed to sign with unlocked account: %v", i, err)
+		}
+	}
+	if err := ks.TimedUnlock(acc, pass, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if storage.decrypts != 1 {
+		t.Errorf("decryption count mismatch while unlocked: have %d, want %d", storage.decrypts, 1)
+	}
+	if _, err := ks.SignHashWithPassphrase(acc, "invalid passwd", testSigData); err != ErrDecrypt {
+		t.Errorf("invalid passphrase error mismatch: have %v, want %v", err, ErrDecrypt)
+	}
+	// The cached key must survive the copies handed out for signing
+	if _, err := ks.SignHash(acc, testSigData); err != nil {
+		t.Fatalf("failed to sign with unlocked key: %v", err)
+	}
+	ks.Lock(acc.Address)
+	if _, err := ks.SignHashWithPassphrase(acc, pass, testSigData); err != nil {
+		t.Fatalf("failed to sign with relocked account: %v", err)
+	}
+	if storage.decrypts != 3 {
+		t.Errorf("decryption count mismatch after relock: have %d, want %d", storage.decrypts, 3)
+	}
+}
+
 func TestTimedUnlock(t *testing.T) {
 	dir, ks := tmpKeyStore(t, true)
 	defer os.RemoveAll(dir)
@@ -363,3 +420,45 @@ func tmpKeyStore(t *testing.T, encrypted bool) (string, *KeyStore) {
 	}
 	return d, new(d)
 }
+
+// Tests that accounts can be exported with custom scrypt parameters and imported
+// back with the new passphrase.
+func TestExportScrypt(t *testing.T) {
+	dir, ks := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir)
+
+	acc, err := ks.NewAccount("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.ExportScrypt(acc, "foo", "bar", 3, 1); err == nil {
+		t.Fatal("expected export with invalid scrypt N to fail")
+	}
+	if _, err := ks.ExportScrypt(acc, "foo", "bar", 1<<30, 1); err == nil {
+		t.Fatal("expected export with oversized scrypt N to fail")
+	}
+	if _, err := ks.ExportScrypt(acc, "invalid", "bar", veryLightScryptN, veryLightScryptP); err != ErrDecrypt {
+		t.Fatalf("invalid passphrase error mismatch: have %v, want %v", err, ErrDecrypt)
+	}
+	keyjson, err := ks.ExportScrypt(acc, "foo", "bar", 4, 2)
+	if err != nil {
+		t.Fatalf("failed to export account: %v", err)
+	}
+	var exported encryptedKeyJSONV3
+	if err := json.Unmarshal(keyjson, &exported); err != nil {
+		t.Fatalf("failed to parse exported key: %v", err)
+	}
+	if n, p := exported.Crypto.KDFParams["n"], exported.Crypto.KDFParams["p"]; n != 4.0 || p != 2.0 {
+		t.Errorf("exported scrypt parameters mismatch: have N=%v P=%v, want N=4 P=2", n, p)
+	}
+	if _, err := ks.Import(keyjson, "foo", "baz"); err != ErrDecrypt {
+		t.Errorf("import with old passphrase error mismatch: have %v, want %v", err, ErrDecrypt)
+	}
+	key, err := DecryptKey(keyjson, "bar")
+	if err != nil {
+		t.Fatalf("failed to decrypt exported key: %v", err)
+	}
+	if key.Address != acc.Address {
+		t.Errorf("exported address mismatch: have %x, want %x", key.Address, acc.Address)
+	}
+}
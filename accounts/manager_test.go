@@ -0,0 +1,120 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package accounts
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+// testWallet is a wallet with a fixed URL and account list. Any other method of
+// the interface panics if called.
+type testWallet struct {
+	Wallet
+	url      URL
+	accounts []Account
+}
+
+func (w *testWallet) URL() URL            { return w.url }
+func (w *testWallet) Accounts() []Account { return w.accounts }
+
+func (w *testWallet) Contains(account Account) bool {
+	for _, acc := range w.accounts {
+		if acc.Address == account.Address {
+			return true
+		}
+	}
+	return false
+}
+
+// testBackend is a backend announcing wallet changes on request.
+type testBackend struct {
+	wallets []Wallet
+	feed    event.Feed
+}
+
+func (b *testBackend) Wallets() []Wallet { return b.wallets }
+func (b *testBackend) Subscribe(sink chan<- WalletEvent) event.Subscription {
+	return b.feed.Subscribe(sink)
+}
+
+func newTestWallet(path string, addrs ...common.Address) *testWallet {
+	wallet := &testWallet{url: URL{Scheme: "test", Path: path}}
+	for _, addr := range addrs {
+		wallet.accounts = append(wallet.accounts, Account{Address: addr, URL: wallet.url})
+	}
+	return wallet
+}
+
+// Tests that the manager tracks the wallets of its backends, keeping them sorted
+// and forwarding their arrivals and departures to subscribers.
+func TestManagerWallets(t *testing.T) {
+	var (
+		a = newTestWallet("a", common.Address{0x01})
+		b = newTestWallet("b")
+		c = newTestWallet("c", common.Address{0x03}, common.Address{0x04})
+		x = newTestWallet("x")
+	)
+	backend := &testBackend{wallets: []Wallet{c, a}}
+	am := NewManager(backend)
+	defer am.Close()
+
+	events := make(chan WalletEvent, 4)
+	sub := am.Subscribe(events)
+	defer sub.Unsubscribe()
+
+	if have, want := am.Wallets(), []Wallet{a, c}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("initial wallets mismatch: have %v, want %v", have, want)
+	}
+	// Announce a new wallet and the departure of an unknown one, the latter of
+	// which must not drop any other wallet
+	backend.feed.Send(WalletEvent{Wallet: b, Arrive: true})
+	backend.feed.Send(WalletEvent{Wallet: newTestWallet("bb"), Arrive: false})
+	backend.feed.Send(WalletEvent{Wallet: x, Arrive: false})
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-events:
+		case <-time.After(time.Second):
+			t.Fatalf("wallet event %d not forwarded", i)
+		}
+	}
+	if have, want := am.Wallets(), []Wallet{a, b, c}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("updated wallets mismatch: have %v, want %v", have, want)
+	}
+	// Look up wallets and accounts
+	if wallet, err := am.Wallet("test://b"); err != nil || wallet != b {
+		t.Errorf("wallet by URL mismatch: have %v, want %v (err %v)", wallet, b, err)
+	}
+	if _, err := am.Wallet("test://x"); err != ErrUnknownWallet {
+		t.Errorf("unknown wallet error mismatch: have %v, want %v", err, ErrUnknownWallet)
+	}
+	if wallet, err := am.Find(Account{Address: common.Address{0x04}}); err != nil || wallet != c {
+		t.Errorf("wallet by account mismatch: have %v, want %v (err %v)", wallet, c, err)
+	}
+	if _, err := am.Find(Account{Address: common.Address{0x02}}); err != ErrUnknownAccount {
+		t.Errorf("unknown account error mismatch: have %v, want %v", err, ErrUnknownAccount)
+	}
+	want := []common.Address{{0x01}, {0x03}, {0x04}}
+	if have := am.Accounts(); !reflect.DeepEqual(have, want) {
+		t.Errorf("accounts mismatch: have %x, want %x", have, want)
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package accounts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// domainType is the name of the struct type describing the signing domain.
+const domainType = "EIP712Domain"
+
+// TypedData is a structured message to sign as specified by EIP-712, along with
+// the definitions of its types and the domain it's valid in.
+type TypedData struct {
+	Types       map[string][]TypedDataField `json:"types"`
+	PrimaryType string                      `json:"primaryType"`
+	Domain      map[string]interface{}      `json:"domain"`
+	Message     map[string]interface{}      `json:"message"`
+}
+
+// TypedDataField is a member of a struct type of typed data.
+type TypedDataField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// TypedDataHash returns the hash to sign for the given typed data, calculated as
+//
+//	keccak256("\x19\x01" ‖ domainSeparator ‖ hashStruct(message))
+//
+// where the domain separator is the struct hash of the domain.
+func TypedDataHash(data *TypedData) (common.Hash, error) {
+	if _, ok := data.Types[domainType]; !ok {
+		return common.Hash{}, fmt.Errorf("missing %s type", domainType)
+	}
+	if _, ok := data.Types[data.PrimaryType]; !ok {
+		return common.Hash{}, fmt.Errorf("unknown primary type %q", data.PrimaryType)
+	}
+	domain, err := data.HashStruct(domainType, data.Domain)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("domain: %v", err)
+	}
+	message, err := data.HashStruct(data.PrimaryType, data.Message)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("message: %v", err)
+	}
+	return crypto.Keccak256Hash([]byte("\x19\x01"), domain[:], message[:]), nil
+}
+
+// HashStruct returns the struct hash of a value of the given type, which is the
+// hash of its type followed by its encoded members.
+func (data *TypedData) HashStruct(typ string, value map[string]interface{}) (common.Hash, error) {
+	enc, err := data.EncodeData(typ, value)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(enc), nil
+}
+
+// TypeHash returns the hash of the encoding of a struct type.
+func (data *TypedData) TypeHash(typ string) common.Hash {
+	return crypto.Keccak256Hash([]byte(data.EncodeType(typ)))
+}
+
+// EncodeType returns the encoding of a struct type, listing its members, followed
+// by the alphabetically sorted encodings of all struct types it references.
+func (data *TypedData) EncodeType(typ string) string {
+	deps := data.dependencies(typ, make(map[string]bool))
+	sort.Strings(deps)
+
+	var buf bytes.Buffer
+	for _, dep := range append([]string{typ}, deps...) {
+		buf.WriteString(dep)
+		buf.WriteByte('(')
+		for i, field := range data.Types[dep] {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(field.Type)
+			buf.WriteByte(' ')
+			buf.WriteString(field.Name)
+		}
+		buf.WriteByte(')')
+	}
+	return buf.String()
+}
+
+// dependencies returns the struct types referenced by a struct type, directly or
+// indirectly, excluding the type itself.
+func (data *TypedData) dependencies(typ string, seen map[string]bool) []string {
+	seen[typ] = true
+
+	var deps []string
+	for _, field := range data.Types[typ] {
+		name := elementType(field.Type)
+		if _, ok := data.Types[name]; !ok || seen[name] {
+			continue
+		}
+		deps = append(deps, name)
+		deps = append(deps, data.dependencies(name, seen)...)
+	}
+	return deps
+}
+
+// EncodeData returns the encoding of a struct value: its type hash followed by
+// each of its members encoded into 32 bytes.
+func (data *TypedData) EncodeData(typ string, value map[string]interface{}) ([]byte, error) {
+	fields, ok := data.Types[typ]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %q", typ)
+	}
+	if len(value) > len(fields) {
+		return nil, fmt.Errorf("%s has more members than its type", typ)
+	}
+	hash := data.TypeHash(typ)
+	enc := append([]byte{}, hash[:]...)
+	for _, field := range fields {
+		member, ok := value[field.Name]
+		if !ok {
+			return nil, fmt.Errorf("%s is missing member %q", typ, field.Name)
+		}
+		word, err := data.encodeValue(field.Type, member)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", typ, field.Name, err)
+		}
+		enc = append(enc, word...)
+	}
+	return enc, nil
+}
+
+// encodeValue encodes a member value of the given type into 32 bytes. Structs,
+// arrays and dynamic types are represented by their hash.
+func (data *TypedData) encodeValue(typ string, value interface{}) ([]byte, error) {
+	// Arrays are hashed from the concatenation of their encoded elements
+	if strings.HasSuffix(typ, "]") {
+		elems, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid %s value %v", typ, value)
+		}
+		elem := typ[:strings.LastIndex(typ, "[")]
+		if size := typ[len(elem)+1 : len(typ)-1]; size != "" {
+			if n, err := strconv.Atoi(size); err != nil || n != len(elems) {
+				return nil, fmt.Errorf("invalid %s length %d", typ, len(elems))
+			}
+		}
+		var enc []byte
+		for _, value := range elems {
+			word, err := data.encodeValue(elem, value)
+			if err != nil {
+				return nil, err
+			}
+			enc = append(enc, word...)
+		}
+		return crypto.Keccak256(enc), nil
+	}
+	// Structs are represented by their struct hash
+	if _, ok := data.Types[typ]; ok {
+		members, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid %s value %v", typ, value)
+		}
+		hash, err := data.HashStruct(typ, members)
+		return hash[:], err
+	}
+	return encodeAtomic(typ, value)
+}
+
+// encodeAtomic encodes a value of an elementary type into 32 bytes, hashing the
+// dynamic string and bytes values.
+func encodeAtomic(typ string, value interface{}) ([]byte, error) {
+	switch {
+	case typ == "string":
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid string value %v", value)
+		}
+		return crypto.Keccak256([]byte(str)), nil
+
+	case typ == "bytes":
+		blob, err := parseBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		return crypto.Keccak256(blob), nil
+
+	case typ == "bool":
+		flag, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("invalid bool value %v", value)
+		}
+		word := make([]byte, 32)
+		if flag {
+			word[31] = 1
+		}
+		return word, nil
+
+	case typ == "address":
+		str, ok := value.(string)
+		if !ok || !common.IsHexAddress(str) {
+			return nil, fmt.Errorf("invalid address value %v", value)
+		}
+		return common.LeftPadBytes(common.HexToAddress(str).Bytes(), 32), nil
+
+	case strings.HasPrefix(typ, "bytes"):
+		size, err := strconv.Atoi(typ[len("bytes"):])
+		if err != nil || size < 1 || size > 32 {
+			return nil, fmt.Errorf("unknown type %q", typ)
+		}
+		blob, err := parseBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(blob) != size {
+			return nil, fmt.Errorf("invalid %s length %d", typ, len(blob))
+		}
+		return common.RightPadBytes(blob, 32), nil
+
+	case strings.HasPrefix(typ, "uint"), strings.HasPrefix(typ, "int"):
+		signed := strings.HasPrefix(typ, "int")
+		bits, err := strconv.Atoi(strings.TrimPrefix(strings.TrimPrefix(typ, "u"), "int"))
+		if err != nil || bits < 8 || bits > 256 || bits%8 != 0 {
+			return nil, fmt.Errorf("unknown type %q", typ)
+		}
+		num, err := parseInteger(value)
+		if err != nil {
+			return nil, err
+		}
+		if !fitsInteger(num, bits, signed) {
+			return nil, fmt.Errorf("%s overflows %s", num, typ)
+		}
+		return math.PaddedBigBytes(math.U256(new(big.Int).Set(num)), 32), nil
+	}
+	return nil, fmt.Errorf("unknown type %q", typ)
+}
+
+// elementType strips all array dimensions from a type.
+func elementType(typ string) string {
+	if i := strings.Index(typ, "["); i >= 0 {
+		return typ[:i]
+	}
+	return typ
+}
+
+// parseBytes decodes a hex encoded byte array value.
+func parseBytes(value interface{}) ([]byte, error) {
+	str, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid bytes value %v", value)
+	}
+	return hexutil.Decode(str)
+}
+
+// parseInteger decodes an integer value given either as a JSON number or as a
+// decimal or hex string.
+func parseInteger(value interface{}) (*big.Int, error) {
+	switch v := value.(type) {
+	case float64:
+		num, accuracy := new(big.Float).SetFloat64(v).Int(nil)
+		if accuracy != big.Exact {
+			return nil, fmt.Errorf("invalid integer value %v", v)
+		}
+		return num, nil
+
+	case json.Number:
+		value = v.String()
+
+	case string:
+		// Parsed below, along with JSON numbers
+	default:
+		return nil, fmt.Errorf("invalid integer value %v", value)
+	}
+	str := value.(string)
+	num, ok := math.ParseBig256(strings.TrimPrefix(str, "-"))
+	if !ok {
+		return nil, fmt.Errorf("invalid integer value %q", str)
+	}
+	if strings.HasPrefix(str, "-") {
+		num.Neg(num)
+	}
+	return num, nil
+}
+
+// fitsInteger reports whether an integer is representable with the given number
+// of bits.
+func fitsInteger(num *big.Int, bits int, signed bool) bool {
+	if !signed {
+		return num.Sign() >= 0 && num.BitLen() <= bits
+	}
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(bits-1))
+	return num.Cmp(new(big.Int).Neg(limit)) >= 0 && num.Cmp(limit) < 0
+}
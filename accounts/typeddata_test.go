@@ -0,0 +1,146 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package accounts
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// mailTypedData is the example message of the EIP-712 specification.
+const mailTypedData = `{
+	"types": {
+		"EIP712Domain": [
+			{"name": "name", "type": "string"},
+			{"name": "version", "type": "string"},
+			{"name": "chainId", "type": "uint256"},
+			{"name": "verifyingContract", "type": "address"}
+		],
+		"Person": [
+			{"name": "name", "type": "string"},
+			{"name": "wallet", "type": "address"}
+		],
+		"Mail": [
+			{"name": "from", "type": "Person"},
+			{"name": "to", "type": "Person"},
+			{"name": "contents", "type": "string"}
+		]
+	},
+	"primaryType": "Mail",
+	"domain": {
+		"name": "Ether Mail",
+		"version": "1",
+		"chainId": 1,
+		"verifyingContract": "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"
+	},
+	"message": {
+		"from": {"name": "Cow", "wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},
+		"to": {"name": "Bob", "wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},
+		"contents": "Hello, Bob!"
+	}
+}`
+
+// Tests typed data hashing against the example of the EIP-712 specification,
+// including the signature produced by its reference implementation.
+func TestTypedDataHash(t *testing.T) {
+	var data TypedData
+	if err := json.Unmarshal([]byte(mailTypedData), &data); err != nil {
+		t.Fatalf("failed to decode typed data: %v", err)
+	}
+	if have, want := data.EncodeType("Mail"), "Mail(Person from,Person to,string contents)Person(string name,address wallet)"; have != want {
+		t.Errorf("type encoding mismatch: have %s, want %s", have, want)
+	}
+	domain, err := data.HashStruct("EIP712Domain", data.Domain)
+	if err != nil {
+		t.Fatalf("failed to hash domain: %v", err)
+	}
+	if want := common.HexToHash("0xf2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f"); domain != want {
+		t.Errorf("domain separator mismatch: have %x, want %x", domain, want)
+	}
+	message, err := data.HashStruct("Mail", data.Message)
+	if err != nil {
+		t.Fatalf("failed to hash message: %v", err)
+	}
+	if want := common.HexToHash("0xc52c0ee5d84264471806290a3f2c4cecfc5490626bf912d01f240d7a274b371e"); message != want {
+		t.Errorf("message hash mismatch: have %x, want %x", message, want)
+	}
+	hash, err := TypedDataHash(&data)
+	if err != nil {
+		t.Fatalf("failed to hash typed data: %v", err)
+	}
+	if want := common.HexToHash("0xbe609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2"); hash != want {
+		t.Errorf("typed data hash mismatch: have %x, want %x", hash, want)
+	}
+	key := crypto.ToECDSAUnsafe(crypto.Keccak256([]byte("cow")))
+	sig, err := crypto.Sign(hash[:], key)
+	if err != nil {
+		t.Fatalf("failed to sign typed data: %v", err)
+	}
+	want := common.FromHex("0x4355c47d63924e8a72e509b65029052eb6c299d53a04e167c5775fd466751c9d07299936d304c153f6443dfa05f40ff007d72911b6f72307f996231605b9156201")
+	if !bytesEqual(sig, want) {
+		t.Errorf("signature mismatch: have %x, want %x", sig, want)
+	}
+}
+
+// Tests that arrays, nested structs and integer limits are encoded as specified,
+// and that malformed values are rejected.
+func TestTypedDataEncoding(t *testing.T) {
+	data := &TypedData{
+		Types: map[string][]TypedDataField{
+			"Group":  {{Name: "members", Type: "Member[]"}, {Name: "tags", Type: "bytes4[2]"}},
+			"Member": {{Name: "id", Type: "int8"}, {Name: "ok", Type: "bool"}},
+		},
+	}
+	if have, want := data.EncodeType("Group"), "Group(Member[] members,bytes4[2] tags)Member(int8 id,bool ok)"; have != want {
+		t.Errorf("type encoding mismatch: have %s, want %s", have, want)
+	}
+	tests := []struct {
+		value map[string]interface{}
+		fail  bool
+	}{
+		{map[string]interface{}{"members": []interface{}{}, "tags": []interface{}{"0x01020304", "0x05060708"}}, false},
+		{map[string]interface{}{"members": []interface{}{map[string]interface{}{"id": -128.0, "ok": true}}, "tags": []interface{}{"0x01020304", "0x05060708"}}, false},
+		{map[string]interface{}{"members": []interface{}{map[string]interface{}{"id": "0x7f", "ok": false}}, "tags": []interface{}{"0x01020304", "0x05060708"}}, false},
+		{map[string]interface{}{"members": []interface{}{map[string]interface{}{"id": 128.0, "ok": true}}, "tags": []interface{}{"0x01020304", "0x05060708"}}, true},
+		{map[string]interface{}{"members": []interface{}{map[string]interface{}{"id": 1.5, "ok": true}}, "tags": []interface{}{"0x01020304", "0x05060708"}}, true},
+		{map[string]interface{}{"members": []interface{}{map[string]interface{}{"id": 1.0}}, "tags": []interface{}{"0x01020304", "0x05060708"}}, true},
+		{map[string]interface{}{"members": []interface{}{}, "tags": []interface{}{"0x01020304"}}, true},
+		{map[string]interface{}{"members": []interface{}{}, "tags": []interface{}{"0x010203", "0x05060708"}}, true},
+		{map[string]interface{}{"members": []interface{}{}, "tags": []interface{}{"0x01020304", "0x05060708"}, "extra": true}, true},
+	}
+	for i, tt := range tests {
+		_, err := data.HashStruct("Group", tt.value)
+		if (err != nil) != tt.fail {
+			t.Errorf("test %d: error mismatch: have %v, want failure %v", i, err, tt.fail)
+		}
+	}
+	// Negative integers are encoded in two's complement
+	enc, err := encodeAtomic("int8", -1.0)
+	if err != nil {
+		t.Fatalf("failed to encode negative integer: %v", err)
+	}
+	if want := common.FromHex("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"); !bytesEqual(enc, want) {
+		t.Errorf("negative integer encoding mismatch: have %x, want %x", enc, want)
+	}
+}
+
+func bytesEqual(a, b []byte) bool {
+	return common.Bytes2Hex(a) == common.Bytes2Hex(b)
+}
@@ -0,0 +1,437 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package trezor contains the wire protocol messages of the Trezor hardware
+// wallets needed to derive Ethereum accounts and sign transactions with them.
+//
+// The messages are a subset of the protocol buffer definitions in the Trezor
+// common GitHub repo, encoded by hand into the protocol buffer wire format:
+// https://github.com/trezor/trezor-common/blob/master/protob/messages.proto
+package trezor
+
+import "fmt"
+
+// MessageType is the identifier of a message on the Trezor wire protocol.
+type MessageType uint16
+
+const (
+	MessageTypeInitialize         MessageType = 0
+	MessageTypePing               MessageType = 1
+	MessageTypeSuccess            MessageType = 2
+	MessageTypeFailure            MessageType = 3
+	MessageTypeFeatures           MessageType = 17
+	MessageTypePinMatrixRequest   MessageType = 18
+	MessageTypePinMatrixAck       MessageType = 19
+	MessageTypeButtonRequest      MessageType = 26
+	MessageTypeButtonAck          MessageType = 27
+	MessageTypePassphraseRequest  MessageType = 41
+	MessageTypeEthereumGetAddress MessageType = 56
+	MessageTypeEthereumAddress    MessageType = 57
+	MessageTypeEthereumSignTx     MessageType = 58
+	MessageTypeEthereumTxRequest  MessageType = 59
+	MessageTypeEthereumTxAck      MessageType = 60
+)
+
+var messageTypeNames = map[MessageType]string{
+	MessageTypeInitialize:         "Initialize",
+	MessageTypePing:               "Ping",
+	MessageTypeSuccess:            "Success",
+	MessageTypeFailure:            "Failure",
+	MessageTypeFeatures:           "Features",
+	MessageTypePinMatrixRequest:   "PinMatrixRequest",
+	MessageTypePinMatrixAck:       "PinMatrixAck",
+	MessageTypeButtonRequest:      "ButtonRequest",
+	MessageTypeButtonAck:          "ButtonAck",
+	MessageTypePassphraseRequest:  "PassphraseRequest",
+	MessageTypeEthereumGetAddress: "EthereumGetAddress",
+	MessageTypeEthereumAddress:    "EthereumAddress",
+	MessageTypeEthereumSignTx:     "EthereumSignTx",
+	MessageTypeEthereumTxRequest:  "EthereumTxRequest",
+	MessageTypeEthereumTxAck:      "EthereumTxAck",
+}
+
+// String implements fmt.Stringer, returning the name of the message type.
+func (t MessageType) String() string {
+	if name, ok := messageTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("MessageType(%d)", uint16(t))
+}
+
+// Message is a Trezor wire protocol message.
+type Message interface {
+	// Type returns the identifier of the message on the wire.
+	Type() MessageType
+
+	// Marshal encodes the message into the protocol buffer wire format.
+	Marshal() []byte
+
+	// Unmarshal decodes the message from the protocol buffer wire format,
+	// ignoring any fields not known.
+	Unmarshal(data []byte) error
+}
+
+// Initialize resets the device and requests its features.
+type Initialize struct{}
+
+func (m *Initialize) Type() MessageType           { return MessageTypeInitialize }
+func (m *Initialize) Marshal() []byte             { return nil }
+func (m *Initialize) Unmarshal(data []byte) error { return decode(data, skip) }
+
+// Ping tests the device, optionally asking for the PIN to unlock it.
+type Ping struct {
+	Message       string
+	PinProtection bool
+}
+
+func (m *Ping) Type() MessageType { return MessageTypePing }
+
+func (m *Ping) Marshal() []byte {
+	var b []byte
+	if m.Message != "" {
+		b = appendBytes(b, 1, []byte(m.Message))
+	}
+	if m.PinProtection {
+		b = appendBool(b, 3, true)
+	}
+	return b
+}
+
+func (m *Ping) Unmarshal(data []byte) error {
+	return decode(data, func(field int, value uint64, content []byte) error {
+		switch field {
+		case 1:
+			m.Message = string(content)
+		case 3:
+			m.PinProtection = value != 0
+		}
+		return nil
+	})
+}
+
+// Success is the reply to a successfully processed request.
+type Success struct {
+	Message string
+}
+
+func (m *Success) Type() MessageType { return MessageTypeSuccess }
+
+func (m *Success) Marshal() []byte {
+	if m.Message == "" {
+		return nil
+	}
+	return appendBytes(nil, 1, []byte(m.Message))
+}
+
+func (m *Success) Unmarshal(data []byte) error {
+	return decode(data, func(field int, value uint64, content []byte) error {
+		if field == 1 {
+			m.Message = string(content)
+		}
+		return nil
+	})
+}
+
+// Failure is the reply to a request the device failed to process.
+type Failure struct {
+	Code    uint64
+	Message string
+}
+
+func (m *Failure) Type() MessageType { return MessageTypeFailure }
+
+func (m *Failure) Marshal() []byte {
+	return appendBytes(appendUint(nil, 1, m.Code), 2, []byte(m.Message))
+}
+
+func (m *Failure) Unmarshal(data []byte) error {
+	return decode(data, func(field int, value uint64, content []byte) error {
+		switch field {
+		case 1:
+			m.Code = value
+		case 2:
+			m.Message = string(content)
+		}
+		return nil
+	})
+}
+
+// Features is the reply to an Initialize request, describing the device.
+type Features struct {
+	MajorVersion uint64
+	MinorVersion uint64
+	PatchVersion uint64
+	Label        string
+}
+
+func (m *Features) Type() MessageType { return MessageTypeFeatures }
+
+func (m *Features) Marshal() []byte {
+	b := appendUint(nil, 2, m.MajorVersion)
+	b = appendUint(b, 3, m.MinorVersion)
+	b = appendUint(b, 4, m.PatchVersion)
+	if m.Label != "" {
+		b = appendBytes(b, 10, []byte(m.Label))
+	}
+	return b
+}
+
+func (m *Features) Unmarshal(data []byte) error {
+	return decode(data, func(field int, value uint64, content []byte) error {
+		switch field {
+		case 2:
+			m.MajorVersion = value
+		case 3:
+			m.MinorVersion = value
+		case 4:
+			m.PatchVersion = value
+		case 10:
+			m.Label = string(content)
+		}
+		return nil
+	})
+}
+
+// PinMatrixRequest is sent by the device when it needs the PIN to proceed.
+type PinMatrixRequest struct{}
+
+func (m *PinMatrixRequest) Type() MessageType           { return MessageTypePinMatrixRequest }
+func (m *PinMatrixRequest) Marshal() []byte             { return nil }
+func (m *PinMatrixRequest) Unmarshal(data []byte) error { return decode(data, skip) }
+
+// PinMatrixAck carries the PIN, encoded as the positions of its digits in the
+// scrambled matrix shown on the device.
+type PinMatrixAck struct {
+	Pin string
+}
+
+func (m *PinMatrixAck) Type() MessageType { return MessageTypePinMatrixAck }
+
+func (m *PinMatrixAck) Marshal() []byte {
+	return appendBytes(nil, 1, []byte(m.Pin))
+}
+
+func (m *PinMatrixAck) Unmarshal(data []byte) error {
+	return decode(data, func(field int, value uint64, content []byte) error {
+		if field == 1 {
+			m.Pin = string(content)
+		}
+		return nil
+	})
+}
+
+// ButtonRequest is sent by the device when it waits for a user confirmation.
+type ButtonRequest struct{}
+
+func (m *ButtonRequest) Type() MessageType           { return MessageTypeButtonRequest }
+func (m *ButtonRequest) Marshal() []byte             { return nil }
+func (m *ButtonRequest) Unmarshal(data []byte) error { return decode(data, skip) }
+
+// ButtonAck tells the device to proceed with waiting for the user confirmation.
+type ButtonAck struct{}
+
+func (m *ButtonAck) Type() MessageType           { return MessageTypeButtonAck }
+func (m *ButtonAck) Marshal() []byte             { return nil }
+func (m *ButtonAck) Unmarshal(data []byte) error { return decode(data, skip) }
+
+// EthereumGetAddress requests the Ethereum address at a derivation path.
+type EthereumGetAddress struct {
+	AddressN    []uint32
+	ShowDisplay bool
+}
+
+func (m *EthereumGetAddress) Type() MessageType { return MessageTypeEthereumGetAddress }
+
+func (m *EthereumGetAddress) Marshal() []byte {
+	b := appendPath(nil, 1, m.AddressN)
+	if m.ShowDisplay {
+		b = appendBool(b, 2, true)
+	}
+	return b
+}
+
+func (m *EthereumGetAddress) Unmarshal(data []byte) error {
+	return decode(data, func(field int, value uint64, content []byte) error {
+		switch field {
+		case 1:
+			m.AddressN = append(m.AddressN, uint32(value))
+		case 2:
+			m.ShowDisplay = value != 0
+		}
+		return nil
+	})
+}
+
+// EthereumAddress is the reply to an EthereumGetAddress request. Older firmware
+// returns the raw address, newer ones its checksummed hex encoding.
+type EthereumAddress struct {
+	Address    []byte
+	AddressHex string
+}
+
+func (m *EthereumAddress) Type() MessageType { return MessageTypeEthereumAddress }
+
+func (m *EthereumAddress) Marshal() []byte {
+	var b []byte
+	if m.Address != nil {
+		b = appendBytes(b, 1, m.Address)
+	}
+	if m.AddressHex != "" {
+		b = appendBytes(b, 2, []byte(m.AddressHex))
+	}
+	return b
+}
+
+func (m *EthereumAddress) Unmarshal(data []byte) error {
+	return decode(data, func(field int, value uint64, content []byte) error {
+		switch field {
+		case 1:
+			m.Address = append([]byte{}, content...)
+		case 2:
+			m.AddressHex = string(content)
+		}
+		return nil
+	})
+}
+
+// EthereumSignTx requests the signing of a transaction by the account at a
+// derivation path. Integers are big endian encoded, without leading zeroes. Data
+// longer than the initial chunk is requested by the device in EthereumTxRequests.
+type EthereumSignTx struct {
+	AddressN         []uint32
+	Nonce            []byte
+	GasPrice         []byte
+	GasLimit         []byte
+	To               []byte // Nil for contract creations
+	Value            []byte
+	DataInitialChunk []byte
+	DataLength       uint32
+	ChainID          uint32 // Zero for homestead signatures
+}
+
+func (m *EthereumSignTx) Type() MessageType { return MessageTypeEthereumSignTx }
+
+func (m *EthereumSignTx) Marshal() []byte {
+	b := appendPath(nil, 1, m.AddressN)
+	b = appendBytes(b, 2, m.Nonce)
+	b = appendBytes(b, 3, m.GasPrice)
+	b = appendBytes(b, 4, m.GasLimit)
+	if m.To != nil {
+		b = appendBytes(b, 5, m.To)
+	}
+	b = appendBytes(b, 6, m.Value)
+	if m.DataLength > 0 {
+		b = appendBytes(b, 7, m.DataInitialChunk)
+		b = appendUint(b, 8, uint64(m.DataLength))
+	}
+	if m.ChainID != 0 {
+		b = appendUint(b, 9, uint64(m.ChainID))
+	}
+	return b
+}
+
+func (m *EthereumSignTx) Unmarshal(data []byte) error {
+	return decode(data, func(field int, value uint64, content []byte) error {
+		switch field {
+		case 1:
+			m.AddressN = append(m.AddressN, uint32(value))
+		case 2:
+			m.Nonce = append([]byte{}, content...)
+		case 3:
+			m.GasPrice = append([]byte{}, content...)
+		case 4:
+			m.GasLimit = append([]byte{}, content...)
+		case 5:
+			m.To = append([]byte{}, content...)
+		case 6:
+			m.Value = append([]byte{}, content...)
+		case 7:
+			m.DataInitialChunk = append([]byte{}, content...)
+		case 8:
+			m.DataLength = uint32(value)
+		case 9:
+			m.ChainID = uint32(value)
+		}
+		return nil
+	})
+}
+
+// EthereumTxRequest is sent by the device while signing a transaction, either
+// asking for the next chunk of data or carrying the final signature.
+type EthereumTxRequest struct {
+	DataLength uint32 // Length of the next data chunk requested, zero if done
+	SignatureV uint32
+	SignatureR []byte
+	SignatureS []byte
+}
+
+func (m *EthereumTxRequest) Type() MessageType { return MessageTypeEthereumTxRequest }
+
+func (m *EthereumTxRequest) Marshal() []byte {
+	if m.DataLength > 0 {
+		return appendUint(nil, 1, uint64(m.DataLength))
+	}
+	b := appendUint(nil, 2, uint64(m.SignatureV))
+	b = appendBytes(b, 3, m.SignatureR)
+	return appendBytes(b, 4, m.SignatureS)
+}
+
+func (m *EthereumTxRequest) Unmarshal(data []byte) error {
+	return decode(data, func(field int, value uint64, content []byte) error {
+		switch field {
+		case 1:
+			m.DataLength = uint32(value)
+		case 2:
+			m.SignatureV = uint32(value)
+		case 3:
+			m.SignatureR = append([]byte{}, content...)
+		case 4:
+			m.SignatureS = append([]byte{}, content...)
+		}
+		return nil
+	})
+}
+
+// EthereumTxAck carries the next chunk of transaction data to the device.
+type EthereumTxAck struct {
+	DataChunk []byte
+}
+
+func (m *EthereumTxAck) Type() MessageType { return MessageTypeEthereumTxAck }
+
+func (m *EthereumTxAck) Marshal() []byte {
+	return appendBytes(nil, 1, m.DataChunk)
+}
+
+func (m *EthereumTxAck) Unmarshal(data []byte) error {
+	return decode(data, func(field int, value uint64, content []byte) error {
+		if field == 1 {
+			m.DataChunk = append([]byte{}, content...)
+		}
+		return nil
+	})
+}
+
+// appendPath appends a derivation path as a repeated integer field to b.
+func appendPath(b []byte, field int, path []uint32) []byte {
+	for _, index := range path {
+		b = appendUint(b, field, uint64(index))
+	}
+	return b
+}
+
+// skip is a field handler ignoring all fields of a message.
+func skip(field int, value uint64, content []byte) error { return nil }
@@ -0,0 +1,107 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trezor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Protocol buffer wire types used by the Trezor messages.
+const (
+	wireVarint  = 0 // Varint encoded integers and booleans
+	wireFixed64 = 1 // Little endian 64 bit values, skipped
+	wireBytes   = 2 // Length prefixed strings, bytes and embedded messages
+	wireFixed32 = 5 // Little endian 32 bit values, skipped
+)
+
+var errTruncated = errors.New("trezor: truncated message")
+
+// appendVarint appends the base 128 varint encoding of v to b.
+func appendVarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+// appendUint appends an integer field to b.
+func appendUint(b []byte, field int, v uint64) []byte {
+	b = appendVarint(b, uint64(field)<<3|wireVarint)
+	return appendVarint(b, v)
+}
+
+// appendBool appends a boolean field to b.
+func appendBool(b []byte, field int, v bool) []byte {
+	if v {
+		return appendUint(b, field, 1)
+	}
+	return appendUint(b, field, 0)
+}
+
+// appendBytes appends a length prefixed field to b.
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = appendVarint(b, uint64(field)<<3|wireBytes)
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// decode iterates over the fields of an encoded message, calling handle with the
+// value of each varint field or the content of each length prefixed one. Fields
+// of fixed size are skipped, since no Trezor message used here carries them.
+func decode(data []byte, handle func(field int, value uint64, content []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errTruncated
+		}
+		data = data[n:]
+
+		var (
+			value   uint64
+			content []byte
+		)
+		switch wire := key & 0x07; wire {
+		case wireVarint:
+			if value, n = binary.Uvarint(data); n <= 0 {
+				return errTruncated
+			}
+			data = data[n:]
+		case wireBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < size {
+				return errTruncated
+			}
+			content, data = data[n:n+int(size)], data[n+int(size):]
+		case wireFixed64, wireFixed32:
+			size := 8
+			if wire == wireFixed32 {
+				size = 4
+			}
+			if len(data) < size {
+				return errTruncated
+			}
+			data = data[size:]
+			continue
+		default:
+			return fmt.Errorf("trezor: unsupported wire type %d", wire)
+		}
+		if err := handle(int(key>>3), value, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package usbwallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/usbwallet/internal/trezor"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// testTrezor is a simulated Trezor device holding a single key, speaking the USB
+// framing of the real devices.
+type testTrezor struct {
+	key     *ecdsa.PrivateKey
+	pin     string // PIN the device waits for, empty if unlocked
+	confirm bool   // Whether to ask for button confirmation before signing
+
+	inbox  []byte // Payload of the message currently being received
+	outbox []byte // Reports queued up for reading
+
+	sign *trezor.EthereumSignTx // Transaction being signed
+	data []byte                 // Transaction data received so far
+}
+
+func (d *testTrezor) Write(report []byte) (int, error) {
+	if len(report) != 64 || report[0] != 0x3f {
+		return 0, fmt.Errorf("invalid report: %x", report)
+	}
+	d.inbox = append(d.inbox, report[1:]...)
+	if len(d.inbox) < 8 || len(d.inbox) < 8+int(binary.BigEndian.Uint32(d.inbox[4:8])) {
+		return len(report), nil
+	}
+	kind := trezor.MessageType(binary.BigEndian.Uint16(d.inbox[2:4]))
+	payload := d.inbox[8 : 8+binary.BigEndian.Uint32(d.inbox[4:8])]
+	d.inbox = nil
+
+	d.reply(d.handle(kind, payload))
+	return len(report), nil
+}
+
+func (d *testTrezor) Read(report []byte) (int, error) {
+	if len(d.outbox) == 0 {
+		return 0, fmt.Errorf("no reply pending")
+	}
+	n := copy(report, d.outbox[:64])
+	d.outbox = d.outbox[64:]
+	return n, nil
+}
+
+// reply frames a message into reports and queues them up for reading.
+func (d *testTrezor) reply(msg trezor.Message) {
+	data := msg.Marshal()
+	payload := make([]byte, 8+len(data))
+	copy(payload, "##")
+	binary.BigEndian.PutUint16(payload[2:], uint16(msg.Type()))
+	binary.BigEndian.PutUint32(payload[4:], uint32(len(data)))
+	copy(payload[8:], data)
+
+	for len(payload) > 0 {
+		report := make([]byte, 64)
+		report[0] = 0x3f
+		payload = payload[copy(report[1:], payload):]
+		d.outbox = append(d.outbox, report...)
+	}
+}
+
+// handle processes a request, returning the reply to send back.
+func (d *testTrezor) handle(kind trezor.MessageType, payload []byte) trezor.Message {
+	switch kind {
+	case trezor.MessageTypeInitialize:
+		return &trezor.Features{MajorVersion: 1, MinorVersion: 5, PatchVersion: 2, Label: "test"}
+
+	case trezor.MessageTypePing:
+		ping := new(trezor.Ping)
+		ping.Unmarshal(payload)
+		if ping.PinProtection && d.pin != "" {
+			return new(trezor.PinMatrixRequest)
+		}
+		return new(trezor.Success)
+
+	case trezor.MessageTypePinMatrixAck:
+		ack := new(trezor.PinMatrixAck)
+		ack.Unmarshal(payload)
+		if ack.Pin != d.pin {
+			return &trezor.Failure{Code: 7, Message: "PIN invalid"}
+		}
+		d.pin = ""
+		return new(trezor.Success)
+
+	case trezor.MessageTypeEthereumGetAddress:
+		return &trezor.EthereumAddress{Address: crypto.PubkeyToAddress(d.key.PublicKey).Bytes()}
+
+	case trezor.MessageTypeEthereumSignTx:
+		d.sign = new(trezor.EthereumSignTx)
+		d.sign.Unmarshal(payload)
+		d.data = d.sign.DataInitialChunk
+		if d.confirm {
+			return new(trezor.ButtonRequest)
+		}
+		return d.proceed()
+
+	case trezor.MessageTypeButtonAck:
+		return d.proceed()
+
+	case trezor.MessageTypeEthereumTxAck:
+		ack := new(trezor.EthereumTxAck)
+		ack.Unmarshal(payload)
+		d.data = append(d.data, ack.DataChunk...)
+		return d.proceed()
+	}
+	return &trezor.Failure{Code: 1, Message: "Unexpected message"}
+}
+
+// proceed requests the missing transaction data in chunks of at most 100 bytes,
+// signing the transaction once complete.
+func (d *testTrezor) proceed() trezor.Message {
+	if left := int(d.sign.DataLength) - len(d.data); left > 0 {
+		if left > 100 {
+			left = 100
+		}
+		return &trezor.EthereumTxRequest{DataLength: uint32(left)}
+	}
+	var (
+		req    = d.sign
+		signer types.Signer
+		offset uint32
+	)
+	if req.ChainID == 0 {
+		signer, offset = types.HomesteadSigner{}, 27
+	} else {
+		signer, offset = types.NewEIP155Signer(big.NewInt(int64(req.ChainID))), req.ChainID*2+35
+	}
+	nonce := new(big.Int).SetBytes(req.Nonce).Uint64()
+	value, gas, price := new(big.Int).SetBytes(req.Value), new(big.Int).SetBytes(req.GasLimit), new(big.Int).SetBytes(req.GasPrice)
+
+	tx := types.NewTransaction(nonce, common.BytesToAddress(req.To), value, gas, price, d.data)
+	sig, err := crypto.Sign(signer.Hash(tx).Bytes(), d.key)
+	if err != nil {
+		return &trezor.Failure{Code: 99, Message: err.Error()}
+	}
+	return &trezor.EthereumTxRequest{SignatureV: uint32(sig[64]) + offset, SignatureR: sig[:32], SignatureS: sig[32:64]}
+}
+
+// Tests that the Trezor driver unlocks devices, derives accounts and signs both
+// EIP-155 and homestead transactions, streaming long transaction data.
+func TestTrezorDriver(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+
+	device := &testTrezor{key: key, pin: "1234"}
+	driver := newTrezorDriver(log.New()).(*trezorDriver)
+
+	// Open the device, entering the PIN in the second phase
+	if err := driver.Open(device, ""); err != ErrTrezorPINNeeded {
+		t.Fatalf("first phase open error mismatch: have %v, want %v", err, ErrTrezorPINNeeded)
+	}
+	if status, _ := driver.Status(); status != "Trezor v1.5.2 'test' waiting for PIN" {
+		t.Errorf("locked status mismatch: have %q", status)
+	}
+	if err := driver.Open(device, "4321"); err == nil || err.Error() != "trezor: PIN invalid" {
+		t.Fatalf("invalid PIN error mismatch: %v", err)
+	}
+	if err := driver.Open(device, ""); err != ErrTrezorPINNeeded {
+		t.Fatalf("reopen error mismatch: have %v, want %v", err, ErrTrezorPINNeeded)
+	}
+	if err := driver.Open(device, "1234"); err != nil {
+		t.Fatalf("failed to unlock device: %v", err)
+	}
+	if status, _ := driver.Status(); status != "Trezor v1.5.2 'test' online" {
+		t.Errorf("unlocked status mismatch: have %q", status)
+	}
+	// Derive the account and sign transactions with it
+	derived, err := driver.Derive(accounts.DefaultBaseDerivationPath)
+	if err != nil || derived != addr {
+		t.Fatalf("derived address mismatch: have %x, want %x (err %v)", derived, addr, err)
+	}
+	data := bytes.Repeat([]byte{0xff}, trezorDataChunk+250)
+	tx := types.NewTransaction(3, common.Address{0xaa}, big.NewInt(1000), big.NewInt(100000), big.NewInt(20), data)
+
+	for _, chainID := range []*big.Int{big.NewInt(4), nil} {
+		device.confirm = chainID != nil
+
+		sender, signed, err := driver.SignTx(accounts.DefaultBaseDerivationPath, tx, chainID)
+		if err != nil {
+			t.Fatalf("chain %v: failed to sign transaction: %v", chainID, err)
+		}
+		if sender != addr {
+			t.Errorf("chain %v: sender mismatch: have %x, want %x", chainID, sender, addr)
+		}
+		if !bytes.Equal(signed.Data(), data) || signed.Nonce() != 3 || *signed.To() != (common.Address{0xaa}) {
+			t.Errorf("chain %v: signed transaction content mismatch", chainID)
+		}
+		if signed.Protected() != (chainID != nil) {
+			t.Errorf("chain %v: replay protection mismatch", chainID)
+		}
+	}
+	// Ensure unsupported chain ids are rejected
+	if _, _, err := driver.SignTx(accounts.DefaultBaseDerivationPath, tx, new(big.Int).Lsh(common.Big1, 32)); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("oversized chain id error mismatch: %v", err)
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/olekukonko/tablewriter"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	dbDeleteCorruptFlag = cli.BoolFlag{
+		Name:  "delete-corrupt",
+		Usage: "Delete the trie nodes and codes not matching their hashes",
+	}
+	dbCommand = cli.Command{
+		Name:     "db",
+		Usage:    "Low level database operations",
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+Inspect and repair the contents of the local chain database.`,
+		Subcommands: []cli.Command{
+			{
+				Name:      "check-state",
+				Usage:     "Check the consistency of a state trie",
+				ArgsUsage: "[<root>]",
+				Action:    utils.MigrateFlags(checkState),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.CacheFlag,
+					utils.LightModeFlag,
+					dbDeleteCorruptFlag,
+				},
+				Description: `
+geth db check-state [--delete-corrupt] [<root>]
+
+Walks the state with the given root (or the state of the head block if none is
+given), including all the storage tries and contract codes, verifying that every
+referenced item is present in the database and matches its hash. A JSON summary
+of the missing and corrupt items is printed to the standard output, and the
+command fails if any were found.
+
+With --delete-corrupt, the corrupt items are removed from the database, so that
+they are reported missing and can be downloaded again by a state sync. The node
+must not be running.`,
+			},
+			{
+				Name:   "inspect",
+				Usage:  "Inspect the storage size for each type of data in the database",
+				Action: utils.MigrateFlags(inspectDatabase),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.CacheFlag,
+					utils.LightModeFlag,
+				},
+				Description: `
+geth db inspect
+
+Iterates over the entire database, printing the number and total size of the
+entries of each known kind of data (headers, bodies, receipts, trie nodes, etc),
+along with the sizes of the ancient store tables if one is in use.`,
+			},
+			{
+				Name:   "stats",
+				Usage:  "Print the internal statistics of the database",
+				Action: utils.MigrateFlags(databaseStats),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.CacheFlag,
+					utils.LightModeFlag,
+				},
+				Description: `
+geth db stats
+
+Prints the LevelDB compaction and IO statistics of the database.`,
+			},
+			{
+				Name:   "compact",
+				Usage:  "Compact the entire database",
+				Action: utils.MigrateFlags(compactDatabase),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.CacheFlag,
+					utils.LightModeFlag,
+				},
+				Description: `
+geth db compact
+
+Flattens the entire key range of the database, discarding deleted and overwritten
+entries. The LevelDB statistics are printed before and after the compaction. The
+node must not be running.`,
+			},
+		},
+	}
+)
+
+func checkState(ctx *cli.Context) error {
+	if len(ctx.Args()) > 1 {
+		utils.Fatalf("This command accepts at most one argument.")
+	}
+	stack := makeFullNode(ctx)
+	chainDb := utils.MakeChainDatabase(ctx, stack)
+	defer chainDb.Close()
+
+	var root common.Hash
+	if len(ctx.Args()) == 1 {
+		root = common.HexToHash(ctx.Args().First())
+	} else {
+		hash := core.GetHeadBlockHash(chainDb)
+		header := core.GetHeader(chainDb, hash, core.GetBlockNumber(chainDb, hash))
+		if header == nil {
+			utils.Fatalf("Failed to retrieve the head block")
+		}
+		root = header.Root
+	}
+	log.Info("Checking state", "root", root)
+
+	start := time.Now()
+	report, err := state.CheckState(chainDb, root)
+	if err != nil {
+		utils.Fatalf("Failed to check state: %v", err)
+	}
+	log.Info("State check finished", "accounts", report.Accounts, "slots", report.Slots, "nodes", report.Nodes, "elapsed", common.PrettyDuration(time.Since(start)))
+
+	if ctx.Bool(dbDeleteCorruptFlag.Name) {
+		for _, hash := range append(report.Corrupt, report.CorruptCode...) {
+			if err := chainDb.Delete(hash[:]); err != nil {
+				utils.Fatalf("Failed to delete corrupt entry %x: %v", hash, err)
+			}
+		}
+		log.Info("Deleted corrupt entries", "nodes", len(report.Corrupt), "codes", len(report.CorruptCode))
+	}
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		utils.Fatalf("Failed to encode report: %v", err)
+	}
+	fmt.Println(string(out))
+
+	if !report.Healthy() {
+		return errors.New("state is inconsistent")
+	}
+	return nil
+}
+
+func inspectDatabase(ctx *cli.Context) error {
+	stack := makeFullNode(ctx)
+	chainDb := utils.MakeChainDatabase(ctx, stack)
+	defer chainDb.Close()
+
+	stats, err := core.InspectDatabase(chainDb)
+	if err != nil {
+		utils.Fatalf("Failed to inspect database: %v", err)
+	}
+	var (
+		items uint64
+		total common.StorageSize
+	)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Database", "Category", "Items", "Size"})
+	for _, stat := range stats {
+		table.Append([]string{stat.Database, stat.Category, fmt.Sprintf("%d", stat.Items), stat.Size.String()})
+		items += stat.Items
+		total += stat.Size
+	}
+	table.Append([]string{"", "Total", fmt.Sprintf("%d", items), total.String()})
+	table.Render()
+	return nil
+}
+
+func databaseStats(ctx *cli.Context) error {
+	stack := makeFullNode(ctx)
+	chainDb := utils.MakeChainDatabase(ctx, stack)
+	defer chainDb.Close()
+
+	printDatabaseStats(chainDb)
+	return nil
+}
+
+func compactDatabase(ctx *cli.Context) error {
+	stack := makeFullNode(ctx)
+	chainDb := utils.MakeChainDatabase(ctx, stack)
+	defer chainDb.Close()
+
+	db, ok := chainDb.(ethdb.Compacter)
+	if !ok {
+		utils.Fatalf("Database does not support compaction")
+	}
+	printDatabaseStats(chainDb)
+
+	start := time.Now()
+	log.Info("Compacting entire database")
+	if err := db.Compact(nil, nil); err != nil {
+		utils.Fatalf("Compaction failed: %v", err)
+	}
+	log.Info("Database compaction finished", "elapsed", common.PrettyDuration(time.Since(start)))
+
+	printDatabaseStats(chainDb)
+	return nil
+}
+
+// printDatabaseStats prints the internal statistics of the database, if it
+// supports reporting them.
+func printDatabaseStats(db ethdb.Database) {
+	stater, ok := db.(ethdb.Stater)
+	if !ok {
+		utils.Fatalf("Database does not support statistics")
+	}
+	stats, err := stater.Stat("leveldb.stats")
+	if err != nil {
+		utils.Fatalf("Failed to read database stats: %v", err)
+	}
+	fmt.Println(stats)
+}
@@ -26,6 +26,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/accounts/usbwallet"
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/console"
@@ -58,15 +59,22 @@ var (
 		utils.BootnodesV4Flag,
 		utils.BootnodesV5Flag,
 		utils.DataDirFlag,
+		utils.AncientFlag,
 		utils.KeyStoreDirFlag,
 		utils.NoUSBFlag,
+		utils.ExternalSignerFlag,
+		utils.HDPathFlag,
 		utils.EthashCacheDirFlag,
 		utils.EthashCachesInMemoryFlag,
 		utils.EthashCachesOnDiskFlag,
 		utils.EthashDatasetDirFlag,
 		utils.EthashDatasetsInMemoryFlag,
 		utils.EthashDatasetsOnDiskFlag,
+		utils.TxPoolLocalsFlag,
 		utils.TxPoolNoLocalsFlag,
+		utils.TxPoolJournalFlag,
+		utils.TxPoolRejournalFlag,
+		utils.TxPoolRebroadcastFlag,
 		utils.TxPoolPriceLimitFlag,
 		utils.TxPoolPriceBumpFlag,
 		utils.TxPoolAccountSlotsFlag,
@@ -77,10 +85,22 @@ var (
 		utils.FastSyncFlag,
 		utils.LightModeFlag,
 		utils.SyncModeFlag,
+		utils.PivotStaleFlag,
+		utils.GCModeFlag,
+		utils.TxLookupLimitFlag,
+		utils.WhitelistFlag,
+		utils.CheckpointHashFlag,
+		utils.CheckpointTDFlag,
 		utils.LightServFlag,
 		utils.LightPeersFlag,
+		utils.LightPriorityFlag,
+		utils.ULCServersFlag,
+		utils.ULCFractionFlag,
 		utils.LightKDFFlag,
+		utils.KeyStoreScryptNFlag,
+		utils.KeyStoreScryptPFlag,
 		utils.CacheFlag,
+		utils.TrieCacheFlag,
 		utils.TrieCacheGenFlag,
 		utils.ListenPortFlag,
 		utils.MaxPeersFlag,
@@ -88,6 +108,8 @@ var (
 		utils.EtherbaseFlag,
 		utils.GasPriceFlag,
 		utils.MinerThreadsFlag,
+		utils.MinerNotifyFlag,
+		utils.MinerRecommitIntervalFlag,
 		utils.MiningEnabledFlag,
 		utils.TargetGasLimitFlag,
 		utils.NATFlag,
@@ -97,17 +119,20 @@ var (
 		utils.NodeKeyFileFlag,
 		utils.NodeKeyHexFlag,
 		utils.DevModeFlag,
+		utils.DevPeriodFlag,
 		utils.TestnetFlag,
 		utils.RinkebyFlag,
 		utils.VMEnableDebugFlag,
 		utils.NetworkIdFlag,
 		utils.RPCCORSDomainFlag,
+		utils.RPCVirtualHostsFlag,
 		utils.EthStatsURLFlag,
 		utils.MetricsEnabledFlag,
 		utils.FakePoWFlag,
 		utils.NoCompactionFlag,
 		utils.GpoBlocksFlag,
 		utils.GpoPercentileFlag,
+		utils.GpoMaxGasPriceFlag,
 		utils.ExtraDataFlag,
 		configFileFlag,
 	}
@@ -117,11 +142,26 @@ var (
 		utils.RPCListenAddrFlag,
 		utils.RPCPortFlag,
 		utils.RPCApiFlag,
+		utils.RPCGasCapFlag,
+		utils.RPCEVMTimeoutFlag,
+		utils.RPCFilterTimeoutFlag,
+		utils.RPCLogsRangeLimitFlag,
+		utils.RPCLogsResultLimitFlag,
+		utils.RPCBatchRequestLimitFlag,
+		utils.RPCBatchResponseMaxSizeFlag,
+		utils.RPCMethodConcurrencyFlag,
+		utils.RPCSlowCallThresholdFlag,
+		utils.GraphQLEnabledFlag,
 		utils.WSEnabledFlag,
 		utils.WSListenAddrFlag,
 		utils.WSPortFlag,
 		utils.WSApiFlag,
 		utils.WSAllowedOriginsFlag,
+		utils.AuthEnabledFlag,
+		utils.AuthListenAddrFlag,
+		utils.AuthPortFlag,
+		utils.AuthApiFlag,
+		utils.AuthJWTSecretFlag,
 		utils.IPCDisabledFlag,
 		utils.IPCPathFlag,
 	}
@@ -145,6 +185,10 @@ func init() {
 		exportCommand,
 		removedbCommand,
 		dumpCommand,
+		// See snapshot.go:
+		snapshotCommand,
+		// See dbcmd.go:
+		dbCommand,
 		// See monitorcmd.go:
 		monitorCommand,
 		// See accountcmd.go:
@@ -212,17 +256,26 @@ func startNode(ctx *cli.Context, stack *node.Node) {
 	// Start up the node itself
 	utils.StartNode(stack)
 
-	// Unlock any account specifically requested
-	ks := stack.AccountManager().Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
-
+	// Unlock any account specifically requested, only possible with a local keystore
+	var ks *keystore.KeyStore
+	if keystores := stack.AccountManager().Backends(keystore.KeyStoreType); len(keystores) > 0 {
+		ks = keystores[0].(*keystore.KeyStore)
+	}
 	passwords := utils.MakePasswordList(ctx)
 	unlocks := strings.Split(ctx.GlobalString(utils.UnlockedAccountFlag.Name), ",")
 	for i, account := range unlocks {
 		if trimmed := strings.TrimSpace(account); trimmed != "" {
+			if ks == nil {
+				utils.Fatalf("Account unlocking requires the local keystore")
+			}
 			unlockAccount(ctx, ks, trimmed, i, passwords)
 		}
 	}
 	// Register wallet event handlers to open and auto-derive wallets
+	basePath, err := accounts.ParseDerivationPath(ctx.GlobalString(utils.HDPathFlag.Name))
+	if err != nil {
+		utils.Fatalf("Invalid HD derivation path: %v", err)
+	}
 	events := make(chan accounts.WalletEvent, 16)
 	stack.AccountManager().Subscribe(events)
 
@@ -236,20 +289,21 @@ func startNode(ctx *cli.Context, stack *node.Node) {
 
 		// Open and self derive any wallets already attached
 		for _, wallet := range stack.AccountManager().Wallets() {
-			if err := wallet.Open(""); err != nil {
+			if err := wallet.Open(""); err != nil && err != usbwallet.ErrTrezorPINNeeded {
 				log.Warn("Failed to open wallet", "url", wallet.URL(), "err", err)
 			} else {
-				wallet.SelfDerive(accounts.DefaultBaseDerivationPath, stateReader)
+				wallet.SelfDerive(basePath, stateReader)
 			}
 		}
 		// Listen for wallet event till termination
 		for event := range events {
 			if event.Arrive {
-				if err := event.Wallet.Open(""); err != nil {
+				// Wallets waiting for a PIN self derive once opened via personal.openWallet
+				if err := event.Wallet.Open(""); err != nil && err != usbwallet.ErrTrezorPINNeeded {
 					log.Warn("New wallet appeared, failed to open", "url", event.Wallet.URL(), "err", err)
 				} else {
 					log.Info("New wallet appeared", "url", event.Wallet.URL(), "status", event.Wallet.Status())
-					event.Wallet.SelfDerive(accounts.DefaultBaseDerivationPath, stateReader)
+					event.Wallet.SelfDerive(basePath, stateReader)
 				}
 			} else {
 				log.Info("Old wallet dropped", "url", event.Wallet.URL())
@@ -258,7 +312,7 @@ func startNode(ctx *cli.Context, stack *node.Node) {
 		}
 	}()
 	// Start auxiliary services if enabled
-	if ctx.GlobalBool(utils.MiningEnabledFlag.Name) {
+	if ctx.GlobalBool(utils.MiningEnabledFlag.Name) || ctx.GlobalBool(utils.DevModeFlag.Name) {
 		// Mining only makes sense if a full Ethereum node is running
 		var ethereum *eth.Ethereum
 		if err := stack.Service(&ethereum); err != nil {
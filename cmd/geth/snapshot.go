@@ -0,0 +1,79 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/light"
+	"github.com/ethereum/go-ethereum/log"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	snapshotRetainFlag = cli.Uint64Flag{
+		Name:  "retain",
+		Value: 128,
+		Usage: "Number of recent canonical block states to keep",
+	}
+	snapshotCommand = cli.Command{
+		Name:     "snapshot",
+		Usage:    "Manage the state of the local database",
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+Manage the state tries stored in the local chain database.`,
+		Subcommands: []cli.Command{
+			{
+				Name:      "prune-state",
+				Usage:     "Prune stale state trie nodes from the database",
+				ArgsUsage: " ",
+				Action:    utils.MigrateFlags(pruneState),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.CacheFlag,
+					utils.LightModeFlag,
+					snapshotRetainFlag,
+				},
+				Description: `
+geth snapshot prune-state [--retain N]
+
+Deletes all the state trie nodes and contract codes from the database that are
+not reachable from the states of the last N canonical blocks. The canonical hash
+tries generated for light clients are kept too. The node must not be running.
+
+After pruning, historical states older than the retained ones are unavailable
+and would need to be regenerated by re-executing the chain.`,
+			},
+		},
+	}
+)
+
+func pruneState(ctx *cli.Context) error {
+	stack := makeFullNode(ctx)
+	chain, chainDb := utils.MakeChain(ctx, stack)
+	defer chainDb.Close()
+
+	start := time.Now()
+	nodes, size, err := chain.PruneState(ctx.Uint64(snapshotRetainFlag.Name), light.GetHelperTrieRoots(chainDb))
+	if err != nil {
+		utils.Fatalf("Failed to prune state: %v", err)
+	}
+	log.Info("State pruning finished", "nodes", nodes, "size", size, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
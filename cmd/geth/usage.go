@@ -67,17 +67,30 @@ var AppHelpFlagGroups = []flagGroup{
 		Flags: []cli.Flag{
 			configFileFlag,
 			utils.DataDirFlag,
+			utils.AncientFlag,
 			utils.KeyStoreDirFlag,
 			utils.NoUSBFlag,
+			utils.ExternalSignerFlag,
+			utils.HDPathFlag,
 			utils.NetworkIdFlag,
 			utils.TestnetFlag,
 			utils.RinkebyFlag,
 			utils.DevModeFlag,
+			utils.DevPeriodFlag,
 			utils.SyncModeFlag,
+			utils.PivotStaleFlag,
+			utils.GCModeFlag,
+			utils.TxLookupLimitFlag,
+			utils.WhitelistFlag,
+			utils.CheckpointHashFlag,
+			utils.CheckpointTDFlag,
 			utils.EthStatsURLFlag,
 			utils.IdentityFlag,
 			utils.LightServFlag,
 			utils.LightPeersFlag,
+			utils.LightPriorityFlag,
+			utils.ULCServersFlag,
+			utils.ULCFractionFlag,
 			utils.LightKDFFlag,
 		},
 	},
@@ -95,7 +108,11 @@ var AppHelpFlagGroups = []flagGroup{
 	{
 		Name: "TRANSACTION POOL",
 		Flags: []cli.Flag{
+			utils.TxPoolLocalsFlag,
 			utils.TxPoolNoLocalsFlag,
+			utils.TxPoolJournalFlag,
+			utils.TxPoolRejournalFlag,
+			utils.TxPoolRebroadcastFlag,
 			utils.TxPoolPriceLimitFlag,
 			utils.TxPoolPriceBumpFlag,
 			utils.TxPoolAccountSlotsFlag,
@@ -109,6 +126,7 @@ var AppHelpFlagGroups = []flagGroup{
 		Name: "PERFORMANCE TUNING",
 		Flags: []cli.Flag{
 			utils.CacheFlag,
+			utils.TrieCacheFlag,
 			utils.TrieCacheGenFlag,
 		},
 	},
@@ -117,6 +135,8 @@ var AppHelpFlagGroups = []flagGroup{
 		Flags: []cli.Flag{
 			utils.UnlockedAccountFlag,
 			utils.PasswordFileFlag,
+			utils.KeyStoreScryptNFlag,
+			utils.KeyStoreScryptPFlag,
 		},
 	},
 	{
@@ -126,14 +146,30 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.RPCListenAddrFlag,
 			utils.RPCPortFlag,
 			utils.RPCApiFlag,
+			utils.RPCGasCapFlag,
+			utils.RPCEVMTimeoutFlag,
+			utils.RPCFilterTimeoutFlag,
+			utils.RPCLogsRangeLimitFlag,
+			utils.RPCLogsResultLimitFlag,
+			utils.RPCBatchRequestLimitFlag,
+			utils.RPCBatchResponseMaxSizeFlag,
+			utils.RPCMethodConcurrencyFlag,
+			utils.RPCSlowCallThresholdFlag,
+			utils.GraphQLEnabledFlag,
 			utils.WSEnabledFlag,
 			utils.WSListenAddrFlag,
 			utils.WSPortFlag,
 			utils.WSApiFlag,
 			utils.WSAllowedOriginsFlag,
+			utils.AuthEnabledFlag,
+			utils.AuthListenAddrFlag,
+			utils.AuthPortFlag,
+			utils.AuthApiFlag,
+			utils.AuthJWTSecretFlag,
 			utils.IPCDisabledFlag,
 			utils.IPCPathFlag,
 			utils.RPCCORSDomainFlag,
+			utils.RPCVirtualHostsFlag,
 			utils.JSpathFlag,
 			utils.ExecFlag,
 			utils.PreloadJSFlag,
@@ -161,6 +197,8 @@ var AppHelpFlagGroups = []flagGroup{
 		Flags: []cli.Flag{
 			utils.MiningEnabledFlag,
 			utils.MinerThreadsFlag,
+			utils.MinerNotifyFlag,
+			utils.MinerRecommitIntervalFlag,
 			utils.EtherbaseFlag,
 			utils.TargetGasLimitFlag,
 			utils.GasPriceFlag,
@@ -172,6 +210,7 @@ var AppHelpFlagGroups = []flagGroup{
 		Flags: []cli.Flag{
 			utils.GpoBlocksFlag,
 			utils.GpoPercentileFlag,
+			utils.GpoMaxGasPriceFlag,
 		},
 	},
 	{
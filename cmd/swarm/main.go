@@ -476,8 +476,11 @@ func getAccount(ctx *cli.Context, stack *node.Node) *ecdsa.PrivateKey {
 		return key
 	}
 	// Otherwise try getting it from the keystore.
-	am := stack.AccountManager()
-	ks := am.Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+	keystores := stack.AccountManager().Backends(keystore.KeyStoreType)
+	if len(keystores) == 0 {
+		utils.Fatalf("Swarm account %s requires the local keystore", keyid)
+	}
+	ks := keystores[0].(*keystore.KeyStore)
 
 	return decryptStoreAccount(ks, keyid, utils.MakePasswordList(ctx))
 }
@@ -19,6 +19,7 @@ package utils
 
 import (
 	"crypto/ecdsa"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/big"
@@ -42,6 +43,7 @@ import (
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/ethstats"
 	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/graphql"
 	"github.com/ethereum/go-ethereum/les"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
@@ -115,6 +117,10 @@ var (
 		Usage: "Data directory for the databases and keystore",
 		Value: DirectoryString{node.DefaultDataDir()},
 	}
+	AncientFlag = DirectoryFlag{
+		Name:  "datadir.ancient",
+		Usage: "Data directory for ancient chain segments (default = inside chaindata)",
+	}
 	KeyStoreDirFlag = DirectoryFlag{
 		Name:  "keystore",
 		Usage: "Directory for the keystore (default = inside the datadir)",
@@ -123,6 +129,15 @@ var (
 		Name:  "nousb",
 		Usage: "Disables monitoring for and managine USB hardware wallets",
 	}
+	ExternalSignerFlag = cli.StringFlag{
+		Name:  "signer",
+		Usage: "External signer (url or path to ipc file), replacing the local keystore",
+	}
+	HDPathFlag = cli.StringFlag{
+		Name:  "hdpath",
+		Usage: "Base derivation path to discover used accounts of HD wallets with",
+		Value: accounts.DefaultBaseDerivationPath.String(),
+	}
 	NetworkIdFlag = cli.Uint64Flag{
 		Name:  "networkid",
 		Usage: "Network identifier (integer, 1=Frontier, 2=Morden (disused), 3=Ropsten, 4=Rinkeby)",
@@ -138,7 +153,11 @@ var (
 	}
 	DevModeFlag = cli.BoolFlag{
 		Name:  "dev",
-		Usage: "Developer mode: pre-configured private network with several debugging flags",
+		Usage: "Ephemeral proof-of-authority network with a pre-funded developer account, mining enabled",
+	}
+	DevPeriodFlag = cli.IntFlag{
+		Name:  "dev.period",
+		Usage: "Block period to use in developer mode (0 = mine only if transaction pending)",
 	}
 	IdentityFlag = cli.StringFlag{
 		Name:  "identity",
@@ -160,9 +179,37 @@ var (
 	defaultSyncMode = eth.DefaultConfig.SyncMode
 	SyncModeFlag    = TextMarshalerFlag{
 		Name:  "syncmode",
-		Usage: `Blockchain sync mode ("fast", "full", or "light")`,
+		Usage: `Blockchain sync mode ("fast", "full", "light" or "checkpoint")`,
 		Value: &defaultSyncMode,
 	}
+	CheckpointHashFlag = cli.StringFlag{
+		Name:  "checkpoint.hash",
+		Usage: "Hash of the trusted block to synchronise from in checkpoint sync mode",
+	}
+	CheckpointTDFlag = BigFlag{
+		Name:  "checkpoint.td",
+		Usage: "Total difficulty of the trusted block to synchronise from in checkpoint sync mode",
+		Value: new(big.Int),
+	}
+	PivotStaleFlag = cli.Uint64Flag{
+		Name:  "pivotstale",
+		Usage: "Number of blocks the fast sync pivot may fall behind the chain head before being moved",
+		Value: eth.DefaultConfig.PivotStale,
+	}
+	GCModeFlag = cli.StringFlag{
+		Name:  "gcmode",
+		Usage: `Blockchain garbage collection mode ("full", "archive")`,
+		Value: "full",
+	}
+	TxLookupLimitFlag = cli.Uint64Flag{
+		Name:  "txlookuplimit",
+		Usage: "Number of recent blocks to maintain transactions index by-hash for (default = index all blocks)",
+		Value: 0,
+	}
+	WhitelistFlag = cli.StringFlag{
+		Name:  "whitelist",
+		Usage: "Comma separated block number-to-hash mappings peers must agree with (<number>=<hash>)",
+	}
 
 	LightServFlag = cli.IntFlag{
 		Name:  "lightserv",
@@ -174,10 +221,31 @@ var (
 		Usage: "Maximum number of LES client peers",
 		Value: 20,
 	}
+	LightPriorityFlag = cli.StringFlag{
+		Name:  "lightpriority",
+		Usage: "Comma separated node IDs of LES clients to serve with priority (e.g. trusted or paying ones)",
+	}
+	ULCServersFlag = cli.StringFlag{
+		Name:  "ulc.servers",
+		Usage: "Comma separated enode URLs of trusted LES servers to run an ultra light client with",
+	}
+	ULCFractionFlag = cli.IntFlag{
+		Name:  "ulc.fraction",
+		Usage: "Minimum percentage of trusted LES servers that must announce a head to accept it (1-100)",
+		Value: 75,
+	}
 	LightKDFFlag = cli.BoolFlag{
 		Name:  "lightkdf",
 		Usage: "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
 	}
+	KeyStoreScryptNFlag = cli.IntFlag{
+		Name:  "keystore.scryptn",
+		Usage: "Custom scrypt N parameter (power of two, at most 262144) for encrypting new keys, overriding the KDF preset",
+	}
+	KeyStoreScryptPFlag = cli.IntFlag{
+		Name:  "keystore.scryptp",
+		Usage: "Custom scrypt P parameter for encrypting new keys, overriding the KDF preset",
+	}
 	// Ethash settings
 	EthashCacheDirFlag = DirectoryFlag{
 		Name:  "ethash.cachedir",
@@ -209,10 +277,29 @@ var (
 		Value: eth.DefaultConfig.EthashDatasetsOnDisk,
 	}
 	// Transaction pool settings
+	TxPoolLocalsFlag = cli.StringFlag{
+		Name:  "txpool.locals",
+		Usage: "Comma separated accounts to treat as locals (no flush, priority inclusion)",
+	}
 	TxPoolNoLocalsFlag = cli.BoolFlag{
 		Name:  "txpool.nolocals",
 		Usage: "Disables price exemptions for locally submitted transactions",
 	}
+	TxPoolJournalFlag = cli.StringFlag{
+		Name:  "txpool.journal",
+		Usage: "Disk journal for local transaction to survive node restarts",
+		Value: core.DefaultTxPoolConfig.Journal,
+	}
+	TxPoolRejournalFlag = cli.DurationFlag{
+		Name:  "txpool.rejournal",
+		Usage: "Time interval to regenerate the local transaction journal",
+		Value: core.DefaultTxPoolConfig.Rejournal,
+	}
+	TxPoolRebroadcastFlag = cli.DurationFlag{
+		Name:  "txpool.rebroadcast",
+		Usage: "Time interval to re-propagate pending local transactions",
+		Value: core.DefaultTxPoolConfig.Rebroadcast,
+	}
 	TxPoolPriceLimitFlag = cli.Uint64Flag{
 		Name:  "txpool.pricelimit",
 		Usage: "Minimum gas price limit to enforce for acceptance into the pool",
@@ -254,6 +341,11 @@ var (
 		Usage: "Megabytes of memory allocated to internal caching (min 16MB / database forced)",
 		Value: 128,
 	}
+	TrieCacheFlag = cli.IntFlag{
+		Name:  "cache.trie",
+		Usage: "Megabytes of memory allowed for recent state trie nodes before flushing them to disk (0 = unlimited)",
+		Value: eth.DefaultConfig.TrieCache,
+	}
 	TrieCacheGenFlag = cli.IntFlag{
 		Name:  "trie-cache-gens",
 		Usage: "Number of trie node generations to keep in memory",
@@ -269,6 +361,15 @@ var (
 		Usage: "Number of CPU threads to use for mining",
 		Value: runtime.NumCPU(),
 	}
+	MinerNotifyFlag = cli.StringFlag{
+		Name:  "minernotify",
+		Usage: "Comma separated HTTP URL list to notify of new work packages",
+	}
+	MinerRecommitIntervalFlag = cli.DurationFlag{
+		Name:  "minerrecommit",
+		Usage: "Time interval to recreate the block being mined",
+		Value: eth.DefaultConfig.MinerRecommit,
+	}
 	TargetGasLimitFlag = cli.Uint64Flag{
 		Name:  "targetgaslimit",
 		Usage: "Target gas limit sets the artificial target gas floor for the blocks to mine",
@@ -341,11 +442,64 @@ var (
 		Usage: "Comma separated list of domains from which to accept cross origin requests (browser enforced)",
 		Value: "",
 	}
+	RPCVirtualHostsFlag = cli.StringFlag{
+		Name:  "rpcvhosts",
+		Usage: "Comma separated list of virtual hostnames from which to accept requests (server enforced). Accepts '*' wildcard.",
+		Value: strings.Join(node.DefaultConfig.HTTPVirtualHosts, ","),
+	}
 	RPCApiFlag = cli.StringFlag{
 		Name:  "rpcapi",
 		Usage: "API's offered over the HTTP-RPC interface",
 		Value: "",
 	}
+	RPCGasCapFlag = cli.Uint64Flag{
+		Name:  "rpc.gascap",
+		Usage: "Gas cap applied to eth_call and eth_estimateGas (0 = no cap)",
+	}
+	RPCEVMTimeoutFlag = cli.DurationFlag{
+		Name:  "rpc.evmtimeout",
+		Usage: "Execution timeout of eth_call and eth_estimateGas (0 = no timeout)",
+		Value: eth.DefaultConfig.RPCEVMTimeout,
+	}
+	RPCFilterTimeoutFlag = cli.DurationFlag{
+		Name:  "rpc.filtertimeout",
+		Usage: "Time after which filters not polled anymore are uninstalled",
+		Value: eth.DefaultConfig.FilterTimeout,
+	}
+	RPCLogsRangeLimitFlag = cli.Uint64Flag{
+		Name:  "rpc.logsrangelimit",
+		Usage: "Maximum number of blocks searched by eth_getLogs (0 = no limit)",
+		Value: eth.DefaultConfig.LogsRangeLimit,
+	}
+	RPCLogsResultLimitFlag = cli.IntFlag{
+		Name:  "rpc.logsresultlimit",
+		Usage: "Maximum number of logs returned by eth_getLogs (0 = no limit)",
+		Value: eth.DefaultConfig.LogsResultLimit,
+	}
+	RPCBatchRequestLimitFlag = cli.IntFlag{
+		Name:  "rpc.batchlimit",
+		Usage: "Maximum number of requests in a batch (0 = no limit)",
+		Value: node.DefaultConfig.BatchRequestLimit,
+	}
+	RPCBatchResponseMaxSizeFlag = cli.IntFlag{
+		Name:  "rpc.batchresponsemaxsize",
+		Usage: "Maximum number of response bytes of a batch (0 = no limit)",
+		Value: node.DefaultConfig.BatchResponseMaxSize,
+	}
+	RPCMethodConcurrencyFlag = cli.IntFlag{
+		Name:  "rpc.methodconcurrency",
+		Usage: "Maximum number of concurrent executions of any RPC method (0 = no limit)",
+		Value: node.DefaultConfig.MethodConcurrencyLimit,
+	}
+	RPCSlowCallThresholdFlag = cli.DurationFlag{
+		Name:  "rpc.slowcalls",
+		Usage: "Execution time beyond which RPC calls are logged as slow (0 = disabled)",
+		Value: node.DefaultConfig.SlowCallThreshold,
+	}
+	GraphQLEnabledFlag = cli.BoolFlag{
+		Name:  "graphql",
+		Usage: "Enable GraphQL queries on the HTTP-RPC server under /graphql",
+	}
 	IPCDisabledFlag = cli.BoolFlag{
 		Name:  "ipcdisable",
 		Usage: "Disable the IPC-RPC server",
@@ -378,6 +532,29 @@ var (
 		Usage: "Origins from which to accept websockets requests",
 		Value: "",
 	}
+	AuthEnabledFlag = cli.BoolFlag{
+		Name:  "authrpc",
+		Usage: "Enable the JWT authenticated HTTP and WS RPC server",
+	}
+	AuthListenAddrFlag = cli.StringFlag{
+		Name:  "authrpc.addr",
+		Usage: "Authenticated RPC server listening interface",
+		Value: node.DefaultAuthHost,
+	}
+	AuthPortFlag = cli.IntFlag{
+		Name:  "authrpc.port",
+		Usage: "Authenticated RPC server listening port",
+		Value: node.DefaultAuthPort,
+	}
+	AuthApiFlag = cli.StringFlag{
+		Name:  "authrpc.api",
+		Usage: "API's offered over the authenticated RPC interface",
+		Value: strings.Join(node.DefaultConfig.AuthModules, ","),
+	}
+	AuthJWTSecretFlag = DirectoryFlag{
+		Name:  "authrpc.jwtsecret",
+		Usage: "Path to the hex encoded JWT secret of the authenticated RPC server (generated if missing)",
+	}
 	ExecFlag = cli.StringFlag{
 		Name:  "exec",
 		Usage: "Execute JavaScript statement",
@@ -462,6 +639,11 @@ var (
 		Usage: "Suggested gas price is the given percentile of a set of recent transaction gas prices",
 		Value: eth.DefaultConfig.GPO.Percentile,
 	}
+	GpoMaxGasPriceFlag = BigFlag{
+		Name:  "gpomaxprice",
+		Usage: "Maximum gas price that will be recommended by the gas price oracle",
+		Value: eth.DefaultConfig.GPO.MaxPrice,
+	}
 	WhisperEnabledFlag = cli.BoolFlag{
 		Name:  "shh",
 		Usage: "Enable Whisper",
@@ -640,6 +822,9 @@ func setHTTP(ctx *cli.Context, cfg *node.Config) {
 	if ctx.GlobalIsSet(RPCApiFlag.Name) {
 		cfg.HTTPModules = splitAndTrim(ctx.GlobalString(RPCApiFlag.Name))
 	}
+	if ctx.GlobalIsSet(RPCVirtualHostsFlag.Name) {
+		cfg.HTTPVirtualHosts = splitAndTrim(ctx.GlobalString(RPCVirtualHostsFlag.Name))
+	}
 }
 
 // setWS creates the WebSocket RPC listener interface string from the set
@@ -663,6 +848,44 @@ func setWS(ctx *cli.Context, cfg *node.Config) {
 	}
 }
 
+// setAuth creates the authenticated RPC listener interface string from the set
+// command line flags, returning empty if the authenticated endpoint is disabled.
+func setAuth(ctx *cli.Context, cfg *node.Config) {
+	if ctx.GlobalBool(AuthEnabledFlag.Name) && cfg.AuthHost == "" {
+		cfg.AuthHost = "127.0.0.1"
+		if ctx.GlobalIsSet(AuthListenAddrFlag.Name) {
+			cfg.AuthHost = ctx.GlobalString(AuthListenAddrFlag.Name)
+		}
+	}
+
+	if ctx.GlobalIsSet(AuthPortFlag.Name) {
+		cfg.AuthPort = ctx.GlobalInt(AuthPortFlag.Name)
+	}
+	if ctx.GlobalIsSet(AuthApiFlag.Name) {
+		cfg.AuthModules = splitAndTrim(ctx.GlobalString(AuthApiFlag.Name))
+	}
+	if ctx.GlobalIsSet(AuthJWTSecretFlag.Name) {
+		cfg.JWTSecret = ctx.GlobalString(AuthJWTSecretFlag.Name)
+	}
+}
+
+// setRPCLimits applies the request limits and slow call logging of the RPC
+// servers from the set command line flags.
+func setRPCLimits(ctx *cli.Context, cfg *node.Config) {
+	if ctx.GlobalIsSet(RPCBatchRequestLimitFlag.Name) {
+		cfg.BatchRequestLimit = ctx.GlobalInt(RPCBatchRequestLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCBatchResponseMaxSizeFlag.Name) {
+		cfg.BatchResponseMaxSize = ctx.GlobalInt(RPCBatchResponseMaxSizeFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCMethodConcurrencyFlag.Name) {
+		cfg.MethodConcurrencyLimit = ctx.GlobalInt(RPCMethodConcurrencyFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCSlowCallThresholdFlag.Name) {
+		cfg.SlowCallThreshold = ctx.GlobalDuration(RPCSlowCallThresholdFlag.Name)
+	}
+}
+
 // setIPC creates an IPC path configuration from the set command line flags,
 // returning an empty string if IPC was explicitly disabled, or the set path.
 func setIPC(ctx *cli.Context, cfg *node.Config) {
@@ -710,24 +933,71 @@ func MakeAddress(ks *keystore.KeyStore, account string) (accounts.Account, error
 	return accs[index], nil
 }
 
+// setCheckpoint creates the trusted checkpoint of checkpoint sync from the
+// command line flags, if set.
+func setCheckpoint(ctx *cli.Context, cfg *eth.Config) {
+	hashSet, tdSet := ctx.GlobalIsSet(CheckpointHashFlag.Name), ctx.GlobalIsSet(CheckpointTDFlag.Name)
+	if !hashSet && !tdSet {
+		return
+	}
+	if !hashSet || !tdSet {
+		Fatalf("Options %q and %q must be set together", CheckpointHashFlag.Name, CheckpointTDFlag.Name)
+	}
+	var hash common.Hash
+	if err := hash.UnmarshalText([]byte(ctx.GlobalString(CheckpointHashFlag.Name))); err != nil {
+		Fatalf("Option %q: %v", CheckpointHashFlag.Name, err)
+	}
+	cfg.Checkpoint = &downloader.Checkpoint{Hash: hash, TD: GlobalBig(ctx, CheckpointTDFlag.Name)}
+}
+
+// setWhitelist creates the set of blocks peers are required to agree with from
+// the command line flags, if set.
+func setWhitelist(ctx *cli.Context, cfg *eth.Config) {
+	whitelist := ctx.GlobalString(WhitelistFlag.Name)
+	if whitelist == "" {
+		return
+	}
+	cfg.Whitelist = make(map[uint64]common.Hash)
+	for _, entry := range strings.Split(whitelist, ",") {
+		parts := strings.Split(entry, "=")
+		if len(parts) != 2 {
+			Fatalf("Invalid whitelist entry: %s", entry)
+		}
+		number, err := strconv.ParseUint(parts[0], 0, 64)
+		if err != nil {
+			Fatalf("Invalid whitelist block number %s: %v", parts[0], err)
+		}
+		var hash common.Hash
+		if err = hash.UnmarshalText([]byte(parts[1])); err != nil {
+			Fatalf("Invalid whitelist hash %s: %v", parts[1], err)
+		}
+		cfg.Whitelist[number] = hash
+	}
+}
+
 // setEtherbase retrieves the etherbase either from the directly specified
-// command line flags or from the keystore if CLI indexed.
+// command line flags or from the keystore if CLI indexed. Without a keystore
+// (e.g. with an external signer), only explicit addresses can be used.
 func setEtherbase(ctx *cli.Context, ks *keystore.KeyStore, cfg *eth.Config) {
 	if ctx.GlobalIsSet(EtherbaseFlag.Name) {
-		account, err := MakeAddress(ks, ctx.GlobalString(EtherbaseFlag.Name))
+		etherbase := ctx.GlobalString(EtherbaseFlag.Name)
+		if ks == nil && !common.IsHexAddress(etherbase) {
+			Fatalf("Option %q: account index requires the local keystore", EtherbaseFlag.Name)
+		}
+		account, err := MakeAddress(ks, etherbase)
 		if err != nil {
 			Fatalf("Option %q: %v", EtherbaseFlag.Name, err)
 		}
 		cfg.Etherbase = account.Address
 		return
 	}
-	accounts := ks.Accounts()
-	if (cfg.Etherbase == common.Address{}) {
-		if len(accounts) > 0 {
-			cfg.Etherbase = accounts[0].Address
-		} else {
-			log.Warn("No etherbase set and no accounts found as default")
-		}
+	if ks == nil || (cfg.Etherbase != common.Address{}) {
+		return
+	}
+	if accounts := ks.Accounts(); len(accounts) > 0 {
+		cfg.Etherbase = accounts[0].Address
+	} else {
+		log.Warn("No etherbase set and no accounts found as default")
 	}
 }
 
@@ -801,13 +1071,15 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	setIPC(ctx, cfg)
 	setHTTP(ctx, cfg)
 	setWS(ctx, cfg)
+	setAuth(ctx, cfg)
+	setRPCLimits(ctx, cfg)
 	setNodeUserIdent(ctx, cfg)
 
 	switch {
 	case ctx.GlobalIsSet(DataDirFlag.Name):
 		cfg.DataDir = ctx.GlobalString(DataDirFlag.Name)
 	case ctx.GlobalBool(DevModeFlag.Name):
-		cfg.DataDir = filepath.Join(os.TempDir(), "ethereum_dev_mode")
+		cfg.DataDir = "" // ephemeral
 	case ctx.GlobalBool(TestnetFlag.Name):
 		cfg.DataDir = filepath.Join(node.DefaultDataDir(), "testnet")
 	case ctx.GlobalBool(RinkebyFlag.Name):
@@ -820,9 +1092,18 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	if ctx.GlobalIsSet(LightKDFFlag.Name) {
 		cfg.UseLightweightKDF = ctx.GlobalBool(LightKDFFlag.Name)
 	}
+	if ctx.GlobalIsSet(KeyStoreScryptNFlag.Name) {
+		cfg.KeyStoreScryptN = ctx.GlobalInt(KeyStoreScryptNFlag.Name)
+	}
+	if ctx.GlobalIsSet(KeyStoreScryptPFlag.Name) {
+		cfg.KeyStoreScryptP = ctx.GlobalInt(KeyStoreScryptPFlag.Name)
+	}
 	if ctx.GlobalIsSet(NoUSBFlag.Name) {
 		cfg.NoUSB = ctx.GlobalBool(NoUSBFlag.Name)
 	}
+	if ctx.GlobalIsSet(ExternalSignerFlag.Name) {
+		cfg.ExternalSigner = ctx.GlobalString(ExternalSignerFlag.Name)
+	}
 }
 
 func setGPO(ctx *cli.Context, cfg *gasprice.Config) {
@@ -832,12 +1113,33 @@ func setGPO(ctx *cli.Context, cfg *gasprice.Config) {
 	if ctx.GlobalIsSet(GpoPercentileFlag.Name) {
 		cfg.Percentile = ctx.GlobalInt(GpoPercentileFlag.Name)
 	}
+	if ctx.GlobalIsSet(GpoMaxGasPriceFlag.Name) {
+		cfg.MaxPrice = GlobalBig(ctx, GpoMaxGasPriceFlag.Name)
+	}
 }
 
 func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
+	if ctx.GlobalIsSet(TxPoolLocalsFlag.Name) {
+		for _, account := range strings.Split(ctx.GlobalString(TxPoolLocalsFlag.Name), ",") {
+			if trimmed := strings.TrimSpace(account); !common.IsHexAddress(trimmed) {
+				Fatalf("Invalid account in --txpool.locals: %s", trimmed)
+			} else {
+				cfg.Locals = append(cfg.Locals, common.HexToAddress(trimmed))
+			}
+		}
+	}
 	if ctx.GlobalIsSet(TxPoolNoLocalsFlag.Name) {
 		cfg.NoLocals = ctx.GlobalBool(TxPoolNoLocalsFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolJournalFlag.Name) {
+		cfg.Journal = ctx.GlobalString(TxPoolJournalFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolRejournalFlag.Name) {
+		cfg.Rejournal = ctx.GlobalDuration(TxPoolRejournalFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolRebroadcastFlag.Name) {
+		cfg.Rebroadcast = ctx.GlobalDuration(TxPoolRebroadcastFlag.Name)
+	}
 	if ctx.GlobalIsSet(TxPoolPriceLimitFlag.Name) {
 		cfg.PriceLimit = ctx.GlobalUint64(TxPoolPriceLimitFlag.Name)
 	}
@@ -910,7 +1212,10 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	checkExclusive(ctx, DevModeFlag, TestnetFlag, RinkebyFlag)
 	checkExclusive(ctx, FastSyncFlag, LightModeFlag, SyncModeFlag)
 
-	ks := stack.AccountManager().Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+	var ks *keystore.KeyStore
+	if keystores := stack.AccountManager().Backends(keystore.KeyStoreType); len(keystores) > 0 {
+		ks = keystores[0].(*keystore.KeyStore)
+	}
 	setEtherbase(ctx, ks, cfg)
 	setGPO(ctx, &cfg.GPO)
 	setTxPool(ctx, &cfg.TxPool)
@@ -924,12 +1229,29 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	case ctx.GlobalBool(LightModeFlag.Name):
 		cfg.SyncMode = downloader.LightSync
 	}
+	setCheckpoint(ctx, cfg)
+	setWhitelist(ctx, cfg)
+	if ctx.GlobalIsSet(PivotStaleFlag.Name) {
+		cfg.PivotStale = ctx.GlobalUint64(PivotStaleFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxLookupLimitFlag.Name) {
+		cfg.TxLookupLimit = ctx.GlobalUint64(TxLookupLimitFlag.Name)
+	}
 	if ctx.GlobalIsSet(LightServFlag.Name) {
 		cfg.LightServ = ctx.GlobalInt(LightServFlag.Name)
 	}
 	if ctx.GlobalIsSet(LightPeersFlag.Name) {
 		cfg.LightPeers = ctx.GlobalInt(LightPeersFlag.Name)
 	}
+	if ctx.GlobalIsSet(LightPriorityFlag.Name) {
+		cfg.LightPriority = strings.Split(ctx.GlobalString(LightPriorityFlag.Name), ",")
+	}
+	if ctx.GlobalIsSet(ULCServersFlag.Name) {
+		cfg.ULC = &eth.ULCConfig{
+			TrustedServers:     strings.Split(ctx.GlobalString(ULCServersFlag.Name), ","),
+			MinTrustedFraction: ctx.GlobalInt(ULCFractionFlag.Name),
+		}
+	}
 	if ctx.GlobalIsSet(NetworkIdFlag.Name) {
 		cfg.NetworkId = ctx.GlobalUint64(NetworkIdFlag.Name)
 	}
@@ -941,11 +1263,24 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	if ctx.GlobalIsSet(CacheFlag.Name) {
 		cfg.DatabaseCache = ctx.GlobalInt(CacheFlag.Name)
 	}
+	if ctx.GlobalIsSet(TrieCacheFlag.Name) {
+		cfg.TrieCache = ctx.GlobalInt(TrieCacheFlag.Name)
+	}
+	cfg.NoPruning = isArchive(ctx)
 	cfg.DatabaseHandles = makeDatabaseHandles()
+	if ctx.GlobalIsSet(AncientFlag.Name) {
+		cfg.DatabaseFreezer = ctx.GlobalString(AncientFlag.Name)
+	}
 
 	if ctx.GlobalIsSet(MinerThreadsFlag.Name) {
 		cfg.MinerThreads = ctx.GlobalInt(MinerThreadsFlag.Name)
 	}
+	if ctx.GlobalIsSet(MinerRecommitIntervalFlag.Name) {
+		cfg.MinerRecommit = ctx.GlobalDuration(MinerRecommitIntervalFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerNotifyFlag.Name) {
+		cfg.MinerNotify = strings.Split(ctx.GlobalString(MinerNotifyFlag.Name), ",")
+	}
 	if ctx.GlobalIsSet(DocRootFlag.Name) {
 		cfg.DocRoot = ctx.GlobalString(DocRootFlag.Name)
 	}
@@ -955,6 +1290,25 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	if ctx.GlobalIsSet(GasPriceFlag.Name) {
 		cfg.GasPrice = GlobalBig(ctx, GasPriceFlag.Name)
 	}
+	if ctx.GlobalIsSet(RPCGasCapFlag.Name) {
+		if gascap := ctx.GlobalUint64(RPCGasCapFlag.Name); gascap != 0 {
+			cfg.RPCGasCap = new(big.Int).SetUint64(gascap)
+		} else {
+			cfg.RPCGasCap = nil
+		}
+	}
+	if ctx.GlobalIsSet(RPCEVMTimeoutFlag.Name) {
+		cfg.RPCEVMTimeout = ctx.GlobalDuration(RPCEVMTimeoutFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCFilterTimeoutFlag.Name) {
+		cfg.FilterTimeout = ctx.GlobalDuration(RPCFilterTimeoutFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCLogsRangeLimitFlag.Name) {
+		cfg.LogsRangeLimit = ctx.GlobalUint64(RPCLogsRangeLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCLogsResultLimitFlag.Name) {
+		cfg.LogsResultLimit = ctx.GlobalInt(RPCLogsResultLimitFlag.Name)
+	}
 	if ctx.GlobalIsSet(VMEnableDebugFlag.Name) {
 		// TODO(fjl): force-enable this in --dev mode
 		cfg.EnablePreimageRecording = ctx.GlobalBool(VMEnableDebugFlag.Name)
@@ -973,11 +1327,34 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 		}
 		cfg.Genesis = core.DefaultRinkebyGenesisBlock()
 	case ctx.GlobalBool(DevModeFlag.Name):
-		cfg.Genesis = core.DevGenesisBlock()
+		// Create a new developer account or reuse the existing one
+		var (
+			developer  accounts.Account
+			passphrase string
+			err        error
+		)
+		if list := MakePasswordList(ctx); len(list) > 0 {
+			passphrase = list[0]
+		}
+		if accs := ks.Accounts(); len(accs) > 0 {
+			developer = accs[0]
+		} else {
+			if developer, err = ks.NewAccount(passphrase); err != nil {
+				Fatalf("Failed to create developer account: %v", err)
+			}
+		}
+		if err := ks.Unlock(developer, passphrase); err != nil {
+			Fatalf("Failed to unlock developer account: %v", err)
+		}
+		log.Info("Using developer account", "address", developer.Address)
+
+		cfg.Genesis = core.DeveloperGenesisBlock(uint64(ctx.GlobalInt(DevPeriodFlag.Name)), developer.Address)
+		if !ctx.GlobalIsSet(EtherbaseFlag.Name) {
+			cfg.Etherbase = developer.Address
+		}
 		if !ctx.GlobalIsSet(GasPriceFlag.Name) {
-			cfg.GasPrice = new(big.Int)
+			cfg.GasPrice = big.NewInt(1)
 		}
-		cfg.PowTest = true
 	}
 
 	// TODO(fjl): move trie cache generations into config
@@ -1017,6 +1394,25 @@ func RegisterShhService(stack *node.Node, cfg *whisper.Config) {
 	}
 }
 
+// RegisterGraphQLService configures the GraphQL query service and mounts it on
+// the HTTP endpoint of the given node.
+func RegisterGraphQLService(stack *node.Node) {
+	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		// Retrieve either the eth or the les service to query
+		var ethServ *eth.Ethereum
+		if err := ctx.Service(&ethServ); err == nil {
+			return graphql.New(ctx, ethServ.ApiBackend), nil
+		}
+		var lesServ *les.LightEthereum
+		if err := ctx.Service(&lesServ); err == nil {
+			return graphql.New(ctx, lesServ.ApiBackend), nil
+		}
+		return nil, errors.New("no Ethereum service to query")
+	}); err != nil {
+		Fatalf("Failed to register the GraphQL service: %v", err)
+	}
+}
+
 // RegisterEthStatsService configures the Ethereum Stats daemon and adds it to
 // th egiven node.
 func RegisterEthStatsService(stack *node.Node, url string) {
@@ -1046,11 +1442,15 @@ func MakeChainDatabase(ctx *cli.Context, stack *node.Node) ethdb.Database {
 		cache   = ctx.GlobalInt(CacheFlag.Name)
 		handles = makeDatabaseHandles()
 	)
-	name := "chaindata"
+	var (
+		chainDb ethdb.Database
+		err     error
+	)
 	if ctx.GlobalBool(LightModeFlag.Name) {
-		name = "lightchaindata"
+		chainDb, err = stack.OpenDatabase("lightchaindata", cache, handles)
+	} else {
+		chainDb, err = stack.OpenDatabaseWithFreezer("chaindata", cache, handles, ctx.GlobalString(AncientFlag.Name))
 	}
-	chainDb, err := stack.OpenDatabase(name, cache, handles)
 	if err != nil {
 		Fatalf("Could not open database: %v", err)
 	}
@@ -1065,7 +1465,7 @@ func MakeGenesis(ctx *cli.Context) *core.Genesis {
 	case ctx.GlobalBool(RinkebyFlag.Name):
 		genesis = core.DefaultRinkebyGenesisBlock()
 	case ctx.GlobalBool(DevModeFlag.Name):
-		genesis = core.DevGenesisBlock()
+		Fatalf("Developer chains are ephemeral")
 	}
 	return genesis
 }
@@ -1088,9 +1488,26 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chai
 	if err != nil {
 		Fatalf("Can't create BlockChain: %v", err)
 	}
+	if err := chain.SetArchive(isArchive(ctx)); err != nil {
+		Fatalf("Can't enable archive mode: %v", err)
+	}
 	return chain, chainDb
 }
 
+// isArchive retrieves whether the garbage collection mode requested on the
+// command line retains all historical states.
+func isArchive(ctx *cli.Context) bool {
+	switch gcmode := ctx.GlobalString(GCModeFlag.Name); gcmode {
+	case "full":
+		return false
+	case "archive":
+		return true
+	default:
+		Fatalf("--%s must be either 'full' or 'archive', got %q", GCModeFlag.Name, gcmode)
+		return false
+	}
+}
+
 // MakeConsolePreloads retrieves the absolute paths for the console JavaScript
 // scripts to preload before starting.
 func MakeConsolePreloads(ctx *cli.Context) []string {
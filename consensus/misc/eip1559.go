@@ -0,0 +1,111 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package misc
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	// ErrBaseFeeMissing is returned if a London header doesn't contain a base fee.
+	ErrBaseFeeMissing = errors.New("header is missing base fee")
+
+	// ErrBaseFeeUnexpected is returned if a pre-London header contains a base fee.
+	ErrBaseFeeUnexpected = errors.New("header has base fee before london fork")
+)
+
+// VerifyEip1559Header verifies some header attributes which were changed in EIP-1559:
+// the gas limit, which is now bounded relative to the elastic parent gas target,
+// and the base fee, which must match the one derived from the parent.
+func VerifyEip1559Header(config *params.ChainConfig, parent, header *types.Header) error {
+	// The gas limit of the fork block is checked against the doubled parent limit
+	parentGasLimit := parent.GasLimit
+	if !config.IsLondon(parent.Number) {
+		parentGasLimit = new(big.Int).Mul(parent.GasLimit, new(big.Int).SetUint64(params.ElasticityMultiplier))
+	}
+	if err := VerifyGaslimit(parentGasLimit, header.GasLimit); err != nil {
+		return err
+	}
+	// Verify the base fee is present and correct
+	if header.BaseFee == nil {
+		return ErrBaseFeeMissing
+	}
+	if expected := CalcBaseFee(config, parent); header.BaseFee.Cmp(expected) != 0 {
+		return fmt.Errorf("invalid baseFee: have %v, want %v, parentBaseFee %v, parentGasUsed %v",
+			header.BaseFee, expected, parent.BaseFee, parent.GasUsed)
+	}
+	return nil
+}
+
+// VerifyGaslimit verifies the header gas limit according to the allowed increase
+// or decrease relative to the parent gas limit.
+func VerifyGaslimit(parentGasLimit, headerGasLimit *big.Int) error {
+	if headerGasLimit.Cmp(math.MaxBig63) > 0 {
+		return fmt.Errorf("invalid gasLimit: have %v, max %v", headerGasLimit, math.MaxBig63)
+	}
+	diff := new(big.Int).Sub(parentGasLimit, headerGasLimit)
+	diff.Abs(diff)
+
+	limit := new(big.Int).Div(parentGasLimit, params.GasLimitBoundDivisor)
+	if diff.Cmp(limit) >= 0 || headerGasLimit.Cmp(params.MinGasLimit) < 0 {
+		return fmt.Errorf("invalid gas limit: have %v, want %v += %v", headerGasLimit, parentGasLimit, limit)
+	}
+	return nil
+}
+
+// CalcBaseFee calculates the base fee of the header following the given parent.
+func CalcBaseFee(config *params.ChainConfig, parent *types.Header) *big.Int {
+	// The first London block uses the initial base fee
+	if !config.IsLondon(parent.Number) {
+		return new(big.Int).SetUint64(params.InitialBaseFee)
+	}
+	var (
+		parentGasTarget = new(big.Int).Div(parent.GasLimit, new(big.Int).SetUint64(params.ElasticityMultiplier))
+		denominator     = new(big.Int).SetUint64(params.BaseFeeChangeDenominator)
+	)
+	switch parent.GasUsed.Cmp(parentGasTarget) {
+	case 0:
+		// Parent used exactly its target, the base fee remains the same
+		return new(big.Int).Set(parent.BaseFee)
+
+	case 1:
+		// Parent used more than its target, the base fee increases by at least 1
+		delta := new(big.Int).Sub(parent.GasUsed, parentGasTarget)
+		delta.Mul(delta, parent.BaseFee)
+		delta.Div(delta, parentGasTarget)
+		delta.Div(delta, denominator)
+		delta = math.BigMax(delta, common.Big1)
+
+		return delta.Add(delta, parent.BaseFee)
+
+	default:
+		// Parent used less than its target, the base fee decreases (but not below zero)
+		delta := new(big.Int).Sub(parentGasTarget, parent.GasUsed)
+		delta.Mul(delta, parent.BaseFee)
+		delta.Div(delta, parentGasTarget)
+		delta.Div(delta, denominator)
+
+		return math.BigMax(delta.Sub(parent.BaseFee, delta), common.Big0)
+	}
+}
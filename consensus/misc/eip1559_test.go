@@ -0,0 +1,88 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package misc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+const initialBaseFee = int64(params.InitialBaseFee)
+
+// londonConfig returns a chain config with London activated at block 5.
+func londonConfig() *params.ChainConfig {
+	config := *params.TestChainConfig
+	config.LondonBlock = big.NewInt(5)
+	return &config
+}
+
+// Tests that the base fee is adjusted according to the gas used by the parent.
+func TestCalcBaseFee(t *testing.T) {
+	tests := []struct {
+		parentBaseFee int64
+		parentGasUsed int64
+		expected      int64
+	}{
+		{initialBaseFee, 10000000, initialBaseFee}, // usage == target
+		{initialBaseFee, 9000000, 987500000},       // usage below target
+		{initialBaseFee, 11000000, 1012500000},     // usage above target
+		{1, 20000000, 2},                           // increase by at least one
+		{initialBaseFee, 0, 875000000},             // empty block
+	}
+	for i, test := range tests {
+		parent := &types.Header{
+			Number:   big.NewInt(10),
+			GasLimit: big.NewInt(20000000),
+			GasUsed:  big.NewInt(test.parentGasUsed),
+			BaseFee:  big.NewInt(test.parentBaseFee),
+		}
+		if have, want := CalcBaseFee(londonConfig(), parent), big.NewInt(test.expected); have.Cmp(want) != 0 {
+			t.Errorf("test %d: base fee mismatch: have %v, want %v", i, have, want)
+		}
+	}
+}
+
+// Tests the header verification rules around the fork block.
+func TestVerifyEip1559Header(t *testing.T) {
+	config := londonConfig()
+
+	// The fork block may double the parent gas limit and uses the initial base fee
+	parent := &types.Header{Number: big.NewInt(4), GasLimit: big.NewInt(10000000), GasUsed: big.NewInt(5000000)}
+	header := &types.Header{Number: big.NewInt(5), GasLimit: big.NewInt(20000000), BaseFee: big.NewInt(initialBaseFee)}
+	if err := VerifyEip1559Header(config, parent, header); err != nil {
+		t.Errorf("fork block rejected: %v", err)
+	}
+	// A missing or wrong base fee must be rejected
+	header.BaseFee = nil
+	if err := VerifyEip1559Header(config, parent, header); err != ErrBaseFeeMissing {
+		t.Errorf("missing base fee error mismatch: have %v, want %v", err, ErrBaseFeeMissing)
+	}
+	header.BaseFee = big.NewInt(initialBaseFee + 1)
+	if err := VerifyEip1559Header(config, parent, header); err == nil {
+		t.Errorf("invalid base fee accepted")
+	}
+	// After the fork the gas limit may not jump anymore
+	parent, header = header, &types.Header{Number: big.NewInt(6), GasLimit: big.NewInt(40000000)}
+	parent.BaseFee, parent.GasUsed = big.NewInt(initialBaseFee), big.NewInt(10000000)
+	header.BaseFee = CalcBaseFee(config, parent)
+	if err := VerifyEip1559Header(config, parent, header); err == nil {
+		t.Errorf("gas limit jump accepted after the fork")
+	}
+}
@@ -32,6 +32,8 @@ import (
 	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/pruner"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -43,6 +45,7 @@ import (
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/trie"
 	"github.com/hashicorp/golang-lru"
+	"gopkg.in/karalabe/cookiejar.v2/collections/prque"
 )
 
 var (
@@ -57,6 +60,12 @@ const (
 	maxFutureBlocks     = 256
 	maxTimeFutureBlocks = 30
 	badBlockLimit       = 10
+	snapshotLayers      = 128 // Number of recent block states kept in memory by the state snapshot
+	triesInMemory       = 128 // Number of recent block states kept in memory by the trie node database
+
+	// trieTimeLimit is the block processing time after which the oldest state kept
+	// in memory is flushed to disk, bounding the work lost on a crash.
+	trieTimeLimit = 5 * time.Minute
 
 	// BlockChainVersion ensures that an incompatible database forces a resync from scratch.
 	BlockChainVersion = 3
@@ -92,11 +101,17 @@ type BlockChain struct {
 	currentBlock     *types.Block // Current head of the block chain
 	currentFastBlock *types.Block // Current head of the fast-sync chain (may be above the block chain!)
 
-	stateCache   state.Database // State database to reuse between imports (contains state cache)
-	bodyCache    *lru.Cache     // Cache for the most recent block bodies
-	bodyRLPCache *lru.Cache     // Cache for the most recent block bodies in RLP encoded format
-	blockCache   *lru.Cache     // Cache for the most recent entire blocks
-	futureBlocks *lru.Cache     // future blocks are blocks added for later processing
+	stateCache   state.Database     // State database to reuse between imports (contains state cache)
+	triedb       *trie.NodeDatabase // Trie node cache backing the state database, garbage collected on import
+	triegc       *prque.Prque       // Priority queue mapping block numbers to the state roots to release
+	gcproc       time.Duration      // Block processing time accumulated since the last state flush
+	trieCache    common.StorageSize // Memory allowance of the cached states, zero for unlimited
+	archive      bool               // Whether to write every state to disk instead of garbage collecting them
+	snaps        *snapshot.Tree     // Flat snapshot of the recent states, nil if unavailable
+	bodyCache    *lru.Cache         // Cache for the most recent block bodies
+	bodyRLPCache *lru.Cache         // Cache for the most recent block bodies in RLP encoded format
+	blockCache   *lru.Cache         // Cache for the most recent entire blocks
+	futureBlocks *lru.Cache         // future blocks are blocks added for later processing
 
 	quit    chan struct{} // blockchain quit channel
 	running int32         // running must be called atomically
@@ -110,22 +125,35 @@ type BlockChain struct {
 	vmConfig  vm.Config
 
 	badBlocks *lru.Cache // Bad block cache
+
+	txLookupLimit uint64        // Number of recent blocks to index transactions for (0 = all), atomically accessed
+	txIndexOnce   sync.Once     // Ensures the transaction indexer is started only once
+	txIndexUpdate chan struct{} // Notification channel to recheck the transaction index
+
+	freezeLock sync.Mutex // Lock serializing ancient block freezing with chain rewinds
 }
 
 // NewBlockChain returns a fully initialised block chain using information
 // available in the database. It initialises the default Ethereum Validator and
 // Processor.
 func NewBlockChain(chainDb ethdb.Database, config *params.ChainConfig, engine consensus.Engine, mux *event.TypeMux, vmConfig vm.Config) (*BlockChain, error) {
+	if err := vm.CheckPrecompiles(config); err != nil {
+		return nil, err
+	}
 	bodyCache, _ := lru.New(bodyCacheLimit)
 	bodyRLPCache, _ := lru.New(bodyCacheLimit)
 	blockCache, _ := lru.New(blockCacheLimit)
 	futureBlocks, _ := lru.New(maxFutureBlocks)
 	badBlocks, _ := lru.New(badBlockLimit)
 
+	triedb := state.NewTrieDB(chainDb)
+
 	bc := &BlockChain{
 		config:       config,
 		chainDb:      chainDb,
-		stateCache:   state.NewDatabase(chainDb),
+		stateCache:   state.NewDatabaseWithTrieDB(triedb),
+		triedb:       triedb,
+		triegc:       prque.New(),
 		eventMux:     mux,
 		quit:         make(chan struct{}),
 		bodyCache:    bodyCache,
@@ -151,6 +179,11 @@ func NewBlockChain(chainDb ethdb.Database, config *params.ChainConfig, engine co
 	if err := bc.loadLastState(); err != nil {
 		return nil, err
 	}
+	bc.loadTrieRoots()
+	// Drop any frozen blocks above the head, e.g. if the key-value store was rewound
+	if err := bc.truncateAncients(bc.hc.CurrentHeader().Number.Uint64()); err != nil {
+		return nil, err
+	}
 	// Check the current state of the block hashes and make sure that we do not have any of the bad blocks in our chain
 	for hash := range BadHashes {
 		if header := bc.GetHeaderByHash(hash); header != nil {
@@ -164,6 +197,19 @@ func NewBlockChain(chainDb ethdb.Database, config *params.ChainConfig, engine co
 			}
 		}
 	}
+	// Load or start generating the flat state snapshot, which reads the head state
+	// straight from disk
+	if err := bc.triedb.Commit(bc.currentBlock.Root()); err != nil {
+		return nil, err
+	}
+	if bc.snaps, err = snapshot.New(chainDb, bc.currentBlock.Root()); err != nil {
+		log.Warn("State snapshot unavailable", "err", err)
+	}
+	// Start moving immutable blocks into the ancient store, if one is attached
+	if store := ancientStore(chainDb); store != nil {
+		bc.wg.Add(1)
+		go bc.freeze(store)
+	}
 	// Take ownership of this particular state
 	go bc.update()
 	return bc, nil
@@ -192,9 +238,11 @@ func (bc *BlockChain) loadLastState() error {
 	}
 	// Make sure the state associated with the block is available
 	if _, err := state.New(currentBlock.Root(), bc.stateCache); err != nil {
-		// Dangling block without a state associated, init from scratch
-		log.Warn("Head state missing, resetting chain", "number", currentBlock.Number(), "hash", currentBlock.Hash())
-		return bc.Reset()
+		// Dangling block without a state associated, roll back to the last flushed one
+		log.Warn("Head state missing, repairing chain", "number", currentBlock.Number(), "hash", currentBlock.Hash())
+		if err := bc.repair(&currentBlock); err != nil {
+			return err
+		}
 	}
 	// Everything seems to be fine, set as the head block
 	bc.currentBlock = currentBlock
@@ -228,6 +276,55 @@ func (bc *BlockChain) loadLastState() error {
 	return nil
 }
 
+// repair tries to repair the current blockchain by rolling back the current block
+// until one with associated state is found. This is needed to fix incomplete
+// database writes caused either by crashes or by the recent states only being
+// kept in memory. This method only rolls back the current block, the current
+// header and fast block are left intact.
+func (bc *BlockChain) repair(head **types.Block) error {
+	for {
+		// Abort if we've rewound to a head block that does have associated state
+		if _, err := state.New((*head).Root(), bc.stateCache); err == nil {
+			log.Info("Rewound blockchain to past state", "number", (*head).Number(), "hash", (*head).Hash())
+			return nil
+		}
+		// Otherwise rewind one block and recheck state availability there
+		if (*head).NumberU64() == 0 {
+			return fmt.Errorf("missing genesis state %x", (*head).Root())
+		}
+		block := bc.GetBlock((*head).ParentHash(), (*head).NumberU64()-1)
+		if block == nil {
+			return fmt.Errorf("missing block %d [%x]", (*head).NumberU64()-1, (*head).ParentHash())
+		}
+		*head = block
+	}
+}
+
+// loadTrieRoots schedules the states restored from the trie node journal of an
+// earlier run for garbage collection. The recent canonical ones are released as
+// the chain progresses, while any others (e.g. side chains) are dropped at once.
+func (bc *BlockChain) loadTrieRoots() {
+	roots := make(map[common.Hash]struct{})
+	for _, root := range bc.triedb.Roots() {
+		roots[root] = struct{}{}
+	}
+	for block := bc.currentBlock; len(roots) > 0; {
+		if _, ok := roots[block.Root()]; ok {
+			bc.triegc.Push(block.Root(), -float32(block.NumberU64()))
+			delete(roots, block.Root())
+		}
+		if block.NumberU64() == 0 || bc.currentBlock.NumberU64()-block.NumberU64() >= triesInMemory {
+			break
+		}
+		if block = bc.GetBlock(block.ParentHash(), block.NumberU64()-1); block == nil {
+			break
+		}
+	}
+	for root := range roots {
+		bc.triedb.Dereference(root)
+	}
+}
+
 // SetHead rewinds the local chain to a new head. In the case of headers, everything
 // above the new head will be deleted and the new one set. In the case of blocks
 // though, the head may be further rewound if block bodies are missing (non-archive
@@ -238,6 +335,9 @@ func (bc *BlockChain) SetHead(head uint64) error {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
+	bc.freezeLock.Lock()
+	defer bc.freezeLock.Unlock()
+
 	// Rewind the header chain, deleting all block bodies until then
 	delFn := func(hash common.Hash, num uint64) {
 		DeleteBody(bc.chainDb, hash, num)
@@ -245,6 +345,11 @@ func (bc *BlockChain) SetHead(head uint64) error {
 	bc.hc.SetHead(head, delFn)
 	currentHeader := bc.hc.CurrentHeader()
 
+	// Drop any blocks above the new head from the ancient store too
+	if err := bc.truncateAncients(currentHeader.Number.Uint64()); err != nil {
+		log.Crit("Failed to truncate ancient chain", "err", err)
+	}
+
 	// Clear out any stale content from the caches
 	bc.bodyCache.Purge()
 	bc.bodyRLPCache.Purge()
@@ -257,8 +362,11 @@ func (bc *BlockChain) SetHead(head uint64) error {
 	}
 	if bc.currentBlock != nil {
 		if _, err := state.New(bc.currentBlock.Root(), bc.stateCache); err != nil {
-			// Rewound state missing, rolled back to before pivot, reset to genesis
-			bc.currentBlock = nil
+			// Rewound state missing, roll back to the last flushed one, or reset to
+			// genesis if rolled back to before the fast sync pivot
+			if err := bc.repair(&bc.currentBlock); err != nil {
+				bc.currentBlock = nil
+			}
 		}
 	}
 	// Rewind the fast block in a simpleton way to the target head
@@ -278,6 +386,7 @@ func (bc *BlockChain) SetHead(head uint64) error {
 	if err := WriteHeadFastBlockHash(bc.chainDb, bc.currentFastBlock.Hash()); err != nil {
 		log.Crit("Failed to reset head fast block", "err", err)
 	}
+	bc.ensureSnapshot(bc.currentBlock.Root())
 	return bc.loadLastState()
 }
 
@@ -297,6 +406,8 @@ func (bc *BlockChain) FastSyncCommitHead(hash common.Hash) error {
 	bc.currentBlock = block
 	bc.mu.Unlock()
 
+	bc.ensureSnapshot(block.Root())
+
 	log.Info("Committed new head block", "number", block.Number(), "hash", hash)
 	return nil
 }
@@ -377,9 +488,98 @@ func (bc *BlockChain) State() (*state.StateDB, error) {
 	return bc.StateAt(bc.CurrentBlock().Root())
 }
 
+// Snapshots returns the flat state snapshot of the recent states, or nil if
+// it's unavailable.
+func (bc *BlockChain) Snapshots() *snapshot.Tree {
+	return bc.snaps
+}
+
+// TrieDB retrieves the trie node database caching the recent states in memory.
+// Tries of these states must be read through it, as their nodes are not yet
+// flushed to disk.
+func (bc *BlockChain) TrieDB() *trie.NodeDatabase {
+	return bc.triedb
+}
+
+// SetTrieCache sets the memory allowance of the recent states cached by the trie
+// node database. Whenever an import grows them beyond it, the oldest trie nodes
+// are flushed to disk. A zero limit keeps all the states of the retained window
+// in memory.
+func (bc *BlockChain) SetTrieCache(limit common.StorageSize) {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+
+	bc.trieCache = limit
+}
+
+// SetArchive toggles the archive mode of the chain. An archive chain writes the
+// state of every imported block straight to disk, retaining all historical
+// states, instead of caching the recent ones in memory and releasing the older
+// ones. Enabling it flushes all the currently cached states to disk.
+func (bc *BlockChain) SetArchive(archive bool) error {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+
+	bc.archive = archive
+	if !archive {
+		return nil
+	}
+	for _, root := range bc.triedb.Roots() {
+		if err := bc.triedb.Commit(root); err != nil {
+			return err
+		}
+		bc.triedb.Dereference(root)
+	}
+	bc.triegc.Reset()
+	bc.gcproc = 0
+	return nil
+}
+
 // StateAt returns a new mutable state based on a particular point in time.
 func (bc *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
-	return state.New(root, bc.stateCache)
+	return state.NewWithSnapshots(root, bc.stateCache, bc.snaps)
+}
+
+// PruneState deletes all the trie nodes and contract codes from the database
+// that are not reachable from the states of the last retain canonical blocks
+// or from any of the additional trie roots given. States already missing from
+// the database (e.g. blocks imported by fast sync) are skipped. The states of
+// the head and genesis blocks are always retained.
+//
+// The chain insertion lock is held throughout the pruning, but state written by
+// other components (e.g. the miner or the state downloader) is not protected,
+// so those need to be stopped by the caller.
+func (bc *BlockChain) PruneState(retain uint64, tries []common.Hash) (int, common.StorageSize, error) {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+
+	p, err := pruner.NewPrunerWithTrieDB(bc.triedb)
+	if err != nil {
+		return 0, 0, err
+	}
+	if retain == 0 {
+		retain = 1
+	}
+	head := bc.CurrentBlock().NumberU64()
+	for i := uint64(0); i < retain && i <= head; i++ {
+		block := bc.GetBlockByNumber(head - i)
+		if block == nil || !bc.HasBlockAndState(block.Hash()) {
+			continue
+		}
+		if err := p.RetainState(block.Root()); err != nil {
+			return 0, 0, err
+		}
+	}
+	// The genesis state is needed to reinitialise the chain on a reset
+	if err := p.RetainState(bc.genesisBlock.Root()); err != nil {
+		return 0, 0, err
+	}
+	for _, root := range tries {
+		if err := p.RetainTrie(root); err != nil {
+			return 0, 0, err
+		}
+	}
+	return p.Prune()
 }
 
 // Reset purges the entire blockchain, restoring it to its genesis state.
@@ -411,9 +611,24 @@ func (bc *BlockChain) ResetWithGenesisBlock(genesis *types.Block) error {
 	bc.hc.SetCurrentHeader(bc.genesisBlock.Header())
 	bc.currentFastBlock = bc.genesisBlock
 
+	bc.ensureSnapshot(bc.genesisBlock.Root())
 	return nil
 }
 
+// ensureSnapshot makes sure the state snapshot covers the given state root,
+// regenerating it if not. It's needed whenever the head state is replaced by
+// one not imported through the block chain (e.g. rewinds, fast sync).
+func (bc *BlockChain) ensureSnapshot(root common.Hash) {
+	if bc.snaps != nil && bc.snaps.Snapshot(root) == nil {
+		// The snapshot is generated from disk, flush the state out of memory first
+		if err := bc.triedb.Commit(root); err != nil {
+			log.Error("Failed to flush state for snapshot", "root", root, "err", err)
+			return
+		}
+		bc.snaps.Rebuild(root)
+	}
+}
+
 // Export writes the active chain to the given writer.
 func (bc *BlockChain) Export(w io.Writer) error {
 	return bc.ExportN(w, uint64(0), bc.currentBlock.NumberU64())
@@ -598,6 +813,22 @@ func (bc *BlockChain) Stop() {
 	atomic.StoreInt32(&bc.procInterrupt, 1)
 
 	bc.wg.Wait()
+
+	// Flush the head state out of memory and journal the older cached states,
+	// so they're restored on the next startup
+	if err := bc.triedb.Commit(bc.CurrentBlock().Root()); err != nil {
+		log.Error("Failed to commit head state", "err", err)
+	}
+	if err := bc.triedb.Journal(); err != nil {
+		log.Error("Failed to journal trie node cache", "err", err)
+	}
+	// Persist the recent snapshot layers, so the snapshot can be reused on restart
+	if bc.snaps != nil {
+		if err := bc.snaps.Cap(bc.CurrentBlock().Root(), 0); err != nil {
+			log.Warn("Failed to persist state snapshot", "err", err)
+		}
+		bc.snaps.Release()
+	}
 	log.Info("Blockchain manager stopped")
 }
 
@@ -753,12 +984,6 @@ func (bc *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain [
 				log.Crit("Failed to write block receipts", "err", err)
 				return
 			}
-			if err := WriteMipmapBloom(bc.chainDb, block.NumberU64(), receipts); err != nil {
-				errs[index] = fmt.Errorf("failed to write log blooms: %v", err)
-				atomic.AddInt32(&failed, 1)
-				log.Crit("Failed to write log blooms", "err", err)
-				return
-			}
 			if err := WriteTxLookupEntries(bc.chainDb, block); err != nil {
 				errs[index] = fmt.Errorf("failed to write lookup metadata: %v", err)
 				atomic.AddInt32(&failed, 1)
@@ -954,26 +1179,59 @@ func (bc *BlockChain) InsertChain(chain types.Blocks) (int, error) {
 		} else {
 			parent = chain[i-1]
 		}
-		state, err := state.New(parent.Root(), bc.stateCache)
+		state, err := state.NewWithSnapshots(parent.Root(), bc.stateCache, bc.snaps)
 		if err != nil {
 			return i, err
 		}
+		// Load the touched trie nodes in the background while processing
+		state.StartPrefetcher()
+
 		// Process block using the parent state as reference point.
 		receipts, logs, usedGas, err := bc.processor.Process(block, state, bc.vmConfig)
 		if err != nil {
+			state.StopPrefetcher()
 			bc.reportBlock(block, receipts, err)
 			return i, err
 		}
 		// Validate the state using the default validator
 		err = bc.Validator().ValidateState(block, parent, state, receipts, usedGas)
 		if err != nil {
+			state.StopPrefetcher()
 			bc.reportBlock(block, receipts, err)
 			return i, err
 		}
-		// Write state changes to database
-		if _, err = state.CommitTo(bc.chainDb, bc.config.IsEIP158(block.Number())); err != nil {
+		// Write state changes into the trie cache and release the stale states
+		root, err := state.CommitTo(bc.triedb, bc.config.IsEIP158(block.Number()))
+		state.StopPrefetcher()
+		if err != nil {
 			return i, err
 		}
+		if bc.archive {
+			// Archive nodes retain every state, write it out straight away
+			if err := bc.triedb.Commit(root); err != nil {
+				return i, err
+			}
+		} else {
+			bc.triedb.Reference(root, common.Hash{})
+			bc.triegc.Push(root, -float32(block.NumberU64()))
+
+			bc.gcproc += time.Since(bstart)
+			if err := bc.gcStates(block.NumberU64()); err != nil {
+				return i, err
+			}
+			// Flush the oldest trie nodes if the live states outgrew their allowance
+			if bc.trieCache > 0 && bc.triedb.Size() > bc.trieCache {
+				if err := bc.triedb.Cap(bc.trieCache); err != nil {
+					return i, err
+				}
+			}
+		}
+		// Flatten the old snapshot layers into the persistent one
+		if bc.snaps != nil {
+			if err := bc.snaps.Cap(block.Root(), snapshotLayers); err != nil {
+				log.Debug("Failed to cap state snapshot", "root", block.Root(), "err", err)
+			}
+		}
 
 		// coalesce logs for later processing
 		coalescedLogs = append(coalescedLogs, logs...)
@@ -1000,10 +1258,6 @@ func (bc *BlockChain) InsertChain(chain types.Blocks) (int, error) {
 			if err := WriteTxLookupEntries(bc.chainDb, block); err != nil {
 				return i, err
 			}
-			// Write map map bloom filters
-			if err := WriteMipmapBloom(bc.chainDb, block.NumberU64(), receipts); err != nil {
-				return i, err
-			}
 			// Write hash preimages
 			if err := WritePreimages(bc.chainDb, block.NumberU64(), state.Preimages()); err != nil {
 				return i, err
@@ -1024,6 +1278,37 @@ func (bc *BlockChain) InsertChain(chain types.Blocks) (int, error) {
 	return 0, nil
 }
 
+// gcStates releases the cached states of all the blocks at least triesInMemory
+// blocks below the given one. If enough block processing time accumulated since
+// the last flush, the canonical state at the edge of the window is written to
+// disk before, bounding the number of blocks to reprocess after a crash.
+func (bc *BlockChain) gcStates(number uint64) error {
+	if number < triesInMemory {
+		return nil
+	}
+	chosen := number - triesInMemory
+
+	if bc.gcproc > trieTimeLimit {
+		if header := bc.GetHeaderByNumber(chosen); header == nil {
+			log.Warn("Reorg in progress, trie commit postponed", "number", chosen)
+		} else {
+			if err := bc.triedb.Commit(header.Root); err != nil {
+				return err
+			}
+			bc.gcproc = 0
+		}
+	}
+	for !bc.triegc.Empty() {
+		root, number := bc.triegc.Pop()
+		if uint64(-number) > chosen {
+			bc.triegc.Push(root, number)
+			break
+		}
+		bc.triedb.Dereference(root.(common.Hash))
+	}
+	return nil
+}
+
 // insertStats tracks and reports on block insertion.
 type insertStats struct {
 	queued, processed, ignored int
@@ -1161,11 +1446,6 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 		if err := WriteTxLookupEntries(bc.chainDb, block); err != nil {
 			return err
 		}
-		// Write map map bloom filters
-		receipts := GetBlockReceipts(bc.chainDb, block.Hash(), block.NumberU64())
-		if err := WriteMipmapBloom(bc.chainDb, block.NumberU64(), receipts); err != nil {
-			return err
-		}
 		addedTxs = append(addedTxs, block.Transactions()...)
 	}
 
@@ -1303,6 +1583,43 @@ func (bc *BlockChain) InsertHeaderChain(chain []*types.Header, checkFreq int) (i
 	return bc.hc.InsertHeaderChain(chain, whFunc, start)
 }
 
+// InsertTrustedHeaders writes a batch of unverified headers, ordered from a
+// trusted block towards the genesis, into the database. The total difficulty of
+// the first header is needed to derive the ones of its ancestors.
+//
+// The returned number of headers written is less than the length of the batch
+// if and only if the trusted chain got linked to the canonical one.
+func (bc *BlockChain) InsertTrustedHeaders(chain []*types.Header, td *big.Int) (int, error) {
+	// Make sure only one thread manipulates the chain at once
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+
+	bc.wg.Add(1)
+	defer bc.wg.Done()
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	return bc.hc.InsertTrustedHeaders(chain, td)
+}
+
+// SetTrustedHead makes the header of a trusted block, along with all of its
+// ancestors inserted via InsertTrustedHeaders, the head of the canonical chain.
+func (bc *BlockChain) SetTrustedHead(hash common.Hash) error {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	head := bc.hc.GetHeaderByHash(hash)
+	if head == nil {
+		return fmt.Errorf("non existent header [%x…]", hash[:4])
+	}
+	bc.hc.SetTrustedHead(head)
+	return nil
+}
+
 // writeHeader writes a header into the local chain, given that its parent is
 // already known. If the total difficulty of the newly inserted header becomes
 // greater than the current known TD, the canonical chain is re-routed.
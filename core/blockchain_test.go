@@ -32,6 +32,7 @@ import (
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trie"
 )
 
 // newTestBlockChain creates a blockchain without validation.
@@ -1151,3 +1152,270 @@ func TestEIP161AccountRemoval(t *testing.T) {
 		t.Error("account should not exist")
 	}
 }
+
+// Tests that headers inserted backwards from a trusted block are linked into
+// the canonical chain, and that invalid trusted difficulties are detected.
+func TestTrustedHeaderInsertion(t *testing.T) {
+	db, blockchain, err := newCanonical(0, false)
+	if err != nil {
+		t.Fatalf("failed to create pristine chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	headers := makeHeaderChain(blockchain.CurrentHeader(), 100, db, canonicalSeed)
+	if _, err := blockchain.InsertHeaderChain(headers[:10], 1); err != nil {
+		t.Fatalf("failed to insert header chain: %v", err)
+	}
+	td := new(big.Int).Set(blockchain.GetTdByHash(headers[9].Hash()))
+	for _, header := range headers[10:] {
+		td.Add(td, header.Difficulty)
+	}
+	// Insert the rest of the chain backwards, with an invalid difficulty first
+	trusted := make([]*types.Header, 0, 91)
+	for i := len(headers) - 1; i >= 9; i-- {
+		trusted = append(trusted, headers[i])
+	}
+	if _, err := blockchain.InsertTrustedHeaders(trusted, new(big.Int).Add(td, common.Big1)); err == nil {
+		t.Fatalf("trusted headers with invalid difficulty inserted")
+	}
+	for i, batch := 0, 30; i < len(trusted); i += batch {
+		end := i + batch
+		if end > len(trusted) {
+			end = len(trusted)
+		}
+		n, err := blockchain.InsertTrustedHeaders(trusted[i:end], td)
+		if err != nil {
+			t.Fatalf("failed to insert trusted headers: %v", err)
+		}
+		if linked := n < end-i; linked != (end == len(trusted)) {
+			t.Fatalf("batch %d link status mismatch: have %v", i/batch, linked)
+		}
+		for _, header := range trusted[i : i+n] {
+			td.Sub(td, header.Difficulty)
+		}
+	}
+	if err := blockchain.SetTrustedHead(headers[99].Hash()); err != nil {
+		t.Fatalf("failed to set trusted head: %v", err)
+	}
+	if head := blockchain.CurrentHeader().Hash(); head != headers[99].Hash() {
+		t.Fatalf("head header mismatch: have %x, want %x", head, headers[99].Hash())
+	}
+	for _, header := range headers {
+		if have := blockchain.GetHeaderByNumber(header.Number.Uint64()); have == nil || have.Hash() != header.Hash() {
+			t.Fatalf("canonical header #%d mismatch", header.Number)
+		}
+	}
+}
+
+var (
+	transferKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	transferAddress = crypto.PubkeyToAddress(transferKey.PublicKey)
+)
+
+// makeTransferChain creates a genesis funding a single account and a chain of
+// blocks on top, each transferring from it to a different recipient.
+func makeTransferChain(t *testing.T, n int) (*Genesis, []*types.Block) {
+	var (
+		db, _   = ethdb.NewMemDatabase()
+		gspec   = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{transferAddress: {Balance: big.NewInt(1000000000)}}}
+		genesis = gspec.MustCommit(db)
+		signer  = types.NewEIP155Signer(gspec.Config.ChainId)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, db, n, func(i int, block *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(transferAddress), common.Address{byte(i), byte(i >> 8)}, big.NewInt(1), big.NewInt(21000), new(big.Int), nil), signer, transferKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block.AddTx(tx)
+	})
+	return gspec, blocks
+}
+
+// Tests that the states of the recent blocks are kept in memory only, releasing
+// the ones falling out of the retained window, and that the head state is
+// flushed to disk when the chain is stopped.
+func TestTrieGarbageCollection(t *testing.T) {
+	gspec, blocks := makeTransferChain(t, triesInMemory+8)
+
+	db, _ := ethdb.NewMemDatabase()
+	gspec.MustCommit(db)
+
+	blockchain, _ := NewBlockChain(db, gspec.Config, ethash.NewFaker(), new(event.TypeMux), vm.Config{})
+	if n, err := blockchain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	for i, block := range blocks {
+		if have, want := blockchain.HasBlockAndState(block.Hash()), i >= len(blocks)-triesInMemory; have != want {
+			t.Errorf("block #%d: state availability mismatch: have %v, want %v", block.Number(), have, want)
+		}
+		if _, err := trie.New(block.Root(), db); err == nil {
+			t.Errorf("block #%d: state flushed to disk", block.Number())
+		}
+	}
+	blockchain.Stop()
+
+	head := blocks[len(blocks)-1]
+	statedb, err := state.New(head.Root(), state.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("head state not flushed: %v", err)
+	}
+	if nonce := statedb.GetNonce(transferAddress); nonce != uint64(len(blocks)) {
+		t.Errorf("head state nonce mismatch: have %d, want %d", nonce, len(blocks))
+	}
+}
+
+// Tests that the cached states are capped to the configured memory allowance
+// during import, flushing the oldest trie nodes to disk.
+func TestTrieCacheCap(t *testing.T) {
+	gspec, blocks := makeTransferChain(t, 32)
+
+	db, _ := ethdb.NewMemDatabase()
+	gspec.MustCommit(db)
+
+	blockchain, _ := NewBlockChain(db, gspec.Config, ethash.NewFaker(), new(event.TypeMux), vm.Config{})
+	defer blockchain.Stop()
+
+	blockchain.SetTrieCache(4096)
+	if n, err := blockchain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	if size := blockchain.TrieDB().Size(); size > 4096 {
+		t.Errorf("trie cache above allowance: have %v, want at most %v", size, common.StorageSize(4096))
+	}
+	// The flushed states must be complete on disk, the rest reachable from memory
+	flushed := 0
+	for _, block := range blocks {
+		if !blockchain.HasBlockAndState(block.Hash()) {
+			t.Errorf("block #%d: state missing", block.Number())
+		}
+		if _, err := trie.New(block.Root(), db); err == nil {
+			flushed++
+		}
+	}
+	if flushed == 0 {
+		t.Errorf("no states flushed to disk")
+	}
+}
+
+// Tests that the states cached in memory are journaled when the chain is
+// stopped and restored on restart, still being released once they fall out
+// of the retained window.
+func TestTrieJournalRestart(t *testing.T) {
+	gspec, blocks := makeTransferChain(t, triesInMemory+16)
+
+	db, _ := ethdb.NewMemDatabase()
+	gspec.MustCommit(db)
+
+	blockchain, _ := NewBlockChain(db, gspec.Config, ethash.NewFaker(), new(event.TypeMux), vm.Config{})
+	if n, err := blockchain.InsertChain(blocks[:16]); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	blockchain.Stop()
+
+	// Restart the chain and ensure the dirty states were restored
+	blockchain, _ = NewBlockChain(db, gspec.Config, ethash.NewFaker(), new(event.TypeMux), vm.Config{})
+	defer blockchain.Stop()
+
+	if len(blockchain.TrieDB().Nodes()) == 0 {
+		t.Fatalf("no trie nodes restored from the journal")
+	}
+	for _, block := range blocks[:16] {
+		if !blockchain.HasBlockAndState(block.Hash()) {
+			t.Errorf("block #%d: state missing after restart", block.Number())
+		}
+	}
+	for _, block := range blocks[:15] {
+		if _, err := trie.New(block.Root(), db); err == nil {
+			t.Errorf("block #%d: state flushed to disk", block.Number())
+		}
+	}
+	// Import the rest of the chain and ensure the restored states were released
+	if n, err := blockchain.InsertChain(blocks[16:]); err != nil {
+		t.Fatalf("failed to insert block %d: %v", 16+n, err)
+	}
+	for _, block := range blocks[:15] {
+		if blockchain.HasBlockAndState(block.Hash()) {
+			t.Errorf("block #%d: restored state not released", block.Number())
+		}
+	}
+}
+
+// Tests that an archive chain writes the state of every block to disk, including
+// the ones journaled by an earlier non-archive run, and that all of them survive
+// restarts.
+func TestArchiveRestart(t *testing.T) {
+	gspec, blocks := makeTransferChain(t, triesInMemory+16)
+
+	db, _ := ethdb.NewMemDatabase()
+	gspec.MustCommit(db)
+
+	// Import a few blocks in full mode, journaling their states on stop
+	blockchain, _ := NewBlockChain(db, gspec.Config, ethash.NewFaker(), new(event.TypeMux), vm.Config{})
+	if n, err := blockchain.InsertChain(blocks[:16]); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	blockchain.Stop()
+
+	// Restart in archive mode and import the rest of the chain
+	blockchain, _ = NewBlockChain(db, gspec.Config, ethash.NewFaker(), new(event.TypeMux), vm.Config{})
+	if err := blockchain.SetArchive(true); err != nil {
+		t.Fatalf("failed to enable archive mode: %v", err)
+	}
+	if n, err := blockchain.InsertChain(blocks[16:]); err != nil {
+		t.Fatalf("failed to insert block %d: %v", 16+n, err)
+	}
+	if size := blockchain.TrieDB().Size(); size != 0 {
+		t.Errorf("archive chain cached %v of trie nodes", size)
+	}
+	for _, block := range blocks {
+		if _, err := trie.New(block.Root(), db); err != nil {
+			t.Errorf("block #%d: state not written to disk: %v", block.Number(), err)
+		}
+	}
+	blockchain.Stop()
+
+	// Restart again and ensure all the historical states are still available
+	blockchain, _ = NewBlockChain(db, gspec.Config, ethash.NewFaker(), new(event.TypeMux), vm.Config{})
+	defer blockchain.Stop()
+
+	if err := blockchain.SetArchive(true); err != nil {
+		t.Fatalf("failed to enable archive mode: %v", err)
+	}
+	for _, block := range blocks {
+		if !blockchain.HasBlockAndState(block.Hash()) {
+			t.Errorf("block #%d: state missing after restart", block.Number())
+		}
+	}
+}
+
+// Tests that pruning the state keeps the genesis state intact, even if it's
+// outside of the retained block range.
+func TestPruneStateRetainsGenesis(t *testing.T) {
+	gspec, blocks := makeTransferChain(t, 8)
+
+	db, _ := ethdb.NewMemDatabase()
+	genesis := gspec.MustCommit(db)
+
+	blockchain, _ := NewBlockChain(db, gspec.Config, ethash.NewFaker(), new(event.TypeMux), vm.Config{})
+	defer blockchain.Stop()
+
+	if n, err := blockchain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	if _, _, err := blockchain.PruneState(1, nil); err != nil {
+		t.Fatalf("failed to prune state: %v", err)
+	}
+	statedb, err := state.New(genesis.Root(), state.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("genesis state pruned: %v", err)
+	}
+	it := state.NewNodeIterator(statedb)
+	for it.Next() {
+	}
+	if it.Error != nil {
+		t.Fatalf("genesis state incomplete: %v", it.Error)
+	}
+	if !blockchain.HasBlockAndState(blocks[len(blocks)-1].Hash()) {
+		t.Fatalf("head state pruned")
+	}
+}
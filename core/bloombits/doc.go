@@ -0,0 +1,26 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+/*
+Package bloombits implements bloom filtering on batches of data.
+
+The header blooms of a fixed size section of the chain are transposed into one
+bit vector per bloom bit, where the n-th bit of a vector is set if the n-th
+header of the section has the given bloom bit set. Filtering a section for a
+log address or topic then only requires the three vectors belonging to its
+bloom bits instead of every header of the section.
+*/
+package bloombits
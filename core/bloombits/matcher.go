@@ -0,0 +1,308 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bloombits
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common/bitutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// errInvalidBitsetLength is returned if a retrieved bit vector doesn't match the
+// section size of the matcher.
+var errInvalidBitsetLength = errors.New("invalid bitset length")
+
+// bloomIndexes represents the bit indexes inside the bloom filter that belong
+// to some key.
+type bloomIndexes [3]uint
+
+// calcBloomIndexes returns the bloom filter bit indexes belonging to the given key.
+func calcBloomIndexes(b []byte) bloomIndexes {
+	b = crypto.Keccak256(b)
+
+	var idxs bloomIndexes
+	for i := 0; i < len(idxs); i++ {
+		idxs[i] = (uint(b[2*i])<<8)&2047 + uint(b[2*i+1])
+	}
+	return idxs
+}
+
+// Retrieval represents a request for the bit vectors of a single bloom bit in
+// a batch of sections, or the response for such a request.
+type Retrieval struct {
+	Bit      uint
+	Sections []uint64
+	Bitsets  [][]byte
+
+	Context context.Context
+	Error   error
+}
+
+// Matcher filters fixed size sections of the chain for blocks potentially
+// containing logs matching a set of address and topic criteria, by combining
+// the rotated bloom bit vectors of the sections with binary AND/OR operations.
+type Matcher struct {
+	sectionSize uint64           // Size of the data batches to filter on
+	filters     [][]bloomIndexes // Filter the system is matching for
+}
+
+// NewMatcher creates a new matcher for the given filter criteria. The filters
+// are AND-ed together, whereas the clauses within a single filter are OR-ed.
+// Setting a filter clause to nil is allowed and will result in that filter rule
+// being skipped (OR 0x11...1).
+func NewMatcher(sectionSize uint64, filters [][][]byte) *Matcher {
+	m := &Matcher{sectionSize: sectionSize}
+	for _, filter := range filters {
+		// Gather the bit indexes of the filter rule, special casing the nil filter
+		if len(filter) == 0 {
+			continue
+		}
+		bloomBits := make([]bloomIndexes, len(filter))
+		for i, clause := range filter {
+			if clause == nil {
+				bloomBits = nil
+				break
+			}
+			bloomBits[i] = calcBloomIndexes(clause)
+		}
+		// Accumulate the filter rules if no nil rule was within
+		if bloomBits != nil {
+			m.filters = append(m.filters, bloomBits)
+		}
+	}
+	return m
+}
+
+// Start creates a matching session for the given block range, which will feed
+// the numbers of the potentially matching blocks into the results channel once
+// the session is multiplexed onto a bit vector retriever.
+func (m *Matcher) Start(ctx context.Context, begin, end uint64, results chan uint64) (*MatcherSession, error) {
+	if m.sectionSize == 0 || m.sectionSize%8 != 0 {
+		return nil, fmt.Errorf("invalid section size %d, must be a positive multiple of 8", m.sectionSize)
+	}
+	if begin > end {
+		return nil, fmt.Errorf("invalid block range #%d-#%d", begin, end)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &MatcherSession{
+		matcher: m,
+		begin:   begin,
+		end:     end,
+		results: results,
+		ctx:     ctx,
+		cancel:  cancel,
+	}, nil
+}
+
+// MatcherSession is a single filtering run of a matcher over a block range.
+type MatcherSession struct {
+	matcher    *Matcher
+	begin, end uint64      // Block range to filter
+	results    chan uint64 // Channel to deliver the potentially matching blocks on
+
+	ctx    context.Context    // Context to abort pending retrievals with
+	cancel context.CancelFunc // Function to terminate the session with
+
+	errLock sync.Mutex
+	err     error // First failure encountered during the session
+}
+
+// Close stops the matching session, aborting any pending retrievals.
+func (s *MatcherSession) Close() {
+	s.cancel()
+}
+
+// Error returns any failure encountered during the matching session.
+func (s *MatcherSession) Error() error {
+	s.errLock.Lock()
+	defer s.errLock.Unlock()
+
+	return s.err
+}
+
+// setError records the first failure encountered during the matching session.
+func (s *MatcherSession) setError(err error) {
+	s.errLock.Lock()
+	defer s.errLock.Unlock()
+
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// Multiplex runs the matching session, filtering the sections of the block range
+// in batches and retrieving the needed bit vectors through the given multiplexer
+// channel. A retrieval is requested by sending a fresh channel into the multiplexer,
+// followed by the retrieval task on it, after which the filled task is expected
+// back on the same channel. The results channel is closed when the session ends.
+func (s *MatcherSession) Multiplex(batch int, mux chan chan *Retrieval) {
+	defer close(s.results)
+
+	if batch < 1 {
+		batch = 1
+	}
+	size := s.matcher.sectionSize
+	first, last := s.begin/size, s.end/size
+
+	for start := first; start <= last; start += uint64(batch) {
+		var sections []uint64
+		for section := start; section <= last && section < start+uint64(batch); section++ {
+			sections = append(sections, section)
+		}
+		vectors, err := s.match(sections, mux)
+		if err != nil {
+			s.setError(err)
+			return
+		}
+		// Deliver the potentially matching blocks within the requested range
+		for i, vector := range vectors {
+			if vector == nil {
+				continue
+			}
+			for j := uint64(0); j < size; j++ {
+				if vector[j/8]&(1<<(7-j%8)) == 0 {
+					continue
+				}
+				number := sections[i]*size + j
+				if number < s.begin || number > s.end {
+					continue
+				}
+				select {
+				case s.results <- number:
+				case <-s.ctx.Done():
+					s.setError(s.ctx.Err())
+					return
+				}
+			}
+		}
+	}
+}
+
+// match filters a batch of sections, returning a bit vector for each of them
+// with the bits of the potentially matching blocks set, or nil if the section
+// cannot contain any matches.
+func (s *MatcherSession) match(sections []uint64, mux chan chan *Retrieval) ([][]byte, error) {
+	vectors := make([][]byte, len(sections))
+	for i := range vectors {
+		vectors[i] = bytes.Repeat([]byte{0xff}, int(s.matcher.sectionSize/8))
+	}
+	for _, filter := range s.matcher.filters {
+		// Only retrieve the bits of the sections still potentially matching
+		var pending []uint64
+		for i, vector := range vectors {
+			if vector != nil {
+				pending = append(pending, sections[i])
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+		bits, err := s.retrieve(filter, pending, mux)
+		if err != nil {
+			return nil, err
+		}
+		// OR together the clauses of the filter rule and AND it into the sections
+		idx := 0
+		for i, vector := range vectors {
+			if vector == nil {
+				continue
+			}
+			match := make([]byte, len(vector))
+			for _, clause := range filter {
+				and := make([]byte, len(vector))
+				copy(and, bits[clause[0]][idx])
+				bitutil.ANDBytes(and, and, bits[clause[1]][idx])
+				bitutil.ANDBytes(and, and, bits[clause[2]][idx])
+				bitutil.ORBytes(match, match, and)
+			}
+			bitutil.ANDBytes(vector, vector, match)
+			if !bitutil.TestBytes(vector) {
+				vectors[i] = nil
+			}
+			idx++
+		}
+	}
+	return vectors, nil
+}
+
+// retrieve concurrently fetches the bit vectors of all the distinct bloom bits
+// of a filter rule for the given sections.
+func (s *MatcherSession) retrieve(filter []bloomIndexes, sections []uint64, mux chan chan *Retrieval) (map[uint][][]byte, error) {
+	var distinct []uint
+	seen := make(map[uint]bool)
+	for _, clause := range filter {
+		for _, bit := range clause {
+			if !seen[bit] {
+				seen[bit] = true
+				distinct = append(distinct, bit)
+			}
+		}
+	}
+	var (
+		bitsets = make([][][]byte, len(distinct))
+		errs    = make([]error, len(distinct))
+		pend    sync.WaitGroup
+	)
+	for i, bit := range distinct {
+		pend.Add(1)
+		go func(i int, bit uint) {
+			defer pend.Done()
+			bitsets[i], errs[i] = s.fetch(bit, sections, mux)
+		}(i, bit)
+	}
+	pend.Wait()
+
+	bits := make(map[uint][][]byte)
+	for i, bit := range distinct {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		bits[bit] = bitsets[i]
+	}
+	return bits, nil
+}
+
+// fetch retrieves the bit vectors of a single bloom bit for the given sections
+// through the multiplexer and validates the response.
+func (s *MatcherSession) fetch(bit uint, sections []uint64, mux chan chan *Retrieval) ([][]byte, error) {
+	request := make(chan *Retrieval)
+	select {
+	case mux <- request:
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+	request <- &Retrieval{Bit: bit, Sections: sections, Context: s.ctx}
+	result := <-request
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(result.Bitsets) != len(sections) {
+		return nil, fmt.Errorf("bit %d: bitset count mismatch: have %d, want %d", bit, len(result.Bitsets), len(sections))
+	}
+	for i, bitset := range result.Bitsets {
+		if uint64(len(bitset)) != s.matcher.sectionSize/8 {
+			return nil, fmt.Errorf("bit %d, section %d: %v", bit, sections[i], errInvalidBitsetLength)
+		}
+	}
+	return result.Bitsets, nil
+}
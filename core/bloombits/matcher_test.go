@@ -0,0 +1,171 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bloombits
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const testSectionSize = 64
+
+// testBloomChain generates the header blooms of a number of test sections, each
+// block containing a few random keys of the given key set.
+func testBloomChain(sections int, keys [][]byte) []types.Bloom {
+	blooms := make([]types.Bloom, sections*testSectionSize)
+	for i := range blooms {
+		for j := rand.Intn(3); j > 0; j-- {
+			blooms[i].Add(new(big.Int).SetBytes(keys[rand.Intn(len(keys))]))
+		}
+	}
+	return blooms
+}
+
+// serveTestBloomBits rotates the test blooms into bit vectors and serves the
+// retrieval requests of matcher sessions from them until the quit channel is
+// closed. Requests for bits in the failing set are rejected.
+func serveTestBloomBits(blooms []types.Bloom, mux chan chan *Retrieval, fail map[uint]bool, quit chan struct{}) {
+	var vectors [][][]byte
+	for section := 0; section < len(blooms)/testSectionSize; section++ {
+		gen, _ := NewGenerator(testSectionSize)
+		for i, bloom := range blooms[section*testSectionSize : (section+1)*testSectionSize] {
+			gen.AddBloom(uint(i), bloom)
+		}
+		bits := make([][]byte, types.BloomBitLength)
+		for i := range bits {
+			bits[i], _ = gen.Bitset(uint(i))
+		}
+		vectors = append(vectors, bits)
+	}
+	go func() {
+		for {
+			select {
+			case request := <-mux:
+				task := <-request
+				if fail[task.Bit] {
+					task.Error = errors.New("retrieval failed")
+				} else {
+					task.Bitsets = make([][]byte, len(task.Sections))
+					for i, section := range task.Sections {
+						task.Bitsets[i] = vectors[section][task.Bit]
+					}
+				}
+				request <- task
+			case <-quit:
+				return
+			}
+		}
+	}()
+}
+
+// Tests that the matcher returns exactly the blocks whose blooms match the
+// filter criteria within the requested range.
+func TestMatcher(t *testing.T) {
+	keys := make([][]byte, 16)
+	for i := range keys {
+		keys[i] = []byte{0xde, 0xad, byte(i)}
+	}
+	blooms := testBloomChain(8, keys)
+
+	mux := make(chan chan *Retrieval)
+	quit := make(chan struct{})
+	defer close(quit)
+	serveTestBloomBits(blooms, mux, nil, quit)
+
+	tests := []struct {
+		filters    [][][]byte
+		begin, end uint64
+	}{
+		{[][][]byte{{keys[0]}}, 0, 8*testSectionSize - 1},
+		{[][][]byte{{keys[1], keys[2]}}, 0, 8*testSectionSize - 1},
+		{[][][]byte{{keys[3]}, {keys[4], keys[5]}}, 0, 8*testSectionSize - 1},
+		{[][][]byte{{keys[6]}, {nil}, {keys[7]}}, 0, 8*testSectionSize - 1},
+		{[][][]byte{{keys[8], keys[9]}, {keys[10]}}, 10, 3*testSectionSize + 17},
+		{[][][]byte{{keys[11]}}, 2 * testSectionSize, 2*testSectionSize + 7},
+	}
+	for i, tt := range tests {
+		// Calculate the expected matches by checking every bloom
+		var want []uint64
+		for number := tt.begin; number <= tt.end; number++ {
+			match := true
+			for _, filter := range tt.filters {
+				found := false
+				for _, clause := range filter {
+					if clause == nil || types.BloomLookup(blooms[number], new(big.Int).SetBytes(clause)) {
+						found = true
+					}
+				}
+				match = match && found
+			}
+			if match {
+				want = append(want, number)
+			}
+		}
+		// Run the matcher and compare the results
+		results := make(chan uint64)
+		session, err := NewMatcher(testSectionSize, tt.filters).Start(context.Background(), tt.begin, tt.end, results)
+		if err != nil {
+			t.Fatalf("test %d: failed to start session: %v", i, err)
+		}
+		go session.Multiplex(3, mux)
+
+		var have []uint64
+		for number := range results {
+			have = append(have, number)
+		}
+		if err := session.Error(); err != nil {
+			t.Fatalf("test %d: session failed: %v", i, err)
+		}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("test %d: matches mismatch: have %v, want %v", i, have, want)
+		}
+	}
+}
+
+// Tests that retrieval failures abort the matching session.
+func TestMatcherRetrievalFailure(t *testing.T) {
+	key := []byte("failing key")
+	blooms := testBloomChain(2, [][]byte{key})
+
+	fail := make(map[uint]bool)
+	for _, bit := range calcBloomIndexes(key) {
+		fail[bit] = true
+	}
+	mux := make(chan chan *Retrieval)
+	quit := make(chan struct{})
+	defer close(quit)
+	serveTestBloomBits(blooms, mux, fail, quit)
+
+	results := make(chan uint64)
+	session, err := NewMatcher(testSectionSize, [][][]byte{{key}}).Start(context.Background(), 0, 2*testSectionSize-1, results)
+	if err != nil {
+		t.Fatalf("failed to start session: %v", err)
+	}
+	go session.Multiplex(1, mux)
+
+	for range results {
+	}
+	if err := session.Error(); err == nil {
+		t.Errorf("session succeeded despite retrieval failure")
+	}
+}
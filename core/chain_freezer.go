@@ -0,0 +1,170 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	// freezerRecheckInterval is the frequency to check the key-value database for
+	// chain progression that might permit new blocks to be frozen into immutable
+	// storage.
+	freezerRecheckInterval = time.Minute
+
+	// freezerBatchLimit is the maximum number of blocks to freeze in one batch
+	// before doing an fsync and deleting them from the key-value store.
+	freezerBatchLimit = 30000
+)
+
+// freeze is the background loop of the chain freezer, periodically moving the
+// canonical blocks past the immutability threshold out of the key-value store
+// into the ancient store. Databases with existing chain data are migrated the
+// same way, one batch at a time.
+func (bc *BlockChain) freeze(store ethdb.AncientStore) {
+	defer bc.wg.Done()
+
+	for {
+		frozen, err := bc.freezeAncients(store)
+		if err != nil {
+			log.Error("Failed to freeze ancient blocks", "err", err)
+		}
+		// Continue right away if a full batch was moved, otherwise wait a bit
+		wait := freezerRecheckInterval
+		if err == nil && frozen == freezerBatchLimit {
+			wait = 0
+		}
+		select {
+		case <-time.After(wait):
+		case <-bc.quit:
+			return
+		}
+	}
+}
+
+// freezeAncients moves the next batch of immutable canonical blocks from the
+// key-value store into the ancient store, returning the number of blocks moved.
+func (bc *BlockChain) freezeAncients(store ethdb.AncientStore) (int, error) {
+	bc.freezeLock.Lock()
+	defer bc.freezeLock.Unlock()
+
+	head := bc.CurrentBlock().NumberU64()
+	if head < params.ImmutabilityThreshold {
+		return 0, nil
+	}
+	frozen, err := store.Ancients()
+	if err != nil {
+		return 0, err
+	}
+	limit := head - params.ImmutabilityThreshold
+	if limit < frozen {
+		return 0, nil
+	}
+	if limit-frozen >= freezerBatchLimit {
+		limit = frozen + freezerBatchLimit - 1
+	}
+	// Append the blocks to the ancient store, stopping at the first missing one
+	var (
+		start  = time.Now()
+		hashes []common.Hash
+	)
+	for number := frozen; number <= limit; number++ {
+		var hash common.Hash
+		if hash, err = bc.freezeBlock(store, number); err != nil {
+			break
+		}
+		hashes = append(hashes, hash)
+
+		select {
+		case <-bc.quit:
+			limit = number
+		default:
+		}
+	}
+	if len(hashes) == 0 {
+		return 0, err
+	}
+	// Make sure the data is safely on disk before deleting it from the database
+	if err := store.Sync(); err != nil {
+		return 0, err
+	}
+	for i, hash := range hashes {
+		number := frozen + uint64(i)
+		if number == 0 {
+			continue // Keep the genesis block around for easy access
+		}
+		DeleteCanonicalHash(bc.chainDb, number)
+		bc.chainDb.Delete(append(append(headerPrefix, encodeBlockNumber(number)...), hash.Bytes()...))
+		DeleteTd(bc.chainDb, hash, number)
+		DeleteBody(bc.chainDb, hash, number)
+		DeleteBlockReceipts(bc.chainDb, hash, number)
+	}
+	log.Info("Moved blocks into the ancient store", "blocks", len(hashes), "number", frozen+uint64(len(hashes))-1,
+		"hash", hashes[len(hashes)-1], "elapsed", common.PrettyDuration(time.Since(start)))
+	return len(hashes), err
+}
+
+// freezeBlock appends the canonical block with the given number to the ancient
+// store, returning its hash.
+func (bc *BlockChain) freezeBlock(store ethdb.AncientStore, number uint64) (common.Hash, error) {
+	hash := GetCanonicalHash(bc.chainDb, number)
+	if hash == (common.Hash{}) {
+		return hash, fmt.Errorf("canonical hash missing for block #%d", number)
+	}
+	header := GetHeaderRLP(bc.chainDb, hash, number)
+	if len(header) == 0 {
+		return hash, fmt.Errorf("block header missing for #%d [%x…]", number, hash[:4])
+	}
+	body := GetBodyRLP(bc.chainDb, hash, number)
+	if len(body) == 0 {
+		return hash, fmt.Errorf("block body missing for #%d [%x…]", number, hash[:4])
+	}
+	receipts := getBlockReceiptsRLP(bc.chainDb, hash, number)
+	if len(receipts) == 0 {
+		if number != 0 {
+			return hash, fmt.Errorf("block receipts missing for #%d [%x…]", number, hash[:4])
+		}
+		receipts = rlp.EmptyList // The genesis receipts are not stored on a chain reset
+	}
+	td := getTdRLP(bc.chainDb, hash, number)
+	if len(td) == 0 {
+		return hash, fmt.Errorf("total difficulty missing for #%d [%x…]", number, hash[:4])
+	}
+	return hash, store.AppendAncient(number, hash.Bytes(), header, body, receipts, td)
+}
+
+// truncateAncients discards all frozen blocks above the given head, which only
+// happens if the chain is rewound past the immutability threshold.
+func (bc *BlockChain) truncateAncients(head uint64) error {
+	store := ancientStore(bc.chainDb)
+	if store == nil {
+		return nil
+	}
+	frozen, err := store.Ancients()
+	if err != nil || frozen <= head+1 {
+		return err
+	}
+	log.Warn("Truncating ancient chain", "from", frozen, "to", head+1)
+	return store.TruncateAncients(head + 1)
+}
@@ -0,0 +1,128 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that immutable blocks are moved from the key-value store into the
+// ancient store, remain accessible from there, and are truncated on rewinds.
+func TestChainFreezer(t *testing.T) {
+	defer func(threshold uint64) { params.ImmutabilityThreshold = threshold }(params.ImmutabilityThreshold)
+	params.ImmutabilityThreshold = 32
+
+	dir, err := ioutil.TempDir("", "chainfreezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		gendb, _ = ethdb.NewMemDatabase()
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address  = crypto.PubkeyToAddress(key.PublicKey)
+		gspec    = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  GenesisAlloc{address: {Balance: big.NewInt(1000000000)}},
+		}
+		genesis = gspec.MustCommit(gendb)
+		signer  = types.NewEIP155Signer(gspec.Config.ChainId)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, gendb, 64, func(i int, block *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x00}, big.NewInt(1000), bigTxGas, nil, nil), signer, key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	db, err := ethdb.NewLDBDatabaseWithFreezer(filepath.Join(dir, "chaindata"), 0, 0, filepath.Join(dir, "ancient"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+	gspec.MustCommit(db)
+
+	chain, _ := NewBlockChain(db, gspec.Config, ethash.NewFaker(), new(event.TypeMux), vm.Config{})
+	defer chain.Stop()
+
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	// Freezing should move everything past the threshold, keeping the genesis
+	if n, err := chain.freezeAncients(db); n != 33 || err != nil {
+		t.Fatalf("freeze result mismatch: have %d/%v, want %d/nil", n, err, 33)
+	}
+	if n, err := chain.freezeAncients(db); n != 0 || err != nil {
+		t.Fatalf("repeated freeze result mismatch: have %d/%v, want 0/nil", n, err)
+	}
+	if frozen, _ := db.Ancients(); frozen != 33 {
+		t.Fatalf("frozen count mismatch: have %d, want %d", frozen, 33)
+	}
+	if data, _ := db.Get(append(append(headerPrefix, encodeBlockNumber(0)...), numSuffix...)); len(data) == 0 {
+		t.Errorf("genesis removed from the key-value store")
+	}
+	for _, block := range blocks {
+		hash, number := block.Hash(), block.NumberU64()
+
+		stored, _ := db.Get(append(append(bodyPrefix, encodeBlockNumber(number)...), hash.Bytes()...))
+		if frozen := number <= 32; frozen != (len(stored) == 0) {
+			t.Errorf("block #%d: key-value store presence mismatch: have %v, want %v", number, len(stored) != 0, !frozen)
+		}
+		if have := GetCanonicalHash(db, number); have != hash {
+			t.Errorf("block #%d: canonical hash mismatch: have %x, want %x", number, have, hash)
+		}
+		if have := GetBlock(db, hash, number); have == nil || have.Hash() != hash || len(have.Transactions()) != 1 {
+			t.Errorf("block #%d: block not retrievable", number)
+		}
+		if receipts := GetBlockReceipts(db, hash, number); len(receipts) != 1 {
+			t.Errorf("block #%d: receipt count mismatch: have %d, want %d", number, len(receipts), 1)
+		}
+		if td := GetTd(db, hash, number); td == nil {
+			t.Errorf("block #%d: total difficulty missing", number)
+		}
+		if tx, blockHash, _, _ := GetTransaction(db, block.Transactions()[0].Hash()); tx == nil || blockHash != hash {
+			t.Errorf("block #%d: transaction not retrievable", number)
+		}
+	}
+	// Rewinding below the frozen blocks should truncate the ancient store
+	if err := chain.SetHead(20); err != nil {
+		t.Fatalf("failed to rewind chain: %v", err)
+	}
+	if frozen, _ := db.Ancients(); frozen != 21 {
+		t.Fatalf("frozen count mismatch after rewind: have %d, want %d", frozen, 21)
+	}
+	if block := chain.GetBlockByNumber(20); block == nil || block.Hash() != blocks[19].Hash() {
+		t.Errorf("new head block not retrievable")
+	}
+	if block := chain.GetBlockByNumber(21); block != nil {
+		t.Errorf("rewound block #21 still retrievable")
+	}
+}
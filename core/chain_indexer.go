@@ -0,0 +1,379 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// ChainIndexerBackend defines the methods needed to process chain segments in
+// the background and write the segment results into the database. These can be
+// used to create filter blooms or CHTs.
+type ChainIndexerBackend interface {
+	// Reset initiates the processing of a new chain segment, potentially terminating
+	// any partially completed operations (in case of a reorg). The head of the last
+	// section (or the zero hash for the first one) is passed along for reference.
+	Reset(section uint64, lastSectionHead common.Hash) error
+
+	// Process crunches through the next header in the chain segment. The caller
+	// will ensure a sequential order of headers.
+	Process(header *types.Header) error
+
+	// Commit finalizes the section metadata and stores it into the database.
+	Commit() error
+}
+
+// ChainIndexer does a post-processing job for equally sized sections of the
+// canonical chain (like bloom tries and CHT structures). A ChainIndexer is
+// connected to the blockchain through the event system by calling Start, which
+// feeds chain head events into the indexer in a goroutine.
+//
+// Further child ChainIndexers can be added which use the output of the parent
+// section indexer. These child indexers receive new head notifications only
+// after an entire section has been finished or in case of rollbacks that might
+// affect already finished sections.
+type ChainIndexer struct {
+	chainDb  ethdb.Database      // Chain database to index the data from
+	indexDb  ethdb.Database      // Prefixed table-view of the db to write index metadata into
+	backend  ChainIndexerBackend // Background processor generating the index data content
+	children []*ChainIndexer     // Child indexers to cascade chain updates to
+
+	sectionSize uint64        // Number of blocks in a single chain segment to process
+	confirmsReq uint64        // Number of confirmations before processing a completed segment
+	throttling  time.Duration // Disk throttling to prevent a heavy upgrade from hogging resources
+
+	storedSections uint64 // Number of sections successfully indexed into the database
+	knownSections  uint64 // Number of sections known to be complete (block wise)
+	cascadedHead   uint64 // Block number of the last completed section cascaded to subindexers
+
+	update chan struct{} // Notification channel that headers should be processed
+	quit   chan struct{} // Quit channel to tear down running goroutines
+	wg     sync.WaitGroup
+
+	log  log.Logger
+	lock sync.RWMutex
+}
+
+// NewChainIndexer creates a new chain indexer to do background processing on
+// chain segments of a given size after certain number of confirmations passed.
+// The throttling parameter might be used to prevent database thrashing.
+func NewChainIndexer(chainDb, indexDb ethdb.Database, backend ChainIndexerBackend, section, confirm uint64, throttling time.Duration, kind string) *ChainIndexer {
+	c := &ChainIndexer{
+		chainDb:     chainDb,
+		indexDb:     indexDb,
+		backend:     backend,
+		update:      make(chan struct{}, 1),
+		quit:        make(chan struct{}),
+		sectionSize: section,
+		confirmsReq: confirm,
+		throttling:  throttling,
+		log:         log.New("type", kind),
+	}
+	// Initialize database dependent fields and start the updater
+	c.loadValidSections()
+	if c.storedSections > 0 {
+		c.cascadedHead = c.storedSections*c.sectionSize - 1
+	}
+
+	c.wg.Add(1)
+	go c.updateLoop()
+
+	return c
+}
+
+// Start creates a goroutine to feed chain head events from the event mux into
+// the indexer for background processing.
+func (c *ChainIndexer) Start(mux *event.TypeMux) {
+	var head *types.Header
+	if hash := GetHeadHeaderHash(c.chainDb); hash != (common.Hash{}) {
+		head = GetHeader(c.chainDb, hash, GetBlockNumber(c.chainDb, hash))
+	}
+	sub := mux.Subscribe(ChainHeadEvent{})
+
+	c.wg.Add(1)
+	go c.eventLoop(head, sub)
+}
+
+// Close tears down all goroutines belonging to the indexer and its children.
+func (c *ChainIndexer) Close() {
+	close(c.quit)
+	c.wg.Wait()
+
+	for _, child := range c.children {
+		child.Close()
+	}
+}
+
+// eventLoop is a secondary event loop of the indexer which pushes chain head
+// events into the processing queue, rolling back sections on reorgs.
+func (c *ChainIndexer) eventLoop(currentHeader *types.Header, sub *event.TypeMuxSubscription) {
+	defer c.wg.Done()
+	defer sub.Unsubscribe()
+
+	// Fire the initial new head event to start any outstanding processing
+	if currentHeader != nil {
+		c.newHead(currentHeader.Number.Uint64(), false)
+	}
+	prevHeader := currentHeader
+	for {
+		select {
+		case <-c.quit:
+			return
+
+		case ev, ok := <-sub.Chan():
+			if !ok {
+				return
+			}
+			header := ev.Data.(ChainHeadEvent).Block.Header()
+			if prevHeader != nil && header.ParentHash != prevHeader.Hash() {
+				// Reorg to the common ancestor if the chain was rewound
+				if ancestor := FindCommonAncestor(c.chainDb, prevHeader, header); ancestor != nil {
+					c.newHead(ancestor.Number.Uint64(), true)
+				}
+			}
+			c.newHead(header.Number.Uint64(), false)
+			prevHeader = header
+		}
+	}
+}
+
+// newHead notifies the indexer about new chain heads and/or reorgs.
+func (c *ChainIndexer) newHead(head uint64, reorg bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// If a reorg happened, invalidate all sections until that point
+	if reorg {
+		// Revert the known section number to the reorg point
+		changed := head / c.sectionSize
+		if changed < c.knownSections {
+			c.knownSections = changed
+		}
+		// Revert the stored sections from the database to the reorg point
+		if changed < c.storedSections {
+			c.setValidSections(changed)
+		}
+		// Update the new head number to the finalized section end and notify children
+		head = changed * c.sectionSize
+
+		if head < c.cascadedHead {
+			c.cascadedHead = head
+			for _, child := range c.children {
+				child.newHead(c.cascadedHead, true)
+			}
+		}
+		return
+	}
+	// No reorg, calculate the number of newly known sections and update if high enough
+	var sections uint64
+	if head >= c.confirmsReq {
+		sections = (head + 1 - c.confirmsReq) / c.sectionSize
+		if sections > c.knownSections {
+			c.knownSections = sections
+		}
+	}
+	if c.knownSections > c.storedSections {
+		c.signalUpdate()
+	}
+}
+
+// signalUpdate wakes up the update loop if it's not already scheduled.
+func (c *ChainIndexer) signalUpdate() {
+	select {
+	case c.update <- struct{}{}:
+	default:
+	}
+}
+
+// updateLoop is the main event loop of the indexer which pushes chain segments
+// down into the processing backend.
+func (c *ChainIndexer) updateLoop() {
+	defer c.wg.Done()
+
+	for {
+		select {
+		case <-c.quit:
+			return
+
+		case <-c.update:
+			// Section headers completed (or rolled back), update the index
+			c.lock.Lock()
+			if c.knownSections > c.storedSections {
+				// Cache the current section count and head to allow unlocking the mutex
+				section := c.storedSections
+				oldHead := c.lastSectionHead(section)
+				// Process the newly defined section in the background
+				c.lock.Unlock()
+				newHead, err := c.processSection(section, oldHead)
+				c.lock.Lock()
+
+				// If processing succeeded and no reorgs occurred, mark the section completed
+				if err == nil && oldHead == c.lastSectionHead(section) && section == c.storedSections {
+					c.setSectionHead(section, newHead)
+					c.setValidSections(section + 1)
+
+					c.cascadedHead = c.storedSections*c.sectionSize - 1
+					for _, child := range c.children {
+						child.newHead(c.cascadedHead, false)
+					}
+				} else {
+					// If processing failed, don't retry until further notification
+					c.log.Debug("Chain index processing failed", "section", section, "err", err)
+					c.knownSections = c.storedSections
+				}
+			}
+			// If there are still further sections to process, reschedule
+			if c.knownSections > c.storedSections {
+				time.AfterFunc(c.throttling, c.signalUpdate)
+			}
+			c.lock.Unlock()
+		}
+	}
+}
+
+// processSection processes an entire section by calling backend functions while
+// ensuring the continuity of the passed headers. Since the chain mutex is not
+// held while processing, the continuity can be broken by a long reorg, in which
+// case the function returns with an error.
+func (c *ChainIndexer) processSection(section uint64, lastHead common.Hash) (common.Hash, error) {
+	c.log.Trace("Processing new chain section", "section", section)
+
+	// Reset and partial processing
+	if err := c.backend.Reset(section, lastHead); err != nil {
+		return common.Hash{}, err
+	}
+	for number := section * c.sectionSize; number < (section+1)*c.sectionSize; number++ {
+		hash := GetCanonicalHash(c.chainDb, number)
+		if hash == (common.Hash{}) {
+			return common.Hash{}, fmt.Errorf("canonical block #%d unknown", number)
+		}
+		header := GetHeader(c.chainDb, hash, number)
+		if header == nil {
+			return common.Hash{}, fmt.Errorf("block #%d [%x…] not found", number, hash[:4])
+		} else if header.ParentHash != lastHead {
+			return common.Hash{}, fmt.Errorf("chain reorged during section processing")
+		}
+		if err := c.backend.Process(header); err != nil {
+			return common.Hash{}, err
+		}
+		lastHead = header.Hash()
+	}
+	if err := c.backend.Commit(); err != nil {
+		c.log.Error("Section commit failed", "error", err)
+		return common.Hash{}, err
+	}
+	return lastHead, nil
+}
+
+// AddChildIndexer adds a child ChainIndexer that can use the output of this one.
+func (c *ChainIndexer) AddChildIndexer(indexer *ChainIndexer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.children = append(c.children, indexer)
+
+	// Cascade any pending updates to new children too
+	if c.storedSections > 0 {
+		indexer.newHead(c.cascadedHead, false)
+	}
+}
+
+// Sections returns the number of processed sections maintained by the indexer
+// and also the hash of the last header indexed for potential canonical
+// verifications.
+func (c *ChainIndexer) Sections() (uint64, common.Hash) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if c.storedSections == 0 {
+		return 0, common.Hash{}
+	}
+	return c.storedSections, c.sectionHead(c.storedSections - 1)
+}
+
+// loadValidSections reads the number of valid sections from the index database
+// and caches it into the local state.
+func (c *ChainIndexer) loadValidSections() {
+	data, _ := c.indexDb.Get([]byte("count"))
+	if len(data) == 8 {
+		c.storedSections = binary.BigEndian.Uint64(data[:])
+	}
+}
+
+// setValidSections writes the number of valid sections to the index database
+func (c *ChainIndexer) setValidSections(sections uint64) {
+	// Set the current number of valid sections in the database
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], sections)
+	c.indexDb.Put([]byte("count"), data[:])
+
+	// Remove any reorged sections, caching the valids in the mean time
+	for c.storedSections > sections {
+		c.storedSections--
+		c.removeSectionHead(c.storedSections)
+	}
+	c.storedSections = sections // needed if new > old
+}
+
+// sectionHead retrieves the last block hash of a processed section from the
+// index database.
+func (c *ChainIndexer) sectionHead(section uint64) common.Hash {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], section)
+
+	hash, _ := c.indexDb.Get(append([]byte("shead"), data[:]...))
+	if len(hash) == len(common.Hash{}) {
+		return common.BytesToHash(hash)
+	}
+	return common.Hash{}
+}
+
+// lastSectionHead retrieves the head of the section preceding the given one, or
+// the zero hash for the very first section.
+func (c *ChainIndexer) lastSectionHead(section uint64) common.Hash {
+	if section == 0 {
+		return common.Hash{}
+	}
+	return c.sectionHead(section - 1)
+}
+
+// setSectionHead writes the last block hash of a processed section to the index
+// database.
+func (c *ChainIndexer) setSectionHead(section uint64, hash common.Hash) {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], section)
+
+	c.indexDb.Put(append([]byte("shead"), data[:]...), hash.Bytes())
+}
+
+// removeSectionHead removes the reference to a processed section from the index
+// database.
+func (c *ChainIndexer) removeSectionHead(section uint64) {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], section)
+
+	c.indexDb.Delete(append([]byte("shead"), data[:]...))
+}
@@ -0,0 +1,192 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// testChainIndexBackend implements ChainIndexerBackend, recording the headers
+// of each processed section and reporting committed sections.
+type testChainIndexBackend struct {
+	size     uint64
+	section  uint64
+	headers  []*types.Header
+	commitCh chan uint64
+}
+
+func (b *testChainIndexBackend) Reset(section uint64, lastSectionHead common.Hash) error {
+	b.section, b.headers = section, nil
+	return nil
+}
+
+func (b *testChainIndexBackend) Process(header *types.Header) error {
+	if want := b.section*b.size + uint64(len(b.headers)); header.Number.Uint64() != want {
+		return fmt.Errorf("unexpected header: have #%d, want #%d", header.Number, want)
+	}
+	b.headers = append(b.headers, header)
+	return nil
+}
+
+func (b *testChainIndexBackend) Commit() error {
+	b.commitCh <- b.section
+	return nil
+}
+
+// writeTestChain inserts a canonical header chain of the given length into the
+// database, marking each header with the given extra data.
+func writeTestChain(db ethdb.Database, from, to uint64, extra byte) {
+	var parent common.Hash
+	if from > 0 {
+		parent = GetCanonicalHash(db, from-1)
+	}
+	for number := from; number < to; number++ {
+		header := &types.Header{Number: new(big.Int).SetUint64(number), ParentHash: parent, Extra: []byte{extra}}
+		WriteHeader(db, header)
+		WriteCanonicalHash(db, header.Hash(), number)
+		parent = header.Hash()
+	}
+}
+
+// verifyIndexerCommit waits for the backend to commit the given section.
+func verifyIndexerCommit(t *testing.T, backend *testChainIndexBackend, want uint64) {
+	select {
+	case have := <-backend.commitCh:
+		if have != want {
+			t.Fatalf("committed section mismatch: have %d, want %d", have, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("section %d not committed", want)
+	}
+}
+
+// verifyIndexerSections waits for the indexer to report the given number of
+// processed sections.
+func verifyIndexerSections(t *testing.T, indexer *ChainIndexer, want uint64) {
+	for i := 0; i < 100; i++ {
+		if have, _ := indexer.Sections(); have == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	have, _ := indexer.Sections()
+	t.Fatalf("section count mismatch: have %d, want %d", have, want)
+}
+
+// Tests that the chain indexer processes completed sections once enough
+// confirmations passed, and reprocesses sections rolled back by reorgs.
+func TestChainIndexerSections(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	backend := &testChainIndexBackend{size: 4, commitCh: make(chan uint64, 16)}
+
+	indexer := NewChainIndexer(db, ethdb.NewTable(db, "index-"), backend, 4, 2, 0, "test")
+	defer indexer.Close()
+
+	verifyCommit := func(want uint64) { verifyIndexerCommit(t, backend, want) }
+	verifySections := func(want uint64) { verifyIndexerSections(t, indexer, want) }
+	// Insufficient confirmations shouldn't trigger any processing
+	writeTestChain(db, 0, 5, 0)
+	indexer.newHead(4, false)
+	verifySections(0)
+
+	// Confirming the first section should process it
+	writeTestChain(db, 5, 9, 0)
+	indexer.newHead(8, false)
+	verifyCommit(0)
+	verifySections(1)
+
+	// Advancing by multiple sections should process all of them in order
+	writeTestChain(db, 9, 18, 0)
+	indexer.newHead(17, false)
+	verifyCommit(1)
+	verifyCommit(2)
+	verifyCommit(3)
+	verifySections(4)
+
+	// Reorging into the second section should roll back and reprocess
+	writeTestChain(db, 6, 18, 1)
+	indexer.newHead(5, true)
+	verifySections(1)
+
+	indexer.newHead(17, false)
+	verifyCommit(1)
+	verifyCommit(2)
+	verifyCommit(3)
+	verifySections(4)
+
+	if _, head := indexer.Sections(); head != GetCanonicalHash(db, 15) {
+		t.Errorf("section head mismatch: have %x, want %x", head, GetCanonicalHash(db, 15))
+	}
+}
+
+// Tests that child indexers are only notified of finished sections of their
+// parent, and that rollbacks of the parent are cascaded to them.
+func TestChainIndexerChildren(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+
+	backend := &testChainIndexBackend{size: 4, commitCh: make(chan uint64, 16)}
+	indexer := NewChainIndexer(db, ethdb.NewTable(db, "index-"), backend, 4, 2, 0, "parent")
+	defer indexer.Close()
+
+	childBackend := &testChainIndexBackend{size: 8, commitCh: make(chan uint64, 16)}
+	child := NewChainIndexer(db, ethdb.NewTable(db, "child-"), childBackend, 8, 0, 0, "child")
+	indexer.AddChildIndexer(child)
+
+	// Finishing the parent sections covering a child section should process it
+	writeTestChain(db, 0, 10, 0)
+	indexer.newHead(9, false)
+	verifyIndexerCommit(t, backend, 0)
+	verifyIndexerCommit(t, backend, 1)
+	verifyIndexerCommit(t, childBackend, 0)
+	verifyIndexerSections(t, child, 1)
+
+	// A partially finished child section shouldn't be processed
+	writeTestChain(db, 10, 14, 0)
+	indexer.newHead(13, false)
+	verifyIndexerCommit(t, backend, 2)
+	verifyIndexerSections(t, indexer, 3)
+	verifyIndexerSections(t, child, 1)
+
+	writeTestChain(db, 14, 18, 0)
+	indexer.newHead(17, false)
+	verifyIndexerCommit(t, backend, 3)
+	verifyIndexerCommit(t, childBackend, 1)
+	verifyIndexerSections(t, child, 2)
+
+	// Reorging into a finished child section should roll back the child too
+	writeTestChain(db, 10, 18, 1)
+	indexer.newHead(9, true)
+	verifyIndexerSections(t, indexer, 2)
+	verifyIndexerSections(t, child, 1)
+
+	indexer.newHead(17, false)
+	verifyIndexerCommit(t, backend, 2)
+	verifyIndexerCommit(t, backend, 3)
+	verifyIndexerCommit(t, childBackend, 1)
+	verifyIndexerSections(t, child, 2)
+
+	if _, head := child.Sections(); head != GetCanonicalHash(db, 15) {
+		t.Errorf("child section head mismatch: have %x, want %x", head, GetCanonicalHash(db, 15))
+	}
+}
@@ -210,7 +210,7 @@ func makeHeader(config *params.ChainConfig, parent *types.Block, state *state.St
 		time = new(big.Int).Add(parent.Time(), big.NewInt(10)) // block time is fixed at 10 seconds
 	}
 
-	return &types.Header{
+	header := &types.Header{
 		Root:       state.IntermediateRoot(config.IsEIP158(parent.Number())),
 		ParentHash: parent.Hash(),
 		Coinbase:   parent.Coinbase(),
@@ -225,6 +225,13 @@ func makeHeader(config *params.ChainConfig, parent *types.Block, state *state.St
 		Number:   new(big.Int).Add(parent.Number(), common.Big1),
 		Time:     time,
 	}
+	if config.IsLondon(header.Number) {
+		header.BaseFee = misc.CalcBaseFee(config, parent.Header())
+		if !config.IsLondon(parent.Number()) {
+			header.GasLimit.Mul(header.GasLimit, new(big.Int).SetUint64(params.ElasticityMultiplier))
+		}
+	}
+	return header
 }
 
 // newCanonical creates a chain database, and injects a deterministic canonical
@@ -0,0 +1,151 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// DatabaseStat is the number and total size of the entries of a particular
+// category of data in the database.
+type DatabaseStat struct {
+	Database string             // Name of the store holding the data (key-value or ancient)
+	Category string             // Kind of the data stored
+	Items    uint64             // Number of entries
+	Size     common.StorageSize // Total size of the keys and values
+}
+
+// inspectCategory describes a category of database entries identified by their
+// key prefix and length, zero length meaning keys of any length.
+type inspectCategory struct {
+	name   string
+	prefix []byte
+	length int
+}
+
+// inspectCategories lists the known database key namespaces. Keys are matched
+// against them in order, the first matching category winning.
+var inspectCategories = []inspectCategory{
+	{"Headers", headerPrefix, 1 + 8 + common.HashLength},
+	{"Total difficulties", headerPrefix, 1 + 8 + common.HashLength + 1},
+	{"Canonical hashes", headerPrefix, 1 + 8 + 1},
+	{"Block number lookups", blockHashPrefix, 1 + common.HashLength},
+	{"Bodies", bodyPrefix, 1 + 8 + common.HashLength},
+	{"Receipts", blockReceiptsPrefix, 1 + 8 + common.HashLength},
+	{"Transaction lookups", lookupPrefix, 1 + common.HashLength},
+	{"Bloom bits", bloomBitsPrefix, 1 + 2 + 8 + common.HashLength},
+	{"Trie preimages", []byte(preimagePrefix), len(preimagePrefix) + common.HashLength},
+	{"Snapshot accounts", []byte("a"), 1 + common.HashLength},
+	{"Snapshot storage", []byte("o"), 1 + 2*common.HashLength},
+	{"Snap sync accounts", []byte("snap-sync-account-"), 0},
+	{"Bloom bits index", []byte("bloomIndex-"), 0},
+	{"CHT index", []byte("chtIndex-"), 0},
+	{"Bloom trie index", []byte("bltIndex-"), 0},
+	{"CHT roots", []byte("cht"), 3 + 8},
+	{"Bloom trie roots", []byte("bltRoot-"), 0},
+	{"Mipmap blooms", mipmapPre, 0},
+	{"Chain configs", configPrefix, 0},
+	{"Legacy receipts", oldReceiptsPrefix, 0},
+	{"Trie nodes and code", nil, common.HashLength},
+}
+
+// inspectMetadataKeys lists the known singleton keys holding chain metadata.
+var inspectMetadataKeys = [][]byte{
+	headHeaderKey, headBlockKey, headFastKey, txIndexTailKey, []byte("BlockchainVersion"),
+	databaseVersionKey, databaseMigrationKey, legacyDeduplicateKey, legacyMipmapKey,
+	[]byte("SnapshotRoot"), []byte("SnapshotGenerator"), []byte("TrieJournal"),
+	[]byte("TrustedCHT"), []byte("TrustedBloomTrie"), []byte("SkeletonSyncStatus"),
+	[]byte("_requestCostStats"),
+}
+
+// InspectDatabase iterates over the entire database, accumulating the number and
+// size of the entries in each known key namespace. If an ancient store is
+// attached, the sizes of its tables are reported too.
+func InspectDatabase(db ethdb.Database) ([]DatabaseStat, error) {
+	stats := make([]DatabaseStat, len(inspectCategories))
+	for i, category := range inspectCategories {
+		stats[i] = DatabaseStat{Database: "Key-Value store", Category: category.name}
+	}
+	var (
+		metadata = DatabaseStat{Database: "Key-Value store", Category: "Metadata"}
+		unknown  = DatabaseStat{Database: "Key-Value store", Category: "Unaccounted"}
+		start    = time.Now()
+		logged   = time.Now()
+		count    uint64
+	)
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+
+	for it.Next() {
+		key, size := it.Key(), common.StorageSize(len(it.Key())+len(it.Value()))
+
+		stat := &unknown
+		for i, category := range inspectCategories {
+			if bytes.HasPrefix(key, category.prefix) && (category.length == 0 || len(key) == category.length) {
+				stat = &stats[i]
+				break
+			}
+		}
+		if stat == &unknown {
+			for _, meta := range inspectMetadataKeys {
+				if bytes.Equal(key, meta) {
+					stat = &metadata
+					break
+				}
+			}
+		}
+		stat.Items++
+		stat.Size += size
+
+		if count++; count%1000 == 0 && time.Since(logged) > 8*time.Second {
+			log.Info("Inspecting database", "count", count, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	stats = append(stats, metadata, unknown)
+
+	// Report the ancient tables if the chain data is partially frozen
+	if store := ancientStore(db); store != nil {
+		frozen, err := store.Ancients()
+		if err != nil {
+			return nil, err
+		}
+		for _, table := range []struct{ kind, name string }{
+			{ethdb.FreezerHeaderTable, "Headers"},
+			{ethdb.FreezerBodiesTable, "Bodies"},
+			{ethdb.FreezerReceiptTable, "Receipts"},
+			{ethdb.FreezerDifficultyTable, "Total difficulties"},
+			{ethdb.FreezerHashTable, "Canonical hashes"},
+		} {
+			size, err := store.AncientSize(table.kind)
+			if err != nil {
+				return nil, err
+			}
+			stats = append(stats, DatabaseStat{Database: "Ancient store", Category: table.name, Items: frozen, Size: common.StorageSize(size)})
+		}
+	}
+	log.Info("Inspected database", "count", count, "elapsed", common.PrettyDuration(time.Since(start)))
+	return stats, nil
+}
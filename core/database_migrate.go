@@ -0,0 +1,213 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var (
+	databaseVersionKey   = []byte("DatabaseVersion")   // databaseVersionKey -> schema version (uint64 big endian)
+	databaseMigrationKey = []byte("DatabaseMigration") // databaseMigrationKey -> progress of the running migration
+
+	// used by the ad-hoc upgrades predating the migrations, now only checked to
+	// skip already performed conversions
+	legacyDeduplicateKey = []byte("dbUpgrade_20170714deduplicateData")
+	legacyMipmapKey      = []byte("setting-mipmap-version")
+)
+
+// migrationProgress is the persisted state of an interrupted migration. The
+// marker is only meaningful to the migration producing the given version.
+type migrationProgress struct {
+	Version uint64
+	Marker  []byte
+}
+
+// databaseMigration is a single upgrade step of the database schema. Migrations
+// must be idempotent: progress is only persisted at checkpoints, so any work
+// done after the last one is repeated if the node goes down midway.
+type databaseMigration struct {
+	name    string
+	migrate func(db ethdb.Database, marker []byte, checkpoint func(marker []byte) error) error
+}
+
+// databaseMigrations is the ordered list of upgrade steps. The schema version of
+// a database is the number of migrations already applied to it, so new steps
+// must only ever be appended to the end.
+var databaseMigrations = []databaseMigration{
+	{"Deduplicate transaction data", migrateDeduplicateData},
+	{"Delete legacy mipmap log blooms", migrateDeleteMipmapBlooms},
+}
+
+// DatabaseVersion is the schema version of a fully migrated database.
+var DatabaseVersion = uint64(len(databaseMigrations))
+
+// GetDatabaseVersion retrieves the schema version of the database, or nil if
+// it was never recorded.
+func GetDatabaseVersion(db ethdb.Database) *uint64 {
+	data, _ := db.Get(databaseVersionKey)
+	if len(data) != 8 {
+		return nil
+	}
+	version := binary.BigEndian.Uint64(data)
+	return &version
+}
+
+// WriteDatabaseVersion stores the schema version of the database.
+func WriteDatabaseVersion(db ethdb.Database, version uint64) error {
+	if err := db.Put(databaseVersionKey, encodeBlockNumber(version)); err != nil {
+		log.Crit("Failed to store database version", "err", err)
+	}
+	return nil
+}
+
+// MigrateDatabase brings the schema of the database up to date, running all the
+// pending migrations in order. Interrupted migrations are resumed from their
+// last checkpoint. Fresh databases are marked as up to date right away.
+//
+// Each migration is finished by a single write of the bumped version, so the
+// database never ends up in between two schema versions.
+func MigrateDatabase(db ethdb.Database) error {
+	version := GetDatabaseVersion(db)
+	if version == nil {
+		if data, _ := db.Get(headHeaderKey); len(data) == 0 {
+			return WriteDatabaseVersion(db, DatabaseVersion)
+		}
+		version = new(uint64)
+	}
+	if *version > DatabaseVersion {
+		return fmt.Errorf("database schema version %d newer than supported %d", *version, DatabaseVersion)
+	}
+	for next := *version + 1; next <= DatabaseVersion; next++ {
+		var (
+			migration = databaseMigrations[next-1]
+			progress  migrationProgress
+			start     = time.Now()
+			logged    = time.Now()
+		)
+		// Resume from the last checkpoint if it belongs to this migration
+		if data, _ := db.Get(databaseMigrationKey); len(data) > 0 {
+			if err := rlp.DecodeBytes(data, &progress); err != nil || progress.Version != next {
+				progress = migrationProgress{}
+			}
+		}
+		if progress.Marker != nil {
+			log.Warn("Resuming database migration", "version", next, "name", migration.name)
+		} else {
+			log.Warn("Migrating database", "version", next, "name", migration.name)
+		}
+		checkpoint := func(marker []byte) error {
+			enc, err := rlp.EncodeToBytes(migrationProgress{Version: next, Marker: marker})
+			if err != nil {
+				return err
+			}
+			if err := db.Put(databaseMigrationKey, enc); err != nil {
+				return err
+			}
+			if time.Since(logged) > 8*time.Second {
+				log.Info("Migrating database", "version", next, "marker", fmt.Sprintf("%x", marker), "elapsed", common.PrettyDuration(time.Since(start)))
+				logged = time.Now()
+			}
+			return nil
+		}
+		if err := migration.migrate(db, progress.Marker, checkpoint); err != nil {
+			return fmt.Errorf("database migration %d (%s) failed: %v", next, migration.name, err)
+		}
+		WriteDatabaseVersion(db, next)
+		db.Delete(databaseMigrationKey)
+
+		log.Info("Database migration completed", "version", next, "name", migration.name, "elapsed", common.PrettyDuration(time.Since(start)))
+	}
+	return nil
+}
+
+// migrateDeduplicateData converts the old transaction metadata entries (<hash>0x01)
+// into lookup entries, deleting the duplicate transaction and receipt data. The
+// marker is the last converted key. The old metadata is deleted last, so a
+// partially converted entry is simply converted again.
+func migrateDeduplicateData(db ethdb.Database, marker []byte, checkpoint func([]byte) error) error {
+	if data, _ := db.Get(legacyDeduplicateKey); len(data) > 0 && data[0] == 42 {
+		return nil
+	}
+	it := db.NewIterator(nil, marker)
+	defer it.Release()
+
+	var converted uint64
+	for it.Next() {
+		// Skip any entries that don't look like old transaction meta entries (<hash>0x01)
+		key := it.Key()
+		if len(key) != common.HashLength+1 || key[common.HashLength] != oldTxMetaSuffix[0] {
+			continue
+		}
+		// Skip any entries that don't contain metadata (name clash between <hash>0x01 and <some-prefix><hash>)
+		var meta txLookupEntry
+		if err := rlp.DecodeBytes(it.Value(), &meta); err != nil {
+			continue
+		}
+		// Skip any already upgraded entries (clash due to <hash> ending with 0x01 (old suffix))
+		hash := common.CopyBytes(key[:common.HashLength])
+		if bytes.HasPrefix(hash, lookupPrefix) {
+			// Potential clash, the "old" `hash` must point to a live transaction.
+			if tx, _, _, _ := GetTransaction(db, common.BytesToHash(hash)); tx == nil || !bytes.Equal(tx.Hash().Bytes(), hash) {
+				continue
+			}
+		}
+		// Convert the old metadata to a new lookup entry, delete duplicate data
+		if err := db.Put(append(append([]byte{}, lookupPrefix...), hash...), it.Value()); err != nil {
+			return err
+		}
+		if err := db.Delete(hash); err != nil {
+			return err
+		}
+		if err := db.Delete(append(append([]byte{}, oldReceiptsPrefix...), hash...)); err != nil {
+			return err
+		}
+		if err := db.Delete(key); err != nil {
+			return err
+		}
+		if converted++; converted%100000 == 0 {
+			if err := checkpoint(key); err != nil {
+				return err
+			}
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	log.Info("Deduplicated database entries", "deduped", converted)
+	return nil
+}
+
+// migrateDeleteMipmapBlooms deletes the mipmap log blooms generated by earlier
+// releases, which were superseded by the bloom bits index. Deletions can't be
+// undone by an interruption, so the migration simply starts over without a marker.
+func migrateDeleteMipmapBlooms(db ethdb.Database, marker []byte, checkpoint func([]byte) error) error {
+	r := util.BytesPrefix(mipmapPre)
+	if err := db.DeleteRange(r.Start, r.Limit); err != nil {
+		return err
+	}
+	return db.Delete(legacyMipmapKey)
+}
@@ -0,0 +1,144 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Tests that fresh databases are marked as up to date without migrating, and
+// that databases from the future are rejected.
+func TestMigrateFreshDatabase(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	if err := MigrateDatabase(db); err != nil {
+		t.Fatalf("failed to migrate fresh database: %v", err)
+	}
+	if version := GetDatabaseVersion(db); version == nil || *version != DatabaseVersion {
+		t.Fatalf("database version mismatch: have %v, want %d", version, DatabaseVersion)
+	}
+	WriteDatabaseVersion(db, DatabaseVersion+1)
+	if err := MigrateDatabase(db); err == nil {
+		t.Fatalf("newer database schema accepted")
+	}
+}
+
+// Tests that interrupted migrations resume from their last checkpoint and that
+// the database version is only bumped when a migration completes.
+func TestMigrateDatabaseResume(t *testing.T) {
+	defer func(migrations []databaseMigration, version uint64) {
+		databaseMigrations, DatabaseVersion = migrations, version
+	}(databaseMigrations, DatabaseVersion)
+
+	var (
+		fail    = true
+		markers [][]byte
+	)
+	databaseMigrations = []databaseMigration{
+		{"first", func(db ethdb.Database, marker []byte, checkpoint func([]byte) error) error {
+			return nil
+		}},
+		{"second", func(db ethdb.Database, marker []byte, checkpoint func([]byte) error) error {
+			markers = append(markers, marker)
+			if fail {
+				checkpoint([]byte{0x01})
+				return errors.New("interrupted")
+			}
+			return nil
+		}},
+	}
+	DatabaseVersion = uint64(len(databaseMigrations))
+
+	db, _ := ethdb.NewMemDatabase()
+	WriteHeadHeaderHash(db, common.Hash{0x01})
+
+	if err := MigrateDatabase(db); err == nil {
+		t.Fatalf("interrupted migration succeeded")
+	}
+	if version := GetDatabaseVersion(db); version == nil || *version != 1 {
+		t.Fatalf("database version mismatch after interruption: have %v, want 1", version)
+	}
+	fail = false
+	if err := MigrateDatabase(db); err != nil {
+		t.Fatalf("failed to resume migration: %v", err)
+	}
+	if version := GetDatabaseVersion(db); version == nil || *version != 2 {
+		t.Fatalf("database version mismatch after completion: have %v, want 2", version)
+	}
+	if len(markers) != 2 || markers[0] != nil || string(markers[1]) != "\x01" {
+		t.Fatalf("resume markers mismatch: have %x, want [nil 01]", markers)
+	}
+	if data, _ := db.Get(databaseMigrationKey); len(data) != 0 {
+		t.Fatalf("migration progress not cleaned up")
+	}
+}
+
+// Tests that old transaction metadata entries are converted into lookup entries.
+func TestMigrateDeduplicateData(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+
+	tx := types.NewTransaction(1, common.BytesToAddress([]byte{0x11}), big.NewInt(111), big.NewInt(1111), big.NewInt(11111), []byte{0x11, 0x11, 0x11})
+	meta, _ := rlp.EncodeToBytes(txLookupEntry{BlockHash: common.Hash{0x02}, BlockIndex: 2, Index: 0})
+	hash := tx.Hash().Bytes()
+
+	db.Put(append(common.CopyBytes(hash), oldTxMetaSuffix...), meta)
+	db.Put(hash, []byte{0xde, 0xad})
+	db.Put(append(common.CopyBytes(oldReceiptsPrefix), hash...), []byte{0xbe, 0xef})
+
+	if err := migrateDeduplicateData(db, nil, func([]byte) error { return nil }); err != nil {
+		t.Fatalf("failed to deduplicate data: %v", err)
+	}
+	if hash, number, index := GetTxLookupEntry(db, tx.Hash()); hash != (common.Hash{0x02}) || number != 2 || index != 0 {
+		t.Errorf("lookup entry mismatch: have %x/%d/%d", hash, number, index)
+	}
+	for _, key := range [][]byte{append(common.CopyBytes(hash), oldTxMetaSuffix...), hash, append(common.CopyBytes(oldReceiptsPrefix), hash...)} {
+		if ok, _ := db.Has(key); ok {
+			t.Errorf("duplicate data %x not deleted", key)
+		}
+	}
+}
+
+// Tests that the legacy mipmap blooms are deleted, leaving other data intact.
+func TestMigrateDeleteMipmapBlooms(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+
+	enc, _ := rlp.EncodeToBytes(uint(2))
+	db.Put(legacyMipmapKey, enc)
+	for i := uint64(0); i < 16; i++ {
+		db.Put(append(append([]byte{}, mipmapPre...), encodeBlockNumber(i)...), []byte{0x01})
+	}
+	db.Put([]byte("mipmap-other"), []byte{0x02})
+
+	if err := migrateDeleteMipmapBlooms(db, nil, func([]byte) error { return nil }); err != nil {
+		t.Fatalf("failed to delete mipmap blooms: %v", err)
+	}
+	for _, key := range db.Keys() {
+		if bytes.HasPrefix(key, mipmapPre) || bytes.Equal(key, legacyMipmapKey) {
+			t.Errorf("legacy mipmap entry %q not deleted", key)
+		}
+	}
+	if ok, _ := db.Has([]byte("mipmap-other")); !ok {
+		t.Errorf("unrelated entry deleted")
+	}
+}
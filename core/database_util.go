@@ -23,7 +23,6 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
-	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -35,9 +34,10 @@ import (
 )
 
 var (
-	headHeaderKey = []byte("LastHeader")
-	headBlockKey  = []byte("LastBlock")
-	headFastKey   = []byte("LastFast")
+	headHeaderKey  = []byte("LastHeader")
+	headBlockKey   = []byte("LastBlock")
+	headFastKey    = []byte("LastFast")
+	txIndexTailKey = []byte("TransactionIndexTail")
 
 	headerPrefix        = []byte("h")   // headerPrefix + num (uint64 big endian) + hash -> header
 	tdSuffix            = []byte("t")   // headerPrefix + num (uint64 big endian) + hash + tdSuffix -> td
@@ -46,21 +46,18 @@ var (
 	bodyPrefix          = []byte("b")   // bodyPrefix + num (uint64 big endian) + hash -> block body
 	blockReceiptsPrefix = []byte("r")   // blockReceiptsPrefix + num (uint64 big endian) + hash -> block receipts
 	lookupPrefix        = []byte("l")   // lookupPrefix + hash -> transaction/receipt lookup metadata
+	bloomBitsPrefix     = []byte("B")   // bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) + hash -> bloom bits
 	preimagePrefix      = "secure-key-" // preimagePrefix + hash -> preimage
 
-	mipmapPre    = []byte("mipmap-log-bloom-")
-	MIPMapLevels = []uint64{1000000, 500000, 100000, 50000, 1000}
-
 	configPrefix = []byte("ethereum-config-") // config prefix for the db
 
 	// used by old db, now only used for conversion
 	oldReceiptsPrefix = []byte("receipts-")
 	oldTxMetaSuffix   = []byte{0x01}
+	mipmapPre         = []byte("mipmap-log-bloom-")
 
 	ErrChainConfigNotFound = errors.New("ChainConfig not found") // general config not found error
 
-	mipmapBloomMu sync.Mutex // protect against race condition when updating mipmap blooms
-
 	preimageCounter    = metrics.NewCounter("db/preimage/total")
 	preimageHitCounter = metrics.NewCounter("db/preimage/hits")
 )
@@ -84,11 +81,43 @@ func encodeBlockNumber(number uint64) []byte {
 func GetCanonicalHash(db ethdb.Database, number uint64) common.Hash {
 	data, _ := db.Get(append(append(headerPrefix, encodeBlockNumber(number)...), numSuffix...))
 	if len(data) == 0 {
-		return common.Hash{}
+		if store := ancientStore(db); store != nil {
+			data, _ = store.Ancient(ethdb.FreezerHashTable, number)
+		}
+		if len(data) == 0 {
+			return common.Hash{}
+		}
 	}
 	return common.BytesToHash(data)
 }
 
+// ancientStore returns the ancient store backing the database, or nil if there
+// is no freezer attached to it.
+func ancientStore(db ethdb.Database) ethdb.AncientStore {
+	store, ok := db.(ethdb.AncientStore)
+	if !ok {
+		return nil
+	}
+	if _, err := store.Ancients(); err != nil {
+		return nil
+	}
+	return store
+}
+
+// getAncient retrieves the frozen data of the given kind belonging to a block,
+// or nil if the block is not frozen or not the canonical one at its height.
+func getAncient(db ethdb.Database, kind string, hash common.Hash, number uint64) []byte {
+	store := ancientStore(db)
+	if store == nil {
+		return nil
+	}
+	if data, _ := store.Ancient(ethdb.FreezerHashTable, number); !bytes.Equal(data, hash[:]) {
+		return nil
+	}
+	data, _ := store.Ancient(kind, number)
+	return data
+}
+
 // missingNumber is returned by GetBlockNumber if no header with the
 // given block hash has been stored in the database
 const missingNumber = uint64(0xffffffffffffffff)
@@ -141,6 +170,9 @@ func GetHeadFastBlockHash(db ethdb.Database) common.Hash {
 // if the header's not found.
 func GetHeaderRLP(db ethdb.Database, hash common.Hash, number uint64) rlp.RawValue {
 	data, _ := db.Get(append(append(headerPrefix, encodeBlockNumber(number)...), hash.Bytes()...))
+	if len(data) == 0 {
+		data = getAncient(db, ethdb.FreezerHeaderTable, hash, number)
+	}
 	return data
 }
 
@@ -162,6 +194,9 @@ func GetHeader(db ethdb.Database, hash common.Hash, number uint64) *types.Header
 // GetBodyRLP retrieves the block body (transactions and uncles) in RLP encoding.
 func GetBodyRLP(db ethdb.Database, hash common.Hash, number uint64) rlp.RawValue {
 	data, _ := db.Get(append(append(bodyPrefix, encodeBlockNumber(number)...), hash.Bytes()...))
+	if len(data) == 0 {
+		data = getAncient(db, ethdb.FreezerBodiesTable, hash, number)
+	}
 	return data
 }
 
@@ -183,7 +218,7 @@ func GetBody(db ethdb.Database, hash common.Hash, number uint64) *types.Body {
 // GetTd retrieves a block's total difficulty corresponding to the hash, nil if
 // none found.
 func GetTd(db ethdb.Database, hash common.Hash, number uint64) *big.Int {
-	data, _ := db.Get(append(append(append(headerPrefix, encodeBlockNumber(number)...), hash[:]...), tdSuffix...))
+	data := getTdRLP(db, hash, number)
 	if len(data) == 0 {
 		return nil
 	}
@@ -195,6 +230,16 @@ func GetTd(db ethdb.Database, hash common.Hash, number uint64) *big.Int {
 	return td
 }
 
+// getTdRLP retrieves a block's total difficulty in its raw RLP database encoding,
+// or nil if it's not found.
+func getTdRLP(db ethdb.Database, hash common.Hash, number uint64) rlp.RawValue {
+	data, _ := db.Get(append(append(append(headerPrefix, encodeBlockNumber(number)...), hash[:]...), tdSuffix...))
+	if len(data) == 0 {
+		data = getAncient(db, ethdb.FreezerDifficultyTable, hash, number)
+	}
+	return data
+}
+
 // GetBlock retrieves an entire block corresponding to the hash, assembling it
 // back from the stored header and body. If either the header or body could not
 // be retrieved nil is returned.
@@ -218,7 +263,7 @@ func GetBlock(db ethdb.Database, hash common.Hash, number uint64) *types.Block {
 // GetBlockReceipts retrieves the receipts generated by the transactions included
 // in a block given by its hash.
 func GetBlockReceipts(db ethdb.Database, hash common.Hash, number uint64) types.Receipts {
-	data, _ := db.Get(append(append(blockReceiptsPrefix, encodeBlockNumber(number)...), hash[:]...))
+	data := getBlockReceiptsRLP(db, hash, number)
 	if len(data) == 0 {
 		return nil
 	}
@@ -234,6 +279,16 @@ func GetBlockReceipts(db ethdb.Database, hash common.Hash, number uint64) types.
 	return receipts
 }
 
+// getBlockReceiptsRLP retrieves the receipts of a block in their raw RLP storage
+// encoding, or nil if they're not found.
+func getBlockReceiptsRLP(db ethdb.Database, hash common.Hash, number uint64) rlp.RawValue {
+	data, _ := db.Get(append(append(blockReceiptsPrefix, encodeBlockNumber(number)...), hash[:]...))
+	if len(data) == 0 {
+		data = getAncient(db, ethdb.FreezerReceiptTable, hash, number)
+	}
+	return data
+}
+
 // GetTxLookupEntry retrieves the positional metadata associated with a transaction
 // hash to allow retrieving the transaction or receipt by hash.
 func GetTxLookupEntry(db ethdb.Database, hash common.Hash) (common.Hash, uint64, uint64) {
@@ -435,8 +490,19 @@ func WriteBlockReceipts(db ethdb.Database, hash common.Hash, number uint64, rece
 // a block, enabling hash based transaction and receipt lookups.
 func WriteTxLookupEntries(db ethdb.Database, block *types.Block) error {
 	batch := db.NewBatch()
+	if err := writeTxLookupEntries(batch, block); err != nil {
+		return err
+	}
+	// Write the scheduled data into the database
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to store lookup entries", "err", err)
+	}
+	return nil
+}
 
-	// Iterate over each transaction and encode its metadata
+// writeTxLookupEntries schedules the positional metadata of every transaction
+// from a block for writing into the given database or batch.
+func writeTxLookupEntries(db ethdb.Putter, block *types.Block) error {
 	for i, tx := range block.Transactions() {
 		entry := txLookupEntry{
 			BlockHash:  block.Hash(),
@@ -447,14 +513,10 @@ func WriteTxLookupEntries(db ethdb.Database, block *types.Block) error {
 		if err != nil {
 			return err
 		}
-		if err := batch.Put(append(lookupPrefix, tx.Hash().Bytes()...), data); err != nil {
+		if err := db.Put(append(lookupPrefix, tx.Hash().Bytes()...), data); err != nil {
 			return err
 		}
 	}
-	// Write the scheduled data into the database
-	if err := batch.Write(); err != nil {
-		log.Crit("Failed to store lookup entries", "err", err)
-	}
 	return nil
 }
 
@@ -492,51 +554,48 @@ func DeleteBlockReceipts(db ethdb.Database, hash common.Hash, number uint64) {
 	db.Delete(append(append(blockReceiptsPrefix, encodeBlockNumber(number)...), hash.Bytes()...))
 }
 
+// GetTxIndexTail retrieves the number of the oldest block whose transactions are
+// indexed by hash, or zero if the index was never limited.
+func GetTxIndexTail(db ethdb.Database) uint64 {
+	data, _ := db.Get(txIndexTailKey)
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// WriteTxIndexTail stores the number of the oldest block whose transactions are
+// indexed by hash.
+func WriteTxIndexTail(db ethdb.Putter, number uint64) error {
+	return db.Put(txIndexTailKey, encodeBlockNumber(number))
+}
+
 // DeleteTxLookupEntry removes all transaction data associated with a hash.
 func DeleteTxLookupEntry(db ethdb.Database, hash common.Hash) {
 	db.Delete(append(lookupPrefix, hash.Bytes()...))
 }
 
-// returns a formatted MIP mapped key by adding prefix, canonical number and level
-//
-// ex. fn(98, 1000) = (prefix || 1000 || 0)
-func mipmapKey(num, level uint64) []byte {
-	lkey := make([]byte, 8)
-	binary.BigEndian.PutUint64(lkey, level)
-	key := new(big.Int).SetUint64(num / level * level)
+// bloomBitsKey returns the database key of the bloom bit vector belonging to the
+// given bit index and section with the given section head hash.
+func bloomBitsKey(bit uint, section uint64, head common.Hash) []byte {
+	key := append(append(bloomBitsPrefix, make([]byte, 10)...), head.Bytes()...)
 
-	return append(mipmapPre, append(lkey, key.Bytes()...)...)
-}
+	binary.BigEndian.PutUint16(key[1:], uint16(bit))
+	binary.BigEndian.PutUint64(key[3:], section)
 
-// WriteMipmapBloom writes each address included in the receipts' logs to the
-// MIP bloom bin.
-func WriteMipmapBloom(db ethdb.Database, number uint64, receipts types.Receipts) error {
-	mipmapBloomMu.Lock()
-	defer mipmapBloomMu.Unlock()
+	return key
+}
 
-	batch := db.NewBatch()
-	for _, level := range MIPMapLevels {
-		key := mipmapKey(number, level)
-		bloomDat, _ := db.Get(key)
-		bloom := types.BytesToBloom(bloomDat)
-		for _, receipt := range receipts {
-			for _, log := range receipt.Logs {
-				bloom.Add(log.Address.Big())
-			}
-		}
-		batch.Put(key, bloom.Bytes())
-	}
-	if err := batch.Write(); err != nil {
-		return fmt.Errorf("mipmap write fail for: %d: %v", number, err)
-	}
-	return nil
+// GetBloomBits retrieves the compressed bit vector of the given bloom bit for a
+// section of the canonical chain, identified by the hash of its last header.
+func GetBloomBits(db ethdb.Database, bit uint, section uint64, head common.Hash) ([]byte, error) {
+	return db.Get(bloomBitsKey(bit, section, head))
 }
 
-// GetMipmapBloom returns a bloom filter using the number and level as input
-// parameters. For available levels see MIPMapLevels.
-func GetMipmapBloom(db ethdb.Database, number, level uint64) types.Bloom {
-	bloomDat, _ := db.Get(mipmapKey(number, level))
-	return types.BytesToBloom(bloomDat)
+// WriteBloomBits stores the compressed bit vector of the given bloom bit for a
+// section of the canonical chain, identified by the hash of its last header.
+func WriteBloomBits(db ethdb.Putter, bit uint, section uint64, head common.Hash, bits []byte) error {
+	return db.Put(bloomBitsKey(bit, section, head), bits)
 }
 
 // PreimageTable returns a Database instance with the key prefix for preimage entries.
@@ -551,7 +610,7 @@ func WritePreimages(db ethdb.Database, number uint64, preimages map[common.Hash]
 	batch := table.NewBatch()
 	hitCount := 0
 	for hash, preimage := range preimages {
-		if _, err := table.Get(hash.Bytes()); err != nil {
+		if ok, _ := table.Has(hash.Bytes()); !ok {
 			batch.Put(hash.Bytes(), preimage)
 			hitCount++
 		}
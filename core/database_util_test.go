@@ -18,9 +18,7 @@ package core
 
 import (
 	"bytes"
-	"io/ioutil"
 	"math/big"
-	"os"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -28,7 +26,6 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/crypto/sha3"
 	"github.com/ethereum/go-ethereum/ethdb"
-	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 )
 
@@ -391,106 +388,63 @@ func TestBlockReceiptStorage(t *testing.T) {
 	}
 }
 
-func TestMipmapBloom(t *testing.T) {
+// Tests that bloom bit vectors are stored per bit, section and section head.
+func TestBloomBitsStorage(t *testing.T) {
 	db, _ := ethdb.NewMemDatabase()
 
-	receipt1 := new(types.Receipt)
-	receipt1.Logs = []*types.Log{
-		{Address: common.BytesToAddress([]byte("test"))},
-		{Address: common.BytesToAddress([]byte("address"))},
+	head1, head2 := common.Hash{0x01}, common.Hash{0x02}
+	if err := WriteBloomBits(db, 7, 3, head1, []byte("bits")); err != nil {
+		t.Fatalf("failed to write bloom bits: %v", err)
 	}
-	receipt2 := new(types.Receipt)
-	receipt2.Logs = []*types.Log{
-		{Address: common.BytesToAddress([]byte("test"))},
-		{Address: common.BytesToAddress([]byte("address1"))},
+	if bits, err := GetBloomBits(db, 7, 3, head1); err != nil || !bytes.Equal(bits, []byte("bits")) {
+		t.Errorf("stored bloom bits mismatch: have %q/%v, want %q", bits, err, "bits")
 	}
-
-	WriteMipmapBloom(db, 1, types.Receipts{receipt1})
-	WriteMipmapBloom(db, 2, types.Receipts{receipt2})
-
-	for _, level := range MIPMapLevels {
-		bloom := GetMipmapBloom(db, 2, level)
-		if !bloom.Test(new(big.Int).SetBytes([]byte("address1"))) {
-			t.Error("expected test to be included on level:", level)
-		}
-	}
-
-	// reset
-	db, _ = ethdb.NewMemDatabase()
-	receipt := new(types.Receipt)
-	receipt.Logs = []*types.Log{
-		{Address: common.BytesToAddress([]byte("test"))},
+	// Different bits, sections or section heads must not be found
+	if _, err := GetBloomBits(db, 8, 3, head1); err == nil {
+		t.Errorf("bloom bits found for different bit")
 	}
-	WriteMipmapBloom(db, 999, types.Receipts{receipt1})
-
-	receipt = new(types.Receipt)
-	receipt.Logs = []*types.Log{
-		{Address: common.BytesToAddress([]byte("test 1"))},
+	if _, err := GetBloomBits(db, 7, 4, head1); err == nil {
+		t.Errorf("bloom bits found for different section")
 	}
-	WriteMipmapBloom(db, 1000, types.Receipts{receipt})
-
-	bloom := GetMipmapBloom(db, 1000, 1000)
-	if bloom.TestBytes([]byte("test")) {
-		t.Error("test should not have been included")
+	if _, err := GetBloomBits(db, 7, 3, head2); err == nil {
+		t.Errorf("bloom bits found for different section head")
 	}
 }
 
-func TestMipmapChain(t *testing.T) {
-	dir, err := ioutil.TempDir("", "mipmap")
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer os.RemoveAll(dir)
-
-	var (
-		db, _   = ethdb.NewLDBDatabase(dir, 0, 0)
-		key1, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
-		addr    = crypto.PubkeyToAddress(key1.PublicKey)
-		addr2   = common.BytesToAddress([]byte("jeff"))
-
-		hash1 = common.BytesToHash([]byte("topic1"))
-	)
-	defer db.Close()
-
-	gspec := &Genesis{
-		Config: params.TestChainConfig,
-		Alloc:  GenesisAlloc{addr: {Balance: big.NewInt(1000000)}},
-	}
-	genesis := gspec.MustCommit(db)
-	chain, receipts := GenerateChain(params.TestChainConfig, genesis, db, 1010, func(i int, gen *BlockGen) {
-		var receipts types.Receipts
-		switch i {
-		case 1:
-			receipt := types.NewReceipt(nil, new(big.Int))
-			receipt.Logs = []*types.Log{{Address: addr, Topics: []common.Hash{hash1}}}
-			gen.AddUncheckedReceipt(receipt)
-			receipts = types.Receipts{receipt}
-		case 1000:
-			receipt := types.NewReceipt(nil, new(big.Int))
-			receipt.Logs = []*types.Log{{Address: addr2}}
-			gen.AddUncheckedReceipt(receipt)
-			receipts = types.Receipts{receipt}
+// Tests that database inspection attributes the entries to the right categories.
+func TestInspectDatabase(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
 
-		}
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1), Extra: []byte("test block")})
+	WriteBlock(db, block)
+	WriteTd(db, block.Hash(), 1, big.NewInt(1))
+	WriteCanonicalHash(db, block.Hash(), 1)
+	WriteBlockReceipts(db, block.Hash(), 1, nil)
+	WriteHeadBlockHash(db, block.Hash())
+	db.Put(crypto.Keccak256([]byte("node")), []byte("node"))
+	db.Put([]byte("unknown"), []byte{0x01})
 
-		// store the receipts
-		WriteMipmapBloom(db, uint64(i+1), receipts)
-	})
-	for i, block := range chain {
-		WriteBlock(db, block)
-		if err := WriteCanonicalHash(db, block.Hash(), block.NumberU64()); err != nil {
-			t.Fatalf("failed to insert block number: %v", err)
-		}
-		if err := WriteHeadBlockHash(db, block.Hash()); err != nil {
-			t.Fatalf("failed to insert block number: %v", err)
+	stats, err := InspectDatabase(db)
+	if err != nil {
+		t.Fatalf("failed to inspect database: %v", err)
+	}
+	want := map[string]uint64{
+		"Headers":              1,
+		"Total difficulties":   1,
+		"Canonical hashes":     1,
+		"Block number lookups": 1,
+		"Bodies":               1,
+		"Receipts":             1,
+		"Trie nodes and code":  1,
+		"Metadata":             1,
+		"Unaccounted":          1,
+	}
+	for _, stat := range stats {
+		if stat.Items != want[stat.Category] {
+			t.Errorf("%s: item count mismatch: have %d, want %d", stat.Category, stat.Items, want[stat.Category])
 		}
-		if err := WriteBlockReceipts(db, block.Hash(), block.NumberU64(), receipts[i]); err != nil {
-			t.Fatal("error writing block receipts:", err)
+		if (stat.Items == 0) != (stat.Size == 0) {
+			t.Errorf("%s: size mismatch: have %v for %d items", stat.Category, stat.Size, stat.Items)
 		}
 	}
-
-	bloom := GetMipmapBloom(db, 0, 1000)
-	if bloom.TestBytes(addr2[:]) {
-		t.Error("address was included in bloom and should not have")
-	}
 }
@@ -153,36 +153,7 @@ func (hc *HeaderChain) WriteHeader(header *types.Header) (status WriteStatus, er
 	// Second clause in the if statement reduces the vulnerability to selfish mining.
 	// Please refer to http://www.cs.cornell.edu/~ie53/publications/btcProcFC.pdf
 	if externTd.Cmp(localTd) > 0 || (externTd.Cmp(localTd) == 0 && mrand.Float64() < 0.5) {
-		// Delete any canonical number assignments above the new head
-		for i := number + 1; ; i++ {
-			hash := GetCanonicalHash(hc.chainDb, i)
-			if hash == (common.Hash{}) {
-				break
-			}
-			DeleteCanonicalHash(hc.chainDb, i)
-		}
-		// Overwrite any stale canonical number assignments
-		var (
-			headHash   = header.ParentHash
-			headNumber = header.Number.Uint64() - 1
-			headHeader = hc.GetHeader(headHash, headNumber)
-		)
-		for GetCanonicalHash(hc.chainDb, headNumber) != headHash {
-			WriteCanonicalHash(hc.chainDb, headHash, headNumber)
-
-			headHash = headHeader.ParentHash
-			headNumber = headHeader.Number.Uint64() - 1
-			headHeader = hc.GetHeader(headHash, headNumber)
-		}
-		// Extend the canonical chain with the new header
-		if err := WriteCanonicalHash(hc.chainDb, hash, number); err != nil {
-			log.Crit("Failed to insert header number", "err", err)
-		}
-		if err := WriteHeadHeaderHash(hc.chainDb, hash); err != nil {
-			log.Crit("Failed to insert head header hash", "err", err)
-		}
-		hc.currentHeaderHash, hc.currentHeader = hash, types.CopyHeader(header)
-
+		hc.setCanonicalHead(header)
 		status = CanonStatTy
 	} else {
 		status = SideStatTy
@@ -194,6 +165,44 @@ func (hc *HeaderChain) WriteHeader(header *types.Header) (status WriteStatus, er
 	return
 }
 
+// setCanonicalHead makes a header, whose ancestors are all stored in the
+// database, the head of the canonical chain.
+func (hc *HeaderChain) setCanonicalHead(header *types.Header) {
+	var (
+		hash   = header.Hash()
+		number = header.Number.Uint64()
+	)
+	// Delete any canonical number assignments above the new head
+	for i := number + 1; ; i++ {
+		hash := GetCanonicalHash(hc.chainDb, i)
+		if hash == (common.Hash{}) {
+			break
+		}
+		DeleteCanonicalHash(hc.chainDb, i)
+	}
+	// Overwrite any stale canonical number assignments
+	var (
+		headHash   = header.ParentHash
+		headNumber = header.Number.Uint64() - 1
+		headHeader = hc.GetHeader(headHash, headNumber)
+	)
+	for GetCanonicalHash(hc.chainDb, headNumber) != headHash {
+		WriteCanonicalHash(hc.chainDb, headHash, headNumber)
+
+		headHash = headHeader.ParentHash
+		headNumber = headHeader.Number.Uint64() - 1
+		headHeader = hc.GetHeader(headHash, headNumber)
+	}
+	// Extend the canonical chain with the new header
+	if err := WriteCanonicalHash(hc.chainDb, hash, number); err != nil {
+		log.Crit("Failed to insert header number", "err", err)
+	}
+	if err := WriteHeadHeaderHash(hc.chainDb, hash); err != nil {
+		log.Crit("Failed to insert head header hash", "err", err)
+	}
+	hc.currentHeaderHash, hc.currentHeader = hash, types.CopyHeader(header)
+}
+
 // WhCallback is a callback function for inserting individual headers.
 // A callback is used for two reasons: first, in a LightChain, status should be
 // processed and light chain events sent, while in a BlockChain this is not
@@ -284,6 +293,60 @@ func (hc *HeaderChain) InsertHeaderChain(chain []*types.Header, writeHeader WhCa
 	return 0, nil
 }
 
+// InsertTrustedHeaders writes a batch of headers, ordered from a trusted block
+// towards the genesis, into the database without verifying them. The total
+// difficulty of the first header is given, the ones of its ancestors are derived
+// from it. Writing stops at the first header already in the canonical chain,
+// whose total difficulty must match the derived one.
+//
+// The returned number of headers written is less than the length of the batch
+// if and only if the trusted chain got linked to the canonical one.
+func (hc *HeaderChain) InsertTrustedHeaders(chain []*types.Header, td *big.Int) (int, error) {
+	td = new(big.Int).Set(td)
+	for i, header := range chain {
+		// Short circuit insertion if shutting down
+		if hc.procInterrupt() {
+			log.Debug("Premature abort during trusted headers import")
+			return i, errors.New("aborted")
+		}
+		hash, number := header.Hash(), header.Number.Uint64()
+		if i > 0 && chain[i-1].ParentHash != hash {
+			return i, fmt.Errorf("non contiguous insert: item %d is #%d [%x…], item %d is #%d [%x…] (parent [%x…])", i-1, chain[i-1].Number,
+				chain[i-1].Hash().Bytes()[:4], i, number, hash[:4], chain[i-1].ParentHash[:4])
+		}
+		// Stop at the first header already linked into the canonical chain
+		if GetCanonicalHash(hc.chainDb, number) == hash {
+			if local := hc.GetTd(hash, number); local == nil || local.Cmp(td) != 0 {
+				return i, fmt.Errorf("total difficulty mismatch at #%d [%x…]: have %v, want %v", number, hash[:4], td, local)
+			}
+			return i, nil
+		}
+		if number == 0 {
+			return i, fmt.Errorf("genesis mismatch: have [%x…], want [%x…]", hash[:4], hc.genesisHeader.Hash().Bytes()[:4])
+		}
+		if td.Cmp(header.Difficulty) <= 0 {
+			return i, fmt.Errorf("total difficulty underflow at #%d [%x…]", number, hash[:4])
+		}
+		if err := hc.WriteTd(hash, number, td); err != nil {
+			log.Crit("Failed to write header total difficulty", "err", err)
+		}
+		if err := WriteHeader(hc.chainDb, header); err != nil {
+			log.Crit("Failed to write header content", "err", err)
+		}
+		hc.headerCache.Add(hash, header)
+		hc.numberCache.Add(hash, number)
+
+		td.Sub(td, header.Difficulty)
+	}
+	return len(chain), nil
+}
+
+// SetTrustedHead makes a header previously written by InsertTrustedHeaders the
+// head of the canonical chain, once all of its ancestors are known.
+func (hc *HeaderChain) SetTrustedHead(head *types.Header) {
+	hc.setCanonicalHead(head)
+}
+
 // GetBlockHashesFromHash retrieves a number of block hashes starting at a given
 // hash, fetching towards the genesis block.
 func (hc *HeaderChain) GetBlockHashesFromHash(hash common.Hash, max uint64) []common.Hash {
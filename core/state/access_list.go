@@ -0,0 +1,54 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// accessList tracks the accounts and storage slots already accessed ("warm")
+// during the execution of the current transaction.
+type accessList map[common.Address]map[common.Hash]struct{}
+
+// containsAddress returns whether addr is in the access list.
+func (al accessList) containsAddress(addr common.Address) bool {
+	_, ok := al[addr]
+	return ok
+}
+
+// contains returns whether addr and its storage slot are in the access list.
+func (al accessList) contains(addr common.Address, slot common.Hash) (addressOk bool, slotOk bool) {
+	slots, ok := al[addr]
+	if !ok {
+		return false, false
+	}
+	_, slotOk = slots[slot]
+	return true, slotOk
+}
+
+// copy creates an independent copy of the access list.
+func (al accessList) copy() accessList {
+	cpy := make(accessList, len(al))
+	for addr, slots := range al {
+		cpySlots := make(map[common.Hash]struct{}, len(slots))
+		for slot := range slots {
+			cpySlots[slot] = struct{}{}
+		}
+		cpy[addr] = cpySlots
+	}
+	return cpy
+}
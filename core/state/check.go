@@ -0,0 +1,88 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// CheckReport summarizes the problems found while checking the consistency of
+// a state stored in a database.
+type CheckReport struct {
+	trie.CheckReport
+
+	Root        common.Hash   `json:"root"`        // State root that was checked
+	Accounts    int           `json:"accounts"`    // Number of accounts reached
+	Slots       int           `json:"slots"`       // Number of storage slots reached
+	MissingCode []common.Hash `json:"missingCode"` // Contract codes absent from the database
+	CorruptCode []common.Hash `json:"corruptCode"` // Contract codes not matching their hash
+}
+
+// Healthy reports whether no problems were found.
+func (r *CheckReport) Healthy() bool {
+	return len(r.Missing) == 0 && len(r.Corrupt) == 0 && len(r.MissingCode) == 0 && len(r.CorruptCode) == 0
+}
+
+// CheckState walks the entire state with the given root, verifying that all the
+// trie nodes and contract codes are present in the database and match their
+// hashes. Storage tries and codes shared by multiple accounts are checked once.
+func CheckState(db trie.DatabaseReader, root common.Hash) (*CheckReport, error) {
+	var (
+		report = &CheckReport{Root: root}
+		seen   = make(map[common.Hash]struct{})
+	)
+	countSlot := func([]byte) error {
+		report.Slots++
+		return nil
+	}
+	checkAccount := func(leaf []byte) error {
+		var account Account
+		if err := rlp.DecodeBytes(leaf, &account); err != nil {
+			return err
+		}
+		report.Accounts++
+
+		if _, ok := seen[account.Root]; !ok {
+			seen[account.Root] = struct{}{}
+			if err := trie.Check(account.Root, db, &report.CheckReport, countSlot); err != nil {
+				return err
+			}
+		}
+		codeHash := common.BytesToHash(account.CodeHash)
+		if _, ok := seen[codeHash]; !ok && !bytes.Equal(account.CodeHash, emptyCodeHash) {
+			seen[codeHash] = struct{}{}
+
+			code, _ := db.Get(account.CodeHash)
+			switch {
+			case len(code) == 0:
+				report.MissingCode = append(report.MissingCode, codeHash)
+			case crypto.Keccak256Hash(code) != codeHash:
+				report.CorruptCode = append(report.CorruptCode, codeHash)
+			}
+		}
+		return nil
+	}
+	if err := trie.Check(root, db, &report.CheckReport, checkAccount); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// Tests that the state checker finds missing and corrupt trie nodes and codes.
+func TestCheckState(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(db))
+
+	for i := byte(0); i < 32; i++ {
+		addr := common.BytesToAddress([]byte{i})
+		state.AddBalance(addr, big.NewInt(int64(i)+1))
+		state.SetState(addr, common.BytesToHash([]byte{i}), common.BytesToHash([]byte{1}))
+		state.SetState(addr, common.BytesToHash([]byte{i, 1}), common.BytesToHash([]byte{2}))
+	}
+	// Give a few accounts the same storage and code, which are checked once
+	for i := byte(32); i < 36; i++ {
+		addr := common.BytesToAddress([]byte{i})
+		state.SetState(addr, common.Hash{}, common.BytesToHash([]byte{3}))
+		state.SetCode(addr, []byte{i % 2})
+	}
+	root, _ := state.CommitTo(db, false)
+
+	report, err := CheckState(db, root)
+	if err != nil {
+		t.Fatalf("failed to check state: %v", err)
+	}
+	if !report.Healthy() {
+		t.Fatalf("healthy state reported inconsistent: %+v", report)
+	}
+	if report.Accounts != 36 || report.Slots != 65 {
+		t.Fatalf("item count mismatch: have %d accounts, %d slots, want 36 and 65", report.Accounts, report.Slots)
+	}
+	// Damage some storage tries and codes, and check they are reported
+	var (
+		missingRoot = state.GetOrNewStateObject(common.BytesToAddress([]byte{1})).data.Root
+		corruptRoot = state.GetOrNewStateObject(common.BytesToAddress([]byte{2})).data.Root
+		missingCode = crypto.Keccak256Hash([]byte{0})
+		corruptCode = crypto.Keccak256Hash([]byte{1})
+	)
+	db.Delete(missingRoot[:])
+	db.Put(corruptRoot[:], []byte{0xc0})
+	db.Delete(missingCode[:])
+	db.Put(corruptCode[:], []byte{0xff})
+
+	if report, err = CheckState(db, root); err != nil {
+		t.Fatalf("failed to check state: %v", err)
+	}
+	if report.Healthy() {
+		t.Fatalf("damaged state reported healthy")
+	}
+	if want := []common.Hash{missingRoot}; !reflect.DeepEqual(report.Missing, want) {
+		t.Errorf("missing nodes mismatch: have %x, want %x", report.Missing, want)
+	}
+	if want := []common.Hash{corruptRoot}; !reflect.DeepEqual(report.Corrupt, want) {
+		t.Errorf("corrupt nodes mismatch: have %x, want %x", report.Corrupt, want)
+	}
+	if want := []common.Hash{missingCode}; !reflect.DeepEqual(report.MissingCode, want) {
+		t.Errorf("missing codes mismatch: have %x, want %x", report.MissingCode, want)
+	}
+	if want := []common.Hash{corruptCode}; !reflect.DeepEqual(report.CorruptCode, want) {
+		t.Errorf("corrupt codes mismatch: have %x, want %x", report.CorruptCode, want)
+	}
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/trie"
 	lru "github.com/hashicorp/golang-lru"
 )
@@ -61,6 +62,9 @@ type Trie interface {
 	Hash() common.Hash
 	NodeIterator(startKey []byte) trie.NodeIterator
 	GetKey([]byte) []byte // TODO(fjl): remove this when SecureTrie is removed
+	// Prove writes the Merkle proof of the value at key into proofDb, see
+	// trie.Trie.Prove for details.
+	Prove(key []byte, fromLevel uint, proofDb trie.DatabaseWriter) error
 }
 
 // NewDatabase creates a backing store for state. The returned database is safe for
@@ -70,8 +74,32 @@ func NewDatabase(db ethdb.Database) Database {
 	return &cachingDB{db: db, codeSizeCache: csc}
 }
 
+// NewDatabaseWithTrieDB creates a backing store for state on top of a trie node
+// database, which keeps the committed tries in memory until they are flushed to
+// disk or garbage collected.
+func NewDatabaseWithTrieDB(triedb *trie.NodeDatabase) Database {
+	csc, _ := lru.New(codeSizeCacheSize)
+	return &cachingDB{db: triedb, codeSizeCache: csc}
+}
+
+// NewTrieDB creates a trie node database for state tries, which keeps the
+// storage tries of the cached accounts alive along with the account trie.
+func NewTrieDB(diskdb ethdb.Database) *trie.NodeDatabase {
+	return trie.NewNodeDatabase(diskdb, storageRoots)
+}
+
+// storageRoots resolves the storage trie root referenced from an account leaf
+// of the state trie.
+func storageRoots(leaf []byte) []common.Hash {
+	var account Account
+	if err := rlp.DecodeBytes(leaf, &account); err != nil || account.Root == emptyRoot {
+		return nil
+	}
+	return []common.Hash{account.Root}
+}
+
 type cachingDB struct {
-	db            ethdb.Database
+	db            trie.Database
 	mu            sync.Mutex
 	pastTries     []*trie.SecureTrie
 	codeSizeCache *lru.Cache
@@ -17,10 +17,12 @@
 package state
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/trie"
 )
@@ -79,3 +81,117 @@ func (self *StateDB) Dump() []byte {
 
 	return json
 }
+
+// dumpKey returns the hex preimage of a hashed trie key, or the hash itself if
+// the preimage is not known.
+func (self *StateDB) dumpKey(hash []byte) string {
+	if key := self.trie.GetKey(hash); key != nil {
+		return common.Bytes2Hex(key)
+	}
+	return common.Bytes2Hex(hash)
+}
+
+// IteratorDump is a single page of an iterative state dump. Accounts and storage
+// slots are keyed by their hex preimages if known, or by their hashes otherwise.
+// Next is the hashed key to resume the dump from, or empty if no more
+// accounts remain.
+type IteratorDump struct {
+	Root     string                 `json:"root"`
+	Accounts map[string]DumpAccount `json:"accounts"`
+	Next     hexutil.Bytes          `json:"next,omitempty"`
+}
+
+// IteratorDump dumps at most maxResults accounts (or all of them if maxResults
+// is not positive), in the order of their hashed keys, starting at the given
+// key. The storage of the accounts is left out if excludeStorage is set, as it
+// is unbounded in size. The flat state snapshot is used if available, falling
+// back to iterating the state trie otherwise.
+func (self *StateDB) IteratorDump(start []byte, maxResults int, excludeStorage bool) (IteratorDump, error) {
+	root := self.trie.Hash()
+	dump := IteratorDump{
+		Root:     fmt.Sprintf("%x", root),
+		Accounts: make(map[string]DumpAccount),
+	}
+	// add includes an account in the dump, returning whether the page is full
+	add := func(key []byte, blob []byte, storage func(hash common.Hash, data *Account) (map[string]string, error)) (bool, error) {
+		if maxResults > 0 && len(dump.Accounts) >= maxResults {
+			dump.Next = common.CopyBytes(key)
+			return true, nil
+		}
+		var data Account
+		if err := rlp.DecodeBytes(blob, &data); err != nil {
+			return false, err
+		}
+		hash := common.BytesToHash(key)
+		account := DumpAccount{
+			Balance:  data.Balance.String(),
+			Nonce:    data.Nonce,
+			Root:     common.Bytes2Hex(data.Root[:]),
+			CodeHash: common.Bytes2Hex(data.CodeHash),
+		}
+		if !bytes.Equal(data.CodeHash, emptyCodeHash) {
+			code, err := self.db.ContractCode(hash, common.BytesToHash(data.CodeHash))
+			if err != nil {
+				return false, err
+			}
+			account.Code = common.Bytes2Hex(code)
+		}
+		if !excludeStorage {
+			var err error
+			if account.Storage, err = storage(hash, &data); err != nil {
+				return false, err
+			}
+		}
+		dump.Accounts[self.dumpKey(key)] = account
+		return false, nil
+	}
+	var seek common.Hash
+	copy(seek[:], start)
+
+	// Iterate over the flat snapshot if it's available for the current state
+	if self.snap != nil && self.snap.Root() == root {
+		if it, err := self.snap.AccountIterator(seek); err == nil {
+			defer it.Release()
+
+			storage := func(hash common.Hash, data *Account) (map[string]string, error) {
+				it, err := self.snap.StorageIterator(hash, common.Hash{})
+				if err != nil {
+					return nil, err
+				}
+				defer it.Release()
+
+				slots := make(map[string]string)
+				for it.Next() {
+					slots[self.dumpKey(it.Hash().Bytes())] = common.Bytes2Hex(it.Value())
+				}
+				return slots, it.Error()
+			}
+			for it.Next() {
+				if full, err := add(it.Hash().Bytes(), it.Value(), storage); full || err != nil {
+					return dump, err
+				}
+			}
+			return dump, it.Error()
+		}
+	}
+	// No usable snapshot, iterate over the state trie
+	storage := func(hash common.Hash, data *Account) (map[string]string, error) {
+		tr, err := self.db.OpenStorageTrie(hash, data.Root)
+		if err != nil {
+			return nil, err
+		}
+		slots := make(map[string]string)
+		it := trie.NewIterator(tr.NodeIterator(nil))
+		for it.Next() {
+			slots[self.dumpKey(it.Key)] = common.Bytes2Hex(it.Value)
+		}
+		return slots, it.Err
+	}
+	it := trie.NewIterator(self.trie.NodeIterator(seek[:]))
+	for it.Next() {
+		if full, err := add(it.Key, it.Value, storage); full || err != nil {
+			return dump, err
+		}
+	}
+	return dump, it.Err
+}
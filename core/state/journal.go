@@ -75,6 +75,15 @@ type (
 		prev      bool
 		prevDirty bool
 	}
+
+	// Changes to the access list.
+	accessListAddAccountChange struct {
+		address *common.Address
+	}
+	accessListAddSlotChange struct {
+		address *common.Address
+		slot    *common.Hash
+	}
 )
 
 func (ch createObjectChange) undo(s *StateDB) {
@@ -142,3 +151,11 @@ func (ch addLogChange) undo(s *StateDB) {
 func (ch addPreimageChange) undo(s *StateDB) {
 	delete(s.preimages, ch.hash)
 }
+
+func (ch accessListAddAccountChange) undo(s *StateDB) {
+	delete(s.accessList, *ch.address)
+}
+
+func (ch accessListAddSlotChange) undo(s *StateDB) {
+	delete(s.accessList[*ch.address], *ch.slot)
+}
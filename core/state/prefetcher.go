@@ -0,0 +1,186 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// emptyRoot is the root hash of an empty trie.
+var emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+// triePrefetcher loads the trie nodes of the accounts and storage slots touched
+// during block processing in the background, so that they are already resolved
+// when the modified tries are hashed and committed. Every trie is prefetched by
+// a separate goroutine into its own copy, which is handed over to the state once
+// it's needed, stopping any further prefetching into it.
+//
+// The prefetcher is not safe for concurrent use, it's driven by its state.
+type triePrefetcher struct {
+	db       Database
+	fetchers map[common.Hash]*subfetcher // Subfetchers for each trie, keyed by root
+}
+
+// newTriePrefetcher creates a trie prefetcher on top of a state database.
+func newTriePrefetcher(db Database) *triePrefetcher {
+	return &triePrefetcher{
+		db:       db,
+		fetchers: make(map[common.Hash]*subfetcher),
+	}
+}
+
+// close aborts all the running subfetchers.
+func (p *triePrefetcher) close() {
+	for _, fetcher := range p.fetchers {
+		fetcher.abort()
+	}
+	p.fetchers = nil
+}
+
+// prefetch schedules a batch of keys to be loaded from the trie with the given
+// root. Storage tries are opened for the given account.
+func (p *triePrefetcher) prefetch(root common.Hash, account *common.Hash, keys [][]byte) {
+	if root == (common.Hash{}) || root == emptyRoot || len(keys) == 0 {
+		return
+	}
+	fetcher := p.fetchers[root]
+	if fetcher == nil {
+		fetcher = newSubfetcher(p.db, root, account)
+		p.fetchers[root] = fetcher
+	}
+	fetcher.schedule(keys)
+}
+
+// trie returns a copy of the trie with the given root containing all the nodes
+// prefetched so far, or nil if the trie is not being prefetched. Prefetching
+// into the trie stops.
+func (p *triePrefetcher) trie(root common.Hash) Trie {
+	fetcher := p.fetchers[root]
+	if fetcher == nil {
+		return nil
+	}
+	return fetcher.peek()
+}
+
+// subfetcher prefetches the nodes of a single trie in a background goroutine.
+type subfetcher struct {
+	db Database
+	tr Trie // Trie being populated, owned by the loop until it terminates
+
+	tasks [][]byte // Keys scheduled for loading
+	lock  sync.Mutex
+
+	wake chan struct{} // Notification of new tasks
+	stop chan struct{} // Channel to interrupt the prefetching
+	term chan struct{} // Channel closed when the loop terminates
+}
+
+// newSubfetcher starts prefetching into the trie with the given root. The trie
+// is opened as a storage trie of the given account, or as the account trie if
+// no account is given.
+func newSubfetcher(db Database, root common.Hash, account *common.Hash) *subfetcher {
+	sf := &subfetcher{
+		db:   db,
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		term: make(chan struct{}),
+	}
+	go sf.loop(root, account)
+	return sf
+}
+
+// schedule adds a batch of keys to load. Keys scheduled after the subfetcher
+// was stopped are ignored.
+func (sf *subfetcher) schedule(keys [][]byte) {
+	sf.lock.Lock()
+	sf.tasks = append(sf.tasks, keys...)
+	sf.lock.Unlock()
+
+	select {
+	case sf.wake <- struct{}{}:
+	default:
+	}
+}
+
+// peek stops the prefetching and returns a copy of the populated trie, or nil
+// if it couldn't be opened.
+func (sf *subfetcher) peek() Trie {
+	sf.abort()
+	if sf.tr == nil {
+		return nil
+	}
+	return sf.db.CopyTrie(sf.tr)
+}
+
+// abort stops the prefetching and waits for the loop to terminate.
+func (sf *subfetcher) abort() {
+	select {
+	case <-sf.stop:
+	default:
+		close(sf.stop)
+	}
+	<-sf.term
+}
+
+// loop opens the trie and loads the scheduled keys until stopped.
+func (sf *subfetcher) loop(root common.Hash, account *common.Hash) {
+	defer close(sf.term)
+
+	var (
+		tr  Trie
+		err error
+	)
+	if account == nil {
+		tr, err = sf.db.OpenTrie(root)
+	} else {
+		tr, err = sf.db.OpenStorageTrie(*account, root)
+	}
+	if err != nil {
+		return
+	}
+	sf.tr = tr
+
+	seen := make(map[string]struct{})
+	for {
+		select {
+		case <-sf.wake:
+			sf.lock.Lock()
+			tasks := sf.tasks
+			sf.tasks = nil
+			sf.lock.Unlock()
+
+			for _, key := range tasks {
+				select {
+				case <-sf.stop:
+					return
+				default:
+				}
+				if _, ok := seen[string(key)]; ok {
+					continue
+				}
+				seen[string(key)] = struct{}{}
+
+				// Missing nodes are simply left for the state to report
+				sf.tr.TryGet(key)
+			}
+		case <-sf.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// Tests that committing a state modified with a running prefetcher results in
+// the same state as without it. The state is backed by a snapshot, so that the
+// tries are only opened on commit and the prefetched ones are picked up.
+func TestPrefetcherCommit(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	sdb := NewDatabase(db)
+
+	state, _ := New(common.Hash{}, sdb)
+	for i := byte(0); i < 100; i++ {
+		addr := common.BytesToAddress([]byte{i})
+		state.AddBalance(addr, big.NewInt(int64(i)+1))
+		for j := byte(0); j < 10; j++ {
+			state.SetState(addr, common.BytesToHash([]byte{i, j}), common.BytesToHash([]byte{1, i, j}))
+		}
+	}
+	root, _ := state.CommitTo(db, false)
+
+	snaps, _ := snapshot.New(db, root)
+	defer snaps.Release()
+
+	last := common.BytesToHash(bytes.Repeat([]byte{0xff}, common.HashLength))
+	for {
+		if _, err := snaps.Snapshot(root).Account(last); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// modify changes the state in a few transactions, finalising each one
+	modify := func(state *StateDB) {
+		for tx := byte(0); tx < 10; tx++ {
+			for i := tx; i < 100; i += 7 {
+				addr := common.BytesToAddress([]byte{i})
+				state.AddBalance(addr, big.NewInt(1))
+				state.SetState(addr, common.BytesToHash([]byte{i, tx}), common.BytesToHash([]byte{2, tx}))
+				state.SetState(addr, common.BytesToHash([]byte{i, tx, 1}), common.BytesToHash([]byte{3, tx}))
+			}
+			state.Suicide(common.BytesToAddress([]byte{50 + tx}))
+			state.SetState(common.BytesToAddress([]byte{200 + tx}), common.Hash{}, common.BytesToHash([]byte{tx + 1}))
+			state.Finalise()
+		}
+	}
+	plain, _ := NewWithSnapshots(root, sdb, snaps)
+	modify(plain)
+	want, _ := plain.CommitTo(db, true)
+
+	for _, hashFirst := range []bool{false, true} {
+		fetched, _ := NewWithSnapshots(root, sdb, snaps)
+		fetched.StartPrefetcher()
+		modify(fetched)
+		if hashFirst {
+			if have := fetched.IntermediateRoot(true); have != want {
+				t.Errorf("intermediate root mismatch: have %x, want %x", have, want)
+			}
+		}
+		have, err := fetched.CommitTo(db, true)
+		fetched.StopPrefetcher()
+
+		if err != nil {
+			t.Fatalf("failed to commit prefetched state: %v", err)
+		}
+		if have != want {
+			t.Errorf("root mismatch: have %x, want %x", have, want)
+		}
+	}
+}
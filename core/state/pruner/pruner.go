@@ -0,0 +1,154 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package pruner implements a mark-and-sweep garbage collector for the trie
+// nodes stored in a chain database.
+package pruner
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Pruner is a mark-and-sweep garbage collector for the trie nodes stored in a
+// database. All the tries that need to be kept must be marked via RetainState
+// or RetainTrie, after which Prune deletes every other trie node and contract
+// code from the database.
+//
+// Trie nodes and contract code are the only entries keyed by plain 32 byte
+// hashes, every other piece of chain data uses a prefixed key. The pruner is
+// not aware of any writes made after marking, so the caller must ensure that
+// no new tries are written into the database until pruning finishes.
+type Pruner struct {
+	db     ethdb.Database
+	triedb *trie.NodeDatabase       // Trie node cache on top of db to read tries through, nil if none
+	marked map[common.Hash]struct{} // Hashes of all the nodes that need to be kept
+}
+
+// NewPruner creates a new state pruner on top of the given database.
+func NewPruner(db ethdb.Database) (*Pruner, error) {
+	return &Pruner{
+		db:     db,
+		marked: make(map[common.Hash]struct{}),
+	}, nil
+}
+
+// NewPrunerWithTrieDB creates a new state pruner for the disk database backing
+// a trie node database. Tries are read through the node database, and all the
+// states kept alive in its cache are retained, since their nodes already flushed
+// to disk must not be deleted.
+func NewPrunerWithTrieDB(triedb *trie.NodeDatabase) (*Pruner, error) {
+	p, err := NewPruner(triedb.DiskDB())
+	if err != nil {
+		return nil, err
+	}
+	p.triedb = triedb
+	for _, root := range triedb.Roots() {
+		if err := p.RetainState(root); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// RetainState marks all the account and storage trie nodes, along with the
+// contract codes reachable from the given state root as live.
+func (p *Pruner) RetainState(root common.Hash) error {
+	database := state.NewDatabase(p.db)
+	if p.triedb != nil {
+		database = state.NewDatabaseWithTrieDB(p.triedb)
+	}
+	statedb, err := state.New(root, database)
+	if err != nil {
+		return err
+	}
+	start, marked := time.Now(), len(p.marked)
+
+	it := state.NewNodeIterator(statedb)
+	for it.Next() {
+		if it.Hash != (common.Hash{}) {
+			p.marked[it.Hash] = struct{}{}
+		}
+	}
+	if it.Error != nil {
+		return it.Error
+	}
+	log.Debug("Retained state trie", "root", root, "nodes", len(p.marked)-marked, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// RetainTrie marks all the nodes of a plain (non-state) trie with the given
+// root as live, e.g. the canonical hash tries of a light server.
+func (p *Pruner) RetainTrie(root common.Hash) error {
+	var db trie.Database = p.db
+	if p.triedb != nil {
+		db = p.triedb
+	}
+	t, err := trie.New(root, db)
+	if err != nil {
+		return err
+	}
+	it := t.NodeIterator(nil)
+	for it.Next(true) {
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			p.marked[hash] = struct{}{}
+		}
+	}
+	return it.Error()
+}
+
+// Prune deletes all the trie nodes and contract codes from the database that
+// were not marked as live, returning the number and size of deleted entries.
+func (p *Pruner) Prune() (int, common.StorageSize, error) {
+	var (
+		start  = time.Now()
+		logged = time.Now()
+		nodes  int
+		size   common.StorageSize
+	)
+	it := p.db.NewIterator(nil, nil)
+	defer it.Release()
+
+	for it.Next() {
+		key := it.Key()
+		if len(key) != common.HashLength {
+			continue
+		}
+		if _, ok := p.marked[common.BytesToHash(key)]; ok {
+			continue
+		}
+		if err := p.db.Delete(key); err != nil {
+			return nodes, size, err
+		}
+		nodes++
+		size += common.StorageSize(len(key) + len(it.Value()))
+
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Pruning state data", "nodes", nodes, "size", size, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return nodes, size, err
+	}
+	log.Info("Pruned state data", "nodes", nodes, "size", size, "retained", len(p.marked), "elapsed", common.PrettyDuration(time.Since(start)))
+	return nodes, size, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// makeTestState creates a state with the given number of accounts on top of the
+// parent root, some of them with storage and code, and commits it into db.
+func makeTestState(db ethdb.Database, parent common.Hash, salt byte, accounts int) common.Hash {
+	statedb, _ := state.New(parent, state.NewDatabase(db))
+	for i := 0; i < accounts; i++ {
+		addr := common.BytesToAddress([]byte{salt, byte(i)})
+		statedb.AddBalance(addr, big.NewInt(int64(i+1)))
+		if i%3 == 0 {
+			statedb.SetCode(addr, []byte{salt, byte(i), 0xff})
+			statedb.SetState(addr, common.Hash{byte(i)}, common.Hash{salt})
+		}
+	}
+	root, _ := statedb.CommitTo(db, false)
+	return root
+}
+
+// checkState verifies that all nodes of a state are present in the database.
+func checkState(t *testing.T, db ethdb.Database, root common.Hash) {
+	statedb, err := state.New(root, state.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("failed to open state %x: %v", root, err)
+	}
+	it := state.NewNodeIterator(statedb)
+	for it.Next() {
+	}
+	if it.Error != nil {
+		t.Fatalf("state %x incomplete: %v", root, it.Error)
+	}
+}
+
+// Tests that pruning deletes the nodes of the stale states, keeping all the
+// retained ones intact, along with non trie database entries.
+func TestPruneState(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+
+	stale := makeTestState(db, common.Hash{}, 1, 64)
+	live := makeTestState(db, stale, 2, 64)
+	db.Put([]byte("secure-key-0123456789012345678901234567890"), []byte{0x01})
+
+	// Create a plain trie to retain alongside the state
+	tr, _ := trie.New(common.Hash{}, db)
+	tr.Update([]byte("key"), []byte("value"))
+	chtRoot, _ := tr.Commit()
+
+	before := len(db.Keys())
+
+	p, err := NewPruner(db)
+	if err != nil {
+		t.Fatalf("failed to create pruner: %v", err)
+	}
+	if err := p.RetainState(live); err != nil {
+		t.Fatalf("failed to retain live state: %v", err)
+	}
+	if err := p.RetainTrie(chtRoot); err != nil {
+		t.Fatalf("failed to retain trie: %v", err)
+	}
+	nodes, _, err := p.Prune()
+	if err != nil {
+		t.Fatalf("failed to prune state: %v", err)
+	}
+	if nodes == 0 || len(db.Keys()) != before-nodes {
+		t.Fatalf("pruned node count mismatch: have %d, database shrunk by %d", nodes, before-len(db.Keys()))
+	}
+	checkState(t, db, live)
+	if _, err := trie.New(chtRoot, db); err != nil {
+		t.Fatalf("retained trie missing: %v", err)
+	}
+	if _, err := db.Get(stale[:]); err == nil {
+		t.Fatalf("stale state root not pruned")
+	}
+	if _, err := db.Get([]byte("secure-key-0123456789012345678901234567890")); err != nil {
+		t.Fatalf("non trie entry pruned: %v", err)
+	}
+}
+
+// Tests that pruning a database without anything retained deletes all the trie
+// nodes from it.
+func TestPruneEverything(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	makeTestState(db, common.Hash{}, 1, 32)
+
+	p, _ := NewPruner(db)
+	if _, _, err := p.Prune(); err != nil {
+		t.Fatalf("failed to prune state: %v", err)
+	}
+	for _, key := range db.Keys() {
+		if len(key) == common.HashLength {
+			t.Errorf("trie node %x not pruned", key)
+		}
+	}
+}
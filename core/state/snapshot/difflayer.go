@@ -0,0 +1,131 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// diffLayer is an in-memory snapshot layer, holding the state changes made by
+// a single block on top of its parent layer. Items not modified in the layer
+// are looked up in its parent.
+type diffLayer struct {
+	parent snapshot    // Parent layer modified by this one, replaced when flattened
+	root   common.Hash // Root hash of the state this layer represents
+	stale  bool        // Whether the layer was flattened or dropped
+
+	destructs map[common.Hash]struct{}               // Accounts deleted in this layer, along with their storage
+	accounts  map[common.Hash][]byte                 // RLP encoded accounts updated in this layer
+	storage   map[common.Hash]map[common.Hash][]byte // Storage slots updated in this layer, nil meaning deletion
+
+	lock sync.RWMutex
+}
+
+// newDiffLayer creates a new diff layer on top of an existing snapshot.
+func newDiffLayer(parent snapshot, root common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) *diffLayer {
+	return &diffLayer{
+		parent:    parent,
+		root:      root,
+		destructs: destructs,
+		accounts:  accounts,
+		storage:   storage,
+	}
+}
+
+// Root returns the root hash of the state this layer represents.
+func (dl *diffLayer) Root() common.Hash {
+	return dl.root
+}
+
+// Parent returns the layer this one was built on.
+func (dl *diffLayer) Parent() snapshot {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.parent
+}
+
+// setParent replaces the parent layer, after it was flattened into a new disk
+// layer.
+func (dl *diffLayer) setParent(parent snapshot) {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	dl.parent = parent
+}
+
+// Stale reports whether the layer was flattened or dropped from the tree.
+func (dl *diffLayer) Stale() bool {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.stale
+}
+
+// markStale flags the layer as unusable.
+func (dl *diffLayer) markStale() {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	dl.stale = true
+}
+
+// Account retrieves the RLP encoded account with the given hash, falling back
+// to the parent layer if it wasn't modified in this one.
+func (dl *diffLayer) Account(hash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	if dl.stale {
+		dl.lock.RUnlock()
+		return nil, errSnapshotStale
+	}
+	if blob, ok := dl.accounts[hash]; ok {
+		dl.lock.RUnlock()
+		return blob, nil
+	}
+	if _, ok := dl.destructs[hash]; ok {
+		dl.lock.RUnlock()
+		return nil, nil
+	}
+	parent := dl.parent
+	dl.lock.RUnlock()
+
+	return parent.Account(hash)
+}
+
+// Storage retrieves the RLP encoded value of a storage slot, falling back to
+// the parent layer if it wasn't modified in this one.
+func (dl *diffLayer) Storage(accountHash, storageHash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	if dl.stale {
+		dl.lock.RUnlock()
+		return nil, errSnapshotStale
+	}
+	if blob, ok := dl.storage[accountHash][storageHash]; ok {
+		dl.lock.RUnlock()
+		return blob, nil
+	}
+	if _, ok := dl.destructs[accountHash]; ok {
+		dl.lock.RUnlock()
+		return nil, nil
+	}
+	parent := dl.parent
+	dl.lock.RUnlock()
+
+	return parent.Storage(accountHash, storageHash)
+}
@@ -0,0 +1,227 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// diskLayer is the persistent base layer of a snapshot tree. While the snapshot
+// is being generated, only the accounts up to the generator's progress marker
+// are available from it.
+type diskLayer struct {
+	diskdb ethdb.Database // Key-value store containing the flat state
+	root   common.Hash    // Root hash of the state this layer represents
+	stale  bool           // Whether a diff layer was flattened into this one
+
+	genMarker []byte             // Last account covered by the generator, nil if generation is done
+	genAbort  chan chan struct{} // Channel to abort the running generator, nil if none running
+
+	lock sync.RWMutex
+}
+
+// loadDiskLayer loads the persisted snapshot of the given state, resuming its
+// generation if it was interrupted.
+func loadDiskLayer(diskdb ethdb.Database, root common.Hash) (*diskLayer, error) {
+	blob, _ := diskdb.Get(snapshotRootKey)
+	if len(blob) != common.HashLength {
+		return nil, errors.New("missing snapshot")
+	}
+	if stored := common.BytesToHash(blob); stored != root {
+		return nil, fmt.Errorf("root mismatch: have %x, want %x", stored, root)
+	}
+	dl := &diskLayer{
+		diskdb: diskdb,
+		root:   root,
+	}
+	if marker, err := diskdb.Get(snapshotGeneratorKey); err == nil {
+		log.Info("Resuming state snapshot generation", "root", root, "at", common.BytesToHash(marker))
+		dl.startGeneration(marker)
+	}
+	return dl, nil
+}
+
+// generateDiskLayer creates a new disk layer for the given state, generating
+// its contents from the state trie in the background.
+func generateDiskLayer(diskdb ethdb.Database, root common.Hash) *diskLayer {
+	batch := diskdb.NewBatch()
+	batch.Put(snapshotRootKey, root[:])
+	batch.Put(snapshotGeneratorKey, []byte{})
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to write snapshot generator", "err", err)
+	}
+	dl := &diskLayer{
+		diskdb: diskdb,
+		root:   root,
+	}
+	dl.startGeneration([]byte{})
+	return dl
+}
+
+// Root returns the root hash of the state this layer represents.
+func (dl *diskLayer) Root() common.Hash {
+	return dl.root
+}
+
+// Parent always returns nil as there's no layer below the disk one.
+func (dl *diskLayer) Parent() snapshot {
+	return nil
+}
+
+// Stale reports whether a diff layer was flattened into this one.
+func (dl *diskLayer) Stale() bool {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.stale
+}
+
+// markStale flags the layer as unusable.
+func (dl *diskLayer) markStale() {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	dl.stale = true
+}
+
+// covered reports whether the generator already processed the given account.
+// The caller must hold the layer lock.
+func (dl *diskLayer) covered(hash common.Hash) bool {
+	return dl.genMarker == nil || bytes.Compare(hash[:], dl.genMarker) <= 0
+}
+
+// Account retrieves the RLP encoded account with the given hash directly from
+// the database.
+func (dl *diskLayer) Account(hash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return nil, errSnapshotStale
+	}
+	if !dl.covered(hash) {
+		return nil, errNotCoveredYet
+	}
+	blob, _ := dl.diskdb.Get(accountKey(hash))
+	return blob, nil
+}
+
+// Storage retrieves the RLP encoded value of a storage slot directly from the
+// database.
+func (dl *diskLayer) Storage(accountHash, storageHash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return nil, errSnapshotStale
+	}
+	if !dl.covered(accountHash) {
+		return nil, errNotCoveredYet
+	}
+	blob, _ := dl.diskdb.Get(storageKey(accountHash, storageHash))
+	return blob, nil
+}
+
+// apply writes the changes of a diff layer directly on top of the disk layer,
+// returning a new disk layer representing the resulting state. The current
+// layer is marked stale up front, as its contents are modified in place. Any
+// running generation is continued on the new layer.
+func (dl *diskLayer) apply(diff *diffLayer) *diskLayer {
+	marker := dl.stopGeneration()
+	dl.markStale()
+
+	covered := func(hash common.Hash) bool {
+		return marker == nil || bytes.Compare(hash[:], marker) <= 0
+	}
+	// Deletions can't be batched, so invalidate the persisted snapshot until the
+	// new root is written to avoid loading a half updated one after a crash
+	if err := dl.diskdb.Delete(snapshotRootKey); err != nil {
+		log.Crit("Failed to invalidate snapshot", "err", err)
+	}
+	batch := dl.diskdb.NewBatch()
+	for hash := range diff.destructs {
+		if !covered(hash) {
+			continue
+		}
+		if err := dl.diskdb.Delete(accountKey(hash)); err != nil {
+			log.Crit("Failed to delete snapshot account", "err", err)
+		}
+		if err := wipeKeys(dl.diskdb, append(append([]byte{}, storagePrefix...), hash[:]...), nil, storageKeyLength); err != nil {
+			log.Crit("Failed to delete snapshot storage", "err", err)
+		}
+	}
+	for hash, blob := range diff.accounts {
+		if covered(hash) {
+			batch.Put(accountKey(hash), blob)
+		}
+	}
+	for accountHash, slots := range diff.storage {
+		if !covered(accountHash) {
+			continue
+		}
+		for storageHash, blob := range slots {
+			if len(blob) > 0 {
+				batch.Put(storageKey(accountHash, storageHash), blob)
+			} else if err := dl.diskdb.Delete(storageKey(accountHash, storageHash)); err != nil {
+				log.Crit("Failed to delete snapshot slot", "err", err)
+			}
+		}
+	}
+	batch.Put(snapshotRootKey, diff.root[:])
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to write snapshot", "err", err)
+	}
+	diff.markStale()
+
+	res := &diskLayer{
+		diskdb: dl.diskdb,
+		root:   diff.root,
+	}
+	if marker != nil {
+		res.startGeneration(marker)
+	}
+	return res
+}
+
+// wipeKeys deletes all the database entries of the given length with the given
+// prefix. If a start hash is given, only entries whose hash following the prefix
+// sorts after it are deleted. The length check is needed as other entries (e.g.
+// trie nodes) may share the single byte snapshot prefixes.
+func wipeKeys(db ethdb.Database, prefix []byte, start []byte, length int) error {
+	it := db.NewIterator(prefix, start)
+	defer it.Release()
+
+	for it.Next() {
+		if len(it.Key()) != length {
+			continue
+		}
+		if len(start) > 0 && bytes.HasPrefix(it.Key()[len(prefix):], start) {
+			continue
+		}
+		if err := db.Delete(common.CopyBytes(it.Key())); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
@@ -0,0 +1,192 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// idealBatchSize is the amount of data to accumulate before flushing generated
+// snapshot entries to disk.
+const idealBatchSize = 100 * 1024
+
+// account is the Ethereum consensus representation of accounts, as stored in
+// the account trie. Only the storage root is needed by the generator.
+type account struct {
+	Nonce    uint64
+	Balance  *big.Int
+	Root     common.Hash
+	CodeHash []byte
+}
+
+// startGeneration starts generating the contents of the disk layer in the
+// background, continuing after the given account.
+func (dl *diskLayer) startGeneration(marker []byte) {
+	abort := make(chan chan struct{})
+
+	dl.lock.Lock()
+	dl.genMarker, dl.genAbort = marker, abort
+	dl.lock.Unlock()
+
+	go dl.generate(marker, abort)
+}
+
+// stopGeneration aborts the background generation if it's running, returning
+// the last account covered, or nil if the generation finished.
+func (dl *diskLayer) stopGeneration() []byte {
+	dl.lock.RLock()
+	abort := dl.genAbort
+	dl.lock.RUnlock()
+
+	if abort != nil {
+		done := make(chan struct{})
+		abort <- done
+		<-done
+	}
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	dl.genAbort = nil
+	return dl.genMarker
+}
+
+// generate iterates over the state trie of the disk layer, writing the flat
+// accounts and storage slots after the given marker into the database. The
+// progress is persisted periodically, so generation can be resumed later.
+//
+// Once done (or failed), the generator keeps waiting for the abort signal, so
+// that stopGeneration doesn't need to care about the generator's state.
+func (dl *diskLayer) generate(marker []byte, abort chan chan struct{}) {
+	var (
+		start  = time.Now()
+		logged = time.Now()
+		batch  = dl.diskdb.NewBatch()
+		size   int
+
+		accounts, slots int
+	)
+	// flush writes out the pending entries along with the generator progress
+	flush := func() {
+		batch.Put(snapshotGeneratorKey, marker)
+		if err := batch.Write(); err != nil {
+			log.Crit("Failed to write state snapshot", "err", err)
+		}
+		batch, size = dl.diskdb.NewBatch(), 0
+
+		dl.lock.Lock()
+		dl.genMarker = marker
+		dl.lock.Unlock()
+	}
+	// fail reports a generation failure and waits for the abort signal
+	fail := func(err error) {
+		log.Error("State snapshot generation failed", "root", dl.root, "err", err)
+		flush()
+		close(<-abort)
+	}
+	// Delete any entries left after the marker by earlier snapshots or partially
+	// generated accounts of an interrupted run
+	if err := wipeKeys(dl.diskdb, accountPrefix, marker, accountKeyLength); err != nil {
+		log.Crit("Failed to wipe stale state snapshot", "err", err)
+	}
+	if err := wipeKeys(dl.diskdb, storagePrefix, marker, storageKeyLength); err != nil {
+		log.Crit("Failed to wipe stale state snapshot", "err", err)
+	}
+	accTrie, err := trie.New(dl.root, dl.diskdb)
+	if err != nil {
+		fail(err)
+		return
+	}
+	it := trie.NewIterator(accTrie.NodeIterator(marker))
+	for it.Next() {
+		if bytes.Compare(it.Key, marker) <= 0 {
+			continue
+		}
+		accountHash := common.BytesToHash(it.Key)
+
+		batch.Put(accountKey(accountHash), it.Value)
+		size += len(it.Key) + len(it.Value)
+		accounts++
+
+		// Generate all the storage slots of the account
+		var acc account
+		if err := rlp.DecodeBytes(it.Value, &acc); err != nil {
+			fail(err)
+			return
+		}
+		storeTrie, err := trie.New(acc.Root, dl.diskdb)
+		if err != nil {
+			fail(err)
+			return
+		}
+		storeIt := trie.NewIterator(storeTrie.NodeIterator(nil))
+		for storeIt.Next() {
+			batch.Put(storageKey(accountHash, common.BytesToHash(storeIt.Key)), storeIt.Value)
+			size += len(storeIt.Key) + len(storeIt.Value)
+			slots++
+
+			// Partial storage may be flushed, it's wiped if generation is resumed
+			if size > idealBatchSize {
+				flush()
+			}
+		}
+		if storeIt.Err != nil {
+			fail(storeIt.Err)
+			return
+		}
+		marker = common.CopyBytes(it.Key)
+
+		// Account fully generated, abort if requested or flush if needed
+		select {
+		case done := <-abort:
+			flush()
+			close(done)
+			return
+		default:
+		}
+		if size > idealBatchSize {
+			flush()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Generating state snapshot", "at", accountHash, "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if it.Err != nil {
+		fail(it.Err)
+		return
+	}
+	// Generation finished, flush the remainder and mark the snapshot complete
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to write state snapshot", "err", err)
+	}
+	if err := dl.diskdb.Delete(snapshotGeneratorKey); err != nil {
+		log.Crit("Failed to remove snapshot generator", "err", err)
+	}
+	dl.lock.Lock()
+	dl.genMarker = nil
+	dl.lock.Unlock()
+
+	log.Info("Generated state snapshot", "root", dl.root, "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+	close(<-abort)
+}
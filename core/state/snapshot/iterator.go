@@ -0,0 +1,276 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+)
+
+// Iterator iterates over the flat accounts or storage slots of a snapshot in
+// ascending hash order. Deleted items are skipped.
+type Iterator interface {
+	// Next moves the iterator to the next item, returning whether there is one.
+	Next() bool
+
+	// Error returns any failure that occurred during iteration.
+	Error() error
+
+	// Hash returns the hash of the account or storage slot the iterator is at.
+	Hash() common.Hash
+
+	// Value returns the RLP encoded account or storage value the iterator is at.
+	Value() []byte
+
+	// Release frees up the resources held by the iterator.
+	Release()
+}
+
+// AccountIterator creates an iterator over the accounts of the disk layer,
+// starting at the given hash. It fails if the generation isn't finished yet.
+func (dl *diskLayer) AccountIterator(seek common.Hash) (Iterator, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return nil, errSnapshotStale
+	}
+	if dl.genMarker != nil {
+		return nil, errNotCoveredYet
+	}
+	return newDiskIterator(dl, accountPrefix, seek, accountKeyLength), nil
+}
+
+// StorageIterator creates an iterator over the storage slots of an account in
+// the disk layer, starting at the given hash.
+func (dl *diskLayer) StorageIterator(accountHash, seek common.Hash) (Iterator, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return nil, errSnapshotStale
+	}
+	if !dl.covered(accountHash) {
+		return nil, errNotCoveredYet
+	}
+	return newDiskIterator(dl, append(append([]byte{}, storagePrefix...), accountHash[:]...), seek, storageKeyLength), nil
+}
+
+// diskIterator iterates over the flat entries of a disk layer with a common
+// prefix. The database iterator operates on a point in time view of the data,
+// so it's unaffected by later modifications of the layer. The caller must hold
+// the layer lock while creating it, so no flattening is in progress.
+type diskIterator struct {
+	it     iterator.Iterator
+	length int
+}
+
+// newDiskIterator creates an iterator over the entries of the given length
+// with the given prefix, starting at the given hash.
+func newDiskIterator(dl *diskLayer, prefix []byte, seek common.Hash, length int) *diskIterator {
+	return &diskIterator{it: dl.diskdb.NewIterator(prefix, seek[:]), length: length}
+}
+
+// Next moves the iterator to the next entry with the requested prefix.
+func (it *diskIterator) Next() bool {
+	for it.it.Next() {
+		if len(it.it.Key()) == it.length {
+			return true
+		}
+	}
+	return false
+}
+
+// Error returns any failure of the database iterator.
+func (it *diskIterator) Error() error {
+	return it.it.Error()
+}
+
+// Hash returns the hash of the current entry.
+func (it *diskIterator) Hash() common.Hash {
+	return common.BytesToHash(it.it.Key()[it.length-common.HashLength:])
+}
+
+// Value returns the RLP encoded value of the current entry.
+func (it *diskIterator) Value() []byte {
+	return common.CopyBytes(it.it.Value())
+}
+
+// Release releases the database iterator.
+func (it *diskIterator) Release() {
+	it.it.Release()
+}
+
+// AccountIterator creates an iterator over the accounts of the layer, merging
+// its own changes with the accounts of its parent.
+func (dl *diffLayer) AccountIterator(seek common.Hash) (Iterator, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return nil, errSnapshotStale
+	}
+	parent, err := dl.parent.AccountIterator(seek)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[common.Hash][]byte, len(dl.accounts)+len(dl.destructs))
+	for hash := range dl.destructs {
+		entries[hash] = nil
+	}
+	for hash, blob := range dl.accounts {
+		entries[hash] = blob
+	}
+	return newDiffIterator(entries, seek, parent), nil
+}
+
+// StorageIterator creates an iterator over the storage slots of an account,
+// merging the changes of the layer with the slots of its parent. The parent's
+// slots are ignored if the account was destructed in this layer.
+func (dl *diffLayer) StorageIterator(accountHash, seek common.Hash) (Iterator, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return nil, errSnapshotStale
+	}
+	var parent Iterator
+	if _, destructed := dl.destructs[accountHash]; !destructed {
+		var err error
+		if parent, err = dl.parent.StorageIterator(accountHash, seek); err != nil {
+			return nil, err
+		}
+	}
+	return newDiffIterator(dl.storage[accountHash], seek, parent), nil
+}
+
+// diffIterator merges the entries changed in a diff layer with an iterator of
+// the parent layer. Entries of the diff layer shadow the parent's ones and nil
+// values mark deletions.
+type diffIterator struct {
+	keys    []common.Hash
+	entries map[common.Hash][]byte
+
+	parent     Iterator // Iterator of the parent layer, nil if exhausted or absent
+	parentNext bool     // Whether the parent iterator is positioned at an unconsumed item
+
+	hash  common.Hash
+	value []byte
+	err   error
+}
+
+// newDiffIterator creates an iterator over the entries of a diff layer starting
+// at the given hash, merged with the parent iterator (which may be nil).
+func newDiffIterator(entries map[common.Hash][]byte, seek common.Hash, parent Iterator) *diffIterator {
+	keys := make([]common.Hash, 0, len(entries))
+	for hash := range entries {
+		if bytes.Compare(hash[:], seek[:]) >= 0 {
+			keys = append(keys, hash)
+		}
+	}
+	sort.Sort(hashes(keys))
+
+	it := &diffIterator{keys: keys, entries: entries, parent: parent}
+	it.advanceParent()
+	return it
+}
+
+// advanceParent moves the parent iterator forward, dropping it when exhausted.
+func (it *diffIterator) advanceParent() {
+	if it.parent == nil {
+		it.parentNext = false
+		return
+	}
+	if it.parentNext = it.parent.Next(); !it.parentNext {
+		it.err = it.parent.Error()
+		it.parent.Release()
+		it.parent = nil
+	}
+}
+
+// Next moves the iterator to the next live entry of either the layer or its
+// parent.
+func (it *diffIterator) Next() bool {
+	for it.err == nil && (len(it.keys) > 0 || it.parentNext) {
+		var (
+			hash  common.Hash
+			value []byte
+		)
+		switch {
+		case len(it.keys) == 0:
+			hash, value = it.parent.Hash(), it.parent.Value()
+			it.advanceParent()
+
+		case !it.parentNext:
+			hash, value = it.keys[0], it.entries[it.keys[0]]
+			it.keys = it.keys[1:]
+
+		default:
+			switch bytes.Compare(it.keys[0][:], it.parent.Hash().Bytes()) {
+			case -1:
+				hash, value = it.keys[0], it.entries[it.keys[0]]
+				it.keys = it.keys[1:]
+			case 0:
+				hash, value = it.keys[0], it.entries[it.keys[0]]
+				it.keys = it.keys[1:]
+				it.advanceParent()
+			case 1:
+				hash, value = it.parent.Hash(), it.parent.Value()
+				it.advanceParent()
+			}
+		}
+		if len(value) > 0 {
+			it.hash, it.value = hash, value
+			return true
+		}
+	}
+	return false
+}
+
+// Error returns any failure of the parent iterators.
+func (it *diffIterator) Error() error {
+	return it.err
+}
+
+// Hash returns the hash of the current entry.
+func (it *diffIterator) Hash() common.Hash {
+	return it.hash
+}
+
+// Value returns the RLP encoded value of the current entry.
+func (it *diffIterator) Value() []byte {
+	return it.value
+}
+
+// Release releases the parent iterator, if still open.
+func (it *diffIterator) Release() {
+	if it.parent != nil {
+		it.parent.Release()
+		it.parent = nil
+	}
+	it.keys, it.parentNext = nil, false
+}
+
+// hashes is a sortable list of hashes.
+type hashes []common.Hash
+
+func (hs hashes) Len() int           { return len(hs) }
+func (hs hashes) Less(i, j int) bool { return bytes.Compare(hs[i][:], hs[j][:]) < 0 }
+func (hs hashes) Swap(i, j int)      { hs[i], hs[j] = hs[j], hs[i] }
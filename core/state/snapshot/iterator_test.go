@@ -0,0 +1,157 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// checkIterator verifies that an iterator returns exactly the given entries at
+// or after the seek hash, in ascending order.
+func checkIterator(t *testing.T, it Iterator, seek common.Hash, want map[common.Hash][]byte) {
+	defer it.Release()
+
+	var keys []common.Hash
+	for hash := range want {
+		if bytes.Compare(hash[:], seek[:]) >= 0 {
+			keys = append(keys, hash)
+		}
+	}
+	sort.Sort(hashes(keys))
+
+	i := 0
+	for ; it.Next(); i++ {
+		if i >= len(keys) {
+			t.Fatalf("iterator returned extra entry %x", it.Hash())
+		}
+		if it.Hash() != keys[i] || !bytes.Equal(it.Value(), want[keys[i]]) {
+			t.Fatalf("entry %d: have %x: %x, want %x: %x", i, it.Hash(), it.Value(), keys[i], want[keys[i]])
+		}
+	}
+	if err := it.Error(); err != nil {
+		t.Fatalf("iteration failed: %v", err)
+	}
+	if i != len(keys) {
+		t.Fatalf("entry count mismatch: have %d, want %d", i, len(keys))
+	}
+}
+
+// Tests that iterating over the accounts and storage of snapshot layers merges
+// the changes of the diff layers with the disk content, skipping deleted items.
+func TestIterators(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	root, content := makeTestState(db)
+
+	snaps, err := New(db, root)
+	if err != nil {
+		t.Fatalf("failed to create snapshot tree: %v", err)
+	}
+	waitGeneration(t, snaps.layers[root].(*diskLayer))
+
+	var (
+		recreated = crypto.Keccak256Hash([]byte{3})
+		deleted   = crypto.Keccak256Hash([]byte{9})
+		modified  = crypto.Keccak256Hash([]byte{6})
+		created   = crypto.Keccak256Hash([]byte{0xff})
+
+		deletedSlot, keptSlot common.Hash
+	)
+	for slot := range content.storage[modified] {
+		if deletedSlot == (common.Hash{}) {
+			deletedSlot = slot
+		} else if keptSlot == (common.Hash{}) {
+			keptSlot = slot
+		}
+	}
+	// Destruct and recreate an account, delete another one, modify storage
+	// and create a new account in the first layer
+	var (
+		root1  = common.HexToHash("0x01")
+		newAcc = []byte{0x01}
+		newVal = []byte{0x02}
+	)
+	snaps.Update(root1, root, map[common.Hash]struct{}{recreated: {}, deleted: {}},
+		map[common.Hash][]byte{recreated: newAcc, created: newAcc, modified: newAcc},
+		map[common.Hash]map[common.Hash][]byte{
+			recreated: {common.HexToHash("0x11"): newVal},
+			modified:  {deletedSlot: nil, keptSlot: newVal, common.HexToHash("0x22"): newVal},
+		})
+	// Modify the storage of the recreated account in the second layer
+	root2 := common.HexToHash("0x02")
+	snaps.Update(root2, root1, nil, nil, map[common.Hash]map[common.Hash][]byte{
+		recreated: {common.HexToHash("0x33"): newVal},
+	})
+
+	accounts := make(map[common.Hash][]byte)
+	for hash, blob := range content.accounts {
+		accounts[hash] = blob
+	}
+	delete(accounts, deleted)
+	accounts[recreated], accounts[created], accounts[modified] = newAcc, newAcc, newAcc
+
+	storage := make(map[common.Hash][]byte)
+	for slot, value := range content.storage[modified] {
+		storage[slot] = value
+	}
+	delete(storage, deletedSlot)
+	storage[keptSlot], storage[common.HexToHash("0x22")] = newVal, newVal
+
+	snap := snaps.Snapshot(root2)
+	for _, seek := range []common.Hash{{}, recreated, common.HexToHash("0x8000000000000000000000000000000000000000000000000000000000000000")} {
+		it, err := snap.AccountIterator(seek)
+		if err != nil {
+			t.Fatalf("failed to create account iterator: %v", err)
+		}
+		checkIterator(t, it, seek, accounts)
+	}
+	it, err := snap.StorageIterator(modified, common.Hash{})
+	if err != nil {
+		t.Fatalf("failed to create storage iterator: %v", err)
+	}
+	checkIterator(t, it, common.Hash{}, storage)
+
+	it, err = snap.StorageIterator(recreated, common.Hash{})
+	if err != nil {
+		t.Fatalf("failed to create storage iterator: %v", err)
+	}
+	checkIterator(t, it, common.Hash{}, map[common.Hash][]byte{common.HexToHash("0x11"): newVal, common.HexToHash("0x33"): newVal})
+
+	it, err = snap.StorageIterator(deleted, common.Hash{})
+	if err != nil {
+		t.Fatalf("failed to create storage iterator: %v", err)
+	}
+	checkIterator(t, it, common.Hash{}, nil)
+
+	// Flattening the layers must keep the iteration results intact
+	if err := snaps.Cap(root2, 0); err != nil {
+		t.Fatalf("failed to flatten snapshot: %v", err)
+	}
+	if _, err := snap.AccountIterator(common.Hash{}); err != errSnapshotStale {
+		t.Fatalf("stale layer iterator error mismatch: have %v, want %v", err, errSnapshotStale)
+	}
+	it, err = snaps.Snapshot(root2).AccountIterator(common.Hash{})
+	if err != nil {
+		t.Fatalf("failed to create account iterator: %v", err)
+	}
+	checkIterator(t, it, common.Hash{}, accounts)
+}
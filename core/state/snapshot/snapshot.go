@@ -0,0 +1,261 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package snapshot implements a flat key-value representation of the recent
+// states, allowing accounts and storage slots to be read without traversing
+// the state tries.
+//
+// The snapshot consists of a single persistent disk layer, holding the flat
+// state of some block, and a tree of in-memory diff layers on top of it, each
+// holding the state changes of a single block. Diff layers deep enough in the
+// tree are periodically flattened into the disk layer.
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var (
+	snapshotRootKey      = []byte("SnapshotRoot")      // State root of the persisted disk layer
+	snapshotGeneratorKey = []byte("SnapshotGenerator") // Last account covered by an unfinished generator
+
+	accountPrefix = []byte("a") // accountPrefix + account hash -> account RLP
+	storagePrefix = []byte("o") // storagePrefix + account hash + storage hash -> storage value RLP
+)
+
+const (
+	accountKeyLength = 1 + common.HashLength   // Length of the flat account keys
+	storageKeyLength = 1 + 2*common.HashLength // Length of the flat storage keys
+)
+
+var (
+	// errSnapshotStale is returned from data accessors if the layer was flattened
+	// into the disk layer or dropped, and cannot be used any more.
+	errSnapshotStale = errors.New("snapshot stale")
+
+	// errNotCoveredYet is returned from data accessors if the requested item is
+	// not yet covered by the running snapshot generator.
+	errNotCoveredYet = errors.New("not covered yet")
+
+	// errSnapshotCycle is returned if a layer is attempted to be added on top of
+	// a layer with the same state root.
+	errSnapshotCycle = errors.New("snapshot cycle")
+)
+
+// accountKey = accountPrefix + hash
+func accountKey(hash common.Hash) []byte {
+	return append(append([]byte{}, accountPrefix...), hash[:]...)
+}
+
+// storageKey = storagePrefix + account hash + storage hash
+func storageKey(accountHash, storageHash common.Hash) []byte {
+	return append(append(append([]byte{}, storagePrefix...), accountHash[:]...), storageHash[:]...)
+}
+
+// Snapshot represents the functionality supported by a snapshot of the state
+// at a particular state root.
+type Snapshot interface {
+	// Root returns the root hash of the state the snapshot represents.
+	Root() common.Hash
+
+	// Account retrieves the RLP encoded account with the given hash, or nil if
+	// the account doesn't exist.
+	Account(hash common.Hash) ([]byte, error)
+
+	// Storage retrieves the RLP encoded value of a storage slot of an account,
+	// or nil if the slot is empty.
+	Storage(accountHash, storageHash common.Hash) ([]byte, error)
+
+	// AccountIterator creates an iterator over all the accounts of the snapshot,
+	// starting at the given account hash.
+	AccountIterator(seek common.Hash) (Iterator, error)
+
+	// StorageIterator creates an iterator over all the storage slots of an
+	// account, starting at the given storage hash.
+	StorageIterator(accountHash, seek common.Hash) (Iterator, error)
+}
+
+// snapshot is the internal version of the snapshot data layer, exposing the
+// layer structure within the tree.
+type snapshot interface {
+	Snapshot
+
+	// Parent returns the layer this one was built on, or nil for the disk layer.
+	Parent() snapshot
+
+	// Stale reports whether the layer was flattened or dropped from the tree.
+	Stale() bool
+}
+
+// Tree is an Ethereum state snapshot tree. It consists of one persistent base
+// layer backed by a key-value store, on top of which arbitrarily many in-memory
+// diff layers are stacked, forming a tree keyed by state root. The tree can
+// fork to follow side chains, but layers not built on top of the disk layer are
+// dropped whenever it's updated.
+type Tree struct {
+	diskdb ethdb.Database           // Persistent database to store the snapshot in
+	layers map[common.Hash]snapshot // Collection of all known layers
+	lock   sync.RWMutex
+}
+
+// New attempts to load an already existing snapshot of the state with the given
+// root from the database. If the snapshot is missing or belongs to a different
+// state, it's discarded and a new one is generated in the background.
+func New(diskdb ethdb.Database, root common.Hash) (*Tree, error) {
+	base, err := loadDiskLayer(diskdb, root)
+	if err != nil {
+		log.Warn("Regenerating state snapshot", "root", root, "reason", err)
+		base = generateDiskLayer(diskdb, root)
+	}
+	return &Tree{
+		diskdb: diskdb,
+		layers: map[common.Hash]snapshot{root: base},
+	}, nil
+}
+
+// Snapshot retrieves a snapshot belonging to the given state root, or nil if
+// no snapshot is maintained for that state.
+func (t *Tree) Snapshot(root common.Hash) Snapshot {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if layer, ok := t.layers[root]; ok {
+		return layer
+	}
+	return nil
+}
+
+// Update adds a new diff layer on top of an existing snapshot, containing the
+// state changes that transition the parent state into the new one. Destructed
+// accounts have all their storage wiped before applying any updates from the
+// same layer. Storage slots with nil values are deleted.
+//
+// The tree takes ownership of the passed maps, the caller must not modify them.
+func (t *Tree) Update(root common.Hash, parentRoot common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) error {
+	if root == parentRoot {
+		return errSnapshotCycle
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, ok := t.layers[root]; ok {
+		return nil
+	}
+	parent, ok := t.layers[parentRoot]
+	if !ok {
+		return fmt.Errorf("parent snapshot %x missing", parentRoot)
+	}
+	t.layers[root] = newDiffLayer(parent, root, destructs, accounts, storage)
+	return nil
+}
+
+// Cap flattens the diff layers below the given root into the disk layer, so
+// that at most the given number of diff layers remain in between. All layers
+// not built on top of the new disk layer are dropped from the tree.
+func (t *Tree) Cap(root common.Hash, layers int) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	snap, ok := t.layers[root]
+	if !ok {
+		return fmt.Errorf("snapshot %x missing", root)
+	}
+	// Gather all the diff layers between the requested root and the disk layer
+	var (
+		diffs []*diffLayer
+		base  *diskLayer
+	)
+	for layer := snap; base == nil; {
+		switch layer := layer.(type) {
+		case *diffLayer:
+			diffs = append(diffs, layer)
+		case *diskLayer:
+			base = layer
+		}
+		layer = layer.Parent()
+	}
+	if len(diffs) <= layers {
+		return nil
+	}
+	// Flatten the excess diff layers into the disk layer, bottom up
+	for i := len(diffs) - 1; i >= layers; i-- {
+		base = base.apply(diffs[i])
+	}
+	if layers > 0 {
+		diffs[layers-1].setParent(base)
+	}
+	// Drop every layer not built on top of the new disk layer
+	remaining := map[common.Hash]snapshot{base.root: base}
+	for root, layer := range t.layers {
+		if descendsFrom(layer, base) {
+			remaining[root] = layer
+		} else if diff, ok := layer.(*diffLayer); ok {
+			diff.markStale()
+		}
+	}
+	t.layers = remaining
+	return nil
+}
+
+// descendsFrom reports whether a layer is built on top of the given base.
+func descendsFrom(layer snapshot, base snapshot) bool {
+	for ; layer != nil; layer = layer.Parent() {
+		if layer == base {
+			return true
+		}
+	}
+	return false
+}
+
+// Rebuild discards all the existing layers and starts generating a new disk
+// layer for the given state root in the background. It's meant to be used if
+// the persistent state was modified outside of the snapshot's knowledge, e.g.
+// after a fast sync or a chain rewind.
+func (t *Tree) Rebuild(root common.Hash) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, layer := range t.layers {
+		switch layer := layer.(type) {
+		case *diffLayer:
+			layer.markStale()
+		case *diskLayer:
+			layer.stopGeneration()
+			layer.markStale()
+		}
+	}
+	log.Info("Rebuilding state snapshot", "root", root)
+	t.layers = map[common.Hash]snapshot{root: generateDiskLayer(t.diskdb, root)}
+}
+
+// Release stops any background snapshot generation. The generation is resumed
+// the next time the snapshot is loaded.
+func (t *Tree) Release() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, layer := range t.layers {
+		if disk, ok := layer.(*diskLayer); ok {
+			disk.stopGeneration()
+		}
+	}
+}
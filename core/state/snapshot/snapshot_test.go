@@ -0,0 +1,329 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// testState is the flat content of a state used to generate snapshots from.
+type testState struct {
+	accounts map[common.Hash][]byte
+	storage  map[common.Hash]map[common.Hash][]byte
+}
+
+// makeTestState creates a state trie with a few accounts, some of them having
+// storage, returning its root and flat content.
+func makeTestState(db ethdb.Database) (common.Hash, *testState) {
+	content := &testState{
+		accounts: make(map[common.Hash][]byte),
+		storage:  make(map[common.Hash]map[common.Hash][]byte),
+	}
+	accTrie, _ := trie.New(common.Hash{}, db)
+	for i := byte(0); i < 32; i++ {
+		hash := crypto.Keccak256Hash([]byte{i})
+
+		acc := account{Nonce: uint64(i), Balance: big.NewInt(int64(i)), CodeHash: crypto.Keccak256(nil)}
+		if i%3 == 0 {
+			content.storage[hash] = make(map[common.Hash][]byte)
+
+			storeTrie, _ := trie.New(common.Hash{}, db)
+			for j := byte(1); j <= i; j++ {
+				slot := crypto.Keccak256Hash([]byte{i, j})
+				value, _ := rlp.EncodeToBytes([]byte{j})
+
+				storeTrie.Update(slot[:], value)
+				content.storage[hash][slot] = value
+			}
+			acc.Root, _ = storeTrie.Commit()
+		}
+		blob, _ := rlp.EncodeToBytes(&acc)
+		accTrie.Update(hash[:], blob)
+		content.accounts[hash] = blob
+	}
+	root, _ := accTrie.Commit()
+	return root, content
+}
+
+// waitGeneration blocks until the generator of a disk layer finishes.
+func waitGeneration(t *testing.T, dl *diskLayer) {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		dl.lock.RLock()
+		done := dl.genMarker == nil
+		dl.lock.RUnlock()
+
+		if done {
+			return
+		}
+	}
+	t.Fatalf("snapshot generation timed out")
+}
+
+// checkSnapshot verifies that a snapshot contains exactly the given content.
+func checkSnapshot(t *testing.T, snap Snapshot, content *testState) {
+	for hash, want := range content.accounts {
+		if have, err := snap.Account(hash); err != nil || !bytes.Equal(have, want) {
+			t.Errorf("account %x: have %x/%v, want %x", hash, have, err, want)
+		}
+		for slot, want := range content.storage[hash] {
+			if have, err := snap.Storage(hash, slot); err != nil || !bytes.Equal(have, want) {
+				t.Errorf("account %x slot %x: have %x/%v, want %x", hash, slot, have, err, want)
+			}
+		}
+	}
+}
+
+// checkDiskContent verifies that the database contains exactly the given flat
+// state, without any leftovers.
+func checkDiskContent(t *testing.T, db *ethdb.MemDatabase, content *testState) {
+	var accounts, slots int
+	for _, key := range db.Keys() {
+		switch {
+		case len(key) == accountKeyLength && bytes.HasPrefix(key, accountPrefix):
+			if _, ok := content.accounts[common.BytesToHash(key[1:])]; !ok {
+				t.Errorf("stale account %x", key[1:])
+			}
+			accounts++
+		case len(key) == storageKeyLength && bytes.HasPrefix(key, storagePrefix):
+			if _, ok := content.storage[common.BytesToHash(key[1:33])][common.BytesToHash(key[33:])]; !ok {
+				t.Errorf("stale slot %x", key[1:])
+			}
+			slots++
+		}
+	}
+	if accounts != len(content.accounts) {
+		t.Errorf("account count mismatch: have %d, want %d", accounts, len(content.accounts))
+	}
+	want := 0
+	for _, storage := range content.storage {
+		want += len(storage)
+	}
+	if slots != want {
+		t.Errorf("slot count mismatch: have %d, want %d", slots, want)
+	}
+}
+
+// Tests that a snapshot can be generated from a state trie, and that a partial
+// generation can be resumed, wiping any stale data left behind.
+func TestGeneration(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	root, content := makeTestState(db)
+
+	snaps, err := New(db, root)
+	if err != nil {
+		t.Fatalf("failed to create snapshot tree: %v", err)
+	}
+	waitGeneration(t, snaps.layers[root].(*diskLayer))
+	checkSnapshot(t, snaps.Snapshot(root), content)
+	checkDiskContent(t, db, content)
+	snaps.Release()
+
+	// Pollute the snapshot beyond a midway marker and resume the generation
+	var marker common.Hash
+	for hash := range content.storage {
+		if bytes.Compare(marker[:], hash[:]) < 0 && bytes.Compare(hash[:], common.HexToHash("0x80").Bytes()) < 0 {
+			marker = hash
+		}
+	}
+	stale := common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	db.Put(accountKey(stale), []byte{0x01})
+	db.Put(storageKey(stale, stale), []byte{0x01})
+	for hash := range content.storage {
+		if bytes.Compare(hash[:], marker[:]) > 0 {
+			db.Put(storageKey(hash, stale), []byte{0x01})
+		}
+	}
+	db.Put(snapshotGeneratorKey, marker[:])
+
+	if snaps, err = New(db, root); err != nil {
+		t.Fatalf("failed to reload snapshot tree: %v", err)
+	}
+	waitGeneration(t, snaps.layers[root].(*diskLayer))
+	checkSnapshot(t, snaps.Snapshot(root), content)
+	checkDiskContent(t, db, content)
+	snaps.Release()
+
+	// Reload the snapshot for a different root and ensure it's regenerated
+	db.Put(snapshotRootKey, stale[:])
+	if snaps, err = New(db, root); err != nil {
+		t.Fatalf("failed to reload snapshot tree: %v", err)
+	}
+	waitGeneration(t, snaps.layers[root].(*diskLayer))
+	checkSnapshot(t, snaps.Snapshot(root), content)
+	snaps.Release()
+}
+
+// Tests that diff layers shadow the data in their parents, and that flattening
+// them into the disk layer produces the same results.
+func TestDiffLayers(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	root, content := makeTestState(db)
+
+	snaps, _ := New(db, root)
+	waitGeneration(t, snaps.layers[root].(*diskLayer))
+
+	// Pick an account with storage to destruct, one to modify and one to create
+	var destructed, modified common.Hash
+	for hash := range content.storage {
+		if len(content.storage[hash]) > 0 {
+			if destructed == (common.Hash{}) {
+				destructed = hash
+			} else {
+				modified = hash
+				break
+			}
+		}
+	}
+	created := common.HexToHash("0x01")
+
+	// Stack a few diff layers containing all the modifications
+	root1, root2, root3 := common.HexToHash("0x11"), common.HexToHash("0x22"), common.HexToHash("0x33")
+	if err := snaps.Update(root1, root, map[common.Hash]struct{}{destructed: {}}, map[common.Hash][]byte{}, map[common.Hash]map[common.Hash][]byte{}); err != nil {
+		t.Fatalf("failed to add layer 1: %v", err)
+	}
+	var slot common.Hash
+	for slot = range content.storage[modified] {
+		break
+	}
+	if err := snaps.Update(root2, root1, map[common.Hash]struct{}{}, map[common.Hash][]byte{modified: {0x02}, created: {0x03}}, map[common.Hash]map[common.Hash][]byte{
+		modified: {slot: nil},
+		created:  {slot: {0x04}},
+	}); err != nil {
+		t.Fatalf("failed to add layer 2: %v", err)
+	}
+	if err := snaps.Update(root3, root2, map[common.Hash]struct{}{}, map[common.Hash][]byte{created: {0x05}}, map[common.Hash]map[common.Hash][]byte{}); err != nil {
+		t.Fatalf("failed to add layer 3: %v", err)
+	}
+	if err := snaps.Update(root3, root3, nil, nil, nil); err != errSnapshotCycle {
+		t.Errorf("cyclic update error mismatch: have %v, want %v", err, errSnapshotCycle)
+	}
+	// Assemble the expected content after all the layers
+	want := &testState{
+		accounts: make(map[common.Hash][]byte),
+		storage:  make(map[common.Hash]map[common.Hash][]byte),
+	}
+	for hash, blob := range content.accounts {
+		want.accounts[hash] = blob
+	}
+	for hash, storage := range content.storage {
+		want.storage[hash] = make(map[common.Hash][]byte)
+		for key, value := range storage {
+			want.storage[hash][key] = value
+		}
+	}
+	delete(want.accounts, destructed)
+	delete(want.storage, destructed)
+	want.accounts[modified] = []byte{0x02}
+	delete(want.storage[modified], slot)
+	want.accounts[created] = []byte{0x05}
+	want.storage[created] = map[common.Hash][]byte{slot: {0x04}}
+
+	check := func(snap Snapshot) {
+		checkSnapshot(t, snap, want)
+		if blob, err := snap.Account(destructed); err != nil || blob != nil {
+			t.Errorf("destructed account: have %x/%v, want nil", blob, err)
+		}
+		for key := range content.storage[destructed] {
+			if blob, err := snap.Storage(destructed, key); err != nil || blob != nil {
+				t.Errorf("destructed slot %x: have %x/%v, want nil", key, blob, err)
+			}
+		}
+		if blob, err := snap.Storage(modified, slot); err != nil || blob != nil {
+			t.Errorf("deleted slot: have %x/%v, want nil", blob, err)
+		}
+	}
+	check(snaps.Snapshot(root3))
+
+	// Flatten the bottom layers, ensure they get stale and the data's unchanged
+	disk, layer1 := snaps.layers[root], snaps.layers[root1]
+	if err := snaps.Cap(root3, 1); err != nil {
+		t.Fatalf("failed to cap snapshot tree: %v", err)
+	}
+	if _, err := disk.Account(modified); err != errSnapshotStale {
+		t.Errorf("flattened disk layer error mismatch: have %v, want %v", err, errSnapshotStale)
+	}
+	if _, err := layer1.Account(modified); err != errSnapshotStale {
+		t.Errorf("flattened diff layer error mismatch: have %v, want %v", err, errSnapshotStale)
+	}
+	if snaps.Snapshot(root) != nil || snaps.Snapshot(root1) != nil {
+		t.Errorf("flattened layers still in the tree")
+	}
+	if _, ok := snaps.layers[root2].(*diskLayer); !ok {
+		t.Errorf("disk layer not moved to layer 2")
+	}
+	check(snaps.Snapshot(root3))
+
+	// Flatten everything and ensure the disk contents match
+	if err := snaps.Cap(root3, 0); err != nil {
+		t.Fatalf("failed to cap snapshot tree: %v", err)
+	}
+	check(snaps.Snapshot(root3))
+	checkDiskContent(t, db, want)
+
+	// Reload the snapshot from disk and ensure it's accepted
+	snaps.Release()
+	if snaps, _ = New(db, root3); snaps.layers[root3].(*diskLayer).genMarker != nil {
+		t.Fatalf("persisted snapshot regenerated")
+	}
+	check(snaps.Snapshot(root3))
+}
+
+// Tests that capping the tree drops side branches not built on top of the new
+// disk layer.
+func TestCapDropsSideBranches(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	root, _ := makeTestState(db)
+
+	snaps, _ := New(db, root)
+	waitGeneration(t, snaps.layers[root].(*diskLayer))
+
+	var (
+		empty = map[common.Hash]struct{}{}
+		none  = map[common.Hash][]byte{}
+		slots = map[common.Hash]map[common.Hash][]byte{}
+
+		a1, a2 = common.HexToHash("0xa1"), common.HexToHash("0xa2")
+		b1, b2 = common.HexToHash("0xb1"), common.HexToHash("0xb2")
+	)
+	snaps.Update(a1, root, empty, none, slots)
+	snaps.Update(a2, a1, empty, none, slots)
+	snaps.Update(b1, root, empty, none, slots)
+	snaps.Update(b2, b1, empty, none, slots)
+
+	side := snaps.Snapshot(b2)
+	if err := snaps.Cap(a2, 1); err != nil {
+		t.Fatalf("failed to cap snapshot tree: %v", err)
+	}
+	if snaps.Snapshot(b1) != nil || snaps.Snapshot(b2) != nil {
+		t.Errorf("side branch not dropped")
+	}
+	if _, err := side.Account(common.Hash{}); err != errSnapshotStale {
+		t.Errorf("dropped layer error mismatch: have %v, want %v", err, errSnapshotStale)
+	}
+	if snaps.Snapshot(a1) == nil || snaps.Snapshot(a2) == nil {
+		t.Errorf("canonical branch dropped")
+	}
+}
@@ -19,9 +19,12 @@ package state
 import (
 	"bytes"
 	"math/big"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 	checker "gopkg.in/check.v1"
@@ -86,6 +89,96 @@ func (s *StateSuite) TestDump(c *checker.C) {
 	}
 }
 
+// Tests that paging through the state with iterative dumps returns the same
+// accounts as a full dump, both with and without a backing snapshot.
+func TestIteratorDump(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	sdb := NewDatabase(db)
+
+	state, _ := New(common.Hash{}, sdb)
+	for i := byte(0); i < 40; i++ {
+		addr := common.BytesToAddress([]byte{i})
+		state.AddBalance(addr, big.NewInt(int64(i)+1))
+		if i%3 == 0 {
+			state.SetState(addr, common.BytesToHash([]byte{i}), common.BytesToHash([]byte{i, i}))
+		}
+		if i%5 == 0 {
+			state.SetCode(addr, []byte{i, i})
+		}
+	}
+	root, _ := state.CommitTo(db, false)
+
+	snaps, _ := snapshot.New(db, root)
+	defer snaps.Release()
+
+	last := common.BytesToHash(bytes.Repeat([]byte{0xff}, common.HashLength))
+	for {
+		if _, err := snaps.Snapshot(root).Account(last); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Add a diff layer on top of the generated snapshot
+	state, _ = NewWithSnapshots(root, sdb, snaps)
+	state.Suicide(common.BytesToAddress([]byte{3}))
+	state.SetState(common.BytesToAddress([]byte{6}), common.BytesToHash([]byte{6, 6}), common.BytesToHash([]byte{6}))
+	state.AddBalance(common.BytesToAddress([]byte{200}), big.NewInt(200))
+	root, _ = state.CommitTo(db, true)
+
+	trieState, _ := New(root, sdb)
+	want := trieState.RawDump()
+
+	snapState, _ := NewWithSnapshots(root, sdb, snaps)
+	if snapState.snap == nil {
+		t.Fatalf("state not backed by snapshot")
+	}
+	for i, state := range []*StateDB{trieState, snapState} {
+		have := make(map[string]DumpAccount)
+		for start := []byte{}; ; {
+			dump, err := state.IteratorDump(start, 7, false)
+			if err != nil {
+				t.Fatalf("state %d: dump failed: %v", i, err)
+			}
+			if dump.Root != want.Root {
+				t.Fatalf("state %d: root mismatch: have %s, want %s", i, dump.Root, want.Root)
+			}
+			if len(dump.Accounts) > 7 {
+				t.Fatalf("state %d: page too large: %d accounts", i, len(dump.Accounts))
+			}
+			for addr, account := range dump.Accounts {
+				if _, ok := have[addr]; ok {
+					t.Fatalf("state %d: account %s dumped twice", i, addr)
+				}
+				have[addr] = account
+			}
+			if len(dump.Next) == 0 {
+				break
+			}
+			start = dump.Next
+		}
+		if !reflect.DeepEqual(have, want.Accounts) {
+			t.Errorf("state %d: dump mismatch:\nhave %v\nwant %v", i, have, want.Accounts)
+		}
+		// Ensure the storage is left out if excluded
+		dump, err := state.IteratorDump(nil, 0, true)
+		if err != nil {
+			t.Fatalf("state %d: storageless dump failed: %v", i, err)
+		}
+		for addr, account := range dump.Accounts {
+			if account.Storage != nil {
+				t.Errorf("state %d: account %s storage dumped", i, addr)
+			}
+			account.Storage = want.Accounts[addr].Storage
+			if !reflect.DeepEqual(account, want.Accounts[addr]) {
+				t.Errorf("state %d: account %s mismatch: have %v, want %v", i, addr, account, want.Accounts[addr])
+			}
+		}
+		if len(dump.Accounts) != len(want.Accounts) {
+			t.Errorf("state %d: storageless dump account count mismatch: have %d, want %d", i, len(dump.Accounts), len(want.Accounts))
+		}
+	}
+}
+
 func (s *StateSuite) SetUpTest(c *checker.C) {
 	s.db, _ = ethdb.NewMemDatabase()
 	s.state, _ = New(common.Hash{}, NewDatabase(s.db))
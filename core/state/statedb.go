@@ -24,6 +24,7 @@ import (
 	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
@@ -45,6 +46,20 @@ type StateDB struct {
 	db   Database
 	trie Trie
 
+	// Flat state snapshot serving reads, and the changes to feed it on commit.
+	// The snapshot is nil if the tree doesn't contain the state's root.
+	snaps         *snapshot.Tree
+	snap          snapshot.Snapshot
+	snapDestructs map[common.Hash]struct{}
+	snapAccounts  map[common.Hash][]byte
+	snapStorage   map[common.Hash]map[common.Hash][]byte
+
+	// Background loader of the trie nodes touched by finalised transactions,
+	// along with the account trie root it's prefetching from (zeroed once the
+	// prefetched account trie was picked up).
+	prefetcher   *triePrefetcher
+	prefetchRoot common.Hash
+
 	// This map holds 'live' objects, which will get modified while processing a state transition.
 	stateObjects           map[common.Address]*stateObject
 	stateObjectsDirty      map[common.Address]struct{}
@@ -67,6 +82,9 @@ type StateDB struct {
 
 	preimages map[common.Hash][]byte
 
+	// Accounts and storage slots accessed by the current transaction (EIP-2929).
+	accessList accessList
+
 	// Journal of state modifications. This is the backbone of
 	// Snapshot and RevertToSnapshot.
 	journal        journal
@@ -78,20 +96,45 @@ type StateDB struct {
 
 // Create a new state from a given trie
 func New(root common.Hash, db Database) (*StateDB, error) {
+	return NewWithSnapshots(root, db, nil)
+}
+
+// NewWithSnapshots creates a new state from a given trie, serving account and
+// storage reads from the snapshot tree if it contains the state, and adding the
+// state changes into the tree on commit.
+func NewWithSnapshots(root common.Hash, db Database, snaps *snapshot.Tree) (*StateDB, error) {
 	tr, err := db.OpenTrie(root)
 	if err != nil {
 		return nil, err
 	}
-	return &StateDB{
+	sdb := &StateDB{
 		db:                     db,
 		trie:                   tr,
+		snaps:                  snaps,
 		stateObjects:           make(map[common.Address]*stateObject),
 		stateObjectsDirty:      make(map[common.Address]struct{}),
 		stateObjectsDestructed: make(map[common.Address]struct{}),
 		refund:                 new(big.Int),
 		logs:                   make(map[common.Hash][]*types.Log),
 		preimages:              make(map[common.Hash][]byte),
-	}, nil
+		accessList:             make(accessList),
+	}
+	sdb.openSnapshot(root)
+	return sdb, nil
+}
+
+// openSnapshot looks up the snapshot of the given state root in the snapshot
+// tree, resetting the tracked snapshot changes.
+func (self *StateDB) openSnapshot(root common.Hash) {
+	self.snap, self.snapDestructs, self.snapAccounts, self.snapStorage = nil, nil, nil, nil
+	if self.snaps == nil {
+		return
+	}
+	if self.snap = self.snaps.Snapshot(root); self.snap != nil {
+		self.snapDestructs = make(map[common.Hash]struct{})
+		self.snapAccounts = make(map[common.Hash][]byte)
+		self.snapStorage = make(map[common.Hash]map[common.Hash][]byte)
+	}
 }
 
 // setError remembers the first non-nil error it is called with.
@@ -122,6 +165,8 @@ func (self *StateDB) Reset(root common.Hash) error {
 	self.logs = make(map[common.Hash][]*types.Log)
 	self.logSize = 0
 	self.preimages = make(map[common.Hash][]byte)
+	self.accessList = make(accessList)
+	self.openSnapshot(root)
 	self.clearJournalAndRefund()
 	return nil
 }
@@ -250,6 +295,45 @@ func (self *StateDB) StorageTrie(a common.Address) Trie {
 	return cpy.updateTrie(self.db)
 }
 
+// GetStorageRoot returns the root hash of the storage trie of an account as of
+// the last commit, or the zero hash for non-existent accounts.
+func (self *StateDB) GetStorageRoot(addr common.Address) common.Hash {
+	stateObject := self.getStateObject(addr)
+	if stateObject == nil {
+		return common.Hash{}
+	}
+	return stateObject.data.Root
+}
+
+// proofList collects the encoded nodes of a Merkle proof in path order.
+type proofList [][]byte
+
+func (n *proofList) Put(key []byte, value []byte) error {
+	*n = append(*n, common.CopyBytes(value))
+	return nil
+}
+
+// GetProof returns the Merkle proof of the account at the given address, from
+// the state root down to the account or to the node proving its absence.
+func (self *StateDB) GetProof(addr common.Address) ([][]byte, error) {
+	var proof proofList
+	err := self.trie.Prove(addr.Bytes(), 0, &proof)
+	return proof, err
+}
+
+// GetStorageProof returns the Merkle proof of a storage slot of an account,
+// against the storage root returned by GetStorageRoot. The proof of a
+// non-existent account is empty.
+func (self *StateDB) GetStorageProof(addr common.Address, key common.Hash) ([][]byte, error) {
+	var proof proofList
+	stateObject := self.getStateObject(addr)
+	if stateObject == nil {
+		return proof, nil
+	}
+	err := stateObject.getTrie(self.db).Prove(key.Bytes(), 0, &proof)
+	return proof, err
+}
+
 func (self *StateDB) HasSuicided(addr common.Address) bool {
 	stateObject := self.getStateObject(addr)
 	if stateObject != nil {
@@ -306,6 +390,15 @@ func (self *StateDB) SetState(addr common.Address, key common.Hash, value common
 	}
 }
 
+// SetStorage replaces the entire storage for the specified account with given
+// storage. This function should only be used for debugging.
+func (self *StateDB) SetStorage(addr common.Address, storage map[common.Hash]common.Hash) {
+	stateObject := self.GetOrNewStateObject(addr)
+	if stateObject != nil {
+		stateObject.SetStorage(storage)
+	}
+}
+
 // Suicide marks the given account as suicided.
 // This clears the account balance.
 //
@@ -340,6 +433,10 @@ func (self *StateDB) updateStateObject(stateObject *stateObject) {
 		panic(fmt.Errorf("can't encode object at %x: %v", addr[:], err))
 	}
 	self.setError(self.trie.TryUpdate(addr[:], data))
+
+	if self.snap != nil {
+		self.snapAccounts[stateObject.addrHash] = data
+	}
 }
 
 // deleteStateObject removes the given object from the state trie.
@@ -347,6 +444,12 @@ func (self *StateDB) deleteStateObject(stateObject *stateObject) {
 	stateObject.deleted = true
 	addr := stateObject.Address()
 	self.setError(self.trie.TryDelete(addr[:]))
+
+	if self.snap != nil {
+		self.snapDestructs[stateObject.addrHash] = struct{}{}
+		delete(self.snapAccounts, stateObject.addrHash)
+		delete(self.snapStorage, stateObject.addrHash)
+	}
 }
 
 // Retrieve a state object given my the address. Returns nil if not found.
@@ -359,8 +462,17 @@ func (self *StateDB) getStateObject(addr common.Address) (stateObject *stateObje
 		return obj
 	}
 
-	// Load the object from the database.
-	enc, err := self.trie.TryGet(addr[:])
+	// Load the object from the snapshot, or from the trie if not available.
+	var (
+		enc []byte
+		err error
+	)
+	if self.snap != nil {
+		enc, err = self.snap.Account(crypto.Keccak256Hash(addr[:]))
+	}
+	if self.snap == nil || err != nil {
+		enc, err = self.trie.TryGet(addr[:])
+	}
 	if len(enc) == 0 {
 		self.setError(err)
 		return nil
@@ -372,6 +484,7 @@ func (self *StateDB) getStateObject(addr common.Address) (stateObject *stateObje
 	}
 	// Insert into the live set.
 	obj := newObject(self, addr, data, self.MarkStateObjectDirty)
+	obj.persisted = true
 	self.setStateObject(obj)
 	return obj
 }
@@ -458,6 +571,8 @@ func (self *StateDB) Copy() *StateDB {
 	state := &StateDB{
 		db:                     self.db,
 		trie:                   self.trie,
+		snaps:                  self.snaps,
+		snap:                   self.snap,
 		stateObjects:           make(map[common.Address]*stateObject, len(self.stateObjectsDirty)),
 		stateObjectsDirty:      make(map[common.Address]struct{}, len(self.stateObjectsDirty)),
 		stateObjectsDestructed: make(map[common.Address]struct{}, len(self.stateObjectsDestructed)),
@@ -465,6 +580,7 @@ func (self *StateDB) Copy() *StateDB {
 		logs:                   make(map[common.Hash][]*types.Log, len(self.logs)),
 		logSize:                self.logSize,
 		preimages:              make(map[common.Hash][]byte),
+		accessList:             self.accessList.copy(),
 	}
 	// Copy the dirty states, logs, and preimages
 	for addr := range self.stateObjectsDirty {
@@ -481,6 +597,23 @@ func (self *StateDB) Copy() *StateDB {
 	for hash, preimage := range self.preimages {
 		state.preimages[hash] = preimage
 	}
+	if self.snap != nil {
+		state.snapDestructs = make(map[common.Hash]struct{}, len(self.snapDestructs))
+		for hash := range self.snapDestructs {
+			state.snapDestructs[hash] = struct{}{}
+		}
+		state.snapAccounts = make(map[common.Hash][]byte, len(self.snapAccounts))
+		for hash, blob := range self.snapAccounts {
+			state.snapAccounts[hash] = blob
+		}
+		state.snapStorage = make(map[common.Hash]map[common.Hash][]byte, len(self.snapStorage))
+		for hash, slots := range self.snapStorage {
+			state.snapStorage[hash] = make(map[common.Hash][]byte, len(slots))
+			for key, blob := range slots {
+				state.snapStorage[hash][key] = blob
+			}
+		}
+	}
 	return state
 }
 
@@ -524,6 +657,7 @@ func (self *StateDB) GetRefund() *big.Int {
 // It is called in between transactions to get the root hash that
 // goes into transaction receipts.
 func (s *StateDB) IntermediateRoot(deleteEmptyObjects bool) common.Hash {
+	s.usePrefetcher()
 	for addr := range s.stateObjectsDirty {
 		stateObject := s.stateObjects[addr]
 		if stateObject.suicided || (deleteEmptyObjects && stateObject.empty()) {
@@ -546,6 +680,61 @@ func (self *StateDB) Prepare(thash, bhash common.Hash, ti int) {
 	self.txIndex = ti
 }
 
+// PrepareAccessList resets the access list for a new transaction and warms up
+// the sender, the destination (if any), the precompiles and everything declared
+// in the transaction's own access list. It should only be called if the Berlin
+// rules (EIP-2929 and EIP-2930) are active.
+func (self *StateDB) PrepareAccessList(sender common.Address, dst *common.Address, precompiles []common.Address, list types.AccessList) {
+	self.accessList = make(accessList)
+	self.AddAddressToAccessList(sender)
+	if dst != nil {
+		self.AddAddressToAccessList(*dst)
+	}
+	for _, addr := range precompiles {
+		self.AddAddressToAccessList(addr)
+	}
+	for _, tuple := range list {
+		self.AddAddressToAccessList(tuple.Address)
+		for _, key := range tuple.StorageKeys {
+			self.AddSlotToAccessList(tuple.Address, key)
+		}
+	}
+}
+
+// AddAddressToAccessList adds the given address to the access list.
+func (self *StateDB) AddAddressToAccessList(addr common.Address) {
+	if self.accessList.containsAddress(addr) {
+		return
+	}
+	self.accessList[addr] = make(map[common.Hash]struct{})
+	self.journal = append(self.journal, accessListAddAccountChange{&addr})
+}
+
+// AddSlotToAccessList adds the given (address, slot) pair to the access list,
+// adding the address too if it's not yet present.
+func (self *StateDB) AddSlotToAccessList(addr common.Address, slot common.Hash) {
+	addrOk, slotOk := self.accessList.contains(addr, slot)
+	if !addrOk {
+		self.AddAddressToAccessList(addr)
+	}
+	if slotOk {
+		return
+	}
+	self.accessList[addr][slot] = struct{}{}
+	self.journal = append(self.journal, accessListAddSlotChange{address: &addr, slot: &slot})
+}
+
+// AddressInAccessList returns whether the address is in the access list.
+func (self *StateDB) AddressInAccessList(addr common.Address) bool {
+	return self.accessList.containsAddress(addr)
+}
+
+// SlotInAccessList returns whether the address and the (address, slot) pair
+// are in the access list.
+func (self *StateDB) SlotInAccessList(addr common.Address, slot common.Hash) (addressOk bool, slotOk bool) {
+	return self.accessList.contains(addr, slot)
+}
+
 // Finalise finalises the state by removing the self destructed objects
 // in the current stateObjectsDestructed buffer and clears the journal
 // as well as the refunds.
@@ -557,6 +746,70 @@ func (s *StateDB) Finalise() {
 		s.deleteStateObject(s.stateObjects[addr])
 	}
 	s.clearJournalAndRefund()
+
+	if s.prefetcher != nil {
+		s.schedulePrefetch()
+	}
+}
+
+// StartPrefetcher starts loading the trie nodes of the accounts and storage
+// slots modified by each finalised transaction in the background, so they're
+// available by the time the state is hashed and committed.
+func (s *StateDB) StartPrefetcher() {
+	s.StopPrefetcher()
+	s.prefetcher = newTriePrefetcher(s.db)
+	s.prefetchRoot = s.trie.Hash()
+}
+
+// StopPrefetcher terminates a running prefetcher, discarding its tries.
+func (s *StateDB) StopPrefetcher() {
+	if s.prefetcher != nil {
+		s.prefetcher.close()
+		s.prefetcher = nil
+	}
+}
+
+// schedulePrefetch schedules the accounts and storage slots of all the dirty
+// objects for prefetching. Storage tries already opened by their objects are
+// not prefetched, as they can't be replaced any more.
+func (s *StateDB) schedulePrefetch() {
+	addrs := make([][]byte, 0, len(s.stateObjectsDirty))
+	for addr := range s.stateObjectsDirty {
+		addrs = append(addrs, common.CopyBytes(addr[:]))
+
+		obj := s.stateObjects[addr]
+		if obj.trie != nil || len(obj.dirtyStorage) == 0 {
+			continue
+		}
+		keys := make([][]byte, 0, len(obj.dirtyStorage))
+		for key := range obj.dirtyStorage {
+			keys = append(keys, common.CopyBytes(key[:]))
+		}
+		addrHash := obj.addrHash
+		s.prefetcher.prefetch(obj.data.Root, &addrHash, keys)
+	}
+	s.prefetcher.prefetch(s.prefetchRoot, nil, addrs)
+}
+
+// usePrefetcher replaces the account trie with the prefetched one. Accounts
+// deleted by Finalise since are deleted from the prefetched trie too, and it's
+// only used if it ends up matching the current one. The account trie is only
+// picked up once, as it's modified afterwards.
+func (s *StateDB) usePrefetcher() {
+	if s.prefetcher == nil || s.prefetchRoot == (common.Hash{}) {
+		return
+	}
+	tr := s.prefetcher.trie(s.prefetchRoot)
+	s.prefetchRoot = common.Hash{}
+	if tr == nil {
+		return
+	}
+	for addr := range s.stateObjectsDestructed {
+		tr.TryDelete(addr[:])
+	}
+	if tr.Hash() == s.trie.Hash() {
+		s.trie = tr
+	}
 }
 
 // DeleteSuicides flags the suicided objects for deletion so that it
@@ -590,6 +843,14 @@ func (s *StateDB) clearJournalAndRefund() {
 func (s *StateDB) CommitTo(dbw trie.DatabaseWriter, deleteEmptyObjects bool) (root common.Hash, err error) {
 	defer s.clearJournalAndRefund()
 
+	s.usePrefetcher()
+
+	// Contract code isn't referenced by any trie node, so it bypasses the memory
+	// cache of node databases, otherwise it would never be persisted.
+	codew := dbw
+	if triedb, ok := dbw.(*trie.NodeDatabase); ok {
+		codew = triedb.DiskDB()
+	}
 	// Commit objects to the trie.
 	for addr, stateObject := range s.stateObjects {
 		_, isDirty := s.stateObjectsDirty[addr]
@@ -601,7 +862,7 @@ func (s *StateDB) CommitTo(dbw trie.DatabaseWriter, deleteEmptyObjects bool) (ro
 		case isDirty:
 			// Write any contract code associated with the state object
 			if stateObject.code != nil && stateObject.dirtyCode {
-				if err := dbw.Put(stateObject.CodeHash(), stateObject.code); err != nil {
+				if err := codew.Put(stateObject.CodeHash(), stateObject.code); err != nil {
 					return common.Hash{}, err
 				}
 				stateObject.dirtyCode = false
@@ -618,5 +879,16 @@ func (s *StateDB) CommitTo(dbw trie.DatabaseWriter, deleteEmptyObjects bool) (ro
 	// Write trie changes.
 	root, err = s.trie.CommitTo(dbw)
 	log.Debug("Trie cache stats after commit", "misses", trie.CacheMisses(), "unloads", trie.CacheUnloads())
+
+	// Feed the state changes into the snapshot tree, the state is not tracked
+	// by the snapshot any more afterwards.
+	if err == nil && s.snap != nil {
+		if parent := s.snap.Root(); parent != root {
+			if err := s.snaps.Update(root, parent, s.snapDestructs, s.snapAccounts, s.snapStorage); err != nil {
+				log.Warn("Failed to update snapshot tree", "from", parent, "to", root, "err", err)
+			}
+		}
+		s.snap, s.snapDestructs, s.snapAccounts, s.snapStorage = nil, nil, nil, nil
+	}
 	return root, err
 }
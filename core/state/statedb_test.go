@@ -27,12 +27,17 @@ import (
 	"strings"
 	"testing"
 	"testing/quick"
+	"time"
 
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	check "gopkg.in/check.v1"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
 )
 
 // Tests that updating a state trie does not leak any database writes prior to
@@ -372,3 +377,226 @@ func (s *StateSuite) TestTouchDelete(c *check.C) {
 		c.Fatal("expected no dirty state object")
 	}
 }
+
+// Tests that states backed by a snapshot read the same data as the ones backed
+// by the trie only, and that committed changes are fed into the snapshot tree.
+func TestSnapshotBackedState(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	sdb := NewDatabase(db)
+
+	// Create an initial state and generate a snapshot for it
+	state, _ := New(common.Hash{}, sdb)
+	for i := byte(0); i < 64; i++ {
+		addr := common.BytesToAddress([]byte{i})
+		state.AddBalance(addr, big.NewInt(int64(i)+1))
+		if i%2 == 0 {
+			state.SetState(addr, common.BytesToHash([]byte{i}), common.BytesToHash([]byte{i, i}))
+			state.SetState(addr, common.BytesToHash([]byte{i, 1}), common.BytesToHash([]byte{i, i, 1}))
+		}
+	}
+	root, _ := state.CommitTo(db, false)
+
+	snaps, _ := snapshot.New(db, root)
+	defer snaps.Release()
+
+	last := common.BytesToHash(bytes.Repeat([]byte{0xff}, common.HashLength))
+	for {
+		if _, err := snaps.Snapshot(root).Account(last); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Modify the state through a snapshot backed state in a few transactions
+	var (
+		resurrected = common.BytesToAddress([]byte{2})
+		modified    = common.BytesToAddress([]byte{4})
+		created     = common.BytesToAddress([]byte{200})
+	)
+	state, _ = NewWithSnapshots(root, sdb, snaps)
+	state.Suicide(resurrected)
+	state.SetState(modified, common.BytesToHash([]byte{4}), common.Hash{})
+	state.SetState(modified, common.BytesToHash([]byte{4, 2}), common.BytesToHash([]byte{1}))
+	state.IntermediateRoot(true)
+
+	state.CreateAccount(resurrected)
+	state.SetState(resurrected, common.BytesToHash([]byte{2, 2}), common.BytesToHash([]byte{2}))
+	state.SetState(created, common.BytesToHash([]byte{200}), common.BytesToHash([]byte{200}))
+	state.AddBalance(common.BytesToAddress([]byte{3}), big.NewInt(100))
+
+	root, _ = state.CommitTo(db, true)
+	if snaps.Snapshot(root) == nil {
+		t.Fatalf("committed state missing from snapshot tree")
+	}
+	// Ensure the snapshot backed state matches the trie one, even after
+	// flattening the updates into the disk layer
+	check := func() {
+		snapState, _ := NewWithSnapshots(root, sdb, snaps)
+		trieState, _ := New(root, sdb)
+		if snapState.snap == nil {
+			t.Fatalf("state not backed by snapshot")
+		}
+		for i := 0; i < 256; i++ {
+			addr := common.BytesToAddress([]byte{byte(i)})
+			if have, want := snapState.Exist(addr), trieState.Exist(addr); have != want {
+				t.Errorf("account %x: existence mismatch: have %v, want %v", addr, have, want)
+			}
+			if have, want := snapState.GetBalance(addr), trieState.GetBalance(addr); have.Cmp(want) != 0 {
+				t.Errorf("account %x: balance mismatch: have %v, want %v", addr, have, want)
+			}
+			for _, key := range [][]byte{{byte(i)}, {byte(i), 1}, {byte(i), 2}} {
+				slot := common.BytesToHash(key)
+				if have, want := snapState.GetState(addr, slot), trieState.GetState(addr, slot); have != want {
+					t.Errorf("account %x, slot %x: value mismatch: have %x, want %x", addr, slot, have, want)
+				}
+			}
+		}
+	}
+	check()
+	if err := snaps.Cap(root, 0); err != nil {
+		t.Fatalf("failed to flatten snapshot: %v", err)
+	}
+	check()
+}
+
+// Tests that access list additions are reverted along with snapshots.
+func TestAccessListRevert(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(db))
+
+	var (
+		sender = common.Address{0x01}
+		dst    = common.Address{0x02}
+		other  = common.Address{0x03}
+		slot   = common.Hash{0x01}
+	)
+	state.PrepareAccessList(sender, &dst, nil, types.AccessList{{Address: other, StorageKeys: []common.Hash{slot}}})
+	if !state.AddressInAccessList(sender) || !state.AddressInAccessList(dst) {
+		t.Fatalf("sender or destination missing from access list")
+	}
+	if addrOk, slotOk := state.SlotInAccessList(other, slot); !addrOk || !slotOk {
+		t.Fatalf("declared slot missing from access list: address %v, slot %v", addrOk, slotOk)
+	}
+	snap := state.Snapshot()
+
+	fresh, freshSlot := common.Address{0x04}, common.Hash{0x02}
+	state.AddSlotToAccessList(fresh, freshSlot)
+	state.AddSlotToAccessList(dst, freshSlot)
+	if addrOk, slotOk := state.SlotInAccessList(fresh, freshSlot); !addrOk || !slotOk {
+		t.Fatalf("added slot missing from access list: address %v, slot %v", addrOk, slotOk)
+	}
+	state.RevertToSnapshot(snap)
+
+	if state.AddressInAccessList(fresh) {
+		t.Errorf("reverted address still in access list")
+	}
+	if addrOk, slotOk := state.SlotInAccessList(dst, freshSlot); !addrOk || slotOk {
+		t.Errorf("reverted slot state mismatch: address %v, slot %v", addrOk, slotOk)
+	}
+	if _, slotOk := state.SlotInAccessList(other, slot); !slotOk {
+		t.Errorf("declared slot lost during revert")
+	}
+}
+
+// Tests that overriding the storage of an account hides all of its original
+// slots, survives copies and is never written out.
+func TestSetStorage(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(db))
+
+	addr := common.Address{0x01}
+	state.SetState(addr, common.Hash{0x01}, common.Hash{0xaa})
+	root, _ := state.CommitTo(db, false)
+
+	state, _ = New(root, NewDatabase(db))
+	state.SetStorage(addr, map[common.Hash]common.Hash{{0x02}: {0xbb}})
+
+	for i, st := range []*StateDB{state, state.Copy()} {
+		if value := st.GetState(addr, common.Hash{0x01}); value != (common.Hash{}) {
+			t.Errorf("state %d: original slot visible: have %x, want zero", i, value)
+		}
+		if value := st.GetState(addr, common.Hash{0x02}); value != (common.Hash{0xbb}) {
+			t.Errorf("state %d: overridden slot mismatch: have %x, want %x", i, value, common.Hash{0xbb})
+		}
+	}
+	if have := state.IntermediateRoot(false); have != root {
+		t.Errorf("storage override leaked into the state root: have %x, want %x", have, root)
+	}
+}
+
+// Tests that the Merkle proofs of accounts and storage slots verify against the
+// state and storage roots, proving the absence of missing entries.
+func TestProofs(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(db))
+
+	addr := common.Address{0x01}
+	for i := byte(0); i < 16; i++ {
+		state.SetBalance(common.Address{i}, big.NewInt(int64(i)+1))
+		state.SetState(addr, common.Hash{i}, common.Hash{0xff, i})
+	}
+	root, _ := state.CommitTo(db, false)
+	state, _ = New(root, NewDatabase(db))
+
+	tests := []struct {
+		addr   common.Address
+		exists bool
+	}{
+		{addr, true},
+		{common.Address{0x0f}, true},
+		{common.Address{0xaa}, false},
+	}
+	for i, tt := range tests {
+		proof, err := state.GetProof(tt.addr)
+		if err != nil {
+			t.Fatalf("test %d: failed to prove account: %v", i, err)
+		}
+		value, err := trie.VerifyProof(root, crypto.Keccak256(tt.addr.Bytes()), proofDb(proof))
+		if err != nil {
+			t.Fatalf("test %d: invalid account proof: %v", i, err)
+		}
+		if (value != nil) != tt.exists {
+			t.Errorf("test %d: account existence mismatch: have %v, want %v", i, value != nil, tt.exists)
+		}
+	}
+	storageRoot := state.GetStorageRoot(addr)
+	for i, tt := range []struct {
+		key   common.Hash
+		value common.Hash
+	}{
+		{common.Hash{0x00}, common.Hash{0xff, 0x00}},
+		{common.Hash{0x0f}, common.Hash{0xff, 0x0f}},
+		{common.Hash{0xaa}, common.Hash{}},
+	} {
+		proof, err := state.GetStorageProof(addr, tt.key)
+		if err != nil {
+			t.Fatalf("slot %d: failed to prove slot: %v", i, err)
+		}
+		value, err := trie.VerifyProof(storageRoot, crypto.Keccak256(tt.key.Bytes()), proofDb(proof))
+		if err != nil {
+			t.Fatalf("slot %d: invalid storage proof: %v", i, err)
+		}
+		var have common.Hash
+		if value != nil {
+			var content []byte
+			if err := rlp.DecodeBytes(value, &content); err != nil {
+				t.Fatalf("slot %d: invalid slot encoding: %v", i, err)
+			}
+			have = common.BytesToHash(content)
+		}
+		if have != tt.value {
+			t.Errorf("slot %d: value mismatch: have %x, want %x", i, have, tt.value)
+		}
+	}
+	if proof, _ := state.GetStorageProof(common.Address{0xaa}, common.Hash{}); len(proof) != 0 {
+		t.Errorf("storage proof of missing account not empty: %d nodes", len(proof))
+	}
+}
+
+// proofDb stores the nodes of a Merkle proof keyed by their hash.
+func proofDb(proof [][]byte) *ethdb.MemDatabase {
+	db, _ := ethdb.NewMemDatabase()
+	for _, node := range proof {
+		db.Put(crypto.Keccak256(node), node)
+	}
+	return db
+}
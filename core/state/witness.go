@@ -0,0 +1,138 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/trie"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// WitnessRecorder is a state database recording all the trie nodes and contract
+// codes read from the underlying database, e.g. to assemble a witness for the
+// stateless execution of a block.
+//
+// Only data loaded from the underlying database is recorded, so the recorder must
+// not share tries with other state databases that might already have them cached.
+type WitnessRecorder struct {
+	Database // State database reading through the recorder
+
+	reads *readRecorder
+	codes map[common.Hash]struct{} // Hashes of all the contract codes accessed
+	lock  sync.Mutex
+}
+
+// NewWitnessRecorder creates a state database on top of db, which records all
+// the state data accessed through it.
+func NewWitnessRecorder(db trie.Database) *WitnessRecorder {
+	reads := &readRecorder{
+		Database: db,
+		seen:     make(map[common.Hash]struct{}),
+	}
+	csc, _ := lru.New(codeSizeCacheSize)
+	return &WitnessRecorder{
+		Database: &cachingDB{db: reads, codeSizeCache: csc},
+		reads:    reads,
+		codes:    make(map[common.Hash]struct{}),
+	}
+}
+
+// ContractCode retrieves a particular contract's code, recording it.
+func (r *WitnessRecorder) ContractCode(addrHash, codeHash common.Hash) ([]byte, error) {
+	r.lock.Lock()
+	r.codes[codeHash] = struct{}{}
+	r.lock.Unlock()
+
+	return r.Database.ContractCode(addrHash, codeHash)
+}
+
+// ContractCodeSize retrieves a particular contract's code size, recording the
+// code itself as it's needed to compute the size.
+func (r *WitnessRecorder) ContractCodeSize(addrHash, codeHash common.Hash) (int, error) {
+	code, err := r.ContractCode(addrHash, codeHash)
+	return len(code), err
+}
+
+// Nodes returns the trie nodes read from the database, in the order they were
+// first accessed.
+func (r *WitnessRecorder) Nodes() [][]byte {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.reads.collect(func(hash common.Hash) bool {
+		_, ok := r.codes[hash]
+		return !ok
+	})
+}
+
+// Codes returns the contract codes read from the database, in the order they
+// were first accessed.
+func (r *WitnessRecorder) Codes() [][]byte {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.reads.collect(func(hash common.Hash) bool {
+		_, ok := r.codes[hash]
+		return ok
+	})
+}
+
+// readRecorder is a database wrapper recording all the successful reads of hash
+// keyed entries (i.e. trie nodes and contract codes).
+type readRecorder struct {
+	trie.Database
+
+	seen   map[common.Hash]struct{}
+	hashes []common.Hash
+	blobs  [][]byte
+	lock   sync.Mutex
+}
+
+// Get retrieves a database entry, recording it if it's keyed by a hash.
+func (r *readRecorder) Get(key []byte) ([]byte, error) {
+	blob, err := r.Database.Get(key)
+	if err != nil || len(key) != common.HashLength {
+		return blob, err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	hash := common.BytesToHash(key)
+	if _, ok := r.seen[hash]; !ok {
+		r.seen[hash] = struct{}{}
+		r.hashes = append(r.hashes, hash)
+		r.blobs = append(r.blobs, common.CopyBytes(blob))
+	}
+	return blob, nil
+}
+
+// collect returns all the recorded entries accepted by the filter, in the order
+// they were first read.
+func (r *readRecorder) collect(filter func(common.Hash) bool) [][]byte {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var blobs [][]byte
+	for i, hash := range r.hashes {
+		if filter(hash) {
+			blobs = append(blobs, r.blobs[i])
+		}
+	}
+	return blobs
+}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
@@ -70,19 +71,22 @@ type Message interface {
 	To() *common.Address
 
 	GasPrice() *big.Int
+	GasFeeCap() *big.Int
+	GasTipCap() *big.Int
 	Gas() *big.Int
 	Value() *big.Int
 
 	Nonce() uint64
 	CheckNonce() bool
 	Data() []byte
+	AccessList() types.AccessList
 }
 
 // IntrinsicGas computes the 'intrinsic gas' for a message
-// with the given data.
+// with the given data and access list.
 //
 // TODO convert to uint64
-func IntrinsicGas(data []byte, contractCreation, homestead bool) *big.Int {
+func IntrinsicGas(data []byte, accessList types.AccessList, contractCreation, homestead bool) *big.Int {
 	igas := new(big.Int)
 	if contractCreation && homestead {
 		igas.SetUint64(params.TxGasContractCreation)
@@ -103,6 +107,14 @@ func IntrinsicGas(data []byte, contractCreation, homestead bool) *big.Int {
 		m.Mul(m, new(big.Int).SetUint64(params.TxDataZeroGas))
 		igas.Add(igas, m)
 	}
+	if accessList != nil {
+		m := big.NewInt(int64(len(accessList)))
+		m.Mul(m, new(big.Int).SetUint64(params.TxAccessListAddressGas))
+		igas.Add(igas, m)
+		m.SetInt64(int64(accessList.StorageKeys()))
+		m.Mul(m, new(big.Int).SetUint64(params.TxAccessListStorageKeyGas))
+		igas.Add(igas, m)
+	}
 	return igas
 }
 
@@ -112,7 +124,7 @@ func NewStateTransition(evm *vm.EVM, msg Message, gp *GasPool) *StateTransition
 		gp:         gp,
 		evm:        evm,
 		msg:        msg,
-		gasPrice:   msg.GasPrice(),
+		gasPrice:   effectiveGasPrice(msg, evm.BaseFee),
 		initialGas: new(big.Int),
 		value:      msg.Value(),
 		data:       msg.Data(),
@@ -120,18 +132,29 @@ func NewStateTransition(evm *vm.EVM, msg Message, gp *GasPool) *StateTransition
 	}
 }
 
+// effectiveGasPrice returns the price per gas the message actually pays: its gas
+// price before London, the tip on top of the base fee capped by the fee cap after.
+func effectiveGasPrice(msg Message, baseFee *big.Int) *big.Int {
+	if baseFee == nil {
+		return new(big.Int).Set(msg.GasPrice())
+	}
+	price := new(big.Int).Add(msg.GasTipCap(), baseFee)
+	return math.BigMin(price, msg.GasFeeCap())
+}
+
 // ApplyMessage computes the new state by applying the given message
 // against the old state within the environment.
 //
 // ApplyMessage returns the bytes returned by any EVM execution (if it took place),
-// the gas used (which includes gas refunds) and an error if it failed. An error always
-// indicates a core error meaning that the message would always fail for that particular
-// state and would never be accepted within a block.
-func ApplyMessage(evm *vm.EVM, msg Message, gp *GasPool) ([]byte, *big.Int, error) {
+// the gas used (which includes gas refunds), whether the execution failed in the
+// EVM and an error if it failed. An error always indicates a core error meaning
+// that the message would always fail for that particular state and would never
+// be accepted within a block.
+func ApplyMessage(evm *vm.EVM, msg Message, gp *GasPool) ([]byte, *big.Int, bool, error) {
 	st := NewStateTransition(evm, msg, gp)
 
-	ret, _, gasUsed, err := st.TransitionDb()
-	return ret, gasUsed, err
+	ret, _, gasUsed, failed, err := st.TransitionDb()
+	return ret, gasUsed, failed, err
 }
 
 func (st *StateTransition) from() vm.AccountRef {
@@ -202,13 +225,23 @@ func (st *StateTransition) preCheck() error {
 			return fmt.Errorf("invalid nonce: have %d, expected %d", msg.Nonce(), n)
 		}
 	}
+	// Make sure the fee caps are sane and cover the base fee. Zero priced calls
+	// which don't check the nonce (eth_call, gas estimation) are exempted.
+	if st.evm.ChainConfig().IsLondon(st.evm.BlockNumber) && (msg.CheckNonce() || msg.GasFeeCap().Sign() > 0) {
+		if msg.GasFeeCap().Cmp(msg.GasTipCap()) < 0 {
+			return ErrTipAboveFeeCap
+		}
+		if msg.GasFeeCap().Cmp(st.evm.BaseFee) < 0 {
+			return ErrFeeCapTooLow
+		}
+	}
 	return st.buyGas()
 }
 
 // TransitionDb will transition the state by applying the current message and returning the result
-// including the required gas for the operation as well as the used gas. It returns an error if it
-// failed. An error indicates a consensus issue.
-func (st *StateTransition) TransitionDb() (ret []byte, requiredGas, usedGas *big.Int, err error) {
+// including the required gas for the operation as well as the used gas and whether the execution
+// failed in the EVM. It returns an error if it failed. An error indicates a consensus issue.
+func (st *StateTransition) TransitionDb() (ret []byte, requiredGas, usedGas *big.Int, failed bool, err error) {
 	if err = st.preCheck(); err != nil {
 		return
 	}
@@ -220,12 +253,16 @@ func (st *StateTransition) TransitionDb() (ret []byte, requiredGas, usedGas *big
 
 	// Pay intrinsic gas
 	// TODO convert to uint64
-	intrinsicGas := IntrinsicGas(st.data, contractCreation, homestead)
+	intrinsicGas := IntrinsicGas(st.data, msg.AccessList(), contractCreation, homestead)
 	if intrinsicGas.BitLen() > 64 {
-		return nil, nil, nil, vm.ErrOutOfGas
+		return nil, nil, nil, false, vm.ErrOutOfGas
 	}
 	if err = st.useGas(intrinsicGas.Uint64()); err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, false, err
+	}
+	// Warm up the accounts and slots touched upfront (EIP-2929, EIP-2930)
+	if st.evm.ChainConfig().IsBerlin(st.evm.BlockNumber) {
+		st.state.PrepareAccessList(sender.Address(), msg.To(), st.evm.ActivePrecompiles(), msg.AccessList())
 	}
 
 	var (
@@ -248,15 +285,21 @@ func (st *StateTransition) TransitionDb() (ret []byte, requiredGas, usedGas *big
 		// sufficient balance to make the transfer happen. The first
 		// balance transfer may never fail.
 		if vmerr == vm.ErrInsufficientBalance {
-			return nil, nil, nil, vmerr
+			return nil, nil, nil, false, vmerr
 		}
 	}
 	requiredGas = new(big.Int).Set(st.gasUsed())
 
 	st.refundGas()
-	st.state.AddBalance(st.evm.Coinbase, new(big.Int).Mul(st.gasUsed(), st.gasPrice))
 
-	return ret, requiredGas, st.gasUsed(), err
+	// Post London the base fee is burnt, the miner only receives the tip
+	tip := new(big.Int).Set(st.gasPrice)
+	if st.evm.ChainConfig().IsLondon(st.evm.BlockNumber) {
+		tip = math.BigMax(tip.Sub(tip, st.evm.BaseFee), common.Big0)
+	}
+	st.state.AddBalance(st.evm.Coinbase, new(big.Int).Mul(st.gasUsed(), tip))
+
+	return ret, requiredGas, st.gasUsed(), vmerr != nil, err
 }
 
 func (st *StateTransition) refundGas() {
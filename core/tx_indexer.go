@@ -0,0 +1,209 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// txIndexBatchBlocks is the number of blocks whose transaction lookup entries
+// are added or removed before the index tail is persisted.
+const txIndexBatchBlocks = 1000
+
+// errTxIndexInterrupted is returned if the transaction indexer was interrupted
+// by the blockchain shutting down.
+var errTxIndexInterrupted = errors.New("transaction indexing interrupted")
+
+// SetTxLookupLimit sets the number of recent blocks to maintain the transaction
+// lookup entries for, zero meaning the entire chain. The first call starts the
+// background indexer, which extends or shrinks the index to match the limit and
+// keeps moving its tail along with the chain head.
+func (bc *BlockChain) SetTxLookupLimit(limit uint64) {
+	atomic.StoreUint64(&bc.txLookupLimit, limit)
+
+	bc.txIndexOnce.Do(func() {
+		bc.txIndexUpdate = make(chan struct{}, 1)
+
+		bc.wg.Add(1)
+		go bc.maintainTxIndex()
+	})
+	select {
+	case bc.txIndexUpdate <- struct{}{}:
+	default:
+	}
+}
+
+// TxLookupLimit returns the number of recent blocks the transaction lookup
+// entries are maintained for, zero meaning the entire chain.
+func (bc *BlockChain) TxLookupLimit() uint64 {
+	return atomic.LoadUint64(&bc.txLookupLimit)
+}
+
+// maintainTxIndex is the event loop of the transaction indexer, rechecking the
+// index on every new chain head or limit change. Only one index update runs at
+// any time, further requests are coalesced until it finishes.
+func (bc *BlockChain) maintainTxIndex() {
+	defer bc.wg.Done()
+
+	sub := bc.eventMux.Subscribe(ChainHeadEvent{})
+	defer sub.Unsubscribe()
+
+	var (
+		events  = sub.Chan()
+		done    chan struct{} // Non-nil if an index update is running
+		pending bool          // Whether another update is needed after the running one
+	)
+	update := func() {
+		if done != nil {
+			pending = true
+			return
+		}
+		done = make(chan struct{})
+		go bc.updateTxIndex(bc.CurrentBlock().NumberU64(), done)
+	}
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			update()
+
+		case <-bc.txIndexUpdate:
+			update()
+
+		case <-done:
+			done = nil
+			if pending {
+				pending = false
+				update()
+			}
+
+		case <-bc.quit:
+			if done != nil {
+				<-done
+			}
+			return
+		}
+	}
+}
+
+// updateTxIndex extends or shrinks the transaction index to cover exactly the
+// blocks within the lookup limit of the given head.
+func (bc *BlockChain) updateTxIndex(head uint64, done chan struct{}) {
+	defer close(done)
+
+	var want uint64
+	if limit := bc.TxLookupLimit(); limit != 0 && head+1 > limit {
+		want = head + 1 - limit
+	}
+	tail := GetTxIndexTail(bc.chainDb)
+	if tail > head+1 {
+		tail = head + 1
+	}
+	var (
+		start = time.Now()
+		err   error
+	)
+	switch {
+	case want < tail:
+		err = bc.indexTransactions(want, tail)
+	case want > tail:
+		err = bc.unindexTransactions(tail, want)
+	default:
+		return
+	}
+	switch err {
+	case nil:
+		log.Info("Updated transaction index", "tail", want, "head", head, "elapsed", common.PrettyDuration(time.Since(start)))
+	case errTxIndexInterrupted:
+		log.Debug("Transaction index update interrupted", "tail", GetTxIndexTail(bc.chainDb))
+	default:
+		log.Error("Failed to update transaction index", "err", err)
+	}
+}
+
+// indexTransactions adds the transaction lookup entries of the canonical blocks
+// in the range [from, to), moving the index tail backwards from the newest one.
+func (bc *BlockChain) indexTransactions(from, to uint64) error {
+	batch := bc.chainDb.NewBatch()
+	for number := to; number > from; {
+		number--
+		if block := bc.canonicalBlock(number); block != nil {
+			if err := writeTxLookupEntries(batch, block); err != nil {
+				return err
+			}
+		}
+		if (to-number)%txIndexBatchBlocks == 0 || number == from {
+			if err := WriteTxIndexTail(batch, number); err != nil {
+				return err
+			}
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch = bc.chainDb.NewBatch()
+
+			select {
+			case <-bc.quit:
+				return errTxIndexInterrupted
+			default:
+			}
+		}
+	}
+	return nil
+}
+
+// unindexTransactions removes the transaction lookup entries of the canonical
+// blocks in the range [from, to), moving the index tail forward from the oldest
+// one.
+func (bc *BlockChain) unindexTransactions(from, to uint64) error {
+	for number := from; number < to; number++ {
+		if block := bc.canonicalBlock(number); block != nil {
+			for _, tx := range block.Transactions() {
+				DeleteTxLookupEntry(bc.chainDb, tx.Hash())
+			}
+		}
+		if (number+1-from)%txIndexBatchBlocks == 0 || number+1 == to {
+			if err := WriteTxIndexTail(bc.chainDb, number+1); err != nil {
+				return err
+			}
+			select {
+			case <-bc.quit:
+				return errTxIndexInterrupted
+			default:
+			}
+		}
+	}
+	return nil
+}
+
+// canonicalBlock retrieves the canonical block with the given number directly
+// from the database, bypassing the block caches meant for recent blocks.
+func (bc *BlockChain) canonicalBlock(number uint64) *types.Block {
+	hash := GetCanonicalHash(bc.chainDb, number)
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	return GetBlock(bc.chainDb, hash, number)
+}
@@ -0,0 +1,96 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the transaction indexer only keeps lookup entries for the recent
+// blocks within the limit, extending and shrinking the index as needed.
+func TestTxIndexer(t *testing.T) {
+	var (
+		gendb, _ = ethdb.NewMemDatabase()
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address  = crypto.PubkeyToAddress(key.PublicKey)
+		gspec    = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  GenesisAlloc{address: {Balance: big.NewInt(1000000000)}},
+		}
+		genesis = gspec.MustCommit(gendb)
+		signer  = types.NewEIP155Signer(gspec.Config.ChainId)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, gendb, 160, func(i int, block *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x00}, big.NewInt(1000), bigTxGas, nil, nil), signer, key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	db, _ := ethdb.NewMemDatabase()
+	gspec.MustCommit(db)
+
+	chain, _ := NewBlockChain(db, gspec.Config, ethash.NewFaker(), new(event.TypeMux), vm.Config{})
+	defer chain.Stop()
+
+	if n, err := chain.InsertChain(blocks[:128]); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	// verifyIndex waits for the index tail to reach the expected block, and checks
+	// that exactly the transactions of the blocks from the tail on are indexed.
+	verifyIndex := func(tail uint64, head uint64) {
+		for i := 0; i < 100 && GetTxIndexTail(db) != tail; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if have := GetTxIndexTail(db); have != tail {
+			t.Fatalf("index tail mismatch: have %d, want %d", have, tail)
+		}
+		for _, block := range blocks[:head] {
+			hash, _, _ := GetTxLookupEntry(db, block.Transactions()[0].Hash())
+			if indexed := hash != (common.Hash{}); indexed != (block.NumberU64() >= tail) {
+				t.Fatalf("block #%d: indexed mismatch: have %v, want %v", block.NumberU64(), indexed, !indexed)
+			}
+		}
+	}
+	// Limiting the index should drop the old lookup entries
+	chain.SetTxLookupLimit(32)
+	verifyIndex(97, 128)
+
+	// Lifting the limit should index the entire chain again
+	chain.SetTxLookupLimit(0)
+	verifyIndex(0, 128)
+
+	// New heads should move the tail of a limited index along
+	chain.SetTxLookupLimit(64)
+	verifyIndex(65, 128)
+
+	if n, err := chain.InsertChain(blocks[128:]); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	verifyIndex(97, 160)
+}
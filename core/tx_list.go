@@ -248,13 +248,15 @@ func (l *txList) Overlaps(tx *types.Transaction) bool {
 // transaction was accepted, and if yes, any previous transaction it replaced.
 //
 // If the new transaction is accepted into the list, the lists' cost and gas
-// thresholds are also potentially updated.
+// thresholds are also potentially updated. A replacement needs to bump both its
+// fee cap and tip cap by the price bump percentage.
 func (l *txList) Add(tx *types.Transaction, priceBump uint64) (bool, *types.Transaction) {
 	// If there's an older better transaction, abort
 	old := l.txs.Get(tx.Nonce())
 	if old != nil {
-		threshold := new(big.Int).Div(new(big.Int).Mul(old.GasPrice(), big.NewInt(100+int64(priceBump))), big.NewInt(100))
-		if threshold.Cmp(tx.GasPrice()) >= 0 {
+		feeThreshold := new(big.Int).Div(new(big.Int).Mul(old.GasFeeCap(), big.NewInt(100+int64(priceBump))), big.NewInt(100))
+		tipThreshold := new(big.Int).Div(new(big.Int).Mul(old.GasTipCap(), big.NewInt(100+int64(priceBump))), big.NewInt(100))
+		if feeThreshold.Cmp(tx.GasFeeCap()) >= 0 || tipThreshold.Cmp(tx.GasTipCap()) >= 0 {
 			return false, nil
 		}
 	}
@@ -70,6 +70,10 @@ var (
 	// than some meaningful limit a user might use. This is not a consensus error
 	// making the transaction invalid, rather a DOS protection.
 	ErrOversizedData = errors.New("oversized data")
+
+	// ErrTxTypeNotSupported is returned if a typed transaction is submitted
+	// before the fork introducing its type has been activated.
+	ErrTxTypeNotSupported = types.ErrTxTypeNotSupported
 )
 
 var (
@@ -99,7 +103,11 @@ type stateFn func() (*state.StateDB, error)
 
 // TxPoolConfig are the configuration parameters of the transaction pool.
 type TxPoolConfig struct {
-	NoLocals bool // Whether local transaction handling should be disabled
+	Locals      []common.Address // Addresses that should be treated by default as local
+	NoLocals    bool             // Whether local transaction handling should be disabled
+	Journal     string           // Journal of local transactions to survive node restarts
+	Rejournal   time.Duration    // Time interval to regenerate the local transaction journal
+	Rebroadcast time.Duration    // Time interval to re-propagate pending local transactions
 
 	PriceLimit uint64 // Minimum gas price to enforce for acceptance into the pool
 	PriceBump  uint64 // Minimum price bump percentage to replace an already existing transaction (nonce)
@@ -115,6 +123,10 @@ type TxPoolConfig struct {
 // DefaultTxPoolConfig contains the default configurations for the transaction
 // pool.
 var DefaultTxPoolConfig = TxPoolConfig{
+	Journal:     "transactions.rlp",
+	Rejournal:   time.Hour,
+	Rebroadcast: 10 * time.Minute,
+
 	PriceLimit: 1,
 	PriceBump:  10,
 
@@ -130,6 +142,14 @@ var DefaultTxPoolConfig = TxPoolConfig{
 // unreasonable or unworkable.
 func (config *TxPoolConfig) sanitize() TxPoolConfig {
 	conf := *config
+	if conf.Rejournal < time.Second {
+		log.Warn("Sanitizing invalid txpool journal time", "provided", conf.Rejournal, "updated", time.Second)
+		conf.Rejournal = time.Second
+	}
+	if conf.Rebroadcast < time.Second {
+		log.Warn("Sanitizing invalid txpool rebroadcast time", "provided", conf.Rebroadcast, "updated", time.Second)
+		conf.Rebroadcast = time.Second
+	}
 	if conf.PriceLimit < 1 {
 		log.Warn("Sanitizing invalid txpool price limit", "provided", conf.PriceLimit, "updated", DefaultTxPoolConfig.PriceLimit)
 		conf.PriceLimit = DefaultTxPoolConfig.PriceLimit
@@ -157,7 +177,10 @@ type TxPool struct {
 	gasPrice     *big.Int
 	eventMux     *event.TypeMux
 	events       *event.TypeMuxSubscription
-	locals       *accountSet
+	txFeed       event.Feed
+	scope        event.SubscriptionScope
+	locals       *accountSet // Set of local transaction to exempt from eviction rules
+	journal      *txJournal  // Journal of local transaction to back up to disk
 	signer       types.Signer
 	mu           sync.RWMutex
 
@@ -171,6 +194,8 @@ type TxPool struct {
 	quit chan struct{}
 
 	homestead bool
+	berlin    bool
+	london    bool
 }
 
 // NewTxPool creates a new transaction pool to gather, sort and filter inbound
@@ -183,7 +208,7 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, eventMux *e
 	pool := &TxPool{
 		config:       config,
 		chainconfig:  chainconfig,
-		signer:       types.NewEIP155Signer(chainconfig.ChainId),
+		signer:       types.NewLondonSigner(chainconfig.ChainId),
 		pending:      make(map[common.Address]*txList),
 		queue:        make(map[common.Address]*txList),
 		beats:        make(map[common.Address]time.Time),
@@ -197,9 +222,26 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, eventMux *e
 		quit:         make(chan struct{}),
 	}
 	pool.locals = newAccountSet(pool.signer)
+	if !config.NoLocals {
+		for _, addr := range config.Locals {
+			log.Info("Setting new local account", "address", addr)
+			pool.locals.add(addr)
+		}
+	}
 	pool.priced = newTxPricedList(&pool.all)
 	pool.resetState()
 
+	// If local transactions and journaling is enabled, load from disk
+	if !config.NoLocals && config.Journal != "" {
+		pool.journal = newTxJournal(config.Journal)
+
+		if err := pool.journal.load(pool.AddLocal); err != nil {
+			log.Warn("Failed to load transaction journal", "err", err)
+		}
+		if err := pool.journal.rotate(pool.local()); err != nil {
+			log.Warn("Failed to rotate transaction journal", "err", err)
+		}
+	}
 	// Start the various events loops and return
 	pool.wg.Add(2)
 	go pool.eventLoop()
@@ -217,6 +259,12 @@ func (pool *TxPool) eventLoop() {
 	report := time.NewTicker(statsReportInterval)
 	defer report.Stop()
 
+	journal := time.NewTicker(pool.config.Rejournal)
+	defer journal.Stop()
+
+	rebroadcast := time.NewTicker(pool.config.Rebroadcast)
+	defer rebroadcast.Stop()
+
 	// Track chain events. When a chain events occurs (new chain canon block)
 	// we need to know the new state. The new state will help us determine
 	// the nonces in the managed state
@@ -234,6 +282,12 @@ func (pool *TxPool) eventLoop() {
 					if pool.chainconfig.IsHomestead(ev.Block.Number()) {
 						pool.homestead = true
 					}
+					if pool.chainconfig.IsBerlin(ev.Block.Number()) {
+						pool.berlin = true
+					}
+					if pool.chainconfig.IsLondon(ev.Block.Number()) {
+						pool.london = true
+					}
 				}
 				pool.resetState()
 				pool.mu.Unlock()
@@ -253,6 +307,32 @@ func (pool *TxPool) eventLoop() {
 				log.Debug("Transaction pool status report", "executable", pending, "queued", queued, "stales", stales)
 				prevPending, prevQueued, prevStales = pending, queued, stales
 			}
+
+		// Handle local transaction journal rotation
+		case <-journal.C:
+			if pool.journal != nil {
+				pool.mu.Lock()
+				if err := pool.journal.rotate(pool.local()); err != nil {
+					log.Warn("Failed to rotate local tx journal", "err", err)
+				}
+				pool.mu.Unlock()
+			}
+
+		// Handle re-propagation of the executable local transactions
+		case <-rebroadcast.C:
+			pool.mu.RLock()
+			var txs types.Transactions
+			for addr := range pool.locals.accounts {
+				if pending := pool.pending[addr]; pending != nil {
+					txs = append(txs, pending.Flatten()...)
+				}
+			}
+			pool.mu.RUnlock()
+
+			if len(txs) > 0 {
+				log.Debug("Rebroadcasting local transactions", "count", len(txs))
+				go pool.eventMux.Post(TxRebroadcastEvent{txs})
+			}
 		}
 	}
 }
@@ -283,13 +363,25 @@ func (pool *TxPool) resetState() {
 
 // Stop terminates the transaction pool.
 func (pool *TxPool) Stop() {
+	// Unsubscribe all subscriptions registered from txpool
+	pool.scope.Close()
+
 	pool.events.Unsubscribe()
 	close(pool.quit)
 	pool.wg.Wait()
 
+	if pool.journal != nil {
+		pool.journal.close()
+	}
 	log.Info("Transaction pool stopped")
 }
 
+// SubscribeNewTxsEvent registers a subscription of NewTxsEvent and starts
+// sending events to the given channel.
+func (pool *TxPool) SubscribeNewTxsEvent(ch chan<- NewTxsEvent) event.Subscription {
+	return pool.scope.Track(pool.txFeed.Subscribe(ch))
+}
+
 // GasPrice returns the current gas price enforced by the transaction pool.
 func (pool *TxPool) GasPrice() *big.Int {
 	pool.mu.RLock()
@@ -359,6 +451,30 @@ func (pool *TxPool) Content() (map[common.Address]types.Transactions, map[common
 	return pending, queued
 }
 
+// Locals retrieves the accounts currently considered local by the pool.
+func (pool *TxPool) Locals() []common.Address {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return pool.locals.flatten()
+}
+
+// local retrieves all currently known local transactions, grouped by origin
+// account and sorted by nonce. The returned transaction set is a copy and can be
+// freely modified by calling code.
+func (pool *TxPool) local() map[common.Address]types.Transactions {
+	txs := make(map[common.Address]types.Transactions)
+	for addr := range pool.locals.accounts {
+		if pending := pool.pending[addr]; pending != nil {
+			txs[addr] = append(txs[addr], pending.Flatten()...)
+		}
+		if queued := pool.queue[addr]; queued != nil {
+			txs[addr] = append(txs[addr], queued.Flatten()...)
+		}
+	}
+	return txs
+}
+
 // Pending retrieves all currently processable transactions, groupped by origin
 // account and sorted by nonce. The returned transaction set is a copy and can be
 // freely modified by calling code.
@@ -376,6 +492,13 @@ func (pool *TxPool) Pending() (map[common.Address]types.Transactions, error) {
 // validateTx checks whether a transaction is valid according to the consensus
 // rules and adheres to some heuristic limits of the local node (price and size).
 func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
+	// Accept typed transactions only once the fork introducing them is active
+	if tx.Type() != types.LegacyTxType && !pool.berlin {
+		return ErrTxTypeNotSupported
+	}
+	if tx.Type() == types.DynamicFeeTxType && !pool.london {
+		return ErrTxTypeNotSupported
+	}
 	// Heuristic limit, reject transactions over 32KB to prevent DOS attacks
 	if tx.Size() > 32*1024 {
 		return ErrOversizedData
@@ -389,14 +512,18 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	if pool.gasLimit().Cmp(tx.Gas()) < 0 {
 		return ErrGasLimit
 	}
+	// Sanity check the fee caps of dynamic fee transactions
+	if tx.GasFeeCap().Cmp(tx.GasTipCap()) < 0 {
+		return ErrTipAboveFeeCap
+	}
 	// Make sure the transaction is signed properly
 	from, err := types.Sender(pool.signer, tx)
 	if err != nil {
 		return ErrInvalidSender
 	}
-	// Drop non-local transactions under our own minimal accepted gas price
+	// Drop non-local transactions under our own minimal accepted gas price (or tip)
 	local = local || pool.locals.contains(from) // account may be local even if the transaction arrived from the network
-	if !local && pool.gasPrice.Cmp(tx.GasPrice()) > 0 {
+	if !local && pool.gasPrice.Cmp(tx.GasTipCap()) > 0 {
 		return ErrUnderpriced
 	}
 	// Ensure the transaction adheres to nonce ordering
@@ -412,7 +539,7 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	if currentState.GetBalance(from).Cmp(tx.Cost()) < 0 {
 		return ErrInsufficientFunds
 	}
-	intrGas := IntrinsicGas(tx.Data(), tx.To() == nil, pool.homestead)
+	intrGas := IntrinsicGas(tx.Data(), tx.AccessList(), tx.To() == nil, pool.homestead)
 	if tx.Gas().Cmp(intrGas) < 0 {
 		return ErrIntrinsicGas
 	}
@@ -473,8 +600,13 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 		}
 		pool.all[tx.Hash()] = tx
 		pool.priced.Put(tx)
+		pool.journalTx(from, tx, local)
 
 		log.Trace("Pooled new executable transaction", "hash", hash, "from", from, "to", tx.To())
+
+		// We've directly injected a replacement transaction, notify subsystems
+		go pool.txFeed.Send(NewTxsEvent{types.Transactions{tx}})
+
 		return old != nil, nil
 	}
 	// New transaction isn't replacing a pending one, push into queue and potentially mark local
@@ -485,10 +617,24 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 	if local {
 		pool.locals.add(from)
 	}
+	pool.journalTx(from, tx, local)
+
 	log.Trace("Pooled new future transaction", "hash", hash, "from", from, "to", tx.To())
 	return replace, nil
 }
 
+// journalTx adds the specified transaction to the local disk journal if it is
+// deemed to have been sent from a local account.
+func (pool *TxPool) journalTx(from common.Address, tx *types.Transaction, local bool) {
+	// Only journal if it's enabled and the transaction is local
+	if pool.journal == nil || !(local || pool.locals.contains(from)) {
+		return
+	}
+	if err := pool.journal.insert(tx); err != nil {
+		log.Warn("Failed to journal local transaction", "err", err)
+	}
+}
+
 // enqueueTx inserts a new transaction into the non-executable transaction queue.
 //
 // Note, this method assumes the pool lock is held!
@@ -515,10 +661,11 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction) (bool, er
 	return old != nil, nil
 }
 
-// promoteTx adds a transaction to the pending (processable) list of transactions.
+// promoteTx adds a transaction to the pending (processable) list of transactions
+// and returns whether it was inserted or an older was better.
 //
 // Note, this method assumes the pool lock is held!
-func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.Transaction) {
+func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.Transaction) bool {
 	// Try to insert the transaction into the pending queue
 	if pool.pending[addr] == nil {
 		pool.pending[addr] = newTxList(true)
@@ -532,7 +679,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 		pool.priced.Removed()
 
 		pendingDiscardCounter.Inc(1)
-		return
+		return false
 	}
 	// Otherwise discard any previous transaction and mark this
 	if old != nil {
@@ -546,10 +693,11 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 		pool.all[hash] = tx
 		pool.priced.Put(tx)
 	}
-	// Set the potentially new pending nonce and notify any subsystems of the new tx
+	// Set the potentially new pending nonce, subsystems are notified by the caller
 	pool.beats[addr] = time.Now()
 	pool.pendingState.SetNonce(addr, tx.Nonce()+1)
-	go pool.eventMux.Post(TxPreEvent{tx})
+
+	return true
 }
 
 // AddLocal enqueues a single transaction into the pool if it is valid, marking
@@ -708,6 +856,9 @@ func (pool *TxPool) removeTx(hash common.Hash) {
 func (pool *TxPool) promoteExecutables(state *state.StateDB, accounts []common.Address) {
 	gaslimit := pool.gasLimit()
 
+	// Track the promoted transactions to broadcast them at once
+	var promoted []*types.Transaction
+
 	// Gather all the accounts potentially needing updates
 	if accounts == nil {
 		accounts = make([]common.Address, 0, len(pool.queue))
@@ -740,8 +891,10 @@ func (pool *TxPool) promoteExecutables(state *state.StateDB, accounts []common.A
 		// Gather all executable transactions and promote them
 		for _, tx := range list.Ready(pool.pendingState.GetNonce(addr)) {
 			hash := tx.Hash()
-			log.Trace("Promoting queued transaction", "hash", hash)
-			pool.promoteTx(addr, hash, tx)
+			if pool.promoteTx(addr, hash, tx) {
+				log.Trace("Promoting queued transaction", "hash", hash)
+				promoted = append(promoted, tx)
+			}
 		}
 		// Drop all transactions over the allowed limit
 		if !pool.locals.contains(addr) {
@@ -758,6 +911,10 @@ func (pool *TxPool) promoteExecutables(state *state.StateDB, accounts []common.A
 			delete(pool.queue, addr)
 		}
 	}
+	// Notify subsystem for new promoted transactions.
+	if len(promoted) > 0 {
+		go pool.txFeed.Send(NewTxsEvent{promoted})
+	}
 	// If the pending limit is overflown, start equalizing allowances
 	pending := uint64(0)
 	for _, list := range pool.pending {
@@ -990,3 +1147,12 @@ func (as *accountSet) containsTx(tx *types.Transaction) bool {
 func (as *accountSet) add(addr common.Address) {
 	as.accounts[addr] = struct{}{}
 }
+
+// flatten returns the list of addresses within this set.
+func (as *accountSet) flatten() []common.Address {
+	accounts := make([]common.Address, 0, len(as.accounts))
+	for account := range as.accounts {
+		accounts = append(accounts, account)
+	}
+	return accounts
+}
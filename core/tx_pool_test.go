@@ -19,8 +19,10 @@ package core
 import (
 	"crypto/ecdsa"
 	"fmt"
+	"io/ioutil"
 	"math/big"
 	"math/rand"
+	"os"
 	"testing"
 	"time"
 
@@ -33,6 +35,15 @@ import (
 	"github.com/ethereum/go-ethereum/params"
 )
 
+// testTxPoolConfig is a transaction pool configuration without stateful disk
+// sideeffects used during testing.
+var testTxPoolConfig TxPoolConfig
+
+func init() {
+	testTxPoolConfig = DefaultTxPoolConfig
+	testTxPoolConfig.Journal = ""
+}
+
 func transaction(nonce uint64, gaslimit *big.Int, key *ecdsa.PrivateKey) *types.Transaction {
 	return pricedTransaction(nonce, gaslimit, big.NewInt(1), key)
 }
@@ -47,7 +58,7 @@ func setupTxPool() (*TxPool, *ecdsa.PrivateKey) {
 	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
 
 	key, _ := crypto.GenerateKey()
-	pool := NewTxPool(DefaultTxPoolConfig, params.TestChainConfig, new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil }, func() *big.Int { return big.NewInt(1000000) })
+	pool := NewTxPool(testTxPoolConfig, params.TestChainConfig, new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil }, func() *big.Int { return big.NewInt(1000000) })
 	pool.resetState()
 
 	return pool, key
@@ -125,7 +136,7 @@ func TestStateChangeDuringPoolReset(t *testing.T) {
 
 	gasLimitFunc := func() *big.Int { return big.NewInt(1000000000) }
 
-	pool := NewTxPool(DefaultTxPoolConfig, params.TestChainConfig, mux, stateFunc, gasLimitFunc)
+	pool := NewTxPool(testTxPoolConfig, params.TestChainConfig, mux, stateFunc, gasLimitFunc)
 	defer pool.Stop()
 	pool.resetState()
 
@@ -196,6 +207,80 @@ func TestInvalidTransactions(t *testing.T) {
 	}
 }
 
+// Tests that typed transactions are only accepted after the Berlin fork, and that
+// their access list is accounted for in the intrinsic gas.
+func TestTransactionTypedAcceptance(t *testing.T) {
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	signer := types.NewEIP2930Signer(params.TestChainConfig.ChainId)
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	currentState, _ := pool.currentState()
+	currentState.AddBalance(from, big.NewInt(0xffffffffffffff))
+
+	accesses := types.AccessList{{Address: common.Address{0xaa}, StorageKeys: []common.Hash{{0x01}}}}
+	intrinsic := params.TxGas + params.TxAccessListAddressGas + params.TxAccessListStorageKeyGas
+
+	tx, _ := types.SignTx(types.NewAccessListTransaction(0, &common.Address{}, big.NewInt(100), new(big.Int).SetUint64(intrinsic), big.NewInt(1), nil, accesses), signer, key)
+	if err := pool.AddRemote(tx); err != ErrTxTypeNotSupported {
+		t.Fatalf("pre-fork typed transaction error mismatch: have %v, want %v", err, ErrTxTypeNotSupported)
+	}
+	pool.berlin = true
+
+	short, _ := types.SignTx(types.NewAccessListTransaction(0, &common.Address{}, big.NewInt(100), new(big.Int).SetUint64(intrinsic-1), big.NewInt(1), nil, accesses), signer, key)
+	if err := pool.AddRemote(short); err != ErrIntrinsicGas {
+		t.Fatalf("underfunded typed transaction error mismatch: have %v, want %v", err, ErrIntrinsicGas)
+	}
+	if err := pool.AddRemote(tx); err != nil {
+		t.Fatalf("failed to add typed transaction: %v", err)
+	}
+	if pending, _ := pool.Stats(); pending != 1 {
+		t.Fatalf("pending transactions mismatched: have %d, want %d", pending, 1)
+	}
+}
+
+// Tests that dynamic fee transactions are only accepted after London, and that
+// replacing one requires bumping both its fee cap and its tip cap.
+func TestTransactionDynamicFeeReplacement(t *testing.T) {
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	signer := types.NewLondonSigner(params.TestChainConfig.ChainId)
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	currentState, _ := pool.currentState()
+	currentState.AddBalance(from, big.NewInt(0xffffffffffffff))
+
+	dynamicTx := func(tip, feeCap int64) *types.Transaction {
+		tx, _ := types.SignTx(types.NewDynamicFeeTransaction(0, &common.Address{}, big.NewInt(100), big.NewInt(100000), big.NewInt(tip), big.NewInt(feeCap), nil, nil), signer, key)
+		return tx
+	}
+	pool.berlin = true
+	if err := pool.AddRemote(dynamicTx(1, 10)); err != ErrTxTypeNotSupported {
+		t.Fatalf("pre-london dynamic transaction error mismatch: have %v, want %v", err, ErrTxTypeNotSupported)
+	}
+	pool.london = true
+
+	if err := pool.AddRemote(dynamicTx(11, 10)); err != ErrTipAboveFeeCap {
+		t.Fatalf("tip above fee cap error mismatch: have %v, want %v", err, ErrTipAboveFeeCap)
+	}
+	if err := pool.AddRemote(dynamicTx(10, 100)); err != nil {
+		t.Fatalf("failed to add dynamic transaction: %v", err)
+	}
+	// Bumping only one of the caps must not be enough to replace it
+	if err := pool.AddRemote(dynamicTx(10, 200)); err != ErrReplaceUnderpriced {
+		t.Fatalf("fee cap only bump error mismatch: have %v, want %v", err, ErrReplaceUnderpriced)
+	}
+	if err := pool.AddRemote(dynamicTx(20, 100)); err != ErrReplaceUnderpriced {
+		t.Fatalf("tip cap only bump error mismatch: have %v, want %v", err, ErrReplaceUnderpriced)
+	}
+	if err := pool.AddRemote(dynamicTx(20, 200)); err != nil {
+		t.Fatalf("failed to replace dynamic transaction: %v", err)
+	}
+	if pending, _ := pool.Stats(); pending != 1 {
+		t.Fatalf("pending transactions mismatched: have %d, want %d", pending, 1)
+	}
+}
+
 func TestTransactionQueue(t *testing.T) {
 	pool, key := setupTxPool()
 	defer pool.Stop()
@@ -657,7 +742,7 @@ func testTransactionQueueGlobalLimiting(t *testing.T, nolocals bool) {
 	db, _ := ethdb.NewMemDatabase()
 	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
 
-	config := DefaultTxPoolConfig
+	config := testTxPoolConfig
 	config.NoLocals = nolocals
 	config.GlobalQueue = config.AccountQueue*3 - 1 // reduce the queue limits to shorten test time (-1 to make it non divisible)
 
@@ -748,7 +833,7 @@ func testTransactionQueueTimeLimiting(t *testing.T, nolocals bool) {
 	db, _ := ethdb.NewMemDatabase()
 	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
 
-	config := DefaultTxPoolConfig
+	config := testTxPoolConfig
 	config.Lifetime = 250 * time.Millisecond
 	config.NoLocals = nolocals
 
@@ -888,7 +973,7 @@ func TestTransactionPendingGlobalLimiting(t *testing.T) {
 	db, _ := ethdb.NewMemDatabase()
 	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
 
-	config := DefaultTxPoolConfig
+	config := testTxPoolConfig
 	config.GlobalSlots = config.AccountSlots * 10
 
 	pool := NewTxPool(config, params.TestChainConfig, new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil }, func() *big.Int { return big.NewInt(1000000) })
@@ -935,7 +1020,7 @@ func TestTransactionCapClearsFromAll(t *testing.T) {
 	db, _ := ethdb.NewMemDatabase()
 	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
 
-	config := DefaultTxPoolConfig
+	config := testTxPoolConfig
 	config.AccountSlots = 2
 	config.AccountQueue = 2
 	config.GlobalSlots = 8
@@ -970,7 +1055,7 @@ func TestTransactionPendingMinimumAllowance(t *testing.T) {
 	db, _ := ethdb.NewMemDatabase()
 	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
 
-	config := DefaultTxPoolConfig
+	config := testTxPoolConfig
 	config.GlobalSlots = 0
 
 	pool := NewTxPool(config, params.TestChainConfig, new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil }, func() *big.Int { return big.NewInt(1000000) })
@@ -1019,7 +1104,7 @@ func TestTransactionPoolRepricing(t *testing.T) {
 	db, _ := ethdb.NewMemDatabase()
 	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
 
-	pool := NewTxPool(DefaultTxPoolConfig, params.TestChainConfig, new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil }, func() *big.Int { return big.NewInt(1000000) })
+	pool := NewTxPool(testTxPoolConfig, params.TestChainConfig, new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil }, func() *big.Int { return big.NewInt(1000000) })
 	defer pool.Stop()
 	pool.resetState()
 
@@ -1104,7 +1189,7 @@ func TestTransactionPoolUnderpricing(t *testing.T) {
 	db, _ := ethdb.NewMemDatabase()
 	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
 
-	config := DefaultTxPoolConfig
+	config := testTxPoolConfig
 	config.GlobalSlots = 2
 	config.GlobalQueue = 2
 
@@ -1192,7 +1277,7 @@ func TestTransactionReplacement(t *testing.T) {
 	db, _ := ethdb.NewMemDatabase()
 	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
 
-	pool := NewTxPool(DefaultTxPoolConfig, params.TestChainConfig, new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil }, func() *big.Int { return big.NewInt(1000000) })
+	pool := NewTxPool(testTxPoolConfig, params.TestChainConfig, new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil }, func() *big.Int { return big.NewInt(1000000) })
 	defer pool.Stop()
 	pool.resetState()
 
@@ -1350,3 +1435,207 @@ func benchmarkPoolBatchInsert(b *testing.B, size int) {
 		pool.AddRemotes(batch)
 	}
 }
+
+// Tests that local transactions are journaled to disk, but remote transactions
+// get discarded between restarts.
+func TestTransactionJournaling(t *testing.T) {
+	// Create a temporary file for the journal
+	file, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary journal: %v", err)
+	}
+	journal := file.Name()
+	defer os.Remove(journal)
+
+	// Clean up the temporary file, we only need the path for now
+	file.Close()
+	os.Remove(journal)
+
+	// Create the original pool to inject transaction into the journal
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	config := testTxPoolConfig
+	config.Journal = journal
+	config.Rejournal = time.Second
+
+	pool := NewTxPool(config, params.TestChainConfig, new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil }, func() *big.Int { return big.NewInt(1000000) })
+
+	// Create two test accounts to ensure remotes expire but locals do not
+	local, _ := crypto.GenerateKey()
+	remote, _ := crypto.GenerateKey()
+
+	statedb.AddBalance(crypto.PubkeyToAddress(local.PublicKey), big.NewInt(1000000000))
+	statedb.AddBalance(crypto.PubkeyToAddress(remote.PublicKey), big.NewInt(1000000000))
+
+	// Add three local and a remote transactions and ensure they are queued up
+	if err := pool.AddLocal(pricedTransaction(0, big.NewInt(100000), big.NewInt(1), local)); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
+	if err := pool.AddLocal(pricedTransaction(1, big.NewInt(100000), big.NewInt(1), local)); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
+	if err := pool.AddLocal(pricedTransaction(2, big.NewInt(100000), big.NewInt(1), local)); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(0, big.NewInt(100000), big.NewInt(1), remote)); err != nil {
+		t.Fatalf("failed to add remote transaction: %v", err)
+	}
+	pending, queued := pool.Stats()
+	if pending != 4 {
+		t.Fatalf("pending transactions mismatched: have %d, want %d", pending, 4)
+	}
+	if queued != 0 {
+		t.Fatalf("queued transactions mismatched: have %d, want %d", queued, 0)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+	// Terminate the old pool, bump the local nonce, create a new pool and ensure relevant transaction survive
+	pool.Stop()
+	statedb.SetNonce(crypto.PubkeyToAddress(local.PublicKey), 1)
+	pool = NewTxPool(config, params.TestChainConfig, new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil }, func() *big.Int { return big.NewInt(1000000) })
+
+	pending, queued = pool.Stats()
+	if queued != 0 {
+		t.Fatalf("queued transactions mismatched: have %d, want %d", queued, 0)
+	}
+	if pending != 2 {
+		t.Fatalf("pending transactions mismatched: have %d, want %d", pending, 2)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+	// Bump the nonce temporarily and ensure the newly invalidated transaction is removed
+	statedb.SetNonce(crypto.PubkeyToAddress(local.PublicKey), 2)
+	pool.resetState()
+	time.Sleep(2 * config.Rejournal)
+	pool.Stop()
+
+	statedb.SetNonce(crypto.PubkeyToAddress(local.PublicKey), 1)
+	pool = NewTxPool(config, params.TestChainConfig, new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil }, func() *big.Int { return big.NewInt(1000000) })
+
+	pending, queued = pool.Stats()
+	if pending != 0 {
+		t.Fatalf("pending transactions mismatched: have %d, want %d", pending, 0)
+	}
+	if queued != 1 {
+		t.Fatalf("queued transactions mismatched: have %d, want %d", queued, 1)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+	pool.Stop()
+}
+
+// Tests that accounts configured as local are exempt from the remote rules even
+// if their transactions arrive from the network, and that their executable
+// transactions are periodically rebroadcast.
+func TestTransactionConfiguredLocalsRebroadcast(t *testing.T) {
+	// Create the pool to test the local accounts with
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	local, _ := crypto.GenerateKey()
+	remote, _ := crypto.GenerateKey()
+
+	config := testTxPoolConfig
+	config.Locals = []common.Address{crypto.PubkeyToAddress(local.PublicKey)}
+	config.Rebroadcast = time.Second
+
+	mux := new(event.TypeMux)
+	sub := mux.Subscribe(TxRebroadcastEvent{})
+	defer sub.Unsubscribe()
+
+	pool := NewTxPool(config, params.TestChainConfig, mux, func() (*state.StateDB, error) { return statedb, nil }, func() *big.Int { return big.NewInt(1000000) })
+	defer pool.Stop()
+
+	if locals := pool.Locals(); len(locals) != 1 || locals[0] != crypto.PubkeyToAddress(local.PublicKey) {
+		t.Fatalf("local accounts mismatch: have %x, want %x", locals, config.Locals)
+	}
+	statedb.AddBalance(crypto.PubkeyToAddress(local.PublicKey), big.NewInt(1000000000))
+	statedb.AddBalance(crypto.PubkeyToAddress(remote.PublicKey), big.NewInt(1000000000))
+
+	// Add a remote transaction from both accounts and a queued one from the local
+	if err := pool.AddRemote(pricedTransaction(0, big.NewInt(100000), big.NewInt(1), local)); err != nil {
+		t.Fatalf("failed to add local account transaction: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(2, big.NewInt(100000), big.NewInt(1), local)); err != nil {
+		t.Fatalf("failed to add local account transaction: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(0, big.NewInt(100000), big.NewInt(1), remote)); err != nil {
+		t.Fatalf("failed to add remote transaction: %v", err)
+	}
+	// Ensure the local account is exempt from price based eviction
+	pool.SetGasPrice(big.NewInt(2))
+
+	pending, queued := pool.Stats()
+	if pending != 1 {
+		t.Fatalf("pending transactions mismatched: have %d, want %d", pending, 1)
+	}
+	if queued != 1 {
+		t.Fatalf("queued transactions mismatched: have %d, want %d", queued, 1)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+	// Wait for the rebroadcast and ensure only the executable local transaction is in it
+	select {
+	case ev := <-sub.Chan():
+		txs := ev.Data.(TxRebroadcastEvent).Txs
+		if len(txs) != 1 || txs[0].Nonce() != 0 {
+			t.Fatalf("rebroadcast transactions mismatch: have %d, want %d", len(txs), 1)
+		}
+		if from, _ := types.Sender(pool.signer, txs[0]); from != crypto.PubkeyToAddress(local.PublicKey) {
+			t.Fatalf("rebroadcast transaction sender mismatch: have %x, want %x", from, crypto.PubkeyToAddress(local.PublicKey))
+		}
+	case <-time.After(3 * config.Rebroadcast):
+		t.Fatalf("local transactions not rebroadcast")
+	}
+}
+
+// Tests that transactions becoming executable are announced in batches through
+// the pool's event feed, and that queued ones are not announced at all.
+func TestTransactionNewTxsEvent(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	events := make(chan NewTxsEvent, 16)
+	sub := pool.SubscribeNewTxsEvent(events)
+	defer sub.Unsubscribe()
+
+	account, _ := deriveSender(transaction(0, big.NewInt(0), key))
+	currentState, _ := pool.currentState()
+	currentState.AddBalance(account, big.NewInt(1000000))
+
+	// Queue up a gapped batch of transactions, none should be announced
+	for i := uint64(1); i <= 3; i++ {
+		if err := pool.AddRemote(transaction(i, big.NewInt(100000), key)); err != nil {
+			t.Fatalf("failed to add queued transaction %d: %v", i, err)
+		}
+	}
+	select {
+	case ev := <-events:
+		t.Fatalf("queued transactions announced: %d", len(ev.Txs))
+	case <-time.After(100 * time.Millisecond):
+	}
+	// Fill the nonce gap and ensure all transactions are announced in one batch
+	if err := pool.AddRemote(transaction(0, big.NewInt(100000), key)); err != nil {
+		t.Fatalf("failed to add gap filling transaction: %v", err)
+	}
+	select {
+	case ev := <-events:
+		if len(ev.Txs) != 4 {
+			t.Fatalf("announced transaction count mismatch: have %d, want %d", len(ev.Txs), 4)
+		}
+		for i, tx := range ev.Txs {
+			if tx.Nonce() != uint64(i) {
+				t.Errorf("announced transaction %d: nonce mismatch: have %d, want %d", i, tx.Nonce(), i)
+			}
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("promoted transactions not announced")
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"sort"
 	"sync/atomic"
 	"time"
+	"unsafe"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
@@ -83,10 +84,14 @@ type Header struct {
 	Extra       []byte         `json:"extraData"        gencodec:"required"`
 	MixDigest   common.Hash    `json:"mixHash"          gencodec:"required"`
 	Nonce       BlockNonce     `json:"nonce"            gencodec:"required"`
+
+	// BaseFee was added by EIP-1559 and is ignored in legacy headers.
+	BaseFee *big.Int `json:"baseFeePerGas,omitempty" rlp:"-"`
 }
 
 // field type overrides for gencodec
 type headerMarshaling struct {
+	BaseFee    *hexutil.Big
 	Difficulty *hexutil.Big
 	Number     *hexutil.Big
 	GasLimit   *hexutil.Big
@@ -96,6 +101,72 @@ type headerMarshaling struct {
 	Hash       common.Hash `json:"hash"` // adds call to Hash() in MarshalJSON
 }
 
+// headerRLP is the legacy RLP layout of a header with the optional fields added
+// by later forks appended as a tail.
+type headerRLP struct {
+	ParentHash  common.Hash
+	UncleHash   common.Hash
+	Coinbase    common.Address
+	Root        common.Hash
+	TxHash      common.Hash
+	ReceiptHash common.Hash
+	Bloom       Bloom
+	Difficulty  *big.Int
+	Number      *big.Int
+	GasLimit    *big.Int
+	GasUsed     *big.Int
+	Time        *big.Int
+	Extra       []byte
+	MixDigest   common.Hash
+	Nonce       BlockNonce
+	BaseFee     []*big.Int `rlp:"tail"` // Only present after the London fork
+}
+
+// EncodeRLP implements rlp.Encoder, appending the base fee only if it is set
+// so that legacy headers retain their original encoding (and hash).
+func (h *Header) EncodeRLP(w io.Writer) error {
+	enc := headerRLP{
+		h.ParentHash, h.UncleHash, h.Coinbase, h.Root, h.TxHash, h.ReceiptHash, h.Bloom,
+		h.Difficulty, h.Number, h.GasLimit, h.GasUsed, h.Time, h.Extra, h.MixDigest, h.Nonce, nil,
+	}
+	if h.BaseFee != nil {
+		enc.BaseFee = []*big.Int{h.BaseFee}
+	}
+	return rlp.Encode(w, &enc)
+}
+
+// DecodeRLP implements rlp.Decoder, accepting both legacy and London headers.
+func (h *Header) DecodeRLP(s *rlp.Stream) error {
+	var dec headerRLP
+	if err := s.Decode(&dec); err != nil {
+		return err
+	}
+	if len(dec.BaseFee) > 1 {
+		return fmt.Errorf("invalid header fields: %d extra", len(dec.BaseFee))
+	}
+	*h = Header{
+		ParentHash:  dec.ParentHash,
+		UncleHash:   dec.UncleHash,
+		Coinbase:    dec.Coinbase,
+		Root:        dec.Root,
+		TxHash:      dec.TxHash,
+		ReceiptHash: dec.ReceiptHash,
+		Bloom:       dec.Bloom,
+		Difficulty:  dec.Difficulty,
+		Number:      dec.Number,
+		GasLimit:    dec.GasLimit,
+		GasUsed:     dec.GasUsed,
+		Time:        dec.Time,
+		Extra:       dec.Extra,
+		MixDigest:   dec.MixDigest,
+		Nonce:       dec.Nonce,
+	}
+	if len(dec.BaseFee) == 1 {
+		h.BaseFee = dec.BaseFee[0]
+	}
+	return nil
+}
+
 // Hash returns the block hash of the header, which is simply the keccak256 hash of its
 // RLP encoding.
 func (h *Header) Hash() common.Hash {
@@ -104,7 +175,7 @@ func (h *Header) Hash() common.Hash {
 
 // HashNoNonce returns the hash which is used as input for the proof-of-work search.
 func (h *Header) HashNoNonce() common.Hash {
-	return rlpHash([]interface{}{
+	fields := []interface{}{
 		h.ParentHash,
 		h.UncleHash,
 		h.Coinbase,
@@ -118,7 +189,17 @@ func (h *Header) HashNoNonce() common.Hash {
 		h.GasUsed,
 		h.Time,
 		h.Extra,
-	})
+	}
+	if h.BaseFee != nil {
+		fields = append(fields, h.BaseFee)
+	}
+	return rlpHash(fields)
+}
+
+// Size returns the approximate memory used by all internal contents. It is used
+// to approximate and limit the memory consumption of various caches.
+func (h *Header) Size() common.StorageSize {
+	return common.StorageSize(unsafe.Sizeof(*h)) + common.StorageSize(len(h.Extra)+(h.Difficulty.BitLen()+h.Number.BitLen()+h.GasLimit.BitLen()+h.GasUsed.BitLen()+h.Time.BitLen())/8)
 }
 
 func rlpHash(x interface{}) (h common.Hash) {
@@ -249,6 +330,9 @@ func CopyHeader(h *Header) *Header {
 	if cpy.GasUsed = new(big.Int); h.GasUsed != nil {
 		cpy.GasUsed.Set(h.GasUsed)
 	}
+	if h.BaseFee != nil {
+		cpy.BaseFee = new(big.Int).Set(h.BaseFee)
+	}
 	if len(h.Extra) > 0 {
 		cpy.Extra = make([]byte, len(h.Extra))
 		copy(cpy.Extra, h.Extra)
@@ -307,6 +391,14 @@ func (b *Block) GasUsed() *big.Int    { return new(big.Int).Set(b.header.GasUsed
 func (b *Block) Difficulty() *big.Int { return new(big.Int).Set(b.header.Difficulty) }
 func (b *Block) Time() *big.Int       { return new(big.Int).Set(b.header.Time) }
 
+// BaseFee returns the base fee of the block, nil before the London fork.
+func (b *Block) BaseFee() *big.Int {
+	if b.header.BaseFee == nil {
+		return nil
+	}
+	return new(big.Int).Set(b.header.BaseFee)
+}
+
 func (b *Block) NumberU64() uint64        { return b.header.Number.Uint64() }
 func (b *Block) MixDigest() common.Hash   { return b.header.MixDigest }
 func (b *Block) Nonce() uint64            { return binary.BigEndian.Uint64(b.header.Nonce[:]) }
@@ -417,7 +509,8 @@ func (h *Header) String() string {
 	Extra:		    %s
 	MixDigest:      %x
 	Nonce:		    %x
-]`, h.Hash(), h.ParentHash, h.UncleHash, h.Coinbase, h.Root, h.TxHash, h.ReceiptHash, h.Bloom, h.Difficulty, h.Number, h.GasLimit, h.GasUsed, h.Time, h.Extra, h.MixDigest, h.Nonce)
+	BaseFee:	    %v
+]`, h.Hash(), h.ParentHash, h.UncleHash, h.Coinbase, h.Root, h.TxHash, h.ReceiptHash, h.Bloom, h.Difficulty, h.Number, h.GasLimit, h.GasUsed, h.Time, h.Extra, h.MixDigest, h.Nonce, h.BaseFee)
 }
 
 type Blocks []*Block
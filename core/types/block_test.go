@@ -68,3 +68,38 @@ func TestBlockEncoding(t *testing.T) {
 		t.Errorf("encoded block mismatch:\ngot:  %x\nwant: %x", ourBlockEnc, blockEnc)
 	}
 }
+
+// Tests that the base fee is only part of the header encoding when set, keeping
+// legacy headers byte for byte identical.
+func TestHeaderBaseFeeEncoding(t *testing.T) {
+	legacy := &Header{
+		Difficulty: big.NewInt(131072),
+		Number:     big.NewInt(1),
+		GasLimit:   big.NewInt(3141592),
+		GasUsed:    big.NewInt(21000),
+		Time:       big.NewInt(1426516743),
+		Extra:      []byte("test"),
+	}
+	london := CopyHeader(legacy)
+	london.BaseFee = big.NewInt(1000000000)
+
+	for i, header := range []*Header{legacy, london} {
+		enc, err := rlp.EncodeToBytes(header)
+		if err != nil {
+			t.Fatalf("header %d: encode error: %v", i, err)
+		}
+		var dec Header
+		if err := rlp.DecodeBytes(enc, &dec); err != nil {
+			t.Fatalf("header %d: decode error: %v", i, err)
+		}
+		if dec.Hash() != header.Hash() {
+			t.Errorf("header %d: hash mismatch: have %x, want %x", i, dec.Hash(), header.Hash())
+		}
+		if (dec.BaseFee == nil) != (header.BaseFee == nil) || (dec.BaseFee != nil && dec.BaseFee.Cmp(header.BaseFee) != 0) {
+			t.Errorf("header %d: base fee mismatch: have %v, want %v", i, dec.BaseFee, header.BaseFee)
+		}
+	}
+	if legacy.Hash() == london.Hash() {
+		t.Errorf("base fee not part of the header hash")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// dynamicFeeTxdata is the RLP payload of an EIP-1559 dynamic fee transaction, as
+// wrapped into the typed transaction envelope.
+type dynamicFeeTxdata struct {
+	ChainID      *big.Int
+	AccountNonce uint64
+	GasTipCap    *big.Int
+	GasFeeCap    *big.Int
+	GasLimit     *big.Int
+	Recipient    *common.Address `rlp:"nil"` // nil means contract creation
+	Amount       *big.Int
+	Payload      []byte
+	AccessList   AccessList
+
+	// Signature values
+	V *big.Int
+	R *big.Int
+	S *big.Int
+}
+
+// newDynamicFeeTxdata assembles the typed payload from the generic transaction data.
+func newDynamicFeeTxdata(data *txdata) *dynamicFeeTxdata {
+	return &dynamicFeeTxdata{
+		ChainID:      data.ChainID,
+		AccountNonce: data.AccountNonce,
+		GasTipCap:    data.GasTipCap,
+		GasFeeCap:    data.GasFeeCap,
+		GasLimit:     data.GasLimit,
+		Recipient:    data.Recipient,
+		Amount:       data.Amount,
+		Payload:      data.Payload,
+		AccessList:   data.AccessList,
+		V:            data.V,
+		R:            data.R,
+		S:            data.S,
+	}
+}
+
+// txdata converts the typed payload back into the generic transaction data. The
+// legacy gas price is set to the fee cap, the most the transaction may pay.
+func (d *dynamicFeeTxdata) txdata() txdata {
+	return txdata{
+		Type:         DynamicFeeTxType,
+		ChainID:      d.ChainID,
+		AccountNonce: d.AccountNonce,
+		Price:        new(big.Int).Set(d.GasFeeCap),
+		GasTipCap:    d.GasTipCap,
+		GasFeeCap:    d.GasFeeCap,
+		GasLimit:     d.GasLimit,
+		Recipient:    d.Recipient,
+		Amount:       d.Amount,
+		Payload:      d.Payload,
+		AccessList:   d.AccessList,
+		V:            d.V,
+		R:            d.R,
+		S:            d.S,
+	}
+}
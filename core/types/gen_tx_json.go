@@ -22,6 +22,11 @@ func (t txdata) MarshalJSON() ([]byte, error) {
 		V            *hexutil.Big    `json:"v" gencodec:"required"`
 		R            *hexutil.Big    `json:"r" gencodec:"required"`
 		S            *hexutil.Big    `json:"s" gencodec:"required"`
+		Type         hexutil.Uint64  `json:"type"                 rlp:"-"`
+		ChainID      *hexutil.Big    `json:"chainId,omitempty"    rlp:"-"`
+		AccessList   AccessList      `json:"accessList,omitempty" rlp:"-"`
+		GasTipCap    *hexutil.Big    `json:"maxPriorityFeePerGas,omitempty" rlp:"-"`
+		GasFeeCap    *hexutil.Big    `json:"maxFeePerGas,omitempty"         rlp:"-"`
 		Hash         *common.Hash    `json:"hash" rlp:"-"`
 	}
 	var enc txdata
@@ -34,6 +39,11 @@ func (t txdata) MarshalJSON() ([]byte, error) {
 	enc.V = (*hexutil.Big)(t.V)
 	enc.R = (*hexutil.Big)(t.R)
 	enc.S = (*hexutil.Big)(t.S)
+	enc.Type = hexutil.Uint64(t.Type)
+	enc.ChainID = (*hexutil.Big)(t.ChainID)
+	enc.AccessList = t.AccessList
+	enc.GasTipCap = (*hexutil.Big)(t.GasTipCap)
+	enc.GasFeeCap = (*hexutil.Big)(t.GasFeeCap)
 	enc.Hash = t.Hash
 	return json.Marshal(&enc)
 }
@@ -49,6 +59,11 @@ func (t *txdata) UnmarshalJSON(input []byte) error {
 		V            *hexutil.Big    `json:"v" gencodec:"required"`
 		R            *hexutil.Big    `json:"r" gencodec:"required"`
 		S            *hexutil.Big    `json:"s" gencodec:"required"`
+		Type         *hexutil.Uint64 `json:"type"                 rlp:"-"`
+		ChainID      *hexutil.Big    `json:"chainId,omitempty"    rlp:"-"`
+		AccessList   *AccessList     `json:"accessList,omitempty" rlp:"-"`
+		GasTipCap    *hexutil.Big    `json:"maxPriorityFeePerGas,omitempty" rlp:"-"`
+		GasFeeCap    *hexutil.Big    `json:"maxFeePerGas,omitempty"         rlp:"-"`
 		Hash         *common.Hash    `json:"hash" rlp:"-"`
 	}
 	var dec txdata
@@ -90,6 +105,21 @@ func (t *txdata) UnmarshalJSON(input []byte) error {
 		return errors.New("missing required field 's' for txdata")
 	}
 	t.S = (*big.Int)(dec.S)
+	if dec.Type != nil {
+		t.Type = uint8(*dec.Type)
+	}
+	if dec.ChainID != nil {
+		t.ChainID = (*big.Int)(dec.ChainID)
+	}
+	if dec.AccessList != nil {
+		t.AccessList = *dec.AccessList
+	}
+	if dec.GasTipCap != nil {
+		t.GasTipCap = (*big.Int)(dec.GasTipCap)
+	}
+	if dec.GasFeeCap != nil {
+		t.GasFeeCap = (*big.Int)(dec.GasFeeCap)
+	}
 	if dec.Hash != nil {
 		t.Hash = dec.Hash
 	}
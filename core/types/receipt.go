@@ -17,9 +17,12 @@
 package types
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
+	"unsafe"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
@@ -28,9 +31,12 @@ import (
 
 //go:generate gencodec -type Receipt -field-override receiptMarshaling -out gen_receipt_json.go
 
+var errEmptyTypedReceipt = errors.New("empty typed receipt bytes")
+
 // Receipt represents the results of a transaction.
 type Receipt struct {
 	// Consensus fields
+	Type              uint8    `json:"type,omitempty"`
 	PostState         []byte   `json:"root"`
 	CumulativeGasUsed *big.Int `json:"cumulativeGasUsed" gencodec:"required"`
 	Bloom             Bloom    `json:"logsBloom"         gencodec:"required"`
@@ -43,6 +49,7 @@ type Receipt struct {
 }
 
 type receiptMarshaling struct {
+	Type              hexutil.Uint64
 	PostState         hexutil.Bytes
 	CumulativeGasUsed *hexutil.Big
 	GasUsed           *hexutil.Big
@@ -72,7 +79,34 @@ func NewReceipt(root []byte, cumulativeGasUsed *big.Int) *Receipt {
 
 // EncodeRLP implements rlp.Encoder, and flattens the consensus fields of a receipt
 // into an RLP stream. If no post state is present, metropolis fork is assumed.
+// Receipts of typed transactions are wrapped into an RLP string prefixed with
+// the transaction type.
 func (r *Receipt) EncodeRLP(w io.Writer) error {
+	if r.Type == LegacyTxType {
+		return r.encodeConsensus(w)
+	}
+	enc, err := r.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return rlp.Encode(w, enc)
+}
+
+// MarshalBinary returns the canonical consensus encoding of the receipt: the
+// bare RLP list for legacy transactions, type byte || RLP list for typed ones.
+func (r *Receipt) MarshalBinary() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if r.Type != LegacyTxType {
+		buf.WriteByte(r.Type)
+	}
+	if err := r.encodeConsensus(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeConsensus writes the untyped RLP list of the consensus fields.
+func (r *Receipt) encodeConsensus(w io.Writer) error {
 	if r.PostState == nil {
 		return rlp.Encode(w, &metropolisReceiptRLP{r.CumulativeGasUsed, r.Bloom, r.Logs})
 	}
@@ -82,11 +116,35 @@ func (r *Receipt) EncodeRLP(w io.Writer) error {
 // DecodeRLP implements rlp.Decoder, and loads the consensus fields of a receipt
 // from an RLP stream.
 func (r *Receipt) DecodeRLP(s *rlp.Stream) error {
+	kind, _, err := s.Kind()
+	if err != nil {
+		return err
+	}
+	if kind != rlp.List {
+		// Typed receipt, wrapped into an RLP string
+		b, err := s.Bytes()
+		if err != nil {
+			return err
+		}
+		if len(b) == 0 {
+			return errEmptyTypedReceipt
+		}
+		if b[0] != AccessListTxType && b[0] != DynamicFeeTxType {
+			return ErrTxTypeNotSupported
+		}
+		r.Type = b[0]
+		return r.decodeConsensus(b[1:])
+	}
 	// Load the raw bytes since we have multiple possible formats
 	raw, err := s.Raw()
 	if err != nil {
 		return err
 	}
+	return r.decodeConsensus(raw)
+}
+
+// decodeConsensus loads the consensus fields from an untyped RLP list.
+func (r *Receipt) decodeConsensus(raw []byte) error {
 	list, _, err := rlp.SplitList(raw)
 	if err != nil {
 		return err
@@ -125,6 +183,18 @@ func (r *Receipt) DecodeRLP(s *rlp.Stream) error {
 	}
 }
 
+// Size returns the approximate memory used by all internal contents. It is used
+// to approximate and limit the memory consumption of various caches.
+func (r *Receipt) Size() common.StorageSize {
+	size := common.StorageSize(unsafe.Sizeof(*r)) + common.StorageSize(len(r.PostState))
+
+	size += common.StorageSize(len(r.Logs)) * common.StorageSize(unsafe.Sizeof(Log{}))
+	for _, log := range r.Logs {
+		size += common.StorageSize(len(log.Topics)*common.HashLength + len(log.Data))
+	}
+	return size
+}
+
 // String implements the Stringer interface.
 func (r *Receipt) String() string {
 	if r.PostState == nil {
@@ -138,13 +208,18 @@ func (r *Receipt) String() string {
 type ReceiptForStorage Receipt
 
 // EncodeRLP implements rlp.Encoder, and flattens all content fields of a receipt
-// into an RLP stream.
+// into an RLP stream. The transaction type is only appended for typed receipts
+// to keep the legacy database format intact.
 func (r *ReceiptForStorage) EncodeRLP(w io.Writer) error {
 	logs := make([]*LogForStorage, len(r.Logs))
 	for i, log := range r.Logs {
 		logs[i] = (*LogForStorage)(log)
 	}
-	return rlp.Encode(w, []interface{}{r.PostState, r.CumulativeGasUsed, r.Bloom, r.TxHash, r.ContractAddress, logs, r.GasUsed})
+	fields := []interface{}{r.PostState, r.CumulativeGasUsed, r.Bloom, r.TxHash, r.ContractAddress, logs, r.GasUsed}
+	if r.Type != LegacyTxType {
+		fields = append(fields, r.Type)
+	}
+	return rlp.Encode(w, fields)
 }
 
 // DecodeRLP implements rlp.Decoder, and loads both consensus and implementation
@@ -158,10 +233,16 @@ func (r *ReceiptForStorage) DecodeRLP(s *rlp.Stream) error {
 		ContractAddress   common.Address
 		Logs              []*LogForStorage
 		GasUsed           *big.Int
+		Rest              []rlp.RawValue `rlp:"tail"` // Transaction type of typed receipts
 	}
 	if err := s.Decode(&receipt); err != nil {
 		return err
 	}
+	if len(receipt.Rest) > 0 {
+		if err := rlp.DecodeBytes(receipt.Rest[0], &r.Type); err != nil {
+			return err
+		}
+	}
 	// Assign the consensus fields
 	r.PostState, r.CumulativeGasUsed, r.Bloom = receipt.PostState, receipt.CumulativeGasUsed, receipt.Bloom
 	r.Logs = make([]*Log, len(receipt.Logs))
@@ -180,9 +261,9 @@ type Receipts []*Receipt
 // Len returns the number of receipts in this list.
 func (r Receipts) Len() int { return len(r) }
 
-// GetRlp returns the RLP encoding of one receipt from the list.
+// GetRlp returns the canonical encoding of one receipt from the list.
 func (r Receipts) GetRlp(i int) []byte {
-	bytes, err := rlp.EncodeToBytes(r[i])
+	bytes, err := r[i].MarshalBinary()
 	if err != nil {
 		panic(err)
 	}
@@ -26,6 +26,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/rlp"
 )
@@ -33,17 +34,29 @@ import (
 //go:generate gencodec -type txdata -field-override txdataMarshaling -out gen_tx_json.go
 
 var (
-	ErrInvalidSig = errors.New("invalid transaction v, r, s values")
-	errNoSigner   = errors.New("missing signing methods")
+	ErrInvalidSig         = errors.New("invalid transaction v, r, s values")
+	ErrTxTypeNotSupported = errors.New("transaction type not supported")
+	ErrFeeCapTooLow       = errors.New("fee cap less than base fee")
+	errNoSigner           = errors.New("missing signing methods")
+	errEmptyTypedTx       = errors.New("empty typed transaction bytes")
+)
+
+// Transaction types.
+const (
+	LegacyTxType     = iota // Untyped, pre-envelope transaction
+	AccessListTxType        // EIP-2930 transaction carrying an access list
+	DynamicFeeTxType        // EIP-1559 transaction paying a base fee and a miner tip
 )
 
 // deriveSigner makes a *best* guess about which signer to use.
-func deriveSigner(V *big.Int) Signer {
-	if V.Sign() != 0 && isProtectedV(V) {
+func deriveSigner(tx *Transaction) Signer {
+	if tx.data.Type != LegacyTxType {
+		return NewLondonSigner(tx.data.ChainID)
+	}
+	if V := tx.data.V; V.Sign() != 0 && isProtectedV(V) {
 		return NewEIP155Signer(deriveChainId(V))
-	} else {
-		return HomesteadSigner{}
 	}
+	return HomesteadSigner{}
 }
 
 type Transaction struct {
@@ -67,6 +80,15 @@ type txdata struct {
 	R *big.Int `json:"r" gencodec:"required"`
 	S *big.Int `json:"s" gencodec:"required"`
 
+	// Typed transaction fields, not part of the legacy RLP encoding.
+	Type       uint8      `json:"type"                 rlp:"-"`
+	ChainID    *big.Int   `json:"chainId,omitempty"    rlp:"-"`
+	AccessList AccessList `json:"accessList,omitempty" rlp:"-"`
+
+	// Dynamic fee transaction fields. Price mirrors GasFeeCap for these.
+	GasTipCap *big.Int `json:"maxPriorityFeePerGas,omitempty" rlp:"-"`
+	GasFeeCap *big.Int `json:"maxFeePerGas,omitempty"         rlp:"-"`
+
 	// This is only used when marshaling to JSON.
 	Hash *common.Hash `json:"hash" rlp:"-"`
 }
@@ -80,6 +102,10 @@ type txdataMarshaling struct {
 	V            *hexutil.Big
 	R            *hexutil.Big
 	S            *hexutil.Big
+	Type         hexutil.Uint64
+	ChainID      *hexutil.Big
+	GasTipCap    *hexutil.Big
+	GasFeeCap    *hexutil.Big
 }
 
 func NewTransaction(nonce uint64, to common.Address, amount, gasLimit, gasPrice *big.Int, data []byte) *Transaction {
@@ -118,13 +144,48 @@ func newTransaction(nonce uint64, to *common.Address, amount, gasLimit, gasPrice
 	return &Transaction{data: d}
 }
 
+// NewAccessListTransaction creates an unsigned EIP-2930 transaction which pre-declares
+// the accounts and storage slots it's going to touch. If to is nil, the transaction
+// is a contract creation. The chain id is filled in by the signer.
+func NewAccessListTransaction(nonce uint64, to *common.Address, amount, gasLimit, gasPrice *big.Int, data []byte, accessList AccessList) *Transaction {
+	tx := newTransaction(nonce, to, amount, gasLimit, gasPrice, data)
+	tx.data.Type = AccessListTxType
+	tx.data.ChainID = new(big.Int)
+	tx.data.AccessList = accessList.copy()
+	return tx
+}
+
+// NewDynamicFeeTransaction creates an unsigned EIP-1559 transaction. The sender pays
+// at most gasFeeCap per unit of gas, of which the base fee is burnt and the miner
+// receives up to gasTipCap. If to is nil, the transaction is a contract creation.
+// The chain id is filled in by the signer.
+func NewDynamicFeeTransaction(nonce uint64, to *common.Address, amount, gasLimit, gasTipCap, gasFeeCap *big.Int, data []byte, accessList AccessList) *Transaction {
+	tx := newTransaction(nonce, to, amount, gasLimit, gasFeeCap, data)
+	tx.data.Type = DynamicFeeTxType
+	tx.data.ChainID = new(big.Int)
+	tx.data.AccessList = accessList.copy()
+	tx.data.GasFeeCap = new(big.Int).Set(tx.data.Price)
+	tx.data.GasTipCap = new(big.Int)
+	if gasTipCap != nil {
+		tx.data.GasTipCap.Set(gasTipCap)
+	}
+	return tx
+}
+
 // ChainId returns which chain id this transaction was signed for (if at all)
 func (tx *Transaction) ChainId() *big.Int {
+	if tx.data.Type != LegacyTxType {
+		return new(big.Int).Set(tx.data.ChainID)
+	}
 	return deriveChainId(tx.data.V)
 }
 
 // Protected returns whether the transaction is protected from replay protection.
+// Typed transactions always commit to a chain id and are thus always protected.
 func (tx *Transaction) Protected() bool {
+	if tx.data.Type != LegacyTxType {
+		return true
+	}
 	return isProtectedV(tx.data.V)
 }
 
@@ -137,20 +198,110 @@ func isProtectedV(V *big.Int) bool {
 	return true
 }
 
-// DecodeRLP implements rlp.Encoder
+// EncodeRLP implements rlp.Encoder. Legacy transactions are encoded as an RLP
+// list, typed transactions as an RLP string wrapping their binary envelope.
 func (tx *Transaction) EncodeRLP(w io.Writer) error {
-	return rlp.Encode(w, &tx.data)
+	if tx.data.Type == LegacyTxType {
+		return rlp.Encode(w, &tx.data)
+	}
+	enc, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return rlp.Encode(w, enc)
 }
 
 // DecodeRLP implements rlp.Decoder
 func (tx *Transaction) DecodeRLP(s *rlp.Stream) error {
-	_, size, _ := s.Kind()
-	err := s.Decode(&tx.data)
-	if err == nil {
-		tx.size.Store(common.StorageSize(rlp.ListSize(size)))
+	kind, size, err := s.Kind()
+	switch {
+	case err != nil:
+		return err
+	case kind == rlp.List:
+		var data txdata
+		if err := s.Decode(&data); err != nil {
+			return err
+		}
+		tx.data = data
+	default:
+		b, err := s.Bytes()
+		if err != nil {
+			return err
+		}
+		if err := tx.decodeTyped(b); err != nil {
+			return err
+		}
+	}
+	tx.size.Store(common.StorageSize(rlp.ListSize(size)))
+	return nil
+}
+
+// MarshalBinary returns the canonical encoding of the transaction. For legacy
+// transactions this is the RLP list, for typed ones the type byte followed by
+// the RLP encoded payload.
+func (tx *Transaction) MarshalBinary() ([]byte, error) {
+	if tx.data.Type == LegacyTxType {
+		return rlp.EncodeToBytes(&tx.data)
+	}
+	payload, err := rlp.EncodeToBytes(tx.typedPayload())
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{tx.data.Type}, payload...), nil
+}
+
+// UnmarshalBinary decodes the canonical encoding of a transaction, accepting
+// both legacy and typed transactions.
+func (tx *Transaction) UnmarshalBinary(b []byte) error {
+	if len(b) > 0 && b[0] > 0x7f {
+		var data txdata
+		if err := rlp.DecodeBytes(b, &data); err != nil {
+			return err
+		}
+		*tx = Transaction{data: data}
+		tx.size.Store(common.StorageSize(len(b)))
+		return nil
+	}
+	var dec Transaction
+	if err := dec.decodeTyped(b); err != nil {
+		return err
+	}
+	*tx = dec
+	tx.size.Store(common.StorageSize(len(b)))
+	return nil
+}
+
+// typedPayload returns the type specific RLP payload of a typed transaction.
+func (tx *Transaction) typedPayload() interface{} {
+	if tx.data.Type == DynamicFeeTxType {
+		return newDynamicFeeTxdata(&tx.data)
 	}
+	return newAccessListTxdata(&tx.data)
+}
 
-	return err
+// decodeTyped decodes a typed transaction envelope into tx.
+func (tx *Transaction) decodeTyped(b []byte) error {
+	if len(b) == 0 {
+		return errEmptyTypedTx
+	}
+	switch b[0] {
+	case AccessListTxType:
+		var inner accessListTxdata
+		if err := rlp.DecodeBytes(b[1:], &inner); err != nil {
+			return err
+		}
+		tx.data = inner.txdata()
+		return nil
+	case DynamicFeeTxType:
+		var inner dynamicFeeTxdata
+		if err := rlp.DecodeBytes(b[1:], &inner); err != nil {
+			return err
+		}
+		tx.data = inner.txdata()
+		return nil
+	default:
+		return ErrTxTypeNotSupported
+	}
 }
 
 func (tx *Transaction) MarshalJSON() ([]byte, error) {
@@ -167,10 +318,27 @@ func (tx *Transaction) UnmarshalJSON(input []byte) error {
 		return err
 	}
 	var V byte
-	if isProtectedV(dec.V) {
+	switch {
+	case dec.Type == AccessListTxType || dec.Type == DynamicFeeTxType:
+		if dec.ChainID == nil {
+			return errors.New("missing required field 'chainId' for typed transaction")
+		}
+		if dec.V.BitLen() > 8 {
+			return ErrInvalidSig
+		}
+		if dec.Type == DynamicFeeTxType {
+			if dec.GasTipCap == nil || dec.GasFeeCap == nil {
+				return errors.New("missing required fee caps for dynamic fee transaction")
+			}
+			dec.Price = new(big.Int).Set(dec.GasFeeCap)
+		}
+		V = byte(dec.V.Uint64())
+	case dec.Type != LegacyTxType:
+		return ErrTxTypeNotSupported
+	case isProtectedV(dec.V):
 		chainId := deriveChainId(dec.V).Uint64()
 		V = byte(dec.V.Uint64() - 35 - 2*chainId)
-	} else {
+	default:
 		V = byte(dec.V.Uint64() - 27)
 	}
 	if !crypto.ValidateSignatureValues(V, dec.R, dec.S, false) {
@@ -186,6 +354,43 @@ func (tx *Transaction) GasPrice() *big.Int { return new(big.Int).Set(tx.data.Pri
 func (tx *Transaction) Value() *big.Int    { return new(big.Int).Set(tx.data.Amount) }
 func (tx *Transaction) Nonce() uint64      { return tx.data.AccountNonce }
 func (tx *Transaction) CheckNonce() bool   { return true }
+func (tx *Transaction) Type() uint8        { return tx.data.Type }
+
+// AccessList returns the access list of the transaction, nil for legacy ones.
+func (tx *Transaction) AccessList() AccessList { return tx.data.AccessList.copy() }
+
+// GasTipCap returns the maximum tip per gas paid to the miner. For transactions
+// without a dynamic fee this is the gas price.
+func (tx *Transaction) GasTipCap() *big.Int {
+	if tx.data.Type == DynamicFeeTxType {
+		return new(big.Int).Set(tx.data.GasTipCap)
+	}
+	return new(big.Int).Set(tx.data.Price)
+}
+
+// GasFeeCap returns the maximum total fee per gas the sender is willing to pay.
+// For transactions without a dynamic fee this is the gas price.
+func (tx *Transaction) GasFeeCap() *big.Int {
+	if tx.data.Type == DynamicFeeTxType {
+		return new(big.Int).Set(tx.data.GasFeeCap)
+	}
+	return new(big.Int).Set(tx.data.Price)
+}
+
+// EffectiveGasTip returns the tip per gas the miner receives given the base fee
+// of the block: the lower of the tip cap and the fee cap less the base fee. An
+// error is returned if the fee cap doesn't cover the base fee.
+func (tx *Transaction) EffectiveGasTip(baseFee *big.Int) (*big.Int, error) {
+	if baseFee == nil {
+		return tx.GasTipCap(), nil
+	}
+	tip := tx.GasFeeCap()
+	if tip.Cmp(baseFee) < 0 {
+		return nil, ErrFeeCapTooLow
+	}
+	tip.Sub(tip, baseFee)
+	return math.BigMin(tip, tx.GasTipCap()), nil
+}
 
 // To returns the recipient address of the transaction.
 // It returns nil if the transaction is a contract creation.
@@ -204,7 +409,12 @@ func (tx *Transaction) Hash() common.Hash {
 	if hash := tx.hash.Load(); hash != nil {
 		return hash.(common.Hash)
 	}
-	v := rlpHash(tx)
+	var v common.Hash
+	if tx.data.Type == LegacyTxType {
+		v = rlpHash(tx)
+	} else {
+		v = prefixedRlpHash(tx.data.Type, tx.typedPayload())
+	}
 	tx.hash.Store(v)
 	return v
 }
@@ -220,7 +430,7 @@ func (tx *Transaction) Size() common.StorageSize {
 		return size.(common.StorageSize)
 	}
 	c := writeCounter(0)
-	rlp.Encode(&c, &tx.data)
+	rlp.Encode(&c, tx)
 	tx.size.Store(common.StorageSize(c))
 	return common.StorageSize(c)
 }
@@ -234,10 +444,13 @@ func (tx *Transaction) AsMessage(s Signer) (Message, error) {
 	msg := Message{
 		nonce:      tx.data.AccountNonce,
 		price:      new(big.Int).Set(tx.data.Price),
+		gasFeeCap:  tx.GasFeeCap(),
+		gasTipCap:  tx.GasTipCap(),
 		gasLimit:   new(big.Int).Set(tx.data.GasLimit),
 		to:         tx.data.Recipient,
 		amount:     tx.data.Amount,
 		data:       tx.data.Payload,
+		accessList: tx.data.AccessList,
 		checkNonce: true,
 	}
 
@@ -268,7 +481,7 @@ func (tx *Transaction) String() string {
 	if tx.data.V != nil {
 		// make a best guess about the signer and use that to derive
 		// the sender.
-		signer := deriveSigner(tx.data.V)
+		signer := deriveSigner(tx)
 		if f, err := Sender(signer, tx); err != nil { // derive but don't cache
 			from = "[invalid sender: invalid sig]"
 		} else {
@@ -283,9 +496,10 @@ func (tx *Transaction) String() string {
 	} else {
 		to = fmt.Sprintf("%x", tx.data.Recipient[:])
 	}
-	enc, _ := rlp.EncodeToBytes(&tx.data)
+	enc, _ := tx.MarshalBinary()
 	return fmt.Sprintf(`
 	TX(%x)
+	Type:     %d
 	Contract: %v
 	From:     %s
 	To:       %s
@@ -300,6 +514,7 @@ func (tx *Transaction) String() string {
 	Hex:      %x
 `,
 		tx.Hash(),
+		tx.data.Type,
 		len(tx.data.Recipient) == 0,
 		from,
 		to,
@@ -324,9 +539,10 @@ func (s Transactions) Len() int { return len(s) }
 // Swap swaps the i'th and the j'th element in s
 func (s Transactions) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 
-// GetRlp implements Rlpable and returns the i'th element of s in rlp
+// GetRlp implements Rlpable and returns the i'th element of s in its canonical
+// encoding (the bare RLP list for legacy transactions, the envelope for typed ones).
 func (s Transactions) GetRlp(i int) []byte {
-	enc, _ := rlp.EncodeToBytes(s[i])
+	enc, _ := s[i].MarshalBinary()
 	return enc
 }
 
@@ -359,24 +575,42 @@ func (s TxByNonce) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 
 // TxByPrice implements both the sort and the heap interface, making it useful
 // for all at once sorting as well as individually adding and removing elements.
-type TxByPrice Transactions
+// Transactions are ordered by the tip they pay the miner on top of the base fee.
+type TxByPrice struct {
+	txs     Transactions
+	baseFee *big.Int
+}
 
-func (s TxByPrice) Len() int           { return len(s) }
-func (s TxByPrice) Less(i, j int) bool { return s[i].data.Price.Cmp(s[j].data.Price) > 0 }
-func (s TxByPrice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s TxByPrice) Len() int { return len(s.txs) }
+func (s TxByPrice) Less(i, j int) bool {
+	return s.txs[i].minerTip(s.baseFee).Cmp(s.txs[j].minerTip(s.baseFee)) > 0
+}
+func (s TxByPrice) Swap(i, j int) { s.txs[i], s.txs[j] = s.txs[j], s.txs[i] }
 
 func (s *TxByPrice) Push(x interface{}) {
-	*s = append(*s, x.(*Transaction))
+	s.txs = append(s.txs, x.(*Transaction))
 }
 
 func (s *TxByPrice) Pop() interface{} {
-	old := *s
+	old := s.txs
 	n := len(old)
 	x := old[n-1]
-	*s = old[0 : n-1]
+	s.txs = old[0 : n-1]
 	return x
 }
 
+// minerTip returns the tip per gas the miner would receive for the transaction
+// given the base fee. Unlike EffectiveGasTip, it goes negative if the fee cap
+// doesn't cover the base fee.
+func (tx *Transaction) minerTip(baseFee *big.Int) *big.Int {
+	if baseFee == nil {
+		return tx.data.Price
+	}
+	tip := tx.GasFeeCap()
+	tip.Sub(tip, baseFee)
+	return math.BigMin(tip, tx.GasTipCap())
+}
+
 // TransactionsByPriceAndNonce represents a set of transactions that can return
 // transactions in a profit-maximising sorted order, while supporting removing
 // entire batches of transactions for non-executable accounts.
@@ -386,15 +620,16 @@ type TransactionsByPriceAndNonce struct {
 }
 
 // NewTransactionsByPriceAndNonce creates a transaction set that can retrieve
-// price sorted transactions in a nonce-honouring way.
+// price sorted transactions in a nonce-honouring way. The base fee is used to
+// rank transactions by effective miner tip, nil ranks by gas price.
 //
 // Note, the input map is reowned so the caller should not interact any more with
 // if after providng it to the constructor.
-func NewTransactionsByPriceAndNonce(txs map[common.Address]Transactions) *TransactionsByPriceAndNonce {
+func NewTransactionsByPriceAndNonce(txs map[common.Address]Transactions, baseFee *big.Int) *TransactionsByPriceAndNonce {
 	// Initialize a price based heap with the head transactions
-	heads := make(TxByPrice, 0, len(txs))
+	heads := TxByPrice{txs: make(Transactions, 0, len(txs)), baseFee: baseFee}
 	for acc, accTxs := range txs {
-		heads = append(heads, accTxs[0])
+		heads.txs = append(heads.txs, accTxs[0])
 		txs[acc] = accTxs[1:]
 	}
 	heap.Init(&heads)
@@ -408,19 +643,19 @@ func NewTransactionsByPriceAndNonce(txs map[common.Address]Transactions) *Transa
 
 // Peek returns the next transaction by price.
 func (t *TransactionsByPriceAndNonce) Peek() *Transaction {
-	if len(t.heads) == 0 {
+	if len(t.heads.txs) == 0 {
 		return nil
 	}
-	return t.heads[0]
+	return t.heads.txs[0]
 }
 
 // Shift replaces the current best head with the next one from the same account.
 func (t *TransactionsByPriceAndNonce) Shift() {
-	signer := deriveSigner(t.heads[0].data.V)
+	signer := deriveSigner(t.heads.txs[0])
 	// derive signer but don't cache.
-	acc, _ := Sender(signer, t.heads[0]) // we only sort valid txs so this cannot fail
+	acc, _ := Sender(signer, t.heads.txs[0]) // we only sort valid txs so this cannot fail
 	if txs, ok := t.txs[acc]; ok && len(txs) > 0 {
-		t.heads[0], t.txs[acc] = txs[0], txs[1:]
+		t.heads.txs[0], t.txs[acc] = txs[0], txs[1:]
 		heap.Fix(&t.heads, 0)
 	} else {
 		heap.Pop(&t.heads)
@@ -442,19 +677,24 @@ type Message struct {
 	from                    common.Address
 	nonce                   uint64
 	amount, price, gasLimit *big.Int
+	gasFeeCap, gasTipCap    *big.Int
 	data                    []byte
+	accessList              AccessList
 	checkNonce              bool
 }
 
-func NewMessage(from common.Address, to *common.Address, nonce uint64, amount, gasLimit, price *big.Int, data []byte, checkNonce bool) Message {
+func NewMessage(from common.Address, to *common.Address, nonce uint64, amount, gasLimit, price *big.Int, data []byte, accessList AccessList, checkNonce bool) Message {
 	return Message{
 		from:       from,
 		to:         to,
 		nonce:      nonce,
 		amount:     amount,
 		price:      price,
+		gasFeeCap:  price,
+		gasTipCap:  price,
 		gasLimit:   gasLimit,
 		data:       data,
+		accessList: accessList,
 		checkNonce: checkNonce,
 	}
 }
@@ -467,3 +707,14 @@ func (m Message) Gas() *big.Int        { return m.gasLimit }
 func (m Message) Nonce() uint64        { return m.nonce }
 func (m Message) Data() []byte         { return m.data }
 func (m Message) CheckNonce() bool     { return m.checkNonce }
+
+// AccessList returns the accounts and storage slots pre-declared by the message.
+func (m Message) AccessList() AccessList { return m.accessList }
+
+// GasFeeCap returns the maximum fee per gas the message pays, the gas price for
+// messages without a dynamic fee.
+func (m Message) GasFeeCap() *big.Int { return m.gasFeeCap }
+
+// GasTipCap returns the maximum tip per gas the message pays to the miner, the
+// gas price for messages without a dynamic fee.
+func (m Message) GasTipCap() *big.Int { return m.gasTipCap }
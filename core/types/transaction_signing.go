@@ -45,6 +45,10 @@ type sigCache struct {
 func MakeSigner(config *params.ChainConfig, blockNumber *big.Int) Signer {
 	var signer Signer
 	switch {
+	case config.IsLondon(blockNumber):
+		signer = NewLondonSigner(config.ChainId)
+	case config.IsBerlin(blockNumber):
+		signer = NewEIP2930Signer(config.ChainId)
 	case config.IsEIP155(blockNumber):
 		signer = NewEIP155Signer(config.ChainId)
 	case config.IsHomestead(blockNumber):
@@ -108,6 +112,154 @@ type Signer interface {
 	Equal(Signer) bool
 }
 
+// LondonSigner implements Signer accepting EIP-1559 dynamic fee transactions
+// on top of everything accepted by the EIP2930Signer.
+type LondonSigner struct{ EIP2930Signer }
+
+// NewLondonSigner returns a signer that accepts EIP-1559 dynamic fee transactions,
+// EIP-2930 access list transactions, EIP-155 replay protected transactions, and
+// legacy Homestead transactions.
+func NewLondonSigner(chainId *big.Int) LondonSigner {
+	return LondonSigner{NewEIP2930Signer(chainId)}
+}
+
+func (s LondonSigner) Equal(s2 Signer) bool {
+	london, ok := s2.(LondonSigner)
+	return ok && london.chainId.Cmp(s.chainId) == 0
+}
+
+func (s LondonSigner) PublicKey(tx *Transaction) ([]byte, error) {
+	if tx.Type() != DynamicFeeTxType {
+		return s.EIP2930Signer.PublicKey(tx)
+	}
+	return recoverTyped(s.chainId, s.Hash(tx), tx)
+}
+
+// WithSignature returns a new transaction with the given signature. This signature
+// needs to be in the [R || S || V] format where V is 0 or 1.
+func (s LondonSigner) WithSignature(tx *Transaction, sig []byte) (*Transaction, error) {
+	if tx.Type() != DynamicFeeTxType {
+		return s.EIP2930Signer.WithSignature(tx, sig)
+	}
+	return withTypedSignature(s.chainId, tx, sig), nil
+}
+
+// EIP2930Signer implements Signer accepting both EIP-2930 access list
+// transactions and legacy EIP155 ones.
+type EIP2930Signer struct{ EIP155Signer }
+
+// NewEIP2930Signer returns a signer that accepts EIP-2930 access list transactions,
+// EIP-155 replay protected transactions, and legacy Homestead transactions.
+func NewEIP2930Signer(chainId *big.Int) EIP2930Signer {
+	return EIP2930Signer{NewEIP155Signer(chainId)}
+}
+
+func (s EIP2930Signer) Equal(s2 Signer) bool {
+	eip2930, ok := s2.(EIP2930Signer)
+	return ok && eip2930.chainId.Cmp(s.chainId) == 0
+}
+
+func (s EIP2930Signer) PublicKey(tx *Transaction) ([]byte, error) {
+	switch tx.Type() {
+	case LegacyTxType:
+		return s.EIP155Signer.PublicKey(tx)
+	case AccessListTxType:
+		return recoverTyped(s.chainId, s.Hash(tx), tx)
+	default:
+		return nil, ErrTxTypeNotSupported
+	}
+}
+
+// WithSignature returns a new transaction with the given signature. This signature
+// needs to be in the [R || S || V] format where V is 0 or 1.
+func (s EIP2930Signer) WithSignature(tx *Transaction, sig []byte) (*Transaction, error) {
+	switch tx.Type() {
+	case LegacyTxType:
+		return s.EIP155Signer.WithSignature(tx, sig)
+	case AccessListTxType:
+		return withTypedSignature(s.chainId, tx, sig), nil
+	default:
+		return nil, ErrTxTypeNotSupported
+	}
+}
+
+// Hash returns the hash to be signed by the sender.
+// It does not uniquely identify the transaction.
+func (s EIP2930Signer) Hash(tx *Transaction) common.Hash {
+	switch tx.Type() {
+	case LegacyTxType:
+		return s.EIP155Signer.Hash(tx)
+	case DynamicFeeTxType:
+		return prefixedRlpHash(tx.Type(), []interface{}{
+			s.chainId,
+			tx.data.AccountNonce,
+			tx.data.GasTipCap,
+			tx.data.GasFeeCap,
+			tx.data.GasLimit,
+			tx.data.Recipient,
+			tx.data.Amount,
+			tx.data.Payload,
+			tx.data.AccessList,
+		})
+	default:
+		return prefixedRlpHash(tx.Type(), []interface{}{
+			s.chainId,
+			tx.data.AccountNonce,
+			tx.data.Price,
+			tx.data.GasLimit,
+			tx.data.Recipient,
+			tx.data.Amount,
+			tx.data.Payload,
+			tx.data.AccessList,
+		})
+	}
+}
+
+// recoverTyped recovers the public key of a typed transaction signed for the
+// given chain. Typed transactions carry the plain y parity in V.
+func recoverTyped(chainId *big.Int, hash common.Hash, tx *Transaction) ([]byte, error) {
+	if tx.data.ChainID.Cmp(chainId) != 0 {
+		return nil, ErrInvalidChainId
+	}
+	if tx.data.V.BitLen() > 8 {
+		return nil, ErrInvalidSig
+	}
+	V := byte(tx.data.V.Uint64())
+	if !crypto.ValidateSignatureValues(V, tx.data.R, tx.data.S, true) {
+		return nil, ErrInvalidSig
+	}
+	// encode the signature in uncompressed format
+	R, S := tx.data.R.Bytes(), tx.data.S.Bytes()
+	sig := make([]byte, 65)
+	copy(sig[32-len(R):32], R)
+	copy(sig[64-len(S):64], S)
+	sig[64] = V
+
+	// recover the public key from the signature
+	pub, err := crypto.Ecrecover(hash[:], sig)
+	if err != nil {
+		return nil, err
+	}
+	if len(pub) == 0 || pub[0] != 4 {
+		return nil, errors.New("invalid public key")
+	}
+	return pub, nil
+}
+
+// withTypedSignature returns a copy of the typed transaction with the given
+// [R || S || V] signature, bound to the given chain.
+func withTypedSignature(chainId *big.Int, tx *Transaction, sig []byte) *Transaction {
+	if len(sig) != 65 {
+		panic(fmt.Sprintf("wrong size for signature: got %d, want 65", len(sig)))
+	}
+	cpy := &Transaction{data: tx.data}
+	cpy.data.ChainID = new(big.Int).Set(chainId)
+	cpy.data.R = new(big.Int).SetBytes(sig[:32])
+	cpy.data.S = new(big.Int).SetBytes(sig[32:64])
+	cpy.data.V = new(big.Int).SetBytes([]byte{sig[64]})
+	return cpy
+}
+
 // EIP155Transaction implements TransactionInterface using the
 // EIP155 rules
 type EIP155Signer struct {
@@ -132,6 +284,9 @@ func (s EIP155Signer) Equal(s2 Signer) bool {
 }
 
 func (s EIP155Signer) PublicKey(tx *Transaction) ([]byte, error) {
+	if tx.Type() != LegacyTxType {
+		return nil, ErrTxTypeNotSupported
+	}
 	// if the transaction is not protected fall back to homestead signer
 	if !tx.Protected() {
 		return (HomesteadSigner{}).PublicKey(tx)
@@ -219,6 +374,9 @@ func (hs HomesteadSigner) WithSignature(tx *Transaction, sig []byte) (*Transacti
 }
 
 func (hs HomesteadSigner) PublicKey(tx *Transaction) ([]byte, error) {
+	if tx.Type() != LegacyTxType {
+		return nil, ErrTxTypeNotSupported
+	}
 	if tx.data.V.BitLen() > 8 {
 		return nil, ErrInvalidSig
 	}
@@ -279,6 +437,9 @@ func (fs FrontierSigner) Hash(tx *Transaction) common.Hash {
 }
 
 func (fs FrontierSigner) PublicKey(tx *Transaction) ([]byte, error) {
+	if tx.Type() != LegacyTxType {
+		return nil, ErrTxTypeNotSupported
+	}
 	if tx.data.V.BitLen() > 8 {
 		return nil, ErrInvalidSig
 	}
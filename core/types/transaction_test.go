@@ -143,7 +143,7 @@ func TestTransactionPriceNonceSort(t *testing.T) {
 		}
 	}
 	// Sort the transactions and cross check the nonce ordering
-	txset := NewTransactionsByPriceAndNonce(groups)
+	txset := NewTransactionsByPriceAndNonce(groups, nil)
 
 	txs := Transactions{}
 	for {
@@ -232,3 +232,202 @@ func TestTransactionJSON(t *testing.T) {
 		}
 	}
 }
+
+// Tests that access list transactions survive the binary, RLP and JSON round
+// trips, and that only the EIP-2930 signer accepts them.
+func TestAccessListTransaction(t *testing.T) {
+	key, addr := defaultTestKey()
+	signer := NewEIP2930Signer(big.NewInt(18))
+
+	to := common.Address{0xaa}
+	accesses := AccessList{{Address: to, StorageKeys: []common.Hash{{0x01}, {0x02}}}}
+	tx, err := SignTx(NewAccessListTransaction(1, &to, big.NewInt(10), big.NewInt(50000), big.NewInt(1), []byte("abcdef"), accesses), signer, key)
+	if err != nil {
+		t.Fatalf("could not sign transaction: %v", err)
+	}
+	if tx.Type() != AccessListTxType {
+		t.Fatalf("transaction type mismatch: have %d, want %d", tx.Type(), AccessListTxType)
+	}
+	if !tx.Protected() || tx.ChainId().Cmp(big.NewInt(18)) != 0 {
+		t.Fatalf("chain id mismatch: have %v, want 18", tx.ChainId())
+	}
+	// Check the binary envelope encoding
+	blob, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to encode transaction: %v", err)
+	}
+	if blob[0] != AccessListTxType {
+		t.Fatalf("envelope type byte mismatch: have %d, want %d", blob[0], AccessListTxType)
+	}
+	if hash := crypto.Keccak256Hash(blob); hash != tx.Hash() {
+		t.Fatalf("hash mismatch: have %x, want %x", tx.Hash(), hash)
+	}
+	var bin Transaction
+	if err := bin.UnmarshalBinary(blob); err != nil {
+		t.Fatalf("failed to decode binary transaction: %v", err)
+	}
+	// Check the RLP encoding used by blocks and the wire protocol
+	enc, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		t.Fatalf("failed to RLP encode transaction: %v", err)
+	}
+	dec, err := decodeTx(enc)
+	if err != nil {
+		t.Fatalf("failed to RLP decode transaction: %v", err)
+	}
+	// Check the JSON encoding used by the RPC
+	data, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatalf("failed to JSON encode transaction: %v", err)
+	}
+	var parsed Transaction
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("failed to JSON decode transaction: %v", err)
+	}
+	for i, decoded := range []*Transaction{&bin, dec, &parsed} {
+		if decoded.Hash() != tx.Hash() {
+			t.Errorf("decoding %d: hash mismatch: have %x, want %x", i, decoded.Hash(), tx.Hash())
+		}
+		if decoded.AccessList().StorageKeys() != 2 {
+			t.Errorf("decoding %d: access list mismatch: have %v, want %v", i, decoded.AccessList(), accesses)
+		}
+		from, err := Sender(signer, decoded)
+		if err != nil {
+			t.Errorf("decoding %d: failed to derive sender: %v", i, err)
+		} else if from != addr {
+			t.Errorf("decoding %d: sender mismatch: have %x, want %x", i, from, addr)
+		}
+	}
+	// Legacy signers must refuse typed transactions
+	if _, err := Sender(NewEIP155Signer(big.NewInt(18)), dec); err != ErrTxTypeNotSupported {
+		t.Errorf("legacy signer error mismatch: have %v, want %v", err, ErrTxTypeNotSupported)
+	}
+	if _, err := Sender(NewEIP2930Signer(big.NewInt(1)), dec); err != ErrInvalidChainId {
+		t.Errorf("foreign chain error mismatch: have %v, want %v", err, ErrInvalidChainId)
+	}
+}
+
+// Tests that the EIP-2930 signer keeps accepting legacy transactions.
+func TestEIP2930SignerLegacy(t *testing.T) {
+	key, addr := defaultTestKey()
+
+	tx, err := SignTx(NewTransaction(0, common.Address{0xaa}, big.NewInt(10), big.NewInt(21000), big.NewInt(1), nil), NewEIP2930Signer(big.NewInt(18)), key)
+	if err != nil {
+		t.Fatalf("could not sign transaction: %v", err)
+	}
+	if tx.Type() != LegacyTxType {
+		t.Fatalf("transaction type mismatch: have %d, want %d", tx.Type(), LegacyTxType)
+	}
+	from, err := Sender(NewEIP155Signer(big.NewInt(18)), tx)
+	if err != nil {
+		t.Fatalf("failed to derive sender: %v", err)
+	}
+	if from != addr {
+		t.Errorf("sender mismatch: have %x, want %x", from, addr)
+	}
+}
+
+func TestDynamicFeeTransaction(t *testing.T) {
+	key, addr := defaultTestKey()
+	signer := NewLondonSigner(big.NewInt(18))
+
+	to := common.Address{0xaa}
+	tx, err := SignTx(NewDynamicFeeTransaction(1, &to, big.NewInt(10), big.NewInt(50000), big.NewInt(2), big.NewInt(20), []byte("abcdef"), nil), signer, key)
+	if err != nil {
+		t.Fatalf("could not sign transaction: %v", err)
+	}
+	if tx.Type() != DynamicFeeTxType {
+		t.Fatalf("transaction type mismatch: have %d, want %d", tx.Type(), DynamicFeeTxType)
+	}
+	// Check the binary and RLP encodings round trip
+	blob, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to encode transaction: %v", err)
+	}
+	if hash := crypto.Keccak256Hash(blob); hash != tx.Hash() {
+		t.Fatalf("hash mismatch: have %x, want %x", tx.Hash(), hash)
+	}
+	var bin Transaction
+	if err := bin.UnmarshalBinary(blob); err != nil {
+		t.Fatalf("failed to decode binary transaction: %v", err)
+	}
+	enc, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		t.Fatalf("failed to RLP encode transaction: %v", err)
+	}
+	dec, err := decodeTx(enc)
+	if err != nil {
+		t.Fatalf("failed to RLP decode transaction: %v", err)
+	}
+	data, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatalf("failed to JSON encode transaction: %v", err)
+	}
+	var parsed Transaction
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("failed to JSON decode transaction: %v", err)
+	}
+	for i, decoded := range []*Transaction{&bin, dec, &parsed} {
+		if decoded.Hash() != tx.Hash() {
+			t.Errorf("decoding %d: hash mismatch: have %x, want %x", i, decoded.Hash(), tx.Hash())
+		}
+		if decoded.GasTipCap().Cmp(big.NewInt(2)) != 0 || decoded.GasFeeCap().Cmp(big.NewInt(20)) != 0 {
+			t.Errorf("decoding %d: fee caps mismatch: have %v/%v, want 2/20", i, decoded.GasTipCap(), decoded.GasFeeCap())
+		}
+		from, err := Sender(signer, decoded)
+		if err != nil {
+			t.Errorf("decoding %d: failed to derive sender: %v", i, err)
+		} else if from != addr {
+			t.Errorf("decoding %d: sender mismatch: have %x, want %x", i, from, addr)
+		}
+	}
+	// Pre-London signers must refuse dynamic fee transactions
+	if _, err := Sender(NewEIP2930Signer(big.NewInt(18)), dec); err != ErrTxTypeNotSupported {
+		t.Errorf("berlin signer error mismatch: have %v, want %v", err, ErrTxTypeNotSupported)
+	}
+	// Check the effective tip at various base fees
+	for i, test := range []struct {
+		baseFee int64
+		tip     int64
+		err     error
+	}{
+		{10, 2, nil}, // tip cap fits
+		{19, 1, nil}, // fee cap limits the tip
+		{20, 0, nil}, // fee cap exactly covers the base fee
+		{21, 0, ErrFeeCapTooLow},
+	} {
+		tip, err := tx.EffectiveGasTip(big.NewInt(test.baseFee))
+		if err != test.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, test.err)
+			continue
+		}
+		if err == nil && tip.Cmp(big.NewInt(test.tip)) != 0 {
+			t.Errorf("test %d: tip mismatch: have %v, want %d", i, tip, test.tip)
+		}
+	}
+}
+
+// Tests that transactions are ordered by effective miner tip once a base fee
+// is in play, rather than by their fee caps.
+func TestTransactionPriceSortBaseFee(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 2)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	signer := NewLondonSigner(big.NewInt(1))
+	to := common.Address{0xaa}
+
+	// High fee cap but tiny tip versus a lower fee cap with a larger tip
+	high, _ := SignTx(NewDynamicFeeTransaction(0, &to, big.NewInt(0), big.NewInt(21000), big.NewInt(1), big.NewInt(100), nil, nil), signer, keys[0])
+	tipped, _ := SignTx(NewDynamicFeeTransaction(0, &to, big.NewInt(0), big.NewInt(21000), big.NewInt(5), big.NewInt(20), nil, nil), signer, keys[1])
+
+	groups := map[common.Address]Transactions{}
+	for _, tx := range []*Transaction{high, tipped} {
+		from, _ := Sender(signer, tx)
+		groups[from] = Transactions{tx}
+	}
+	txset := NewTransactionsByPriceAndNonce(groups, big.NewInt(10))
+	if first := txset.Peek(); first.Hash() != tipped.Hash() {
+		t.Errorf("ordering mismatch: have %x first, want %x", first.Hash(), tipped.Hash())
+	}
+}
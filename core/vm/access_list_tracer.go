@@ -0,0 +1,183 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// accessList is an accumulator for the set of accounts and storage slots an EVM
+// contract execution touches.
+type accessList map[common.Address]accessListSlots
+
+// accessListSlots is an accumulator for the set of storage slots within a single
+// contract that an EVM contract execution touches.
+type accessListSlots map[common.Hash]struct{}
+
+// newAccessList creates a new accessList, seeded with the given one.
+func newAccessList(seed types.AccessList) accessList {
+	al := make(accessList)
+	for _, tuple := range seed {
+		al.addAddress(tuple.Address)
+		for _, slot := range tuple.StorageKeys {
+			al.addSlot(tuple.Address, slot)
+		}
+	}
+	return al
+}
+
+// addAddress adds an address to the accesslist.
+func (al accessList) addAddress(address common.Address) {
+	if _, ok := al[address]; !ok {
+		al[address] = make(accessListSlots)
+	}
+}
+
+// addSlot adds a storage slot to the accesslist, along with its address.
+func (al accessList) addSlot(address common.Address, slot common.Hash) {
+	al.addAddress(address)
+	al[address][slot] = struct{}{}
+}
+
+// equal checks if the content of the current access list is the same as the
+// content of the other one.
+func (al accessList) equal(other accessList) bool {
+	if len(al) != len(other) {
+		return false
+	}
+	for addr, slots := range al {
+		otherSlots, ok := other[addr]
+		if !ok || len(slots) != len(otherSlots) {
+			return false
+		}
+		for slot := range slots {
+			if _, ok := otherSlots[slot]; !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// accessList converts the accesslist to a types.AccessList.
+func (al accessList) accessList() types.AccessList {
+	acl := make(types.AccessList, 0, len(al))
+	for addr, slots := range al {
+		tuple := types.AccessTuple{Address: addr, StorageKeys: []common.Hash{}}
+		for slot := range slots {
+			tuple.StorageKeys = append(tuple.StorageKeys, slot)
+		}
+		acl = append(acl, tuple)
+	}
+	return acl
+}
+
+// AccessListTracer is an EVMLogger accumulating the accounts and storage slots
+// touched by an execution, making up the EIP-2930 access list it would benefit
+// from. The sender, the recipient and the precompiled contracts are left out as
+// they are warm regardless.
+type AccessListTracer struct {
+	env      *EVM
+	excluded map[common.Address]struct{}
+	list     accessList
+}
+
+// NewAccessListTracer creates a tracer seeded with the given access list, which
+// leaves the given sender and recipient out of the accumulated list.
+func NewAccessListTracer(acl types.AccessList, from, to common.Address) *AccessListTracer {
+	excluded := map[common.Address]struct{}{from: {}, to: {}}
+
+	list := newAccessList(acl)
+	for addr := range excluded {
+		if slots, ok := list[addr]; ok && len(slots) == 0 {
+			delete(list, addr)
+		}
+	}
+	return &AccessListTracer{
+		excluded: excluded,
+		list:     list,
+	}
+}
+
+// CaptureStart implements the EVMLogger interface, retaining the EVM to tell the
+// precompiled contracts apart.
+func (a *AccessListTracer) CaptureStart(env *EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	a.env = env
+	return nil
+}
+
+// CaptureState captures all opcodes that touch storage or addresses and adds them
+// to the accesslist.
+func (a *AccessListTracer) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	size := stack.len()
+	switch {
+	case (op == SLOAD || op == SSTORE) && size >= 1:
+		a.list.addSlot(contract.Address(), common.BigToHash(stack.Back(0)))
+	case (op == EXTCODECOPY || op == EXTCODESIZE || op == BALANCE || op == SELFDESTRUCT) && size >= 1:
+		a.addAddress(common.BigToAddress(stack.Back(0)))
+	case (op == CALL || op == CALLCODE || op == DELEGATECALL) && size >= 5:
+		a.addAddress(common.BigToAddress(stack.Back(1)))
+	}
+	return nil
+}
+
+// addAddress adds an address to the accesslist, unless it's always warm.
+func (a *AccessListTracer) addAddress(addr common.Address) {
+	if _, ok := a.excluded[addr]; ok {
+		return
+	}
+	if a.env != nil && a.env.IsPrecompile(addr) {
+		return
+	}
+	a.list.addAddress(addr)
+}
+
+// CaptureFault implements the EVMLogger interface, faults are not traced.
+func (a *AccessListTracer) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnter implements the EVMLogger interface, calls are traced through
+// their opcodes.
+func (a *AccessListTracer) CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureExit implements the EVMLogger interface, calls are traced through
+// their opcodes.
+func (a *AccessListTracer) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	return nil
+}
+
+// CaptureEnd implements the EVMLogger interface, the end is not traced.
+func (a *AccessListTracer) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
+	return nil
+}
+
+// AccessList returns the current accesslist maintained by the tracer.
+func (a *AccessListTracer) AccessList() types.AccessList {
+	return a.list.accessList()
+}
+
+// Equal returns whether the accumulated access list matches the other tracer's.
+func (a *AccessListTracer) Equal(other *AccessListTracer) bool {
+	return a.list.equal(other.list)
+}
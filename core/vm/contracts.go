@@ -19,7 +19,9 @@ package vm
 import (
 	"crypto/sha256"
 	"errors"
+	"fmt"
 	"math/big"
+	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -45,6 +47,68 @@ var PrecompiledContracts = map[common.Address]PrecompiledContract{
 	common.BytesToAddress([]byte{4}): &dataCopy{},
 }
 
+var (
+	customPrecompiles     = make(map[string]PrecompiledContract)
+	customPrecompilesLock sync.RWMutex
+)
+
+// RegisterPrecompiledContract makes a custom precompiled contract implementation
+// available under the given name. Chain configurations activate it at an address
+// of their choosing through params.ChainConfig.Precompiles. Registration must
+// happen before any chain using the contract is opened.
+func RegisterPrecompiledContract(name string, p PrecompiledContract) error {
+	customPrecompilesLock.Lock()
+	defer customPrecompilesLock.Unlock()
+
+	if _, ok := customPrecompiles[name]; ok {
+		return fmt.Errorf("precompiled contract %q already registered", name)
+	}
+	customPrecompiles[name] = p
+	return nil
+}
+
+// CheckPrecompiles verifies that all custom precompiled contracts scheduled by the
+// chain configuration are registered and do not shadow a default one.
+func CheckPrecompiles(config *params.ChainConfig) error {
+	customPrecompilesLock.RLock()
+	defer customPrecompilesLock.RUnlock()
+
+	for addr, precompile := range config.Precompiles {
+		if precompile == nil {
+			continue
+		}
+		if _, ok := PrecompiledContracts[addr]; ok {
+			return fmt.Errorf("precompiled contract %q clashes with default one at %x", precompile.Name, addr)
+		}
+		if _, ok := customPrecompiles[precompile.Name]; !ok {
+			return fmt.Errorf("precompiled contract %q at %x not registered", precompile.Name, addr)
+		}
+	}
+	return nil
+}
+
+// activePrecompiles returns the precompiled contracts active at the given block,
+// the default ones extended with the custom ones scheduled by the chain config.
+func activePrecompiles(config *params.ChainConfig, num *big.Int) map[common.Address]PrecompiledContract {
+	custom := config.ActivePrecompiles(num)
+	if len(custom) == 0 {
+		return PrecompiledContracts
+	}
+	customPrecompilesLock.RLock()
+	defer customPrecompilesLock.RUnlock()
+
+	precompiles := make(map[common.Address]PrecompiledContract, len(PrecompiledContracts)+len(custom))
+	for addr, p := range PrecompiledContracts {
+		precompiles[addr] = p
+	}
+	for addr, name := range custom {
+		if p, ok := customPrecompiles[name]; ok {
+			precompiles[addr] = p
+		}
+	}
+	return precompiles
+}
+
 // RunPrecompile runs and evaluate the output of a precompiled contract defined in contracts.go
 func RunPrecompiledContract(p PrecompiledContract, input []byte, contract *Contract) (ret []byte, err error) {
 	gas := p.RequiredGas(input)
@@ -1 +1,98 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
 package vm
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// reverser is a custom precompiled contract returning its input reversed.
+type reverser struct{}
+
+func (reverser) RequiredGas(input []byte) uint64 { return 100 }
+
+func (reverser) Run(input []byte) ([]byte, error) {
+	output := make([]byte, len(input))
+	for i, b := range input {
+		output[len(input)-1-i] = b
+	}
+	return output, nil
+}
+
+func TestCustomPrecompiles(t *testing.T) {
+	if err := RegisterPrecompiledContract("reverser", reverser{}); err != nil {
+		t.Fatalf("failed to register precompile: %v", err)
+	}
+	if err := RegisterPrecompiledContract("reverser", reverser{}); err == nil {
+		t.Errorf("duplicate registration succeeded")
+	}
+	addr := common.BytesToAddress([]byte{0x01, 0x00})
+
+	config := *params.TestChainConfig
+	config.Precompiles = map[common.Address]*params.PrecompileConfig{
+		addr: {Name: "reverser", Block: big.NewInt(10)},
+	}
+	if err := CheckPrecompiles(&config); err != nil {
+		t.Fatalf("valid config rejected: %v", err)
+	}
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	// Before the activation block the address is a plain empty account
+	env := NewEVM(Context{BlockNumber: big.NewInt(9)}, statedb, &config, Config{})
+	if env.IsPrecompile(addr) {
+		t.Errorf("precompile active before its activation block")
+	}
+	if have, want := len(env.ActivePrecompiles()), len(PrecompiledContracts); have != want {
+		t.Errorf("active precompile count mismatch: have %d, want %d", have, want)
+	}
+	// From the activation block on, calls are served by the registered contract
+	env = NewEVM(Context{BlockNumber: big.NewInt(10), CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true }, Transfer: func(StateDB, common.Address, common.Address, *big.Int) {}}, statedb, &config, Config{})
+	if !env.IsPrecompile(addr) {
+		t.Fatalf("precompile inactive after its activation block")
+	}
+	ret, gas, err := env.Call(AccountRef(common.Address{}), addr, []byte{1, 2, 3}, 1000, new(big.Int))
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if want := []byte{3, 2, 1}; !bytes.Equal(ret, want) {
+		t.Errorf("output mismatch: have %x, want %x", ret, want)
+	}
+	if gas != 900 {
+		t.Errorf("leftover gas mismatch: have %d, want %d", gas, 900)
+	}
+	// Unregistered names and clashes with the default contracts are rejected
+	config.Precompiles = map[common.Address]*params.PrecompileConfig{
+		addr: {Name: "missing", Block: big.NewInt(0)},
+	}
+	if err := CheckPrecompiles(&config); err == nil {
+		t.Errorf("unregistered precompile accepted")
+	}
+	config.Precompiles = map[common.Address]*params.PrecompileConfig{
+		common.BytesToAddress([]byte{1}): {Name: "reverser", Block: big.NewInt(0)},
+	}
+	if err := CheckPrecompiles(&config); err == nil {
+		t.Errorf("precompile shadowing ecrecover accepted")
+	}
+}
@@ -19,6 +19,7 @@ package vm
 import (
 	"math/big"
 	"sync/atomic"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -36,8 +37,7 @@ type (
 // run runs the given contract and takes care of running precompiles with a fallback to the byte code interpreter.
 func run(evm *EVM, snapshot int, contract *Contract, input []byte) ([]byte, error) {
 	if contract.CodeAddr != nil {
-		precompiledContracts := PrecompiledContracts
-		if p := precompiledContracts[*contract.CodeAddr]; p != nil {
+		if p := evm.precompiles[*contract.CodeAddr]; p != nil {
 			return RunPrecompiledContract(p, input, contract)
 		}
 	}
@@ -66,6 +66,7 @@ type Context struct {
 	BlockNumber *big.Int       // Provides information for NUMBER
 	Time        *big.Int       // Provides information for TIME
 	Difficulty  *big.Int       // Provides information for DIFFICULTY
+	BaseFee     *big.Int       // Base fee of the block, nil before London
 }
 
 // EVM is the Ethereum Virtual Machine base object and provides
@@ -89,6 +90,8 @@ type EVM struct {
 	chainConfig *params.ChainConfig
 	// chain rules contains the chain rules for the current epoch
 	chainRules params.Rules
+	// precompiles contains the precompiled contracts active in the current block
+	precompiles map[common.Address]PrecompiledContract
 	// virtual machine configuration options used to initialise the
 	// evm.
 	vmConfig Config
@@ -109,18 +112,41 @@ func NewEVM(ctx Context, statedb StateDB, chainConfig *params.ChainConfig, vmCon
 		vmConfig:    vmConfig,
 		chainConfig: chainConfig,
 		chainRules:  chainConfig.Rules(ctx.BlockNumber),
+		precompiles: activePrecompiles(chainConfig, ctx.BlockNumber),
 	}
 
 	evm.interpreter = NewInterpreter(evm, vmConfig)
 	return evm
 }
 
+// ActivePrecompiles returns the addresses of the precompiled contracts active in
+// the block the EVM is executing.
+func (evm *EVM) ActivePrecompiles() []common.Address {
+	addrs := make([]common.Address, 0, len(evm.precompiles))
+	for addr := range evm.precompiles {
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// IsPrecompile reports whether the given address hosts an active precompiled
+// contract.
+func (evm *EVM) IsPrecompile(addr common.Address) bool {
+	_, ok := evm.precompiles[addr]
+	return ok
+}
+
 // Cancel cancels any running EVM operation. This may be called concurrently and
 // it's safe to be called multiple times.
 func (evm *EVM) Cancel() {
 	atomic.StoreInt32(&evm.abort, 1)
 }
 
+// Cancelled returns true if Cancel has been called
+func (evm *EVM) Cancelled() bool {
+	return atomic.LoadInt32(&evm.abort) == 1
+}
+
 // Call executes the contract associated with the addr with the given input as parameters. It also handles any
 // necessary value transfer required and takes the necessary steps to create accounts and reverses the state in
 // case of an execution error or failed value transfer.
@@ -137,13 +163,15 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 	if !evm.Context.CanTransfer(evm.StateDB, caller.Address(), value) {
 		return nil, gas, ErrInsufficientBalance
 	}
+	evm.captureBegin(CALL, caller.Address(), addr, input, gas, value)
+	defer func(start time.Time) { evm.captureEnd(start, gas, leftOverGas, ret, err) }(time.Now())
 
 	var (
 		to       = AccountRef(addr)
 		snapshot = evm.StateDB.Snapshot()
 	)
 	if !evm.StateDB.Exist(addr) {
-		if PrecompiledContracts[addr] == nil && evm.ChainConfig().IsEIP158(evm.BlockNumber) && value.Sign() == 0 {
+		if evm.precompiles[addr] == nil && evm.ChainConfig().IsEIP158(evm.BlockNumber) && value.Sign() == 0 {
 			return nil, gas, nil
 		}
 
@@ -186,6 +214,8 @@ func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte,
 	if !evm.CanTransfer(evm.StateDB, caller.Address(), value) {
 		return nil, gas, ErrInsufficientBalance
 	}
+	evm.captureBegin(CALLCODE, caller.Address(), addr, input, gas, value)
+	defer func(start time.Time) { evm.captureEnd(start, gas, leftOverGas, ret, err) }(time.Now())
 
 	var (
 		snapshot = evm.StateDB.Snapshot()
@@ -221,6 +251,8 @@ func (evm *EVM) DelegateCall(caller ContractRef, addr common.Address, input []by
 	if evm.depth > int(params.CallCreateDepth) {
 		return nil, gas, ErrDepth
 	}
+	evm.captureBegin(DELEGATECALL, caller.Address(), addr, input, gas, nil)
+	defer func(start time.Time) { evm.captureEnd(start, gas, leftOverGas, ret, err) }(time.Now())
 
 	var (
 		snapshot = evm.StateDB.Snapshot()
@@ -259,8 +291,15 @@ func (evm *EVM) Create(caller ContractRef, code []byte, gas uint64, value *big.I
 	nonce := evm.StateDB.GetNonce(caller.Address())
 	evm.StateDB.SetNonce(caller.Address(), nonce+1)
 
-	snapshot := evm.StateDB.Snapshot()
 	contractAddr = crypto.CreateAddress(caller.Address(), nonce)
+	evm.captureBegin(CREATE, caller.Address(), contractAddr, code, gas, value)
+	defer func(start time.Time) { evm.captureEnd(start, gas, leftOverGas, ret, err) }(time.Now())
+
+	// The new contract address is warm even if the creation fails (EIP-2929)
+	if evm.chainRules.IsBerlin {
+		evm.StateDB.AddAddressToAccessList(contractAddr)
+	}
+	snapshot := evm.StateDB.Snapshot()
 	evm.StateDB.CreateAccount(contractAddr)
 	if evm.ChainConfig().IsEIP158(evm.BlockNumber) {
 		evm.StateDB.SetNonce(contractAddr, 1)
@@ -307,6 +346,32 @@ func (evm *EVM) Create(caller ContractRef, code []byte, gas uint64, value *big.I
 	return ret, contractAddr, contract.Gas, err
 }
 
+// captureBegin notifies the tracer, if any, about a new call frame: the
+// outermost one through CaptureStart, nested ones through CaptureEnter.
+func (evm *EVM) captureBegin(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	if !evm.vmConfig.Debug {
+		return
+	}
+	if evm.depth == 0 {
+		evm.vmConfig.Tracer.CaptureStart(evm, from, to, typ == CREATE, input, gas, value)
+	} else {
+		evm.vmConfig.Tracer.CaptureEnter(typ, from, to, input, gas, value)
+	}
+}
+
+// captureEnd notifies the tracer, if any, about the end of the current call
+// frame, counterpart of captureBegin.
+func (evm *EVM) captureEnd(start time.Time, gas, leftOverGas uint64, ret []byte, err error) {
+	if !evm.vmConfig.Debug {
+		return
+	}
+	if evm.depth == 0 {
+		evm.vmConfig.Tracer.CaptureEnd(ret, gas-leftOverGas, time.Since(start), err)
+	} else {
+		evm.vmConfig.Tracer.CaptureExit(ret, gas-leftOverGas, err)
+	}
+}
+
 // ChainConfig returns the evmironment's chain configuration
 func (evm *EVM) ChainConfig() *params.ChainConfig { return evm.chainConfig }
 
@@ -96,20 +96,31 @@ func gasSStore(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, m
 		y, x = stack.Back(1), stack.Back(0)
 		val  = evm.StateDB.GetState(contract.Address(), common.BigToHash(x))
 	)
+	// EIP-2929: touching a cold slot incurs a surcharge, which in turn is
+	// deducted from the cost of modifying an existing slot.
+	var cold, discount uint64
+	if evm.chainRules.IsBerlin {
+		slot := common.BigToHash(x)
+		if _, slotOk := evm.StateDB.SlotInAccessList(contract.Address(), slot); !slotOk {
+			evm.StateDB.AddSlotToAccessList(contract.Address(), slot)
+			cold = params.ColdSloadCost
+		}
+		discount = params.ColdSloadCost
+	}
 	// This checks for 3 scenario's and calculates gas accordingly
 	// 1. From a zero-value address to a non-zero value         (NEW VALUE)
 	// 2. From a non-zero value address to a zero-value address (DELETE)
 	// 3. From a non-zero to a non-zero                         (CHANGE)
 	if common.EmptyHash(val) && !common.EmptyHash(common.BigToHash(y)) {
 		// 0 => non 0
-		return params.SstoreSetGas, nil
+		return cold + params.SstoreSetGas, nil
 	} else if !common.EmptyHash(val) && common.EmptyHash(common.BigToHash(y)) {
 		evm.StateDB.AddRefund(new(big.Int).SetUint64(params.SstoreRefundGas))
 
-		return params.SstoreClearGas, nil
+		return cold + params.SstoreClearGas - discount, nil
 	} else {
 		// non 0 => non 0 (or 0 => 0)
-		return params.SstoreResetGas, nil
+		return cold + params.SstoreResetGas - discount, nil
 	}
 }
 
@@ -197,8 +208,12 @@ func gasExtCodeCopy(gt params.GasTable, evm *EVM, contract *Contract, stack *Sta
 		return 0, err
 	}
 
+	base := gt.ExtcodeCopy
+	if evm.chainRules.IsBerlin {
+		base = accessAccountGas(evm, common.BigToAddress(stack.Back(0)))
+	}
 	var overflow bool
-	if gas, overflow = math.SafeAdd(gas, gt.ExtcodeCopy); overflow {
+	if gas, overflow = math.SafeAdd(gas, base); overflow {
 		return 0, errGasUintOverflow
 	}
 
@@ -266,17 +281,50 @@ func gasCreate(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, m
 }
 
 func gasBalance(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	if evm.chainRules.IsBerlin {
+		return accessAccountGas(evm, common.BigToAddress(stack.Back(0))), nil
+	}
 	return gt.Balance, nil
 }
 
 func gasExtCodeSize(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	if evm.chainRules.IsBerlin {
+		return accessAccountGas(evm, common.BigToAddress(stack.Back(0))), nil
+	}
 	return gt.ExtcodeSize, nil
 }
 
 func gasSLoad(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	if evm.chainRules.IsBerlin {
+		slot := common.BigToHash(stack.Back(0))
+		if _, slotOk := evm.StateDB.SlotInAccessList(contract.Address(), slot); slotOk {
+			return params.WarmStorageReadCost, nil
+		}
+		evm.StateDB.AddSlotToAccessList(contract.Address(), slot)
+		return params.ColdSloadCost, nil
+	}
 	return gt.SLoad, nil
 }
 
+// accessAccountGas returns the EIP-2929 cost of accessing an account, marking
+// it as warm for the rest of the transaction.
+func accessAccountGas(evm *EVM, addr common.Address) uint64 {
+	if evm.StateDB.AddressInAccessList(addr) {
+		return params.WarmStorageReadCost
+	}
+	evm.StateDB.AddAddressToAccessList(addr)
+	return params.ColdAccountAccessCost
+}
+
+// callBaseGas returns the base cost of the CALL family of opcodes, which is the
+// account access cost of the callee after the Berlin fork.
+func callBaseGas(gt params.GasTable, evm *EVM, addr common.Address) uint64 {
+	if evm.chainRules.IsBerlin {
+		return accessAccountGas(evm, addr)
+	}
+	return gt.Calls
+}
+
 func gasExp(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
 	expByteLen := uint64((stack.data[stack.len()-2].BitLen() + 7) / 8)
 
@@ -292,10 +340,10 @@ func gasExp(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, mem
 
 func gasCall(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
 	var (
-		gas            = gt.Calls
 		transfersValue = stack.Back(2).Sign() != 0
 		address        = common.BigToAddress(stack.Back(1))
 		eip158         = evm.ChainConfig().IsEIP158(evm.BlockNumber)
+		gas            = callBaseGas(gt, evm, address)
 	)
 	if eip158 {
 		if evm.StateDB.Empty(address) && transfersValue {
@@ -335,7 +383,7 @@ func gasCall(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, mem
 }
 
 func gasCallCode(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-	gas := gt.Calls
+	gas := callBaseGas(gt, evm, common.BigToAddress(stack.Back(1)))
 	if stack.Back(2).Sign() != 0 {
 		gas += params.CallValueTransferGas
 	}
@@ -389,6 +437,14 @@ func gasSuicide(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack,
 			gas += gt.CreateBySuicide
 		}
 	}
+	// EIP-2929: a cold beneficiary is charged the account access cost
+	if evm.chainRules.IsBerlin {
+		address := common.BigToAddress(stack.Back(0))
+		if !evm.StateDB.AddressInAccessList(address) {
+			evm.StateDB.AddAddressToAccessList(address)
+			gas += params.ColdAccountAccessCost
+		}
+	}
 
 	if !evm.StateDB.HasSuicided(contract.Address()) {
 		evm.StateDB.AddRefund(new(big.Int).SetUint64(params.SuicideRefundGas))
@@ -402,7 +458,7 @@ func gasDelegateCall(gt params.GasTable, evm *EVM, contract *Contract, stack *St
 		return 0, err
 	}
 	var overflow bool
-	if gas, overflow = math.SafeAdd(gas, gt.Calls); overflow {
+	if gas, overflow = math.SafeAdd(gas, callBaseGas(gt, evm, common.BigToAddress(stack.Back(1)))); overflow {
 		return 0, errGasUintOverflow
 	}
 
@@ -14,6 +14,8 @@ func TestByteOp(t *testing.T) {
 		env   = NewEVM(Context{}, nil, params.TestChainConfig, Config{EnableJit: false, ForceJit: false})
 		stack = newstack()
 	)
+	env.interpreter.intPool = poolOfIntPools.get()
+	defer poolOfIntPools.put(env.interpreter.intPool)
 	tests := []struct {
 		v        string
 		th       uint64
@@ -47,6 +49,8 @@ func opBenchmark(bench *testing.B, op func(pc *uint64, evm *EVM, contract *Contr
 		env   = NewEVM(Context{}, nil, params.TestChainConfig, Config{EnableJit: false, ForceJit: false})
 		stack = newstack()
 	)
+	env.interpreter.intPool = poolOfIntPools.get()
+	defer poolOfIntPools.put(env.interpreter.intPool)
 	// convert args
 	byteArgs := make([][]byte, len(args))
 	for i, arg := range args {
@@ -58,6 +58,18 @@ type StateDB interface {
 	RevertToSnapshot(int)
 	Snapshot() int
 
+	// PrepareAccessList resets the access list for a new transaction, warming up
+	// the sender, the destination, the precompiles and the declared access list.
+	PrepareAccessList(sender common.Address, dst *common.Address, precompiles []common.Address, list types.AccessList)
+	// AddressInAccessList and SlotInAccessList report whether an account or a
+	// storage slot was already accessed by the current transaction (EIP-2929).
+	AddressInAccessList(addr common.Address) bool
+	SlotInAccessList(addr common.Address, slot common.Hash) (addressOk bool, slotOk bool)
+	// AddAddressToAccessList and AddSlotToAccessList mark an account or a
+	// storage slot as accessed. The changes are reverted along with snapshots.
+	AddAddressToAccessList(addr common.Address)
+	AddSlotToAccessList(addr common.Address, slot common.Hash)
+
 	AddLog(*types.Log)
 	AddPreimage(common.Hash, []byte)
 
@@ -35,7 +35,7 @@ type Config struct {
 	// ForceJit forces the JIT VM
 	ForceJit bool
 	// Tracer is the op code logger
-	Tracer Tracer
+	Tracer EVMLogger
 	// NoRecursion disabled Interpreter call, callcode,
 	// delegate call and create.
 	NoRecursion bool
@@ -45,8 +45,9 @@ type Config struct {
 	EnablePreimageRecording bool
 	// JumpTable contains the EVM instruction table. This
 	// may me left uninitialised and will be set the default
-	// table.
-	JumpTable [256]operation
+	// table. The table is shared, not copied, and must not
+	// be modified once in use.
+	JumpTable *JumpTable
 }
 
 // Interpreter is used to run Ethereum based contracts and will utilise the
@@ -64,15 +65,14 @@ type Interpreter struct {
 
 // NewInterpreter returns a new instance of the Interpreter.
 func NewInterpreter(evm *EVM, cfg Config) *Interpreter {
-	// We use the STOP instruction whether to see
-	// the jump table was initialised. If it was not
-	// we'll set the default jump table.
-	if !cfg.JumpTable[STOP].valid {
+	// If the jump table was not initialised we'll set the
+	// default one, shared by all interpreters of the phase.
+	if cfg.JumpTable == nil {
 		switch {
 		case evm.ChainConfig().IsHomestead(evm.BlockNumber):
-			cfg.JumpTable = homesteadInstructionSet
+			cfg.JumpTable = &homesteadInstructionSet
 		default:
-			cfg.JumpTable = frontierInstructionSet
+			cfg.JumpTable = &frontierInstructionSet
 		}
 	}
 
@@ -80,11 +80,10 @@ func NewInterpreter(evm *EVM, cfg Config) *Interpreter {
 		evm:      evm,
 		cfg:      cfg,
 		gasTable: evm.ChainConfig().GasTable(evm.BlockNumber),
-		intPool:  newIntPool(),
 	}
 }
 
-func (in *Interpreter) enforceRestrictions(op OpCode, operation operation, stack *Stack) error {
+func (in *Interpreter) enforceRestrictions(op OpCode, operation *operation, stack *Stack) error {
 	return nil
 }
 
@@ -95,6 +94,15 @@ func (in *Interpreter) enforceRestrictions(op OpCode, operation operation, stack
 // considered a revert-and-consume-all-gas operation. No error specific checks
 // should be handled to reduce complexity and errors further down the in.
 func (in *Interpreter) Run(snapshot int, contract *Contract, input []byte) (ret []byte, err error) {
+	// The integer pool is borrowed for the outermost call and shared with the
+	// nested ones, returning it afterwards so the next transaction can reuse it.
+	if in.intPool == nil {
+		in.intPool = poolOfIntPools.get()
+		defer func() {
+			poolOfIntPools.put(in.intPool)
+			in.intPool = nil
+		}()
+	}
 	in.evm.depth++
 	defer func() { in.evm.depth-- }()
 
@@ -110,7 +118,7 @@ func (in *Interpreter) Run(snapshot int, contract *Contract, input []byte) (ret
 
 	var (
 		op    OpCode        // current opcode
-		mem   = NewMemory() // bound memory
+		mem   = newMemory() // bound memory
 		stack = newstack()  // local stack
 		// For optimisation reason we're using uint64 as the program counter.
 		// It's theoretically possible to go above 2^64. The YP defines the PC
@@ -120,9 +128,16 @@ func (in *Interpreter) Run(snapshot int, contract *Contract, input []byte) (ret
 	)
 	contract.Input = input
 
+	// Recycle the memory, the stack and whatever integers are left on it once
+	// the execution (and any fault capture below) is done.
+	defer func() {
+		in.intPool.put(stack.data...)
+		returnStack(stack)
+		returnMemory(mem)
+	}()
 	defer func() {
 		if err != nil && in.cfg.Debug {
-			in.cfg.Tracer.CaptureState(in.evm, pc, op, contract.Gas, cost, mem, stack, contract, in.evm.depth, err)
+			in.cfg.Tracer.CaptureFault(in.evm, pc, op, contract.Gas, cost, mem, stack, contract, in.evm.depth, err)
 		}
 	}()
 
@@ -135,7 +150,7 @@ func (in *Interpreter) Run(snapshot int, contract *Contract, input []byte) (ret
 		op = contract.GetOp(pc)
 
 		// get the operation from the jump table matching the opcode
-		operation := in.cfg.JumpTable[op]
+		operation := &in.cfg.JumpTable[op]
 		if err := in.enforceRestrictions(op, operation, stack); err != nil {
 			return nil, err
 		}
@@ -16,7 +16,10 @@
 
 package vm
 
-import "math/big"
+import (
+	"math/big"
+	"sync"
+)
 
 var checkVal = big.NewInt(-42)
 
@@ -38,12 +41,20 @@ func (p *intPool) get() *big.Int {
 	}
 	return new(big.Int)
 }
-func (p *intPool) put(is ...*big.Int) {
-	if len(p.pool.data) > poolLimit {
-		return
+
+// getZero retrieves a big int from the pool, set to zero.
+func (p *intPool) getZero() *big.Int {
+	if p.pool.len() > 0 {
+		return p.pool.pop().SetUint64(0)
 	}
+	return new(big.Int)
+}
 
+func (p *intPool) put(is ...*big.Int) {
 	for _, i := range is {
+		if len(p.pool.data) > poolLimit {
+			return
+		}
 		// verifyPool is a build flag. Pool verification makes sure the integrity
 		// of the integer pool by comparing values to a default value.
 		if verifyPool {
@@ -53,3 +64,39 @@ func (p *intPool) put(is ...*big.Int) {
 		p.pool.push(i)
 	}
 }
+
+// intPoolPool is a pool of integer pools, shared by all interpreters so the
+// integers allocated by one execution are recycled by the following ones.
+type intPoolPool struct {
+	pools []*intPool
+	lock  sync.Mutex
+}
+
+const poolDefaultCap = 25
+
+var poolOfIntPools = &intPoolPool{
+	pools: make([]*intPool, 0, poolDefaultCap),
+}
+
+// get retrieves an integer pool, allocating a new one if none is available.
+func (ipp *intPoolPool) get() *intPool {
+	ipp.lock.Lock()
+	defer ipp.lock.Unlock()
+
+	if len(ipp.pools) > 0 {
+		ip := ipp.pools[len(ipp.pools)-1]
+		ipp.pools = ipp.pools[:len(ipp.pools)-1]
+		return ip
+	}
+	return newIntPool()
+}
+
+// put returns an integer pool for reuse, dropping it if enough are kept around.
+func (ipp *intPoolPool) put(ip *intPool) {
+	ipp.lock.Lock()
+	defer ipp.lock.Unlock()
+
+	if len(ipp.pools) < cap(ipp.pools) {
+		ipp.pools = append(ipp.pools, ip)
+	}
+}
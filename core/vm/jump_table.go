@@ -55,6 +55,9 @@ type operation struct {
 	reverts bool
 }
 
+// JumpTable contains the EVM instructions mapped by opcode.
+type JumpTable [256]operation
+
 var (
 	frontierInstructionSet  = NewFrontierInstructionSet()
 	homesteadInstructionSet = NewHomesteadInstructionSet()
@@ -62,7 +65,7 @@ var (
 
 // NewHomesteadInstructionSet returns the frontier and homestead
 // instructions that can be executed during the homestead phase.
-func NewHomesteadInstructionSet() [256]operation {
+func NewHomesteadInstructionSet() JumpTable {
 	instructionSet := NewFrontierInstructionSet()
 	instructionSet[DELEGATECALL] = operation{
 		execute:       opDelegateCall,
@@ -76,8 +79,8 @@ func NewHomesteadInstructionSet() [256]operation {
 
 // NewFrontierInstructionSet returns the frontier instructions
 // that can be executed during the frontier phase.
-func NewFrontierInstructionSet() [256]operation {
-	return [256]operation{
+func NewFrontierInstructionSet() JumpTable {
+	return JumpTable{
 		STOP: {
 			execute:       opStop,
 			gasCost:       constGasFunc(0),
@@ -79,16 +79,36 @@ func (s *StructLog) OpName() string {
 	return s.Op.String()
 }
 
-// Tracer is used to collect execution traces from an EVM transaction
-// execution. CaptureState is called for each step of the VM with the
-// current VM state.
+// EVMLogger is used to collect execution traces from an EVM transaction
+// execution. It is the API through which code embedding the EVM observes the
+// execution, it's installed through Config.Tracer and only invoked if
+// Config.Debug is set.
+//
+// For every top level call or contract creation the hooks are invoked as:
+//
+//	CaptureStart                  once, before the outermost call frame runs
+//	CaptureState                  before every operation executed by the VM
+//	CaptureFault                  instead of CaptureState when an operation fails
+//	CaptureEnter / CaptureExit    around every nested call frame, self destructs included
+//	CaptureEnd                    once, after the outermost call frame returned
+//
 // Note that reference types are actual VM data structures; make copies
-// if you need to retain them beyond the current call.
-type Tracer interface {
+// if you need to retain them beyond the current call. Errors returned by the
+// hooks don't affect the execution.
+type EVMLogger interface {
+	CaptureStart(env *EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error
 	CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error
-	CaptureEnd(output []byte, gasUsed uint64, t time.Duration) error
+	CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error
+	CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error
+	CaptureExit(output []byte, gasUsed uint64, err error) error
+	CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error
 }
 
+// Tracer is the former name of EVMLogger.
+//
+// Deprecated: use EVMLogger.
+type Tracer = EVMLogger
+
 // StructLogger is an EVM state logger and implements Tracer.
 //
 // StructLogger can capture state based on the given Log configuration and also keeps
@@ -183,8 +203,28 @@ func (l *StructLogger) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost ui
 	return nil
 }
 
-func (l *StructLogger) CaptureEnd(output []byte, gasUsed uint64, t time.Duration) error {
-	fmt.Printf("0x%x", output)
+// CaptureStart implements the EVMLogger interface, the struct logger only records steps.
+func (l *StructLogger) CaptureStart(env *EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureFault logs the failed step the same way as CaptureState does.
+func (l *StructLogger) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return l.CaptureState(env, pc, op, gas, cost, memory, stack, contract, depth, err)
+}
+
+// CaptureEnter implements the EVMLogger interface, the struct logger only records steps.
+func (l *StructLogger) CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureExit implements the EVMLogger interface, the struct logger only records steps.
+func (l *StructLogger) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	return nil
+}
+
+// CaptureEnd implements the EVMLogger interface, the struct logger only records steps.
+func (l *StructLogger) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
 	return nil
 }
 
@@ -17,7 +17,10 @@
 package vm
 
 import (
+	"bytes"
+	"encoding/json"
 	"math/big"
+	"strings"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -92,3 +95,37 @@ func TestStorageCapture(t *testing.T) {
 		t.Error("expected for each to be called")
 	}
 }
+
+func TestJSONLoggerCapture(t *testing.T) {
+	var (
+		out      = new(bytes.Buffer)
+		env      = NewEVM(Context{}, nil, params.TestChainConfig, Config{})
+		logger   = NewJSONLogger(&LogConfig{DisableMemory: true}, out)
+		mem      = NewMemory()
+		stack    = newstack()
+		contract = NewContract(&dummyContractRef{}, &dummyContractRef{}, new(big.Int), 0)
+	)
+	mem.Resize(32)
+	stack.push(big.NewInt(1))
+
+	logger.CaptureState(env, 0, PUSH1, 10, 3, mem, stack, contract, 1, nil)
+	logger.CaptureEnd([]byte{0x01}, 3, 0, nil)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("line count mismatch: have %d, want %d", len(lines), 2)
+	}
+	var step map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &step); err != nil {
+		t.Fatalf("failed to decode step: %v", err)
+	}
+	if step["memory"] != "0x" {
+		t.Errorf("memory captured despite being disabled: %v", step["memory"])
+	}
+	if stack, ok := step["stack"].([]interface{}); !ok || len(stack) != 1 {
+		t.Errorf("stack mismatch: have %v, want 1 item", step["stack"])
+	}
+	if !strings.Contains(lines[1], `"output":"01"`) {
+		t.Errorf("unexpected end record: %s", lines[1])
+	}
+}
@@ -16,7 +16,10 @@
 
 package vm
 
-import "fmt"
+import (
+	"fmt"
+	"sync"
+)
 
 // Memory implements a simple memory model for the ethereum virtual machine.
 type Memory struct {
@@ -29,6 +32,35 @@ func NewMemory() *Memory {
 	return &Memory{}
 }
 
+// maxPooledMemory is the largest memory capacity kept around for reuse, so
+// a single memory hungry execution doesn't pin its allocation forever.
+const maxPooledMemory = 1024 * 1024
+
+// memoryPool recycles the memories of finished executions.
+var memoryPool = sync.Pool{
+	New: func() interface{} {
+		return NewMemory()
+	},
+}
+
+// newMemory retrieves an empty memory from the pool.
+func newMemory() *Memory {
+	return memoryPool.Get().(*Memory)
+}
+
+// returnMemory empties the memory and puts it back into the pool. Neither the
+// memory nor slices previously obtained through GetPtr or Data may be used
+// afterwards.
+func returnMemory(m *Memory) {
+	if cap(m.store) > maxPooledMemory {
+		return
+	}
+	m.store = m.store[:0]
+	m.lastGasCost = 0
+	m.lastReturn = nil
+	memoryPool.Put(m)
+}
+
 // Set sets offset + size to value
 func (m *Memory) Set(offset, size uint64, value []byte) {
 	// length of store may never be less than offset + size.
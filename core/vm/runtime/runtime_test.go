@@ -18,8 +18,10 @@ package runtime
 
 import (
 	"math/big"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
@@ -117,6 +119,86 @@ func TestCall(t *testing.T) {
 	}
 }
 
+// Tests that the data returned by an execution is not clobbered when its memory
+// is recycled for a subsequent one.
+func TestReturnSurvivesMemoryReuse(t *testing.T) {
+	ret, _, err := Execute([]byte{
+		byte(vm.PUSH1), 10,
+		byte(vm.PUSH1), 0,
+		byte(vm.MSTORE),
+		byte(vm.PUSH1), 32,
+		byte(vm.PUSH1), 0,
+		byte(vm.RETURN),
+	}, nil, nil)
+	if err != nil {
+		t.Fatal("didn't expect error", err)
+	}
+	for i := 0; i < 16; i++ {
+		if _, _, err := Execute([]byte{
+			byte(vm.PUSH1), 0xff,
+			byte(vm.PUSH1), 0,
+			byte(vm.MSTORE),
+		}, nil, nil); err != nil {
+			t.Fatal("didn't expect error", err)
+		}
+	}
+	num := new(big.Int).SetBytes(ret)
+	if num.Cmp(big.NewInt(10)) != 0 {
+		t.Error("Expected 10, got", num)
+	}
+}
+
+// Tests that the access list tracer accumulates the touched accounts and slots,
+// leaving out the always warm sender, recipient and precompiles.
+func TestAccessListTracer(t *testing.T) {
+	var (
+		contract = common.StringToAddress("contract")
+		origin   = common.StringToAddress("origin")
+		other    = common.HexToAddress("0x00000000000000000000000000000000000000ff")
+	)
+	tracer := vm.NewAccessListTracer(nil, origin, contract)
+	_, _, err := Execute([]byte{
+		byte(vm.PUSH1), 1,
+		byte(vm.SLOAD),
+		byte(vm.PUSH1), 0xff,
+		byte(vm.BALANCE),
+		byte(vm.PUSH1), 0,
+		byte(vm.PUSH1), 0,
+		byte(vm.PUSH1), 0,
+		byte(vm.PUSH1), 0,
+		byte(vm.PUSH1), 0,
+		byte(vm.PUSH1), 2, // sha256 precompile
+		byte(vm.GAS),
+		byte(vm.CALL),
+	}, nil, &Config{Origin: origin, EVMConfig: vm.Config{Debug: true, Tracer: tracer}})
+	if err != nil {
+		t.Fatal("didn't expect error", err)
+	}
+	acl := tracer.AccessList()
+	if len(acl) != 2 {
+		t.Fatalf("access list length mismatch: have %d, want 2: %v", len(acl), acl)
+	}
+	for _, tuple := range acl {
+		switch tuple.Address {
+		case contract:
+			if want := []common.Hash{common.BigToHash(big.NewInt(1))}; !reflect.DeepEqual(tuple.StorageKeys, want) {
+				t.Errorf("storage keys mismatch: have %v, want %v", tuple.StorageKeys, want)
+			}
+		case other:
+			if len(tuple.StorageKeys) != 0 {
+				t.Errorf("unexpected storage keys for %x: %v", other, tuple.StorageKeys)
+			}
+		default:
+			t.Errorf("unexpected address in access list: %x", tuple.Address)
+		}
+	}
+	// A tracer seeded with the result accumulates the same list
+	seeded := vm.NewAccessListTracer(acl, origin, contract)
+	if !seeded.Equal(tracer) {
+		t.Errorf("seeded tracer mismatch: have %v, want %v", seeded.AccessList(), acl)
+	}
+}
+
 func BenchmarkCall(b *testing.B) {
 	var definition = `[{"constant":true,"inputs":[],"name":"seller","outputs":[{"name":"","type":"address"}],"type":"function"},{"constant":false,"inputs":[],"name":"abort","outputs":[],"type":"function"},{"constant":true,"inputs":[],"name":"value","outputs":[{"name":"","type":"uint256"}],"type":"function"},{"constant":false,"inputs":[],"name":"refund","outputs":[],"type":"function"},{"constant":true,"inputs":[],"name":"buyer","outputs":[{"name":"","type":"address"}],"type":"function"},{"constant":false,"inputs":[],"name":"confirmReceived","outputs":[],"type":"function"},{"constant":true,"inputs":[],"name":"state","outputs":[{"name":"","type":"uint8"}],"type":"function"},{"constant":false,"inputs":[],"name":"confirmPurchase","outputs":[],"type":"function"},{"inputs":[],"type":"constructor"},{"anonymous":false,"inputs":[],"name":"Aborted","type":"event"},{"anonymous":false,"inputs":[],"name":"PurchaseConfirmed","type":"event"},{"anonymous":false,"inputs":[],"name":"ItemReceived","type":"event"},{"anonymous":false,"inputs":[],"name":"Refunded","type":"event"}]`
 
@@ -149,3 +231,51 @@ func BenchmarkCall(b *testing.B) {
 		}
 	}
 }
+
+// hookRecorder is an EVMLogger recording the sequence of hooks invoked.
+type hookRecorder struct {
+	hooks []string
+}
+
+func (r *hookRecorder) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	r.hooks = append(r.hooks, "start")
+	return nil
+}
+
+func (r *hookRecorder) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	r.hooks = append(r.hooks, "state "+op.String())
+	return nil
+}
+
+func (r *hookRecorder) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	r.hooks = append(r.hooks, "fault "+op.String())
+	return nil
+}
+
+func (r *hookRecorder) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	r.hooks = append(r.hooks, "enter "+typ.String())
+	return nil
+}
+
+func (r *hookRecorder) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	r.hooks = append(r.hooks, "exit")
+	return nil
+}
+
+func (r *hookRecorder) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
+	r.hooks = append(r.hooks, "end")
+	return nil
+}
+
+func TestEVMLoggerHooks(t *testing.T) {
+	recorder := new(hookRecorder)
+	cfg := &Config{EVMConfig: vm.Config{Debug: true, Tracer: recorder}}
+
+	// PUSH1 0, POP, POP: the second POP underflows the stack
+	Execute([]byte{byte(vm.PUSH1), 0x00, byte(vm.POP), byte(vm.POP)}, nil, cfg)
+
+	want := []string{"start", "state PUSH1", "state POP", "fault POP", "end"}
+	if !reflect.DeepEqual(recorder.hooks, want) {
+		t.Errorf("hook sequence mismatch: have %v, want %v", recorder.hooks, want)
+	}
+}
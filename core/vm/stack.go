@@ -19,6 +19,7 @@ package vm
 import (
 	"fmt"
 	"math/big"
+	"sync"
 )
 
 // stack is an object for basic stack operations. Items popped to the stack are
@@ -28,8 +29,23 @@ type Stack struct {
 	data []*big.Int
 }
 
+// stackPool recycles the stacks of finished executions, sparing every call
+// frame the allocation of a full sized backing slice.
+var stackPool = sync.Pool{
+	New: func() interface{} {
+		return &Stack{data: make([]*big.Int, 0, 1024)}
+	},
+}
+
 func newstack() *Stack {
-	return &Stack{data: make([]*big.Int, 0, 1024)}
+	return stackPool.Get().(*Stack)
+}
+
+// returnStack empties the stack and puts it back into the pool. The stack
+// must not be used afterwards.
+func returnStack(st *Stack) {
+	st.data = st.data[:0]
+	stackPool.Put(st)
 }
 
 func (st *Stack) Data() []*big.Int {
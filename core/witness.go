@@ -0,0 +1,185 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// errIncompleteWitness is returned if a block executed against a witness tries
+// to access state not contained within.
+var errIncompleteWitness = errors.New("incomplete witness")
+
+// Witness is a stateless execution witness of a block, containing all the data
+// needed to execute it without access to the chain database.
+type Witness struct {
+	Headers []*types.Header // Parent header, followed by the ancestors accessed by the EVM
+	Nodes   [][]byte        // Trie nodes touched during execution, in access order
+	Codes   [][]byte        // Contract codes touched during execution, in access order
+}
+
+// RecordWitness re-executes a block of the local chain on top of its parent's
+// state, recording all the data accessed into a witness.
+func (bc *BlockChain) RecordWitness(block *types.Block) (*Witness, error) {
+	parent := bc.GetHeader(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, fmt.Errorf("parent %x not found", block.ParentHash())
+	}
+	recorder := state.NewWitnessRecorder(bc.triedb)
+	statedb, err := state.New(parent.Root, recorder)
+	if err != nil {
+		return nil, err
+	}
+	chain := newWitnessChain(bc.config, bc.engine, bc, parent)
+	if _, _, _, err := applyBlock(bc.config, chain, bc.engine, block, statedb, vm.Config{}); err != nil {
+		return nil, err
+	}
+	if err := statedb.Error(); err != nil {
+		return nil, err
+	}
+	return &Witness{
+		Headers: chain.headers,
+		Nodes:   recorder.Nodes(),
+		Codes:   recorder.Codes(),
+	}, nil
+}
+
+// ExecuteWitness executes a block against the state contained in its witness
+// only, validating the resulting gas usage, receipts and state root.
+func ExecuteWitness(config *params.ChainConfig, engine consensus.Engine, block *types.Block, witness *Witness) error {
+	if len(witness.Headers) == 0 || witness.Headers[0].Hash() != block.ParentHash() {
+		return fmt.Errorf("%v: parent header missing", errIncompleteWitness)
+	}
+	parent := witness.Headers[0]
+
+	// Assemble an in-memory database out of the witness data
+	db, _ := ethdb.NewMemDatabase()
+	for _, blob := range witness.Nodes {
+		db.Put(crypto.Keccak256(blob), blob)
+	}
+	for _, code := range witness.Codes {
+		db.Put(crypto.Keccak256(code), code)
+	}
+	statedb, err := state.New(parent.Root, state.NewDatabase(db))
+	if err != nil {
+		return fmt.Errorf("%v: %v", errIncompleteWitness, err)
+	}
+	// Execute the block and validate the results
+	chain := newWitnessChain(config, engine, nil, witness.Headers...)
+	receipts, _, usedGas, err := applyBlock(config, chain, engine, block, statedb, vm.Config{})
+	if err != nil {
+		return err
+	}
+	if err := statedb.Error(); err != nil {
+		return fmt.Errorf("%v: %v", errIncompleteWitness, err)
+	}
+	validator := NewBlockValidator(config, nil, engine)
+	return validator.ValidateState(block, types.NewBlockWithHeader(parent), statedb, receipts, usedGas)
+}
+
+// witnessChain is the chain context of a block execution, serving the ancestor
+// headers from a witness. If a backing chain is set, any headers not yet in the
+// witness are retrieved from it and added.
+type witnessChain struct {
+	config *params.ChainConfig
+	engine consensus.Engine
+	chain  consensus.ChainReader // Backing chain while recording, nil when replaying
+
+	headers []*types.Header               // Headers accessed, in order
+	index   map[common.Hash]*types.Header // Headers accessed, by hash
+}
+
+// newWitnessChain creates a chain context serving the given headers.
+func newWitnessChain(config *params.ChainConfig, engine consensus.Engine, chain consensus.ChainReader, headers ...*types.Header) *witnessChain {
+	wc := &witnessChain{
+		config: config,
+		engine: engine,
+		chain:  chain,
+		index:  make(map[common.Hash]*types.Header),
+	}
+	for _, header := range headers {
+		wc.add(header)
+	}
+	return wc
+}
+
+// add records a header into the witness, unless it's nil or already present.
+func (wc *witnessChain) add(header *types.Header) *types.Header {
+	if header == nil {
+		return nil
+	}
+	hash := header.Hash()
+	if _, ok := wc.index[hash]; !ok {
+		wc.index[hash] = header
+		wc.headers = append(wc.headers, header)
+	}
+	return header
+}
+
+func (wc *witnessChain) Config() *params.ChainConfig { return wc.config }
+
+func (wc *witnessChain) Engine() consensus.Engine { return wc.engine }
+
+// CurrentHeader returns the parent of the block being executed.
+func (wc *witnessChain) CurrentHeader() *types.Header { return wc.headers[0] }
+
+func (wc *witnessChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header, ok := wc.index[hash]; ok {
+		return header
+	}
+	if wc.chain == nil {
+		return nil
+	}
+	return wc.add(wc.chain.GetHeader(hash, number))
+}
+
+func (wc *witnessChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	if header, ok := wc.index[hash]; ok {
+		return header
+	}
+	if wc.chain == nil {
+		return nil
+	}
+	return wc.add(wc.chain.GetHeaderByHash(hash))
+}
+
+func (wc *witnessChain) GetHeaderByNumber(number uint64) *types.Header {
+	if wc.chain != nil {
+		return wc.add(wc.chain.GetHeaderByNumber(number))
+	}
+	for _, header := range wc.headers {
+		if header.Number.Uint64() == number {
+			return header
+		}
+	}
+	return nil
+}
+
+// GetBlock is not supported by witnesses, as they contain no block bodies.
+func (wc *witnessChain) GetBlock(hash common.Hash, number uint64) *types.Block {
+	return nil
+}
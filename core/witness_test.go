@@ -0,0 +1,124 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that a witness recorded while executing a block contains everything
+// needed to re-execute it statelessly, and that missing data is detected.
+func TestBlockWitness(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		counter = common.Address{0xcc}
+		signer  = types.HomesteadSigner{}
+
+		// Contract incrementing slot 0 and storing blockhash(number-2) into slot 1
+		code = common.FromHex("0x600054600101600055436002900340600155")
+
+		gspec = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc: GenesisAlloc{
+				address: {Balance: big.NewInt(1000000000)},
+				counter: {Code: code, Balance: new(big.Int)},
+			},
+		}
+	)
+	gendb, _ := ethdb.NewMemDatabase()
+	genesis := gspec.MustCommit(gendb)
+
+	// Generate a few blocks with plain transfers to have some ancestors (chain
+	// generation doesn't support BLOCKHASH, so the contract isn't called here)
+	blocks, _ := GenerateChain(gspec.Config, genesis, gendb, 3, func(i int, block *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0xaa}, big.NewInt(1), big.NewInt(21000), new(big.Int), nil), signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block.AddTx(tx)
+	})
+	db, _ := ethdb.NewMemDatabase()
+	gspec.MustCommit(db)
+	engine := ethash.NewFaker()
+	chain, _ := NewBlockChain(db, gspec.Config, engine, new(event.TypeMux), vm.Config{})
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	// Assemble a block calling into the contract on top of the chain
+	parent := chain.CurrentBlock()
+	statedb, _ := chain.State()
+	header := makeHeader(gspec.Config, parent, statedb)
+
+	tx, err := types.SignTx(types.NewTransaction(statedb.GetNonce(address), counter, new(big.Int), big.NewInt(100000), new(big.Int), nil), signer, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statedb.Prepare(tx.Hash(), common.Hash{}, 0)
+	receipt, _, err := ApplyTransaction(gspec.Config, chain, nil, new(GasPool).AddGas(header.GasLimit), statedb, header, tx, header.GasUsed, vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to apply transaction: %v", err)
+	}
+	block, _ := engine.Finalize(chain, header, statedb, types.Transactions{tx}, nil, types.Receipts{receipt})
+	if _, err := chain.InsertChain(types.Blocks{block}); err != nil {
+		t.Fatalf("failed to insert contract call block: %v", err)
+	}
+	// Record a witness and ensure it's enough to execute the block
+	witness, err := chain.RecordWitness(block)
+	if err != nil {
+		t.Fatalf("failed to record witness: %v", err)
+	}
+	if len(witness.Headers) != 2 {
+		t.Errorf("witness header count mismatch: have %d, want %d", len(witness.Headers), 2)
+	}
+	if len(witness.Codes) != 1 {
+		t.Errorf("witness code count mismatch: have %d, want %d", len(witness.Codes), 1)
+	}
+	if err := ExecuteWitness(gspec.Config, engine, block, witness); err != nil {
+		t.Fatalf("failed to execute witness: %v", err)
+	}
+	// Drop each trie node in turn and ensure execution fails
+	for i := range witness.Nodes {
+		partial := *witness
+		partial.Nodes = append(append([][]byte{}, witness.Nodes[:i]...), witness.Nodes[i+1:]...)
+
+		if err := ExecuteWitness(gspec.Config, engine, block, &partial); err == nil {
+			t.Errorf("node %d: execution succeeded without node", i)
+		}
+	}
+	// Drop the contract code and the ancestor header, ensure execution fails
+	partial := *witness
+	partial.Codes = nil
+	if err := ExecuteWitness(gspec.Config, engine, block, &partial); err == nil {
+		t.Errorf("execution succeeded without contract code")
+	}
+	partial = *witness
+	partial.Headers = witness.Headers[:1]
+	if err := ExecuteWitness(gspec.Config, engine, block, &partial); err == nil {
+		t.Errorf("execution succeeded without ancestor header")
+	}
+}
@@ -17,9 +17,12 @@
 package eth
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -30,11 +33,13 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/misc"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/light"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/miner"
 	"github.com/ethereum/go-ethereum/params"
@@ -43,7 +48,16 @@ import (
 	"github.com/ethereum/go-ethereum/trie"
 )
 
-const defaultTraceTimeout = 5 * time.Second
+const (
+	// defaultTraceTimeout is the amount of time a single transaction can execute
+	// by default before being forcefully aborted.
+	defaultTraceTimeout = 5 * time.Second
+
+	// defaultTraceReexec is the number of blocks the tracer is willing to go back
+	// and re-execute to produce missing historical state necessary to run a
+	// specific trace.
+	defaultTraceReexec = uint64(128)
+)
 
 // PublicEthereumAPI provides an API to access Ethereum full node-related
 // information.
@@ -80,7 +94,7 @@ type PublicMinerAPI struct {
 
 // NewPublicMinerAPI create a new PublicMinerAPI instance.
 func NewPublicMinerAPI(e *Ethereum) *PublicMinerAPI {
-	agent := miner.NewRemoteAgent(e.BlockChain(), e.Engine())
+	agent := miner.NewRemoteAgent(e.BlockChain(), e.Engine(), e.minerNotify)
 	e.Miner().Register(agent)
 
 	return &PublicMinerAPI{e, agent}
@@ -194,6 +208,12 @@ func (api *PrivateMinerAPI) SetGasPrice(gasPrice hexutil.Big) bool {
 	return true
 }
 
+// SetRecommitInterval updates the interval for miner sealing work recommitting,
+// given in milliseconds.
+func (api *PrivateMinerAPI) SetRecommitInterval(interval int) {
+	api.e.Miner().SetRecommitInterval(time.Duration(interval) * time.Millisecond)
+}
+
 // SetEtherbase sets the etherbase of the miner
 func (api *PrivateMinerAPI) SetEtherbase(etherbase common.Address) bool {
 	api.e.SetEtherbase(etherbase)
@@ -298,6 +318,18 @@ func (api *PrivateAdminAPI) ImportChain(file string) (bool, error) {
 	return true, nil
 }
 
+// BeaconSync retrieves the chain backwards from a trusted head header, linking
+// it up with the local chain independently of the peers' total difficulties.
+func (api *PrivateAdminAPI) BeaconSync(header *types.Header) (bool, error) {
+	if header == nil || header.Number == nil {
+		return false, errors.New("missing head header")
+	}
+	if err := api.eth.protocolManager.downloader.BeaconSync(header); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // PublicDebugAPI is the collection of Etheruem full node APIs exposed
 // over the public debugging endpoint.
 type PublicDebugAPI struct {
@@ -312,12 +344,41 @@ func NewPublicDebugAPI(eth *Ethereum) *PublicDebugAPI {
 
 // DumpBlock retrieves the entire state of the database at a given block.
 func (api *PublicDebugAPI) DumpBlock(blockNr rpc.BlockNumber) (state.Dump, error) {
+	stateDb, err := api.stateAt(blockNr)
+	if err != nil {
+		return state.Dump{}, err
+	}
+	return stateDb.RawDump(), nil
+}
+
+// AccountRangeMaxResults is the maximum number of accounts returned by a single
+// AccountRange call.
+const AccountRangeMaxResults = 256
+
+// AccountRange retrieves a page of the state at a given block, starting at the
+// given hashed account key. The returned dump contains the key to continue from
+// if more accounts remain. The account storage is only included if excludeStorage
+// is explicitly unset, since a single contract may hold an unbounded number of
+// slots.
+func (api *PublicDebugAPI) AccountRange(blockNr rpc.BlockNumber, start hexutil.Bytes, maxResults int, excludeStorage *bool) (state.IteratorDump, error) {
+	stateDb, err := api.stateAt(blockNr)
+	if err != nil {
+		return state.IteratorDump{}, err
+	}
+	if maxResults <= 0 || maxResults > AccountRangeMaxResults {
+		maxResults = AccountRangeMaxResults
+	}
+	return stateDb.IteratorDump(start, maxResults, excludeStorage == nil || *excludeStorage)
+}
+
+// stateAt retrieves the state of the database at a given block.
+func (api *PublicDebugAPI) stateAt(blockNr rpc.BlockNumber) (*state.StateDB, error) {
 	if blockNr == rpc.PendingBlockNumber {
 		// If we're dumping the pending state, we need to request
 		// both the pending block as well as the pending state from
 		// the miner and operate on those
 		_, stateDb := api.eth.miner.Pending()
-		return stateDb.RawDump(), nil
+		return stateDb, nil
 	}
 	var block *types.Block
 	if blockNr == rpc.LatestBlockNumber {
@@ -326,13 +387,9 @@ func (api *PublicDebugAPI) DumpBlock(blockNr rpc.BlockNumber) (state.Dump, error
 		block = api.eth.blockchain.GetBlockByNumber(uint64(blockNr))
 	}
 	if block == nil {
-		return state.Dump{}, fmt.Errorf("block #%d not found", blockNr)
-	}
-	stateDb, err := api.eth.BlockChain().StateAt(block.Root())
-	if err != nil {
-		return state.Dump{}, err
+		return nil, fmt.Errorf("block #%d not found", blockNr)
 	}
-	return stateDb.RawDump(), nil
+	return api.eth.BlockChain().StateAt(block.Root())
 }
 
 // PrivateDebugAPI is the collection of Etheruem full node APIs exposed over
@@ -348,50 +405,52 @@ func NewPrivateDebugAPI(config *params.ChainConfig, eth *Ethereum) *PrivateDebug
 	return &PrivateDebugAPI{config: config, eth: eth}
 }
 
-// BlockTraceResult is the returned value when replaying a block to check for
-// consensus results and full VM trace logs for all included transactions.
-type BlockTraceResult struct {
-	Validated  bool                  `json:"validated"`
-	StructLogs []ethapi.StructLogRes `json:"structLogs"`
-	Error      string                `json:"error"`
-}
-
 // TraceArgs holds extra parameters to trace functions
 type TraceArgs struct {
 	*vm.LogConfig
 	Tracer  *string
 	Timeout *string
+	Reexec  *uint64      // Number of blocks to re-execute to regenerate missing state
+	GasCap  *hexutil.Big // Gas cap of traced calls, overriding the node wide one (0 = no cap)
+}
+
+// StdTraceConfig holds extra parameters to standard-json trace functions.
+type StdTraceConfig struct {
+	*vm.LogConfig
+	Reexec *uint64     // Number of blocks to re-execute to regenerate missing state
+	TxHash common.Hash // Only trace this transaction of the block, if set
+}
+
+// txTraceResult is the result of tracing a single transaction of a block. The
+// trace is marshalled as soon as the transaction was executed, so the tracer's
+// data is only ever held in memory for a single transaction.
+type txTraceResult struct {
+	Result json.RawMessage `json:"result,omitempty"` // Trace results produced by the tracer
+	Error  string          `json:"error,omitempty"`  // Trace failure produced by the tracer
 }
 
 // TraceBlock processes the given block'api RLP but does not import the block in to
-// the chain.
-func (api *PrivateDebugAPI) TraceBlock(blockRlp []byte, config *vm.LogConfig) BlockTraceResult {
+// the chain, returning the traces of all its transactions.
+func (api *PrivateDebugAPI) TraceBlock(ctx context.Context, blockRlp []byte, config *TraceArgs) ([]*txTraceResult, error) {
 	var block types.Block
-	err := rlp.Decode(bytes.NewReader(blockRlp), &block)
-	if err != nil {
-		return BlockTraceResult{Error: fmt.Sprintf("could not decode block: %v", err)}
-	}
-
-	validated, logs, err := api.traceBlock(&block, config)
-	return BlockTraceResult{
-		Validated:  validated,
-		StructLogs: ethapi.FormatLogs(logs),
-		Error:      formatError(err),
+	if err := rlp.Decode(bytes.NewReader(blockRlp), &block); err != nil {
+		return nil, fmt.Errorf("could not decode block: %v", err)
 	}
+	return api.traceBlock(ctx, &block, config)
 }
 
 // TraceBlockFromFile loads the block'api RLP from the given file name and attempts to
 // process it but does not import the block in to the chain.
-func (api *PrivateDebugAPI) TraceBlockFromFile(file string, config *vm.LogConfig) BlockTraceResult {
+func (api *PrivateDebugAPI) TraceBlockFromFile(ctx context.Context, file string, config *TraceArgs) ([]*txTraceResult, error) {
 	blockRlp, err := ioutil.ReadFile(file)
 	if err != nil {
-		return BlockTraceResult{Error: fmt.Sprintf("could not read file: %v", err)}
+		return nil, fmt.Errorf("could not read file: %v", err)
 	}
-	return api.TraceBlock(blockRlp, config)
+	return api.TraceBlock(ctx, blockRlp, config)
 }
 
 // TraceBlockByNumber processes the block by canonical block number.
-func (api *PrivateDebugAPI) TraceBlockByNumber(blockNr rpc.BlockNumber, config *vm.LogConfig) BlockTraceResult {
+func (api *PrivateDebugAPI) TraceBlockByNumber(ctx context.Context, blockNr rpc.BlockNumber, config *TraceArgs) ([]*txTraceResult, error) {
 	// Fetch the block that we aim to reprocess
 	var block *types.Block
 	switch blockNr {
@@ -405,64 +464,218 @@ func (api *PrivateDebugAPI) TraceBlockByNumber(blockNr rpc.BlockNumber, config *
 	}
 
 	if block == nil {
-		return BlockTraceResult{Error: fmt.Sprintf("block #%d not found", blockNr)}
-	}
-
-	validated, logs, err := api.traceBlock(block, config)
-	return BlockTraceResult{
-		Validated:  validated,
-		StructLogs: ethapi.FormatLogs(logs),
-		Error:      formatError(err),
+		return nil, fmt.Errorf("block #%d not found", blockNr)
 	}
+	return api.traceBlock(ctx, block, config)
 }
 
 // TraceBlockByHash processes the block by hash.
-func (api *PrivateDebugAPI) TraceBlockByHash(hash common.Hash, config *vm.LogConfig) BlockTraceResult {
+func (api *PrivateDebugAPI) TraceBlockByHash(ctx context.Context, hash common.Hash, config *TraceArgs) ([]*txTraceResult, error) {
 	// Fetch the block that we aim to reprocess
 	block := api.eth.BlockChain().GetBlockByHash(hash)
 	if block == nil {
-		return BlockTraceResult{Error: fmt.Sprintf("block #%x not found", hash)}
+		return nil, fmt.Errorf("block #%x not found", hash)
 	}
+	return api.traceBlock(ctx, block, config)
+}
 
-	validated, logs, err := api.traceBlock(block, config)
-	return BlockTraceResult{
-		Validated:  validated,
-		StructLogs: ethapi.FormatLogs(logs),
-		Error:      formatError(err),
+// traceBlock re-executes all the transactions of the given block on top of the
+// state of its parent, tracing each of them with the requested tracer. The state
+// is not saved.
+func (api *PrivateDebugAPI) traceBlock(ctx context.Context, block *types.Block, config *TraceArgs) ([]*txTraceResult, error) {
+	if block.NumberU64() == 0 {
+		return nil, errors.New("genesis is not traceable")
 	}
-}
+	blockchain := api.eth.BlockChain()
 
-// traceBlock processes the given block but does not save the state.
-func (api *PrivateDebugAPI) traceBlock(block *types.Block, logConfig *vm.LogConfig) (bool, []vm.StructLog, error) {
-	// Validate and reprocess the block
+	parent := blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, fmt.Errorf("parent %x not found", block.ParentHash())
+	}
+	reexec := defaultTraceReexec
+	if config != nil && config.Reexec != nil {
+		reexec = *config.Reexec
+	}
+	statedb, err := api.computeStateDB(parent, reexec)
+	if err != nil {
+		return nil, err
+	}
+	// Mutate the state according to any hard-fork specs, as block processing does
+	if api.config.DAOForkSupport && api.config.DAOForkBlock != nil && api.config.DAOForkBlock.Cmp(block.Number()) == 0 {
+		misc.ApplyDAOHardFork(statedb)
+	}
 	var (
-		blockchain = api.eth.BlockChain()
-		validator  = blockchain.Validator()
-		processor  = blockchain.Processor()
+		signer  = types.MakeSigner(api.config, block.Number())
+		results = make([]*txTraceResult, len(block.Transactions()))
 	)
+	for i, tx := range block.Transactions() {
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			return nil, fmt.Errorf("tx %x: %v", tx.Hash(), err)
+		}
+		context := core.NewEVMContext(msg, block.Header(), blockchain, nil)
+		statedb.Prepare(tx.Hash(), block.Hash(), i)
 
-	structLogger := vm.NewStructLogger(logConfig)
+		res, err := api.traceTx(ctx, msg, context, statedb, config)
+		if err != nil {
+			results[i] = &txTraceResult{Error: err.Error()}
+			continue
+		}
+		// Marshal the trace right away, dropping the tracer's own data
+		blob, err := json.Marshal(res)
+		if err != nil {
+			results[i] = &txTraceResult{Error: err.Error()}
+			continue
+		}
+		results[i] = &txTraceResult{Result: blob}
 
-	config := vm.Config{
-		Debug:  true,
-		Tracer: structLogger,
+		// Update the state with pending changes, as block processing does
+		if api.config.IsMetropolis(block.Number()) {
+			statedb.Finalise()
+		} else {
+			statedb.IntermediateRoot(api.config.IsEIP158(block.Number()))
+		}
 	}
-	if err := api.eth.engine.VerifyHeader(blockchain, block.Header(), true); err != nil {
-		return false, structLogger.StructLogs(), err
+	return results, nil
+}
+
+// StandardTraceBlockToFile re-executes the transactions of the block with the
+// given hash, or only the one selected by the config, streaming their traces
+// into one file per transaction. The traces are the JSON encoded execution
+// steps, one per line, followed by the outcome of the transaction. The names
+// of the files, created in the system's temporary directory, are returned.
+func (api *PrivateDebugAPI) StandardTraceBlockToFile(ctx context.Context, hash common.Hash, config *StdTraceConfig) ([]string, error) {
+	block := api.eth.BlockChain().GetBlockByHash(hash)
+	if block == nil {
+		return nil, fmt.Errorf("block #%x not found", hash)
 	}
-	statedb, err := blockchain.StateAt(blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1).Root())
-	if err != nil {
-		return false, structLogger.StructLogs(), err
+	if block.NumberU64() == 0 {
+		return nil, errors.New("genesis is not traceable")
 	}
+	blockchain := api.eth.BlockChain()
 
-	receipts, _, usedGas, err := processor.Process(block, statedb, config)
+	parent := blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, fmt.Errorf("parent %x not found", block.ParentHash())
+	}
+	var (
+		logConfig *vm.LogConfig
+		txHash    common.Hash
+		reexec    = defaultTraceReexec
+	)
+	if config != nil {
+		logConfig, txHash = config.LogConfig, config.TxHash
+		if config.Reexec != nil {
+			reexec = *config.Reexec
+		}
+	}
+	statedb, err := api.computeStateDB(parent, reexec)
 	if err != nil {
-		return false, structLogger.StructLogs(), err
+		return nil, err
+	}
+	// Mutate the state according to any hard-fork specs, as block processing does
+	if api.config.DAOForkSupport && api.config.DAOForkBlock != nil && api.config.DAOForkBlock.Cmp(block.Number()) == 0 {
+		misc.ApplyDAOHardFork(statedb)
+	}
+	var (
+		signer = types.MakeSigner(api.config, block.Number())
+		dumps  []string
+	)
+	for i, tx := range block.Transactions() {
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			return dumps, fmt.Errorf("tx %x: %v", tx.Hash(), err)
+		}
+		statedb.Prepare(tx.Hash(), block.Hash(), i)
+
+		// Trace the transaction into its own file if it's selected
+		var (
+			vmConf vm.Config
+			dump   *os.File
+			writer *bufio.Writer
+		)
+		if txHash == (common.Hash{}) || txHash == tx.Hash() {
+			prefix := fmt.Sprintf("block_%#x-%d-%#x-", block.Hash().Bytes()[:4], i, tx.Hash().Bytes()[:4])
+			if dump, err = ioutil.TempFile(os.TempDir(), prefix); err != nil {
+				return dumps, err
+			}
+			dumps = append(dumps, dump.Name())
+
+			writer = bufio.NewWriter(dump)
+			vmConf = vm.Config{Debug: true, Tracer: vm.NewJSONLogger(logConfig, writer)}
+		}
+		context := core.NewEVMContext(msg, block.Header(), blockchain, nil)
+		vmenv := vm.NewEVM(context, statedb, api.config, vmConf)
+		_, _, _, err = core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas()))
+
+		if writer != nil {
+			writer.Flush()
+		}
+		if dump != nil {
+			dump.Close()
+			log.Info("Wrote standard trace", "file", dump.Name())
+		}
+		if err != nil {
+			return dumps, fmt.Errorf("tracing tx %x failed: %v", tx.Hash(), err)
+		}
+		// Update the state with pending changes, as block processing does
+		if api.config.IsMetropolis(block.Number()) {
+			statedb.Finalise()
+		} else {
+			statedb.IntermediateRoot(api.config.IsEIP158(block.Number()))
+		}
+		// Stop once the selected transaction was traced
+		if txHash == tx.Hash() {
+			break
+		}
+	}
+	if txHash != (common.Hash{}) && len(dumps) == 0 {
+		return nil, fmt.Errorf("transaction %x not found in block %x", txHash, hash)
+	}
+	return dumps, nil
+}
+
+// computeStateDB retrieves the state of the given block. If it's not available
+// any more (e.g. it was pruned), the state of the closest ancestor at most reexec
+// blocks back which still is, is loaded and the blocks in between re-executed on
+// top of it in memory. Nothing is written to the database.
+func (api *PrivateDebugAPI) computeStateDB(block *types.Block, reexec uint64) (*state.StateDB, error) {
+	blockchain := api.eth.BlockChain()
+
+	// If we have the state fully available, use that
+	statedb, err := blockchain.StateAt(block.Root())
+	if err == nil {
+		return statedb, nil
 	}
-	if err := validator.ValidateState(block, blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1), statedb, receipts, usedGas); err != nil {
-		return false, structLogger.StructLogs(), err
+	// Otherwise look for the closest ancestor with its state available
+	var (
+		origin  = block.NumberU64()
+		pending []*types.Block
+	)
+	for i := uint64(0); i < reexec && block.NumberU64() > 0; i++ {
+		pending = append(pending, block)
+		if block = blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1); block == nil {
+			break
+		}
+		if statedb, err = blockchain.StateAt(block.Root()); err == nil {
+			break
+		}
 	}
-	return true, structLogger.StructLogs(), nil
+	if block == nil || err != nil {
+		return nil, fmt.Errorf("required historical state unavailable (reexec=%d)", reexec)
+	}
+	// Regenerate the state by re-executing the blocks in between
+	for i := len(pending) - 1; i >= 0; i-- {
+		block := pending[i]
+		if _, _, _, err := blockchain.Processor().Process(block, statedb, vm.Config{}); err != nil {
+			return nil, fmt.Errorf("processing block %d failed: %v", block.NumberU64(), err)
+		}
+		if root := statedb.IntermediateRoot(api.config.IsEIP158(block.Number())); root != block.Root() {
+			return nil, fmt.Errorf("state root mismatch regenerating block %d: have %x, want %x", block.NumberU64(), root, block.Root())
+		}
+	}
+	log.Info("Regenerated historical state", "number", origin, "reexec", len(pending))
+	return statedb, nil
 }
 
 // callmsg is the message type used for call transitions.
@@ -485,84 +698,157 @@ func (m callmsg) Gas() *big.Int                         { return m.gas }
 func (m callmsg) Value() *big.Int                       { return m.value }
 func (m callmsg) Data() []byte                          { return m.data }
 
-// formatError formats a Go error into either an empty string or the data content
-// of the error itself.
-func formatError(err error) string {
-	if err == nil {
-		return ""
-	}
-	return err.Error()
-}
-
 type timeoutError struct{}
 
 func (t *timeoutError) Error() string {
 	return "Execution time exceeded"
 }
 
+// newTracer creates the tracer requested by the trace arguments, a struct logger
+// if none was. Requested tracers, either native ones selected by name or
+// JavaScript code, are stopped once the trace timeout expires or the context is
+// cancelled. The returned function releases the timeout's resources.
+func newTracer(ctx context.Context, config *TraceArgs) (vm.EVMLogger, context.CancelFunc, error) {
+	if config == nil || config.Tracer == nil {
+		var logConfig *vm.LogConfig
+		if config != nil {
+			logConfig = config.LogConfig
+		}
+		return vm.NewStructLogger(logConfig), func() {}, nil
+	}
+	timeout := defaultTraceTimeout
+	if config.Timeout != nil {
+		var err error
+		if timeout, err = time.ParseDuration(*config.Timeout); err != nil {
+			return nil, nil, err
+		}
+	}
+	tracer, err := ethapi.NewTracer(*config.Tracer)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Handle timeouts and RPC cancellations
+	deadlineCtx, cancel := context.WithTimeout(ctx, timeout)
+	go func() {
+		<-deadlineCtx.Done()
+		tracer.Stop(&timeoutError{})
+	}()
+	return tracer, cancel, nil
+}
+
+// traceResult assembles the result of a traced execution from the tracer.
+func traceResult(tracer vm.EVMLogger, ret []byte, gas *big.Int, failed bool) (interface{}, error) {
+	switch tracer := tracer.(type) {
+	case *vm.StructLogger:
+		return &ethapi.ExecutionResult{
+			Gas:         gas,
+			Failed:      failed,
+			ReturnValue: fmt.Sprintf("%x", ret),
+			StructLogs:  ethapi.FormatLogs(tracer.StructLogs()),
+		}, nil
+	case ethapi.Tracer:
+		return tracer.GetResult()
+	default:
+		panic(fmt.Sprintf("bad tracer type %T", tracer))
+	}
+}
+
 // TraceTransaction returns the structured logs created during the execution of EVM
-// and returns them as a JSON object.
+// and returns them as a JSON object. If a tracer is given, either the name of a
+// native tracer (callTracer, prestateTracer, 4byteTracer) or JavaScript code, its
+// result is returned instead.
 func (api *PrivateDebugAPI) TraceTransaction(ctx context.Context, txHash common.Hash, config *TraceArgs) (interface{}, error) {
-	var tracer vm.Tracer
-	if config != nil && config.Tracer != nil {
-		timeout := defaultTraceTimeout
+	// Retrieve the tx from the chain and the containing block
+	tx, blockHash, _, txIndex := core.GetTransaction(api.eth.ChainDb(), txHash)
+	if tx == nil {
+		return nil, fmt.Errorf("transaction %x not found", txHash)
+	}
+	reexec := defaultTraceReexec
+	if config != nil && config.Reexec != nil {
+		reexec = *config.Reexec
+	}
+	msg, context, statedb, err := api.computeTxEnv(blockHash, int(txIndex), reexec)
+	if err != nil {
+		return nil, err
+	}
+	return api.traceTx(ctx, msg, context, statedb, config)
+}
+
+// TraceCall traces the given call as if it were executed on top of the given
+// block, the same way as TraceTransaction does for transactions.
+//
+// The call is subject to the node wide gas cap and EVM timeout of eth_call,
+// which may be overridden through the trace arguments.
+func (api *PrivateDebugAPI) TraceCall(ctx context.Context, args ethapi.CallArgs, blockNr rpc.BlockNumber, config *TraceArgs) (interface{}, error) {
+	gasCap, timeout := api.eth.ApiBackend.RPCGasCap(), api.eth.ApiBackend.RPCEVMTimeout()
+	if config != nil {
+		if config.GasCap != nil {
+			gasCap = config.GasCap.ToInt()
+		}
 		if config.Timeout != nil {
 			var err error
 			if timeout, err = time.ParseDuration(*config.Timeout); err != nil {
 				return nil, err
 			}
 		}
-
-		var err error
-		if tracer, err = ethapi.NewJavascriptTracer(*config.Tracer); err != nil {
-			return nil, err
+	}
+	if gasCap != nil && gasCap.Sign() != 0 {
+		if gas := args.Gas.ToInt(); gas.Sign() == 0 || gas.Cmp(gasCap) > 0 {
+			args.Gas = hexutil.Big(*gasCap)
 		}
-
-		// Handle timeouts and RPC cancellations
-		deadlineCtx, cancel := context.WithTimeout(ctx, timeout)
-		go func() {
-			<-deadlineCtx.Done()
-			tracer.(*ethapi.JavascriptTracer).Stop(&timeoutError{})
-		}()
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
 		defer cancel()
-	} else if config == nil {
-		tracer = vm.NewStructLogger(nil)
-	} else {
-		tracer = vm.NewStructLogger(config.LogConfig)
 	}
-
-	// Retrieve the tx from the chain and the containing block
-	tx, blockHash, _, txIndex := core.GetTransaction(api.eth.ChainDb(), txHash)
-	if tx == nil {
-		return nil, fmt.Errorf("transaction %x not found", txHash)
+	statedb, header, err := api.eth.ApiBackend.StateAndHeaderByNumber(ctx, blockNr)
+	if err != nil {
+		return nil, err
+	}
+	if statedb == nil {
+		return nil, fmt.Errorf("block #%d not found", blockNr)
 	}
-	msg, context, statedb, err := api.computeTxEnv(blockHash, int(txIndex))
+	msg := args.ToMessage(api.eth.ApiBackend, header)
+	context := core.NewEVMContext(msg, header, api.eth.BlockChain(), nil)
+
+	return api.traceTx(ctx, msg, context, statedb, config)
+}
+
+// traceTx executes the given message on top of statedb with the requested tracer
+// attached and returns the trace.
+func (api *PrivateDebugAPI) traceTx(ctx context.Context, msg core.Message, context vm.Context, statedb *state.StateDB, config *TraceArgs) (interface{}, error) {
+	tracer, cancel, err := newTracer(ctx, config)
 	if err != nil {
 		return nil, err
 	}
+	defer cancel()
 
-	// Run the transaction with tracing enabled.
+	// Run the message with tracing enabled, aborting it if the context is done.
 	vmenv := vm.NewEVM(context, statedb, api.config, vm.Config{Debug: true, Tracer: tracer})
-	ret, gas, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(tx.Gas()))
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			vmenv.Cancel()
+		case <-done:
+		}
+	}()
+	ret, gas, failed, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas()))
 	if err != nil {
 		return nil, fmt.Errorf("tracing failed: %v", err)
 	}
-	switch tracer := tracer.(type) {
-	case *vm.StructLogger:
-		return &ethapi.ExecutionResult{
-			Gas:         gas,
-			ReturnValue: fmt.Sprintf("%x", ret),
-			StructLogs:  ethapi.FormatLogs(tracer.StructLogs()),
-		}, nil
-	case *ethapi.JavascriptTracer:
-		return tracer.GetResult()
-	default:
-		panic(fmt.Sprintf("bad tracer type %T", tracer))
+	if vmenv.Cancelled() {
+		return nil, fmt.Errorf("tracing aborted: %v", ctx.Err())
 	}
+	return traceResult(tracer, ret, gas, failed)
 }
 
-// computeTxEnv returns the execution environment of a certain transaction.
-func (api *PrivateDebugAPI) computeTxEnv(blockHash common.Hash, txIndex int) (core.Message, vm.Context, *state.StateDB, error) {
+// computeTxEnv returns the execution environment of a certain transaction,
+// regenerating the state of the parent block if necessary (see computeStateDB).
+func (api *PrivateDebugAPI) computeTxEnv(blockHash common.Hash, txIndex int, reexec uint64) (core.Message, vm.Context, *state.StateDB, error) {
 	// Create the parent state.
 	block := api.eth.BlockChain().GetBlockByHash(blockHash)
 	if block == nil {
@@ -572,7 +858,7 @@ func (api *PrivateDebugAPI) computeTxEnv(blockHash common.Hash, txIndex int) (co
 	if parent == nil {
 		return nil, vm.Context{}, nil, fmt.Errorf("block parent %x not found", block.ParentHash())
 	}
-	statedb, err := api.eth.BlockChain().StateAt(parent.Root())
+	statedb, err := api.computeStateDB(parent, reexec)
 	if err != nil {
 		return nil, vm.Context{}, nil, err
 	}
@@ -590,7 +876,7 @@ func (api *PrivateDebugAPI) computeTxEnv(blockHash common.Hash, txIndex int) (co
 
 		vmenv := vm.NewEVM(context, statedb, api.config, vm.Config{})
 		gp := new(core.GasPool).AddGas(tx.Gas())
-		_, _, err := core.ApplyMessage(vmenv, msg, gp)
+		_, _, _, err := core.ApplyMessage(vmenv, msg, gp)
 		if err != nil {
 			return nil, vm.Context{}, nil, fmt.Errorf("tx %x failed: %v", tx.Hash(), err)
 		}
@@ -611,6 +897,37 @@ func (api *PrivateDebugAPI) GetBadBlocks(ctx context.Context) ([]core.BadBlockAr
 	return api.eth.BlockChain().BadBlocks()
 }
 
+// PruneState deletes all the trie nodes from the database that are not part of
+// the states of the last retain canonical blocks, nor of a canonical hash trie
+// generated for light clients. It returns the number of deleted entries.
+//
+// Pruning is refused while mining or synchronising, as those write new states
+// into the database without the blockchain's knowledge.
+func (api *PrivateDebugAPI) PruneState(retain uint64) (int, error) {
+	if api.eth.IsMining() {
+		return 0, errors.New("cannot prune state while mining")
+	}
+	if api.eth.Downloader().Synchronising() {
+		return 0, errors.New("cannot prune state while synchronising")
+	}
+	nodes, _, err := api.eth.BlockChain().PruneState(retain, light.GetHelperTrieRoots(api.eth.ChainDb()))
+	return nodes, err
+}
+
+// BlockWitness re-executes a block of the local chain, returning the RLP encoded
+// witness of all the state it accessed, needed to execute it statelessly.
+func (api *PrivateDebugAPI) BlockWitness(ctx context.Context, hash common.Hash) (hexutil.Bytes, error) {
+	block := api.eth.BlockChain().GetBlockByHash(hash)
+	if block == nil {
+		return nil, fmt.Errorf("block %x not found", hash)
+	}
+	witness, err := api.eth.BlockChain().RecordWitness(block)
+	if err != nil {
+		return nil, err
+	}
+	return rlp.EncodeToBytes(witness)
+}
+
 // StorageRangeResult is the result of a debug_storageRangeAt API call.
 type StorageRangeResult struct {
 	Storage storageMap   `json:"storage"`
@@ -626,7 +943,7 @@ type storageEntry struct {
 
 // StorageRangeAt returns the storage at the given block height and transaction index.
 func (api *PrivateDebugAPI) StorageRangeAt(ctx context.Context, blockHash common.Hash, txIndex int, contractAddress common.Address, keyStart hexutil.Bytes, maxResult int) (StorageRangeResult, error) {
-	_, _, statedb, err := api.computeTxEnv(blockHash, txIndex)
+	_, _, statedb, err := api.computeTxEnv(blockHash, txIndex, defaultTraceReexec)
 	if err != nil {
 		return StorageRangeResult{}, err
 	}
@@ -18,17 +18,24 @@ package eth
 
 import (
 	"context"
+	"errors"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/filters"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
+// errFilteringUnsupported is returned if the API backend cannot be used to query
+// or stream log events.
+var errFilteringUnsupported = errors.New("log filtering not supported by backend")
+
 // ContractBackend implements bind.ContractBackend with direct calls to Ethereum
 // internals to support operating on contracts within subprotocols like eth and
 // swarm.
@@ -40,16 +47,24 @@ type ContractBackend struct {
 	eapi  *ethapi.PublicEthereumAPI        // Wrapper around the Ethereum object to access metadata
 	bcapi *ethapi.PublicBlockChainAPI      // Wrapper around the blockchain to access chain data
 	txapi *ethapi.PublicTransactionPoolAPI // Wrapper around the transaction pool to access transaction data
+
+	filters filters.Backend      // Chain access for one-off log queries, nil if unsupported
+	events  *filters.EventSystem // Event system for streaming log events, nil if unsupported
 }
 
 // NewContractBackend creates a new native contract backend using an existing
 // Etheruem object.
 func NewContractBackend(apiBackend ethapi.Backend) *ContractBackend {
-	return &ContractBackend{
+	backend := &ContractBackend{
 		eapi:  ethapi.NewPublicEthereumAPI(apiBackend),
 		bcapi: ethapi.NewPublicBlockChainAPI(apiBackend),
 		txapi: ethapi.NewPublicTransactionPoolAPI(apiBackend, new(ethapi.AddrLocker)),
 	}
+	if fb, ok := apiBackend.(filters.Backend); ok {
+		backend.filters = fb
+		backend.events = filters.NewEventSystem(fb.EventMux(), fb, false)
+	}
+	return backend
 }
 
 // CodeAt retrieves any code associated with the contract from the local API.
@@ -66,7 +81,7 @@ func (b *ContractBackend) PendingCodeAt(ctx context.Context, contract common.Add
 // call with the specified data as the input. The pending flag requests execution
 // against the pending block, not the stable head of the chain.
 func (b *ContractBackend) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNum *big.Int) ([]byte, error) {
-	out, err := b.bcapi.Call(ctx, toCallArgs(msg), toBlockNumber(blockNum))
+	out, err := b.bcapi.Call(ctx, toCallArgs(msg), toBlockNumber(blockNum), nil, nil)
 	return out, err
 }
 
@@ -74,7 +89,7 @@ func (b *ContractBackend) CallContract(ctx context.Context, msg ethereum.CallMsg
 // call with the specified data as the input. The pending flag requests execution
 // against the pending block, not the stable head of the chain.
 func (b *ContractBackend) PendingCallContract(ctx context.Context, msg ethereum.CallMsg) ([]byte, error) {
-	out, err := b.bcapi.Call(ctx, toCallArgs(msg), rpc.PendingBlockNumber)
+	out, err := b.bcapi.Call(ctx, toCallArgs(msg), rpc.PendingBlockNumber, nil, nil)
 	return out, err
 }
 
@@ -125,7 +140,7 @@ func (b *ContractBackend) SuggestGasPrice(ctx context.Context) (*big.Int, error)
 // requirement as other transactions may be added or removed by miners, but it
 // should provide a basis for setting a reasonable default.
 func (b *ContractBackend) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (*big.Int, error) {
-	out, err := b.bcapi.EstimateGas(ctx, toCallArgs(msg))
+	out, err := b.bcapi.EstimateGas(ctx, toCallArgs(msg), nil, nil)
 	return out.ToInt(), err
 }
 
@@ -136,3 +151,65 @@ func (b *ContractBackend) SendTransaction(ctx context.Context, tx *types.Transac
 	_, err := b.txapi.SendRawTransaction(ctx, raw)
 	return err
 }
+
+// FilterLogs implements bind.ContractFilterer executing a one-off log filter
+// against the local chain, blocking until all matching logs are gathered.
+func (b *ContractBackend) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	if b.filters == nil {
+		return nil, errFilteringUnsupported
+	}
+	filter := filters.New(b.filters)
+	filter.SetBeginBlock(int64(toBlockNumber(query.FromBlock)))
+	filter.SetEndBlock(int64(toBlockNumber(query.ToBlock)))
+	filter.SetAddresses(query.Addresses)
+	filter.SetTopics(query.Topics)
+
+	logs, err := filter.Find(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]types.Log, len(logs))
+	for i, log := range logs {
+		res[i] = *log
+	}
+	return res, nil
+}
+
+// SubscribeFilterLogs implements bind.ContractFilterer streaming all the logs
+// matching the query from newly imported blocks into the given channel.
+func (b *ContractBackend) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	if b.events == nil {
+		return nil, errFilteringUnsupported
+	}
+	sink := make(chan []*types.Log)
+	sub, err := b.events.SubscribeLogs(filters.FilterCriteria{
+		FromBlock: query.FromBlock,
+		ToBlock:   query.ToBlock,
+		Addresses: query.Addresses,
+		Topics:    query.Topics,
+	}, sink)
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case logs := <-sink:
+				for _, log := range logs {
+					select {
+					case ch <- *log:
+					case err := <-sub.Err():
+						return err
+					case <-quit:
+						return nil
+					}
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
@@ -22,6 +22,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"runtime"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
@@ -34,6 +35,7 @@ import (
 // DefaultConfig contains default settings for use on the Ethereum main net.
 var DefaultConfig = Config{
 	SyncMode:             downloader.FastSync,
+	PivotStale:           downloader.DefaultPivotStale,
 	EthashCacheDir:       "ethash",
 	EthashCachesInMem:    2,
 	EthashCachesOnDisk:   3,
@@ -42,12 +44,17 @@ var DefaultConfig = Config{
 	NetworkId:            1,
 	LightPeers:           20,
 	DatabaseCache:        128,
+	TrieCache:            256,
 	GasPrice:             big.NewInt(18 * params.Shannon),
+	MinerRecommit:        3 * time.Second,
+	RPCEVMTimeout:        5 * time.Second,
+	FilterTimeout:        5 * time.Minute,
 
 	TxPool: core.DefaultTxPoolConfig,
 	GPO: gasprice.Config{
 		Blocks:     10,
 		Percentile: 50,
+		MaxPrice:   gasprice.DefaultMaxPrice,
 	},
 }
 
@@ -76,21 +83,46 @@ type Config struct {
 	NetworkId uint64 // Network ID to use for selecting peers to connect to
 	SyncMode  downloader.SyncMode
 
+	// Number of blocks the fast sync pivot may fall behind the chain head
+	// before it is moved forward.
+	PivotStale uint64 `toml:",omitempty"`
+
+	// Number of recent blocks to maintain the transaction lookup index for
+	// (0 = index all blocks).
+	TxLookupLimit uint64 `toml:",omitempty"`
+
+	// Trusted block to synchronise from in checkpoint sync mode.
+	Checkpoint *downloader.Checkpoint `toml:",omitempty"`
+
+	// Whitelist of required block number -> hash values to accept from peers.
+	Whitelist map[uint64]common.Hash `toml:"-"`
+
 	// Light client options
 	LightServ  int `toml:",omitempty"` // Maximum percentage of time allowed for serving LES requests
 	LightPeers int `toml:",omitempty"` // Maximum number of LES client peers
 	MaxPeers   int `toml:"-"`          // Maximum number of global peers
 
+	// Node IDs of light clients (e.g. trusted or paying ones) to serve with priority.
+	LightPriority []string `toml:",omitempty"`
+
+	// Ultra light client options
+	ULC *ULCConfig `toml:",omitempty"`
+
 	// Database options
 	SkipBcVersionCheck bool `toml:"-"`
 	DatabaseHandles    int  `toml:"-"`
 	DatabaseCache      int
+	DatabaseFreezer    string // Directory of the ancient chain data (default = "ancient" within the chain database)
+	TrieCache          int    // Megabytes of recent state trie nodes to keep in memory (0 = unlimited)
+	NoPruning          bool   // Whether to write every state to disk instead of only keeping the recent ones (archive mode)
 
 	// Mining-related options
-	Etherbase    common.Address `toml:",omitempty"`
-	MinerThreads int            `toml:",omitempty"`
-	ExtraData    []byte         `toml:",omitempty"`
-	GasPrice     *big.Int
+	Etherbase     common.Address `toml:",omitempty"`
+	MinerThreads  int            `toml:",omitempty"`
+	MinerNotify   []string       `toml:",omitempty"` // HTTP URLs to push new work packages to
+	MinerRecommit time.Duration  // Base interval to recreate the block being mined at
+	ExtraData     []byte         `toml:",omitempty"`
+	GasPrice      *big.Int
 
 	// Ethash options
 	EthashCacheDir       string
@@ -109,6 +141,13 @@ type Config struct {
 	// Enables tracking of SHA3 preimages in the VM
 	EnablePreimageRecording bool
 
+	// RPC call execution limits
+	RPCGasCap       *big.Int      `toml:",omitempty"` // Gas cap of eth_call and eth_estimateGas (nil = no cap)
+	RPCEVMTimeout   time.Duration // Timeout of eth_call and eth_estimateGas executions (0 = no timeout)
+	FilterTimeout   time.Duration // Time after which filters not polled anymore are uninstalled
+	LogsRangeLimit  uint64        // Maximum number of blocks searched by eth_getLogs (0 = no limit)
+	LogsResultLimit int           // Maximum number of logs returned by eth_getLogs (0 = no limit)
+
 	// Miscellaneous options
 	DocRoot   string `toml:"-"`
 	PowFake   bool   `toml:"-"`
@@ -116,6 +155,13 @@ type Config struct {
 	PowShared bool   `toml:"-"`
 }
 
+// ULCConfig is the configuration of the ultra light client mode, in which new
+// heads are only accepted if enough of the trusted servers announced them.
+type ULCConfig struct {
+	TrustedServers     []string `toml:",omitempty"` // Enode URLs of the trusted LES servers
+	MinTrustedFraction int      `toml:",omitempty"` // Minimum percentage of trusted servers to announce a head
+}
+
 type configMarshaling struct {
 	ExtraData hexutil.Bytes
 }
@@ -0,0 +1,244 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package downloader
+
+import (
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// cpUncleDepth is the number of blocks up to and including the checkpoint whose
+// bodies are retrieved, so that the uncles of the blocks after it can be verified.
+const cpUncleDepth = 7
+
+var (
+	errNoCheckpoint          = errors.New("no trusted checkpoint configured")
+	errCheckpointUnavailable = errors.New("peer is behind the trusted checkpoint")
+)
+
+// Checkpoint is a trusted block to start synchronising from in checkpoint sync
+// mode, skipping the verification of the chain leading up to it.
+type Checkpoint struct {
+	Hash common.Hash // Hash of the trusted block
+	TD   *big.Int    // Total difficulty of the trusted block
+}
+
+// syncCheckpoint retrieves the chain up to the trusted checkpoint from a peer,
+// unless the local chain already reached it.
+//
+// The headers are retrieved backwards from the checkpoint until they link up
+// with the local canonical chain, checking only that they hash together. The
+// state of the checkpoint is retrieved meanwhile, after which the bodies and
+// receipts of the last few blocks are fetched and the checkpoint is committed
+// as the head block. The blocks after it are then synchronised as in full sync.
+func (d *Downloader) syncCheckpoint(p *peerConnection, td *big.Int) error {
+	checkpoint := d.Checkpoint
+	if checkpoint == nil {
+		return errNoCheckpoint
+	}
+	head := d.blockchain.CurrentBlock()
+	if local := d.blockchain.GetTdByHash(head.Hash()); local != nil && local.Cmp(checkpoint.TD) >= 0 {
+		return nil
+	}
+	if td.Cmp(checkpoint.TD) < 0 {
+		return errCheckpointUnavailable
+	}
+	p.log.Debug("Synchronising up to trusted checkpoint", "hash", checkpoint.Hash, "td", checkpoint.TD)
+
+	var (
+		header *types.Header                     // Header of the checkpoint block
+		recent []*types.Header                   // Headers of the blocks up to the checkpoint
+		sync   *stateSync                        // State sync of the checkpoint block
+		next   = checkpoint.Hash                 // Hash of the next header to retrieve
+		nextTd = new(big.Int).Set(checkpoint.TD) // Total difficulty of the next header
+		start  = time.Now()
+	)
+	defer func() {
+		if sync != nil {
+			sync.Cancel()
+		}
+	}()
+	for {
+		headers, err := d.fetchHeadersBackwards(p, next)
+		if err != nil {
+			return err
+		}
+		for _, h := range headers {
+			if h.Hash() != next {
+				p.log.Debug("Retrieved unlinked checkpoint header", "number", h.Number, "hash", h.Hash(), "want", next)
+				return errInvalidChain
+			}
+			next = h.ParentHash
+		}
+		// Start retrieving the state as soon as the checkpoint header is known
+		if header == nil {
+			header = headers[0]
+			for i := len(headers) - 1; i >= 0; i-- {
+				if i < cpUncleDepth && headers[i].Number.Sign() > 0 {
+					recent = append(recent, headers[i])
+				}
+			}
+			sync = d.syncState(header.Root)
+
+			d.syncStatsLock.Lock()
+			d.syncStatsChainHeight = header.Number.Uint64()
+			d.syncStatsLock.Unlock()
+		}
+		n, err := d.blockchain.InsertTrustedHeaders(headers, nextTd)
+		if err != nil {
+			return err
+		}
+		if n < len(headers) {
+			break
+		}
+		for _, h := range headers {
+			nextTd.Sub(nextTd, h.Difficulty)
+		}
+		last := headers[len(headers)-1]
+		log.Debug("Imported trusted block headers", "count", len(headers), "number", last.Number, "hash", last.Hash())
+	}
+	if err := d.blockchain.SetTrustedHead(header.Hash()); err != nil {
+		return err
+	}
+	log.Info("Imported headers up to trusted checkpoint", "number", header.Number, "hash", header.Hash(), "elapsed", common.PrettyDuration(time.Since(start)))
+
+	// Wait for the state of the checkpoint, then commit it as the head block
+	select {
+	case <-sync.done:
+		if err := sync.Wait(); err != nil {
+			return err
+		}
+	case <-d.cancelCh:
+		return errCancelStateFetch
+	}
+	blocks, receipts, err := d.fetchCheckpointBlocks(p, recent)
+	if err != nil {
+		return err
+	}
+	if _, err := d.blockchain.InsertReceiptChain(blocks, receipts); err != nil {
+		return err
+	}
+	return d.blockchain.FastSyncCommitHead(header.Hash())
+}
+
+// fetchHeadersBackwards retrieves a batch of headers from a peer, starting at
+// the given hash and moving towards the genesis block.
+func (d *Downloader) fetchHeadersBackwards(p *peerConnection, hash common.Hash) ([]*types.Header, error) {
+	packet, err := d.fetchCheckpointData(p, d.headerCh, func() error {
+		return p.peer.RequestHeadersByHash(hash, MaxHeaderFetch, 0, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	headers := packet.(*headerPack).headers
+	switch {
+	case len(headers) == 0:
+		return nil, errEmptyHeaderSet
+	case len(headers) > MaxHeaderFetch:
+		p.log.Debug("Too many headers for checkpoint request", "headers", len(headers))
+		return nil, errBadPeer
+	}
+	return headers, nil
+}
+
+// fetchCheckpointBlocks retrieves the bodies and receipts of a batch of blocks
+// from a peer, verifying them against their headers.
+func (d *Downloader) fetchCheckpointBlocks(p *peerConnection, headers []*types.Header) (types.Blocks, []types.Receipts, error) {
+	hashes := make([]common.Hash, len(headers))
+	for i, header := range headers {
+		hashes[i] = header.Hash()
+	}
+	packet, err := d.fetchCheckpointData(p, d.bodyCh, func() error { return p.peer.RequestBodies(hashes) })
+	if err != nil {
+		return nil, nil, err
+	}
+	bodies := packet.(*bodyPack)
+	if len(bodies.transactions) != len(headers) || len(bodies.uncles) != len(headers) {
+		p.log.Debug("Missing checkpoint block bodies", "have", len(bodies.transactions), "want", len(headers))
+		return nil, nil, errBadPeer
+	}
+	packet, err = d.fetchCheckpointData(p, d.receiptCh, func() error { return p.peer.RequestReceipts(hashes) })
+	if err != nil {
+		return nil, nil, err
+	}
+	receipts := packet.(*receiptPack).receipts
+	if len(receipts) != len(headers) {
+		p.log.Debug("Missing checkpoint block receipts", "have", len(receipts), "want", len(headers))
+		return nil, nil, errBadPeer
+	}
+	var (
+		blocks = make(types.Blocks, len(headers))
+		chain  = make([]types.Receipts, len(headers))
+	)
+	for i, header := range headers {
+		if types.DeriveSha(types.Transactions(bodies.transactions[i])) != header.TxHash || types.CalcUncleHash(bodies.uncles[i]) != header.UncleHash {
+			p.log.Debug("Invalid checkpoint block body", "number", header.Number, "hash", hashes[i])
+			return nil, nil, errBadPeer
+		}
+		if types.DeriveSha(types.Receipts(receipts[i])) != header.ReceiptHash {
+			p.log.Debug("Invalid checkpoint block receipts", "number", header.Number, "hash", hashes[i])
+			return nil, nil, errBadPeer
+		}
+		blocks[i] = types.NewBlockWithHeader(header).WithBody(bodies.transactions[i], bodies.uncles[i])
+		chain[i] = receipts[i]
+	}
+	return blocks, chain, nil
+}
+
+// fetchCheckpointData sends a request to a peer and waits for the response to
+// arrive on the given delivery channel, discarding anything else delivered in
+// the meantime.
+func (d *Downloader) fetchCheckpointData(p *peerConnection, deliveryCh chan dataPack, request func() error) (dataPack, error) {
+	go request()
+
+	ttl := d.requestTTL()
+	timeout := time.After(ttl)
+	for {
+		var (
+			packet dataPack
+			ch     chan dataPack
+		)
+		select {
+		case <-d.cancelCh:
+			return nil, errCancelBlockFetch
+
+		case <-timeout:
+			p.log.Debug("Waiting for checkpoint data timed out", "elapsed", ttl)
+			return nil, errTimeout
+
+		case packet = <-d.headerCh:
+			ch = d.headerCh
+		case packet = <-d.bodyCh:
+			ch = d.bodyCh
+		case packet = <-d.receiptCh:
+			ch = d.receiptCh
+		}
+		// Discard anything not from the origin peer or out of bounds
+		if packet.PeerId() != p.id {
+			log.Debug("Received checkpoint data from incorrect peer", "peer", packet.PeerId())
+			continue
+		}
+		if ch == deliveryCh {
+			return packet, nil
+		}
+	}
+}
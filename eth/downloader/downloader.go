@@ -30,6 +30,7 @@ import (
 	ethereum "github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/snap"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
@@ -67,6 +68,14 @@ var (
 	fsPivotInterval        = 256        // Number of headers out of which to randomize the pivot point
 	fsMinFullBlocks        = 64         // Number of blocks to retrieve fully even in fast sync
 	fsCriticalTrials       = uint32(32) // Number of times to retry in the cricical section before bailing
+
+	fsHeaderContCheck = 3 * time.Second // Time interval to check for headers while waiting for the pivot commit
+	fsPivotStaleCheck = time.Second     // Time interval to check for pivot staleness while its state syncs
+
+	// DefaultPivotStale is the default number of blocks the fast sync pivot may
+	// fall behind the chain head before it's moved forward. It leaves the head
+	// some room to move beyond the window the pivot is initially picked from.
+	DefaultPivotStale = uint64(fsPivotInterval + 2*fsMinFullBlocks)
 )
 
 var (
@@ -102,8 +111,20 @@ type Downloader struct {
 	peers   *peerSet // Set of active peers from which download can proceed
 	stateDB ethdb.Database
 
+	SnapSyncer *snap.Syncer // Retriever of the state from snap protocol peers
+
+	// PivotStale is the number of blocks the fast sync pivot may fall behind the
+	// chain head while its state is retrieved, before it's moved forward.
+	PivotStale uint64
+
+	// Checkpoint is the trusted block to synchronise from in checkpoint sync mode.
+	Checkpoint *Checkpoint
+
+	skeleton *skeleton // Header syncer retrieving the chain backwards from trusted heads
+
 	fsPivotLock  *types.Header // Pivot header on critical section entry (cannot change between retries)
 	fsPivotFails uint32        // Number of subsequent fast sync failures in the critical section
+	committed    int32         // Whether the fast sync pivot was committed (or there's none)
 
 	rttEstimate   uint64 // Round trip time to target for download requests
 	rttConfidence uint64 // Confidence in the estimated RTT (unit: millionths to allow atomic ops)
@@ -193,6 +214,13 @@ type BlockChain interface {
 	// FastSyncCommitHead directly commits the head block to a certain entity.
 	FastSyncCommitHead(common.Hash) error
 
+	// InsertTrustedHeaders inserts a batch of unverified headers, ordered from a
+	// trusted block backwards, reporting whether they linked to the local chain.
+	InsertTrustedHeaders([]*types.Header, *big.Int) (int, error)
+
+	// SetTrustedHead makes a trusted header the head of the local header chain.
+	SetTrustedHead(common.Hash) error
+
 	// InsertChain inserts a batch of blocks into the local chain.
 	InsertChain(types.Blocks) (int, error)
 
@@ -228,8 +256,13 @@ func New(mode SyncMode, stateDb ethdb.Database, mux *event.TypeMux, chain BlockC
 		stateSyncStart: make(chan *stateSync),
 		trackStateReq:  make(chan *stateReq),
 	}
+	dl.SnapSyncer = snap.NewSyncer(stateDb)
+	dl.PivotStale = DefaultPivotStale
+	dl.skeleton = newSkeleton(dl)
+
 	go dl.qosTuner()
 	go dl.stateFetcher()
+	go dl.skeleton.loop()
 	return dl
 }
 
@@ -247,7 +280,7 @@ func (d *Downloader) Progress() ethereum.SyncProgress {
 
 	current := uint64(0)
 	switch d.mode {
-	case FullSync:
+	case FullSync, CheckpointSync:
 		current = d.blockchain.CurrentBlock().NumberU64()
 	case FastSync:
 		current = d.blockchain.CurrentFastBlock().NumberU64()
@@ -268,6 +301,16 @@ func (d *Downloader) Synchronising() bool {
 	return atomic.LoadInt32(&d.synchronising) > 0
 }
 
+// PeerStats retrieves the retrieval quality measured for a download peer, or nil
+// if the peer is not registered.
+func (d *Downloader) PeerStats(id string) *PeerStats {
+	p := d.peers.Peer(id)
+	if p == nil {
+		return nil
+	}
+	return p.Stats()
+}
+
 // RegisterPeer injects a new download peer into the set of block source to be
 // used for fetching hashes and blocks from.
 func (d *Downloader) RegisterPeer(id string, version int, peer Peer) error {
@@ -418,6 +461,14 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 		log.Debug("Synchronisation terminated", "elapsed", time.Since(start))
 	}(time.Now())
 
+	// Retrieve the chain up to the trusted checkpoint and full sync from there
+	if d.mode == CheckpointSync {
+		if err := d.syncCheckpoint(p, td); err != nil {
+			return err
+		}
+		d.mode = FullSync
+	}
+
 	// Look up the sync boundaries: the common ancestor and the target block
 	latest, err := d.fetchHeight(p)
 	if err != nil {
@@ -465,15 +516,19 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 		}
 		log.Debug("Fast syncing until pivot block", "pivot", pivot)
 	}
+	atomic.StoreInt32(&d.committed, 1)
+	if d.mode == FastSync && pivot != 0 {
+		atomic.StoreInt32(&d.committed, 0)
+	}
 	d.queue.Prepare(origin+1, d.mode, pivot, latest)
 	if d.syncInitHook != nil {
 		d.syncInitHook(origin, height)
 	}
 
 	fetchers := []func() error{
-		func() error { return d.fetchHeaders(p, origin+1) }, // Headers are always retrieved
-		func() error { return d.fetchBodies(origin + 1) },   // Bodies are retrieved during normal and fast sync
-		func() error { return d.fetchReceipts(origin + 1) }, // Receipts are retrieved during fast sync
+		func() error { return d.fetchHeaders(p, origin+1, pivot) }, // Headers are always retrieved
+		func() error { return d.fetchBodies(origin + 1) },          // Bodies are retrieved during normal and fast sync
+		func() error { return d.fetchReceipts(origin + 1) },        // Receipts are retrieved during fast sync
 		func() error { return d.processHeaders(origin+1, td) },
 	}
 	if d.mode == FastSync {
@@ -769,7 +824,10 @@ func (d *Downloader) findAncestor(p *peerConnection, height uint64) (uint64, err
 // other peers are only accepted if they map cleanly to the skeleton. If no one
 // can fill in the skeleton - not even the origin peer - it's assumed invalid and
 // the origin is dropped.
-func (d *Downloader) fetchHeaders(p *peerConnection, from uint64) error {
+//
+// During fast sync, new headers keep being polled for until the pivot block is
+// committed, allowing the pivot to move forward if it grows stale.
+func (d *Downloader) fetchHeaders(p *peerConnection, from uint64, pivot uint64) error {
 	p.log.Debug("Directing header downloads", "origin", from)
 	defer p.log.Debug("Header download terminated")
 
@@ -820,6 +878,18 @@ func (d *Downloader) fetchHeaders(p *peerConnection, from uint64) error {
 			}
 			// If no more headers are inbound, notify the content fetchers and return
 			if packet.Items() == 0 {
+				// Don't abort header fetches while the pivot is downloading. Peers
+				// stopping short of the blocks promised after it are stalling.
+				if atomic.LoadInt32(&d.committed) == 0 && pivot+uint64(fsMinFullBlocks) < from {
+					p.log.Debug("No headers, waiting for pivot commit")
+					select {
+					case <-time.After(fsHeaderContCheck):
+						getHeaders(from)
+						continue
+					case <-d.cancelCh:
+						return errCancelHeaderFetch
+					}
+				}
 				p.log.Debug("No more headers available")
 				select {
 				case d.headerProcCh <- nil:
@@ -968,22 +1038,22 @@ func (d *Downloader) fetchReceipts(from uint64) error {
 // various callbacks to handle the slight differences between processing them.
 //
 // The instrumentation parameters:
-//  - errCancel:   error type to return if the fetch operation is cancelled (mostly makes logging nicer)
-//  - deliveryCh:  channel from which to retrieve downloaded data packets (merged from all concurrent peers)
-//  - deliver:     processing callback to deliver data packets into type specific download queues (usually within `queue`)
-//  - wakeCh:      notification channel for waking the fetcher when new tasks are available (or sync completed)
-//  - expire:      task callback method to abort requests that took too long and return the faulty peers (traffic shaping)
-//  - pending:     task callback for the number of requests still needing download (detect completion/non-completability)
-//  - inFlight:    task callback for the number of in-progress requests (wait for all active downloads to finish)
-//  - throttle:    task callback to check if the processing queue is full and activate throttling (bound memory use)
-//  - reserve:     task callback to reserve new download tasks to a particular peer (also signals partial completions)
-//  - fetchHook:   tester callback to notify of new tasks being initiated (allows testing the scheduling logic)
-//  - fetch:       network callback to actually send a particular download request to a physical remote peer
-//  - cancel:      task callback to abort an in-flight download request and allow rescheduling it (in case of lost peer)
-//  - capacity:    network callback to retrieve the estimated type-specific bandwidth capacity of a peer (traffic shaping)
-//  - idle:        network callback to retrieve the currently (type specific) idle peers that can be assigned tasks
-//  - setIdle:     network callback to set a peer back to idle and update its estimated capacity (traffic shaping)
-//  - kind:        textual label of the type being downloaded to display in log mesages
+//   - errCancel:   error type to return if the fetch operation is cancelled (mostly makes logging nicer)
+//   - deliveryCh:  channel from which to retrieve downloaded data packets (merged from all concurrent peers)
+//   - deliver:     processing callback to deliver data packets into type specific download queues (usually within `queue`)
+//   - wakeCh:      notification channel for waking the fetcher when new tasks are available (or sync completed)
+//   - expire:      task callback method to abort requests that took too long and return the faulty peers (traffic shaping)
+//   - pending:     task callback for the number of requests still needing download (detect completion/non-completability)
+//   - inFlight:    task callback for the number of in-progress requests (wait for all active downloads to finish)
+//   - throttle:    task callback to check if the processing queue is full and activate throttling (bound memory use)
+//   - reserve:     task callback to reserve new download tasks to a particular peer (also signals partial completions)
+//   - fetchHook:   tester callback to notify of new tasks being initiated (allows testing the scheduling logic)
+//   - fetch:       network callback to actually send a particular download request to a physical remote peer
+//   - cancel:      task callback to abort an in-flight download request and allow rescheduling it (in case of lost peer)
+//   - capacity:    network callback to retrieve the estimated type-specific bandwidth capacity of a peer (traffic shaping)
+//   - idle:        network callback to retrieve the currently (type specific) idle peers that can be assigned tasks
+//   - setIdle:     network callback to set a peer back to idle and update its estimated capacity (traffic shaping)
+//   - kind:        textual label of the type being downloaded to display in log mesages
 func (d *Downloader) fetchParts(errCancel error, deliveryCh chan dataPack, deliver func(dataPack) (int, error), wakeCh chan bool,
 	expire func() map[string]int, pending func() int, inFlight func() bool, throttle func() bool, reserve func(*peerConnection, int) (*fetchRequest, bool, error),
 	fetchHook func([]*types.Header), fetch func(*peerConnection, *fetchRequest) error, cancel func(*fetchRequest), capacity func(*peerConnection) int,
@@ -1011,6 +1081,12 @@ func (d *Downloader) fetchParts(errCancel error, deliveryCh chan dataPack, deliv
 				if err == errInvalidChain {
 					return err
 				}
+				// Drop peers consistently delivering data not matching their requests. Skeleton
+				// fills are exempt, peers on a different fork legitimately can't fill them.
+				if err != nil && err != errNoFetchesPending && kind != "headers" && peer.MarkInvalid() {
+					peer.log.Debug("Consistently invalid deliveries, dropping", "type", kind, "err", err)
+					d.dropPeer(peer.id)
+				}
 				// Unless a peer delivered something completely else than requested (usually
 				// caused by a timed out request which came through in the end), set it to
 				// idle. If the delivery's stale, the peer should have already been idled.
@@ -1069,6 +1145,10 @@ func (d *Downloader) fetchParts(errCancel error, deliveryCh chan dataPack, deliv
 					if fails > 2 {
 						peer.log.Trace("Data delivery timed out", "type", kind)
 						setIdle(peer, 0)
+						if peer.MarkTimeout() {
+							peer.log.Debug("Consistently timing out, dropping", "type", kind)
+							d.dropPeer(pid)
+						}
 					} else {
 						peer.log.Debug("Stalling delivery, dropping", "type", kind)
 						d.dropPeer(pid)
@@ -1306,6 +1386,13 @@ func (d *Downloader) processHeaders(origin uint64, td *big.Int) error {
 				headers = headers[limit:]
 				origin += uint64(limit)
 			}
+			// Track the chain head moving while the sync is running
+			d.syncStatsLock.Lock()
+			if d.syncStatsChainHeight < origin-1 {
+				d.syncStatsChainHeight = origin - 1
+			}
+			d.syncStatsLock.Unlock()
+
 			// Signal the content downloaders of the availablility of new tasks
 			for _, ch := range []chan bool{d.bodyWakeCh, d.receiptWakeCh} {
 				select {
@@ -1320,7 +1407,7 @@ func (d *Downloader) processHeaders(origin uint64, td *big.Int) error {
 // processFullSyncContent takes fetch results from the queue and imports them into the chain.
 func (d *Downloader) processFullSyncContent() error {
 	for {
-		results := d.queue.WaitResults()
+		results := d.queue.Results(true)
 		if len(results) == 0 {
 			return nil
 		}
@@ -1367,32 +1454,75 @@ func (d *Downloader) importBlockResults(results []*fetchResult) error {
 func (d *Downloader) processFastSyncContent(latest *types.Header) error {
 	// Start syncing state of the reported head block.
 	// This should get us most of the state of the pivot block.
-	stateSync := d.syncState(latest.Root)
-	defer stateSync.Cancel()
-	go func() {
-		if err := stateSync.Wait(); err != nil {
-			d.queue.Close() // wake up WaitResults
+	sync := d.syncState(latest.Root)
+	defer func() { sync.Cancel() }()
+	closeOnErr := func(s *stateSync) {
+		if err := s.Wait(); err != nil && err != errCancelStateFetch {
+			d.queue.Close() // wake up Results
 		}
-	}()
+	}
+	go closeOnErr(sync)
 
-	pivot := d.queue.FastSyncPivot()
+	var (
+		pivot    = d.queue.FastSyncPivot()
+		oldPivot *fetchResult   // Pivot block whose state is being retrieved
+		oldTail  []*fetchResult // Results following the pivot, held back with it
+	)
 	for {
-		results := d.queue.WaitResults()
+		// Don't block on new results while monitoring the pivot for staleness
+		results := d.queue.Results(oldPivot == nil)
 		if len(results) == 0 {
-			return stateSync.Cancel()
+			if oldPivot == nil {
+				return sync.Cancel()
+			}
+			select {
+			case <-d.cancelCh:
+				return errCancelContentProcessing
+			default:
+			}
 		}
-		if d.chainInsertHook != nil {
+		if d.chainInsertHook != nil && len(results) > 0 {
 			d.chainInsertHook(results)
 		}
+		if oldPivot != nil {
+			results = append(append([]*fetchResult{oldPivot}, oldTail...), results...)
+		}
+		// Move the pivot forward if the chain head left it too far behind, unless
+		// it's locked in by failures in the critical section
+		if d.fsPivotLock == nil && len(results) > 0 {
+			if height := results[len(results)-1].Header.Number.Uint64(); height > pivot+d.PivotStale && height > pivot+uint64(fsMinFullBlocks) {
+				log.Warn("Pivot became stale, moving", "old", pivot, "new", height-uint64(fsMinFullBlocks))
+				pivot = height - uint64(fsMinFullBlocks)
+				d.queue.SetFastSyncPivot(pivot)
+			}
+		}
 		P, beforeP, afterP := splitAroundPivot(pivot, results)
-		if err := d.commitFastSyncData(beforeP, stateSync); err != nil {
+		if err := d.commitFastSyncData(beforeP, sync); err != nil {
 			return err
 		}
 		if P != nil {
-			stateSync.Cancel()
-			if err := d.commitPivotBlock(P); err != nil {
-				return err
+			// Retrieve the state of a new pivot block, healing what was already
+			// retrieved for the previous one
+			if oldPivot != P {
+				sync.Cancel()
+				sync = d.syncState(P.Header.Root)
+				go closeOnErr(sync)
+				oldPivot = P
+			}
+			// Wait for the state, occasionally checking for pivot staleness
+			select {
+			case <-sync.done:
+				if err := sync.Wait(); err != nil {
+					return err
+				}
+				if err := d.commitPivotBlock(P); err != nil {
+					return err
+				}
+				oldPivot, oldTail = nil, nil
 
+			case <-time.After(fsPivotStaleCheck):
+				oldTail = afterP
+				continue
 			}
 		}
 		if err := d.importBlockResults(afterP); err != nil {
@@ -1453,21 +1583,24 @@ func (d *Downloader) commitFastSyncData(results []*fetchResult, stateSync *state
 
 func (d *Downloader) commitPivotBlock(result *fetchResult) error {
 	b := types.NewBlockWithHeader(result.Header).WithBody(result.Transactions, result.Uncles)
-	// Sync the pivot block state. This should complete reasonably quickly because
-	// we've already synced up to the reported head block state earlier.
-	if err := d.syncState(b.Root()).Wait(); err != nil {
-		return err
-	}
 	log.Debug("Committing fast sync pivot as new head", "number", b.Number(), "hash", b.Hash())
 	if _, err := d.blockchain.InsertReceiptChain([]*types.Block{b}, []types.Receipts{result.Receipts}); err != nil {
 		return err
 	}
-	return d.blockchain.FastSyncCommitHead(b.Hash())
+	if err := d.blockchain.FastSyncCommitHead(b.Hash()); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&d.committed, 1)
+	return nil
 }
 
 // DeliverHeaders injects a new batch of block headers received from a remote
 // node into the download schedule.
 func (d *Downloader) DeliverHeaders(id string, headers []*types.Header) (err error) {
+	if d.skeleton.deliver(id, headers) {
+		headerInMeter.Mark(int64(len(headers)))
+		return nil
+	}
 	return d.deliver(id, d.headerCh, &headerPack{id, headers}, headerInMeter, headerDropMeter)
 }
 
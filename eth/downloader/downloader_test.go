@@ -32,6 +32,7 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/trie"
 )
@@ -46,6 +47,7 @@ func init() {
 	MaxForkAncestry = uint64(10000)
 	blockCacheLimit = 1024
 	fsCriticalTrials = 10
+	fsHeaderContCheck = 500 * time.Millisecond
 }
 
 // downloadTester is a test simulator for mocking out local block chain.
@@ -366,7 +368,7 @@ func (dl *downloadTester) InsertReceiptChain(blocks types.Blocks, receipts []typ
 		if _, ok := dl.ownHeaders[blocks[i].Hash()]; !ok {
 			return i, errors.New("unknown owner")
 		}
-		if _, ok := dl.ownBlocks[blocks[i].ParentHash()]; !ok {
+		if _, ok := dl.ownHeaders[blocks[i].ParentHash()]; !ok {
 			return i, errors.New("unknown parent")
 		}
 		dl.ownBlocks[blocks[i].Hash()] = blocks[i]
@@ -375,6 +377,49 @@ func (dl *downloadTester) InsertReceiptChain(blocks types.Blocks, receipts []typ
 	return len(blocks), nil
 }
 
+// InsertTrustedHeaders injects a batch of trusted headers, ordered from the newest
+// one backwards, into the simulated chain until it links up with the local one.
+func (dl *downloadTester) InsertTrustedHeaders(headers []*types.Header, td *big.Int) (int, error) {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	td = new(big.Int).Set(td)
+	for i, header := range headers {
+		hash, number := header.Hash(), header.Number.Uint64()
+		if number < uint64(len(dl.ownHashes)) && dl.ownHashes[number] == hash {
+			if dl.ownChainTd[hash].Cmp(td) != 0 {
+				return i, errors.New("total difficulty mismatch")
+			}
+			return i, nil
+		}
+		dl.ownHeaders[hash] = header
+		dl.ownChainTd[hash] = new(big.Int).Set(td)
+		td.Sub(td, header.Difficulty)
+	}
+	return len(headers), nil
+}
+
+// SetTrustedHead links a trusted header and its ancestors into the simulated chain.
+func (dl *downloadTester) SetTrustedHead(hash common.Hash) error {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	header := dl.ownHeaders[hash]
+	if header == nil {
+		return fmt.Errorf("non existent header: %x", hash[:4])
+	}
+	var hashes []common.Hash
+	for number := header.Number.Uint64(); number >= uint64(len(dl.ownHashes)) || dl.ownHashes[number] != hash; number-- {
+		hashes = append(hashes, hash)
+		hash = dl.ownHeaders[hash].ParentHash
+	}
+	dl.ownHashes = dl.ownHashes[:dl.ownHeaders[hash].Number.Uint64()+1]
+	for i := len(hashes) - 1; i >= 0; i-- {
+		dl.ownHashes = append(dl.ownHashes, hashes[i])
+	}
+	return nil
+}
+
 // Rollback removes some recently added elements from the chain.
 func (dl *downloadTester) Rollback(hashes []common.Hash) {
 	dl.lock.Lock()
@@ -404,7 +449,7 @@ func (dl *downloadTester) newSlowPeer(id string, version int, hashes []common.Ha
 	defer dl.lock.Unlock()
 
 	var err error
-	err = dl.downloader.RegisterPeer(id, version, &downloadTesterPeer{dl, id, delay})
+	err = dl.downloader.RegisterPeer(id, version, &downloadTesterPeer{dl: dl, id: id, delay: delay})
 	if err == nil {
 		// Assign the owned hashes, headers and blocks to the peer (deep copy)
 		dl.peerHashes[id] = make([]common.Hash, len(hashes))
@@ -466,6 +511,7 @@ type downloadTesterPeer struct {
 	dl    *downloadTester
 	id    string
 	delay time.Duration
+	stall bool // Whether to leave requests for missing states unanswered
 }
 
 // Head constructs a function to retrieve a peer's current head hash
@@ -509,8 +555,15 @@ func (dlp *downloadTesterPeer) RequestHeadersByNumber(origin uint64, amount int,
 	hashes := dlp.dl.peerHashes[dlp.id]
 	headers := dlp.dl.peerHeaders[dlp.id]
 	result := make([]*types.Header, 0, amount)
-	for i := 0; i < amount && len(hashes)-int(origin)-1-i*(skip+1) >= 0; i++ {
-		if header, ok := headers[hashes[len(hashes)-int(origin)-1-i*(skip+1)]]; ok {
+	for i := 0; i < amount; i++ {
+		index := len(hashes) - int(origin) - 1 - i*(skip+1)
+		if reverse {
+			index = len(hashes) - int(origin) - 1 + i*(skip+1)
+		}
+		if index < 0 || index >= len(hashes) {
+			break
+		}
+		if header, ok := headers[hashes[index]]; ok {
 			result = append(result, header)
 		}
 	}
@@ -583,6 +636,8 @@ func (dlp *downloadTesterPeer) RequestNodeData(hashes []common.Hash) error {
 		if data, err := dlp.dl.peerDb.Get(hash.Bytes()); err == nil {
 			if !dlp.dl.peerMissingStates[dlp.id][hash] {
 				results = append(results, data)
+			} else if dlp.stall {
+				return nil
 			}
 		}
 	}
@@ -726,9 +781,7 @@ func testThrottling(t *testing.T, protocol int, mode SyncMode) {
 			cached = len(tester.downloader.queue.blockDonePool)
 			if mode == FastSync {
 				if receipts := len(tester.downloader.queue.receiptDonePool); receipts < cached {
-					if tester.downloader.queue.resultCache[receipts].Header.Number.Uint64() < tester.downloader.queue.fastSyncPivot {
-						cached = receipts
-					}
+					cached = receipts
 				}
 			}
 			frozen = int(atomic.LoadUint32(&blocked))
@@ -762,6 +815,52 @@ func testThrottling(t *testing.T, protocol int, mode SyncMode) {
 	}
 }
 
+// Tests that block retrievals are throttled by the memory used by the cached
+// results too, not only by their count, when blocks are large.
+func TestMemoryThrottling(t *testing.T) {
+	tester := newTester()
+	defer tester.terminate()
+
+	targetBlocks := blockCacheLimit - 15
+	hashes, headers, _, _ := tester.makeChain(targetBlocks, 0, tester.genesis, nil, false)
+
+	chain := make([]*types.Header, 0, targetBlocks)
+	for i := len(hashes) - 2; i >= 0; i-- {
+		chain = append(chain, headers[hashes[i]])
+	}
+	q := newQueue()
+	q.Prepare(1, FullSync, 0, nil)
+	q.Schedule(chain, 1)
+
+	// Pretend blocks are large enough for only a few to fit into memory
+	window := 16
+	q.resultSize = common.StorageSize(blockCacheMemory / window)
+
+	for i := 0; !q.ShouldThrottleBlocks(); i++ {
+		if i >= window {
+			t.Fatalf("memory limit not enforced")
+		}
+		p := newPeerConnection(fmt.Sprintf("peer #%d", i), 63, nil, log.New())
+		request, _, err := q.ReserveBodies(p, MaxBlockFetch)
+		if err != nil {
+			t.Fatalf("failed to reserve bodies: %v", err)
+		}
+		if request == nil {
+			continue
+		}
+		for _, header := range request.Headers {
+			if number := header.Number.Uint64(); number > uint64(window) {
+				t.Fatalf("reserved block #%d beyond the memory limit of %d blocks", number, window)
+			}
+		}
+	}
+	// Shrinking the blocks should free up the cache again
+	q.resultSize = 0
+	if q.ShouldThrottleBlocks() {
+		t.Fatalf("throttled with available memory")
+	}
+}
+
 // Tests that simple synchronization against a forked chain works correctly. In
 // this test common ancestor lookup should *not* be short circuited, and a full
 // binary search should be executed.
@@ -1091,8 +1190,8 @@ func testEmptyShortCircuit(t *testing.T, protocol int, mode SyncMode) {
 			bodiesNeeded++
 		}
 	}
-	for hash, receipt := range receipts {
-		if mode == FastSync && len(receipt) > 0 && headers[hash].Number.Uint64() <= tester.downloader.queue.fastSyncPivot {
+	for _, receipt := range receipts {
+		if mode == FastSync && len(receipt) > 0 {
 			receiptsNeeded++
 		}
 	}
@@ -1342,6 +1441,50 @@ func testBlockHeaderAttackerDropping(t *testing.T, protocol int) {
 	}
 }
 
+// Tests that peers repeatedly delivering block bodies not matching the requested
+// headers get dropped, while the sync completes from the honest ones.
+func TestInvalidBodyDropping62(t *testing.T) { testInvalidBodyDropping(t, 62) }
+func TestInvalidBodyDropping63(t *testing.T) { testInvalidBodyDropping(t, 63) }
+func TestInvalidBodyDropping64(t *testing.T) { testInvalidBodyDropping(t, 64) }
+
+func testInvalidBodyDropping(t *testing.T, protocol int) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	targetBlocks := blockCacheLimit - 15
+	hashes, headers, blocks, receipts := tester.makeChain(targetBlocks, 0, tester.genesis, nil, false)
+
+	// Create a peer serving an invalid uncle set for every block
+	junk := make(map[common.Hash]*types.Block)
+	for hash, block := range blocks {
+		junk[hash] = block.WithBody(block.Transactions(), []*types.Header{block.Header()})
+	}
+	tester.newPeer("junk", protocol, hashes, headers, junk, receipts)
+
+	// Synchronise in two rounds, each giving the junk peer a chance to fail
+	tester.newPeer("half", protocol, hashes[targetBlocks/2:], headers, blocks, receipts)
+	if err := tester.sync("half", nil, FullSync); err != nil {
+		t.Fatalf("failed to synchronise first half: %v", err)
+	}
+	if _, ok := tester.peerHashes["junk"]; !ok {
+		t.Fatalf("peer dropped after first invalid delivery")
+	}
+	tester.newPeer("full", protocol, hashes, headers, blocks, receipts)
+	if err := tester.sync("full", nil, FullSync); err != nil {
+		t.Fatalf("failed to synchronise blocks: %v", err)
+	}
+	assertOwnChain(t, tester, targetBlocks+1)
+
+	if _, ok := tester.peerHashes["junk"]; ok {
+		t.Fatalf("peer delivering invalid bodies not dropped")
+	}
+	if stats := tester.downloader.PeerStats("full"); stats == nil || stats.BlockThroughput == 0 || stats.Faults != 0 {
+		t.Fatalf("honest peer stats mismatch: %+v", stats)
+	}
+}
+
 // Tests that synchronisation progress (origin block number, current block number
 // and highest block number) is tracked and updated correctly.
 func TestSyncProgress62(t *testing.T)      { testSyncProgress(t, 62, FullSync) }
@@ -1803,3 +1946,255 @@ func testFastCriticalRestarts(t *testing.T, protocol int, progress bool) {
 	// completed using a single mode of operation, whereas fast-then-slow can result
 	// in arbitrary intermediate state that's not cleanly verifiable.
 }
+
+// Tests that if the state of the fast sync pivot cannot be retrieved and the
+// pivot falls too far behind the chain head, it is moved forward and the sync
+// finishes on the state of the new pivot.
+func TestFastPivotStale63(t *testing.T) { testFastPivotStale(t, 63) }
+func TestFastPivotStale64(t *testing.T) { testFastPivotStale(t, 64) }
+
+func testFastPivotStale(t *testing.T, protocol int) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	// Create a large enough blockchain to actually fast sync on
+	targetBlocks := fsMinFullBlocks + 2*fsPivotInterval - 15
+	hashes, headers, blocks, receipts := tester.makeChain(targetBlocks, 0, tester.genesis, nil, false)
+
+	tester.newPeer("peer", protocol, hashes, headers, blocks, receipts)
+	tester.downloader.dropPeer = func(id string) {} // Missing states would otherwise drop the only peer
+	tester.downloader.PivotStale = 1
+
+	// Stall on the state of all pivot candidates but the one at the chain head
+	for i := 1; i < fsPivotInterval; i++ {
+		tester.peerMissingStates["peer"][headers[hashes[fsMinFullBlocks+i]].Root] = true
+	}
+	(tester.downloader.peers.peers["peer"].peer).(*downloadTesterPeer).stall = true
+	if err := tester.sync("peer", nil, FastSync); err != nil {
+		t.Fatalf("failed to synchronise blocks: %v", err)
+	}
+	assertOwnChain(t, tester, targetBlocks+1)
+}
+
+// Tests that checkpoint sync retrieves only the headers before a trusted block,
+// the state and last few bodies at it, and full blocks after it.
+func TestCheckpointSynchronisation63(t *testing.T) { testCheckpointSynchronisation(t, 63) }
+func TestCheckpointSynchronisation64(t *testing.T) { testCheckpointSynchronisation(t, 64) }
+
+func testCheckpointSynchronisation(t *testing.T, protocol int) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	// Create a chain with the checkpoint a few batches before the head
+	targetBlocks := 3*MaxHeaderFetch + 10
+	hashes, headers, blocks, receipts := tester.makeChain(targetBlocks, 0, tester.genesis, nil, false)
+	tester.newPeer("peer", protocol, hashes, headers, blocks, receipts)
+
+	checkpoint := hashes[50]
+	tester.downloader.Checkpoint = &Checkpoint{Hash: checkpoint, TD: tester.peerChainTds["peer"][checkpoint]}
+
+	if err := tester.sync("peer", nil, CheckpointSync); err != nil {
+		t.Fatalf("failed to synchronise blocks: %v", err)
+	}
+	if hs := len(tester.ownHashes); hs != targetBlocks+1 {
+		t.Fatalf("synchronised headers mismatch: have %v, want %v", hs, targetBlocks+1)
+	}
+	if head := tester.CurrentBlock().Hash(); head != hashes[0] {
+		t.Fatalf("head block mismatch: have %x, want %x", head[:4], hashes[0][:4])
+	}
+	for i, hash := range tester.ownHashes {
+		if tester.ownHeaders[hash] == nil || tester.ownHeaders[hash].Number.Uint64() != uint64(i) {
+			t.Fatalf("header #%d missing or misplaced", i)
+		}
+		if td, want := tester.ownChainTd[hash], tester.peerChainTds["peer"][hash]; td == nil || td.Cmp(want) != 0 {
+			t.Fatalf("total difficulty mismatch at #%d: have %v, want %v", i, td, want)
+		}
+		number := targetBlocks - 50
+		if _, ok := tester.ownBlocks[hash]; ok != (i == 0 || i > number-cpUncleDepth) {
+			t.Fatalf("block #%d presence mismatch: have %v", i, ok)
+		}
+	}
+}
+
+// Tests that a checkpoint with an invalid total difficulty is detected when its
+// headers link up with the local chain, and that peers behind the checkpoint
+// are not synchronised with.
+func TestCheckpointInvalidTd63(t *testing.T) { testCheckpointInvalidTd(t, 63) }
+func TestCheckpointInvalidTd64(t *testing.T) { testCheckpointInvalidTd(t, 64) }
+
+func testCheckpointInvalidTd(t *testing.T, protocol int) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	targetBlocks := MaxHeaderFetch + 10
+	hashes, headers, blocks, receipts := tester.makeChain(targetBlocks, 0, tester.genesis, nil, false)
+	tester.newPeer("peer", protocol, hashes, headers, blocks, receipts)
+
+	// Bump the checkpoint difficulty above the peer's, it should be unavailable
+	td := new(big.Int).Add(tester.peerChainTds["peer"][hashes[0]], big.NewInt(1))
+	tester.downloader.Checkpoint = &Checkpoint{Hash: hashes[0], TD: td}
+
+	if err := tester.sync("peer", nil, CheckpointSync); err != errCheckpointUnavailable {
+		t.Fatalf("unavailable checkpoint error mismatch: have %v, want %v", err, errCheckpointUnavailable)
+	}
+	// Move the checkpoint back a few blocks, keeping the difficulty of the head
+	tester.downloader.Checkpoint = &Checkpoint{Hash: hashes[10], TD: tester.peerChainTds["peer"][hashes[0]]}
+	if err := tester.sync("peer", nil, CheckpointSync); err == nil {
+		t.Fatalf("succeeded to synchronise from invalid checkpoint")
+	}
+	if head := tester.CurrentBlock().NumberU64(); head != 0 {
+		t.Fatalf("head block advanced from invalid checkpoint: #%d", head)
+	}
+}
+
+// waitHeadHeader waits until the tester's head header becomes the given one.
+func waitHeadHeader(t *testing.T, tester *downloadTester, hash common.Hash) {
+	for start := time.Now(); tester.CurrentHeader().Hash() != hash; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("head header mismatch: have #%d, want %x", tester.CurrentHeader().Number, hash[:4])
+		}
+	}
+}
+
+// Tests that the skeleton syncer retrieves the chain backwards from a trusted
+// head, imports it once it links up with the local chain, and extends it when
+// newer heads arrive.
+func TestBeaconSync62(t *testing.T) { testBeaconSync(t, 62) }
+func TestBeaconSync63(t *testing.T) { testBeaconSync(t, 63) }
+func TestBeaconSync64(t *testing.T) { testBeaconSync(t, 64) }
+
+func testBeaconSync(t *testing.T, protocol int) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	targetBlocks := blockCacheLimit - 15
+	hashes, headers, blocks, receipts := tester.makeChain(targetBlocks, 0, tester.genesis, nil, false)
+	tester.newPeer("peer", protocol, hashes, headers, blocks, receipts)
+
+	// Sync to a few blocks below the head, then extend to the head
+	if err := tester.downloader.BeaconSync(headers[hashes[2]]); err != nil {
+		t.Fatalf("failed to start beacon sync: %v", err)
+	}
+	waitHeadHeader(t, tester, hashes[2])
+
+	for i := 1; i >= 0; i-- {
+		if err := tester.downloader.BeaconSync(headers[hashes[i]]); err != nil {
+			t.Fatalf("failed to extend beacon sync: %v", err)
+		}
+	}
+	waitHeadHeader(t, tester, hashes[0])
+
+	if hs := len(tester.ownHeaders); hs != targetBlocks+1 {
+		t.Fatalf("synchronised headers mismatch: have %v, want %v", hs, targetBlocks+1)
+	}
+	if progress := readSkeletonProgress(tester.stateDb); len(progress.Subchains) > 0 {
+		t.Fatalf("skeleton subchains left after import: %v", progress.Subchains)
+	}
+}
+
+// Tests that the skeleton syncer follows a head reorged onto a different fork,
+// importing the new fork from where it diverges.
+func TestBeaconSyncReorg62(t *testing.T) { testBeaconSyncReorg(t, 62) }
+func TestBeaconSyncReorg63(t *testing.T) { testBeaconSyncReorg(t, 63) }
+func TestBeaconSyncReorg64(t *testing.T) { testBeaconSyncReorg(t, 64) }
+
+func testBeaconSyncReorg(t *testing.T, protocol int) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	common, fork := MaxHeaderFetch, 2*MaxHeaderFetch
+	hashesA, hashesB, headersA, headersB, blocksA, blocksB, receiptsA, receiptsB := tester.makeChainFork(common+fork, fork, tester.genesis, nil, true)
+
+	tester.newPeer("fork A", protocol, hashesA, headersA, blocksA, receiptsA)
+	if err := tester.downloader.BeaconSync(headersA[hashesA[0]]); err != nil {
+		t.Fatalf("failed to start beacon sync: %v", err)
+	}
+	waitHeadHeader(t, tester, hashesA[0])
+
+	// Switch the peers over to the other fork and reorg the head onto it
+	tester.dropPeer("fork A")
+	tester.newPeer("fork B", protocol, hashesB, headersB, blocksB, receiptsB)
+	if err := tester.downloader.BeaconSync(headersB[hashesB[0]]); err != nil {
+		t.Fatalf("failed to reorg beacon sync: %v", err)
+	}
+	waitHeadHeader(t, tester, hashesB[0])
+
+	if hs := len(tester.ownHeaders); hs != common+2*fork+1 {
+		t.Fatalf("synchronised headers mismatch: have %v, want %v", hs, common+2*fork+1)
+	}
+}
+
+// Tests that new skeleton subchains are merged into older ones when reaching a
+// shared header, and that they overwrite older ones on a different fork.
+func TestSkeletonSubchains(t *testing.T) {
+	tester := newTester()
+	defer tester.terminate()
+
+	hashesA, hashesB, headersA, headersB, _, _, _, _ := tester.makeChainFork(40, 20, tester.genesis, nil, true)
+	chainA := func(number int) *types.Header { return headersA[hashesA[40-number]] }
+	chainB := func(number int) *types.Header { return headersB[hashesB[40-number]] }
+
+	s := tester.downloader.skeleton
+	s.progress = new(skeletonProgress)
+
+	check := func(want ...subchain) {
+		if len(s.progress.Subchains) != len(want) {
+			t.Fatalf("subchain count mismatch: have %d, want %d", len(s.progress.Subchains), len(want))
+		}
+		for i, chain := range s.progress.Subchains {
+			if *chain != want[i] {
+				t.Fatalf("subchain %d mismatch: have %+v, want %+v", i, *chain, want[i])
+			}
+		}
+	}
+	extend := func(chain func(int) *types.Header, from, to int) {
+		headers := make([]*types.Header, 0, from-to+1)
+		for number := from; number >= to; number-- {
+			headers = append(headers, chain(number))
+		}
+		if err := s.extend(headers); err != nil {
+			t.Fatalf("failed to extend subchain: %v", err)
+		}
+	}
+	// Start a subchain and extend its head, then open a new one above it
+	s.processNewHead(chainA(30))
+	s.processNewHead(chainA(31))
+	check(subchain{31, 30, chainA(29).Hash()})
+
+	s.processNewHead(chainA(38))
+	check(subchain{38, 38, chainA(37).Hash()}, subchain{31, 30, chainA(29).Hash()})
+
+	// Fill the gap between them, they should merge on the first shared header
+	extend(chainA, 37, 25)
+	check(subchain{38, 30, chainA(29).Hash()})
+
+	// Reorg onto the other fork below the head, the older subchain should be cut
+	// back as the new one runs over it, then dropped
+	s.processNewHead(chainB(34))
+	check(subchain{34, 34, chainB(33).Hash()}, subchain{33, 30, chainA(29).Hash()})
+
+	extend(chainB, 33, 31)
+	check(subchain{34, 31, chainB(30).Hash()}, subchain{30, 30, chainA(29).Hash()})
+
+	extend(chainB, 30, 15)
+	check(subchain{34, 15, chainB(14).Hash()})
+
+	for number := uint64(35); number <= 38; number++ {
+		if header := readSkeletonHeader(tester.stateDb, number); header != nil {
+			t.Fatalf("reorged header #%d not deleted", number)
+		}
+	}
+	if header := readSkeletonHeader(tester.stateDb, 20); header == nil || header.Hash() != chainB(20).Hash() {
+		t.Fatalf("header #20 mismatch after reorg")
+	}
+}
@@ -37,6 +37,8 @@ import (
 const (
 	maxLackingHashes  = 4096 // Maximum number of entries allowed on the list or lacking items
 	measurementImpact = 0.1  // The impact a single measurement has on a peer's final throughput value.
+	invalidImpact     = 0.4  // The impact an invalid delivery has on a peer's fault average
+	maxPeerFaults     = 0.5  // Moving average of failed requests above which a peer is dropped
 )
 
 var (
@@ -59,7 +61,8 @@ type peerConnection struct {
 	receiptThroughput float64 // Number of receipts measured to be retrievable per second
 	stateThroughput   float64 // Number of node data pieces measured to be retrievable per second
 
-	rtt time.Duration // Request round trip time to track responsiveness (QoS)
+	rtt    time.Duration // Request round trip time to track responsiveness (QoS)
+	faults float64       // Moving average of timed out or invalid requests (kept across resets)
 
 	headerStarted  time.Time // Time instance when the last header fetch was started
 	blockStarted   time.Time // Time instance when the last block (body) fetch was started
@@ -161,6 +164,21 @@ func (p *peerConnection) FetchHeaders(from uint64, count int) error {
 	return nil
 }
 
+// FetchHeadersBackwards sends a header retrieval request to the remote peer,
+// going from the given block towards the genesis.
+func (p *peerConnection) FetchHeadersBackwards(from uint64, count int) error {
+	// Short circuit if the peer is already fetching
+	if !atomic.CompareAndSwapInt32(&p.headerIdle, 0, 1) {
+		return errAlreadyFetching
+	}
+	p.headerStarted = time.Now()
+
+	// Issue the header retrieval request (absolut downwards without gaps)
+	go p.peer.RequestHeadersByNumber(from, count, 0, true)
+
+	return nil
+}
+
 // FetchBodies sends a block body retrieval request to the remote peer.
 func (p *peerConnection) FetchBodies(request *fetchRequest) error {
 	// Sanity check the protocol version
@@ -277,6 +295,7 @@ func (p *peerConnection) setIdle(started time.Time, delivered int, throughput *f
 
 	*throughput = (1-measurementImpact)*(*throughput) + measurementImpact*measured
 	p.rtt = time.Duration((1-measurementImpact)*float64(p.rtt) + measurementImpact*float64(elapsed))
+	p.faults = (1 - measurementImpact) * p.faults
 
 	p.log.Trace("Peer throughput measurements updated",
 		"hps", p.headerThroughput, "bps", p.blockThroughput,
@@ -284,6 +303,54 @@ func (p *peerConnection) setIdle(started time.Time, delivered int, throughput *f
 		"miss", len(p.lacking), "rtt", p.rtt)
 }
 
+// MarkTimeout records a request which the peer failed to answer in time,
+// returning whether it's been consistently slow enough to be dropped.
+func (p *peerConnection) MarkTimeout() bool {
+	return p.markFault(measurementImpact)
+}
+
+// MarkInvalid records a request which the peer answered with data not matching
+// it, returning whether it's been faulty enough to be dropped. Invalid data is
+// weighed heavier than timeouts, as it's either malicious or a very late reply.
+func (p *peerConnection) MarkInvalid() bool {
+	return p.markFault(invalidImpact)
+}
+
+// markFault updates the fault average of the peer with a failed request of the
+// given impact, returning whether the peer should be dropped.
+func (p *peerConnection) markFault(impact float64) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.faults = (1-impact)*p.faults + impact
+	return p.faults > maxPeerFaults
+}
+
+// PeerStats is a snapshot of the retrieval quality measured for a peer.
+type PeerStats struct {
+	HeaderThroughput  float64       `json:"headerThroughput"`  // Headers retrievable per second
+	BlockThroughput   float64       `json:"blockThroughput"`   // Block bodies retrievable per second
+	ReceiptThroughput float64       `json:"receiptThroughput"` // Receipts retrievable per second
+	StateThroughput   float64       `json:"stateThroughput"`   // Node data pieces retrievable per second
+	RTT               time.Duration `json:"rtt"`               // Request round trip time
+	Faults            float64       `json:"faults"`            // Moving average of failed requests
+}
+
+// Stats retrieves the retrieval quality measured for the peer.
+func (p *peerConnection) Stats() *PeerStats {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return &PeerStats{
+		HeaderThroughput:  p.headerThroughput,
+		BlockThroughput:   p.blockThroughput,
+		ReceiptThroughput: p.receiptThroughput,
+		StateThroughput:   p.stateThroughput,
+		RTT:               p.rtt,
+		Faults:            p.faults,
+	}
+}
+
 // HeaderCapacity retrieves the peers header download allowance based on its
 // previously discovered throughput.
 func (p *peerConnection) HeaderCapacity(targetRTT time.Duration) int {
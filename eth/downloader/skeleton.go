@@ -0,0 +1,586 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package downloader
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// scratchBatches is the number of header batches the skeleton syncer retrieves
+// concurrently below the tail of the subchain being extended.
+const scratchBatches = 8
+
+var (
+	skeletonProgressKey  = []byte("SkeletonSyncStatus") // Subchains retrieved by the skeleton syncer
+	skeletonHeaderPrefix = []byte("skeleton-header-")   // skeletonHeaderPrefix + num (uint64 big endian) -> header
+
+	errSkeletonGenesis = errors.New("skeleton chain doesn't link to the local genesis")
+	errSkeletonMissing = errors.New("skeleton header missing from the database")
+)
+
+// subchain is a contiguous segment of the skeleton chain stored in the database,
+// which may not be linked to the local chain yet.
+type subchain struct {
+	Head uint64      // Block number of the newest header in the subchain
+	Tail uint64      // Block number of the oldest header in the subchain
+	Next common.Hash // Block hash of the parent of the oldest header
+}
+
+// skeletonProgress is the database entry allowing a skeleton sync to be resumed
+// after a restart.
+type skeletonProgress struct {
+	Subchains []*subchain // Disjoint subchains retrieved so far, newest first
+}
+
+// skeletonBatch is a range of headers to retrieve backwards below the tail of
+// the newest subchain.
+type skeletonBatch struct {
+	from    uint64          // Number of the newest header in the batch
+	count   int             // Number of headers in the batch
+	peer    string          // Peer retrieving (or having delivered) the batch
+	headers []*types.Header // Delivered headers, newest first
+	dropped bool            // Whether the batch was abandoned while in flight
+}
+
+// skeletonRequest is a header retrieval request in flight for a batch.
+type skeletonRequest struct {
+	peer    *peerConnection
+	batch   *skeletonBatch
+	timer   *time.Timer     // Timer firing when the request times out
+	headers []*types.Header // Delivered headers, nil if timed out
+	done    chan struct{}   // Closed when the sync the request belongs to ends
+}
+
+// skeleton is a header syncer which retrieves the chain backwards from a head
+// announced by a trusted source (e.g. an RPC call or a checkpoint), instead of
+// following the total difficulty claims of the peers. Headers are stored aside
+// until they link up with the local chain, after which they're imported into it
+// in batches.
+//
+// New heads extending the current one are appended. Any other head starts a new
+// subchain, which overwrites the headers of the older ones on its way down and
+// is merged with them once they agree on a header.
+type skeleton struct {
+	d        *Downloader
+	progress *skeletonProgress // Subchains retrieved so far, nil until loaded
+
+	batches []*skeletonBatch // Header batches being retrieved, newest first
+
+	requests map[string]*skeletonRequest // Requests in flight, keyed by peer
+	lock     sync.Mutex                  // Protects the requests
+
+	headCh     chan *types.Header    // Channel receiving the heads to sync to
+	responseCh chan *skeletonRequest // Channel receiving the answered requests
+	timeoutCh  chan *skeletonRequest // Channel receiving the timed out requests
+	syncDone   chan struct{}         // Closed when the current sync cycle ends
+	filling    chan struct{}         // Always closed, to not block while importing
+}
+
+// newSkeleton creates a skeleton syncer importing into the local chain of the
+// downloader.
+func newSkeleton(d *Downloader) *skeleton {
+	s := &skeleton{
+		d:          d,
+		requests:   make(map[string]*skeletonRequest),
+		headCh:     make(chan *types.Header),
+		responseCh: make(chan *skeletonRequest),
+		timeoutCh:  make(chan *skeletonRequest),
+		filling:    make(chan struct{}),
+	}
+	close(s.filling)
+	return s
+}
+
+// BeaconSync starts or extends a skeleton sync towards the given head, retrieving
+// the chain backwards from it until it links up with the local chain.
+func (d *Downloader) BeaconSync(head *types.Header) error {
+	select {
+	case d.skeleton.headCh <- head:
+		return nil
+	case <-d.quitCh:
+		return errCancelHeaderFetch
+	}
+}
+
+// loop waits for heads to sync to, running a sync cycle for each, until the
+// downloader is terminated.
+func (s *skeleton) loop() {
+	for {
+		select {
+		case head := <-s.headCh:
+			if err := s.sync(head); err != nil && err != errCancelHeaderFetch {
+				log.Warn("Skeleton sync failed", "err", err)
+			}
+		case <-s.d.quitCh:
+			return
+		}
+	}
+}
+
+// sync runs a sync cycle towards a head, returning once the skeleton is imported
+// into the local chain.
+func (s *skeleton) sync(head *types.Header) error {
+	if s.progress == nil {
+		s.progress = readSkeletonProgress(s.d.stateDB)
+	}
+	s.syncDone = make(chan struct{})
+	defer s.cleanup()
+
+	if err := s.processNewHead(head); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		// Nothing to do if all the subchains were imported
+		if len(s.progress.Subchains) == 0 {
+			return nil
+		}
+		// Import the skeleton once linked, otherwise keep retrieving it
+		var filling chan struct{}
+
+		linked, err := s.linked()
+		if err != nil {
+			s.wipe()
+			return err
+		}
+		if linked {
+			done, err := s.fill()
+			if err != nil || done {
+				return err
+			}
+			filling = s.filling
+		} else {
+			s.assignTasks()
+		}
+		select {
+		case head := <-s.headCh:
+			if err := s.processNewHead(head); err != nil {
+				return err
+			}
+		case req := <-s.responseCh:
+			s.processResponse(req)
+
+		case req := <-s.timeoutCh:
+			req.peer.log.Debug("Skeleton header request timed out", "from", req.batch.from)
+			req.peer.SetHeadersIdle(0)
+			req.batch.peer = ""
+			if req.peer.MarkTimeout() {
+				s.d.dropPeer(req.peer.id)
+			}
+		case <-ticker.C:
+		case <-filling:
+		case <-s.d.quitCh:
+			return errCancelHeaderFetch
+		}
+	}
+}
+
+// cleanup releases the peers with requests in flight at the end of a sync cycle.
+func (s *skeleton) cleanup() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for id, req := range s.requests {
+		req.timer.Stop()
+		req.peer.SetHeadersIdle(0)
+		delete(s.requests, id)
+	}
+	close(s.syncDone)
+	s.batches = nil
+}
+
+// processNewHead appends a head to the newest subchain if it extends it, or
+// starts a new subchain from it otherwise.
+func (s *skeleton) processNewHead(head *types.Header) error {
+	number := head.Number.Uint64()
+	if number == 0 || s.d.lightchain.HasHeader(head.Hash()) {
+		return nil
+	}
+	if len(s.progress.Subchains) > 0 {
+		cur := s.progress.Subchains[0]
+		if number == cur.Head+1 {
+			if last := readSkeletonHeader(s.d.stateDB, cur.Head); last != nil && last.Hash() == head.ParentHash {
+				cur.Head = number
+				return s.write(head)
+			}
+		}
+		if number >= cur.Tail && number <= cur.Head {
+			if known := readSkeletonHeader(s.d.stateDB, number); known != nil && known.Hash() == head.Hash() {
+				return nil
+			}
+		}
+	}
+	log.Debug("Starting new skeleton subchain", "number", number, "hash", head.Hash())
+
+	s.progress.Subchains = append([]*subchain{{Head: number, Tail: number, Next: head.ParentHash}}, s.progress.Subchains...)
+	s.abandonBatches()
+
+	if s.overlap(head) {
+		return s.writeProgress()
+	}
+	return s.write(head)
+}
+
+// overlap checks whether a header about to become the tail of the newest subchain
+// runs into the next older one. If they agree on the header, the two are merged
+// and true is returned. Otherwise the older subchain is on a reorged fork, and the
+// part of it overwritten by the newer one is dropped.
+func (s *skeleton) overlap(header *types.Header) bool {
+	var (
+		cur    = s.progress.Subchains[0]
+		number = header.Number.Uint64()
+	)
+	for len(s.progress.Subchains) > 1 {
+		old := s.progress.Subchains[1]
+
+		// Delete any headers of the older subchain above the newer one
+		for ; old.Head > cur.Head && old.Head >= old.Tail; old.Head-- {
+			s.d.stateDB.Delete(skeletonHeaderKey(old.Head))
+		}
+		if old.Head >= old.Tail && old.Head >= number {
+			if known := readSkeletonHeader(s.d.stateDB, number); known != nil && known.Hash() == header.Hash() {
+				log.Debug("Merging skeleton subchains", "number", number, "head", cur.Head, "tail", old.Tail)
+				cur.Tail, cur.Next = old.Tail, old.Next
+				s.progress.Subchains = append(s.progress.Subchains[:1], s.progress.Subchains[2:]...)
+				return true
+			}
+			old.Head--
+		}
+		if old.Head >= old.Tail {
+			return false
+		}
+		s.progress.Subchains = append(s.progress.Subchains[:1], s.progress.Subchains[2:]...)
+	}
+	return false
+}
+
+// linked checks whether the newest subchain links up with the local chain.
+func (s *skeleton) linked() (bool, error) {
+	cur := s.progress.Subchains[0]
+	if header := s.d.lightchain.GetHeaderByHash(cur.Next); header != nil && header.Number.Uint64() == cur.Tail-1 {
+		return true, nil
+	}
+	if cur.Tail <= 1 {
+		return false, errSkeletonGenesis
+	}
+	return false, nil
+}
+
+// assignTasks schedules the batches below the tail of the newest subchain and
+// requests the unassigned ones from the idle peers.
+func (s *skeleton) assignTasks() {
+	for len(s.batches) < scratchBatches {
+		from := s.progress.Subchains[0].Tail - 1
+		if n := len(s.batches); n > 0 {
+			from = s.batches[n-1].from - uint64(s.batches[n-1].count)
+		}
+		if from == 0 {
+			break
+		}
+		count := MaxHeaderFetch
+		if from < uint64(count) {
+			count = int(from)
+		}
+		s.batches = append(s.batches, &skeletonBatch{from: from, count: count})
+	}
+	idles, _ := s.d.peers.HeaderIdlePeers()
+	for _, batch := range s.batches {
+		if batch.peer != "" {
+			continue
+		}
+		for len(idles) > 0 && batch.peer == "" {
+			p := idles[0]
+			idles = idles[1:]
+
+			// Track the request before sending it, the reply may arrive immediately
+			req := &skeletonRequest{peer: p, batch: batch, done: s.syncDone}
+
+			s.lock.Lock()
+			if err := p.FetchHeadersBackwards(batch.from, batch.count); err != nil {
+				s.lock.Unlock()
+				continue
+			}
+			batch.peer = p.id
+			s.requests[p.id] = req
+			req.timer = time.AfterFunc(s.d.requestTTL(), func() { s.complete(req, nil) })
+			s.lock.Unlock()
+		}
+		if len(idles) == 0 {
+			break
+		}
+	}
+}
+
+// deliver hands a batch of headers to the skeleton syncer if they answer one of
+// its requests, returning whether they were taken.
+func (s *skeleton) deliver(id string, headers []*types.Header) bool {
+	s.lock.Lock()
+	req := s.requests[id]
+	s.lock.Unlock()
+
+	if req == nil || (len(headers) > 0 && headers[0].Number.Uint64() != req.batch.from) {
+		return false
+	}
+	s.complete(req, headers)
+	return true
+}
+
+// complete finishes a request with the delivered headers, or as timed out if
+// there are none, unless it's been finished already.
+func (s *skeleton) complete(req *skeletonRequest, headers []*types.Header) {
+	s.lock.Lock()
+	if s.requests[req.peer.id] != req {
+		s.lock.Unlock()
+		return
+	}
+	delete(s.requests, req.peer.id)
+	s.lock.Unlock()
+
+	ch := s.timeoutCh
+	if headers != nil {
+		req.timer.Stop()
+		req.headers, ch = headers, s.responseCh
+	}
+	select {
+	case ch <- req:
+	case <-req.done:
+		req.peer.SetHeadersIdle(0)
+	}
+}
+
+// processResponse checks the headers delivered for a batch, and if they're
+// valid, stores all the batches delivered contiguously below the tail.
+func (s *skeleton) processResponse(req *skeletonRequest) {
+	var (
+		batch   = req.batch
+		headers = req.headers
+	)
+	req.peer.SetHeadersIdle(len(headers))
+	if batch.dropped {
+		return
+	}
+	batch.peer = ""
+
+	if len(headers) == 0 {
+		req.peer.log.Trace("Skeleton headers not delivered", "from", batch.from)
+		return
+	}
+	valid := len(headers) == batch.count
+	for i := 0; valid && i < len(headers); i++ {
+		valid = headers[i].Number.Uint64() == batch.from-uint64(i)
+		if valid && i > 0 {
+			valid = headers[i-1].ParentHash == headers[i].Hash()
+		}
+	}
+	if !valid {
+		req.peer.log.Debug("Invalid skeleton headers delivered", "from", batch.from, "count", len(headers))
+		if req.peer.MarkInvalid() {
+			s.d.dropPeer(req.peer.id)
+		}
+		return
+	}
+	batch.peer, batch.headers = req.peer.id, headers
+
+	for len(s.batches) > 0 && s.batches[0].headers != nil {
+		batch := s.batches[0]
+		if cur := s.progress.Subchains[0]; batch.headers[0].Hash() != cur.Next {
+			log.Debug("Unlinked skeleton headers delivered", "peer", batch.peer, "number", batch.from, "hash", batch.headers[0].Hash(), "want", cur.Next)
+			s.d.dropPeer(batch.peer)
+			batch.peer, batch.headers = "", nil
+			return
+		}
+		s.batches = s.batches[1:]
+
+		if err := s.extend(batch.headers); err != nil {
+			log.Error("Failed to store skeleton headers", "err", err)
+			return
+		}
+	}
+}
+
+// extend stores a contiguous batch of headers below the tail of the newest
+// subchain, stopping early if it merges with an older one or links up with the
+// local chain.
+func (s *skeleton) extend(headers []*types.Header) error {
+	cur := s.progress.Subchains[0]
+
+	batch := s.d.stateDB.NewBatch()
+	for _, header := range headers {
+		if s.overlap(header) {
+			s.abandonBatches()
+			break
+		}
+		if err := writeSkeletonHeader(batch, header); err != nil {
+			return err
+		}
+		cur.Tail, cur.Next = header.Number.Uint64(), header.ParentHash
+
+		if s.d.lightchain.HasHeader(cur.Next) {
+			s.abandonBatches()
+			break
+		}
+	}
+	if err := writeSkeletonProgress(batch, s.progress); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Trace("Extended skeleton subchain", "head", cur.Head, "tail", cur.Tail, "subchains", len(s.progress.Subchains))
+	return nil
+}
+
+// abandonBatches discards the batches scheduled below the tail of the newest
+// subchain, leaving the requests still in flight to be ignored.
+func (s *skeleton) abandonBatches() {
+	for _, batch := range s.batches {
+		batch.dropped = true
+	}
+	s.batches = nil
+}
+
+// fill imports the next batch of headers of the newest subchain into the local
+// chain, returning whether the whole skeleton was imported.
+func (s *skeleton) fill() (bool, error) {
+	cur := s.progress.Subchains[0]
+
+	headers := make([]*types.Header, 0, MaxHeaderFetch)
+	for number := cur.Tail; number <= cur.Head && len(headers) < MaxHeaderFetch; number++ {
+		header := readSkeletonHeader(s.d.stateDB, number)
+		if header == nil {
+			s.wipe()
+			return false, errSkeletonMissing
+		}
+		headers = append(headers, header)
+	}
+	if n, err := s.d.lightchain.InsertHeaderChain(headers, fsHeaderCheckFrequency); err != nil {
+		log.Debug("Invalid skeleton header encountered", "number", headers[n].Number, "hash", headers[n].Hash(), "err", err)
+		s.wipe()
+		return false, errInvalidChain
+	}
+	for _, header := range headers {
+		s.d.stateDB.Delete(skeletonHeaderKey(header.Number.Uint64()))
+	}
+	last := headers[len(headers)-1]
+	cur.Tail, cur.Next = last.Number.Uint64()+1, last.Hash()
+
+	log.Debug("Imported skeleton headers", "count", len(headers), "number", last.Number, "hash", last.Hash())
+	if cur.Tail <= cur.Head {
+		return false, s.writeProgress()
+	}
+	// The newest subchain is imported, any older ones are stale forks
+	log.Info("Imported skeleton chain", "number", last.Number, "hash", last.Hash())
+	s.wipe()
+	return true, nil
+}
+
+// wipe deletes all the subchains from the database.
+func (s *skeleton) wipe() {
+	for _, chain := range s.progress.Subchains {
+		for number := chain.Tail; number <= chain.Head; number++ {
+			s.d.stateDB.Delete(skeletonHeaderKey(number))
+		}
+	}
+	s.progress = new(skeletonProgress)
+	s.abandonBatches()
+	s.d.stateDB.Delete(skeletonProgressKey)
+}
+
+// write stores a header of the skeleton along with the sync progress.
+func (s *skeleton) write(header *types.Header) error {
+	batch := s.d.stateDB.NewBatch()
+	if err := writeSkeletonHeader(batch, header); err != nil {
+		return err
+	}
+	if err := writeSkeletonProgress(batch, s.progress); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// writeProgress stores the sync progress.
+func (s *skeleton) writeProgress() error {
+	batch := s.d.stateDB.NewBatch()
+	if err := writeSkeletonProgress(batch, s.progress); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// skeletonHeaderKey = skeletonHeaderPrefix + num (uint64 big endian)
+func skeletonHeaderKey(number uint64) []byte {
+	enc := make([]byte, 8)
+	binary.BigEndian.PutUint64(enc, number)
+	return append(append([]byte{}, skeletonHeaderPrefix...), enc...)
+}
+
+// readSkeletonHeader retrieves a header of the skeleton chain, nil if it's not
+// stored.
+func readSkeletonHeader(db ethdb.Database, number uint64) *types.Header {
+	data, _ := db.Get(skeletonHeaderKey(number))
+	if len(data) == 0 {
+		return nil
+	}
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(data, header); err != nil {
+		log.Error("Invalid skeleton header RLP", "number", number, "err", err)
+		return nil
+	}
+	return header
+}
+
+// writeSkeletonHeader stores a header of the skeleton chain.
+func writeSkeletonHeader(db ethdb.Batch, header *types.Header) error {
+	data, err := rlp.EncodeToBytes(header)
+	if err != nil {
+		return err
+	}
+	return db.Put(skeletonHeaderKey(header.Number.Uint64()), data)
+}
+
+// readSkeletonProgress retrieves the progress of an interrupted skeleton sync,
+// or an empty one if there's none.
+func readSkeletonProgress(db ethdb.Database) *skeletonProgress {
+	progress := new(skeletonProgress)
+	if data, _ := db.Get(skeletonProgressKey); len(data) > 0 {
+		if err := rlp.DecodeBytes(data, progress); err != nil {
+			log.Error("Invalid skeleton sync progress RLP", "err", err)
+			return new(skeletonProgress)
+		}
+	}
+	return progress
+}
+
+// writeSkeletonProgress stores the progress of a skeleton sync.
+func writeSkeletonProgress(db ethdb.Batch, progress *skeletonProgress) error {
+	data, err := rlp.EncodeToBytes(progress)
+	if err != nil {
+		return err
+	}
+	return db.Put(skeletonProgressKey, data)
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/crypto/sha3"
+	"github.com/ethereum/go-ethereum/eth/snap"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/trie"
 )
@@ -185,7 +186,8 @@ func (d *Downloader) runStateSync(s *stateSync) *stateSync {
 // stateSync schedules requests for downloading a particular state trie defined
 // by a given state root.
 type stateSync struct {
-	d *Downloader // Downloader instance to access and manage current peerset
+	d    *Downloader // Downloader instance to access and manage current peerset
+	root common.Hash // State root being synced
 
 	sched  *state.StateSync           // State trie sync scheduler defining the tasks
 	keccak hash.Hash                  // Keccak256 hasher to verify deliveries with
@@ -209,6 +211,7 @@ type stateTask struct {
 func newStateSync(d *Downloader, root common.Hash) *stateSync {
 	return &stateSync{
 		d:       d,
+		root:    root,
 		sched:   state.NewStateSync(root, d.stateDB),
 		keccak:  sha3.NewKeccak256(),
 		tasks:   make(map[common.Hash]*stateTask),
@@ -221,8 +224,17 @@ func newStateSync(d *Downloader, root common.Hash) *stateSync {
 // run starts the task assignment and response processing loop, blocking until
 // it finishes, and finally notifying any goroutines waiting for the loop to
 // finish.
+//
+// If any peers speak the snap protocol, the state is retrieved from them instead
+// of node by node.
 func (s *stateSync) run() {
-	s.err = s.loop()
+	if s.d.SnapSyncer.Peers() > 0 {
+		if s.err = s.d.SnapSyncer.Sync(s.root, s.cancel); s.err == snap.ErrCancelled {
+			s.err = errCancelStateFetch
+		}
+	} else {
+		s.err = s.loop()
+	}
 	close(s.done)
 }
 
@@ -271,6 +283,9 @@ func (s *stateSync) loop() error {
 				// this peer at the moment.
 				log.Warn("Stalling state sync, dropping peer", "peer", req.peer.id)
 				s.d.dropPeer(req.peer.id)
+			} else if req.timedOut() && req.peer.MarkTimeout() {
+				log.Warn("Consistently timing out state sync, dropping peer", "peer", req.peer.id)
+				s.d.dropPeer(req.peer.id)
 			}
 			// Process all the received blobs and check for stale delivery
 			stale, err := s.process(req)
@@ -36,6 +36,7 @@ const (
 	maxUncleDist  = 7                      // Maximum allowed backward distance from the chain head
 	maxQueueDist  = 32                     // Maximum allowed distance from the chain head to queue
 	hashLimit     = 256                    // Maximum number of unique blocks a peer may have announced
+	announceLimit = 4096                   // Maximum number of announcements tracked across all peers
 	blockLimit    = 64                     // Maximum number of unique blocks a peer may have delivered
 )
 
@@ -83,6 +84,7 @@ type announce struct {
 
 // headerFilterTask represents a batch of headers needing fetcher filtering.
 type headerFilterTask struct {
+	peer    string          // The source peer of block headers
 	headers []*types.Header // Collection of headers to filter
 	time    time.Time       // Arrival time of the headers
 }
@@ -90,6 +92,7 @@ type headerFilterTask struct {
 // headerFilterTask represents a batch of block bodies (transactions and uncles)
 // needing fetcher filtering.
 type bodyFilterTask struct {
+	peer         string                 // The source peer of block bodies
 	transactions [][]*types.Transaction // Collection of transactions per block bodies
 	uncles       [][]*types.Header      // Collection of uncles per block bodies
 	time         time.Time              // Arrival time of the blocks' contents
@@ -216,10 +219,10 @@ func (f *Fetcher) Enqueue(peer string, block *types.Block) error {
 	}
 }
 
-// FilterHeaders extracts all the headers that were explicitly requested by the fetcher,
-// returning those that should be handled differently.
-func (f *Fetcher) FilterHeaders(headers []*types.Header, time time.Time) []*types.Header {
-	log.Trace("Filtering headers", "headers", len(headers))
+// FilterHeaders extracts all the headers that were explicitly requested by the fetcher
+// from the given peer, returning those that should be handled differently.
+func (f *Fetcher) FilterHeaders(peer string, headers []*types.Header, time time.Time) []*types.Header {
+	log.Trace("Filtering headers", "peer", peer, "headers", len(headers))
 
 	// Send the filter channel to the fetcher
 	filter := make(chan *headerFilterTask)
@@ -231,7 +234,7 @@ func (f *Fetcher) FilterHeaders(headers []*types.Header, time time.Time) []*type
 	}
 	// Request the filtering of the header list
 	select {
-	case filter <- &headerFilterTask{headers: headers, time: time}:
+	case filter <- &headerFilterTask{peer: peer, headers: headers, time: time}:
 	case <-f.quit:
 		return nil
 	}
@@ -245,9 +248,10 @@ func (f *Fetcher) FilterHeaders(headers []*types.Header, time time.Time) []*type
 }
 
 // FilterBodies extracts all the block bodies that were explicitly requested by
-// the fetcher, returning those that should be handled differently.
-func (f *Fetcher) FilterBodies(transactions [][]*types.Transaction, uncles [][]*types.Header, time time.Time) ([][]*types.Transaction, [][]*types.Header) {
-	log.Trace("Filtering bodies", "txs", len(transactions), "uncles", len(uncles))
+// the fetcher from the given peer, returning those that should be handled
+// differently.
+func (f *Fetcher) FilterBodies(peer string, transactions [][]*types.Transaction, uncles [][]*types.Header, time time.Time) ([][]*types.Transaction, [][]*types.Header) {
+	log.Trace("Filtering bodies", "peer", peer, "txs", len(transactions), "uncles", len(uncles))
 
 	// Send the filter channel to the fetcher
 	filter := make(chan *bodyFilterTask)
@@ -259,7 +263,7 @@ func (f *Fetcher) FilterBodies(transactions [][]*types.Transaction, uncles [][]*
 	}
 	// Request the filtering of the body list
 	select {
-	case filter <- &bodyFilterTask{transactions: transactions, uncles: uncles, time: time}:
+	case filter <- &bodyFilterTask{peer: peer, transactions: transactions, uncles: uncles, time: time}:
 	case <-f.quit:
 		return nil, nil
 	}
@@ -324,6 +328,8 @@ func (f *Fetcher) loop() {
 			if count > hashLimit {
 				log.Debug("Peer exceeded outstanding announces", "peer", notification.origin, "limit", hashLimit)
 				propAnnounceDOSMeter.Mark(1)
+				propPeerDropMeter.Mark(1)
+				f.dropPeer(notification.origin)
 				break
 			}
 			// If we have a valid block number, check that it's potentially useful
@@ -341,6 +347,12 @@ func (f *Fetcher) loop() {
 			if _, ok := f.completing[notification.hash]; ok {
 				break
 			}
+			// Make room for the announcement if too many are tracked across all peers
+			if f.announceCount() >= announceLimit && !f.evictAnnounce() {
+				log.Debug("Discarded announcement, too many outstanding", "peer", notification.origin, "limit", announceLimit)
+				propAnnounceDOSMeter.Mark(1)
+				break
+			}
 			f.announces[notification.origin] = count
 			f.announced[notification.hash] = append(f.announced[notification.hash], notification)
 			if f.announceChangeHook != nil && len(f.announced[notification.hash]) == 1 {
@@ -444,7 +456,7 @@ func (f *Fetcher) loop() {
 				hash := header.Hash()
 
 				// Filter fetcher-requested headers from other synchronisation algorithms
-				if announce := f.fetching[hash]; announce != nil && f.fetched[hash] == nil && f.completing[hash] == nil && f.queued[hash] == nil {
+				if announce := f.fetching[hash]; announce != nil && announce.origin == task.peer && f.fetched[hash] == nil && f.completing[hash] == nil && f.queued[hash] == nil {
 					// If the delivered header does not match the promised number, drop the announcer
 					if header.Number.Uint64() != announce.number {
 						log.Trace("Invalid block number fetched", "peer", announce.origin, "hash", header.Hash(), "announced", announce.number, "provided", header.Number)
@@ -519,7 +531,7 @@ func (f *Fetcher) loop() {
 				matched := false
 
 				for hash, announce := range f.completing {
-					if f.queued[hash] == nil {
+					if f.queued[hash] == nil && announce.origin == task.peer {
 						txnHash := types.DeriveSha(types.Transactions(task.transactions[i]))
 						uncleHash := types.CalcUncleHash(task.uncles[i])
 
@@ -594,6 +606,42 @@ func (f *Fetcher) rescheduleComplete(complete *time.Timer) {
 	complete.Reset(gatherSlack - time.Since(earliest))
 }
 
+// announceCount returns the total number of announcements tracked across all
+// peers, in any stage of the retrieval.
+func (f *Fetcher) announceCount() int {
+	count := 0
+	for _, announces := range f.announces {
+		count += announces
+	}
+	return count
+}
+
+// evictAnnounce drops a random announcement that is not yet being fetched to make
+// room for new ones. It returns false if there was nothing to evict.
+func (f *Fetcher) evictAnnounce() bool {
+	for hash, announces := range f.announced {
+		i := rand.Intn(len(announces))
+		announce := announces[i]
+
+		f.announces[announce.origin]--
+		if f.announces[announce.origin] == 0 {
+			delete(f.announces, announce.origin)
+		}
+		if len(announces) == 1 {
+			delete(f.announced, hash)
+			if f.announceChangeHook != nil {
+				f.announceChangeHook(hash, false)
+			}
+		} else {
+			f.announced[hash] = append(announces[:i], announces[i+1:]...)
+		}
+		log.Trace("Evicted announcement", "peer", announce.origin, "number", announce.number, "hash", hash)
+		propAnnounceEvictMeter.Mark(1)
+		return true
+	}
+	return false
+}
+
 // enqueue schedules a new future import operation, if the block to be imported
 // has not yet been seen.
 func (f *Fetcher) enqueue(peer string, block *types.Block) {
@@ -604,6 +652,8 @@ func (f *Fetcher) enqueue(peer string, block *types.Block) {
 	if count > blockLimit {
 		log.Debug("Discarded propagated block, exceeded allowance", "peer", peer, "number", block.Number(), "hash", hash, "limit", blockLimit)
 		propBroadcastDOSMeter.Mark(1)
+		propPeerDropMeter.Mark(1)
+		f.dropPeer(peer)
 		f.forgetHash(hash)
 		return
 	}
@@ -23,16 +23,19 @@ import (
 )
 
 var (
-	propAnnounceInMeter   = metrics.NewMeter("eth/fetcher/prop/announces/in")
-	propAnnounceOutTimer  = metrics.NewTimer("eth/fetcher/prop/announces/out")
-	propAnnounceDropMeter = metrics.NewMeter("eth/fetcher/prop/announces/drop")
-	propAnnounceDOSMeter  = metrics.NewMeter("eth/fetcher/prop/announces/dos")
+	propAnnounceInMeter    = metrics.NewMeter("eth/fetcher/prop/announces/in")
+	propAnnounceOutTimer   = metrics.NewTimer("eth/fetcher/prop/announces/out")
+	propAnnounceDropMeter  = metrics.NewMeter("eth/fetcher/prop/announces/drop")
+	propAnnounceDOSMeter   = metrics.NewMeter("eth/fetcher/prop/announces/dos")
+	propAnnounceEvictMeter = metrics.NewMeter("eth/fetcher/prop/announces/evict")
 
 	propBroadcastInMeter   = metrics.NewMeter("eth/fetcher/prop/broadcasts/in")
 	propBroadcastOutTimer  = metrics.NewTimer("eth/fetcher/prop/broadcasts/out")
 	propBroadcastDropMeter = metrics.NewMeter("eth/fetcher/prop/broadcasts/drop")
 	propBroadcastDOSMeter  = metrics.NewMeter("eth/fetcher/prop/broadcasts/dos")
 
+	propPeerDropMeter = metrics.NewMeter("eth/fetcher/prop/peers/drop")
+
 	headerFetchMeter = metrics.NewMeter("eth/fetcher/fetch/headers")
 	bodyFetchMeter   = metrics.NewMeter("eth/fetcher/fetch/bodies")
 
@@ -40,4 +43,15 @@ var (
 	headerFilterOutMeter = metrics.NewMeter("eth/fetcher/filter/headers/out")
 	bodyFilterInMeter    = metrics.NewMeter("eth/fetcher/filter/bodies/in")
 	bodyFilterOutMeter   = metrics.NewMeter("eth/fetcher/filter/bodies/out")
+
+	txAnnounceInMeter    = metrics.NewMeter("eth/fetcher/tx/announces/in")
+	txAnnounceKnownMeter = metrics.NewMeter("eth/fetcher/tx/announces/known")
+	txAnnounceDOSMeter   = metrics.NewMeter("eth/fetcher/tx/announces/dos")
+
+	txBroadcastInMeter = metrics.NewMeter("eth/fetcher/tx/broadcasts/in")
+	txReplyInMeter     = metrics.NewMeter("eth/fetcher/tx/replies/in")
+
+	txRequestOutMeter     = metrics.NewMeter("eth/fetcher/tx/request/out")
+	txRequestFailMeter    = metrics.NewMeter("eth/fetcher/tx/request/fail")
+	txRequestTimeoutMeter = metrics.NewMeter("eth/fetcher/tx/request/timeout")
 )
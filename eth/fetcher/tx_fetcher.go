@@ -0,0 +1,419 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package fetcher
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	txArriveTimeout = 500 * time.Millisecond // Time allowance before an announced transaction is explicitly requested
+	txFetchTimeout  = 5 * time.Second        // Maximum allotted time to return an explicitly requested transaction
+	maxTxAnnounces  = 4096                   // Maximum number of unique transactions a peer may have announced
+	maxTxRetrievals = 256                    // Maximum number of transactions to request from a peer in one go
+)
+
+// txKnownFn is a callback type for checking whether a transaction is already
+// known to the local transaction pool.
+type txKnownFn func(common.Hash) bool
+
+// txInsertFn is a callback type to insert a batch of transactions into the
+// local transaction pool.
+type txInsertFn func([]*types.Transaction) error
+
+// txRequesterFn is a callback type for sending a transaction retrieval request.
+type txRequesterFn func(peer string, hashes []common.Hash) error
+
+// txAnnounce is the notification of the availability of a batch of new
+// transactions in the network.
+type txAnnounce struct {
+	origin string        // Identifier of the peer originating the notification
+	hashes []common.Hash // Batch of transaction hashes being announced
+}
+
+// txDelivery is the notification that a batch of transactions have been added
+// to the pool and should be untracked.
+type txDelivery struct {
+	origin string        // Identifier of the peer originating the delivery
+	hashes []common.Hash // Batch of transaction hashes having been delivered
+	direct bool          // Whether this is a direct reply or a broadcast
+}
+
+// txRequest represents an in-flight transaction retrieval request destined to
+// a specific peer.
+type txRequest struct {
+	hashes []common.Hash // Transactions having been requested
+	time   time.Time     // Timestamp of the request
+}
+
+// TxFetcher is responsible for accumulating transaction announcements from
+// various peers and scheduling them for retrieval. Announced transactions are
+// first given some time to arrive via regular broadcasts, and are only fetched
+// explicitly if they are still missing afterwards.
+type TxFetcher struct {
+	// Various event channels
+	notify  chan *txAnnounce
+	cleanup chan *txDelivery
+	drop    chan string
+	quit    chan struct{}
+
+	// Announce states
+	waitlist  map[common.Hash]map[string]struct{} // Transactions waiting for a broadcast, with their announcers
+	waittime  map[common.Hash]time.Time           // Timestamps when the waiting transactions were first announced
+	announced map[common.Hash]map[string]struct{} // Transactions scheduled for fetching, with their announcers
+	announces map[string]map[common.Hash]struct{} // Per peer announce sets to dedup and prevent memory exhaustion
+	fetching  map[common.Hash]string              // Transactions currently fetching, with the peer asked
+	requests  map[string]*txRequest               // In-flight transaction retrievals per peer
+
+	// Callbacks
+	hasTx    txKnownFn     // Checks whether a transaction is already in the pool
+	addTxs   txInsertFn    // Injects a batch of transactions into the pool
+	fetchTxs txRequesterFn // Retrieves a batch of transactions from a remote peer
+}
+
+// NewTxFetcher creates a transaction fetcher to retrieve transactions based on
+// hash announcements.
+func NewTxFetcher(hasTx txKnownFn, addTxs txInsertFn, fetchTxs txRequesterFn) *TxFetcher {
+	return &TxFetcher{
+		notify:    make(chan *txAnnounce),
+		cleanup:   make(chan *txDelivery),
+		drop:      make(chan string),
+		quit:      make(chan struct{}),
+		waitlist:  make(map[common.Hash]map[string]struct{}),
+		waittime:  make(map[common.Hash]time.Time),
+		announced: make(map[common.Hash]map[string]struct{}),
+		announces: make(map[string]map[common.Hash]struct{}),
+		fetching:  make(map[common.Hash]string),
+		requests:  make(map[string]*txRequest),
+		hasTx:     hasTx,
+		addTxs:    addTxs,
+		fetchTxs:  fetchTxs,
+	}
+}
+
+// Start boots up the announcement based transaction retriever, accepting and
+// processing hash notifications and deliveries until termination requested.
+func (f *TxFetcher) Start() {
+	go f.loop()
+}
+
+// Stop terminates the announcement based transaction retriever, canceling all
+// pending operations.
+func (f *TxFetcher) Stop() {
+	close(f.quit)
+}
+
+// Notify announces the fetcher of the potential availability of a batch of new
+// transactions in the network.
+func (f *TxFetcher) Notify(peer string, hashes []common.Hash) error {
+	txAnnounceInMeter.Mark(int64(len(hashes)))
+
+	// Skip any transaction announcements that we already know of
+	unknown := make([]common.Hash, 0, len(hashes))
+	for _, hash := range hashes {
+		if !f.hasTx(hash) {
+			unknown = append(unknown, hash)
+		}
+	}
+	txAnnounceKnownMeter.Mark(int64(len(hashes) - len(unknown)))
+	if len(unknown) == 0 {
+		return nil
+	}
+	select {
+	case f.notify <- &txAnnounce{origin: peer, hashes: unknown}:
+		return nil
+	case <-f.quit:
+		return errTerminated
+	}
+}
+
+// Enqueue imports a batch of received transactions into the transaction pool
+// and notifies the fetcher to stop tracking them. The direct flag signals that
+// the batch is a reply to an explicit request, in which case any requested but
+// missing transactions are considered unavailable at the origin.
+func (f *TxFetcher) Enqueue(peer string, txs []*types.Transaction, direct bool) error {
+	if direct {
+		txReplyInMeter.Mark(int64(len(txs)))
+	} else {
+		txBroadcastInMeter.Mark(int64(len(txs)))
+	}
+	hashes := make([]common.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash()
+	}
+	if err := f.addTxs(txs); err != nil {
+		log.Trace("Failed to import some transactions", "peer", peer, "err", err)
+	}
+	select {
+	case f.cleanup <- &txDelivery{origin: peer, hashes: hashes, direct: direct}:
+		return nil
+	case <-f.quit:
+		return errTerminated
+	}
+}
+
+// Drop should be called when a peer disconnects. It cleans up all the internal
+// data structures of the given node and reschedules its pending retrievals.
+func (f *TxFetcher) Drop(peer string) error {
+	select {
+	case f.drop <- peer:
+		return nil
+	case <-f.quit:
+		return errTerminated
+	}
+}
+
+// Loop is the main fetcher loop, checking and processing various notification
+// events.
+func (f *TxFetcher) loop() {
+	waitTimer := time.NewTimer(0)
+	timeoutTimer := time.NewTimer(0)
+
+	for {
+		select {
+		case <-f.quit:
+			// Fetcher terminating, abort all operations
+			return
+
+		case ann := <-f.notify:
+			// A batch of transactions was announced, track the ones not yet seen
+			idle := len(f.waittime) == 0
+
+			for i, hash := range ann.hashes {
+				if _, ok := f.announces[ann.origin][hash]; ok {
+					continue
+				}
+				// Make sure the peer isn't DOSing us with announcements
+				if len(f.announces[ann.origin]) >= maxTxAnnounces {
+					log.Debug("Peer exceeded outstanding announces", "peer", ann.origin, "limit", maxTxAnnounces)
+					txAnnounceDOSMeter.Mark(int64(len(ann.hashes) - i))
+					break
+				}
+				if f.announces[ann.origin] == nil {
+					f.announces[ann.origin] = make(map[common.Hash]struct{})
+				}
+				f.announces[ann.origin][hash] = struct{}{}
+
+				// If the transaction is already tracked, add the peer as an alternate source
+				if announcers := f.announced[hash]; announcers != nil {
+					announcers[ann.origin] = struct{}{}
+					continue
+				}
+				if announcers := f.waitlist[hash]; announcers != nil {
+					announcers[ann.origin] = struct{}{}
+					continue
+				}
+				// Otherwise give the transaction some time to arrive via broadcast
+				f.waitlist[hash] = map[string]struct{}{ann.origin: {}}
+				f.waittime[hash] = time.Now()
+			}
+			if idle {
+				f.rescheduleWait(waitTimer)
+			}
+			// New alternates might allow idle peers to pick up queued retrievals
+			f.scheduleFetches(timeoutTimer)
+
+		case delivery := <-f.cleanup:
+			// A batch of transactions was imported, remove all traces of them
+			for _, hash := range delivery.hashes {
+				f.forgetHash(hash)
+			}
+			// If it was a reply, anything not delivered is unavailable at the origin
+			if delivery.direct {
+				if req := f.requests[delivery.origin]; req != nil {
+					for _, hash := range req.hashes {
+						if f.fetching[hash] == delivery.origin {
+							delete(f.fetching, hash)
+							f.forgetAnnounce(delivery.origin, hash)
+						}
+					}
+					delete(f.requests, delivery.origin)
+				}
+			}
+			f.scheduleFetches(timeoutTimer)
+
+		case peer := <-f.drop:
+			// A peer disconnected, release its announcements and retrievals
+			for hash := range f.announces[peer] {
+				if f.fetching[hash] == peer {
+					delete(f.fetching, hash)
+				}
+				f.forgetAnnounce(peer, hash)
+			}
+			delete(f.requests, peer)
+
+			f.scheduleFetches(timeoutTimer)
+
+		case <-waitTimer.C:
+			// At least one transaction's wait ran out, queue it for retrieval
+			for hash, waittime := range f.waittime {
+				if time.Since(waittime) > txArriveTimeout-gatherSlack {
+					announcers := f.waitlist[hash]
+					delete(f.waitlist, hash)
+					delete(f.waittime, hash)
+
+					f.announced[hash] = announcers
+					if f.hasTx(hash) {
+						f.forgetHash(hash)
+					}
+				}
+			}
+			f.rescheduleWait(waitTimer)
+			f.scheduleFetches(timeoutTimer)
+
+		case <-timeoutTimer.C:
+			// At least one request's timer ran out, reschedule to alternate peers
+			for peer, req := range f.requests {
+				if time.Since(req.time) > txFetchTimeout-gatherSlack {
+					log.Debug("Transaction retrieval timed out", "peer", peer, "count", len(req.hashes))
+					txRequestTimeoutMeter.Mark(int64(len(req.hashes)))
+
+					for _, hash := range req.hashes {
+						if f.fetching[hash] == peer {
+							delete(f.fetching, hash)
+							f.forgetAnnounce(peer, hash)
+						}
+					}
+					delete(f.requests, peer)
+				}
+			}
+			f.rescheduleTimeout(timeoutTimer)
+			f.scheduleFetches(timeoutTimer)
+		}
+	}
+}
+
+// scheduleFetches assigns queued transactions to idle peers that announced
+// them and sends out the retrieval requests.
+func (f *TxFetcher) scheduleFetches(timeout *time.Timer) {
+	idle := len(f.requests) == 0
+
+	for peer, hashes := range f.announces {
+		if f.requests[peer] != nil {
+			continue
+		}
+		var batch []common.Hash
+		for hash := range hashes {
+			if f.announced[hash] == nil {
+				continue // Still waiting for a broadcast
+			}
+			if _, ok := f.fetching[hash]; ok {
+				continue // Already requested from someone else
+			}
+			batch = append(batch, hash)
+			if len(batch) >= maxTxRetrievals {
+				break
+			}
+		}
+		if len(batch) == 0 {
+			continue
+		}
+		for _, hash := range batch {
+			f.fetching[hash] = peer
+		}
+		f.requests[peer] = &txRequest{hashes: batch, time: time.Now()}
+
+		log.Trace("Fetching scheduled transactions", "peer", peer, "count", len(batch))
+		txRequestOutMeter.Mark(int64(len(batch)))
+
+		// Create a closure of the fetch and schedule in on a new thread
+		peer, batch := peer, batch
+		go func() {
+			if err := f.fetchTxs(peer, batch); err != nil {
+				log.Debug("Failed to request transactions", "peer", peer, "err", err)
+				txRequestFailMeter.Mark(int64(len(batch)))
+				f.Drop(peer)
+			}
+		}()
+	}
+	if idle && len(f.requests) > 0 {
+		f.rescheduleTimeout(timeout)
+	}
+}
+
+// rescheduleWait resets the specified wait timer to the next announce timeout.
+func (f *TxFetcher) rescheduleWait(wait *time.Timer) {
+	// Short circuit if no transactions are waiting
+	if len(f.waittime) == 0 {
+		return
+	}
+	// Otherwise find the earliest expiring announcement
+	earliest := time.Now()
+	for _, waittime := range f.waittime {
+		if earliest.After(waittime) {
+			earliest = waittime
+		}
+	}
+	wait.Reset(txArriveTimeout - time.Since(earliest))
+}
+
+// rescheduleTimeout resets the specified timeout timer to the next request
+// timeout.
+func (f *TxFetcher) rescheduleTimeout(timeout *time.Timer) {
+	// Short circuit if no transactions are being retrieved
+	if len(f.requests) == 0 {
+		return
+	}
+	// Otherwise find the earliest expiring request
+	earliest := time.Now()
+	for _, req := range f.requests {
+		if earliest.After(req.time) {
+			earliest = req.time
+		}
+	}
+	timeout.Reset(txFetchTimeout - time.Since(earliest))
+}
+
+// forgetAnnounce removes a single peer from the set of sources of a tracked
+// transaction, dropping the transaction altogether if no source remains.
+func (f *TxFetcher) forgetAnnounce(peer string, hash common.Hash) {
+	if hashes := f.announces[peer]; hashes != nil {
+		delete(hashes, hash)
+		if len(hashes) == 0 {
+			delete(f.announces, peer)
+		}
+	}
+	if announcers := f.waitlist[hash]; announcers != nil {
+		delete(announcers, peer)
+		if len(announcers) == 0 {
+			delete(f.waitlist, hash)
+			delete(f.waittime, hash)
+		}
+	}
+	if announcers := f.announced[hash]; announcers != nil {
+		delete(announcers, peer)
+		if len(announcers) == 0 {
+			delete(f.announced, hash)
+		}
+	}
+}
+
+// forgetHash removes all traces of a transaction announcement from the fetcher's
+// internal state.
+func (f *TxFetcher) forgetHash(hash common.Hash) {
+	for peer := range f.waitlist[hash] {
+		f.forgetAnnounce(peer, hash)
+	}
+	for peer := range f.announced[hash] {
+		f.forgetAnnounce(peer, hash)
+	}
+	delete(f.fetching, hash)
+}
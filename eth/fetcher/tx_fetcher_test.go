@@ -0,0 +1,258 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package fetcher
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// txRetrieval is a transaction retrieval request issued by the fetcher.
+type txRetrieval struct {
+	peer   string
+	hashes []common.Hash
+}
+
+// txFetcherTester is a test simulator for mocking out the local transaction
+// pool and the remote peers.
+type txFetcherTester struct {
+	fetcher *TxFetcher
+
+	pool     map[common.Hash]*types.Transaction // Transactions added to the pool
+	requests chan *txRetrieval                  // Retrieval requests issued by the fetcher
+	lock     sync.RWMutex
+}
+
+// newTxTester creates a new transaction fetcher test mocker.
+func newTxTester() *txFetcherTester {
+	tester := &txFetcherTester{
+		pool:     make(map[common.Hash]*types.Transaction),
+		requests: make(chan *txRetrieval, 1024),
+	}
+	tester.fetcher = NewTxFetcher(tester.hasTx, tester.addTxs, tester.fetchTxs)
+	tester.fetcher.Start()
+
+	return tester
+}
+
+// hasTx checks whether a transaction is known to the tester's pool.
+func (f *txFetcherTester) hasTx(hash common.Hash) bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return f.pool[hash] != nil
+}
+
+// addTxs injects a batch of transactions into the tester's pool.
+func (f *txFetcherTester) addTxs(txs []*types.Transaction) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, tx := range txs {
+		f.pool[tx.Hash()] = tx
+	}
+	return nil
+}
+
+// fetchTxs records a retrieval request issued by the fetcher.
+func (f *txFetcherTester) fetchTxs(peer string, hashes []common.Hash) error {
+	f.requests <- &txRetrieval{peer: peer, hashes: hashes}
+	return nil
+}
+
+// makeTxs creates a batch of distinct transactions for announcing.
+func makeTxs(n int) []*types.Transaction {
+	txs := make([]*types.Transaction, n)
+	for i := range txs {
+		txs[i] = types.NewTransaction(uint64(i), common.Address{}, big.NewInt(0), big.NewInt(21000), big.NewInt(0), nil)
+	}
+	return txs
+}
+
+// txHashes extracts the hashes of a batch of transactions.
+func txHashes(txs []*types.Transaction) []common.Hash {
+	hashes := make([]common.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash()
+	}
+	return hashes
+}
+
+// verifyTxRetrieval waits for a retrieval request to be issued by the fetcher.
+func verifyTxRetrieval(t *testing.T, requests chan *txRetrieval) *txRetrieval {
+	select {
+	case req := <-requests:
+		return req
+	case <-time.After(txArriveTimeout + time.Second):
+		t.Fatalf("retrieval timeout")
+	}
+	return nil
+}
+
+// verifyNoTxRetrieval checks that no retrieval request is issued by the fetcher
+// within the arrival timeout.
+func verifyNoTxRetrieval(t *testing.T, requests chan *txRetrieval) {
+	select {
+	case req := <-requests:
+		t.Fatalf("unexpected retrieval: peer %s, hashes %v", req.peer, req.hashes)
+	case <-time.After(txArriveTimeout + 200*time.Millisecond):
+	}
+}
+
+// Tests that announced transactions are retrieved from the announcer if they
+// don't arrive via broadcast in time.
+func TestTxFetcherRetrieval(t *testing.T) {
+	tester := newTxTester()
+	defer tester.fetcher.Stop()
+
+	txs := makeTxs(4)
+	tester.fetcher.Notify("peer", txHashes(txs))
+
+	req := verifyTxRetrieval(t, tester.requests)
+	if req.peer != "peer" || len(req.hashes) != len(txs) {
+		t.Fatalf("retrieval mismatch: have %s/%d, want %s/%d", req.peer, len(req.hashes), "peer", len(txs))
+	}
+	tester.fetcher.Enqueue("peer", txs, true)
+	for _, tx := range txs {
+		if !tester.hasTx(tx.Hash()) {
+			t.Errorf("transaction %x not added to the pool", tx.Hash())
+		}
+	}
+	verifyNoTxRetrieval(t, tester.requests)
+}
+
+// Tests that announced transactions arriving via broadcast before the wait
+// expires are not retrieved explicitly.
+func TestTxFetcherBroadcastArrival(t *testing.T) {
+	tester := newTxTester()
+	defer tester.fetcher.Stop()
+
+	txs := makeTxs(4)
+	tester.fetcher.Notify("announcer", txHashes(txs))
+	tester.fetcher.Enqueue("broadcaster", txs, false)
+
+	verifyNoTxRetrieval(t, tester.requests)
+}
+
+// Tests that announcements of transactions already in the pool are ignored.
+func TestTxFetcherKnownAnnouncement(t *testing.T) {
+	tester := newTxTester()
+	defer tester.fetcher.Stop()
+
+	txs := makeTxs(4)
+	tester.addTxs(txs)
+	tester.fetcher.Notify("peer", txHashes(txs))
+
+	verifyNoTxRetrieval(t, tester.requests)
+}
+
+// Tests that transactions announced by multiple peers are only retrieved once.
+func TestTxFetcherDeduplication(t *testing.T) {
+	tester := newTxTester()
+	defer tester.fetcher.Stop()
+
+	txs := makeTxs(4)
+	for _, peer := range []string{"peer #1", "peer #2", "peer #3"} {
+		tester.fetcher.Notify(peer, txHashes(txs))
+	}
+	fetched := make(map[common.Hash]int)
+	for len(fetched) < len(txs) {
+		req := verifyTxRetrieval(t, tester.requests)
+		for _, hash := range req.hashes {
+			fetched[hash]++
+		}
+	}
+	for hash, count := range fetched {
+		if count != 1 {
+			t.Errorf("transaction %x retrieved %d times, want 1", hash, count)
+		}
+	}
+	verifyNoTxRetrieval(t, tester.requests)
+}
+
+// Tests that transactions not delivered by the requested peer are retrieved
+// from alternate announcers.
+func TestTxFetcherMissingRetry(t *testing.T) {
+	tester := newTxTester()
+	defer tester.fetcher.Stop()
+
+	txs := makeTxs(1)
+	tester.fetcher.Notify("peer #1", txHashes(txs))
+	tester.fetcher.Notify("peer #2", txHashes(txs))
+
+	first := verifyTxRetrieval(t, tester.requests)
+	tester.fetcher.Enqueue(first.peer, nil, true)
+
+	second := verifyTxRetrieval(t, tester.requests)
+	if second.peer == first.peer {
+		t.Fatalf("retried from the same peer: %s", second.peer)
+	}
+	tester.fetcher.Enqueue(second.peer, txs, true)
+	verifyNoTxRetrieval(t, tester.requests)
+}
+
+// Tests that retrievals from disconnecting peers are rescheduled to alternate
+// announcers.
+func TestTxFetcherDropRetry(t *testing.T) {
+	tester := newTxTester()
+	defer tester.fetcher.Stop()
+
+	txs := makeTxs(1)
+	tester.fetcher.Notify("peer #1", txHashes(txs))
+	tester.fetcher.Notify("peer #2", txHashes(txs))
+
+	first := verifyTxRetrieval(t, tester.requests)
+	tester.fetcher.Drop(first.peer)
+
+	second := verifyTxRetrieval(t, tester.requests)
+	if second.peer == first.peer {
+		t.Fatalf("retried from the dropped peer: %s", second.peer)
+	}
+}
+
+// Tests that a peer cannot announce more transactions than the fetcher is
+// willing to track, and that retrievals are capped in size.
+func TestTxFetcherAnnounceLimit(t *testing.T) {
+	tester := newTxTester()
+	defer tester.fetcher.Stop()
+
+	txs := makeTxs(maxTxAnnounces + 100)
+	tester.fetcher.Notify("attacker", txHashes(txs))
+
+	// Reply to all requests empty-handed, collecting the requested hashes
+	fetched := make(map[common.Hash]struct{})
+	for len(fetched) < maxTxAnnounces {
+		req := verifyTxRetrieval(t, tester.requests)
+		if len(req.hashes) > maxTxRetrievals {
+			t.Fatalf("retrieval too large: have %d, want <= %d", len(req.hashes), maxTxRetrievals)
+		}
+		for _, hash := range req.hashes {
+			fetched[hash] = struct{}{}
+		}
+		tester.fetcher.Enqueue(req.peer, nil, true)
+	}
+	verifyNoTxRetrieval(t, tester.requests)
+
+	if len(fetched) != maxTxAnnounces {
+		t.Errorf("tracked announcement count mismatch: have %d, want %d", len(fetched), maxTxAnnounces)
+	}
+}
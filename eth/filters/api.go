@@ -30,46 +30,75 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
-var (
-	deadline = 5 * time.Minute // consider a filter inactive if it has not been polled for within deadline
-)
+// defaultFilterTimeout is the time after which filters not polled anymore are
+// uninstalled, if no valid timeout is configured.
+const defaultFilterTimeout = 5 * time.Minute
+
+// Config holds the settings of the filter API.
+type Config struct {
+	Timeout     time.Duration // Time after which filters not polled anymore are uninstalled
+	RangeLimit  uint64        // Maximum number of blocks searched by a log query (0 = no limit)
+	ResultLimit int           // Maximum number of logs returned by a log query (0 = no limit)
+}
 
 // filter is a helper struct that holds meta information over the filter type
-// and associated subscription in the event system.
+// and associated subscriptions in the event system.
+//
+// Block and pending transaction filters, as well as pending logs, accumulate
+// the events until polled. Mined logs are not buffered: polls search the blocks
+// imported since the previous one through the bloombits index, with the log
+// subscription only used to detect reorgs and report the removed logs.
 type filter struct {
 	typ      Type
-	deadline *time.Timer // filter is inactiv when deadline triggers
-	hashes   []common.Hash
+	deadline *time.Timer // filter is inactive when deadline triggers
 	crit     FilterCriteria
-	logs     []*types.Log
-	s        *Subscription // associated subscription in event system
+	subs     []*Subscription // associated subscriptions in event system
+	done     chan struct{}   // closed when the filter is uninstalled
+
+	headers chan *types.Header
+	txs     chan []*types.Transaction
+	mined   chan []*types.Log
+	pending chan []*types.Log
+
+	hashes  []common.Hash // block or transaction hashes not yet polled
+	removed []*types.Log  // mined logs removed by reorgs, not yet polled
+	logs    []*types.Log  // pending logs not yet polled
+
+	pollMu  sync.Mutex // serializes the searches of mined logs
+	next    uint64     // first block not yet searched for mined logs
+	rewound bool       // whether next was rewound during the last search
 }
 
 // PublicFilterAPI offers support to create and manage filters. This will allow external clients to retrieve various
 // information related to the Ethereum protocol such als blocks, transactions and logs.
 type PublicFilterAPI struct {
 	backend   Backend
-	useMipMap bool
 	mux       *event.TypeMux
 	quit      chan struct{}
 	chainDb   ethdb.Database
 	events    *EventSystem
+	config    Config
 	filtersMu sync.Mutex
 	filters   map[rpc.ID]*filter
 }
 
-// NewPublicFilterAPI returns a new PublicFilterAPI instance.
-func NewPublicFilterAPI(backend Backend, lightMode bool) *PublicFilterAPI {
+// NewPublicFilterAPI returns a new PublicFilterAPI instance. Filters not polled
+// within the configured timeout are uninstalled.
+func NewPublicFilterAPI(backend Backend, lightMode bool, config Config) *PublicFilterAPI {
+	if config.Timeout <= 0 {
+		config.Timeout = defaultFilterTimeout
+	}
 	api := &PublicFilterAPI{
-		backend:   backend,
-		useMipMap: !lightMode,
-		mux:       backend.EventMux(),
-		chainDb:   backend.ChainDb(),
-		events:    NewEventSystem(backend.EventMux(), backend, lightMode),
-		filters:   make(map[rpc.ID]*filter),
+		backend: backend,
+		mux:     backend.EventMux(),
+		chainDb: backend.ChainDb(),
+		events:  NewEventSystem(backend.EventMux(), backend, lightMode),
+		config:  config,
+		filters: make(map[rpc.ID]*filter),
 	}
 
 	go api.timeoutLoop()
@@ -77,67 +106,136 @@ func NewPublicFilterAPI(backend Backend, lightMode bool) *PublicFilterAPI {
 	return api
 }
 
-// timeoutLoop runs every 5 minutes and deletes filters that have not been recently used.
-// Tt is started when the api is created.
+// timeoutLoop periodically deletes filters that have not been recently used.
+// It is started when the api is created.
 func (api *PublicFilterAPI) timeoutLoop() {
-	ticker := time.NewTicker(5 * time.Minute)
+	ticker := time.NewTicker(api.config.Timeout)
 	for {
 		<-ticker.C
+
+		var expired []rpc.ID
 		api.filtersMu.Lock()
 		for id, f := range api.filters {
 			select {
 			case <-f.deadline.C:
-				f.s.Unsubscribe()
-				delete(api.filters, id)
+				expired = append(expired, id)
 			default:
 				continue
 			}
 		}
 		api.filtersMu.Unlock()
+
+		for _, id := range expired {
+			api.uninstall(id)
+		}
 	}
 }
 
-// NewPendingTransactionFilter creates a filter that fetches pending transaction hashes
-// as transactions enter the pending state.
-//
-// It is part of the filter package because this filter can be used throug the
-// `eth_getFilterChanges` polling method that is also used for log filters.
-//
-// https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_newpendingtransactionfilter
-func (api *PublicFilterAPI) NewPendingTransactionFilter() rpc.ID {
-	var (
-		pendingTxs   = make(chan common.Hash)
-		pendingTxSub = api.events.SubscribePendingTxEvents(pendingTxs)
-	)
+// install registers a filter whose subscriptions are already set up, tracking
+// its events until it is uninstalled. Filters created on connections supporting
+// notifications are also uninstalled when the connection is closed.
+func (api *PublicFilterAPI) install(ctx context.Context, f *filter) rpc.ID {
+	id := rpc.NewID()
+	f.deadline = time.NewTimer(api.config.Timeout)
+	f.done = make(chan struct{})
 
 	api.filtersMu.Lock()
-	api.filters[pendingTxSub.ID] = &filter{typ: PendingTransactionsSubscription, deadline: time.NewTimer(deadline), hashes: make([]common.Hash, 0), s: pendingTxSub}
+	api.filters[id] = f
 	api.filtersMu.Unlock()
 
-	go func() {
-		for {
-			select {
-			case ph := <-pendingTxs:
-				api.filtersMu.Lock()
-				if f, found := api.filters[pendingTxSub.ID]; found {
-					f.hashes = append(f.hashes, ph)
+	var closed <-chan interface{}
+	if notifier, supported := rpc.NotifierFromContext(ctx); supported {
+		closed = notifier.Closed()
+	}
+	go api.track(id, f, closed)
+
+	return id
+}
+
+// track accumulates the events of a filter until it is uninstalled or the
+// connection it was created on is closed.
+func (api *PublicFilterAPI) track(id rpc.ID, f *filter, closed <-chan interface{}) {
+	for {
+		select {
+		case h := <-f.headers:
+			api.filtersMu.Lock()
+			f.hashes = append(f.hashes, h.Hash())
+			api.filtersMu.Unlock()
+
+		case txs := <-f.txs:
+			api.filtersMu.Lock()
+			for _, tx := range txs {
+				f.hashes = append(f.hashes, tx.Hash())
+			}
+			api.filtersMu.Unlock()
+
+		case logs := <-f.mined:
+			api.filtersMu.Lock()
+			for _, log := range logs {
+				// Logs of already searched blocks mean the chain was reorganised,
+				// the blocks need to be searched again from the fork point.
+				if log.BlockNumber < f.next {
+					f.next, f.rewound = log.BlockNumber, true
+				}
+				if log.Removed {
+					f.removed = append(f.removed, log)
 				}
-				api.filtersMu.Unlock()
-			case <-pendingTxSub.Err():
-				api.filtersMu.Lock()
-				delete(api.filters, pendingTxSub.ID)
-				api.filtersMu.Unlock()
-				return
 			}
+			api.filtersMu.Unlock()
+
+		case logs := <-f.pending:
+			api.filtersMu.Lock()
+			f.logs = append(f.logs, logs...)
+			api.filtersMu.Unlock()
+
+		case <-closed:
+			api.uninstall(id)
+			return
+
+		case <-f.done:
+			return
 		}
-	}()
+	}
+}
 
-	return pendingTxSub.ID
+// uninstall removes a filter and tears down its subscriptions, returning
+// whether the filter was found.
+func (api *PublicFilterAPI) uninstall(id rpc.ID) bool {
+	api.filtersMu.Lock()
+	f, found := api.filters[id]
+	if found {
+		delete(api.filters, id)
+	}
+	api.filtersMu.Unlock()
+
+	if found {
+		for _, sub := range f.subs {
+			sub.Unsubscribe()
+		}
+		close(f.done)
+	}
+	return found
+}
+
+// NewPendingTransactionFilter creates a filter that fetches pending transaction hashes
+// as transactions enter the pending state.
+//
+// It is part of the filter package because this filter can be used throug the
+// `eth_getFilterChanges` polling method that is also used for log filters.
+//
+// https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_newpendingtransactionfilter
+func (api *PublicFilterAPI) NewPendingTransactionFilter(ctx context.Context) rpc.ID {
+	f := &filter{typ: PendingTransactionsSubscription, txs: make(chan []*types.Transaction)}
+	f.subs = append(f.subs, api.events.SubscribePendingTxs(f.txs))
+
+	return api.install(ctx, f)
 }
 
 // NewPendingTransactions creates a subscription that is triggered each time a transaction
 // enters the transaction pool and was signed from one of the transactions this nodes manages.
-func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context) (*rpc.Subscription, error) {
+// By default only the transaction hashes are sent, if fullTx is true the complete
+// transactions are.
+func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context, fullTx *bool) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
 	if !supported {
 		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
@@ -146,13 +244,20 @@ func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context) (*rpc.Su
 	rpcSub := notifier.CreateSubscription()
 
 	go func() {
-		txHashes := make(chan common.Hash)
-		pendingTxSub := api.events.SubscribePendingTxEvents(txHashes)
+		txs := make(chan []*types.Transaction, 128)
+		pendingTxSub := api.events.SubscribePendingTxs(txs)
 
 		for {
 			select {
-			case h := <-txHashes:
-				notifier.Notify(rpcSub.ID, h)
+			case txs := <-txs:
+				// Keep notifying one transaction at a time, as clients expect
+				for _, tx := range txs {
+					if fullTx != nil && *fullTx {
+						notifier.Notify(rpcSub.ID, ethapi.NewRPCPendingTransaction(tx))
+					} else {
+						notifier.Notify(rpcSub.ID, tx.Hash())
+					}
+				}
 			case <-rpcSub.Err():
 				pendingTxSub.Unsubscribe()
 				return
@@ -170,35 +275,11 @@ func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context) (*rpc.Su
 // It is part of the filter package since polling goes with eth_getFilterChanges.
 //
 // https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_newblockfilter
-func (api *PublicFilterAPI) NewBlockFilter() rpc.ID {
-	var (
-		headers   = make(chan *types.Header)
-		headerSub = api.events.SubscribeNewHeads(headers)
-	)
-
-	api.filtersMu.Lock()
-	api.filters[headerSub.ID] = &filter{typ: BlocksSubscription, deadline: time.NewTimer(deadline), hashes: make([]common.Hash, 0), s: headerSub}
-	api.filtersMu.Unlock()
+func (api *PublicFilterAPI) NewBlockFilter(ctx context.Context) rpc.ID {
+	f := &filter{typ: BlocksSubscription, headers: make(chan *types.Header)}
+	f.subs = append(f.subs, api.events.SubscribeNewHeads(f.headers))
 
-	go func() {
-		for {
-			select {
-			case h := <-headers:
-				api.filtersMu.Lock()
-				if f, found := api.filters[headerSub.ID]; found {
-					f.hashes = append(f.hashes, h.Hash())
-				}
-				api.filtersMu.Unlock()
-			case <-headerSub.Err():
-				api.filtersMu.Lock()
-				delete(api.filters, headerSub.ID)
-				api.filtersMu.Unlock()
-				return
-			}
-		}
-	}()
-
-	return headerSub.ID
+	return api.install(ctx, f)
 }
 
 // NewHeads send a notification each time a new (header) block is appended to the chain.
@@ -290,39 +371,35 @@ type FilterCriteria struct {
 // In case "fromBlock" > "toBlock" an error is returned.
 //
 // https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_newfilter
-func (api *PublicFilterAPI) NewFilter(crit FilterCriteria) (rpc.ID, error) {
-	logs := make(chan []*types.Log)
-	logsSub, err := api.events.SubscribeLogs(crit, logs)
+func (api *PublicFilterAPI) NewFilter(ctx context.Context, crit FilterCriteria) (rpc.ID, error) {
+	typ, err := logsSubscriptionType(crit)
 	if err != nil {
 		return rpc.ID(""), err
 	}
+	f := &filter{typ: typ, crit: crit}
 
-	api.filtersMu.Lock()
-	api.filters[logsSub.ID] = &filter{typ: LogsSubscription, crit: crit, deadline: time.NewTimer(deadline), logs: make([]*types.Log, 0), s: logsSub}
-	api.filtersMu.Unlock()
-
-	go func() {
-		for {
-			select {
-			case l := <-logs:
-				api.filtersMu.Lock()
-				if f, found := api.filters[logsSub.ID]; found {
-					f.logs = append(f.logs, l...)
-				}
-				api.filtersMu.Unlock()
-			case <-logsSub.Err():
-				api.filtersMu.Lock()
-				delete(api.filters, logsSub.ID)
-				api.filtersMu.Unlock()
-				return
-			}
+	if typ != PendingLogsSubscription {
+		// Mined logs are searched for starting with the next block, unless
+		// the range starts later
+		if header, _ := api.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber); header != nil {
+			f.next = header.Number.Uint64() + 1
 		}
-	}()
-
-	return logsSub.ID, nil
+		if crit.FromBlock != nil && crit.FromBlock.Sign() >= 0 && crit.FromBlock.Uint64() > f.next {
+			f.next = crit.FromBlock.Uint64()
+		}
+		f.mined = make(chan []*types.Log)
+		f.subs = append(f.subs, api.events.subscribeLogs(crit, f.mined))
+	}
+	if typ != LogsSubscription {
+		f.pending = make(chan []*types.Log)
+		f.subs = append(f.subs, api.events.subscribePendingLogs(crit, f.pending))
+	}
+	return api.install(ctx, f), nil
 }
 
 // GetLogs returns logs matching the given argument that are stored within the state.
+// Queries exceeding the configured block range or result limits fail with an error
+// carrying the last block to query up to in order to stay within them.
 //
 // https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_getlogs
 func (api *PublicFilterAPI) GetLogs(ctx context.Context, crit FilterCriteria) ([]*types.Log, error) {
@@ -333,11 +410,12 @@ func (api *PublicFilterAPI) GetLogs(ctx context.Context, crit FilterCriteria) ([
 		crit.ToBlock = big.NewInt(rpc.LatestBlockNumber.Int64())
 	}
 
-	filter := New(api.backend, api.useMipMap)
+	filter := New(api.backend)
 	filter.SetBeginBlock(crit.FromBlock.Int64())
 	filter.SetEndBlock(crit.ToBlock.Int64())
 	filter.SetAddresses(crit.Addresses)
 	filter.SetTopics(crit.Topics)
+	filter.SetLimits(api.config.RangeLimit, api.config.ResultLimit)
 
 	logs, err := filter.Find(ctx)
 	return returnLogs(logs), err
@@ -347,17 +425,7 @@ func (api *PublicFilterAPI) GetLogs(ctx context.Context, crit FilterCriteria) ([
 //
 // https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_uninstallfilter
 func (api *PublicFilterAPI) UninstallFilter(id rpc.ID) bool {
-	api.filtersMu.Lock()
-	f, found := api.filters[id]
-	if found {
-		delete(api.filters, id)
-	}
-	api.filtersMu.Unlock()
-	if found {
-		f.s.Unsubscribe()
-	}
-
-	return found
+	return api.uninstall(id)
 }
 
 // GetFilterLogs returns the logs for the filter with the given id.
@@ -369,11 +437,11 @@ func (api *PublicFilterAPI) GetFilterLogs(ctx context.Context, id rpc.ID) ([]*ty
 	f, found := api.filters[id]
 	api.filtersMu.Unlock()
 
-	if !found || f.typ != LogsSubscription {
+	if !found || f.typ == BlocksSubscription || f.typ == PendingTransactionsSubscription {
 		return nil, fmt.Errorf("filter not found")
 	}
 
-	filter := New(api.backend, api.useMipMap)
+	filter := New(api.backend)
 	if f.crit.FromBlock != nil {
 		filter.SetBeginBlock(f.crit.FromBlock.Int64())
 	} else {
@@ -386,6 +454,7 @@ func (api *PublicFilterAPI) GetFilterLogs(ctx context.Context, id rpc.ID) ([]*ty
 	}
 	filter.SetAddresses(f.crit.Addresses)
 	filter.SetTopics(f.crit.Topics)
+	filter.SetLimits(api.config.RangeLimit, api.config.ResultLimit)
 
 	logs, err := filter.Find(ctx)
 	if err != nil {
@@ -398,34 +467,90 @@ func (api *PublicFilterAPI) GetFilterLogs(ctx context.Context, id rpc.ID) ([]*ty
 // last time is was called. This can be used for polling.
 //
 // For pending transaction and block filters the result is []common.Hash.
-// (pending)Log filters return []Log.
+// (pending)Log filters return []Log. Logs removed by chain reorganisations are
+// returned first, followed by the newly mined and the pending logs.
 //
 // https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_getfilterchanges
-func (api *PublicFilterAPI) GetFilterChanges(id rpc.ID) (interface{}, error) {
+func (api *PublicFilterAPI) GetFilterChanges(ctx context.Context, id rpc.ID) (interface{}, error) {
+	api.filtersMu.Lock()
+	f, found := api.filters[id]
+	if !found {
+		api.filtersMu.Unlock()
+		return []interface{}{}, fmt.Errorf("filter not found")
+	}
+	if !f.deadline.Stop() {
+		// timer expired but filter is not yet removed in timeout loop
+		// receive timer value and reset timer
+		<-f.deadline.C
+	}
+	f.deadline.Reset(api.config.Timeout)
+
+	switch f.typ {
+	case PendingTransactionsSubscription, BlocksSubscription:
+		hashes := f.hashes
+		f.hashes = nil
+		api.filtersMu.Unlock()
+		return returnHashes(hashes), nil
+
+	case PendingLogsSubscription:
+		logs := f.logs
+		f.logs = nil
+		api.filtersMu.Unlock()
+		return returnLogs(logs), nil
+	}
+	api.filtersMu.Unlock()
+
+	// Search the blocks imported since the last poll for mined logs
+	f.pollMu.Lock()
+	defer f.pollMu.Unlock()
+
+	api.filtersMu.Lock()
+	begin := f.next
+	f.rewound = false
+	api.filtersMu.Unlock()
+
+	mined, next, err := api.minedLogs(ctx, f.crit, begin)
+	if err != nil {
+		return []interface{}{}, err
+	}
 	api.filtersMu.Lock()
 	defer api.filtersMu.Unlock()
 
-	if f, found := api.filters[id]; found {
-		if !f.deadline.Stop() {
-			// timer expired but filter is not yet removed in timeout loop
-			// receive timer value and reset timer
-			<-f.deadline.C
-		}
-		f.deadline.Reset(deadline)
-
-		switch f.typ {
-		case PendingTransactionsSubscription, BlocksSubscription:
-			hashes := f.hashes
-			f.hashes = nil
-			return returnHashes(hashes), nil
-		case LogsSubscription:
-			logs := f.logs
-			f.logs = nil
-			return returnLogs(logs), nil
-		}
+	if !f.rewound {
+		f.next = next
+	}
+	logs := append(append(f.removed, mined...), f.logs...)
+	f.removed, f.logs = nil, nil
+
+	return returnLogs(logs), nil
+}
+
+// minedLogs searches the canonical chain for the logs matching the criteria,
+// starting at block begin up to the current head or the end of the range. The
+// first block not yet searched is returned along the logs.
+func (api *PublicFilterAPI) minedLogs(ctx context.Context, crit FilterCriteria, begin uint64) ([]*types.Log, uint64, error) {
+	header, err := api.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if header == nil || err != nil {
+		return nil, begin, err
+	}
+	end := header.Number.Uint64()
+	if crit.ToBlock != nil && crit.ToBlock.Sign() >= 0 && crit.ToBlock.Uint64() < end {
+		end = crit.ToBlock.Uint64()
 	}
+	if begin > end {
+		return nil, begin, nil
+	}
+	filter := New(api.backend)
+	filter.SetBeginBlock(int64(begin))
+	filter.SetEndBlock(int64(end))
+	filter.SetAddresses(crit.Addresses)
+	filter.SetTopics(crit.Topics)
 
-	return []interface{}{}, fmt.Errorf("filter not found")
+	logs, err := filter.Find(ctx)
+	if err != nil {
+		return nil, begin, err
+	}
+	return logs, end + 1, nil
 }
 
 // returnHashes is a helper that will return an empty hash array case the given hash array is nil,
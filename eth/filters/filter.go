@@ -18,12 +18,14 @@ package filters
 
 import (
 	"context"
-	"math"
+	"fmt"
 	"math/big"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/bloombits"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
@@ -33,32 +35,60 @@ import (
 type Backend interface {
 	ChainDb() ethdb.Database
 	EventMux() *event.TypeMux
+	SubscribeNewTxsEvent(chan<- core.NewTxsEvent) event.Subscription
 	HeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Header, error)
 	GetReceipts(ctx context.Context, blockHash common.Hash) (types.Receipts, error)
+
+	BloomStatus() (uint64, uint64)
+	ServiceFilter(ctx context.Context, session *bloombits.MatcherSession)
+}
+
+// LimitError is returned by searches exceeding the block range or result limits.
+// LastBlock is the highest block a search starting at the same block may end at
+// to stay within the limits, allowing clients to paginate. It is nil if the logs
+// of the first block alone exceed the result limit, as no such block exists.
+type LimitError struct {
+	msg       string
+	LastBlock *uint64
+}
+
+func (e *LimitError) Error() string { return e.msg }
+
+// ErrorCode returns the JSON-RPC error code of exceeded limits.
+func (e *LimitError) ErrorCode() int { return -32005 }
+
+// ErrorData returns the last block to paginate to. The data is omitted if the
+// logs of the first block alone exceed the result limit.
+func (e *LimitError) ErrorData() interface{} {
+	if e.LastBlock == nil {
+		return nil
+	}
+	return map[string]interface{}{"lastBlock": hexutil.Uint64(*e.LastBlock)}
 }
 
 // Filter can be used to retrieve and filter logs.
 type Filter struct {
-	backend   Backend
-	useMipMap bool
+	backend Backend
 
 	created time.Time
 
 	db         ethdb.Database
 	begin, end int64
+	start      uint64 // first block of the ongoing search
 	addresses  []common.Address
 	topics     [][]common.Hash
+
+	rangeLimit  uint64 // maximum number of blocks searched (0 = no limit)
+	resultLimit int    // maximum number of logs returned (0 = no limit)
 }
 
-// New creates a new filter which uses a bloom filter on blocks to figure out whether
-// a particular block is interesting or not.
-// MipMaps allow past blocks to be searched much more efficiently, but are not available
-// to light clients.
-func New(backend Backend, useMipMap bool) *Filter {
+// New creates a new filter which uses the bloom bits index to figure out which
+// sections of the chain are interesting, and the header blooms of the blocks
+// not yet indexed to check whether a particular block is interesting or not.
+func New(backend Backend) *Filter {
 	return &Filter{
-		backend:   backend,
-		useMipMap: useMipMap,
-		db:        backend.ChainDb(),
+		backend: backend,
+		db:      backend.ChainDb(),
 	}
 }
 
@@ -85,115 +115,184 @@ func (f *Filter) SetTopics(topics [][]common.Hash) {
 	f.topics = topics
 }
 
-// FindOnce searches the blockchain for matching log entries, returning
-// all matching entries from the first block that contains matches,
-// updating the start point of the filter accordingly. If no results are
-// found, a nil slice is returned.
-func (f *Filter) FindOnce(ctx context.Context) ([]*types.Log, error) {
-	head, _ := f.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
-	if head == nil {
+// SetLimits caps the number of blocks searched and logs returned, zero meaning
+// no limit. Searches exceeding them fail with a LimitError.
+func (f *Filter) SetLimits(blocks uint64, results int) {
+	f.rangeLimit = blocks
+	f.resultLimit = results
+}
+
+// Find searches the blockchain for matching log entries, returning all the
+// matching entries within the filter range and updating the start point of
+// the filter past the last searched block.
+func (f *Filter) Find(ctx context.Context) ([]*types.Log, error) {
+	header, _ := f.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if header == nil {
 		return nil, nil
 	}
-	headBlockNumber := head.Number.Uint64()
+	head := header.Number.Uint64()
 
-	var beginBlockNo uint64 = uint64(f.begin)
 	if f.begin == -1 {
-		beginBlockNo = headBlockNumber
+		f.begin = int64(head)
 	}
-	var endBlockNo uint64 = uint64(f.end)
+	end := uint64(f.end)
 	if f.end == -1 {
-		endBlockNo = headBlockNumber
+		end = head
 	}
-
-	// if no addresses are present we can't make use of fast search which
-	// uses the mipmap bloom filters to check for fast inclusion and uses
-	// higher range probability in order to ensure at least a false positive
-	if !f.useMipMap || len(f.addresses) == 0 {
-		logs, blockNumber, err := f.getLogs(ctx, beginBlockNo, endBlockNo)
-		f.begin = int64(blockNumber + 1)
-		return logs, err
+	if f.begin < 0 || uint64(f.begin) > end {
+		return nil, nil
 	}
-
-	logs, blockNumber := f.mipFind(beginBlockNo, endBlockNo, 0)
-	f.begin = int64(blockNumber + 1)
-	return logs, nil
-}
-
-// Run filters logs with the current parameters set
-func (f *Filter) Find(ctx context.Context) (logs []*types.Log, err error) {
-	for {
-		newLogs, err := f.FindOnce(ctx)
-		if len(newLogs) == 0 || err != nil {
+	if f.rangeLimit > 0 && end-uint64(f.begin) >= f.rangeLimit {
+		last := uint64(f.begin) + f.rangeLimit - 1
+		return nil, &LimitError{
+			msg:       fmt.Sprintf("block range exceeds limit of %d", f.rangeLimit),
+			LastBlock: &last,
+		}
+	}
+	f.start = uint64(f.begin)
+
+	// Gather all indexed logs, and finish with non indexed ones
+	var (
+		logs []*types.Log
+		err  error
+	)
+	size, sections := f.backend.BloomStatus()
+	if indexed := sections * size; indexed > uint64(f.begin) {
+		if indexed > end {
+			logs, err = f.indexedLogs(ctx, end)
+		} else {
+			logs, err = f.indexedLogs(ctx, indexed-1)
+		}
+		if err != nil {
 			return logs, err
 		}
-		logs = append(logs, newLogs...)
 	}
+	return f.unindexedLogs(ctx, end, logs)
 }
 
-func (f *Filter) mipFind(start, end uint64, depth int) (logs []*types.Log, blockNumber uint64) {
-	level := core.MIPMapLevels[depth]
-	// normalise numerator so we can work in level specific batches and
-	// work with the proper range checks
-	for num := start / level * level; num <= end; num += level {
-		// find addresses in bloom filters
-		bloom := core.GetMipmapBloom(f.db, num, level)
-		// Don't bother checking the first time through the loop - we're probably picking
-		// up where a previous run left off.
-		first := true
-		for _, addr := range f.addresses {
-			if first || bloom.TestBytes(addr[:]) {
-				first = false
-				// range check normalised values and make sure that
-				// we're resolving the correct range instead of the
-				// normalised values.
-				start := uint64(math.Max(float64(num), float64(start)))
-				end := uint64(math.Min(float64(num+level-1), float64(end)))
-				if depth+1 == len(core.MIPMapLevels) {
-					l, blockNumber, _ := f.getLogs(context.Background(), start, end)
-					if len(l) > 0 {
-						return l, blockNumber
-					}
-				} else {
-					l, blockNumber := f.mipFind(start, end, depth+1)
-					if len(l) > 0 {
-						return l, blockNumber
-					}
+// indexedLogs returns the logs matching the filter criteria based on the bloom
+// bits indexed available locally or via the network.
+func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
+	size, _ := f.backend.BloomStatus()
+
+	// Create a matcher session and request servicing from the backend
+	matches := make(chan uint64, 64)
+
+	session, err := bloombits.NewMatcher(size, f.bloomFilters()).Start(ctx, uint64(f.begin), end, matches)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	f.backend.ServiceFilter(ctx, session)
+
+	// Iterate over the matches until exhausted or context closed
+	var logs []*types.Log
+
+	for {
+		select {
+		case number, ok := <-matches:
+			// Abort if all matches have been fulfilled
+			if !ok {
+				err := session.Error()
+				if err == nil {
+					f.begin = int64(end) + 1
 				}
+				return logs, err
 			}
+			f.begin = int64(number) + 1
+
+			// Retrieve the suggested block and pull any truly matching logs
+			header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
+			if header == nil || err != nil {
+				return logs, err
+			}
+			found, err := f.checkMatches(ctx, header)
+			if err != nil {
+				return logs, err
+			}
+			logs = append(logs, found...)
+			if err := f.checkResultLimit(logs, number); err != nil {
+				return logs, err
+			}
+
+		case <-ctx.Done():
+			return logs, ctx.Err()
 		}
 	}
-
-	return nil, end
 }
 
-func (f *Filter) getLogs(ctx context.Context, start, end uint64) (logs []*types.Log, blockNumber uint64, err error) {
-	for i := start; i <= end; i++ {
-		blockNumber := rpc.BlockNumber(i)
-		header, err := f.backend.HeaderByNumber(ctx, blockNumber)
+// unindexedLogs appends the logs matching the filter criteria based on raw block
+// iteration and bloom matching to the already collected ones.
+func (f *Filter) unindexedLogs(ctx context.Context, end uint64, logs []*types.Log) ([]*types.Log, error) {
+	for ; f.begin <= int64(end); f.begin++ {
+		header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(f.begin))
 		if header == nil || err != nil {
-			return logs, end, err
+			return logs, err
 		}
-
-		// Use bloom filtering to see if this block is interesting given the
-		// current parameters
-		if f.bloomFilter(header.Bloom) {
-			// Get the logs of the block
-			receipts, err := f.backend.GetReceipts(ctx, header.Hash())
+		if bloomFilter(header.Bloom, f.addresses, f.topics) {
+			found, err := f.checkMatches(ctx, header)
 			if err != nil {
-				return nil, end, err
+				return logs, err
 			}
-			var unfiltered []*types.Log
-			for _, receipt := range receipts {
-				unfiltered = append(unfiltered, ([]*types.Log)(receipt.Logs)...)
-			}
-			logs = filterLogs(unfiltered, nil, nil, f.addresses, f.topics)
-			if len(logs) > 0 {
-				return logs, uint64(blockNumber), nil
+			logs = append(logs, found...)
+			if err := f.checkResultLimit(logs, header.Number.Uint64()); err != nil {
+				return logs, err
 			}
 		}
 	}
+	return logs, nil
+}
 
-	return logs, end, nil
+// checkResultLimit returns a LimitError if the logs collected up to and including
+// the given block exceed the result limit.
+func (f *Filter) checkResultLimit(logs []*types.Log, number uint64) error {
+	if f.resultLimit == 0 || len(logs) <= f.resultLimit {
+		return nil
+	}
+	err := &LimitError{msg: fmt.Sprintf("query returned more than %d results", f.resultLimit)}
+	if number > f.start {
+		last := number - 1
+		err.LastBlock = &last
+	}
+	return err
+}
+
+// checkMatches checks if the receipts belonging to the given header contain any
+// log events that match the filter criteria.
+func (f *Filter) checkMatches(ctx context.Context, header *types.Header) ([]*types.Log, error) {
+	receipts, err := f.backend.GetReceipts(ctx, header.Hash())
+	if err != nil {
+		return nil, err
+	}
+	var unfiltered []*types.Log
+	for _, receipt := range receipts {
+		unfiltered = append(unfiltered, receipt.Logs...)
+	}
+	return filterLogs(unfiltered, nil, nil, f.addresses, f.topics), nil
+}
+
+// bloomFilters converts the filter criteria into the bloom bits matcher's
+// format, where a nil clause matches everything.
+func (f *Filter) bloomFilters() [][][]byte {
+	var filters [][][]byte
+	if len(f.addresses) > 0 {
+		filter := make([][]byte, len(f.addresses))
+		for i, address := range f.addresses {
+			filter[i] = address.Bytes()
+		}
+		filters = append(filters, filter)
+	}
+	for _, topicList := range f.topics {
+		filter := make([][]byte, len(topicList))
+		for i, topic := range topicList {
+			if topic != (common.Hash{}) {
+				filter[i] = topic.Bytes()
+			}
+		}
+		filters = append(filters, filter)
+	}
+	return filters
 }
 
 func includes(addresses []common.Address, a common.Address) bool {
@@ -250,10 +349,6 @@ Logs:
 	return ret
 }
 
-func (f *Filter) bloomFilter(bloom types.Bloom) bool {
-	return bloomFilter(bloom, f.addresses, f.topics)
-}
-
 func bloomFilter(bloom types.Bloom, addresses []common.Address, topics [][]common.Hash) bool {
 	if len(addresses) > 0 {
 		var included bool
@@ -17,14 +17,18 @@
 package filters
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"math/big"
 	"reflect"
 	"testing"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/bitutil"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/bloombits"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
@@ -33,8 +37,9 @@ import (
 )
 
 type testBackend struct {
-	mux *event.TypeMux
-	db  ethdb.Database
+	mux    *event.TypeMux
+	db     ethdb.Database
+	txFeed event.Feed
 }
 
 func (b *testBackend) ChainDb() ethdb.Database {
@@ -45,6 +50,10 @@ func (b *testBackend) EventMux() *event.TypeMux {
 	return b.mux
 }
 
+func (b *testBackend) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
+	return b.txFeed.Subscribe(ch)
+}
+
 func (b *testBackend) HeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Header, error) {
 	var hash common.Hash
 	var num uint64
@@ -63,6 +72,55 @@ func (b *testBackend) GetReceipts(ctx context.Context, blockHash common.Hash) (t
 	return core.GetBlockReceipts(b.db, blockHash, num), nil
 }
 
+// BloomStatus reports the number of consecutive test sections indexed into the
+// bloom bits of the database.
+func (b *testBackend) BloomStatus() (uint64, uint64) {
+	var sections uint64
+	for {
+		head := core.GetCanonicalHash(b.db, (sections+1)*testBloomBitsBlocks-1)
+		if _, err := core.GetBloomBits(b.db, 0, sections, head); err != nil {
+			return testBloomBitsBlocks, sections
+		}
+		sections++
+	}
+}
+
+func (b *testBackend) ServiceFilter(ctx context.Context, session *bloombits.MatcherSession) {
+	var (
+		requests = make(chan chan *bloombits.Retrieval)
+		done     = make(chan struct{})
+	)
+	go func() {
+		session.Multiplex(16, requests)
+		close(done)
+	}()
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+
+			case request := <-requests:
+				task := <-request
+
+				task.Bitsets = make([][]byte, len(task.Sections))
+				for i, section := range task.Sections {
+					head := core.GetCanonicalHash(b.db, (section+1)*testBloomBitsBlocks-1)
+					blob, err := core.GetBloomBits(b.db, task.Bit, section, head)
+					if err == nil {
+						task.Bitsets[i], err = bitutil.DecompressBytes(blob, int(testBloomBitsBlocks/8))
+					}
+					if err != nil {
+						task.Error = err
+						break
+					}
+				}
+				request <- task
+			}
+		}
+	}()
+}
+
 // TestBlockSubscription tests if a block subscription returns block hashes for posted chain events.
 // It creates multiple subscriptions:
 // - one at the start and should receive all posted chain events and a second (blockHashes)
@@ -74,8 +132,8 @@ func TestBlockSubscription(t *testing.T) {
 	var (
 		mux         = new(event.TypeMux)
 		db, _       = ethdb.NewMemDatabase()
-		backend     = &testBackend{mux, db}
-		api         = NewPublicFilterAPI(backend, false)
+		backend     = &testBackend{mux: mux, db: db}
+		api         = NewPublicFilterAPI(backend, false, Config{})
 		genesis     = new(core.Genesis).MustCommit(db)
 		chain, _    = core.GenerateChain(params.TestChainConfig, genesis, db, 10, func(i int, gen *core.BlockGen) {})
 		chainEvents = []core.ChainEvent{}
@@ -127,8 +185,8 @@ func TestPendingTxFilter(t *testing.T) {
 	var (
 		mux     = new(event.TypeMux)
 		db, _   = ethdb.NewMemDatabase()
-		backend = &testBackend{mux, db}
-		api     = NewPublicFilterAPI(backend, false)
+		backend = &testBackend{mux: mux, db: db}
+		api     = NewPublicFilterAPI(backend, false, Config{})
 
 		transactions = []*types.Transaction{
 			types.NewTransaction(0, common.HexToAddress("0xb794f5ea0ba39494ce83a213fffba74279579268"), new(big.Int), new(big.Int), new(big.Int), nil),
@@ -141,16 +199,13 @@ func TestPendingTxFilter(t *testing.T) {
 		hashes []common.Hash
 	)
 
-	fid0 := api.NewPendingTransactionFilter()
+	fid0 := api.NewPendingTransactionFilter(context.Background())
 
 	time.Sleep(1 * time.Second)
-	for _, tx := range transactions {
-		ev := core.TxPreEvent{Tx: tx}
-		mux.Post(ev)
-	}
+	backend.txFeed.Send(core.NewTxsEvent{Txs: transactions})
 
 	for {
-		results, err := api.GetFilterChanges(fid0)
+		results, err := api.GetFilterChanges(context.Background(), fid0)
 		if err != nil {
 			t.Fatalf("Unable to retrieve logs: %v", err)
 		}
@@ -177,8 +232,8 @@ func TestLogFilterCreation(t *testing.T) {
 	var (
 		mux     = new(event.TypeMux)
 		db, _   = ethdb.NewMemDatabase()
-		backend = &testBackend{mux, db}
-		api     = NewPublicFilterAPI(backend, false)
+		backend = &testBackend{mux: mux, db: db}
+		api     = NewPublicFilterAPI(backend, false, Config{})
 
 		testCases = []struct {
 			crit    FilterCriteria
@@ -204,7 +259,7 @@ func TestLogFilterCreation(t *testing.T) {
 	)
 
 	for i, test := range testCases {
-		_, err := api.NewFilter(test.crit)
+		_, err := api.NewFilter(context.Background(), test.crit)
 		if test.success && err != nil {
 			t.Errorf("expected filter creation for case %d to success, got %v", i, err)
 		}
@@ -222,8 +277,8 @@ func TestInvalidLogFilterCreation(t *testing.T) {
 	var (
 		mux     = new(event.TypeMux)
 		db, _   = ethdb.NewMemDatabase()
-		backend = &testBackend{mux, db}
-		api     = NewPublicFilterAPI(backend, false)
+		backend = &testBackend{mux: mux, db: db}
+		api     = NewPublicFilterAPI(backend, false, Config{})
 	)
 
 	// different situations where log filter creation should fail.
@@ -235,21 +290,22 @@ func TestInvalidLogFilterCreation(t *testing.T) {
 	}
 
 	for i, test := range testCases {
-		if _, err := api.NewFilter(test); err == nil {
+		if _, err := api.NewFilter(context.Background(), test); err == nil {
 			t.Errorf("Expected NewFilter for case #%d to fail", i)
 		}
 	}
 }
 
-// TestLogFilter tests whether log filters match the correct logs that are posted to the event mux.
+// TestLogFilter tests whether log filters match the correct logs, searching the
+// chain for the mined ones and collecting the pending ones posted to the event mux.
 func TestLogFilter(t *testing.T) {
 	t.Parallel()
 
 	var (
 		mux     = new(event.TypeMux)
 		db, _   = ethdb.NewMemDatabase()
-		backend = &testBackend{mux, db}
-		api     = NewPublicFilterAPI(backend, false)
+		backend = &testBackend{mux: mux, db: db}
+		api     = NewPublicFilterAPI(backend, false, Config{})
 
 		firstAddr      = common.HexToAddress("0x1111111111111111111111111111111111111111")
 		secondAddr     = common.HexToAddress("0x2222222222222222222222222222222222222222")
@@ -259,9 +315,9 @@ func TestLogFilter(t *testing.T) {
 		secondTopic    = common.HexToHash("0x2222222222222222222222222222222222222222222222222222222222222222")
 		notUsedTopic   = common.HexToHash("0x9999999999999999999999999999999999999999999999999999999999999999")
 
-		// posted twice, once as vm.Logs and once as core.PendingLogsEvent
+		// mined in blocks 1 to 3 and posted as core.PendingLogsEvent
 		allLogs = []*types.Log{
-			{Address: firstAddr},
+			{Address: firstAddr, BlockNumber: 1},
 			{Address: firstAddr, Topics: []common.Hash{firstTopic}, BlockNumber: 1},
 			{Address: secondAddr, Topics: []common.Hash{firstTopic}, BlockNumber: 1},
 			{Address: thirdAddress, Topics: []common.Hash{secondTopic}, BlockNumber: 2},
@@ -305,14 +361,13 @@ func TestLogFilter(t *testing.T) {
 
 	// create all filters
 	for i := range testCases {
-		testCases[i].id, _ = api.NewFilter(testCases[i].crit)
+		testCases[i].id, _ = api.NewFilter(context.Background(), testCases[i].crit)
 	}
 
-	// raise events
+	// mine the logs and raise the pending events
+	writeTestChain(t, db, allLogs)
+
 	time.Sleep(1 * time.Second)
-	if err := mux.Post(allLogs); err != nil {
-		t.Fatal(err)
-	}
 	if err := mux.Post(core.PendingLogsEvent{Logs: allLogs}); err != nil {
 		t.Fatal(err)
 	}
@@ -320,7 +375,7 @@ func TestLogFilter(t *testing.T) {
 	for i, tt := range testCases {
 		var fetched []*types.Log
 		for { // fetch all expected logs
-			results, err := api.GetFilterChanges(tt.id)
+			results, err := api.GetFilterChanges(context.Background(), tt.id)
 			if err != nil {
 				t.Fatalf("Unable to fetch logs: %v", err)
 			}
@@ -342,7 +397,7 @@ func TestLogFilter(t *testing.T) {
 			if fetched[l].Removed {
 				t.Errorf("expected log not to be removed for log %d in case %d", l, i)
 			}
-			if !reflect.DeepEqual(fetched[l], tt.expected[l]) {
+			if !sameLog(fetched[l], tt.expected[l]) {
 				t.Errorf("invalid log on index %d for case %d", l, i)
 			}
 		}
@@ -356,8 +411,8 @@ func TestPendingLogsSubscription(t *testing.T) {
 	var (
 		mux     = new(event.TypeMux)
 		db, _   = ethdb.NewMemDatabase()
-		backend = &testBackend{mux, db}
-		api     = NewPublicFilterAPI(backend, false)
+		backend = &testBackend{mux: mux, db: db}
+		api     = NewPublicFilterAPI(backend, false, Config{})
 
 		firstAddr      = common.HexToAddress("0x1111111111111111111111111111111111111111")
 		secondAddr     = common.HexToAddress("0x2222222222222222222222222222222222222222")
@@ -461,3 +516,309 @@ func TestPendingLogsSubscription(t *testing.T) {
 		}
 	}
 }
+
+// TestFilterTimeout tests whether filters that are not polled anymore are
+// uninstalled once the filter timeout expires, while polled ones are kept.
+func TestFilterTimeout(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mux     = new(event.TypeMux)
+		db, _   = ethdb.NewMemDatabase()
+		backend = &testBackend{mux: mux, db: db}
+		api     = NewPublicFilterAPI(backend, false, Config{Timeout: 100 * time.Millisecond})
+		ctx     = context.Background()
+	)
+	idle := api.NewBlockFilter(ctx)
+	polled := api.NewPendingTransactionFilter(ctx)
+
+	for i := 0; i < 6; i++ {
+		time.Sleep(50 * time.Millisecond)
+		if _, err := api.GetFilterChanges(ctx, polled); err != nil {
+			t.Fatalf("polled filter uninstalled: %v", err)
+		}
+	}
+	if _, err := api.GetFilterChanges(ctx, idle); err == nil {
+		t.Fatalf("idle filter not uninstalled")
+	}
+	if api.UninstallFilter(idle) {
+		t.Errorf("idle filter uninstalled twice")
+	}
+	if !api.UninstallFilter(polled) {
+		t.Errorf("polled filter not found")
+	}
+}
+
+// TestFilterConnectionClose tests whether the filters installed over a
+// connection are uninstalled when the connection is closed.
+func TestFilterConnectionClose(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mux     = new(event.TypeMux)
+		db, _   = ethdb.NewMemDatabase()
+		backend = &testBackend{mux: mux, db: db}
+		api     = NewPublicFilterAPI(backend, false, Config{})
+		server  = rpc.NewServer()
+	)
+	if err := server.RegisterName("eth", api); err != nil {
+		t.Fatalf("failed to register filter api: %v", err)
+	}
+	client := rpc.DialInProc(server)
+
+	var id rpc.ID
+	if err := client.Call(&id, "eth_newBlockFilter"); err != nil {
+		t.Fatalf("failed to create block filter: %v", err)
+	}
+	if err := client.Call(&id, "eth_newFilter", FilterCriteria{}); err != nil {
+		t.Fatalf("failed to create log filter: %v", err)
+	}
+	if n := installedFilters(api); n != 2 {
+		t.Fatalf("installed filter count mismatch: have %d, want %d", n, 2)
+	}
+	client.Close()
+
+	for i := 0; installedFilters(api) > 0; i++ {
+		if i == 50 {
+			t.Fatalf("filters not uninstalled after the connection closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestLogFilterReorg tests whether log filters report the logs removed by a
+// chain reorganisation and search the blocks after the fork point again.
+func TestLogFilterReorg(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mux     = new(event.TypeMux)
+		db, _   = ethdb.NewMemDatabase()
+		backend = &testBackend{mux: mux, db: db}
+		api     = NewPublicFilterAPI(backend, false, Config{})
+		ctx     = context.Background()
+
+		addr = common.HexToAddress("0x1111111111111111111111111111111111111111")
+		logs = []*types.Log{
+			{Address: addr, BlockNumber: 1},
+			{Address: addr, BlockNumber: 2},
+		}
+	)
+	id, err := api.NewFilter(ctx, FilterCriteria{Addresses: []common.Address{addr}})
+	if err != nil {
+		t.Fatalf("failed to create filter: %v", err)
+	}
+	writeTestChain(t, db, logs)
+
+	results, err := api.GetFilterChanges(ctx, id)
+	if err != nil {
+		t.Fatalf("failed to poll filter: %v", err)
+	}
+	if have := results.([]*types.Log); len(have) != 2 {
+		t.Fatalf("mined log count mismatch: have %d, want %d", len(have), 2)
+	}
+	// Remove the log of block 2, both blocks are searched again on the next poll
+	removed := &types.Log{Address: addr, BlockNumber: 1, Removed: true}
+	time.Sleep(100 * time.Millisecond)
+	if err := mux.Post(core.RemovedLogsEvent{Logs: []*types.Log{removed}}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if results, err = api.GetFilterChanges(ctx, id); err != nil {
+		t.Fatalf("failed to poll filter: %v", err)
+	}
+	want := []*types.Log{removed, logs[0], logs[1]}
+	have := results.([]*types.Log)
+	if len(have) != len(want) {
+		t.Fatalf("log count mismatch: have %d, want %d", len(have), len(want))
+	}
+	for i := range have {
+		if !sameLog(have[i], want[i]) || have[i].Removed != want[i].Removed {
+			t.Errorf("log %d mismatch: have %+v, want %+v", i, have[i], want[i])
+		}
+	}
+	// Nothing changed since, the next poll must be empty
+	if results, err = api.GetFilterChanges(ctx, id); err != nil {
+		t.Fatalf("failed to poll filter: %v", err)
+	}
+	if have := results.([]*types.Log); len(have) != 0 {
+		t.Errorf("unexpected logs after reorg: %v", have)
+	}
+}
+
+// TestGetLogsLimits tests whether log queries exceeding the block range or result
+// limits fail, reporting the last block to paginate to.
+func TestGetLogsLimits(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mux     = new(event.TypeMux)
+		db, _   = ethdb.NewMemDatabase()
+		backend = &testBackend{mux: mux, db: db}
+		ctx     = context.Background()
+
+		addr = common.HexToAddress("0x1111111111111111111111111111111111111111")
+		logs = []*types.Log{
+			{Address: addr, BlockNumber: 1},
+			{Address: addr, BlockNumber: 1},
+			{Address: addr, BlockNumber: 2},
+			{Address: addr, BlockNumber: 3},
+			{Address: addr, BlockNumber: 3},
+		}
+	)
+	writeTestChain(t, db, logs)
+
+	tests := []struct {
+		config     Config
+		from, to   int64
+		results    int
+		lastBlock  int64 // -1 if no last block is reported
+		limitError bool
+	}{
+		{Config{}, 0, 3, 5, 0, false},
+		{Config{RangeLimit: 3}, 1, 3, 5, 0, false},
+		{Config{RangeLimit: 2}, 1, 3, 0, 2, true},
+		{Config{RangeLimit: 2}, 2, -1, 3, 0, false},
+		{Config{ResultLimit: 5}, 0, 3, 5, 0, false},
+		{Config{ResultLimit: 2}, 1, 1, 2, 0, false},
+		{Config{ResultLimit: 2}, 1, 3, 0, 1, true},
+		{Config{ResultLimit: 2}, 2, 3, 0, 2, true},
+		{Config{ResultLimit: 1}, 1, 3, 0, -1, true},
+	}
+	for i, tt := range tests {
+		api := NewPublicFilterAPI(backend, false, tt.config)
+		crit := FilterCriteria{FromBlock: big.NewInt(tt.from), ToBlock: big.NewInt(tt.to)}
+
+		found, err := api.GetLogs(ctx, crit)
+		if !tt.limitError {
+			if err != nil {
+				t.Errorf("test %d: failed to get logs: %v", i, err)
+			} else if len(found) != tt.results {
+				t.Errorf("test %d: log count mismatch: have %d, want %d", i, len(found), tt.results)
+			}
+			continue
+		}
+		limitErr, ok := err.(*LimitError)
+		if !ok {
+			t.Errorf("test %d: error mismatch: have %v, want limit error", i, err)
+			continue
+		}
+		switch {
+		case limitErr.LastBlock == nil && tt.lastBlock != -1:
+			t.Errorf("test %d: last block missing, want %d", i, tt.lastBlock)
+		case limitErr.LastBlock != nil && int64(*limitErr.LastBlock) != tt.lastBlock:
+			t.Errorf("test %d: last block mismatch: have %d, want %d", i, *limitErr.LastBlock, tt.lastBlock)
+		}
+	}
+	// Ensure the last block is reported to remote clients
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", NewPublicFilterAPI(backend, false, Config{ResultLimit: 2})); err != nil {
+		t.Fatalf("failed to register filter api: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	var result []*types.Log
+	err := client.Call(&result, "eth_getLogs", map[string]interface{}{"fromBlock": "0x1", "toBlock": "0x3"})
+	dataErr, ok := err.(rpc.DataError)
+	if !ok {
+		t.Fatalf("error mismatch: have %v, want error with data", err)
+	}
+	if have, want := fmt.Sprint(dataErr.ErrorData()), "map[lastBlock:0x1]"; have != want {
+		t.Errorf("error data mismatch: have %s, want %s", have, want)
+	}
+}
+
+// TestGetLogsLimitsGenesis tests that a log query starting at the genesis block,
+// whose logs alone exceed the result limit, reports no last block to paginate to
+// instead of one within the failing range.
+func TestGetLogsLimitsGenesis(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mux     = new(event.TypeMux)
+		db, _   = ethdb.NewMemDatabase()
+		backend = &testBackend{mux: mux, db: db}
+		ctx     = context.Background()
+
+		addr = common.HexToAddress("0x1111111111111111111111111111111111111111")
+	)
+	writeTestChain(t, db, []*types.Log{{Address: addr, BlockNumber: 1}})
+
+	genesis := core.GetCanonicalHash(db, 0)
+	receipt := types.NewReceipt(nil, new(big.Int))
+	receipt.Logs = []*types.Log{{Address: addr}, {Address: addr}}
+	if err := core.WriteBlockReceipts(db, genesis, 0, types.Receipts{receipt}); err != nil {
+		t.Fatal("error writing block receipts:", err)
+	}
+	api := NewPublicFilterAPI(backend, false, Config{ResultLimit: 1})
+
+	_, err := api.GetLogs(ctx, FilterCriteria{FromBlock: big.NewInt(0), ToBlock: big.NewInt(1)})
+	limitErr, ok := err.(*LimitError)
+	if !ok {
+		t.Fatalf("error mismatch: have %v, want limit error", err)
+	}
+	if limitErr.LastBlock != nil {
+		t.Errorf("last block mismatch: have %d, want none", *limitErr.LastBlock)
+	}
+	if data := limitErr.ErrorData(); data != nil {
+		t.Errorf("error data mismatch: have %v, want none", data)
+	}
+}
+
+// installedFilters returns the number of filters currently installed.
+func installedFilters(api *PublicFilterAPI) int {
+	api.filtersMu.Lock()
+	defer api.filtersMu.Unlock()
+
+	return len(api.filters)
+}
+
+// writeTestChain generates and writes a canonical chain with the given logs
+// mined in the blocks they reference.
+func writeTestChain(t *testing.T, db ethdb.Database, logs []*types.Log) {
+	var head uint64
+	for _, log := range logs {
+		if log.BlockNumber > head {
+			head = log.BlockNumber
+		}
+	}
+	genesis := core.GenesisBlockForTesting(db, common.Address{}, big.NewInt(1000000))
+	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, db, int(head), func(i int, gen *core.BlockGen) {
+		receipt := types.NewReceipt(nil, new(big.Int))
+		for _, log := range logs {
+			if log.BlockNumber == uint64(i+1) {
+				receipt.Logs = append(receipt.Logs, log)
+			}
+		}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		gen.AddUncheckedReceipt(receipt)
+	})
+	for i, block := range chain {
+		core.WriteBlock(db, block)
+		if err := core.WriteCanonicalHash(db, block.Hash(), block.NumberU64()); err != nil {
+			t.Fatalf("failed to insert block number: %v", err)
+		}
+		if err := core.WriteHeadBlockHash(db, block.Hash()); err != nil {
+			t.Fatalf("failed to insert block number: %v", err)
+		}
+		if err := core.WriteBlockReceipts(db, block.Hash(), block.NumberU64(), receipts[i]); err != nil {
+			t.Fatal("error writing block receipts:", err)
+		}
+	}
+}
+
+// sameLog reports whether two logs have the same origin and content, ignoring
+// the encoding differences of logs read back from the database.
+func sameLog(a, b *types.Log) bool {
+	if a.Address != b.Address || a.BlockNumber != b.BlockNumber || len(a.Topics) != len(b.Topics) {
+		return false
+	}
+	for i := range a.Topics {
+		if a.Topics[i] != b.Topics[i] {
+			return false
+		}
+	}
+	return bytes.Equal(a.Data, b.Data)
+}
@@ -24,7 +24,9 @@ import (
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/bitutil"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/bloombits"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
@@ -41,8 +43,32 @@ func makeReceipt(addr common.Address) *types.Receipt {
 	return receipt
 }
 
-func BenchmarkMipmaps(b *testing.B) {
-	dir, err := ioutil.TempDir("", "mipmap")
+// testBloomBitsBlocks is the section size of the bloom bits index in tests.
+const testBloomBitsBlocks = 256
+
+// writeTestBloomBits rotates the header blooms of the canonical chain into the
+// bloom bits index for all the completed test sections.
+func writeTestBloomBits(db ethdb.Database) {
+	head := core.GetBlockNumber(db, core.GetHeadBlockHash(db))
+
+	for section := uint64(0); (section+1)*testBloomBitsBlocks <= head+1; section++ {
+		gen, _ := bloombits.NewGenerator(uint(testBloomBitsBlocks))
+
+		var last common.Hash
+		for i := uint64(0); i < testBloomBitsBlocks; i++ {
+			number := section*testBloomBitsBlocks + i
+			last = core.GetCanonicalHash(db, number)
+			gen.AddBloom(uint(i), core.GetHeader(db, last, number).Bloom)
+		}
+		for i := 0; i < types.BloomBitLength; i++ {
+			bits, _ := gen.Bitset(uint(i))
+			core.WriteBloomBits(db, uint(i), section, last, bitutil.CompressBytes(bits))
+		}
+	}
+}
+
+func BenchmarkFilters(b *testing.B) {
+	dir, err := ioutil.TempDir("", "filtertest")
 	if err != nil {
 		b.Fatal(err)
 	}
@@ -51,7 +77,7 @@ func BenchmarkMipmaps(b *testing.B) {
 	var (
 		db, _   = ethdb.NewLDBDatabase(dir, 0, 0)
 		mux     = new(event.TypeMux)
-		backend = &testBackend{mux, db}
+		backend = &testBackend{mux: mux, db: db}
 		key1, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
 		addr1   = crypto.PubkeyToAddress(key1.PublicKey)
 		addr2   = common.BytesToAddress([]byte("jeff"))
@@ -62,27 +88,20 @@ func BenchmarkMipmaps(b *testing.B) {
 
 	genesis := core.GenesisBlockForTesting(db, addr1, big.NewInt(1000000))
 	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, db, 100010, func(i int, gen *core.BlockGen) {
-		var receipts types.Receipts
 		switch i {
 		case 2403:
 			receipt := makeReceipt(addr1)
-			receipts = types.Receipts{receipt}
 			gen.AddUncheckedReceipt(receipt)
 		case 1034:
 			receipt := makeReceipt(addr2)
-			receipts = types.Receipts{receipt}
 			gen.AddUncheckedReceipt(receipt)
 		case 34:
 			receipt := makeReceipt(addr3)
-			receipts = types.Receipts{receipt}
 			gen.AddUncheckedReceipt(receipt)
 		case 99999:
 			receipt := makeReceipt(addr4)
-			receipts = types.Receipts{receipt}
 			gen.AddUncheckedReceipt(receipt)
-
 		}
-		core.WriteMipmapBloom(db, uint64(i+1), receipts)
 	})
 	for i, block := range chain {
 		core.WriteBlock(db, block)
@@ -96,9 +115,10 @@ func BenchmarkMipmaps(b *testing.B) {
 			b.Fatal("error writing block receipts:", err)
 		}
 	}
+	writeTestBloomBits(db)
 	b.ResetTimer()
 
-	filter := New(backend, true)
+	filter := New(backend)
 	filter.SetAddresses([]common.Address{addr1, addr2, addr3, addr4})
 	filter.SetBeginBlock(0)
 	filter.SetEndBlock(-1)
@@ -112,7 +132,7 @@ func BenchmarkMipmaps(b *testing.B) {
 }
 
 func TestFilters(t *testing.T) {
-	dir, err := ioutil.TempDir("", "mipmap")
+	dir, err := ioutil.TempDir("", "filtertest")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -121,7 +141,7 @@ func TestFilters(t *testing.T) {
 	var (
 		db, _   = ethdb.NewLDBDatabase(dir, 0, 0)
 		mux     = new(event.TypeMux)
-		backend = &testBackend{mux, db}
+		backend = &testBackend{mux: mux, db: db}
 		key1, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
 		addr    = crypto.PubkeyToAddress(key1.PublicKey)
 
@@ -134,7 +154,6 @@ func TestFilters(t *testing.T) {
 
 	genesis := core.GenesisBlockForTesting(db, addr, big.NewInt(1000000))
 	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, db, 1000, func(i int, gen *core.BlockGen) {
-		var receipts types.Receipts
 		switch i {
 		case 1:
 			receipt := types.NewReceipt(nil, new(big.Int))
@@ -145,7 +164,6 @@ func TestFilters(t *testing.T) {
 				},
 			}
 			gen.AddUncheckedReceipt(receipt)
-			receipts = types.Receipts{receipt}
 		case 2:
 			receipt := types.NewReceipt(nil, new(big.Int))
 			receipt.Logs = []*types.Log{
@@ -155,7 +173,6 @@ func TestFilters(t *testing.T) {
 				},
 			}
 			gen.AddUncheckedReceipt(receipt)
-			receipts = types.Receipts{receipt}
 		case 998:
 			receipt := types.NewReceipt(nil, new(big.Int))
 			receipt.Logs = []*types.Log{
@@ -165,7 +182,6 @@ func TestFilters(t *testing.T) {
 				},
 			}
 			gen.AddUncheckedReceipt(receipt)
-			receipts = types.Receipts{receipt}
 		case 999:
 			receipt := types.NewReceipt(nil, new(big.Int))
 			receipt.Logs = []*types.Log{
@@ -175,12 +191,7 @@ func TestFilters(t *testing.T) {
 				},
 			}
 			gen.AddUncheckedReceipt(receipt)
-			receipts = types.Receipts{receipt}
 		}
-		// i is used as block number for the writes but since the i
-		// starts at 0 and block 0 (genesis) is already present increment
-		// by one
-		core.WriteMipmapBloom(db, uint64(i+1), receipts)
 	})
 	for i, block := range chain {
 		core.WriteBlock(db, block)
@@ -194,8 +205,13 @@ func TestFilters(t *testing.T) {
 			t.Fatal("error writing block receipts:", err)
 		}
 	}
+	// Index part of the chain to filter both the indexed and the unindexed blocks
+	writeTestBloomBits(db)
+	if _, sections := backend.BloomStatus(); sections != 3 {
+		t.Fatalf("indexed section count mismatch: have %d, want %d", sections, 3)
+	}
 
-	filter := New(backend, true)
+	filter := New(backend)
 	filter.SetAddresses([]common.Address{addr})
 	filter.SetTopics([][]common.Hash{{hash1, hash2, hash3, hash4}})
 	filter.SetBeginBlock(0)
@@ -206,7 +222,7 @@ func TestFilters(t *testing.T) {
 		t.Error("expected 4 log, got", len(logs))
 	}
 
-	filter = New(backend, true)
+	filter = New(backend)
 	filter.SetAddresses([]common.Address{addr})
 	filter.SetTopics([][]common.Hash{{hash3}})
 	filter.SetBeginBlock(900)
@@ -219,7 +235,7 @@ func TestFilters(t *testing.T) {
 		t.Errorf("expected log[0].Topics[0] to be %x, got %x", hash3, logs[0].Topics[0])
 	}
 
-	filter = New(backend, true)
+	filter = New(backend)
 	filter.SetAddresses([]common.Address{addr})
 	filter.SetTopics([][]common.Hash{{hash3}})
 	filter.SetBeginBlock(990)
@@ -232,7 +248,7 @@ func TestFilters(t *testing.T) {
 		t.Errorf("expected log[0].Topics[0] to be %x, got %x", hash3, logs[0].Topics[0])
 	}
 
-	filter = New(backend, true)
+	filter = New(backend)
 	filter.SetTopics([][]common.Hash{{hash1, hash2}})
 	filter.SetBeginBlock(1)
 	filter.SetEndBlock(10)
@@ -243,7 +259,7 @@ func TestFilters(t *testing.T) {
 	}
 
 	failHash := common.BytesToHash([]byte("fail"))
-	filter = New(backend, true)
+	filter = New(backend)
 	filter.SetTopics([][]common.Hash{{failHash}})
 	filter.SetBeginBlock(0)
 	filter.SetEndBlock(-1)
@@ -254,7 +270,7 @@ func TestFilters(t *testing.T) {
 	}
 
 	failAddr := common.BytesToAddress([]byte("failmenow"))
-	filter = New(backend, true)
+	filter = New(backend)
 	filter.SetAddresses([]common.Address{failAddr})
 	filter.SetBeginBlock(0)
 	filter.SetEndBlock(-1)
@@ -264,7 +280,7 @@ func TestFilters(t *testing.T) {
 		t.Error("expected 0 log, got", len(logs))
 	}
 
-	filter = New(backend, true)
+	filter = New(backend)
 	filter.SetTopics([][]common.Hash{{failHash}, {hash1}})
 	filter.SetBeginBlock(0)
 	filter.SetEndBlock(-1)
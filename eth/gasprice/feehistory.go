@@ -0,0 +1,173 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package gasprice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// maxFeeHistory is the maximum number of blocks a single fee history request
+// may cover.
+const maxFeeHistory = 1024
+
+var errRequestBeyondHead = errors.New("request beyond head block")
+
+// txGasAndReward is a transaction's gas used and effective miner tip, used to
+// compute the reward percentiles of a block.
+type txGasAndReward struct {
+	gasUsed *big.Int
+	reward  *big.Int
+}
+
+type sortGasAndReward []txGasAndReward
+
+func (s sortGasAndReward) Len() int           { return len(s) }
+func (s sortGasAndReward) Less(i, j int) bool { return s[i].reward.Cmp(s[j].reward) < 0 }
+func (s sortGasAndReward) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// FeeHistory returns the base fees, gas used ratios and, if percentiles are
+// requested, the effective tip percentiles (weighted by gas used) of up to
+// blocks consecutive blocks ending at lastBlock. The returned base fees include
+// the one of the block following lastBlock, zero is reported before London.
+func (gpo *Oracle) FeeHistory(ctx context.Context, blocks int, lastBlock rpc.BlockNumber, rewardPercentiles []float64) (oldest *big.Int, reward [][]*big.Int, baseFee []*big.Int, gasUsedRatio []float64, err error) {
+	if blocks < 1 {
+		return new(big.Int), nil, nil, nil, nil
+	}
+	if blocks > maxFeeHistory {
+		blocks = maxFeeHistory
+	}
+	for i, p := range rewardPercentiles {
+		if p < 0 || p > 100 {
+			return nil, nil, nil, nil, fmt.Errorf("invalid reward percentile: %f", p)
+		}
+		if i > 0 && p < rewardPercentiles[i-1] {
+			return nil, nil, nil, nil, fmt.Errorf("invalid reward percentile: #%d:%f > #%d:%f", i-1, rewardPercentiles[i-1], i, p)
+		}
+	}
+	// Pending blocks have no final base fee nor receipts, report the head instead
+	if lastBlock == rpc.PendingBlockNumber {
+		lastBlock = rpc.LatestBlockNumber
+	}
+	head, err := gpo.backend.HeaderByNumber(ctx, lastBlock)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if head == nil {
+		return nil, nil, nil, nil, errRequestBeyondHead
+	}
+	last := head.Number.Uint64()
+	if uint64(blocks) > last+1 {
+		blocks = int(last + 1)
+	}
+	first := last + 1 - uint64(blocks)
+
+	reward = make([][]*big.Int, 0, blocks)
+	baseFee = make([]*big.Int, 0, blocks+1)
+	gasUsedRatio = make([]float64, 0, blocks)
+
+	for number := first; number <= last; number++ {
+		block, err := gpo.backend.BlockByNumber(ctx, rpc.BlockNumber(number))
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		if block == nil {
+			return nil, nil, nil, nil, errRequestBeyondHead
+		}
+		if fee := block.BaseFee(); fee != nil {
+			baseFee = append(baseFee, fee)
+		} else {
+			baseFee = append(baseFee, new(big.Int))
+		}
+		ratio, _ := new(big.Float).Quo(new(big.Float).SetInt(block.GasUsed()), new(big.Float).SetInt(block.GasLimit())).Float64()
+		gasUsedRatio = append(gasUsedRatio, ratio)
+
+		if len(rewardPercentiles) > 0 {
+			rewards, err := gpo.blockRewards(ctx, block, rewardPercentiles)
+			if err != nil {
+				return nil, nil, nil, nil, err
+			}
+			reward = append(reward, rewards)
+		}
+	}
+	// Append the base fee of the block following the requested range
+	if config := gpo.backend.ChainConfig(); config.IsLondon(new(big.Int).SetUint64(last + 1)) {
+		baseFee = append(baseFee, misc.CalcBaseFee(config, head))
+	} else {
+		baseFee = append(baseFee, new(big.Int))
+	}
+	if len(rewardPercentiles) == 0 {
+		reward = nil
+	}
+	return new(big.Int).SetUint64(first), reward, baseFee, gasUsedRatio, nil
+}
+
+// blockRewards computes the effective tip percentiles of a block, weighting
+// each transaction by the gas it used.
+func (gpo *Oracle) blockRewards(ctx context.Context, block *types.Block, percentiles []float64) ([]*big.Int, error) {
+	rewards := make([]*big.Int, len(percentiles))
+	txs := block.Transactions()
+	if len(txs) == 0 {
+		// Empty block, all percentiles are zero
+		for i := range rewards {
+			rewards[i] = new(big.Int)
+		}
+		return rewards, nil
+	}
+	receipts, err := gpo.backend.GetReceipts(ctx, block.Hash())
+	if err != nil {
+		return nil, err
+	}
+	if len(receipts) != len(txs) {
+		return nil, fmt.Errorf("receipt count mismatch for block %d: have %d, want %d", block.NumberU64(), len(receipts), len(txs))
+	}
+	sorter := make(sortGasAndReward, len(txs))
+	for i, tx := range txs {
+		tip, _ := tx.EffectiveGasTip(block.BaseFee())
+		if tip == nil {
+			tip = new(big.Int)
+		}
+		used := new(big.Int).Set(receipts[i].CumulativeGasUsed)
+		if i > 0 {
+			used.Sub(used, receipts[i-1].CumulativeGasUsed)
+		}
+		sorter[i] = txGasAndReward{gasUsed: used, reward: tip}
+	}
+	sort.Sort(sorter)
+
+	var (
+		txIndex int
+		sumUsed = new(big.Int).Set(sorter[0].gasUsed)
+		limit   = new(big.Float).SetInt(block.GasUsed())
+	)
+	for i, p := range percentiles {
+		threshold, _ := new(big.Float).Mul(limit, big.NewFloat(p/100)).Int(nil)
+		for sumUsed.Cmp(threshold) < 0 && txIndex < len(txs)-1 {
+			txIndex++
+			sumUsed.Add(sumUsed, sorter[txIndex].gasUsed)
+		}
+		rewards[i] = sorter[txIndex].reward
+	}
+	return rewards, nil
+}
@@ -23,17 +23,24 @@ import (
 	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
-var maxPrice = big.NewInt(500 * params.Shannon)
+// sampleNumber is the number of cheapest transactions sampled from each block.
+const sampleNumber = 3
+
+// DefaultMaxPrice is the highest gas price the oracle recommends by default.
+var DefaultMaxPrice = big.NewInt(500 * params.Shannon)
 
 type Config struct {
 	Blocks     int
 	Percentile int
 	Default    *big.Int `toml:",omitempty"`
+	MaxPrice   *big.Int `toml:",omitempty"`
 }
 
 // Oracle recommends gas prices based on the content of recent
@@ -42,11 +49,13 @@ type Oracle struct {
 	backend   ethapi.Backend
 	lastHead  common.Hash
 	lastPrice *big.Int
+	lastTip   *big.Int
 	cacheLock sync.RWMutex
 	fetchLock sync.Mutex
 
 	checkBlocks, maxEmpty, maxBlocks int
 	percentile                       int
+	maxPrice                         *big.Int
 }
 
 // NewOracle returns a new oracle.
@@ -62,27 +71,51 @@ func NewOracle(backend ethapi.Backend, params Config) *Oracle {
 	if percent > 100 {
 		percent = 100
 	}
+	maxPrice := params.MaxPrice
+	if maxPrice == nil {
+		maxPrice = DefaultMaxPrice
+	} else if maxPrice.Sign() <= 0 {
+		maxPrice = DefaultMaxPrice
+		log.Warn("Sanitizing invalid gasprice oracle max price", "provided", params.MaxPrice, "updated", maxPrice)
+	}
 	return &Oracle{
 		backend:     backend,
 		lastPrice:   params.Default,
+		lastTip:     params.Default,
 		checkBlocks: blocks,
 		maxEmpty:    blocks / 2,
 		maxBlocks:   blocks * 5,
 		percentile:  percent,
+		maxPrice:    maxPrice,
 	}
 }
 
 // SuggestPrice returns the recommended gas price.
 func (gpo *Oracle) SuggestPrice(ctx context.Context) (*big.Int, error) {
+	price, _, err := gpo.suggest(ctx)
+	return price, err
+}
+
+// SuggestTipCap returns the recommended tip per gas for dynamic fee transactions,
+// based on the effective tips miners received in recent blocks. Before London
+// the whole gas price counts as tip.
+func (gpo *Oracle) SuggestTipCap(ctx context.Context) (*big.Int, error) {
+	_, tip, err := gpo.suggest(ctx)
+	return tip, err
+}
+
+// suggest returns the recommended gas price and tip for the current head,
+// sampling recent blocks if the head changed since the last call.
+func (gpo *Oracle) suggest(ctx context.Context) (*big.Int, *big.Int, error) {
 	gpo.cacheLock.RLock()
 	lastHead := gpo.lastHead
-	lastPrice := gpo.lastPrice
+	lastPrice, lastTip := gpo.lastPrice, gpo.lastTip
 	gpo.cacheLock.RUnlock()
 
 	head, _ := gpo.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
 	headHash := head.Hash()
 	if headHash == lastHead {
-		return lastPrice, nil
+		return lastPrice, lastTip, nil
 	}
 
 	gpo.fetchLock.Lock()
@@ -91,17 +124,17 @@ func (gpo *Oracle) SuggestPrice(ctx context.Context) (*big.Int, error) {
 	// try checking the cache again, maybe the last fetch fetched what we need
 	gpo.cacheLock.RLock()
 	lastHead = gpo.lastHead
-	lastPrice = gpo.lastPrice
+	lastPrice, lastTip = gpo.lastPrice, gpo.lastTip
 	gpo.cacheLock.RUnlock()
 	if headHash == lastHead {
-		return lastPrice, nil
+		return lastPrice, lastTip, nil
 	}
 
 	blockNum := head.Number.Uint64()
 	ch := make(chan getBlockPricesResult, gpo.checkBlocks)
 	sent := 0
 	exp := 0
-	var txPrices []*big.Int
+	var txPrices, txTips []*big.Int
 	for sent < gpo.checkBlocks && blockNum > 0 {
 		go gpo.getBlockPrices(ctx, blockNum, ch)
 		sent++
@@ -112,11 +145,12 @@ func (gpo *Oracle) SuggestPrice(ctx context.Context) (*big.Int, error) {
 	for exp > 0 {
 		res := <-ch
 		if res.err != nil {
-			return lastPrice, res.err
+			return lastPrice, lastTip, res.err
 		}
 		exp--
 		if len(res.prices) > 0 {
 			txPrices = append(txPrices, res.prices...)
+			txTips = append(txTips, res.tips...)
 			continue
 		}
 		if maxEmpty > 0 {
@@ -130,41 +164,71 @@ func (gpo *Oracle) SuggestPrice(ctx context.Context) (*big.Int, error) {
 			blockNum--
 		}
 	}
-	price := lastPrice
-	if len(txPrices) > 0 {
-		sort.Sort(bigIntArray(txPrices))
-		price = txPrices[(len(txPrices)-1)*gpo.percentile/100]
-	}
-	if price.Cmp(maxPrice) > 0 {
-		price = new(big.Int).Set(maxPrice)
-	}
+	price, tip := gpo.pick(txPrices, lastPrice), gpo.pick(txTips, lastTip)
 
 	gpo.cacheLock.Lock()
 	gpo.lastHead = headHash
 	gpo.lastPrice = price
+	gpo.lastTip = tip
 	gpo.cacheLock.Unlock()
-	return price, nil
+	return price, tip, nil
+}
+
+// pick returns the configured percentile of the sampled values, capped at the
+// maximum price, or the fallback if there are no samples.
+func (gpo *Oracle) pick(samples []*big.Int, fallback *big.Int) *big.Int {
+	price := fallback
+	if len(samples) > 0 {
+		sort.Sort(bigIntArray(samples))
+		price = samples[(len(samples)-1)*gpo.percentile/100]
+	}
+	if price.Cmp(gpo.maxPrice) > 0 {
+		price = new(big.Int).Set(gpo.maxPrice)
+	}
+	return price
 }
 
 type getBlockPricesResult struct {
 	prices []*big.Int
+	tips   []*big.Int
 	err    error
 }
 
-// getLowestPrice calculates the lowest transaction gas price in a given block
-// and sends it to the result channel. If the block is empty, price is nil.
+// getBlockPrices samples the gas prices and effective miner tips of the cheapest
+// transactions in a given block and sends them to the result channel.
 func (gpo *Oracle) getBlockPrices(ctx context.Context, blockNum uint64, ch chan getBlockPricesResult) {
 	block, err := gpo.backend.BlockByNumber(ctx, rpc.BlockNumber(blockNum))
 	if block == nil {
-		ch <- getBlockPricesResult{nil, err}
+		ch <- getBlockPricesResult{nil, nil, err}
 		return
 	}
-	txs := block.Transactions()
-	prices := make([]*big.Int, len(txs))
-	for i, tx := range txs {
-		prices[i] = tx.GasPrice()
+	signer := types.MakeSigner(gpo.backend.ChainConfig(), block.Number())
+	prices, tips := sampleBlockPrices(block, signer, sampleNumber)
+	ch <- getBlockPricesResult{prices, tips, nil}
+}
+
+// sampleBlockPrices returns the lowest limit gas prices and effective miner tips
+// paid by the transactions of a block. Transactions sent by the block's miner are
+// skipped, as the miner can include them at any price.
+func sampleBlockPrices(block *types.Block, signer types.Signer, limit int) ([]*big.Int, []*big.Int) {
+	var prices, tips []*big.Int
+	for _, tx := range block.Transactions() {
+		if sender, err := types.Sender(signer, tx); err != nil || sender == block.Coinbase() {
+			continue
+		}
+		tip, err := tx.EffectiveGasTip(block.BaseFee())
+		if err != nil {
+			continue // can't happen for included transactions
+		}
+		prices = append(prices, tx.GasPrice())
+		tips = append(tips, tip)
+	}
+	sort.Sort(bigIntArray(prices))
+	sort.Sort(bigIntArray(tips))
+	if len(prices) > limit {
+		prices, tips = prices[:limit], tips[:limit]
 	}
-	ch <- getBlockPricesResult{prices, nil}
+	return prices, tips
 }
 
 type bigIntArray []*big.Int
@@ -0,0 +1,61 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package gasprice
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Tests that only the cheapest transactions of a block are sampled, ignoring
+// the ones sent by the miner itself.
+func TestSampleBlockPrices(t *testing.T) {
+	var (
+		miner, _ = crypto.GenerateKey()
+		user, _  = crypto.GenerateKey()
+		signer   = types.HomesteadSigner{}
+	)
+	var txs []*types.Transaction
+	for i, price := range []int64{50, 10, 40, 30, 20} {
+		tx, _ := types.SignTx(types.NewTransaction(uint64(i), common.Address{}, big.NewInt(0), big.NewInt(21000), big.NewInt(price), nil), signer, user)
+		txs = append(txs, tx)
+	}
+	// The miner stuffs its own block with free transactions
+	free, _ := types.SignTx(types.NewTransaction(0, common.Address{}, big.NewInt(0), big.NewInt(21000), big.NewInt(0), nil), signer, miner)
+	txs = append(txs, free)
+
+	header := &types.Header{Number: big.NewInt(1), Coinbase: crypto.PubkeyToAddress(miner.PublicKey)}
+	block := types.NewBlock(header, txs, nil, nil)
+
+	prices, tips := sampleBlockPrices(block, signer, 3)
+	want := []int64{10, 20, 30}
+	if len(prices) != len(want) || len(tips) != len(want) {
+		t.Fatalf("sample count mismatch: have %d prices and %d tips, want %d", len(prices), len(tips), len(want))
+	}
+	for i := range want {
+		if prices[i].Int64() != want[i] {
+			t.Errorf("price %d mismatch: have %v, want %d", i, prices[i], want[i])
+		}
+		if tips[i].Int64() != want[i] {
+			t.Errorf("tip %d mismatch: have %v, want %d", i, tips[i], want[i])
+		}
+	}
+}
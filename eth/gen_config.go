@@ -4,6 +4,7 @@ package eth
 
 import (
 	"math/big"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
@@ -17,15 +18,26 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		Genesis                 *core.Genesis `toml:",omitempty"`
 		NetworkId               uint64
 		SyncMode                downloader.SyncMode
-		LightServ               int  `toml:",omitempty"`
-		LightPeers              int  `toml:",omitempty"`
-		MaxPeers                int  `toml:"-"`
-		SkipBcVersionCheck      bool `toml:"-"`
-		DatabaseHandles         int  `toml:"-"`
+		PivotStale              uint64                 `toml:",omitempty"`
+		TxLookupLimit           uint64                 `toml:",omitempty"`
+		Checkpoint              *downloader.Checkpoint `toml:",omitempty"`
+		Whitelist               map[uint64]common.Hash `toml:"-"`
+		LightServ               int                    `toml:",omitempty"`
+		LightPeers              int                    `toml:",omitempty"`
+		MaxPeers                int                    `toml:"-"`
+		LightPriority           []string               `toml:",omitempty"`
+		ULC                     *ULCConfig             `toml:",omitempty"`
+		SkipBcVersionCheck      bool                   `toml:"-"`
+		DatabaseHandles         int                    `toml:"-"`
 		DatabaseCache           int
+		DatabaseFreezer         string
+		TrieCache               int
+		NoPruning               bool
 		Etherbase               common.Address `toml:",omitempty"`
 		MinerThreads            int            `toml:",omitempty"`
-		ExtraData               hexutil.Bytes  `toml:",omitempty"`
+		MinerNotify             []string       `toml:",omitempty"`
+		MinerRecommit           time.Duration
+		ExtraData               hexutil.Bytes `toml:",omitempty"`
 		GasPrice                *big.Int
 		EthashCacheDir          string
 		EthashCachesInMem       int
@@ -36,6 +48,11 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		TxPool                  core.TxPoolConfig
 		GPO                     gasprice.Config
 		EnablePreimageRecording bool
+		RPCGasCap               *big.Int `toml:",omitempty"`
+		RPCEVMTimeout           time.Duration
+		FilterTimeout           time.Duration
+		LogsRangeLimit          uint64
+		LogsResultLimit         int
 		DocRoot                 string `toml:"-"`
 		PowFake                 bool   `toml:"-"`
 		PowTest                 bool   `toml:"-"`
@@ -45,14 +62,25 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.Genesis = c.Genesis
 	enc.NetworkId = c.NetworkId
 	enc.SyncMode = c.SyncMode
+	enc.PivotStale = c.PivotStale
+	enc.TxLookupLimit = c.TxLookupLimit
+	enc.Checkpoint = c.Checkpoint
+	enc.Whitelist = c.Whitelist
 	enc.LightServ = c.LightServ
 	enc.LightPeers = c.LightPeers
 	enc.MaxPeers = c.MaxPeers
+	enc.LightPriority = c.LightPriority
+	enc.ULC = c.ULC
 	enc.SkipBcVersionCheck = c.SkipBcVersionCheck
 	enc.DatabaseHandles = c.DatabaseHandles
 	enc.DatabaseCache = c.DatabaseCache
+	enc.DatabaseFreezer = c.DatabaseFreezer
+	enc.TrieCache = c.TrieCache
+	enc.NoPruning = c.NoPruning
 	enc.Etherbase = c.Etherbase
 	enc.MinerThreads = c.MinerThreads
+	enc.MinerNotify = c.MinerNotify
+	enc.MinerRecommit = c.MinerRecommit
 	enc.ExtraData = c.ExtraData
 	enc.GasPrice = c.GasPrice
 	enc.EthashCacheDir = c.EthashCacheDir
@@ -64,6 +92,11 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.TxPool = c.TxPool
 	enc.GPO = c.GPO
 	enc.EnablePreimageRecording = c.EnablePreimageRecording
+	enc.RPCGasCap = c.RPCGasCap
+	enc.RPCEVMTimeout = c.RPCEVMTimeout
+	enc.FilterTimeout = c.FilterTimeout
+	enc.LogsRangeLimit = c.LogsRangeLimit
+	enc.LogsResultLimit = c.LogsResultLimit
 	enc.DocRoot = c.DocRoot
 	enc.PowFake = c.PowFake
 	enc.PowTest = c.PowTest
@@ -76,15 +109,26 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		Genesis                 *core.Genesis `toml:",omitempty"`
 		NetworkId               *uint64
 		SyncMode                *downloader.SyncMode
-		LightServ               *int  `toml:",omitempty"`
-		LightPeers              *int  `toml:",omitempty"`
-		MaxPeers                *int  `toml:"-"`
-		SkipBcVersionCheck      *bool `toml:"-"`
-		DatabaseHandles         *int  `toml:"-"`
+		PivotStale              *uint64                `toml:",omitempty"`
+		TxLookupLimit           *uint64                `toml:",omitempty"`
+		Checkpoint              *downloader.Checkpoint `toml:",omitempty"`
+		Whitelist               map[uint64]common.Hash `toml:"-"`
+		LightServ               *int                   `toml:",omitempty"`
+		LightPeers              *int                   `toml:",omitempty"`
+		MaxPeers                *int                   `toml:"-"`
+		LightPriority           []string               `toml:",omitempty"`
+		ULC                     *ULCConfig             `toml:",omitempty"`
+		SkipBcVersionCheck      *bool                  `toml:"-"`
+		DatabaseHandles         *int                   `toml:"-"`
 		DatabaseCache           *int
+		DatabaseFreezer         *string
+		TrieCache               *int
+		NoPruning               *bool
 		Etherbase               *common.Address `toml:",omitempty"`
 		MinerThreads            *int            `toml:",omitempty"`
-		ExtraData               hexutil.Bytes   `toml:",omitempty"`
+		MinerNotify             []string        `toml:",omitempty"`
+		MinerRecommit           *time.Duration
+		ExtraData               hexutil.Bytes `toml:",omitempty"`
 		GasPrice                *big.Int
 		EthashCacheDir          *string
 		EthashCachesInMem       *int
@@ -95,6 +139,11 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		TxPool                  *core.TxPoolConfig
 		GPO                     *gasprice.Config
 		EnablePreimageRecording *bool
+		RPCGasCap               *big.Int `toml:",omitempty"`
+		RPCEVMTimeout           *time.Duration
+		FilterTimeout           *time.Duration
+		LogsRangeLimit          *uint64
+		LogsResultLimit         *int
 		DocRoot                 *string `toml:"-"`
 		PowFake                 *bool   `toml:"-"`
 		PowTest                 *bool   `toml:"-"`
@@ -113,12 +162,30 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.SyncMode != nil {
 		c.SyncMode = *dec.SyncMode
 	}
+	if dec.PivotStale != nil {
+		c.PivotStale = *dec.PivotStale
+	}
+	if dec.TxLookupLimit != nil {
+		c.TxLookupLimit = *dec.TxLookupLimit
+	}
+	if dec.Checkpoint != nil {
+		c.Checkpoint = dec.Checkpoint
+	}
+	if dec.Whitelist != nil {
+		c.Whitelist = dec.Whitelist
+	}
 	if dec.LightServ != nil {
 		c.LightServ = *dec.LightServ
 	}
 	if dec.LightPeers != nil {
 		c.LightPeers = *dec.LightPeers
 	}
+	if dec.LightPriority != nil {
+		c.LightPriority = dec.LightPriority
+	}
+	if dec.ULC != nil {
+		c.ULC = dec.ULC
+	}
 	if dec.MaxPeers != nil {
 		c.MaxPeers = *dec.MaxPeers
 	}
@@ -131,12 +198,27 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.DatabaseCache != nil {
 		c.DatabaseCache = *dec.DatabaseCache
 	}
+	if dec.DatabaseFreezer != nil {
+		c.DatabaseFreezer = *dec.DatabaseFreezer
+	}
+	if dec.TrieCache != nil {
+		c.TrieCache = *dec.TrieCache
+	}
+	if dec.NoPruning != nil {
+		c.NoPruning = *dec.NoPruning
+	}
 	if dec.Etherbase != nil {
 		c.Etherbase = *dec.Etherbase
 	}
 	if dec.MinerThreads != nil {
 		c.MinerThreads = *dec.MinerThreads
 	}
+	if dec.MinerNotify != nil {
+		c.MinerNotify = dec.MinerNotify
+	}
+	if dec.MinerRecommit != nil {
+		c.MinerRecommit = *dec.MinerRecommit
+	}
 	if dec.ExtraData != nil {
 		c.ExtraData = dec.ExtraData
 	}
@@ -170,6 +252,21 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.EnablePreimageRecording != nil {
 		c.EnablePreimageRecording = *dec.EnablePreimageRecording
 	}
+	if dec.RPCGasCap != nil {
+		c.RPCGasCap = dec.RPCGasCap
+	}
+	if dec.RPCEVMTimeout != nil {
+		c.RPCEVMTimeout = *dec.RPCEVMTimeout
+	}
+	if dec.FilterTimeout != nil {
+		c.FilterTimeout = *dec.FilterTimeout
+	}
+	if dec.LogsRangeLimit != nil {
+		c.LogsRangeLimit = *dec.LogsRangeLimit
+	}
+	if dec.LogsResultLimit != nil {
+		c.LogsResultLimit = *dec.LogsResultLimit
+	}
 	if dec.DocRoot != nil {
 		c.DocRoot = *dec.DocRoot
 	}
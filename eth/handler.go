@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"math"
 	"math/big"
+	"math/rand"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -33,6 +34,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/eth/fetcher"
+	"github.com/ethereum/go-ethereum/eth/snap"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
@@ -45,6 +47,10 @@ import (
 const (
 	softResponseLimit = 2 * 1024 * 1024 // Target maximum size of returned blocks, headers or node data.
 	estHeaderRlpSize  = 500             // Approximate size of an RLP encoded block header
+
+	// txChanSize is the size of channel listening to NewTxsEvent.
+	// The number is referenced from the size of tx pool.
+	txChanSize = 4096
 )
 
 var (
@@ -55,6 +61,10 @@ var (
 // not compatible (low protocol version restrictions and high requirements).
 var errIncompatibleConfig = errors.New("incompatible configuration")
 
+// errWhitelistMismatch is returned if a peer serves a header contradicting one of
+// the locally whitelisted blocks, i.e. it's on the wrong side of a fork.
+var errWhitelistMismatch = errors.New("whitelist block mismatch")
+
 func errResp(code errCode, format string, v ...interface{}) error {
 	return fmt.Errorf("%v - %v", code, fmt.Sprintf(format, v...))
 }
@@ -62,24 +72,29 @@ func errResp(code errCode, format string, v ...interface{}) error {
 type ProtocolManager struct {
 	networkId uint64
 
-	fastSync  uint32 // Flag whether fast sync is enabled (gets disabled if we already have blocks)
-	acceptTxs uint32 // Flag whether we're considered synchronised (enables transaction processing)
+	fastSync       uint32 // Flag whether fast sync is enabled (gets disabled if we already have blocks)
+	checkpointSync uint32 // Flag whether checkpoint sync is enabled (gets disabled if we already have blocks)
+	acceptTxs      uint32 // Flag whether we're considered synchronised (enables transaction processing)
 
 	txpool      txPool
 	blockchain  *core.BlockChain
 	chaindb     ethdb.Database
 	chainconfig *params.ChainConfig
 	maxPeers    int
+	whitelist   map[uint64]common.Hash
 
 	downloader *downloader.Downloader
 	fetcher    *fetcher.Fetcher
+	txFetcher  *fetcher.TxFetcher
 	peers      *peerSet
 
 	SubProtocols []p2p.Protocol
 
-	eventMux      *event.TypeMux
-	txSub         *event.TypeMuxSubscription
-	minedBlockSub *event.TypeMuxSubscription
+	eventMux       *event.TypeMux
+	txsCh          chan core.NewTxsEvent
+	txsSub         event.Subscription
+	rebroadcastSub *event.TypeMuxSubscription
+	minedBlockSub  *event.TypeMuxSubscription
 
 	// channels for fetcher, syncer, txsyncLoop
 	newPeerCh   chan *peer
@@ -94,7 +109,7 @@ type ProtocolManager struct {
 
 // NewProtocolManager returns a new ethereum sub protocol manager. The Ethereum sub protocol manages peers capable
 // with the ethereum network.
-func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, networkId uint64, maxPeers int, mux *event.TypeMux, txpool txPool, engine consensus.Engine, blockchain *core.BlockChain, chaindb ethdb.Database) (*ProtocolManager, error) {
+func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, networkId uint64, maxPeers int, mux *event.TypeMux, txpool txPool, engine consensus.Engine, blockchain *core.BlockChain, chaindb ethdb.Database, whitelist map[uint64]common.Hash) (*ProtocolManager, error) {
 	// Create the protocol manager with the base fields
 	manager := &ProtocolManager{
 		networkId:   networkId,
@@ -104,6 +119,7 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 		chaindb:     chaindb,
 		chainconfig: config,
 		maxPeers:    maxPeers,
+		whitelist:   whitelist,
 		peers:       newPeerSet(),
 		newPeerCh:   make(chan *peer),
 		noMorePeers: make(chan struct{}),
@@ -118,11 +134,18 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 	if mode == downloader.FastSync {
 		manager.fastSync = uint32(1)
 	}
+	if mode == downloader.CheckpointSync && blockchain.CurrentBlock().NumberU64() > 0 {
+		log.Warn("Blockchain not empty, checkpoint sync disabled")
+		mode = downloader.FullSync
+	}
+	if mode == downloader.CheckpointSync {
+		manager.checkpointSync = uint32(1)
+	}
 	// Initiate a sub-protocol for every implemented version we can handle
 	manager.SubProtocols = make([]p2p.Protocol, 0, len(ProtocolVersions))
 	for i, version := range ProtocolVersions {
 		// Skip protocol version if incompatible with the mode of operation
-		if mode == downloader.FastSync && version < eth63 {
+		if (mode == downloader.FastSync || mode == downloader.CheckpointSync) && version < eth63 {
 			continue
 		}
 		// Compatible; initialise the sub-protocol
@@ -147,7 +170,9 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 			},
 			PeerInfo: func(id discover.NodeID) interface{} {
 				if p := manager.peers.Peer(fmt.Sprintf("%x", id[:8])); p != nil {
-					return p.Info()
+					info := p.Info()
+					info.Download = manager.downloader.PeerStats(p.id)
+					return info
 				}
 				return nil
 			},
@@ -156,6 +181,9 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 	if len(manager.SubProtocols) == 0 {
 		return nil, errIncompatibleConfig
 	}
+	// Serve and retrieve state ranges over the snap protocol alongside eth
+	manager.SubProtocols = append(manager.SubProtocols, snap.MakeProtocols((*snapHandler)(manager))...)
+
 	// Construct the different synchronisation mechanisms
 	manager.downloader = downloader.New(mode, chaindb, manager.eventMux, blockchain, nil, manager.removePeer)
 
@@ -166,8 +194,8 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 		return blockchain.CurrentBlock().NumberU64()
 	}
 	inserter := func(blocks types.Blocks) (int, error) {
-		// If fast sync is running, deny importing weird blocks
-		if atomic.LoadUint32(&manager.fastSync) == 1 {
+		// If fast or checkpoint sync is running, deny importing weird blocks
+		if atomic.LoadUint32(&manager.fastSync) == 1 || atomic.LoadUint32(&manager.checkpointSync) == 1 {
 			log.Warn("Discarded bad propagated block", "number", blocks[0].Number(), "hash", blocks[0].Hash())
 			return 0, nil
 		}
@@ -176,6 +204,19 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 	}
 	manager.fetcher = fetcher.New(blockchain.GetBlockByHash, validator, manager.BroadcastBlock, heighter, inserter, manager.removePeer)
 
+	// Construct the transaction fetcher retrieving announced pool transactions
+	hasTx := func(hash common.Hash) bool {
+		return manager.txpool.Get(hash) != nil
+	}
+	fetchTxs := func(id string, hashes []common.Hash) error {
+		p := manager.peers.Peer(id)
+		if p == nil {
+			return errNotRegistered
+		}
+		return p.RequestTxs(hashes)
+	}
+	manager.txFetcher = fetcher.NewTxFetcher(hasTx, manager.txpool.AddRemotes, fetchTxs)
+
 	return manager, nil
 }
 
@@ -189,6 +230,7 @@ func (pm *ProtocolManager) removePeer(id string) {
 
 	// Unregister the peer from the downloader and Ethereum peer set
 	pm.downloader.UnregisterPeer(id)
+	pm.txFetcher.Drop(id)
 	if err := pm.peers.Unregister(id); err != nil {
 		log.Error("Peer removal failed", "peer", id, "err", err)
 	}
@@ -200,8 +242,13 @@ func (pm *ProtocolManager) removePeer(id string) {
 
 func (pm *ProtocolManager) Start() {
 	// broadcast transactions
-	pm.txSub = pm.eventMux.Subscribe(core.TxPreEvent{})
+	pm.txsCh = make(chan core.NewTxsEvent, txChanSize)
+	pm.txsSub = pm.txpool.SubscribeNewTxsEvent(pm.txsCh)
 	go pm.txBroadcastLoop()
+
+	// rebroadcast stale local transactions
+	pm.rebroadcastSub = pm.eventMux.Subscribe(core.TxRebroadcastEvent{})
+	go pm.txRebroadcastLoop()
 	// broadcast mined blocks
 	pm.minedBlockSub = pm.eventMux.Subscribe(core.NewMinedBlockEvent{})
 	go pm.minedBroadcastLoop()
@@ -209,13 +256,16 @@ func (pm *ProtocolManager) Start() {
 	// start sync handlers
 	go pm.syncer()
 	go pm.txsyncLoop()
+	pm.txFetcher.Start()
 }
 
 func (pm *ProtocolManager) Stop() {
 	log.Info("Stopping Ethereum protocol")
 
-	pm.txSub.Unsubscribe()         // quits txBroadcastLoop
-	pm.minedBlockSub.Unsubscribe() // quits blockBroadcastLoop
+	pm.txsSub.Unsubscribe()         // quits txBroadcastLoop
+	pm.rebroadcastSub.Unsubscribe() // quits txRebroadcastLoop
+	pm.minedBlockSub.Unsubscribe()  // quits blockBroadcastLoop
+	pm.txFetcher.Stop()             // quits txFetcher
 
 	// Quit the sync loop.
 	// After this send has completed, no new peers will be accepted.
@@ -291,6 +341,12 @@ func (pm *ProtocolManager) handle(p *peer) error {
 			}
 		}()
 	}
+	// If we have any explicitly whitelisted blocks, request them for validation
+	for number := range pm.whitelist {
+		if err := p.RequestHeadersByNumber(number, 1, 0, false); err != nil {
+			return err
+		}
+	}
 	// main loop. handle incoming messages.
 	for {
 		if err := pm.handleMsg(p); err != nil {
@@ -404,6 +460,16 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		if err := msg.Decode(&headers); err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
+		// If any of the headers contradicts the whitelist, the peer is on another fork
+		for _, header := range headers {
+			if want, ok := pm.whitelist[header.Number.Uint64()]; ok {
+				if hash := header.Hash(); hash != want {
+					p.Log().Info("Whitelist mismatch, dropping peer", "number", header.Number, "hash", hash, "want", want)
+					return errWhitelistMismatch
+				}
+				p.Log().Debug("Whitelist block verified", "number", header.Number, "hash", want)
+			}
+		}
 		// If no headers were received, but we're expending a DAO fork check, maybe it's that
 		if len(headers) == 0 && p.forkDrop != nil {
 			// Possibly an empty reply to the fork header checks, sanity check TDs
@@ -442,7 +508,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 				return nil
 			}
 			// Irrelevant of the fork checks, send the header to the fetcher just in case
-			headers = pm.fetcher.FilterHeaders(headers, time.Now())
+			headers = pm.fetcher.FilterHeaders(p.id, headers, time.Now())
 		}
 		if len(headers) > 0 || !filter {
 			err := pm.downloader.DeliverHeaders(p.id, headers)
@@ -495,7 +561,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		// Filter out any explicitly requested bodies, deliver the rest to the downloader
 		filter := len(trasactions) > 0 || len(uncles) > 0
 		if filter {
-			trasactions, uncles = pm.fetcher.FilterBodies(trasactions, uncles, time.Now())
+			trasactions, uncles = pm.fetcher.FilterBodies(p.id, trasactions, uncles, time.Now())
 		}
 		if len(trasactions) > 0 || len(uncles) > 0 || !filter {
 			err := pm.downloader.DeliverBodies(p.id, trasactions, uncles)
@@ -524,7 +590,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 				return errResp(ErrDecode, "msg %v: %v", msg, err)
 			}
 			// Retrieve the requested state entry, stopping if enough was found
-			if entry, err := pm.chaindb.Get(hash.Bytes()); err == nil {
+			if entry, err := pm.blockchain.TrieDB().Get(hash.Bytes()); err == nil {
 				data = append(data, entry)
 				bytes += len(entry)
 			}
@@ -658,7 +724,73 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			}
 			p.MarkTransaction(tx.Hash())
 		}
-		pm.txpool.AddRemotes(txs)
+		pm.txFetcher.Enqueue(p.id, txs, false)
+
+	case p.version >= eth65 && msg.Code == NewPooledTransactionHashesMsg:
+		// New transaction hashes were announced, schedule the unknown ones for retrieval
+		if atomic.LoadUint32(&pm.acceptTxs) == 0 {
+			break
+		}
+		var hashes []common.Hash
+		if err := msg.Decode(&hashes); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		// Mark the hashes as present at the remote node
+		for _, hash := range hashes {
+			p.MarkTransaction(hash)
+		}
+		pm.txFetcher.Notify(p.id, hashes)
+
+	case p.version >= eth65 && msg.Code == GetPooledTransactionsMsg:
+		// Decode the retrieval message
+		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
+		if _, err := msgStream.List(); err != nil {
+			return err
+		}
+		// Gather transactions until the fetch or network limits is reached
+		var (
+			hash   common.Hash
+			bytes  int
+			hashes []common.Hash
+			txs    []rlp.RawValue
+		)
+		for bytes < softResponseLimit {
+			// Retrieve the hash of the next transaction
+			if err := msgStream.Decode(&hash); err == rlp.EOL {
+				break
+			} else if err != nil {
+				return errResp(ErrDecode, "msg %v: %v", msg, err)
+			}
+			// Retrieve the requested transaction, skipping if unknown to us
+			tx := pm.txpool.Get(hash)
+			if tx == nil {
+				continue
+			}
+			// If known, encode and queue for response packet
+			if encoded, err := rlp.EncodeToBytes(tx); err != nil {
+				log.Error("Failed to encode transaction", "err", err)
+			} else {
+				hashes = append(hashes, hash)
+				txs = append(txs, encoded)
+				bytes += len(encoded)
+			}
+		}
+		return p.SendPooledTransactionsRLP(hashes, txs)
+
+	case p.version >= eth65 && msg.Code == PooledTransactionsMsg:
+		// A batch of transactions arrived to one of our previous requests
+		var txs []*types.Transaction
+		if err := msg.Decode(&txs); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		for i, tx := range txs {
+			// Validate and mark the remote transaction
+			if tx == nil {
+				return errResp(ErrDecode, "transaction %d is nil", i)
+			}
+			p.MarkTransaction(tx.Hash())
+		}
+		pm.txFetcher.Enqueue(p.id, txs, true)
 
 	default:
 		return errResp(ErrInvalidMsgCode, "%v", msg.Code)
@@ -698,16 +830,53 @@ func (pm *ProtocolManager) BroadcastBlock(block *types.Block, propagate bool) {
 	}
 }
 
-// BroadcastTx will propagate a transaction to all peers which are not known to
-// already have the given transaction.
-func (pm *ProtocolManager) BroadcastTx(hash common.Hash, tx *types.Transaction) {
-	// Broadcast transaction to a batch of peers not knowing about it
-	peers := pm.peers.PeersWithoutTx(hash)
-	//FIXME include this again: peers = peers[:int(math.Sqrt(float64(len(peers))))]
-	for _, peer := range peers {
-		peer.SendTransactions(types.Transactions{tx})
+// BroadcastTxs will propagate a batch of transactions to all peers which are not
+// known to already have the given transaction. The full transactions are only
+// sent to a subset of the peers (and all legacy ones), the rest only get an
+// announcement.
+func (pm *ProtocolManager) BroadcastTxs(txs types.Transactions) {
+	var (
+		txset = make(map[*peer]types.Transactions)
+		annos = make(map[*peer][]common.Hash)
+	)
+	// Broadcast transactions to a batch of peers not knowing about it
+	for _, tx := range txs {
+		peers := pm.peers.PeersWithoutTx(tx.Hash())
+		transfer := int(math.Sqrt(float64(len(peers))))
+
+		sent := 0
+		for _, peer := range peers {
+			if peer.version < eth65 || sent < transfer {
+				txset[peer] = append(txset[peer], tx)
+				sent++
+			} else {
+				annos[peer] = append(annos[peer], tx.Hash())
+			}
+		}
+		log.Trace("Broadcast transaction", "hash", tx.Hash(), "recipients", sent, "announced", len(peers)-sent)
+	}
+	for peer, txs := range txset {
+		peer.SendTransactions(txs)
+	}
+	for peer, hashes := range annos {
+		peer.SendNewPooledTransactionHashes(hashes)
 	}
-	log.Trace("Broadcast transaction", "hash", hash, "recipients", len(peers))
+}
+
+// RebroadcastTxs propagates a batch of local transactions again, irrespective of
+// whether peers are already known to have them, since they may well have been
+// dropped remotely in the meantime. Only a random subset of the peers receives
+// the batch, the rest will learn about them from those.
+func (pm *ProtocolManager) RebroadcastTxs(txs types.Transactions) {
+	peers := pm.peers.AllPeers()
+	transfer := int(math.Sqrt(float64(len(peers))))
+	if transfer < 1 && len(peers) > 0 {
+		transfer = 1
+	}
+	for _, i := range rand.Perm(len(peers))[:transfer] {
+		peers[i].SendTransactions(txs)
+	}
+	log.Trace("Rebroadcast transactions", "count", len(txs), "recipients", transfer)
 }
 
 // Mined broadcast loop
@@ -723,10 +892,24 @@ func (self *ProtocolManager) minedBroadcastLoop() {
 }
 
 func (self *ProtocolManager) txBroadcastLoop() {
+	for {
+		select {
+		case event := <-self.txsCh:
+			self.BroadcastTxs(event.Txs)
+
+		// Err() channel will be closed when unsubscribing.
+		case <-self.txsSub.Err():
+			return
+		}
+	}
+}
+
+func (self *ProtocolManager) txRebroadcastLoop() {
 	// automatically stops if unsubscribe
-	for obj := range self.txSub.Chan() {
-		event := obj.Data.(core.TxPreEvent)
-		self.BroadcastTx(event.Tx.Hash(), event.Tx)
+	for obj := range self.rebroadcastSub.Chan() {
+		if ev, ok := obj.Data.(core.TxRebroadcastEvent); ok {
+			self.RebroadcastTxs(ev.Txs)
+		}
 	}
 }
 
@@ -0,0 +1,43 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/eth/snap"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// snapHandler implements the snap.Backend interface to serve and retrieve state
+// ranges through the protocol manager.
+type snapHandler ProtocolManager
+
+// Database retrieves the database the state is served from, including the recent
+// states only cached in memory by the block chain.
+func (h *snapHandler) Database() trie.Database {
+	return h.blockchain.TrieDB()
+}
+
+// Snapshots retrieves the flat state snapshot to serve ranges from, if any.
+func (h *snapHandler) Snapshots() *snapshot.Tree {
+	return h.blockchain.Snapshots()
+}
+
+// Syncer retrieves the state syncer of the downloader.
+func (h *snapHandler) Syncer() *snap.Syncer {
+	return h.downloader.SnapSyncer
+}
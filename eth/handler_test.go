@@ -476,7 +476,7 @@ func testDAOChallenge(t *testing.T, localForked, remoteForked bool, timeout bool
 		genesis       = gspec.MustCommit(db)
 		blockchain, _ = core.NewBlockChain(db, config, pow, evmux, vm.Config{})
 	)
-	pm, err := NewProtocolManager(config, downloader.FullSync, DefaultConfig.NetworkId, 1000, evmux, new(testTxPool), pow, blockchain, db)
+	pm, err := NewProtocolManager(config, downloader.FullSync, DefaultConfig.NetworkId, 1000, evmux, new(testTxPool), pow, blockchain, db, nil)
 	if err != nil {
 		t.Fatalf("failed to start test protocol manager: %v", err)
 	}
@@ -522,3 +522,69 @@ func testDAOChallenge(t *testing.T, localForked, remoteForked bool, timeout bool
 		}
 	}
 }
+
+// Tests that peers are dropped if they serve headers contradicting the locally
+// whitelisted blocks, but are kept if they agree with or don't know them yet.
+func TestWhitelistChallengeMatch(t *testing.T)    { testWhitelistChallenge(t, "match") }
+func TestWhitelistChallengeMismatch(t *testing.T) { testWhitelistChallenge(t, "mismatch") }
+func TestWhitelistChallengeUnknown(t *testing.T)  { testWhitelistChallenge(t, "unknown") }
+
+func testWhitelistChallenge(t *testing.T, reply string) {
+	// Create a protocol manager requiring a specific block
+	var (
+		evmux         = new(event.TypeMux)
+		pow           = ethash.NewFaker()
+		db, _         = ethdb.NewMemDatabase()
+		config        = &params.ChainConfig{}
+		gspec         = &core.Genesis{Config: config}
+		genesis       = gspec.MustCommit(db)
+		blockchain, _ = core.NewBlockChain(db, config, pow, evmux, vm.Config{})
+	)
+	blocks, _ := core.GenerateChain(config, genesis, db, 1, nil)
+	forked, _ := core.GenerateChain(config, genesis, db, 1, func(i int, block *core.BlockGen) {
+		block.SetExtra([]byte("fork"))
+	})
+	whitelist := map[uint64]common.Hash{1: blocks[0].Hash()}
+
+	pm, err := NewProtocolManager(config, downloader.FullSync, DefaultConfig.NetworkId, 1000, evmux, new(testTxPool), pow, blockchain, db, whitelist)
+	if err != nil {
+		t.Fatalf("failed to start test protocol manager: %v", err)
+	}
+	pm.Start()
+	defer pm.Stop()
+
+	// Connect a new peer and check that we receive the whitelist challenge
+	peer, _ := newTestPeer("peer", eth63, pm, true)
+	defer peer.close()
+
+	challenge := &getBlockHeadersData{
+		Origin:  hashOrNumber{Number: 1},
+		Amount:  1,
+		Skip:    0,
+		Reverse: false,
+	}
+	if err := p2p.ExpectMsg(peer.app, GetBlockHeadersMsg, challenge); err != nil {
+		t.Fatalf("challenge mismatch: %v", err)
+	}
+	// Reply to the challenge according to the requested scenario
+	var headers []*types.Header
+	switch reply {
+	case "match":
+		headers = []*types.Header{blocks[0].Header()}
+	case "mismatch":
+		headers = []*types.Header{forked[0].Header()}
+	}
+	if err := p2p.Send(peer.app, BlockHeadersMsg, headers); err != nil {
+		t.Fatalf("failed to answer challenge: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond) // Sleep to avoid the verification racing with the drops
+
+	// Verify that only the peer on the other side of the fork is dropped
+	want := 1
+	if reply == "mismatch" {
+		want = 0
+	}
+	if peers := pm.peers.Len(); peers != want {
+		t.Fatalf("peer count mismatch: have %d, want %d", peers, want)
+	}
+}
@@ -26,6 +26,10 @@ var (
 	propTxnInTrafficMeter     = metrics.NewMeter("eth/prop/txns/in/traffic")
 	propTxnOutPacketsMeter    = metrics.NewMeter("eth/prop/txns/out/packets")
 	propTxnOutTrafficMeter    = metrics.NewMeter("eth/prop/txns/out/traffic")
+	propTxHashInPacketsMeter  = metrics.NewMeter("eth/prop/txhashes/in/packets")
+	propTxHashInTrafficMeter  = metrics.NewMeter("eth/prop/txhashes/in/traffic")
+	propTxHashOutPacketsMeter = metrics.NewMeter("eth/prop/txhashes/out/packets")
+	propTxHashOutTrafficMeter = metrics.NewMeter("eth/prop/txhashes/out/traffic")
 	propHashInPacketsMeter    = metrics.NewMeter("eth/prop/hashes/in/packets")
 	propHashInTrafficMeter    = metrics.NewMeter("eth/prop/hashes/in/traffic")
 	propHashOutPacketsMeter   = metrics.NewMeter("eth/prop/hashes/out/packets")
@@ -50,6 +54,10 @@ var (
 	reqReceiptInTrafficMeter  = metrics.NewMeter("eth/req/receipts/in/traffic")
 	reqReceiptOutPacketsMeter = metrics.NewMeter("eth/req/receipts/out/packets")
 	reqReceiptOutTrafficMeter = metrics.NewMeter("eth/req/receipts/out/traffic")
+	reqTxnInPacketsMeter      = metrics.NewMeter("eth/req/txns/in/packets")
+	reqTxnInTrafficMeter      = metrics.NewMeter("eth/req/txns/in/traffic")
+	reqTxnOutPacketsMeter     = metrics.NewMeter("eth/req/txns/out/packets")
+	reqTxnOutTrafficMeter     = metrics.NewMeter("eth/req/txns/out/traffic")
 	miscInPacketsMeter        = metrics.NewMeter("eth/misc/in/packets")
 	miscInTrafficMeter        = metrics.NewMeter("eth/misc/in/traffic")
 	miscOutPacketsMeter       = metrics.NewMeter("eth/misc/out/packets")
@@ -96,6 +104,8 @@ func (rw *meteredMsgReadWriter) ReadMsg() (p2p.Msg, error) {
 		packets, traffic = reqStateInPacketsMeter, reqStateInTrafficMeter
 	case rw.version >= eth63 && msg.Code == ReceiptsMsg:
 		packets, traffic = reqReceiptInPacketsMeter, reqReceiptInTrafficMeter
+	case rw.version >= eth65 && msg.Code == PooledTransactionsMsg:
+		packets, traffic = reqTxnInPacketsMeter, reqTxnInTrafficMeter
 
 	case msg.Code == NewBlockHashesMsg:
 		packets, traffic = propHashInPacketsMeter, propHashInTrafficMeter
@@ -103,6 +113,8 @@ func (rw *meteredMsgReadWriter) ReadMsg() (p2p.Msg, error) {
 		packets, traffic = propBlockInPacketsMeter, propBlockInTrafficMeter
 	case msg.Code == TxMsg:
 		packets, traffic = propTxnInPacketsMeter, propTxnInTrafficMeter
+	case rw.version >= eth65 && msg.Code == NewPooledTransactionHashesMsg:
+		packets, traffic = propTxHashInPacketsMeter, propTxHashInTrafficMeter
 	}
 	packets.Mark(1)
 	traffic.Mark(int64(msg.Size))
@@ -123,6 +135,8 @@ func (rw *meteredMsgReadWriter) WriteMsg(msg p2p.Msg) error {
 		packets, traffic = reqStateOutPacketsMeter, reqStateOutTrafficMeter
 	case rw.version >= eth63 && msg.Code == ReceiptsMsg:
 		packets, traffic = reqReceiptOutPacketsMeter, reqReceiptOutTrafficMeter
+	case rw.version >= eth65 && msg.Code == PooledTransactionsMsg:
+		packets, traffic = reqTxnOutPacketsMeter, reqTxnOutTrafficMeter
 
 	case msg.Code == NewBlockHashesMsg:
 		packets, traffic = propHashOutPacketsMeter, propHashOutTrafficMeter
@@ -130,6 +144,8 @@ func (rw *meteredMsgReadWriter) WriteMsg(msg p2p.Msg) error {
 		packets, traffic = propBlockOutPacketsMeter, propBlockOutTrafficMeter
 	case msg.Code == TxMsg:
 		packets, traffic = propTxnOutPacketsMeter, propTxnOutTrafficMeter
+	case rw.version >= eth65 && msg.Code == NewPooledTransactionHashesMsg:
+		packets, traffic = propTxHashOutPacketsMeter, propTxHashOutTrafficMeter
 	}
 	packets.Mark(1)
 	traffic.Mark(int64(msg.Size))
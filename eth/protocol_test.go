@@ -39,6 +39,7 @@ var testAccount, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6
 // Tests that handshake failures are detected and reported correctly.
 func TestStatusMsgErrors62(t *testing.T) { testStatusMsgErrors(t, 62) }
 func TestStatusMsgErrors63(t *testing.T) { testStatusMsgErrors(t, 63) }
+func TestStatusMsgErrors65(t *testing.T) { testStatusMsgErrors(t, 65) }
 
 func testStatusMsgErrors(t *testing.T, protocol int) {
 	pm := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, nil)
@@ -91,6 +92,7 @@ func testStatusMsgErrors(t *testing.T, protocol int) {
 // This test checks that received transactions are added to the local pool.
 func TestRecvTransactions62(t *testing.T) { testRecvTransactions(t, 62) }
 func TestRecvTransactions63(t *testing.T) { testRecvTransactions(t, 63) }
+func TestRecvTransactions65(t *testing.T) { testRecvTransactions(t, 65) }
 
 func testRecvTransactions(t *testing.T, protocol int) {
 	txAdded := make(chan []*types.Transaction)
@@ -112,13 +114,14 @@ func testRecvTransactions(t *testing.T, protocol int) {
 			t.Errorf("added wrong tx hash: got %v, want %v", added[0].Hash(), tx.Hash())
 		}
 	case <-time.After(2 * time.Second):
-		t.Errorf("no TxPreEvent received within 2 seconds")
+		t.Errorf("no NewTxsEvent received within 2 seconds")
 	}
 }
 
 // This test checks that pending transactions are sent.
 func TestSendTransactions62(t *testing.T) { testSendTransactions(t, 62) }
 func TestSendTransactions63(t *testing.T) { testSendTransactions(t, 63) }
+func TestSendTransactions65(t *testing.T) { testSendTransactions(t, 65) }
 
 func testSendTransactions(t *testing.T, protocol int) {
 	pm := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, nil)
@@ -142,18 +145,28 @@ func testSendTransactions(t *testing.T, protocol int) {
 			seen[tx.Hash()] = false
 		}
 		for n := 0; n < len(alltxs) && !t.Failed(); {
-			var txs []*types.Transaction
+			var hashes []common.Hash
 			msg, err := p.app.ReadMsg()
 			if err != nil {
 				t.Errorf("%v: read error: %v", p.Peer, err)
-			} else if msg.Code != TxMsg {
-				t.Errorf("%v: got code %d, want TxMsg", p.Peer, msg.Code)
 			}
-			if err := msg.Decode(&txs); err != nil {
-				t.Errorf("%v: %v", p.Peer, err)
+			switch {
+			case protocol < 65 && msg.Code == TxMsg:
+				var txs []*types.Transaction
+				if err := msg.Decode(&txs); err != nil {
+					t.Errorf("%v: %v", p.Peer, err)
+				}
+				for _, tx := range txs {
+					hashes = append(hashes, tx.Hash())
+				}
+			case protocol >= 65 && msg.Code == NewPooledTransactionHashesMsg:
+				if err := msg.Decode(&hashes); err != nil {
+					t.Errorf("%v: %v", p.Peer, err)
+				}
+			default:
+				t.Errorf("%v: got unexpected code %d", p.Peer, msg.Code)
 			}
-			for _, tx := range txs {
-				hash := tx.Hash()
+			for _, hash := range hashes {
 				seentx, want := seen[hash]
 				if seentx {
 					t.Errorf("%v: got tx more than once: %x", p.Peer, hash)
@@ -174,6 +187,79 @@ func testSendTransactions(t *testing.T, protocol int) {
 	wg.Wait()
 }
 
+// Tests that transactions announced by hash are retrieved from the announcer
+// and added to the pool.
+func TestRecvTransactionAnnounces65(t *testing.T) { testRecvTransactionAnnounces(t, 65) }
+
+func testRecvTransactionAnnounces(t *testing.T, protocol int) {
+	txAdded := make(chan []*types.Transaction)
+	pm := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, txAdded)
+	pm.acceptTxs = 1 // mark synced to accept transactions
+	p, _ := newTestPeer("peer", protocol, pm, true)
+	defer pm.Stop()
+	defer p.close()
+
+	tx := newTestTransaction(testAccount, 0, 0)
+	if err := p2p.Send(p.app, NewPooledTransactionHashesMsg, []common.Hash{tx.Hash()}); err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+	// Wait for the retrieval request and serve it
+	msg, err := p.app.ReadMsg()
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if msg.Code != GetPooledTransactionsMsg {
+		t.Fatalf("message code mismatch: have %d, want %d", msg.Code, GetPooledTransactionsMsg)
+	}
+	var hashes []common.Hash
+	if err := msg.Decode(&hashes); err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+	if len(hashes) != 1 || hashes[0] != tx.Hash() {
+		t.Fatalf("requested hashes mismatch: have %v, want [%x]", hashes, tx.Hash())
+	}
+	if err := p2p.Send(p.app, PooledTransactionsMsg, []interface{}{tx}); err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+	select {
+	case added := <-txAdded:
+		if len(added) != 1 {
+			t.Errorf("wrong number of added transactions: got %d, want 1", len(added))
+		} else if added[0].Hash() != tx.Hash() {
+			t.Errorf("added wrong tx hash: got %v, want %v", added[0].Hash(), tx.Hash())
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("no transaction added within 2 seconds")
+	}
+}
+
+// Tests that pooled transactions can be retrieved by hash, and unknown ones
+// are silently skipped.
+func TestGetPooledTransactions65(t *testing.T) { testGetPooledTransactions(t, 65) }
+
+func testGetPooledTransactions(t *testing.T, protocol int) {
+	pm := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, nil)
+	defer pm.Stop()
+
+	known := newTestTransaction(testAccount, 0, 0)
+	unknown := newTestTransaction(testAccount, 1, 0)
+	pm.txpool.AddRemotes([]*types.Transaction{known})
+
+	p, _ := newTestPeer("peer", protocol, pm, true)
+	defer p.close()
+
+	// Drain the initial transaction sync announcing the known transaction
+	if err := p2p.ExpectMsg(p.app, NewPooledTransactionHashesMsg, []common.Hash{known.Hash()}); err != nil {
+		t.Fatalf("initial announcement mismatch: %v", err)
+	}
+	if err := p2p.Send(p.app, GetPooledTransactionsMsg, []common.Hash{unknown.Hash(), known.Hash()}); err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+	if err := p2p.ExpectMsg(p.app, PooledTransactionsMsg, []*types.Transaction{known}); err != nil {
+		t.Errorf("pooled transactions mismatch: %v", err)
+	}
+}
+
 // Tests that the custom union field encoder and decoder works correctly.
 func TestGetBlockHeadersDataEncodeDecode(t *testing.T) {
 	// Create a "random" hash for testing
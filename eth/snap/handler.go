@@ -0,0 +1,379 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+const (
+	softResponseLimit = 2 * 1024 * 1024 // Target maximum size of returned ranges, codes or nodes
+	maxCodeLookups    = 1024            // Maximum number of codes to serve in a single response
+	maxTrieLookups    = 1024            // Maximum number of trie nodes to serve in a single response
+)
+
+// Backend is the node the snap protocol is running on, providing the state data
+// to serve to remote peers and the syncer to deliver their responses to.
+type Backend interface {
+	// Database retrieves the database holding the trie nodes and contract codes,
+	// including the recent ones not yet flushed to disk.
+	Database() trie.Database
+
+	// Snapshots retrieves the state snapshot tree to serve ranges from, or nil
+	// if the ranges must be read from the tries.
+	Snapshots() *snapshot.Tree
+
+	// Syncer retrieves the syncer consuming the responses of remote peers.
+	Syncer() *Syncer
+}
+
+// MakeProtocols constructs the p2p protocol definitions for snap.
+func MakeProtocols(backend Backend) []p2p.Protocol {
+	protocols := make([]p2p.Protocol, len(ProtocolVersions))
+	for i, version := range ProtocolVersions {
+		version := version // Closure for the run
+		protocols[i] = p2p.Protocol{
+			Name:    ProtocolName,
+			Version: version,
+			Length:  ProtocolLengths[i],
+			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				return Handle(backend, NewPeer(version, p, rw))
+			},
+		}
+	}
+	return protocols
+}
+
+// Handle registers the peer with the syncer and serves its messages until the
+// connection is torn down.
+func Handle(backend Backend, peer *Peer) error {
+	syncer := backend.Syncer()
+	if err := syncer.Register(peer); err != nil {
+		return err
+	}
+	defer syncer.Unregister(peer.ID())
+
+	for {
+		if err := handleMessage(backend, peer); err != nil {
+			peer.Log().Debug("Snap message handling failed", "err", err)
+			return err
+		}
+	}
+}
+
+// handleMessage is invoked whenever an inbound message is received from a remote
+// peer. The remote connection is torn down upon returning any error.
+func handleMessage(backend Backend, peer *Peer) error {
+	// Read the next message from the remote peer, and ensure it's fully consumed
+	msg, err := peer.rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	if msg.Size > ProtocolMaxMsgSize {
+		return fmt.Errorf("%v: %v > %v", errMsgTooLarge, msg.Size, ProtocolMaxMsgSize)
+	}
+	defer msg.Discard()
+
+	// Handle the message depending on its contents
+	switch msg.Code {
+	case GetAccountRangeMsg:
+		var req getAccountRangeData
+		if err := msg.Decode(&req); err != nil {
+			return fmt.Errorf("%v: %v: %v", errDecode, msg, err)
+		}
+		accounts, proof := serviceGetAccountRange(backend, &req)
+		return p2p.Send(peer.rw, AccountRangeMsg, &accountRangeData{ID: req.ID, Accounts: accounts, Proof: proof})
+
+	case AccountRangeMsg:
+		var res accountRangeData
+		if err := msg.Decode(&res); err != nil {
+			return fmt.Errorf("%v: %v: %v", errDecode, msg, err)
+		}
+		hashes, accounts := make([]common.Hash, len(res.Accounts)), make([][]byte, len(res.Accounts))
+		for i, account := range res.Accounts {
+			hashes[i], accounts[i] = account.Hash, account.Body
+		}
+		return backend.Syncer().OnAccounts(peer, res.ID, hashes, accounts, res.Proof)
+
+	case GetStorageRangesMsg:
+		var req getStorageRangesData
+		if err := msg.Decode(&req); err != nil {
+			return fmt.Errorf("%v: %v: %v", errDecode, msg, err)
+		}
+		if len(req.Accounts) != len(req.Roots) {
+			return fmt.Errorf("%v: %d accounts, %d storage roots", errBadRequest, len(req.Accounts), len(req.Roots))
+		}
+		slots, proof := serviceGetStorageRanges(backend, &req)
+		return p2p.Send(peer.rw, StorageRangesMsg, &storageRangesData{ID: req.ID, Slots: slots, Proof: proof})
+
+	case StorageRangesMsg:
+		var res storageRangesData
+		if err := msg.Decode(&res); err != nil {
+			return fmt.Errorf("%v: %v: %v", errDecode, msg, err)
+		}
+		hashes, slots := make([][]common.Hash, len(res.Slots)), make([][][]byte, len(res.Slots))
+		for i, set := range res.Slots {
+			hashes[i], slots[i] = make([]common.Hash, len(set)), make([][]byte, len(set))
+			for j, slot := range set {
+				hashes[i][j], slots[i][j] = slot.Hash, slot.Body
+			}
+		}
+		return backend.Syncer().OnStorage(peer, res.ID, hashes, slots, res.Proof)
+
+	case GetByteCodesMsg:
+		var req getByteCodesData
+		if err := msg.Decode(&req); err != nil {
+			return fmt.Errorf("%v: %v: %v", errDecode, msg, err)
+		}
+		codes := serviceGetBlobs(backend.Database(), req.Hashes, req.Bytes, maxCodeLookups)
+		return p2p.Send(peer.rw, ByteCodesMsg, &byteCodesData{ID: req.ID, Codes: codes})
+
+	case ByteCodesMsg:
+		var res byteCodesData
+		if err := msg.Decode(&res); err != nil {
+			return fmt.Errorf("%v: %v: %v", errDecode, msg, err)
+		}
+		return backend.Syncer().OnByteCodes(peer, res.ID, res.Codes)
+
+	case GetTrieNodesMsg:
+		var req getTrieNodesData
+		if err := msg.Decode(&req); err != nil {
+			return fmt.Errorf("%v: %v: %v", errDecode, msg, err)
+		}
+		nodes := serviceGetBlobs(backend.Database(), req.Hashes, req.Bytes, maxTrieLookups)
+		return p2p.Send(peer.rw, TrieNodesMsg, &trieNodesData{ID: req.ID, Nodes: nodes})
+
+	case TrieNodesMsg:
+		var res trieNodesData
+		if err := msg.Decode(&res); err != nil {
+			return fmt.Errorf("%v: %v: %v", errDecode, msg, err)
+		}
+		return backend.Syncer().OnTrieNodes(peer, res.ID, res.Nodes)
+
+	default:
+		return fmt.Errorf("%v: %v", errInvalidMsgCode, msg.Code)
+	}
+}
+
+// serviceGetAccountRange assembles the response to an account range query. The
+// last account returned may be the first one beyond the limit, proving that
+// there are none between the limit and it. Unless the entire trie is returned,
+// the edges of the range are proven. An empty response is returned if the state
+// is not available.
+func serviceGetAccountRange(backend Backend, req *getAccountRangeData) ([]*accountData, [][]byte) {
+	if req.Bytes > softResponseLimit {
+		req.Bytes = softResponseLimit
+	}
+	tr, err := trie.New(req.Root, backend.Database())
+	if err != nil {
+		return nil, nil
+	}
+	var it snapshot.Iterator
+	if snap := snapshotOf(backend, req.Root); snap != nil {
+		it, _ = snap.AccountIterator(req.Origin)
+	}
+	if it == nil {
+		it = newTrieIterator(tr, req.Origin)
+	}
+	defer it.Release()
+
+	var (
+		accounts  []*accountData
+		size      uint64
+		last      common.Hash
+		exhausted = true
+	)
+	for it.Next() {
+		last = it.Hash()
+		accounts = append(accounts, &accountData{Hash: last, Body: common.CopyBytes(it.Value())})
+		size += uint64(common.HashLength + len(it.Value()))
+
+		if bytes.Compare(last[:], req.Limit[:]) >= 0 || size >= req.Bytes {
+			exhausted = false
+			break
+		}
+	}
+	if it.Error() != nil {
+		return nil, nil
+	}
+	// The full trie is self-proving, otherwise prove the edges of the range
+	if req.Origin == (common.Hash{}) && exhausted {
+		return accounts, nil
+	}
+	proof, err := proveRange(tr, req.Origin, last, len(accounts) > 0)
+	if err != nil {
+		return nil, nil
+	}
+	return accounts, proof
+}
+
+// serviceGetStorageRanges assembles the response to a storage range query. The
+// accounts are served in order until the size limit is reached, and only the
+// last one may be incomplete, in which case its range is proven. Accounts whose
+// storage is not available end the response.
+func serviceGetStorageRanges(backend Backend, req *getStorageRangesData) ([][]*storageData, [][]byte) {
+	if req.Bytes > softResponseLimit {
+		req.Bytes = softResponseLimit
+	}
+	var (
+		slots [][]*storageData
+		size  uint64
+	)
+	for i, account := range req.Accounts {
+		if size >= req.Bytes {
+			break
+		}
+		var origin common.Hash
+		if i == 0 {
+			origin = req.Origin
+		}
+		tr, err := trie.New(req.Roots[i], backend.Database())
+		if err != nil {
+			break
+		}
+		var it snapshot.Iterator
+		if snap := snapshotOf(backend, req.Root); snap != nil && storageRootOf(snap, account) == req.Roots[i] {
+			it, _ = snap.StorageIterator(account, origin)
+		}
+		if it == nil {
+			it = newTrieIterator(tr, origin)
+		}
+		var (
+			storage   []*storageData
+			last      common.Hash
+			exhausted = true
+		)
+		for it.Next() {
+			last = it.Hash()
+			storage = append(storage, &storageData{Hash: last, Body: common.CopyBytes(it.Value())})
+			size += uint64(common.HashLength + len(it.Value()))
+
+			if size >= req.Bytes {
+				exhausted = false
+				break
+			}
+		}
+		it.Release()
+		if it.Error() != nil || len(storage) == 0 {
+			break
+		}
+		slots = append(slots, storage)
+
+		// Complete storage tries are self-proving, otherwise prove the edges of the
+		// range and stop
+		if origin != (common.Hash{}) || !exhausted {
+			proof, err := proveRange(tr, origin, last, true)
+			if err != nil {
+				return slots[:len(slots)-1], nil
+			}
+			return slots, proof
+		}
+	}
+	return slots, nil
+}
+
+// serviceGetBlobs retrieves the trie nodes or contract codes with the given
+// hashes from the database, skipping the ones not available.
+func serviceGetBlobs(db trie.DatabaseReader, hashes []common.Hash, limit uint64, count int) [][]byte {
+	if limit > softResponseLimit {
+		limit = softResponseLimit
+	}
+	var (
+		blobs [][]byte
+		size  uint64
+	)
+	for i, hash := range hashes {
+		if i >= count || size >= limit {
+			break
+		}
+		if blob, err := db.Get(hash[:]); err == nil && len(blob) > 0 {
+			blobs = append(blobs, blob)
+			size += uint64(len(blob))
+		}
+	}
+	return blobs
+}
+
+// snapshotOf retrieves the snapshot of the given state root, if available.
+func snapshotOf(backend Backend, root common.Hash) snapshot.Snapshot {
+	snaps := backend.Snapshots()
+	if snaps == nil {
+		return nil
+	}
+	return snaps.Snapshot(root)
+}
+
+// storageRootOf retrieves the storage root of an account from a snapshot, or the
+// zero hash if the account can't be read.
+func storageRootOf(snap snapshot.Snapshot, account common.Hash) common.Hash {
+	blob, err := snap.Account(account)
+	if err != nil || blob == nil {
+		return common.Hash{}
+	}
+	var acc state.Account
+	if err := rlp.DecodeBytes(blob, &acc); err != nil {
+		return common.Hash{}
+	}
+	return acc.Root
+}
+
+// proveRange creates the merkle proofs of the edges of a range, the origin and
+// optionally the last key.
+func proveRange(tr *trie.Trie, origin, last common.Hash, proveLast bool) ([][]byte, error) {
+	proofDb, _ := ethdb.NewMemDatabase()
+	if err := tr.Prove(origin[:], 0, proofDb); err != nil {
+		return nil, err
+	}
+	if proveLast {
+		if err := tr.Prove(last[:], 0, proofDb); err != nil {
+			return nil, err
+		}
+	}
+	var proof [][]byte
+	for _, key := range proofDb.Keys() {
+		blob, _ := proofDb.Get(key)
+		proof = append(proof, blob)
+	}
+	return proof, nil
+}
+
+// trieIterator iterates over the leaves of a trie whose keys are hashes, serving
+// the ranges of states not covered by snapshots.
+type trieIterator struct {
+	it *trie.Iterator
+}
+
+// newTrieIterator creates an iterator over the leaves of the trie, starting at
+// the given key.
+func newTrieIterator(tr *trie.Trie, origin common.Hash) *trieIterator {
+	return &trieIterator{it: trie.NewIterator(tr.NodeIterator(origin[:]))}
+}
+
+func (it *trieIterator) Next() bool        { return it.it.Next() }
+func (it *trieIterator) Error() error      { return it.it.Err }
+func (it *trieIterator) Hash() common.Hash { return common.BytesToHash(it.it.Key) }
+func (it *trieIterator) Value() []byte     { return it.it.Value }
+func (it *trieIterator) Release()          {}
@@ -0,0 +1,141 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package snap implements the snap protocol, which retrieves the state of the
+// chain as contiguous ranges of accounts and storage slots instead of trie node
+// by trie node.
+package snap
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Constants to match up protocol versions and messages
+const (
+	snap1 = 1
+)
+
+// Official short name of the protocol used during capability negotiation.
+var ProtocolName = "snap"
+
+// Supported versions of the snap protocol (first is primary).
+var ProtocolVersions = []uint{snap1}
+
+// Number of implemented message corresponding to different protocol versions.
+var ProtocolLengths = []uint64{8}
+
+const ProtocolMaxMsgSize = 10 * 1024 * 1024 // Maximum cap on the size of a protocol message
+
+// snap protocol message codes
+const (
+	GetAccountRangeMsg  = 0x00
+	AccountRangeMsg     = 0x01
+	GetStorageRangesMsg = 0x02
+	StorageRangesMsg    = 0x03
+	GetByteCodesMsg     = 0x04
+	ByteCodesMsg        = 0x05
+	GetTrieNodesMsg     = 0x06
+	TrieNodesMsg        = 0x07
+)
+
+var (
+	errMsgTooLarge    = errors.New("message too long")
+	errDecode         = errors.New("invalid message")
+	errInvalidMsgCode = errors.New("invalid message code")
+	errBadRequest     = errors.New("bad request")
+)
+
+// getAccountRangeData is the network packet requesting the accounts of a state
+// between two account hashes.
+type getAccountRangeData struct {
+	ID     uint64      // Request ID to match up responses with
+	Root   common.Hash // Root hash of the account trie to serve
+	Origin common.Hash // Hash of the first account to retrieve
+	Limit  common.Hash // Hash of the last account to retrieve
+	Bytes  uint64      // Soft limit at which to stop returning data
+}
+
+// accountRangeData is the network packet returning a range of accounts, along
+// with the merkle proofs of its first and last keys.
+type accountRangeData struct {
+	ID       uint64         // ID of the request this is a response for
+	Accounts []*accountData // List of consecutive accounts from the trie
+	Proof    [][]byte       // List of trie nodes proving the account range
+}
+
+// accountData represents a single account in an account range.
+type accountData struct {
+	Hash common.Hash  // Hash of the account
+	Body rlp.RawValue // Consensus encoding of the account
+}
+
+// getStorageRangesData is the network packet requesting the storage slots of a
+// batch of accounts. The origin only applies to the first account.
+type getStorageRangesData struct {
+	ID       uint64        // Request ID to match up responses with
+	Root     common.Hash   // Root hash of the account trie containing the accounts
+	Accounts []common.Hash // Hashes of the accounts to retrieve the slots of
+	Roots    []common.Hash // Storage roots of the accounts, to serve changed accounts by
+	Origin   common.Hash   // Hash of the first storage slot of the first account
+	Bytes    uint64        // Soft limit at which to stop returning data
+}
+
+// storageRangesData is the network packet returning the storage slots of a
+// batch of accounts. Only the slots of the last account may be incomplete, in
+// which case they are proven by the merkle proofs of their first and last keys.
+type storageRangesData struct {
+	ID    uint64           // ID of the request this is a response for
+	Slots [][]*storageData // Lists of consecutive slots, one per account
+	Proof [][]byte         // List of trie nodes proving the last slot range
+}
+
+// storageData represents a single slot in a storage range.
+type storageData struct {
+	Hash common.Hash // Hash of the storage slot
+	Body []byte      // Consensus encoding of the slot value
+}
+
+// getByteCodesData is the network packet requesting contract codes by hash.
+type getByteCodesData struct {
+	ID     uint64        // Request ID to match up responses with
+	Hashes []common.Hash // Code hashes to retrieve
+	Bytes  uint64        // Soft limit at which to stop returning data
+}
+
+// byteCodesData is the network packet returning contract codes, in the order
+// they were requested. Codes not available are left out.
+type byteCodesData struct {
+	ID    uint64   // ID of the request this is a response for
+	Codes [][]byte // Requested contract codes
+}
+
+// getTrieNodesData is the network packet requesting trie nodes by hash, used to
+// heal the state after the ranges were retrieved.
+type getTrieNodesData struct {
+	ID     uint64        // Request ID to match up responses with
+	Hashes []common.Hash // Hashes of the trie nodes to retrieve
+	Bytes  uint64        // Soft limit at which to stop returning data
+}
+
+// trieNodesData is the network packet returning trie nodes, in the order they
+// were requested. Nodes not available are left out.
+type trieNodesData struct {
+	ID    uint64   // ID of the request this is a response for
+	Nodes [][]byte // Requested trie nodes
+}
@@ -0,0 +1,948 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	// emptyCode is the known hash of the empty EVM bytecode.
+	emptyCode = crypto.Keccak256Hash(nil)
+
+	// flatAccountPrefix is the database prefix of the downloaded accounts, kept
+	// until all the ranges are retrieved and the account trie can be generated.
+	flatAccountPrefix = []byte("snap-sync-account-") // flatAccountPrefix + hash -> account
+)
+
+const (
+	accountChunks     = 16         // Number of chunks the account hash space is split into
+	maxRequestSize    = 512 * 1024 // Soft limit of the data requested in a single query
+	maxStorageSetSize = 128        // Maximum number of accounts to request storage for at once
+	maxCodeRequest    = 64         // Maximum number of contract codes to request at once
+	maxTrieRequest    = 256        // Maximum number of trie nodes to request at once
+	idealBatchSize    = 100 * 1024 // Amount of data to accumulate before flushing to disk
+)
+
+var (
+	requestTimeout = 10 * time.Second // Maximum time allowance for a peer to respond
+	logInterval    = 8 * time.Second  // Interval between progress reports
+)
+
+var (
+	// ErrCancelled is returned from Sync if the sync was cancelled.
+	ErrCancelled = errors.New("sync cancelled")
+)
+
+// SyncPeer abstracts out the methods required for a peer to be synced against,
+// with the aim of making testing easier.
+type SyncPeer interface {
+	// ID retrieves the peer's unique identifier.
+	ID() string
+
+	// RequestAccountRange fetches a batch of accounts rooted in a specific account
+	// trie, starting with the origin.
+	RequestAccountRange(id uint64, root, origin, limit common.Hash, bytes uint64) error
+
+	// RequestStorageRanges fetches the storage slots of a batch of accounts,
+	// starting at the origin in the first account.
+	RequestStorageRanges(id uint64, root common.Hash, accounts, roots []common.Hash, origin common.Hash, bytes uint64) error
+
+	// RequestByteCodes fetches a batch of contract codes by hash.
+	RequestByteCodes(id uint64, hashes []common.Hash, bytes uint64) error
+
+	// RequestTrieNodes fetches a batch of trie nodes by hash.
+	RequestTrieNodes(id uint64, hashes []common.Hash, bytes uint64) error
+}
+
+// accountTask is a chunk of the account hash space being retrieved.
+type accountTask struct {
+	next common.Hash // Next account to retrieve
+	last common.Hash // Last account of the chunk
+	busy bool        // Whether a request is in flight for the chunk
+	done bool        // Whether the chunk was fully retrieved
+}
+
+// storageTask is the storage trie of an account being retrieved. The slots are
+// retrieved in order, feeding the generator of the trie nodes.
+type storageTask struct {
+	account common.Hash     // Hash of the account owning the storage
+	root    common.Hash     // Storage root the slots are verified against
+	next    common.Hash     // Next storage slot to retrieve
+	trie    *trie.StackTrie // Generator of the storage trie nodes
+	busy    bool            // Whether a request is in flight for the storage
+}
+
+// request is a data retrieval request in flight, along with the response of the
+// peer once delivered.
+type request struct {
+	id   uint64
+	peer string
+	root common.Hash // State root the request was issued for
+
+	account *accountTask   // Account chunk requested
+	storage []*storageTask // Storage tries requested
+	codes   []common.Hash  // Contract codes requested
+	nodes   []common.Hash  // Trie nodes requested
+
+	timer     *time.Timer
+	delivered bool          // Whether the request was answered or expired, protected by the syncer lock
+	deliver   chan *request // Channel of the sync run to deliver the request to
+	done      chan struct{} // Channel closed when the sync run terminates
+
+	// Response fields, all nil for timed out or unserved requests
+	hashes  [][]common.Hash // Hashes of the accounts, or of the slots per storage trie
+	values  [][][]byte      // Accounts, or slots per storage trie
+	cont    bool            // Whether the last range has more data to the right
+	blobs   map[common.Hash][]byte
+	failed  bool // Whether the peer didn't have the requested data
+	expired bool // Whether the request timed out
+}
+
+// Syncer retrieves the state of a block using the snap protocol. The accounts
+// are downloaded as contiguous ranges, split in chunks retrieved concurrently
+// from different peers, followed by the storage slots and contract codes they
+// reference. The storage tries are generated while their slots arrive, and the
+// account trie once all ranges are retrieved. The state is then healed node by
+// node, fixing up any inconsistencies caused by changing the root mid-sync.
+//
+// The progress of the ranges is retained across Sync calls, so that a sync can
+// be moved on to a newer state root without starting over.
+type Syncer struct {
+	db ethdb.Database // Database to store the retrieved state in
+
+	peers     map[string]SyncPeer // Peers to retrieve the state from
+	busy      map[string]bool     // Peers with requests in flight
+	stateless map[string]bool     // Peers not having the state of the current root
+	requests  map[uint64]*request // Requests in flight, keyed by ID
+	nextID    uint64              // ID of the next request
+	update    chan struct{}       // Notification channel of peer changes
+	lock      sync.RWMutex        // Protects the peer and request tracking
+
+	root      common.Hash                 // Current state root being synced
+	accounts  []*accountTask              // Account chunks, nil if the sync wasn't started
+	storage   []*storageTask              // Storage tries pending retrieval
+	codes     map[common.Hash]struct{}    // Contract codes pending retrieval
+	generated bool                        // Whether the account trie was generated
+	healer    *state.StateSync            // Scheduler of the trie nodes to heal
+	healing   map[common.Hash]struct{}    // Trie nodes being healed
+	healRetry []common.Hash               // Trie nodes to retry healing
+	batch     *syncBatch                  // Write batch of the retrieved state
+	stats     struct{ a, s, c, n uint64 } // Accounts, slots, codes and nodes retrieved
+	logTime   time.Time                   // Time of the last progress report
+}
+
+// NewSyncer creates a state syncer storing the retrieved state into db, which
+// must be iterable.
+func NewSyncer(db ethdb.Database) *Syncer {
+	return &Syncer{
+		db:        db,
+		peers:     make(map[string]SyncPeer),
+		busy:      make(map[string]bool),
+		stateless: make(map[string]bool),
+		requests:  make(map[uint64]*request),
+		update:    make(chan struct{}, 1),
+	}
+}
+
+// Register injects a new peer into the set of sync sources.
+func (s *Syncer) Register(peer SyncPeer) error {
+	id := peer.ID()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.peers[id]; ok {
+		return fmt.Errorf("peer %s already registered", id)
+	}
+	s.peers[id] = peer
+	s.notify()
+	return nil
+}
+
+// Unregister removes a peer from the set of sync sources. Its requests in flight
+// are retried elsewhere once they time out.
+func (s *Syncer) Unregister(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.peers[id]; !ok {
+		return fmt.Errorf("peer %s not registered", id)
+	}
+	delete(s.peers, id)
+	delete(s.stateless, id)
+	s.notify()
+	return nil
+}
+
+// Peers returns the number of registered peers.
+func (s *Syncer) Peers() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return len(s.peers)
+}
+
+// notify wakes up the sync loop. The lock must be held.
+func (s *Syncer) notify() {
+	select {
+	case s.update <- struct{}{}:
+	default:
+	}
+}
+
+// Sync retrieves the state with the given root, blocking until it's complete or
+// the cancel channel is closed. Retrieved ranges are kept if the sync is stopped,
+// so that a subsequent call with a newer root continues where this one left off.
+func (s *Syncer) Sync(root common.Hash, cancel chan struct{}) error {
+	if err := s.start(root); err != nil {
+		return err
+	}
+	var (
+		deliver = make(chan *request)
+		done    = make(chan struct{})
+	)
+	defer func() {
+		close(done)
+		s.revertRequests()
+	}()
+	log.Info("Starting snap state sync", "root", root)
+
+	for {
+		if err := s.maybeFinish(); err != nil {
+			if err == errSyncDone {
+				return nil
+			}
+			return err
+		}
+		s.assignTasks(deliver, done)
+		s.reportProgress(false)
+
+		select {
+		case <-s.update:
+			// Peer joined or left, reassign the tasks
+		case <-cancel:
+			return ErrCancelled
+		case req := <-deliver:
+			if err := s.process(req); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// errSyncDone is returned internally when the sync finished.
+var errSyncDone = errors.New("sync done")
+
+// start prepares the sync of the given root, resuming the previous progress.
+func (s *Syncer) start(root common.Hash) error {
+	s.lock.Lock()
+	if root != s.root {
+		// Peers and healing are specific to the root, restart them
+		s.stateless = make(map[string]bool)
+		s.healer, s.healing, s.healRetry = nil, nil, nil
+	}
+	s.root = root
+	s.lock.Unlock()
+
+	s.logTime = time.Now()
+	if s.batch == nil {
+		s.batch = newSyncBatch(s.db)
+	}
+	if s.accounts != nil {
+		return nil
+	}
+	// Fresh sync, drop the leftovers of any interrupted one and split the
+	// account hash space into chunks
+	if err := s.deleteFlatAccounts(); err != nil {
+		return err
+	}
+	step := new(big.Int).Div(new(big.Int).Lsh(common.Big1, 256), big.NewInt(accountChunks))
+	next := new(big.Int)
+	for i := 0; i < accountChunks; i++ {
+		last := new(big.Int).Sub(new(big.Int).Add(next, step), common.Big1)
+		s.accounts = append(s.accounts, &accountTask{
+			next: common.BigToHash(next),
+			last: common.BigToHash(last),
+		})
+		next = next.Add(last, common.Big1)
+	}
+	s.codes = make(map[common.Hash]struct{})
+	s.generated = false
+	return nil
+}
+
+// maybeFinish advances the sync to the next phase once the current one is done,
+// generating the account trie after the ranges and finishing after the healing.
+// errSyncDone is returned if the sync is complete.
+func (s *Syncer) maybeFinish() error {
+	s.lock.RLock()
+	inflight := len(s.requests)
+	s.lock.RUnlock()
+
+	if inflight > 0 {
+		return nil
+	}
+	if !s.generated {
+		for _, task := range s.accounts {
+			if !task.done {
+				return nil
+			}
+		}
+		if len(s.storage) > 0 || len(s.codes) > 0 {
+			return nil
+		}
+		if err := s.generateAccountTrie(); err != nil {
+			return err
+		}
+		s.generated = true
+	}
+	if s.healer == nil {
+		if err := s.batch.flush(); err != nil {
+			return err
+		}
+		s.healer = state.NewStateSync(s.root, s.db)
+		s.healing = make(map[common.Hash]struct{})
+		s.healRetry = nil
+	}
+	if s.healer.Pending() > 0 || len(s.healRetry) > 0 {
+		return nil
+	}
+	// The state is complete, reset the syncer for the next sync
+	if err := s.batch.flush(); err != nil {
+		return err
+	}
+	s.reportProgress(true)
+	log.Info("Snap state sync complete", "root", s.root)
+
+	s.accounts, s.storage, s.codes = nil, nil, nil
+	s.generated, s.healer, s.healing, s.healRetry = false, nil, nil, nil
+	return errSyncDone
+}
+
+// generateAccountTrie generates the account trie from the retrieved accounts,
+// deleting them afterwards.
+func (s *Syncer) generateAccountTrie() error {
+	if err := s.batch.flush(); err != nil {
+		return err
+	}
+	tr := trie.NewStackTrie(s.batch)
+
+	it := s.db.NewIterator(flatAccountPrefix, nil)
+	for it.Next() {
+		tr.Update(common.CopyBytes(it.Key()[len(flatAccountPrefix):]), common.CopyBytes(it.Value()))
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return err
+	}
+	root := tr.Hash()
+	if err := s.batch.flush(); err != nil {
+		return err
+	}
+	log.Debug("Generated account trie", "root", root, "target", s.root)
+	return s.deleteFlatAccounts()
+}
+
+// deleteFlatAccounts removes all the retrieved accounts from the database.
+func (s *Syncer) deleteFlatAccounts() error {
+	r := util.BytesPrefix(flatAccountPrefix)
+	return s.db.DeleteRange(r.Start, r.Limit)
+}
+
+// assignTasks assigns a request to every idle peer having the state, retrieving
+// the storage and codes before moving on to further account ranges.
+func (s *Syncer) assignTasks(deliver chan *request, done chan struct{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for id, peer := range s.peers {
+		if s.busy[id] || s.stateless[id] {
+			continue
+		}
+		req := &request{id: s.nextID, peer: id, root: s.root, deliver: deliver, done: done}
+
+		var err error
+		switch {
+		case s.generated:
+			if !s.fillHealRequest(req) {
+				return
+			}
+			err = peer.RequestTrieNodes(req.id, req.nodes, maxRequestSize)
+
+		case s.fillStorageRequest(req):
+			var accounts, roots []common.Hash
+			for _, task := range req.storage {
+				accounts, roots = append(accounts, task.account), append(roots, task.root)
+			}
+			err = peer.RequestStorageRanges(req.id, req.root, accounts, roots, req.storage[0].next, maxRequestSize)
+
+		case s.fillCodeRequest(req):
+			err = peer.RequestByteCodes(req.id, req.codes, maxRequestSize)
+
+		case s.fillAccountRequest(req):
+			err = peer.RequestAccountRange(req.id, req.root, req.account.next, req.account.last, maxRequestSize)
+
+		default:
+			return // Nothing left to assign
+		}
+		s.nextID++
+		if err != nil {
+			// Peer is most likely disconnecting, don't use it again
+			log.Debug("Failed to send snap request", "peer", id, "err", err)
+			s.stateless[id] = true
+			s.revertRequest(req)
+			continue
+		}
+		s.busy[id] = true
+		s.requests[req.id] = req
+		req.timer = time.AfterFunc(requestTimeout, func() { s.expire(req) })
+	}
+}
+
+// fillAccountRequest assigns the next idle account chunk to the request.
+func (s *Syncer) fillAccountRequest(req *request) bool {
+	for _, task := range s.accounts {
+		if !task.busy && !task.done {
+			task.busy, req.account = true, task
+			return true
+		}
+	}
+	return false
+}
+
+// fillStorageRequest assigns idle storage tries to the request. Tries already
+// partially retrieved are requested on their own, the others in batches.
+func (s *Syncer) fillStorageRequest(req *request) bool {
+	for _, task := range s.storage {
+		if task.busy {
+			continue
+		}
+		if task.next != (common.Hash{}) {
+			if len(req.storage) == 0 {
+				task.busy, req.storage = true, []*storageTask{task}
+				return true
+			}
+			continue
+		}
+		task.busy, req.storage = true, append(req.storage, task)
+		if len(req.storage) >= maxStorageSetSize {
+			break
+		}
+	}
+	return len(req.storage) > 0
+}
+
+// fillCodeRequest assigns pending contract codes to the request.
+func (s *Syncer) fillCodeRequest(req *request) bool {
+	for hash := range s.codes {
+		delete(s.codes, hash)
+		if req.codes = append(req.codes, hash); len(req.codes) >= maxCodeRequest {
+			break
+		}
+	}
+	return len(req.codes) > 0
+}
+
+// fillHealRequest assigns missing trie nodes to the request.
+func (s *Syncer) fillHealRequest(req *request) bool {
+	req.nodes = s.healRetry
+	if len(req.nodes) > maxTrieRequest {
+		req.nodes, s.healRetry = req.nodes[:maxTrieRequest], req.nodes[maxTrieRequest:]
+	} else {
+		s.healRetry = nil
+	}
+	if len(req.nodes) < maxTrieRequest {
+		for _, hash := range s.healer.Missing(maxTrieRequest - len(req.nodes)) {
+			if _, ok := s.healing[hash]; !ok {
+				req.nodes = append(req.nodes, hash)
+			}
+		}
+	}
+	for _, hash := range req.nodes {
+		s.healing[hash] = struct{}{}
+	}
+	return len(req.nodes) > 0
+}
+
+// expire marks a request as timed out and delivers it to the sync loop.
+func (s *Syncer) expire(req *request) {
+	s.lock.Lock()
+	if s.requests[req.id] != req || req.delivered {
+		s.lock.Unlock()
+		return // Already delivered
+	}
+	req.delivered = true
+	s.lock.Unlock()
+
+	req.expired = true
+	s.deliverRequest(req)
+}
+
+// deliverRequest hands a finished request over to the sync loop that issued it.
+func (s *Syncer) deliverRequest(req *request) {
+	select {
+	case req.deliver <- req:
+	case <-req.done:
+	}
+}
+
+// pending looks up the request a response belongs to, marking it delivered. The
+// request is tracked as in flight until the sync loop processes it. Nil is
+// returned for unrequested, expired or already answered responses.
+func (s *Syncer) pending(peer SyncPeer, id uint64) *request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	req := s.requests[id]
+	if req == nil || req.peer != peer.ID() || req.delivered {
+		return nil
+	}
+	req.delivered = true
+	if req.timer != nil {
+		req.timer.Stop()
+	}
+	return req
+}
+
+// OnAccounts is a callback method to invoke when a range of accounts is received
+// from a remote peer. The range is verified against its proof, and an error is
+// returned if it's invalid.
+func (s *Syncer) OnAccounts(peer SyncPeer, id uint64, hashes []common.Hash, accounts [][]byte, proof [][]byte) error {
+	req := s.pending(peer, id)
+	if req == nil || req.account == nil {
+		log.Debug("Unrequested account range", "peer", peer.ID(), "reqid", id)
+		return nil
+	}
+	if len(hashes) == 0 && len(proof) == 0 {
+		req.failed = true // Peer doesn't have the state
+		s.deliverRequest(req)
+		return nil
+	}
+	cont, err := verifyRange(req.root, req.account.next, hashes, accounts, proof)
+	if err != nil {
+		req.failed = true
+		s.deliverRequest(req)
+		return fmt.Errorf("invalid account range: %v", err)
+	}
+	req.hashes, req.values, req.cont = [][]common.Hash{hashes}, [][][]byte{accounts}, cont
+	s.deliverRequest(req)
+	return nil
+}
+
+// OnStorage is a callback method to invoke when ranges of storage slots are
+// received from a remote peer. Only the last range may be incomplete, proven by
+// the proof; an error is returned if any of them is invalid.
+func (s *Syncer) OnStorage(peer SyncPeer, id uint64, hashes [][]common.Hash, slots [][][]byte, proof [][]byte) error {
+	req := s.pending(peer, id)
+	if req == nil || req.storage == nil {
+		log.Debug("Unrequested storage ranges", "peer", peer.ID(), "reqid", id)
+		return nil
+	}
+	err := func() error {
+		if len(hashes) != len(slots) || len(hashes) > len(req.storage) {
+			return fmt.Errorf("%d ranges for %d accounts", len(hashes), len(req.storage))
+		}
+		for i := range hashes {
+			var ranged [][]byte
+			if i == len(hashes)-1 {
+				ranged = proof
+			}
+			if ranged == nil && req.storage[i].next != (common.Hash{}) {
+				return errors.New("unproven partial storage range")
+			}
+			cont, err := verifyRange(req.storage[i].root, req.storage[i].next, hashes[i], slots[i], ranged)
+			if err != nil {
+				return err
+			}
+			req.cont = cont
+		}
+		return nil
+	}()
+	if err != nil {
+		req.failed = true
+		s.deliverRequest(req)
+		return fmt.Errorf("invalid storage ranges: %v", err)
+	}
+	if len(hashes) == 0 {
+		req.failed = true // Peer doesn't have the state
+	}
+	req.hashes, req.values = hashes, slots
+	s.deliverRequest(req)
+	return nil
+}
+
+// OnByteCodes is a callback method to invoke when a batch of contract codes is
+// received from a remote peer. An error is returned if it contains codes that
+// weren't requested.
+func (s *Syncer) OnByteCodes(peer SyncPeer, id uint64, codes [][]byte) error {
+	req := s.pending(peer, id)
+	if req == nil || req.codes == nil {
+		log.Debug("Unrequested contract codes", "peer", peer.ID(), "reqid", id)
+		return nil
+	}
+	blobs, err := matchBlobs(req.codes, codes)
+	if err != nil {
+		req.failed = true
+		s.deliverRequest(req)
+		return fmt.Errorf("invalid contract codes: %v", err)
+	}
+	req.blobs, req.failed = blobs, len(blobs) == 0
+	s.deliverRequest(req)
+	return nil
+}
+
+// OnTrieNodes is a callback method to invoke when a batch of trie nodes is
+// received from a remote peer. An error is returned if it contains nodes that
+// weren't requested.
+func (s *Syncer) OnTrieNodes(peer SyncPeer, id uint64, nodes [][]byte) error {
+	req := s.pending(peer, id)
+	if req == nil || req.nodes == nil {
+		log.Debug("Unrequested trie nodes", "peer", peer.ID(), "reqid", id)
+		return nil
+	}
+	blobs, err := matchBlobs(req.nodes, nodes)
+	if err != nil {
+		req.failed = true
+		s.deliverRequest(req)
+		return fmt.Errorf("invalid trie nodes: %v", err)
+	}
+	req.blobs, req.failed = blobs, len(blobs) == 0
+	s.deliverRequest(req)
+	return nil
+}
+
+// process handles a finished request in the sync loop, storing the delivered
+// data and returning the undelivered tasks to the queues.
+func (s *Syncer) process(req *request) error {
+	s.lock.Lock()
+	delete(s.requests, req.id)
+	delete(s.busy, req.peer)
+	if req.failed && req.root == s.root {
+		s.stateless[req.peer] = true
+	}
+	s.lock.Unlock()
+
+	var err error
+	switch {
+	case req.account != nil:
+		err = s.processAccounts(req)
+	case req.storage != nil:
+		err = s.processStorage(req)
+	case req.codes != nil:
+		err = s.processCodes(req)
+	case req.nodes != nil:
+		err = s.processNodes(req)
+	}
+	if err != nil {
+		return err
+	}
+	return s.batch.maybeFlush()
+}
+
+// processAccounts stores a delivered account range, scheduling the retrieval of
+// the storage and code of its accounts, and advances the chunk.
+func (s *Syncer) processAccounts(req *request) error {
+	task := req.account
+	task.busy = false
+	if req.hashes == nil || task.done {
+		return nil
+	}
+	hashes, accounts := req.hashes[0], req.values[0]
+	for i, hash := range hashes {
+		if bytes.Compare(hash[:], task.last[:]) > 0 {
+			break // Proof of the chunk's end, belongs to the next one
+		}
+		var account state.Account
+		if err := rlp.DecodeBytes(accounts[i], &account); err != nil {
+			return err
+		}
+		if err := s.batch.Put(append(append([]byte{}, flatAccountPrefix...), hash[:]...), accounts[i]); err != nil {
+			return err
+		}
+		if account.Root != emptyRoot && !s.has(account.Root) {
+			s.storage = append(s.storage, &storageTask{account: hash, root: account.Root, trie: trie.NewStackTrie(s.batch)})
+		}
+		if codeHash := common.BytesToHash(account.CodeHash); codeHash != emptyCode && !s.has(codeHash) {
+			s.codes[codeHash] = struct{}{}
+		}
+		s.stats.a++
+	}
+	if len(hashes) == 0 || !req.cont || bytes.Compare(hashes[len(hashes)-1][:], task.last[:]) >= 0 {
+		task.done = true
+		return nil
+	}
+	task.next = incHash(hashes[len(hashes)-1])
+	return nil
+}
+
+// processStorage feeds the delivered storage slots into the generators of their
+// tries, completing the tries fully delivered.
+func (s *Syncer) processStorage(req *request) error {
+	for _, task := range req.storage {
+		task.busy = false
+	}
+	completed := make(map[*storageTask]bool)
+	for i, hashes := range req.hashes {
+		task := req.storage[i]
+		for j, hash := range hashes {
+			task.trie.Update(hash[:], req.values[i][j])
+		}
+		s.stats.s += uint64(len(hashes))
+
+		if i < len(req.hashes)-1 || !req.cont {
+			if root := task.trie.Hash(); root != task.root {
+				return fmt.Errorf("storage trie %x generated with root %x", task.root, root)
+			}
+			completed[task] = true
+			continue
+		}
+		task.next = incHash(hashes[len(hashes)-1])
+	}
+	if len(completed) > 0 {
+		remaining := s.storage[:0]
+		for _, task := range s.storage {
+			if !completed[task] {
+				remaining = append(remaining, task)
+			}
+		}
+		s.storage = remaining
+	}
+	return nil
+}
+
+// processCodes stores the delivered contract codes, rescheduling the rest.
+func (s *Syncer) processCodes(req *request) error {
+	for _, hash := range req.codes {
+		code, ok := req.blobs[hash]
+		if !ok {
+			s.codes[hash] = struct{}{}
+			continue
+		}
+		if err := s.batch.Put(hash[:], code); err != nil {
+			return err
+		}
+		s.stats.c++
+	}
+	return nil
+}
+
+// processNodes feeds the delivered trie nodes into the healer, rescheduling the
+// rest. Deliveries of a previous root's healing are dropped.
+func (s *Syncer) processNodes(req *request) error {
+	if s.healer == nil || req.root != s.root {
+		return nil
+	}
+	for _, hash := range req.nodes {
+		blob, ok := req.blobs[hash]
+		if !ok {
+			s.healRetry = append(s.healRetry, hash)
+			continue
+		}
+		delete(s.healing, hash)
+
+		_, _, err := s.healer.Process([]trie.SyncResult{{Hash: hash, Data: blob}})
+		switch err {
+		case nil:
+			s.stats.n++
+		case trie.ErrNotRequested, trie.ErrAlreadyProcessed:
+		default:
+			return fmt.Errorf("invalid state node %s: %v", hash.TerminalString(), err)
+		}
+	}
+	if _, err := s.healer.Commit(s.batch); err != nil {
+		return err
+	}
+	return s.batch.flush() // The healer checks the database for existing nodes
+}
+
+// revertRequests abandons all the requests in flight when a sync run terminates,
+// returning their tasks to the queues.
+func (s *Syncer) revertRequests() {
+	s.lock.Lock()
+	reqs := make([]*request, 0, len(s.requests))
+	for _, req := range s.requests {
+		if req.timer != nil {
+			req.timer.Stop()
+		}
+		reqs = append(reqs, req)
+	}
+	s.requests = make(map[uint64]*request)
+	s.busy = make(map[string]bool)
+	s.lock.Unlock()
+
+	for _, req := range reqs {
+		s.revertRequest(req)
+	}
+	if s.batch != nil {
+		if err := s.batch.flush(); err != nil {
+			log.Error("Failed to flush synced state", "err", err)
+		}
+	}
+}
+
+// revertRequest returns the tasks of an undelivered request to the queues.
+func (s *Syncer) revertRequest(req *request) {
+	if req.account != nil {
+		req.account.busy = false
+	}
+	for _, task := range req.storage {
+		task.busy = false
+	}
+	for _, hash := range req.codes {
+		s.codes[hash] = struct{}{}
+	}
+	if s.healer != nil && req.root == s.root {
+		s.healRetry = append(s.healRetry, req.nodes...)
+	}
+}
+
+// has reports whether the database contains the given trie node or code.
+func (s *Syncer) has(hash common.Hash) bool {
+	blob, _ := s.db.Get(hash[:])
+	return len(blob) > 0
+}
+
+// reportProgress logs the sync progress, at most once every log interval unless
+// forced.
+func (s *Syncer) reportProgress(force bool) {
+	if !force && time.Since(s.logTime) < logInterval {
+		return
+	}
+	s.logTime = time.Now()
+
+	var chunks int
+	for _, task := range s.accounts {
+		if task.done {
+			chunks++
+		}
+	}
+	log.Info("Snap state sync in progress", "chunks", fmt.Sprintf("%d/%d", chunks, len(s.accounts)),
+		"accounts", s.stats.a, "slots", s.stats.s, "codes", s.stats.c, "healed", s.stats.n,
+		"storage", len(s.storage), "pending", len(s.codes))
+}
+
+// verifyRange checks a range of trie leaves starting at origin against its
+// proof. A nil proof means the range is the entire trie.
+func verifyRange(root common.Hash, origin common.Hash, hashes []common.Hash, values [][]byte, proof [][]byte) (bool, error) {
+	if len(hashes) != len(values) {
+		return false, fmt.Errorf("%d keys for %d values", len(hashes), len(values))
+	}
+	keys := make([][]byte, len(hashes))
+	for i := range hashes {
+		keys[i] = hashes[i][:]
+	}
+	if proof == nil {
+		if origin != (common.Hash{}) {
+			return false, errors.New("unproven range")
+		}
+		return trie.VerifyRangeProof(root, nil, nil, keys, values, nil)
+	}
+	proofDb, _ := ethdb.NewMemDatabase()
+	for _, node := range proof {
+		proofDb.Put(crypto.Keccak256(node), node)
+	}
+	var last []byte
+	if len(keys) > 0 {
+		last = keys[len(keys)-1]
+	}
+	return trie.VerifyRangeProof(root, origin[:], last, keys, values, proofDb)
+}
+
+// matchBlobs pairs delivered trie nodes or codes with the hashes they were
+// requested by. The blobs must be in the order of the requests, but may skip
+// any of them.
+func matchBlobs(hashes []common.Hash, blobs [][]byte) (map[common.Hash][]byte, error) {
+	matched := make(map[common.Hash][]byte, len(blobs))
+	next := 0
+	for _, blob := range blobs {
+		hash := crypto.Keccak256Hash(blob)
+		for next < len(hashes) && hashes[next] != hash {
+			next++
+		}
+		if next == len(hashes) {
+			return nil, fmt.Errorf("unexpected blob %x", hash)
+		}
+		matched[hash] = blob
+		next++
+	}
+	return matched, nil
+}
+
+// incHash returns the hash following h, wrapping around after the last one.
+func incHash(h common.Hash) common.Hash {
+	for i := len(h) - 1; i >= 0; i-- {
+		if h[i]++; h[i] != 0 {
+			break
+		}
+	}
+	return h
+}
+
+// syncBatch is a write batch flushing itself whenever it grows large.
+type syncBatch struct {
+	db    ethdb.Database
+	batch ethdb.Batch
+	size  int
+}
+
+func newSyncBatch(db ethdb.Database) *syncBatch {
+	return &syncBatch{db: db, batch: db.NewBatch()}
+}
+
+// Put queues an entry for writing.
+func (b *syncBatch) Put(key, value []byte) error {
+	b.size += len(key) + len(value)
+	return b.batch.Put(key, value)
+}
+
+// maybeFlush writes the queued entries if they exceed the ideal batch size.
+func (b *syncBatch) maybeFlush() error {
+	if b.size < idealBatchSize {
+		return nil
+	}
+	return b.flush()
+}
+
+// flush writes the queued entries into the database.
+func (b *syncBatch) flush() error {
+	if b.size == 0 {
+		return nil
+	}
+	if err := b.batch.Write(); err != nil {
+		return err
+	}
+	b.batch, b.size = b.db.NewBatch(), 0
+	return nil
+}
@@ -0,0 +1,292 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// testBackend serves the state of a test database.
+type testBackend struct {
+	db    ethdb.Database
+	snaps *snapshot.Tree
+}
+
+func (b *testBackend) Database() trie.Database   { return b.db }
+func (b *testBackend) Snapshots() *snapshot.Tree { return b.snaps }
+func (b *testBackend) Syncer() *Syncer           { return nil }
+
+// testPeer is a simulated snap peer answering the requests of a syncer from a
+// test backend, limiting its responses to a small size to split the ranges.
+type testPeer struct {
+	id      string
+	backend *testBackend
+	syncer  *Syncer
+	limit   uint64
+
+	tamper  bool       // Whether to corrupt the accounts served
+	budget  int        // Number of requests to serve before going silent, 0 for unlimited
+	served  int        // Number of requests served
+	dropped bool       // Whether the syncer rejected a response
+	lock    sync.Mutex // Protects the counters
+}
+
+func newTestPeer(id string, backend *testBackend, syncer *Syncer) *testPeer {
+	return &testPeer{id: id, backend: backend, syncer: syncer, limit: 4 * 1024}
+}
+
+func (p *testPeer) ID() string { return p.id }
+
+// respond runs a response asynchronously like a remote peer would, dropping the
+// peer if the syncer rejects it.
+func (p *testPeer) respond(deliver func() error) {
+	p.lock.Lock()
+	if p.budget > 0 && p.served >= p.budget {
+		p.lock.Unlock()
+		return
+	}
+	p.served++
+	p.lock.Unlock()
+
+	go func() {
+		err := deliver()
+
+		p.lock.Lock()
+		defer p.lock.Unlock()
+
+		if err != nil && !p.dropped {
+			p.dropped = true
+			p.syncer.Unregister(p.id)
+		}
+	}()
+}
+
+func (p *testPeer) RequestAccountRange(id uint64, root, origin, limit common.Hash, bytes uint64) error {
+	p.respond(func() error {
+		accounts, proof := serviceGetAccountRange(p.backend, &getAccountRangeData{ID: id, Root: root, Origin: origin, Limit: limit, Bytes: p.limit})
+		hashes, blobs := make([]common.Hash, len(accounts)), make([][]byte, len(accounts))
+		for i, account := range accounts {
+			hashes[i], blobs[i] = account.Hash, account.Body
+		}
+		if p.tamper && len(blobs) > 0 {
+			blobs[0] = append(blobs[0][:len(blobs[0]):len(blobs[0])], 0x00)
+		}
+		return p.syncer.OnAccounts(p, id, hashes, blobs, proof)
+	})
+	return nil
+}
+
+func (p *testPeer) RequestStorageRanges(id uint64, root common.Hash, accounts, roots []common.Hash, origin common.Hash, bytes uint64) error {
+	p.respond(func() error {
+		slots, proof := serviceGetStorageRanges(p.backend, &getStorageRangesData{ID: id, Root: root, Accounts: accounts, Roots: roots, Origin: origin, Bytes: p.limit})
+		hashes, blobs := make([][]common.Hash, len(slots)), make([][][]byte, len(slots))
+		for i, set := range slots {
+			hashes[i], blobs[i] = make([]common.Hash, len(set)), make([][]byte, len(set))
+			for j, slot := range set {
+				hashes[i][j], blobs[i][j] = slot.Hash, slot.Body
+			}
+		}
+		return p.syncer.OnStorage(p, id, hashes, blobs, proof)
+	})
+	return nil
+}
+
+func (p *testPeer) RequestByteCodes(id uint64, hashes []common.Hash, bytes uint64) error {
+	p.respond(func() error {
+		return p.syncer.OnByteCodes(p, id, serviceGetBlobs(p.backend.db, hashes, p.limit, maxCodeLookups))
+	})
+	return nil
+}
+
+func (p *testPeer) RequestTrieNodes(id uint64, hashes []common.Hash, bytes uint64) error {
+	p.respond(func() error {
+		return p.syncer.OnTrieNodes(p, id, serviceGetBlobs(p.backend.db, hashes, p.limit, maxTrieLookups))
+	})
+	return nil
+}
+
+// makeTestState populates a state with accounts of varying storage sizes and
+// codes, some of them shared, modifying every modify-th account with the given
+// seed. The state root is returned.
+func makeTestState(statedb *state.StateDB, db ethdb.Database, seed int64, modify int) common.Hash {
+	for i := 0; i < 300; i++ {
+		if i%modify != 0 {
+			continue
+		}
+		addr := common.BigToAddress(big.NewInt(int64(i)))
+		statedb.SetNonce(addr, uint64(i))
+		statedb.AddBalance(addr, big.NewInt(seed+int64(i)))
+
+		if i%10 == 0 {
+			slots := 4
+			if i%100 == 0 {
+				slots = 400 // Spans many responses
+			}
+			for j := 0; j < slots; j++ {
+				statedb.SetState(addr, common.BigToHash(big.NewInt(int64(j))), common.BigToHash(big.NewInt(seed+int64(i*j+1))))
+			}
+		}
+		if i%7 == 0 {
+			statedb.SetCode(addr, []byte{byte(i % 3), byte(seed)})
+		}
+	}
+	root, _ := statedb.CommitTo(db, false)
+	return root
+}
+
+// syncWithPeers syncs the state with the given root into db from the peers,
+// failing the test if it doesn't complete.
+func syncWithPeers(t *testing.T, syncer *Syncer, root common.Hash, peers ...*testPeer) {
+	for _, peer := range peers {
+		if err := syncer.Register(peer); err != nil {
+			t.Fatalf("failed to register peer %s: %v", peer.id, err)
+		}
+	}
+	done := make(chan error, 1)
+	cancel := make(chan struct{})
+	go func() { done <- syncer.Sync(root, cancel) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("sync failed: %v", err)
+		}
+	case <-time.After(20 * time.Second):
+		close(cancel)
+		t.Fatalf("sync timed out")
+	}
+}
+
+// checkSynced verifies that the state with the given root is complete in db.
+func checkSynced(t *testing.T, db ethdb.Database, root common.Hash) {
+	report, err := state.CheckState(db, root)
+	if err != nil {
+		t.Fatalf("failed to check synced state: %v", err)
+	}
+	if !report.Healthy() {
+		t.Fatalf("synced state inconsistent: %+v", report)
+	}
+	if report.Accounts == 0 {
+		t.Fatalf("synced state empty")
+	}
+}
+
+// Tests that a state is retrieved from multiple peers, both from the tries and
+// from the snapshot of the source.
+func TestSync(t *testing.T)         { testSync(t, false) }
+func TestSyncSnapshot(t *testing.T) { testSync(t, true) }
+
+func testSync(t *testing.T, snapshots bool) {
+	source, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(source))
+	root := makeTestState(statedb, source, 1, 1)
+
+	backend := &testBackend{db: source}
+	if snapshots {
+		snaps, err := snapshot.New(source, root)
+		if err != nil {
+			t.Fatalf("failed to create snapshot: %v", err)
+		}
+		defer snaps.Release()
+		backend.snaps = snaps
+	}
+	db, _ := ethdb.NewMemDatabase()
+	syncer := NewSyncer(db)
+	syncWithPeers(t, syncer, root, newTestPeer("a", backend, syncer), newTestPeer("b", backend, syncer))
+	checkSynced(t, db, root)
+
+	for _, key := range db.Keys() {
+		if len(key) > len(flatAccountPrefix) && string(key[:len(flatAccountPrefix)]) == string(flatAccountPrefix) {
+			t.Fatalf("staged account %x left in database", key)
+		}
+	}
+}
+
+// Tests that a sync interrupted and moved on to a newer state root completes,
+// healing the retrieved parts of the older state.
+func TestSyncRootChange(t *testing.T) {
+	source, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(source))
+	root1 := makeTestState(statedb, source, 1, 1)
+	statedb, _ = state.New(root1, state.NewDatabase(source))
+	root2 := makeTestState(statedb, source, 2, 3)
+
+	var (
+		backend = &testBackend{db: source}
+		db, _   = ethdb.NewMemDatabase()
+		syncer  = NewSyncer(db)
+		peer    = newTestPeer("a", backend, syncer)
+	)
+	// Sync part of the first state, until the peer stops responding
+	peer.budget = 10
+	if err := syncer.Register(peer); err != nil {
+		t.Fatalf("failed to register peer: %v", err)
+	}
+	cancel := make(chan struct{})
+	done := make(chan error, 1)
+	go func() { done <- syncer.Sync(root1, cancel) }()
+
+	time.Sleep(100 * time.Millisecond)
+	close(cancel)
+	if err := <-done; err != ErrCancelled {
+		t.Fatalf("cancelled sync error mismatch: have %v, want %v", err, ErrCancelled)
+	}
+	if err := syncer.Unregister(peer.id); err != nil {
+		t.Fatalf("failed to unregister peer: %v", err)
+	}
+	// Continue with the second state and check it's complete
+	peer.budget = 0
+	syncWithPeers(t, syncer, root2, peer)
+	checkSynced(t, db, root2)
+
+	if syncer.stats.n == 0 {
+		t.Errorf("no trie nodes healed")
+	}
+}
+
+// Tests that peers delivering invalid ranges are rejected, and the state is
+// retrieved from the honest ones.
+func TestSyncInvalidRange(t *testing.T) {
+	source, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(source))
+	root := makeTestState(statedb, source, 1, 1)
+
+	var (
+		backend = &testBackend{db: source}
+		db, _   = ethdb.NewMemDatabase()
+		syncer  = NewSyncer(db)
+		bad     = newTestPeer("bad", backend, syncer)
+	)
+	bad.tamper = true
+	syncWithPeers(t, syncer, root, bad, newTestPeer("good", backend, syncer))
+	checkSynced(t, db, root)
+
+	bad.lock.Lock()
+	defer bad.lock.Unlock()
+	if bad.served > 0 && !bad.dropped {
+		t.Errorf("peer serving invalid ranges not dropped")
+	}
+}
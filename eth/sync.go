@@ -60,8 +60,9 @@ func (pm *ProtocolManager) syncTransactions(p *peer) {
 
 // txsyncLoop takes care of the initial transaction sync for each new
 // connection. When a new peer appears, we relay all currently pending
-// transactions. In order to minimise egress bandwidth usage, we send
-// the transactions in small packs to one peer at a time.
+// transactions (or only their hashes for eth/65 peers). In order to minimise
+// egress bandwidth usage, we send the transactions in small packs to one peer
+// at a time.
 func (pm *ProtocolManager) txsyncLoop() {
 	var (
 		pending = make(map[discover.NodeID]*txsync)
@@ -78,7 +79,11 @@ func (pm *ProtocolManager) txsyncLoop() {
 		pack.txs = pack.txs[:0]
 		for i := 0; i < len(s.txs) && size < txsyncPackSize; i++ {
 			pack.txs = append(pack.txs, s.txs[i])
-			size += s.txs[i].Size()
+			if s.p.version >= eth65 {
+				size += common.HashLength
+			} else {
+				size += s.txs[i].Size()
+			}
 		}
 		// Remove the transactions that will be sent.
 		s.txs = s.txs[:copy(s.txs, s.txs[len(pack.txs):])]
@@ -86,9 +91,19 @@ func (pm *ProtocolManager) txsyncLoop() {
 			delete(pending, s.p.ID())
 		}
 		// Send the pack in the background.
-		s.p.Log().Trace("Sending batch of transactions", "count", len(pack.txs), "bytes", size)
 		sending = true
-		go func() { done <- pack.p.SendTransactions(pack.txs) }()
+		if s.p.version >= eth65 {
+			// Newer peers only get announcements and retrieve what they need
+			hashes := make([]common.Hash, len(pack.txs))
+			for i, tx := range pack.txs {
+				hashes[i] = tx.Hash()
+			}
+			s.p.Log().Trace("Announcing batch of transactions", "count", len(hashes), "bytes", size)
+			go func() { done <- pack.p.SendNewPooledTransactionHashes(hashes) }()
+		} else {
+			s.p.Log().Trace("Sending batch of transactions", "count", len(pack.txs), "bytes", size)
+			go func() { done <- pack.p.SendTransactions(pack.txs) }()
+		}
 	}
 
 	// pick chooses the next pending sync.
@@ -174,7 +189,10 @@ func (pm *ProtocolManager) synchronise(peer *peer) {
 	}
 	// Otherwise try to sync with the downloader
 	mode := downloader.FullSync
-	if atomic.LoadUint32(&pm.fastSync) == 1 {
+	if atomic.LoadUint32(&pm.checkpointSync) == 1 {
+		// Checkpoint sync was explicitly requested, and explicitly granted
+		mode = downloader.CheckpointSync
+	} else if atomic.LoadUint32(&pm.fastSync) == 1 {
 		// Fast sync was explicitly requested, and explicitly granted
 		mode = downloader.FastSync
 	} else if currentBlock.NumberU64() == 0 && pm.blockchain.CurrentFastBlock().NumberU64() > 0 {
@@ -207,4 +225,11 @@ func (pm *ProtocolManager) synchronise(peer *peer) {
 			atomic.StoreUint32(&pm.fastSync, 0)
 		}
 	}
+	// If checkpoint sync was enabled, and we synced up, disable it
+	if atomic.LoadUint32(&pm.checkpointSync) == 1 {
+		if pm.blockchain.CurrentBlock().NumberU64() > 0 {
+			log.Info("Checkpoint sync complete, auto disabling")
+			atomic.StoreUint32(&pm.checkpointSync, 0)
+		}
+	}
 }
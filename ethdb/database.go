@@ -22,6 +22,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/syndtr/goleveldb/leveldb"
@@ -29,12 +30,17 @@ import (
 	"github.com/syndtr/goleveldb/leveldb/filter"
 	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 
 	gometrics "github.com/rcrowley/go-metrics"
 )
 
 var OpenFileLimit = 64
 
+// deleteRangeBatchSize is the number of deletions accumulated by DeleteRange
+// before they are flushed to disk.
+const deleteRangeBatchSize = 10000
+
 type LDBDatabase struct {
 	fn string      // filename for reporting
 	db *leveldb.DB // LevelDB instance
@@ -49,6 +55,8 @@ type LDBDatabase struct {
 	compReadMeter  gometrics.Meter // Meter for measuring the data read during compaction
 	compWriteMeter gometrics.Meter // Meter for measuring the data written during compaction
 
+	ancient *freezer // Append-only flat file store of the ancient chain data, nil if not attached
+
 	quitLock sync.Mutex      // Mutex protecting the quit channel access
 	quitChan chan chan error // Quit channel to stop the metrics collection before closing the database
 
@@ -89,6 +97,20 @@ func NewLDBDatabase(file string, cache int, handles int) (*LDBDatabase, error) {
 	}, nil
 }
 
+// NewLDBDatabaseWithFreezer returns a LevelDB wrapped object, backed by a freezer
+// in the given directory storing the ancient immutable chain data.
+func NewLDBDatabaseWithFreezer(file string, cache int, handles int, freezer string) (*LDBDatabase, error) {
+	db, err := NewLDBDatabase(file, cache, handles)
+	if err != nil {
+		return nil, err
+	}
+	if db.ancient, err = newFreezer(freezer); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
 // Path returns the path to the database directory.
 func (db *LDBDatabase) Path() string {
 	return db.fn
@@ -141,8 +163,46 @@ func (db *LDBDatabase) Delete(key []byte) error {
 	return db.db.Delete(key, nil)
 }
 
-func (db *LDBDatabase) NewIterator() iterator.Iterator {
-	return db.db.NewIterator(nil, nil)
+// Has retrieves if a key is present in the database.
+func (db *LDBDatabase) Has(key []byte) (bool, error) {
+	return db.db.Has(key, nil)
+}
+
+// DeleteRange deletes all the keys in the range [start, end) from the database.
+// A nil end deletes everything from start onwards.
+func (db *LDBDatabase) DeleteRange(start, end []byte) error {
+	it := db.db.NewIterator(&util.Range{Start: start, Limit: end}, nil)
+	defer it.Release()
+
+	batch := new(leveldb.Batch)
+	for it.Next() {
+		batch.Delete(it.Key())
+		if batch.Len() >= deleteRangeBatchSize {
+			if err := db.db.Write(batch, nil); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return db.db.Write(batch, nil)
+}
+
+// NewIterator creates a binary-alphabetical iterator over the subset of the
+// database contents with a particular key prefix, starting at a particular
+// initial key (or after, if it does not exist).
+func (db *LDBDatabase) NewIterator(prefix []byte, start []byte) iterator.Iterator {
+	return db.db.NewIterator(bytesPrefixRange(prefix, start), nil)
+}
+
+// bytesPrefixRange returns the key range covering all the keys with the given
+// prefix, starting at the given key relative to the prefix.
+func bytesPrefixRange(prefix, start []byte) *util.Range {
+	r := util.BytesPrefix(prefix)
+	r.Start = append(common.CopyBytes(prefix), start...)
+	return r
 }
 
 func (db *LDBDatabase) Close() {
@@ -157,6 +217,11 @@ func (db *LDBDatabase) Close() {
 			db.log.Error("Metrics collection failed", "err", err)
 		}
 	}
+	if db.ancient != nil {
+		if err := db.ancient.Close(); err != nil {
+			db.log.Error("Failed to close ancient database", "err", err)
+		}
+	}
 	err := db.db.Close()
 	if err == nil {
 		db.log.Info("Database closed")
@@ -165,6 +230,82 @@ func (db *LDBDatabase) Close() {
 	}
 }
 
+// HasAncient implements AncientReader, returning whether the specified ancient
+// data exists in the attached freezer.
+func (db *LDBDatabase) HasAncient(kind string, number uint64) (bool, error) {
+	if db.ancient == nil {
+		return false, errNotSupported
+	}
+	return db.ancient.HasAncient(kind, number)
+}
+
+// Ancient implements AncientReader, retrieving an ancient binary blob from the
+// attached freezer.
+func (db *LDBDatabase) Ancient(kind string, number uint64) ([]byte, error) {
+	if db.ancient == nil {
+		return nil, errNotSupported
+	}
+	return db.ancient.Ancient(kind, number)
+}
+
+// Ancients implements AncientReader, returning the number of frozen blocks.
+func (db *LDBDatabase) Ancients() (uint64, error) {
+	if db.ancient == nil {
+		return 0, errNotSupported
+	}
+	return db.ancient.Ancients()
+}
+
+// AncientSize implements AncientReader, returning the size of the specified
+// ancient data category.
+func (db *LDBDatabase) AncientSize(kind string) (uint64, error) {
+	if db.ancient == nil {
+		return 0, errNotSupported
+	}
+	return db.ancient.AncientSize(kind)
+}
+
+// AppendAncient implements AncientWriter, injecting the data of the next block
+// into the attached freezer.
+func (db *LDBDatabase) AppendAncient(number uint64, hash, header, body, receipts, td []byte) error {
+	if db.ancient == nil {
+		return errNotSupported
+	}
+	return db.ancient.AppendAncient(number, hash, header, body, receipts, td)
+}
+
+// TruncateAncients implements AncientWriter, discarding all but the first n
+// blocks from the attached freezer.
+func (db *LDBDatabase) TruncateAncients(n uint64) error {
+	if db.ancient == nil {
+		return errNotSupported
+	}
+	return db.ancient.TruncateAncients(n)
+}
+
+// Sync implements AncientWriter, flushing the attached freezer to disk.
+func (db *LDBDatabase) Sync() error {
+	if db.ancient == nil {
+		return errNotSupported
+	}
+	return db.ancient.Sync()
+}
+
+// Stat returns a particular internal stat of the database, the "leveldb." prefix
+// of the property name being optional.
+func (db *LDBDatabase) Stat(property string) (string, error) {
+	if !strings.HasPrefix(property, "leveldb.") {
+		property = "leveldb." + property
+	}
+	return db.db.GetProperty(property)
+}
+
+// Compact flattens the underlying data store for the given key range. A nil
+// start or limit extends the range to the first or last key respectively.
+func (db *LDBDatabase) Compact(start []byte, limit []byte) error {
+	return db.db.CompactRange(util.Range{Start: start, Limit: limit})
+}
+
 func (db *LDBDatabase) LDB() *leveldb.DB {
 	return db.db
 }
@@ -313,10 +454,34 @@ func (dt *table) Get(key []byte) ([]byte, error) {
 	return dt.db.Get(append([]byte(dt.prefix), key...))
 }
 
+func (dt *table) Has(key []byte) (bool, error) {
+	return dt.db.Has(append([]byte(dt.prefix), key...))
+}
+
 func (dt *table) Delete(key []byte) error {
 	return dt.db.Delete(append([]byte(dt.prefix), key...))
 }
 
+// DeleteRange deletes all the keys in the range [start, end) from the table. A
+// nil end deletes everything from start until the end of the table.
+func (dt *table) DeleteRange(start, end []byte) error {
+	limit := util.BytesPrefix([]byte(dt.prefix)).Limit
+	if end != nil {
+		limit = append([]byte(dt.prefix), end...)
+	}
+	return dt.db.DeleteRange(append([]byte(dt.prefix), start...), limit)
+}
+
+// NewIterator creates an iterator over the subset of the table contents with a
+// particular key prefix, starting at a particular initial key. The keys returned
+// by the iterator don't contain the table prefix.
+func (dt *table) NewIterator(prefix []byte, start []byte) iterator.Iterator {
+	return &tableIterator{
+		Iterator: dt.db.NewIterator(append([]byte(dt.prefix), prefix...), start),
+		prefix:   dt.prefix,
+	}
+}
+
 func (dt *table) Close() {
 	// Do nothing; don't close the underlying DB.
 }
@@ -342,3 +507,25 @@ func (tb *tableBatch) Put(key, value []byte) error {
 func (tb *tableBatch) Write() error {
 	return tb.batch.Write()
 }
+
+// tableIterator wraps a database iterator, stripping the table prefix from the
+// keys of the entries.
+type tableIterator struct {
+	iterator.Iterator
+	prefix string
+}
+
+// Seek moves the iterator to the first entry with a key greater than or equal
+// to the given table key.
+func (it *tableIterator) Seek(key []byte) bool {
+	return it.Iterator.Seek(append([]byte(it.prefix), key...))
+}
+
+// Key returns the key of the current entry without the table prefix.
+func (it *tableIterator) Key() []byte {
+	key := it.Iterator.Key()
+	if key == nil {
+		return nil
+	}
+	return key[len(it.prefix):]
+}
@@ -17,8 +17,11 @@
 package ethdb
 
 import (
+	"bytes"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
 )
@@ -32,3 +35,147 @@ func newDb() *LDBDatabase {
 
 	return db
 }
+
+// testDatabases creates a LevelDB, an in-memory and a table database for running
+// the same tests against all of them, along with a cleanup function.
+func testDatabases(t *testing.T) (map[string]Database, func()) {
+	dir, err := ioutil.TempDir("", "ethdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ldb, err := NewLDBDatabase(dir, 0, 0)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("failed to create leveldb: %v", err)
+	}
+	memdb, _ := NewMemDatabase()
+	tabledb, _ := NewMemDatabase()
+	tabledb.Put([]byte("b"), []byte("outside"))
+	tabledb.Put([]byte("ta"), []byte("outside"))
+	tabledb.Put([]byte("tac"), []byte("outside"))
+
+	dbs := map[string]Database{
+		"leveldb": ldb,
+		"memory":  memdb,
+		"table":   NewTable(tabledb, "tab"),
+	}
+	return dbs, func() {
+		ldb.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// Tests that the presence of keys is reported correctly.
+func TestDatabaseHas(t *testing.T) {
+	dbs, cleanup := testDatabases(t)
+	defer cleanup()
+
+	for name, db := range dbs {
+		db.Put([]byte("a"), nil)
+		db.Put([]byte("b"), []byte{0x01})
+
+		for key, want := range map[string]bool{"a": true, "b": true, "c": false, "": false} {
+			if have, err := db.Has([]byte(key)); have != want || err != nil {
+				t.Errorf("%s: key %q: presence mismatch: have %v/%v, want %v/nil", name, key, have, err, want)
+			}
+		}
+	}
+}
+
+// Tests that iterators only return the entries with the requested prefix, in
+// key order, starting at the requested key.
+func TestDatabaseIterator(t *testing.T) {
+	dbs, cleanup := testDatabases(t)
+	defer cleanup()
+
+	keys := []string{"1", "10", "11", "2", "20", "21", "22", "3"}
+	tests := []struct {
+		prefix, start string
+		want          []string
+	}{
+		{"", "", keys},
+		{"1", "", []string{"1", "10", "11"}},
+		{"2", "1", []string{"21", "22"}},
+		{"2", "0", []string{"20", "21", "22"}},
+		{"2", "15", []string{"22"}},
+		{"", "21", []string{"21", "22", "3"}},
+		{"3", "0", nil},
+		{"4", "", nil},
+	}
+	for name, db := range dbs {
+		for _, key := range keys {
+			db.Put([]byte(key), []byte("v"+key))
+		}
+		for i, tt := range tests {
+			var have []string
+
+			it := db.NewIterator([]byte(tt.prefix), []byte(tt.start))
+			for it.Next() {
+				if !bytes.Equal(it.Value(), []byte("v"+string(it.Key()))) {
+					t.Errorf("%s: test %d: value mismatch for key %q: have %q", name, i, it.Key(), it.Value())
+				}
+				have = append(have, string(it.Key()))
+			}
+			it.Release()
+
+			if !equalKeys(have, tt.want) {
+				t.Errorf("%s: test %d: iterated keys mismatch: have %q, want %q", name, i, have, tt.want)
+			}
+		}
+	}
+}
+
+// Tests that range deletions remove exactly the keys within the range.
+func TestDatabaseDeleteRange(t *testing.T) {
+	dbs, cleanup := testDatabases(t)
+	defer cleanup()
+
+	tests := []struct {
+		start, end string
+		nilEnd     bool
+		want       []string
+	}{
+		{start: "10", end: "2", want: []string{"1", "2", "20", "3"}},
+		{start: "", end: "20", want: []string{"20", "3"}},
+		{start: "25", nilEnd: true, want: []string{"1", "10", "11", "2", "20"}},
+		{start: "", nilEnd: true, want: nil},
+	}
+	for name, db := range dbs {
+		for i, tt := range tests {
+			for _, key := range []string{"1", "10", "11", "2", "20", "3"} {
+				db.Put([]byte(key), []byte{0x01})
+			}
+			end := []byte(tt.end)
+			if tt.nilEnd {
+				end = nil
+			}
+			if err := db.DeleteRange([]byte(tt.start), end); err != nil {
+				t.Fatalf("%s: test %d: failed to delete range: %v", name, i, err)
+			}
+			var have []string
+
+			it := db.NewIterator(nil, nil)
+			for it.Next() {
+				have = append(have, string(it.Key()))
+			}
+			it.Release()
+
+			if !equalKeys(have, tt.want) {
+				t.Errorf("%s: test %d: remaining keys mismatch: have %q, want %q", name, i, have, tt.want)
+			}
+		}
+	}
+}
+
+// equalKeys reports whether two key lists contain the same keys in the same order.
+func equalKeys(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,216 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Names of the tables the freezer stores the ancient chain data in.
+const (
+	FreezerHeaderTable     = "headers"  // RLP encoded block headers
+	FreezerHashTable       = "hashes"   // Canonical block hashes
+	FreezerBodiesTable     = "bodies"   // RLP encoded block bodies
+	FreezerReceiptTable    = "receipts" // RLP encoded block receipts for storage
+	FreezerDifficultyTable = "diffs"    // RLP encoded total difficulties
+)
+
+// freezerNoSnappy configures whether compression is disabled for the ancient
+// tables. Hashes and difficulties don't compress well.
+var freezerNoSnappy = map[string]bool{
+	FreezerHeaderTable:     false,
+	FreezerHashTable:       true,
+	FreezerBodiesTable:     false,
+	FreezerReceiptTable:    false,
+	FreezerDifficultyTable: true,
+}
+
+var (
+	// errNotSupported is returned if the database doesn't support the required
+	// operation, e.g. ancient data access without a freezer attached.
+	errNotSupported = errors.New("this operation is not supported")
+
+	// errUnknownTable is returned if the user attempts to read from a table that
+	// is not tracked by the freezer.
+	errUnknownTable = errors.New("unknown table")
+)
+
+// freezer is an append-only database to store immutable chain data into flat
+// files. The append only nature minimizes disk writes, and the flat files don't
+// suffer from the write amplification and compactions of LevelDB, keeping the
+// key-value store small and fast.
+//
+// All tables always contain the same number of items, which is maintained by
+// rolling back partial appends and repairing the tables on startup.
+type freezer struct {
+	frozen uint64 // Number of blocks already frozen, atomically accessed
+
+	tables map[string]*freezerTable // Data tables for storing everything
+}
+
+// newFreezer creates a chain freezer that moves ancient chain data into append
+// only flat file containers.
+func newFreezer(datadir string) (*freezer, error) {
+	freezer := &freezer{
+		tables: make(map[string]*freezerTable),
+	}
+	for name, disableSnappy := range freezerNoSnappy {
+		table, err := newFreezerTable(datadir, name, disableSnappy)
+		if err != nil {
+			freezer.Close()
+			return nil, err
+		}
+		freezer.tables[name] = table
+	}
+	if err := freezer.repair(); err != nil {
+		freezer.Close()
+		return nil, err
+	}
+	log.Info("Opened ancient database", "database", datadir, "frozen", freezer.frozen)
+	return freezer, nil
+}
+
+// repair truncates all data tables to the same length, dropping any blocks that
+// were only partially appended before a crash.
+func (f *freezer) repair() error {
+	min := uint64(0)
+	for i, name := range f.tableNames() {
+		if items := f.tables[name].Items(); i == 0 || items < min {
+			min = items
+		}
+	}
+	for _, table := range f.tables {
+		if err := table.truncate(min); err != nil {
+			return err
+		}
+	}
+	atomic.StoreUint64(&f.frozen, min)
+	return nil
+}
+
+// tableNames returns the names of the freezer tables in a stable order.
+func (f *freezer) tableNames() []string {
+	return []string{FreezerHeaderTable, FreezerHashTable, FreezerBodiesTable, FreezerReceiptTable, FreezerDifficultyTable}
+}
+
+// HasAncient returns an indicator whether the specified ancient data exists in
+// the freezer.
+func (f *freezer) HasAncient(kind string, number uint64) (bool, error) {
+	if table := f.tables[kind]; table != nil {
+		return table.Items() > number, nil
+	}
+	return false, nil
+}
+
+// Ancient retrieves an ancient binary blob from the append-only immutable files.
+func (f *freezer) Ancient(kind string, number uint64) ([]byte, error) {
+	if table := f.tables[kind]; table != nil {
+		return table.Retrieve(number)
+	}
+	return nil, errUnknownTable
+}
+
+// Ancients returns the length of the frozen items.
+func (f *freezer) Ancients() (uint64, error) {
+	return atomic.LoadUint64(&f.frozen), nil
+}
+
+// AncientSize returns the ancient size of the specified category.
+func (f *freezer) AncientSize(kind string) (uint64, error) {
+	if table := f.tables[kind]; table != nil {
+		return table.Size()
+	}
+	return 0, errUnknownTable
+}
+
+// AppendAncient injects all binary blobs belonging to a block at the end of the
+// append-only immutable table files. Out-of-order injections are rejected, but
+// concurrent appends of the same block are not safe, so a single writer is
+// expected.
+func (f *freezer) AppendAncient(number uint64, hash, header, body, receipts, td []byte) (err error) {
+	// Roll back all tables to the starting position in case of error
+	defer func() {
+		if err != nil {
+			frozen := atomic.LoadUint64(&f.frozen)
+			for _, table := range f.tables {
+				if rerr := table.truncate(frozen); rerr != nil {
+					log.Error("Failed to roll back ancient tables", "number", number, "err", rerr)
+				}
+			}
+		}
+	}()
+	blobs := map[string][]byte{
+		FreezerHashTable:       hash,
+		FreezerHeaderTable:     header,
+		FreezerBodiesTable:     body,
+		FreezerReceiptTable:    receipts,
+		FreezerDifficultyTable: td,
+	}
+	for _, name := range f.tableNames() {
+		if err := f.tables[name].Append(number, blobs[name]); err != nil {
+			return fmt.Errorf("failed to append %s #%d: %v", name, number, err)
+		}
+	}
+	atomic.AddUint64(&f.frozen, 1)
+	return nil
+}
+
+// TruncateAncients discards any recent data above the provided threshold number.
+func (f *freezer) TruncateAncients(items uint64) error {
+	if atomic.LoadUint64(&f.frozen) <= items {
+		return nil
+	}
+	for _, table := range f.tables {
+		if err := table.truncate(items); err != nil {
+			return err
+		}
+	}
+	atomic.StoreUint64(&f.frozen, items)
+	return nil
+}
+
+// Sync flushes all data tables to disk.
+func (f *freezer) Sync() error {
+	var errs []error
+	for _, table := range f.tables {
+		if err := table.Sync(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+// Close terminates the chain freezer, closing all the data files.
+func (f *freezer) Close() error {
+	var errs []error
+	for _, table := range f.tables {
+		if err := table.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/golang/snappy"
+)
+
+var (
+	// errClosed is returned if an operation attempts to read from or write to the
+	// freezer table after it has already been closed.
+	errClosed = errors.New("closed")
+
+	// errOutOfBounds is returned if the item requested is not contained within the
+	// freezer table.
+	errOutOfBounds = errors.New("out of bounds")
+
+	// errOutOrderInsertion is returned if the user attempts to inject out-of-order
+	// binary blobs into the freezer.
+	errOutOrderInsertion = errors.New("the append operation is out-order")
+)
+
+// indexEntrySize is the size of a single index entry, the big endian encoded
+// offset of the end of the item in the data file.
+const indexEntrySize = 8
+
+// freezerTable is an append-only flat file store of binary blobs. Each table is
+// made up of a data file holding the concatenated (optionally snappy compressed)
+// items, and an index file holding the end offsets of the items within it. The
+// index file starts with a zero entry, so item i spans the data between index
+// entries i and i+1.
+type freezerTable struct {
+	items   uint64 // Number of items stored in the table
+	dataLen uint64 // Length of the data file, the offset the next item goes to
+
+	noCompression bool // If true, the items are stored without snappy compression
+	index         *os.File
+	data          *os.File
+
+	lock   sync.RWMutex // Mutex protecting the files and counters
+	logger log.Logger   // Contextual logger tracking the table name
+}
+
+// newFreezerTable opens the given path as a freezer table, creating the files
+// if they don't exist and repairing any inconsistencies left by a crash.
+func newFreezerTable(path, name string, noCompression bool) (*freezerTable, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+	idxName, dataName := fmt.Sprintf("%s.ridx", name), fmt.Sprintf("%s.rdat", name)
+	if !noCompression {
+		idxName, dataName = fmt.Sprintf("%s.cidx", name), fmt.Sprintf("%s.cdat", name)
+	}
+	index, err := os.OpenFile(filepath.Join(path, idxName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.OpenFile(filepath.Join(path, dataName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		index.Close()
+		return nil, err
+	}
+	tab := &freezerTable{
+		noCompression: noCompression,
+		index:         index,
+		data:          data,
+		logger:        log.New("table", name),
+	}
+	if err := tab.repair(); err != nil {
+		tab.Close()
+		return nil, err
+	}
+	return tab, nil
+}
+
+// repair cross checks the index and data files, truncating them to the last
+// item that was fully written into both.
+func (t *freezerTable) repair() error {
+	stat, err := t.index.Stat()
+	if err != nil {
+		return err
+	}
+	// Ensure the index starts with the zero entry and holds whole entries only
+	if stat.Size() == 0 {
+		if _, err := t.index.WriteAt(make([]byte, indexEntrySize), 0); err != nil {
+			return err
+		}
+	}
+	indexLen := uint64(stat.Size())
+	if indexLen < indexEntrySize {
+		indexLen = indexEntrySize
+	}
+	if overflow := indexLen % indexEntrySize; overflow != 0 {
+		indexLen -= overflow
+		if err := t.index.Truncate(int64(indexLen)); err != nil {
+			return err
+		}
+	}
+	if stat, err = t.data.Stat(); err != nil {
+		return err
+	}
+	dataLen := uint64(stat.Size())
+
+	// Drop any index entries pointing past the data, and data past the last entry
+	items := indexLen/indexEntrySize - 1
+	offset, err := t.offset(items)
+	if err != nil {
+		return err
+	}
+	for offset > dataLen {
+		items--
+		if offset, err = t.offset(items); err != nil {
+			return err
+		}
+	}
+	if err := t.index.Truncate(int64((items + 1) * indexEntrySize)); err != nil {
+		return err
+	}
+	if offset < dataLen {
+		if err := t.data.Truncate(int64(offset)); err != nil {
+			return err
+		}
+	}
+	if indexLen != (items+1)*indexEntrySize || offset != dataLen {
+		t.logger.Warn("Repaired freezer table", "items", items, "size", offset)
+	}
+	t.items, t.dataLen = items, offset
+	return nil
+}
+
+// offset retrieves the data file offset the item with the given index ends at,
+// or zero for the sentinel entry preceding the first item.
+func (t *freezerTable) offset(item uint64) (uint64, error) {
+	var entry [indexEntrySize]byte
+	if _, err := t.index.ReadAt(entry[:], int64(item*indexEntrySize)); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(entry[:]), nil
+}
+
+// Items returns the number of items stored in the table.
+func (t *freezerTable) Items() uint64 {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.items
+}
+
+// Size returns the total data size of the table, including the index.
+func (t *freezerTable) Size() (uint64, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if t.index == nil {
+		return 0, errClosed
+	}
+	return t.dataLen + (t.items+1)*indexEntrySize, nil
+}
+
+// Append injects a binary blob at the end of the freezer table. The item number
+// must be the next one in sequence, otherwise an error is returned.
+func (t *freezerTable) Append(item uint64, blob []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return errClosed
+	}
+	if item != t.items {
+		return errOutOrderInsertion
+	}
+	if !t.noCompression {
+		blob = snappy.Encode(nil, blob)
+	}
+	// Write the data first, so a crash leaves at most some dangling data behind
+	if _, err := t.data.WriteAt(blob, int64(t.dataLen)); err != nil {
+		return err
+	}
+	var entry [indexEntrySize]byte
+	binary.BigEndian.PutUint64(entry[:], t.dataLen+uint64(len(blob)))
+	if _, err := t.index.WriteAt(entry[:], int64((t.items+1)*indexEntrySize)); err != nil {
+		return err
+	}
+	t.items, t.dataLen = t.items+1, t.dataLen+uint64(len(blob))
+	return nil
+}
+
+// Retrieve looks up the data offset of an item with the given number and
+// retrieves the raw binary blob from the data file.
+func (t *freezerTable) Retrieve(item uint64) ([]byte, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if t.index == nil {
+		return nil, errClosed
+	}
+	if item >= t.items {
+		return nil, errOutOfBounds
+	}
+	start, err := t.offset(item)
+	if err != nil {
+		return nil, err
+	}
+	end, err := t.offset(item + 1)
+	if err != nil {
+		return nil, err
+	}
+	if start > end {
+		return nil, fmt.Errorf("corrupt index entry for item %d: start %d, end %d", item, start, end)
+	}
+	blob := make([]byte, end-start)
+	if _, err := t.data.ReadAt(blob, int64(start)); err != nil {
+		return nil, err
+	}
+	if t.noCompression {
+		return blob, nil
+	}
+	return snappy.Decode(nil, blob)
+}
+
+// truncate discards any recent items above the provided threshold number. The
+// index is shortened first, so a crash midway leaves only dangling data behind
+// which is cleaned up by the next repair.
+func (t *freezerTable) truncate(items uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return errClosed
+	}
+	if items >= t.items {
+		return nil
+	}
+	offset, err := t.offset(items)
+	if err != nil {
+		return err
+	}
+	if err := t.index.Truncate(int64((items + 1) * indexEntrySize)); err != nil {
+		return err
+	}
+	if err := t.data.Truncate(int64(offset)); err != nil {
+		return err
+	}
+	t.items, t.dataLen = items, offset
+	return nil
+}
+
+// Sync pushes any pending data from memory out to disk.
+func (t *freezerTable) Sync() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return errClosed
+	}
+	if err := t.data.Sync(); err != nil {
+		return err
+	}
+	return t.index.Sync()
+}
+
+// Close closes all opened files of the table.
+func (t *freezerTable) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var errs []error
+	if t.index != nil {
+		if err := t.index.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		t.index = nil
+	}
+	if t.data != nil {
+		if err := t.data.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		t.data = nil
+	}
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testFreezerItem generates a deterministic blob of varying size for an item.
+func testFreezerItem(item uint64) []byte {
+	return bytes.Repeat([]byte{byte(item)}, int(item%17)+1)
+}
+
+// Tests that items appended to a freezer table can be retrieved, both with and
+// without compression, and that the table survives a reopen.
+func TestFreezerTableBasics(t *testing.T) {
+	for _, noCompression := range []bool{false, true} {
+		dir, err := ioutil.TempDir("", "freezer")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		table, err := newFreezerTable(dir, "test", noCompression)
+		if err != nil {
+			t.Fatalf("failed to create table: %v", err)
+		}
+		for i := uint64(0); i < 100; i++ {
+			if err := table.Append(i, testFreezerItem(i)); err != nil {
+				t.Fatalf("item %d: failed to append: %v", i, err)
+			}
+		}
+		if err := table.Append(101, []byte{0x01}); err != errOutOrderInsertion {
+			t.Errorf("out of order append error mismatch: have %v, want %v", err, errOutOrderInsertion)
+		}
+		table.Close()
+
+		if table, err = newFreezerTable(dir, "test", noCompression); err != nil {
+			t.Fatalf("failed to reopen table: %v", err)
+		}
+		if items := table.Items(); items != 100 {
+			t.Fatalf("item count mismatch: have %d, want %d", items, 100)
+		}
+		for i := uint64(0); i < 100; i++ {
+			blob, err := table.Retrieve(i)
+			if err != nil {
+				t.Fatalf("item %d: failed to retrieve: %v", i, err)
+			}
+			if !bytes.Equal(blob, testFreezerItem(i)) {
+				t.Fatalf("item %d: blob mismatch: have %x, want %x", i, blob, testFreezerItem(i))
+			}
+		}
+		if _, err := table.Retrieve(100); err != errOutOfBounds {
+			t.Errorf("out of bounds retrieval error mismatch: have %v, want %v", err, errOutOfBounds)
+		}
+		table.Close()
+	}
+}
+
+// Tests that a freezer table is repaired to the last fully written item if the
+// index or data file has been partially written.
+func TestFreezerTableRepair(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	table, err := newFreezerTable(dir, "test", true)
+	if err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	for i := uint64(0); i < 10; i++ {
+		table.Append(i, testFreezerItem(i))
+	}
+	table.Close()
+
+	// Dangling data and a partial index entry should both be dropped
+	appendFile(t, filepath.Join(dir, "test.rdat"), []byte{0xde, 0xad})
+	appendFile(t, filepath.Join(dir, "test.ridx"), []byte{0x00, 0x01})
+
+	if table, err = newFreezerTable(dir, "test", true); err != nil {
+		t.Fatalf("failed to reopen table: %v", err)
+	}
+	if items := table.Items(); items != 10 {
+		t.Fatalf("item count mismatch after dangling data: have %d, want %d", items, 10)
+	}
+	if blob, _ := table.Retrieve(9); !bytes.Equal(blob, testFreezerItem(9)) {
+		t.Fatalf("last item mismatch: have %x, want %x", blob, testFreezerItem(9))
+	}
+	table.Close()
+
+	// Missing data should drop the index entries pointing into it
+	if err := os.Truncate(filepath.Join(dir, "test.rdat"), 1); err != nil {
+		t.Fatal(err)
+	}
+	if table, err = newFreezerTable(dir, "test", true); err != nil {
+		t.Fatalf("failed to reopen table: %v", err)
+	}
+	defer table.Close()
+
+	if items := table.Items(); items != 1 {
+		t.Fatalf("item count mismatch after missing data: have %d, want %d", items, 1)
+	}
+	if err := table.Append(1, testFreezerItem(1)); err != nil {
+		t.Fatalf("failed to append after repair: %v", err)
+	}
+	if blob, _ := table.Retrieve(1); !bytes.Equal(blob, testFreezerItem(1)) {
+		t.Fatalf("appended item mismatch: have %x, want %x", blob, testFreezerItem(1))
+	}
+}
+
+// Tests that the freezer keeps its tables in sync, truncating them together and
+// repairing partially appended blocks on startup.
+func TestFreezerTruncate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := newFreezer(dir)
+	if err != nil {
+		t.Fatalf("failed to create freezer: %v", err)
+	}
+	for i := uint64(0); i < 10; i++ {
+		item := testFreezerItem(i)
+		if err := f.AppendAncient(i, item, item, item, item, item); err != nil {
+			t.Fatalf("block %d: failed to append: %v", i, err)
+		}
+	}
+	if err := f.AppendAncient(5, nil, nil, nil, nil, nil); err == nil {
+		t.Fatalf("out of order block appended")
+	}
+	if err := f.TruncateAncients(6); err != nil {
+		t.Fatalf("failed to truncate: %v", err)
+	}
+	// Append a partial block into a single table only and reopen
+	f.tables[FreezerHeaderTable].Append(6, testFreezerItem(6))
+	f.Close()
+
+	if f, err = newFreezer(dir); err != nil {
+		t.Fatalf("failed to reopen freezer: %v", err)
+	}
+	defer f.Close()
+
+	if frozen, _ := f.Ancients(); frozen != 6 {
+		t.Fatalf("frozen count mismatch: have %d, want %d", frozen, 6)
+	}
+	for _, name := range f.tableNames() {
+		if ok, _ := f.HasAncient(name, 5); !ok {
+			t.Errorf("%s: block 5 missing", name)
+		}
+		if ok, _ := f.HasAncient(name, 6); ok {
+			t.Errorf("%s: block 6 not truncated", name)
+		}
+		if blob, _ := f.Ancient(name, 5); !bytes.Equal(blob, testFreezerItem(5)) {
+			t.Errorf("%s: block 5 mismatch: have %x, want %x", name, blob, testFreezerItem(5))
+		}
+	}
+}
+
+// appendFile appends raw data to the end of a file.
+func appendFile(t *testing.T, path string, data []byte) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -16,15 +16,90 @@
 
 package ethdb
 
-type Database interface {
+import "github.com/syndtr/goleveldb/leveldb/iterator"
+
+// Putter wraps the database write operation supported by both batches and regular databases.
+type Putter interface {
 	Put(key []byte, value []byte) error
+}
+
+type Database interface {
+	Putter
+	Iteratee
 	Get(key []byte) ([]byte, error)
+	Has(key []byte) (bool, error)
 	Delete(key []byte) error
+	DeleteRange(start, end []byte) error
 	Close()
 	NewBatch() Batch
 }
 
 type Batch interface {
-	Put(key, value []byte) error
+	Putter
 	Write() error
 }
+
+// Iteratee wraps the NewIterator method of a backing data store.
+type Iteratee interface {
+	// NewIterator creates a binary-alphabetical iterator over the subset of the
+	// database contents with a particular key prefix, starting at a particular
+	// initial key (or after, if it does not exist). The start key is relative to
+	// the prefix.
+	NewIterator(prefix []byte, start []byte) iterator.Iterator
+}
+
+// Stater wraps the Stat method of a backing data store.
+type Stater interface {
+	// Stat returns a particular internal stat of the database.
+	Stat(property string) (string, error)
+}
+
+// Compacter wraps the Compact method of a backing data store.
+type Compacter interface {
+	// Compact flattens the underlying data store for the given key range. In
+	// essence, deleted and overwritten versions are discarded, and the data is
+	// rearranged to reduce the cost of operations needed to access them.
+	//
+	// A nil start is treated as a key before all keys in the data store; a nil
+	// limit is treated as a key after all keys in the data store. If both are
+	// nil then it will compact the entire data store.
+	Compact(start []byte, limit []byte) error
+}
+
+// AncientReader contains the methods required to read from immutable ancient
+// chain data.
+type AncientReader interface {
+	// HasAncient returns an indicator whether the specified data exists in the
+	// ancient store.
+	HasAncient(kind string, number uint64) (bool, error)
+
+	// Ancient retrieves an ancient binary blob from the append-only immutable files.
+	Ancient(kind string, number uint64) ([]byte, error)
+
+	// Ancients returns the number of blocks stored in the ancient store.
+	Ancients() (uint64, error)
+
+	// AncientSize returns the ancient size of the specified category.
+	AncientSize(kind string) (uint64, error)
+}
+
+// AncientWriter contains the methods required to write to immutable ancient
+// chain data.
+type AncientWriter interface {
+	// AppendAncient injects all binary blobs belonging to a block at the end of
+	// the append-only immutable table files.
+	AppendAncient(number uint64, hash, header, body, receipts, td []byte) error
+
+	// TruncateAncients discards all but the first n ancient data from the store.
+	TruncateAncients(n uint64) error
+
+	// Sync flushes all in-memory ancient store data to disk.
+	Sync() error
+}
+
+// AncientStore contains all the methods required to handle the ancient store
+// backing the immutable chain data.
+type AncientStore interface {
+	AncientReader
+	AncientWriter
+}
@@ -17,10 +17,14 @@
 package ethdb
 
 import (
+	"bytes"
 	"errors"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
 )
 
 /*
@@ -66,6 +70,53 @@ func (db *MemDatabase) Keys() [][]byte {
 	return keys
 }
 
+// Has retrieves if a key is present in the database.
+func (db *MemDatabase) Has(key []byte) (bool, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	_, ok := db.db[string(key)]
+	return ok, nil
+}
+
+// NewIterator returns an iterator over a snapshot of the database entries with
+// a particular key prefix, starting at a particular initial key. The entries are
+// sorted by key in the same order as the LevelDB iterator would return them.
+func (db *MemDatabase) NewIterator(prefix []byte, start []byte) iterator.Iterator {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var (
+		pr      = string(prefix)
+		st      = string(append(common.CopyBytes(prefix), start...))
+		entries = make(memEntries, 0, len(db.db))
+	)
+	for key, value := range db.db {
+		if !strings.HasPrefix(key, pr) || key < st {
+			continue
+		}
+		entries = append(entries, kv{[]byte(key), value})
+	}
+	sort.Sort(entries)
+	return iterator.NewArrayIterator(entries)
+}
+
+// memEntries is a key sorted list of database entries, implementing the array
+// interface of the LevelDB iterators.
+type memEntries []kv
+
+func (e memEntries) Len() int           { return len(e) }
+func (e memEntries) Less(i, j int) bool { return bytes.Compare(e[i].k, e[j].k) < 0 }
+func (e memEntries) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+
+func (e memEntries) Search(key []byte) int {
+	return sort.Search(len(e), func(i int) bool { return bytes.Compare(e[i].k, key) >= 0 })
+}
+
+func (e memEntries) Index(i int) (key, value []byte) {
+	return e[i].k, e[i].v
+}
+
 /*
 func (db *MemDatabase) GetKeys() []*common.Key {
 	data, _ := db.Get([]byte("KeyRing"))
@@ -82,6 +133,20 @@ func (db *MemDatabase) Delete(key []byte) error {
 	return nil
 }
 
+// DeleteRange deletes all the keys in the range [start, end) from the database.
+// A nil end deletes everything from start onwards.
+func (db *MemDatabase) DeleteRange(start, end []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	for key := range db.db {
+		if key >= string(start) && (end == nil || key < string(end)) {
+			delete(db.db, key)
+		}
+	}
+	return nil
+}
+
 func (db *MemDatabase) Close() {}
 
 func (db *MemDatabase) NewBatch() Batch {
@@ -0,0 +1,342 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// object is a GraphQL object type, resolving its fields on demand. Resolvers
+// return nil for null values, objects (or slices of them) for nested types and
+// JSON encodable values for scalars.
+type object interface {
+	resolve(ctx context.Context, field string, args arguments) (interface{}, error)
+}
+
+// objectType is the reflected type of an object resolver.
+var objectType = reflect.TypeOf((*object)(nil)).Elem()
+
+// typeName returns the GraphQL type name of an object, which is the name of the
+// Go type implementing it.
+func typeName(obj object) string {
+	return reflect.Indirect(reflect.ValueOf(obj)).Type().Name()
+}
+
+// errUnknownField is returned when querying a field an object doesn't have.
+func errUnknownField(obj object, field string) error {
+	return fmt.Errorf("cannot query field %q on type %q", field, typeName(obj))
+}
+
+// queryError is a request or field error reported back to the caller.
+type queryError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// response is the result of executing a GraphQL request.
+type response struct {
+	Data   interface{}   `json:"data,omitempty"`
+	Errors []*queryError `json:"errors,omitempty"`
+}
+
+// result is the ordered set of fields resolved on an object.
+type result struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// MarshalJSON implements json.Marshaler, retaining the order of the fields as
+// they were requested.
+func (r *result) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range r.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		value, err := json.Marshal(r.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// field is a collected field to resolve, merging all selections sharing the
+// same response key.
+type field struct {
+	key        string
+	name       string
+	args       map[string]interface{}
+	selections []*selection
+}
+
+// executor runs a single operation of a parsed document against a root object.
+type executor struct {
+	doc    *document
+	vars   map[string]interface{}
+	errors []*queryError
+}
+
+// execute runs the requested operation of a query against the root object.
+func execute(ctx context.Context, root object, query string, operationName string, vars map[string]interface{}) *response {
+	doc, err := parse(query)
+	if err != nil {
+		return &response{Errors: []*queryError{{Message: err.Error()}}}
+	}
+	op, err := doc.operation(operationName)
+	if err != nil {
+		return &response{Errors: []*queryError{{Message: err.Error()}}}
+	}
+	if op.kind != "query" {
+		return &response{Errors: []*queryError{{Message: fmt.Sprintf("%s operations are not supported", op.kind)}}}
+	}
+	e := &executor{doc: doc, vars: make(map[string]interface{})}
+	for _, def := range op.variables {
+		value, ok := vars[def.name]
+		if !ok {
+			value, _ = e.value(def.defValue) // constant, cannot fail
+		}
+		if value == nil && def.required {
+			return &response{Errors: []*queryError{{Message: fmt.Sprintf("missing value for required variable $%s", def.name)}}}
+		}
+		e.vars[def.name] = value
+	}
+	data := e.executeObject(ctx, root, op.selections, nil)
+	return &response{Data: data, Errors: e.errors}
+}
+
+// operation picks the operation to execute from the document.
+func (doc *document) operation(name string) (*operation, error) {
+	if name == "" {
+		if len(doc.operations) > 1 {
+			return nil, fmt.Errorf("operation name required for documents with multiple operations")
+		}
+		return doc.operations[0], nil
+	}
+	for _, op := range doc.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+// fail records a field error at the given path.
+func (e *executor) fail(path []interface{}, err error) {
+	e.errors = append(e.errors, &queryError{Message: err.Error(), Path: append([]interface{}{}, path...)})
+}
+
+// executeObject resolves the selected fields of an object.
+func (e *executor) executeObject(ctx context.Context, obj object, selections []*selection, path []interface{}) *result {
+	fields, err := e.collect(selections, nil, make(map[string]int), make(map[string]bool))
+	if err != nil {
+		e.fail(path, err)
+		return nil
+	}
+	res := &result{values: make(map[string]interface{})}
+	for _, f := range fields {
+		fpath := append(path, f.key)
+		res.keys = append(res.keys, f.key)
+
+		if f.name == "__typename" {
+			res.values[f.key] = typeName(obj)
+			continue
+		}
+		args, err := e.arguments(f.args)
+		if err != nil {
+			e.fail(fpath, err)
+			continue
+		}
+		value, err := obj.resolve(ctx, f.name, args)
+		if err != nil {
+			e.fail(fpath, err)
+			continue
+		}
+		res.values[f.key] = e.complete(ctx, value, f.selections, fpath)
+	}
+	return res
+}
+
+// complete converts a resolved value into its result, descending into objects
+// and lists of objects.
+func (e *executor) complete(ctx context.Context, value interface{}, selections []*selection, path []interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil
+	}
+	if obj, ok := value.(object); ok {
+		if len(selections) == 0 {
+			e.fail(path, fmt.Errorf("field of type %q must have a selection of subfields", typeName(obj)))
+			return nil
+		}
+		return e.executeObject(ctx, obj, selections, path)
+	}
+	if rv.Kind() == reflect.Slice && rv.Type().Elem().Implements(objectType) {
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = e.complete(ctx, rv.Index(i).Interface(), selections, append(path, i))
+		}
+		return list
+	}
+	if len(selections) > 0 {
+		e.fail(path, fmt.Errorf("field of scalar type must not have a selection of subfields"))
+		return nil
+	}
+	return value
+}
+
+// collect flattens the selections into the list of fields to resolve, expanding
+// fragments, evaluating @skip and @include and merging fields that share the
+// same response key.
+func (e *executor) collect(selections []*selection, fields []*field, index map[string]int, visited map[string]bool) ([]*field, error) {
+	for _, sel := range selections {
+		include, err := e.included(sel)
+		if err != nil {
+			return nil, err
+		}
+		if !include {
+			continue
+		}
+		switch {
+		case sel.spread:
+			if visited[sel.name] {
+				continue
+			}
+			frag, ok := e.doc.fragments[sel.name]
+			if !ok {
+				return nil, fmt.Errorf("unknown fragment %q", sel.name)
+			}
+			visited[sel.name] = true
+			if fields, err = e.collect(frag.selections, fields, index, visited); err != nil {
+				return nil, err
+			}
+
+		case sel.name == "":
+			if fields, err = e.collect(sel.selections, fields, index, visited); err != nil {
+				return nil, err
+			}
+
+		default:
+			key := sel.alias
+			if key == "" {
+				key = sel.name
+			}
+			if i, ok := index[key]; ok {
+				if fields[i].name != sel.name || !reflect.DeepEqual(fields[i].args, sel.args) {
+					return nil, fmt.Errorf("conflicting selections for %q", key)
+				}
+				fields[i].selections = append(fields[i].selections, sel.selections...)
+				continue
+			}
+			index[key] = len(fields)
+			fields = append(fields, &field{
+				key:        key,
+				name:       sel.name,
+				args:       sel.args,
+				selections: append([]*selection{}, sel.selections...),
+			})
+		}
+	}
+	return fields, nil
+}
+
+// included evaluates the @skip and @include directives of a selection.
+func (e *executor) included(sel *selection) (bool, error) {
+	for _, dir := range sel.directives {
+		switch dir.name {
+		case "skip", "include":
+			args, err := e.arguments(dir.args)
+			if err != nil {
+				return false, err
+			}
+			cond, ok := args["if"].(bool)
+			if !ok {
+				return false, fmt.Errorf("directive @%s requires a boolean \"if\" argument", dir.name)
+			}
+			if cond == (dir.name == "skip") {
+				return false, nil
+			}
+		default:
+			return false, fmt.Errorf("unknown directive @%s", dir.name)
+		}
+	}
+	return true, nil
+}
+
+// arguments substitutes the variables within the raw arguments of a field.
+func (e *executor) arguments(raw map[string]interface{}) (arguments, error) {
+	args := make(arguments, len(raw))
+	for name, value := range raw {
+		resolved, err := e.value(value)
+		if err != nil {
+			return nil, err
+		}
+		args[name] = resolved
+	}
+	return args, nil
+}
+
+// value substitutes the variables within a raw input value.
+func (e *executor) value(raw interface{}) (interface{}, error) {
+	switch v := raw.(type) {
+	case variable:
+		value, ok := e.vars[string(v)]
+		if !ok {
+			return nil, fmt.Errorf("undeclared variable $%s", v)
+		}
+		return value, nil
+
+	case enum:
+		return string(v), nil
+
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			value, err := e.value(item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = value
+		}
+		return list, nil
+
+	case map[string]interface{}:
+		fields := make(map[string]interface{}, len(v))
+		for name, item := range v {
+			value, err := e.value(item)
+			if err != nil {
+				return nil, err
+			}
+			fields[name] = value
+		}
+		return fields, nil
+	}
+	return raw, nil
+}
@@ -0,0 +1,746 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/filters"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// maxBlockRange is the maximum number of blocks a single blocks query may span.
+const maxBlockRange = 1024
+
+// Backend is the chain access needed to resolve queries, shared with the
+// JSON-RPC API handlers.
+type Backend interface {
+	ethapi.Backend
+	filters.Backend
+}
+
+// arguments are the input values of a field, with all variables substituted.
+type arguments map[string]interface{}
+
+// long retrieves a 64 bit unsigned integer argument, given either as a number
+// or as a decimal or hex encoded string.
+func (args arguments) long(name string) (uint64, bool, error) {
+	value, ok := args[name]
+	if !ok || value == nil {
+		return 0, false, nil
+	}
+	var (
+		n   uint64
+		err error
+	)
+	switch v := value.(type) {
+	case int64:
+		if v < 0 {
+			err = errors.New("negative value")
+		}
+		n = uint64(v)
+	case float64:
+		if v < 0 || v != float64(uint64(v)) {
+			err = errors.New("not an unsigned integer")
+		}
+		n = uint64(v)
+	case json.Number:
+		n, err = strconv.ParseUint(string(v), 10, 64)
+	case string:
+		if strings.HasPrefix(v, "0x") {
+			n, err = hexutil.DecodeUint64(v)
+		} else {
+			n, err = strconv.ParseUint(v, 10, 64)
+		}
+	default:
+		err = errors.New("not an integer")
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid argument %q: %v", name, err)
+	}
+	return n, true, nil
+}
+
+// bytes retrieves a hex encoded binary argument of the given length.
+func (args arguments) bytes(name string, length int) ([]byte, bool, error) {
+	value, ok := args[name]
+	if !ok || value == nil {
+		return nil, false, nil
+	}
+	blob, err := decodeBytes(value, length)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid argument %q: %v", name, err)
+	}
+	return blob, true, nil
+}
+
+// hash retrieves a 32 byte hash argument.
+func (args arguments) hash(name string) (common.Hash, bool, error) {
+	blob, ok, err := args.bytes(name, common.HashLength)
+	return common.BytesToHash(blob), ok, err
+}
+
+// address retrieves a 20 byte address argument.
+func (args arguments) address(name string) (common.Address, bool, error) {
+	blob, ok, err := args.bytes(name, common.AddressLength)
+	return common.BytesToAddress(blob), ok, err
+}
+
+// decodeBytes decodes a hex string input value of the given length.
+func decodeBytes(value interface{}, length int) ([]byte, error) {
+	str, ok := value.(string)
+	if !ok {
+		return nil, errors.New("not a hex string")
+	}
+	blob, err := hexutil.Decode(str)
+	if err != nil {
+		return nil, err
+	}
+	if len(blob) != length {
+		return nil, fmt.Errorf("invalid length %d, want %d", len(blob), length)
+	}
+	return blob, nil
+}
+
+// number retrieves the block number argument to resolve state at, defaulting to
+// the given one.
+func (args arguments) number(name string, def rpc.BlockNumber) (rpc.BlockNumber, error) {
+	n, ok, err := args.long(name)
+	if err != nil || !ok {
+		return def, err
+	}
+	return rpc.BlockNumber(n), nil
+}
+
+// logFilter is the parsed form of the log filter arguments.
+type logFilter struct {
+	from, to  int64
+	addresses []common.Address
+	topics    [][]common.Hash
+}
+
+// filter retrieves a log filter argument, with fromBlock and toBlock defaulting
+// to the latest block.
+func (args arguments) filter(name string) (*logFilter, error) {
+	raw, ok := args[name].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("missing argument %q", name)
+	}
+	fields := arguments(raw)
+	crit := &logFilter{from: rpc.LatestBlockNumber.Int64(), to: rpc.LatestBlockNumber.Int64()}
+
+	if n, ok, err := fields.long("fromBlock"); err != nil {
+		return nil, err
+	} else if ok {
+		crit.from = int64(n)
+	}
+	if n, ok, err := fields.long("toBlock"); err != nil {
+		return nil, err
+	} else if ok {
+		crit.to = int64(n)
+	}
+	if raw, ok := fields["addresses"]; ok && raw != nil {
+		list, ok := raw.([]interface{})
+		if !ok {
+			return nil, errors.New("invalid argument \"addresses\": not a list")
+		}
+		for _, item := range list {
+			blob, err := decodeBytes(item, common.AddressLength)
+			if err != nil {
+				return nil, fmt.Errorf("invalid argument \"addresses\": %v", err)
+			}
+			crit.addresses = append(crit.addresses, common.BytesToAddress(blob))
+		}
+	}
+	if raw, ok := fields["topics"]; ok && raw != nil {
+		list, ok := raw.([]interface{})
+		if !ok {
+			return nil, errors.New("invalid argument \"topics\": not a list")
+		}
+		for _, item := range list {
+			alternatives, ok := item.([]interface{})
+			if !ok {
+				return nil, errors.New("invalid argument \"topics\": not a list of lists")
+			}
+			topics := []common.Hash{}
+			for _, alt := range alternatives {
+				blob, err := decodeBytes(alt, common.HashLength)
+				if err != nil {
+					return nil, fmt.Errorf("invalid argument \"topics\": %v", err)
+				}
+				topics = append(topics, common.BytesToHash(blob))
+			}
+			crit.topics = append(crit.topics, topics)
+		}
+	}
+	return crit, nil
+}
+
+// find runs the log filter against the backend.
+func (crit *logFilter) find(ctx context.Context, backend Backend) ([]*Log, error) {
+	filter := filters.New(backend)
+	filter.SetBeginBlock(crit.from)
+	filter.SetEndBlock(crit.to)
+	filter.SetAddresses(crit.addresses)
+	filter.SetTopics(crit.topics)
+
+	logs, err := filter.Find(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*Log, len(logs))
+	for i, log := range logs {
+		res[i] = &Log{backend: backend, tx: &Transaction{backend: backend, hash: log.TxHash}, log: log}
+	}
+	return res, nil
+}
+
+// Query is the root of all queries, resolving:
+//
+//	block(number: Long, hash: Bytes32): Block
+//	blocks(from: Long!, to: Long): [Block!]!
+//	transaction(hash: Bytes32!): Transaction
+//	logs(filter: FilterCriteria!): [Log!]!
+//	pending: Pending!
+//	gasPrice: BigInt!
+//	protocolVersion: Int!
+type Query struct {
+	backend Backend
+}
+
+func (q *Query) resolve(ctx context.Context, field string, args arguments) (interface{}, error) {
+	switch field {
+	case "block":
+		number, hasNumber, err := args.long("number")
+		if err != nil {
+			return nil, err
+		}
+		hash, hasHash, err := args.hash("hash")
+		if err != nil {
+			return nil, err
+		}
+		var block *types.Block
+		switch {
+		case hasNumber && hasHash:
+			return nil, errors.New("only one of number or hash may be specified")
+		case hasHash:
+			block, err = q.backend.GetBlock(ctx, hash)
+		case hasNumber:
+			block, err = q.backend.BlockByNumber(ctx, rpc.BlockNumber(number))
+		default:
+			block, err = q.backend.BlockByNumber(ctx, rpc.LatestBlockNumber)
+		}
+		if block == nil || err != nil {
+			return nil, err
+		}
+		return &Block{backend: q.backend, block: block}, nil
+
+	case "blocks":
+		from, ok, err := args.long("from")
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New("missing argument \"from\"")
+		}
+		to, ok, err := args.long("to")
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			to = q.backend.CurrentBlock().NumberU64()
+		}
+		if to >= from && to-from >= maxBlockRange {
+			return nil, fmt.Errorf("block range too large, maximum %d", maxBlockRange)
+		}
+		blocks := []*Block{}
+		for number := from; number <= to; number++ {
+			block, err := q.backend.BlockByNumber(ctx, rpc.BlockNumber(number))
+			if err != nil {
+				return nil, err
+			}
+			if block == nil {
+				break
+			}
+			blocks = append(blocks, &Block{backend: q.backend, block: block})
+		}
+		return blocks, nil
+
+	case "transaction":
+		hash, ok, err := args.hash("hash")
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New("missing argument \"hash\"")
+		}
+		tx := &Transaction{backend: q.backend, hash: hash}
+		if tx.load(); tx.tx == nil {
+			return nil, nil
+		}
+		return tx, nil
+
+	case "logs":
+		crit, err := args.filter("filter")
+		if err != nil {
+			return nil, err
+		}
+		return crit.find(ctx, q.backend)
+
+	case "pending":
+		return &Pending{backend: q.backend}, nil
+
+	case "gasPrice":
+		price, err := q.backend.SuggestPrice(ctx)
+		return (*hexutil.Big)(price), err
+
+	case "protocolVersion":
+		return q.backend.ProtocolVersion(), nil
+	}
+	return nil, errUnknownField(q, field)
+}
+
+// Block is a block of the chain, resolving:
+//
+//	number: Long!
+//	hash: Bytes32!
+//	parent: Block
+//	nonce: Bytes!
+//	transactionsRoot: Bytes32!
+//	transactionCount: Int!
+//	stateRoot: Bytes32!
+//	receiptsRoot: Bytes32!
+//	miner(block: Long): Account!
+//	extraData: Bytes!
+//	gasLimit: BigInt!
+//	gasUsed: BigInt!
+//	timestamp: BigInt!
+//	logsBloom: Bytes!
+//	mixHash: Bytes32!
+//	difficulty: BigInt!
+//	totalDifficulty: BigInt!
+//	ommerCount: Int!
+//	ommers: [Block!]!
+//	ommerHash: Bytes32!
+//	transactions: [Transaction!]!
+//	transactionAt(index: Int!): Transaction
+//	logs(filter: BlockFilterCriteria!): [Log!]!
+//	account(address: Address!): Account!
+type Block struct {
+	backend Backend
+	block   *types.Block
+}
+
+func (b *Block) resolve(ctx context.Context, field string, args arguments) (interface{}, error) {
+	header := b.block.Header()
+	switch field {
+	case "number":
+		return header.Number.Uint64(), nil
+	case "hash":
+		return b.block.Hash(), nil
+	case "parent":
+		if header.Number.Sign() == 0 {
+			return nil, nil
+		}
+		parent, err := b.backend.GetBlock(ctx, header.ParentHash)
+		if parent == nil || err != nil {
+			return nil, err
+		}
+		return &Block{backend: b.backend, block: parent}, nil
+	case "nonce":
+		return hexutil.Bytes(header.Nonce[:]), nil
+	case "transactionsRoot":
+		return header.TxHash, nil
+	case "transactionCount":
+		return len(b.block.Transactions()), nil
+	case "stateRoot":
+		return header.Root, nil
+	case "receiptsRoot":
+		return header.ReceiptHash, nil
+	case "miner":
+		return b.account(args, header.Coinbase)
+	case "extraData":
+		return hexutil.Bytes(header.Extra), nil
+	case "gasLimit":
+		return (*hexutil.Big)(header.GasLimit), nil
+	case "gasUsed":
+		return (*hexutil.Big)(header.GasUsed), nil
+	case "timestamp":
+		return (*hexutil.Big)(header.Time), nil
+	case "logsBloom":
+		return hexutil.Bytes(header.Bloom[:]), nil
+	case "mixHash":
+		return header.MixDigest, nil
+	case "difficulty":
+		return (*hexutil.Big)(header.Difficulty), nil
+	case "totalDifficulty":
+		td := b.backend.GetTd(b.block.Hash())
+		if td == nil {
+			return nil, fmt.Errorf("total difficulty of block %x not found", b.block.Hash())
+		}
+		return (*hexutil.Big)(td), nil
+	case "ommerCount":
+		return len(b.block.Uncles()), nil
+	case "ommers":
+		ommers := []*Block{}
+		for _, uncle := range b.block.Uncles() {
+			ommers = append(ommers, &Block{backend: b.backend, block: types.NewBlockWithHeader(uncle)})
+		}
+		return ommers, nil
+	case "ommerHash":
+		return header.UncleHash, nil
+	case "transactions":
+		txs := []*Transaction{}
+		for i := range b.block.Transactions() {
+			txs = append(txs, b.transaction(i))
+		}
+		return txs, nil
+	case "transactionAt":
+		index, ok, err := args.long("index")
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New("missing argument \"index\"")
+		}
+		if index >= uint64(len(b.block.Transactions())) {
+			return nil, nil
+		}
+		return b.transaction(int(index)), nil
+	case "logs":
+		crit, err := args.filter("filter")
+		if err != nil {
+			return nil, err
+		}
+		crit.from, crit.to = header.Number.Int64(), header.Number.Int64()
+		return crit.find(ctx, b.backend)
+	case "account":
+		addr, ok, err := args.address("address")
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New("missing argument \"address\"")
+		}
+		return &Account{backend: b.backend, address: addr, number: rpc.BlockNumber(header.Number.Int64())}, nil
+	}
+	return nil, errUnknownField(b, field)
+}
+
+// account resolves an account at the block number given in the arguments,
+// defaulting to this block.
+func (b *Block) account(args arguments, addr common.Address) (*Account, error) {
+	number, err := args.number("block", rpc.BlockNumber(b.block.Number().Int64()))
+	if err != nil {
+		return nil, err
+	}
+	return &Account{backend: b.backend, address: addr, number: number}, nil
+}
+
+// transaction wraps the transaction at the given index of the block.
+func (b *Block) transaction(index int) *Transaction {
+	tx := b.block.Transactions()[index]
+	return &Transaction{
+		backend: b.backend,
+		hash:    tx.Hash(),
+		tx:      tx,
+		block:   b.block.Hash(),
+		number:  b.block.NumberU64(),
+		index:   uint64(index),
+		mined:   true,
+	}
+}
+
+// Transaction is a mined or pending transaction, resolving:
+//
+//	hash: Bytes32!
+//	nonce: Long!
+//	index: Int
+//	from(block: Long): Account!
+//	to(block: Long): Account
+//	value: BigInt!
+//	gasPrice: BigInt!
+//	gas: BigInt!
+//	inputData: Bytes!
+//	block: Block
+//	gasUsed: BigInt
+//	cumulativeGasUsed: BigInt
+//	createdContract(block: Long): Account
+//	logs: [Log!]
+type Transaction struct {
+	backend Backend
+	hash    common.Hash
+	tx      *types.Transaction // Lazily loaded from the database or the pool
+
+	block  common.Hash // Hash of the including block if mined
+	number uint64      // Number of the including block if mined
+	index  uint64      // Index within the including block if mined
+	mined  bool        // Whether the transaction was found within a block
+}
+
+// load retrieves the transaction from the chain or the transaction pool, if it
+// hasn't been loaded yet.
+func (t *Transaction) load() {
+	if t.tx != nil {
+		return
+	}
+	if tx, block, number, index := core.GetTransaction(t.backend.ChainDb(), t.hash); tx != nil {
+		t.tx, t.block, t.number, t.index, t.mined = tx, block, number, index, true
+		return
+	}
+	t.tx = t.backend.GetPoolTransaction(t.hash)
+}
+
+func (t *Transaction) resolve(ctx context.Context, field string, args arguments) (interface{}, error) {
+	if field == "hash" {
+		return t.hash, nil
+	}
+	if t.load(); t.tx == nil {
+		return nil, fmt.Errorf("transaction %x not found", t.hash)
+	}
+	switch field {
+	case "nonce":
+		return t.tx.Nonce(), nil
+	case "index":
+		if !t.mined {
+			return nil, nil
+		}
+		return t.index, nil
+	case "from":
+		signer := types.MakeSigner(t.backend.ChainConfig(), new(big.Int).SetUint64(t.number))
+		if !t.mined {
+			signer = types.MakeSigner(t.backend.ChainConfig(), t.backend.CurrentBlock().Number())
+		}
+		from, err := types.Sender(signer, t.tx)
+		if err != nil {
+			return nil, err
+		}
+		return t.account(args, from)
+	case "to":
+		if t.tx.To() == nil {
+			return nil, nil
+		}
+		return t.account(args, *t.tx.To())
+	case "value":
+		return (*hexutil.Big)(t.tx.Value()), nil
+	case "gasPrice":
+		return (*hexutil.Big)(t.tx.GasPrice()), nil
+	case "gas":
+		return (*hexutil.Big)(t.tx.Gas()), nil
+	case "inputData":
+		return hexutil.Bytes(t.tx.Data()), nil
+	case "block":
+		if !t.mined {
+			return nil, nil
+		}
+		block, err := t.backend.GetBlock(ctx, t.block)
+		if block == nil || err != nil {
+			return nil, err
+		}
+		return &Block{backend: t.backend, block: block}, nil
+	case "gasUsed", "cumulativeGasUsed", "createdContract", "logs":
+		receipt, err := t.receipt(ctx)
+		if receipt == nil || err != nil {
+			return nil, err
+		}
+		switch field {
+		case "gasUsed":
+			return (*hexutil.Big)(receipt.GasUsed), nil
+		case "cumulativeGasUsed":
+			return (*hexutil.Big)(receipt.CumulativeGasUsed), nil
+		case "createdContract":
+			if t.tx.To() != nil {
+				return nil, nil
+			}
+			return t.account(args, receipt.ContractAddress)
+		default:
+			logs := make([]*Log, len(receipt.Logs))
+			for i, log := range receipt.Logs {
+				logs[i] = &Log{backend: t.backend, tx: t, log: log}
+			}
+			return logs, nil
+		}
+	}
+	return nil, errUnknownField(t, field)
+}
+
+// receipt retrieves the receipt of a mined transaction.
+func (t *Transaction) receipt(ctx context.Context) (*types.Receipt, error) {
+	if !t.mined {
+		return nil, nil
+	}
+	receipts, err := t.backend.GetReceipts(ctx, t.block)
+	if err != nil {
+		return nil, err
+	}
+	if t.index >= uint64(len(receipts)) {
+		return nil, nil
+	}
+	return receipts[t.index], nil
+}
+
+// account resolves an account at the block number given in the arguments,
+// defaulting to the including block, or the pending one if not yet mined.
+func (t *Transaction) account(args arguments, addr common.Address) (*Account, error) {
+	def := rpc.PendingBlockNumber
+	if t.mined {
+		def = rpc.BlockNumber(t.number)
+	}
+	number, err := args.number("block", def)
+	if err != nil {
+		return nil, err
+	}
+	return &Account{backend: t.backend, address: addr, number: number}, nil
+}
+
+// Log is an event emitted by a mined transaction, resolving:
+//
+//	index: Int!
+//	account(block: Long): Account!
+//	topics: [Bytes32!]!
+//	data: Bytes!
+//	transaction: Transaction!
+type Log struct {
+	backend Backend
+	tx      *Transaction
+	log     *types.Log
+}
+
+func (l *Log) resolve(ctx context.Context, field string, args arguments) (interface{}, error) {
+	switch field {
+	case "index":
+		return l.log.Index, nil
+	case "account":
+		number, err := args.number("block", rpc.BlockNumber(l.log.BlockNumber))
+		if err != nil {
+			return nil, err
+		}
+		return &Account{backend: l.backend, address: l.log.Address, number: number}, nil
+	case "topics":
+		return l.log.Topics, nil
+	case "data":
+		return hexutil.Bytes(l.log.Data), nil
+	case "transaction":
+		return l.tx, nil
+	}
+	return nil, errUnknownField(l, field)
+}
+
+// Account is the state of an account at a given block, resolving:
+//
+//	address: Address!
+//	balance: BigInt!
+//	transactionCount: Long!
+//	code: Bytes!
+//	storage(slot: Bytes32!): Bytes32!
+type Account struct {
+	backend Backend
+	address common.Address
+	number  rpc.BlockNumber
+}
+
+func (a *Account) resolve(ctx context.Context, field string, args arguments) (interface{}, error) {
+	if field == "address" {
+		return a.address, nil
+	}
+	statedb, err := a.state(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	switch field {
+	case "balance":
+		value = (*hexutil.Big)(statedb.GetBalance(a.address))
+	case "transactionCount":
+		value = statedb.GetNonce(a.address)
+	case "code":
+		value = hexutil.Bytes(statedb.GetCode(a.address))
+	case "storage":
+		slot, ok, err := args.hash("slot")
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New("missing argument \"slot\"")
+		}
+		value = statedb.GetState(a.address, slot)
+	default:
+		return nil, errUnknownField(a, field)
+	}
+	return value, statedb.Error()
+}
+
+// state retrieves the state of the block the account is resolved at.
+func (a *Account) state(ctx context.Context) (*state.StateDB, error) {
+	statedb, _, err := a.backend.StateAndHeaderByNumber(ctx, a.number)
+	if err != nil {
+		return nil, err
+	}
+	if statedb == nil {
+		return nil, fmt.Errorf("state of block %d not available", a.number)
+	}
+	return statedb, nil
+}
+
+// Pending is the pending state and transaction pool, resolving:
+//
+//	transactionCount: Int!
+//	transactions: [Transaction!]!
+//	account(address: Address!): Account!
+type Pending struct {
+	backend Backend
+}
+
+func (p *Pending) resolve(ctx context.Context, field string, args arguments) (interface{}, error) {
+	switch field {
+	case "transactionCount", "transactions":
+		pending, err := p.backend.GetPoolTransactions()
+		if err != nil {
+			return nil, err
+		}
+		if field == "transactionCount" {
+			return len(pending), nil
+		}
+		txs := make([]*Transaction, len(pending))
+		for i, tx := range pending {
+			txs[i] = &Transaction{backend: p.backend, hash: tx.Hash(), tx: tx}
+		}
+		return txs, nil
+	case "account":
+		addr, ok, err := args.address("address")
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New("missing argument \"address\"")
+		}
+		return &Account{backend: p.backend, address: addr, number: rpc.PendingBlockNumber}, nil
+	}
+	return nil, errUnknownField(p, field)
+}
@@ -0,0 +1,268 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var (
+	testAddr = common.HexToAddress("0x0000000000000000000000000000000000000042")
+	testSlot = common.HexToHash("0x01")
+)
+
+// testBackend is a backend serving a short chain of empty blocks and a single
+// account state.
+type testBackend struct {
+	Backend
+	db     ethdb.Database
+	blocks []*types.Block
+	state  *state.StateDB
+}
+
+func newTestBackend(t *testing.T) *testBackend {
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	statedb.SetBalance(testAddr, big.NewInt(1000))
+	statedb.SetNonce(testAddr, 7)
+	statedb.SetState(testAddr, testSlot, common.HexToHash("0xff"))
+
+	backend := &testBackend{db: db, state: statedb}
+	parent := common.Hash{}
+	for i := 0; i < 3; i++ {
+		block := types.NewBlock(&types.Header{
+			ParentHash: parent,
+			Number:     big.NewInt(int64(i)),
+			Difficulty: big.NewInt(131072),
+			GasLimit:   big.NewInt(4712388),
+			GasUsed:    new(big.Int),
+			Time:       big.NewInt(int64(i * 15)),
+			Extra:      []byte{byte(i)},
+		}, nil, nil, nil)
+		backend.blocks = append(backend.blocks, block)
+		parent = block.Hash()
+	}
+	return backend
+}
+
+func (b *testBackend) ChainDb() ethdb.Database    { return b.db }
+func (b *testBackend) CurrentBlock() *types.Block { return b.blocks[len(b.blocks)-1] }
+
+func (b *testBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
+	if number == rpc.LatestBlockNumber || number == rpc.PendingBlockNumber {
+		return b.CurrentBlock(), nil
+	}
+	if int(number) >= len(b.blocks) {
+		return nil, nil
+	}
+	return b.blocks[number], nil
+}
+
+func (b *testBackend) GetBlock(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	for _, block := range b.blocks {
+		if block.Hash() == hash {
+			return block, nil
+		}
+	}
+	return nil, nil
+}
+
+func (b *testBackend) StateAndHeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*state.StateDB, *types.Header, error) {
+	block, _ := b.BlockByNumber(ctx, number)
+	if block == nil {
+		return nil, nil, nil
+	}
+	return b.state, block.Header(), nil
+}
+
+func (b *testBackend) GetPoolTransaction(hash common.Hash) *types.Transaction { return nil }
+
+// run executes a query against the test backend, returning the JSON response.
+func run(t *testing.T, backend Backend, query string, vars map[string]interface{}) string {
+	res := execute(context.Background(), &Query{backend: backend}, query, "", vars)
+	blob, err := json.Marshal(res)
+	if err != nil {
+		t.Fatalf("failed to encode response: %v", err)
+	}
+	return string(blob)
+}
+
+// Tests that queries are resolved against the chain, with the fields returned in
+// the requested order.
+func TestQuery(t *testing.T) {
+	backend := newTestBackend(t)
+	var (
+		genesis = backend.blocks[0].Hash().Hex()
+		head    = backend.blocks[2].Hash().Hex()
+	)
+	tests := []struct {
+		query string
+		vars  map[string]interface{}
+		want  string
+	}{
+		// Simple fields, nested objects and aliases
+		{
+			query: `{ block { number hash parent { number } } }`,
+			want:  `{"data":{"block":{"number":2,"hash":"` + head + `","parent":{"number":1}}}}`,
+		},
+		{
+			query: `{ first: block(number: 0) { hash parent { number } } last: block(hash: "` + head + `") { extraData } }`,
+			want:  `{"data":{"first":{"hash":"` + genesis + `","parent":null},"last":{"extraData":"0x02"}}}`,
+		},
+		{
+			query: `{ block(number: 10) { number } }`,
+			want:  `{"data":{"block":null}}`,
+		},
+		{
+			query: `{ blocks(from: 1) { number __typename } }`,
+			want:  `{"data":{"blocks":[{"number":1,"__typename":"Block"},{"number":2,"__typename":"Block"}]}}`,
+		},
+		// Account state lookups
+		{
+			query: `{ block(number: 1) { account(address: "` + testAddr.Hex() + `") { balance transactionCount storage(slot: "` + testSlot.Hex() + `") } } }`,
+			want:  `{"data":{"block":{"account":{"balance":"0x3e8","transactionCount":7,"storage":"0x00000000000000000000000000000000000000000000000000000000000000ff"}}}}`,
+		},
+		// Variables, fragments and directives
+		{
+			query: `query Block($n: Long!, $extra: Boolean = false) { block(number: $n) { ...header extraData @include(if: $extra) } } fragment header on Block { number }`,
+			vars:  map[string]interface{}{"n": json.Number("1")},
+			want:  `{"data":{"block":{"number":1}}}`,
+		},
+		{
+			query: `query ($n: Long) { block(number: $n) { number ... on Block { number hash @skip(if: true) } ... { timestamp } } }`,
+			vars:  map[string]interface{}{"n": "0x1"},
+			want:  `{"data":{"block":{"number":1,"timestamp":"0xf"}}}`,
+		},
+		// Field errors nullify the field only
+		{
+			query: `{ block { number missing } }`,
+			want:  `{"data":{"block":{"number":2,"missing":null}},"errors":[{"message":"cannot query field \"missing\" on type \"Block\"","path":["block","missing"]}]}`,
+		},
+		{
+			query: `{ block(number: "x") { number } }`,
+			want:  `{"data":{"block":null},"errors":[{"message":"invalid argument \"number\": strconv.ParseUint: parsing \"x\": invalid syntax","path":["block"]}]}`,
+		},
+		{
+			query: `{ block }`,
+			want:  `{"data":{"block":null},"errors":[{"message":"field of type \"Block\" must have a selection of subfields","path":["block"]}]}`,
+		},
+		// Request errors fail the entire query
+		{
+			query: `query ($n: Long!) { block(number: $n) { number } }`,
+			want:  `{"errors":[{"message":"missing value for required variable $n"}]}`,
+		},
+		{
+			query: `mutation { block { number } }`,
+			want:  `{"errors":[{"message":"mutation operations are not supported"}]}`,
+		},
+		{
+			query: `{ block { number }`,
+			want:  `{"errors":[{"message":"syntax error at 1:19: expected name, found \"\""}]}`,
+		},
+	}
+	for i, tt := range tests {
+		if have := run(t, backend, tt.query, tt.vars); have != tt.want {
+			t.Errorf("test %d: response mismatch:\nhave %s\nwant %s", i, have, tt.want)
+		}
+	}
+}
+
+// Tests that query documents are tokenized and parsed correctly.
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		fail  bool
+	}{
+		{`{ a }`, false},
+		{`{ a, b # comment
+		   c(x: 1, y: -2.5e3, z: "s\"A", w: [1 2], v: {k: null}, e: ENUM) }`, false},
+		{`query Q($a: [Int!]! = [1]) @dir { a(x: $a) }`, false},
+		{`fragment f on T { a } { ...f }`, false},
+		{``, true},
+		{`{ }`, true},
+		{`{ a(x: 01a) }`, true},
+		{`{ a(x: "unterminated) }`, true},
+		{`query ($a: Int = $b) { a }`, true},
+		{`{ a(x: 1, x: 2) }`, true},
+		{`fragment on on T { a } { a }`, true},
+		{`subscription`, true},
+		{`{ a } ~`, true},
+	}
+	for i, tt := range tests {
+		_, err := parse(tt.query)
+		if (err != nil) != tt.fail {
+			t.Errorf("test %d: error mismatch: have %v, want failure %v", i, err, tt.fail)
+		}
+	}
+}
+
+// Tests that queries are accepted over HTTP both as POST bodies and GET query
+// parameters.
+func TestServeHTTP(t *testing.T) {
+	server := httptest.NewServer(&Service{backend: newTestBackend(t)})
+	defer server.Close()
+
+	want := `{"data":{"block":{"number":1}}}` + "\n"
+
+	body := `{"query": "query ($n: Long) { block(number: $n) { number } }", "variables": {"n": 1}}`
+	res, err := http.Post(server.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to post query: %v", err)
+	}
+	if have := readBody(t, res); have != want {
+		t.Errorf("POST response mismatch: have %s, want %s", have, want)
+	}
+	params := url.Values{"query": {"{ block(number: 1) { number } }"}}
+	if res, err = http.Get(server.URL + "?" + params.Encode()); err != nil {
+		t.Fatalf("failed to get query: %v", err)
+	}
+	if have := readBody(t, res); have != want {
+		t.Errorf("GET response mismatch: have %s, want %s", have, want)
+	}
+	params = url.Values{"query": {"{ block"}}
+	if res, err = http.Get(server.URL + "?" + params.Encode()); err != nil {
+		t.Fatalf("failed to get query: %v", err)
+	}
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid query status mismatch: have %d, want %d", res.StatusCode, http.StatusBadRequest)
+	}
+	res.Body.Close()
+}
+
+func readBody(t *testing.T, res *http.Response) string {
+	defer res.Body.Close()
+
+	blob, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	return string(blob)
+}
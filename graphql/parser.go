@@ -0,0 +1,665 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// document is a parsed GraphQL query document.
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+// operation is a single named or anonymous operation within a document.
+type operation struct {
+	kind       string // query, mutation or subscription
+	name       string
+	variables  []*variableDef
+	selections []*selection
+}
+
+// variableDef is the declaration of a variable an operation accepts.
+type variableDef struct {
+	name     string
+	required bool        // Whether the declared type is non-null
+	defValue interface{} // Default value if the variable is omitted (nil = none)
+}
+
+// fragment is a named, reusable set of selections.
+type fragment struct {
+	name       string
+	selections []*selection
+}
+
+// selection is a single field, fragment spread or inline fragment.
+type selection struct {
+	alias      string
+	name       string                 // Field name (empty for inline fragments)
+	spread     bool                   // Whether name refers to a fragment to expand
+	args       map[string]interface{} // Unresolved field arguments
+	directives []*directive
+	selections []*selection
+}
+
+// directive is a @name(args) annotation on a selection.
+type directive struct {
+	name string
+	args map[string]interface{}
+}
+
+// variable is a reference to an operation variable within a value.
+type variable string
+
+// enum is an unquoted enum value literal.
+type enum string
+
+// Token kinds produced by the lexer.
+const (
+	tokenEOF = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+// token is a single lexical token of a query document.
+type token struct {
+	kind int
+	text string
+	pos  int
+}
+
+// parser is a recursive descent parser of GraphQL query documents, keeping a
+// single token of lookahead.
+type parser struct {
+	src string
+	pos int
+	tok token
+}
+
+// parse parses a GraphQL query document.
+func parse(src string) (*document, error) {
+	p := &parser{src: src}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	doc := &document{fragments: make(map[string]*fragment)}
+	for p.tok.kind != tokenEOF {
+		if p.tok.kind == tokenName && p.tok.text == "fragment" {
+			frag, err := p.parseFragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.fragments[frag.name]; ok {
+				return nil, fmt.Errorf("duplicate fragment %q", frag.name)
+			}
+			doc.fragments[frag.name] = frag
+			continue
+		}
+		op, err := p.parseOperation()
+		if err != nil {
+			return nil, err
+		}
+		doc.operations = append(doc.operations, op)
+	}
+	if len(doc.operations) == 0 {
+		return nil, fmt.Errorf("no operations in query document")
+	}
+	return doc, nil
+}
+
+// errorf creates a syntax error pointing at the current token.
+func (p *parser) errorf(format string, args ...interface{}) error {
+	line, col := 1, 1
+	for _, c := range p.src[:p.tok.pos] {
+		if c == '\n' {
+			line, col = line+1, 1
+		} else {
+			col++
+		}
+	}
+	return fmt.Errorf("syntax error at %d:%d: %s", line, col, fmt.Sprintf(format, args...))
+}
+
+// peek reports whether the current token is the given punctuator.
+func (p *parser) peek(punct string) bool {
+	return p.tok.kind == tokenPunct && p.tok.text == punct
+}
+
+// expect consumes the given punctuator or fails.
+func (p *parser) expect(punct string) error {
+	if !p.peek(punct) {
+		return p.errorf("expected %q, found %q", punct, p.tok.text)
+	}
+	return p.advance()
+}
+
+// name consumes a name token and returns it.
+func (p *parser) name() (string, error) {
+	if p.tok.kind != tokenName {
+		return "", p.errorf("expected name, found %q", p.tok.text)
+	}
+	name := p.tok.text
+	return name, p.advance()
+}
+
+// parseOperation parses a shorthand query or a full operation definition.
+func (p *parser) parseOperation() (*operation, error) {
+	op := &operation{kind: "query"}
+	if !p.peek("{") {
+		kind, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case "query", "mutation", "subscription":
+			op.kind = kind
+		default:
+			return nil, p.errorf("unexpected %q", kind)
+		}
+		if p.tok.kind == tokenName {
+			if op.name, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if p.peek("(") {
+			if op.variables, err = p.parseVariableDefs(); err != nil {
+				return nil, err
+			}
+		}
+		if _, err = p.parseDirectives(); err != nil {
+			return nil, err
+		}
+	}
+	selections, err := p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.selections = selections
+	return op, nil
+}
+
+// parseVariableDefs parses the variable declarations of an operation.
+func (p *parser) parseVariableDefs() ([]*variableDef, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var defs []*variableDef
+	for !p.peek(")") {
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		def := &variableDef{name: name}
+		if def.required, err = p.parseType(); err != nil {
+			return nil, err
+		}
+		if p.peek("=") {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if def.defValue, err = p.parseValue(true); err != nil {
+				return nil, err
+			}
+		}
+		defs = append(defs, def)
+	}
+	return defs, p.advance()
+}
+
+// parseType parses a type reference, returning whether it is non-null. The
+// types themselves are not checked, arguments are validated by the resolvers.
+func (p *parser) parseType() (bool, error) {
+	if p.peek("[") {
+		if err := p.advance(); err != nil {
+			return false, err
+		}
+		if _, err := p.parseType(); err != nil {
+			return false, err
+		}
+		if err := p.expect("]"); err != nil {
+			return false, err
+		}
+	} else if _, err := p.name(); err != nil {
+		return false, err
+	}
+	if p.peek("!") {
+		return true, p.advance()
+	}
+	return false, nil
+}
+
+// parseFragment parses a named fragment definition.
+func (p *parser) parseFragment() (*fragment, error) {
+	if err := p.advance(); err != nil { // "fragment"
+		return nil, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if name == "on" {
+		return nil, p.errorf("invalid fragment name %q", name)
+	}
+	if err := p.parseTypeCondition(); err != nil {
+		return nil, err
+	}
+	if _, err := p.parseDirectives(); err != nil {
+		return nil, err
+	}
+	selections, err := p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+	return &fragment{name: name, selections: selections}, nil
+}
+
+// parseTypeCondition parses an "on Type" clause. The schema has no interfaces
+// or unions, so conditions always hold and are discarded.
+func (p *parser) parseTypeCondition() error {
+	if p.tok.kind != tokenName || p.tok.text != "on" {
+		return p.errorf("expected type condition, found %q", p.tok.text)
+	}
+	if err := p.advance(); err != nil {
+		return err
+	}
+	_, err := p.name()
+	return err
+}
+
+// parseSelectionSet parses a braced, non-empty list of selections.
+func (p *parser) parseSelectionSet() ([]*selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var selections []*selection
+	for !p.peek("}") {
+		sel, err := p.parseSelection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, sel)
+	}
+	if len(selections) == 0 {
+		return nil, p.errorf("empty selection set")
+	}
+	return selections, p.advance()
+}
+
+// parseSelection parses a field, a fragment spread or an inline fragment.
+func (p *parser) parseSelection() (*selection, error) {
+	var (
+		sel = new(selection)
+		err error
+	)
+	if p.peek("...") {
+		if err = p.advance(); err != nil {
+			return nil, err
+		}
+		switch {
+		case p.tok.kind == tokenName && p.tok.text == "on":
+			if err = p.parseTypeCondition(); err != nil {
+				return nil, err
+			}
+		case p.tok.kind == tokenName:
+			sel.spread = true
+			if sel.name, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if sel.directives, err = p.parseDirectives(); err != nil {
+			return nil, err
+		}
+		if !sel.spread {
+			if sel.selections, err = p.parseSelectionSet(); err != nil {
+				return nil, err
+			}
+		}
+		return sel, nil
+	}
+	if sel.name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if p.peek(":") {
+		if err = p.advance(); err != nil {
+			return nil, err
+		}
+		sel.alias = sel.name
+		if sel.name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek("(") {
+		if sel.args, err = p.parseArguments(); err != nil {
+			return nil, err
+		}
+	}
+	if sel.directives, err = p.parseDirectives(); err != nil {
+		return nil, err
+	}
+	if p.peek("{") {
+		if sel.selections, err = p.parseSelectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return sel, nil
+}
+
+// parseArguments parses a parenthesized list of name: value pairs.
+func (p *parser) parseArguments() (map[string]interface{}, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	args := make(map[string]interface{})
+	for !p.peek(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := args[name]; ok {
+			return nil, p.errorf("duplicate argument %q", name)
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if args[name], err = p.parseValue(false); err != nil {
+			return nil, err
+		}
+	}
+	return args, p.advance()
+}
+
+// parseDirectives parses any number of @name(args) annotations.
+func (p *parser) parseDirectives() ([]*directive, error) {
+	var directives []*directive
+	for p.peek("@") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		dir := &directive{name: name}
+		if p.peek("(") {
+			if dir.args, err = p.parseArguments(); err != nil {
+				return nil, err
+			}
+		}
+		directives = append(directives, dir)
+	}
+	return directives, nil
+}
+
+// parseValue parses an input value. Variables are rejected in constant
+// contexts, such as the default values of variables.
+func (p *parser) parseValue(constant bool) (interface{}, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokenPunct:
+		switch tok.text {
+		case "$":
+			if constant {
+				return nil, p.errorf("unexpected variable")
+			}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			name, err := p.name()
+			return variable(name), err
+
+		case "[":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			list := []interface{}{}
+			for !p.peek("]") {
+				item, err := p.parseValue(constant)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, item)
+			}
+			return list, p.advance()
+
+		case "{":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			fields := make(map[string]interface{})
+			for !p.peek("}") {
+				name, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				if fields[name], err = p.parseValue(constant); err != nil {
+					return nil, err
+				}
+			}
+			return fields, p.advance()
+		}
+	case tokenInt:
+		n, err := strconv.ParseInt(tok.text, 10, 64)
+		if err != nil {
+			return nil, p.errorf("invalid integer %q", tok.text)
+		}
+		return n, p.advance()
+
+	case tokenFloat:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid float %q", tok.text)
+		}
+		return f, p.advance()
+
+	case tokenString:
+		return tok.text, p.advance()
+
+	case tokenName:
+		var value interface{}
+		switch tok.text {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		case "null":
+			value = nil
+		default:
+			value = enum(tok.text)
+		}
+		return value, p.advance()
+	}
+	return nil, p.errorf("unexpected %q", tok.text)
+}
+
+// advance moves the lookahead to the next token in the source, skipping over
+// whitespace, commas and comments.
+func (p *parser) advance() error {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' && p.src[p.pos] != '\r' {
+				p.pos++
+			}
+			continue
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' && c != ',' {
+			break
+		}
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.tok = token{kind: tokenEOF, pos: start}
+		return nil
+	}
+	switch c := p.src[p.pos]; {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.tok = token{kind: tokenPunct, text: "...", pos: start}
+
+	case strings.IndexByte("!$():=@[]{}|", c) >= 0:
+		p.pos++
+		p.tok = token{kind: tokenPunct, text: string(c), pos: start}
+
+	case c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		for p.pos < len(p.src) && isNameChar(p.src[p.pos]) {
+			p.pos++
+		}
+		p.tok = token{kind: tokenName, text: p.src[start:p.pos], pos: start}
+
+	case c == '-' || '0' <= c && c <= '9':
+		return p.lexNumber()
+
+	case c == '"':
+		return p.lexString()
+
+	default:
+		p.tok = token{pos: start}
+		r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+		return p.errorf("unexpected character %q", r)
+	}
+	return nil
+}
+
+// lexNumber lexes an integer or a floating point literal.
+func (p *parser) lexNumber() error {
+	start, kind := p.pos, tokenInt
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	digits := func() int {
+		from := p.pos
+		for p.pos < len(p.src) && '0' <= p.src[p.pos] && p.src[p.pos] <= '9' {
+			p.pos++
+		}
+		return p.pos - from
+	}
+	if digits() == 0 {
+		p.tok = token{pos: start}
+		return p.errorf("invalid number")
+	}
+	if p.pos < len(p.src) && p.src[p.pos] == '.' {
+		kind = tokenFloat
+		p.pos++
+		if digits() == 0 {
+			p.tok = token{pos: start}
+			return p.errorf("invalid number")
+		}
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		kind = tokenFloat
+		p.pos++
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		if digits() == 0 {
+			p.tok = token{pos: start}
+			return p.errorf("invalid number")
+		}
+	}
+	if p.pos < len(p.src) && isNameChar(p.src[p.pos]) {
+		p.tok = token{pos: start}
+		return p.errorf("invalid number")
+	}
+	p.tok = token{kind: kind, text: p.src[start:p.pos], pos: start}
+	return nil
+}
+
+// lexString lexes a double quoted string literal, unescaping its contents.
+func (p *parser) lexString() error {
+	start := p.pos
+	p.pos++
+
+	var text strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			p.tok = token{kind: tokenString, text: text.String(), pos: start}
+			return nil
+
+		case c == '\n' || c == '\r':
+			p.tok = token{pos: start}
+			return p.errorf("unterminated string")
+
+		case c == '\\':
+			if p.pos+1 >= len(p.src) {
+				p.tok = token{pos: start}
+				return p.errorf("unterminated string")
+			}
+			p.pos++
+			switch esc := p.src[p.pos]; esc {
+			case '"', '\\', '/':
+				text.WriteByte(esc)
+			case 'b':
+				text.WriteByte('\b')
+			case 'f':
+				text.WriteByte('\f')
+			case 'n':
+				text.WriteByte('\n')
+			case 'r':
+				text.WriteByte('\r')
+			case 't':
+				text.WriteByte('\t')
+			case 'u':
+				if p.pos+5 > len(p.src) {
+					p.tok = token{pos: start}
+					return p.errorf("invalid unicode escape")
+				}
+				code, err := strconv.ParseUint(p.src[p.pos+1:p.pos+5], 16, 16)
+				if err != nil {
+					p.tok = token{pos: start}
+					return p.errorf("invalid unicode escape")
+				}
+				text.WriteRune(rune(code))
+				p.pos += 4
+			default:
+				p.tok = token{pos: start}
+				return p.errorf("invalid escape sequence \\%c", esc)
+			}
+			p.pos++
+
+		default:
+			text.WriteByte(c)
+			p.pos++
+		}
+	}
+	p.tok = token{pos: start}
+	return p.errorf("unterminated string")
+}
+
+// isNameChar reports whether c may appear within a name.
+func isNameChar(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
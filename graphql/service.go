@@ -0,0 +1,113 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package graphql provides a GraphQL interface to the chain data, served on the
+// HTTP endpoint of the node next to the JSON-RPC API.
+//
+// Only queries are supported: fields, aliases, arguments, variables, fragments
+// and the @skip and @include directives. The schema is documented on the types
+// resolving it, starting from Query.
+package graphql
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// maxRequestContentLength is the maximum size of a query request body.
+const maxRequestContentLength = 1024 * 128
+
+// Path is the path of the HTTP endpoint the GraphQL service is mounted on.
+const Path = "/graphql"
+
+// request is the JSON encoded body of a GraphQL request.
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Service is a node service answering GraphQL queries over HTTP.
+type Service struct {
+	backend Backend
+}
+
+// New creates a GraphQL service over the given backend and mounts it on the
+// HTTP endpoint of the node.
+func New(ctx *node.ServiceContext, backend Backend) *Service {
+	service := &Service{backend: backend}
+	ctx.RegisterHTTPHandler(Path, service)
+	return service
+}
+
+// Protocols implements node.Service, returning no network protocols.
+func (s *Service) Protocols() []p2p.Protocol { return nil }
+
+// APIs implements node.Service, returning no RPC APIs.
+func (s *Service) APIs() []rpc.API { return nil }
+
+// Start implements node.Service, the handler is served by the node.
+func (s *Service) Start(server *p2p.Server) error { return nil }
+
+// Stop implements node.Service, the handler is served by the node.
+func (s *Service) Stop() error { return nil }
+
+// ServeHTTP answers a GraphQL query given as either the JSON body of a POST
+// request or the query parameters of a GET request.
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+	switch r.Method {
+	case http.MethodGet:
+		params := r.URL.Query()
+		req.Query = params.Get("query")
+		req.OperationName = params.Get("operationName")
+		if vars := params.Get("variables"); vars != "" {
+			dec := json.NewDecoder(strings.NewReader(vars))
+			dec.UseNumber()
+			if err := dec.Decode(&req.Variables); err != nil {
+				http.Error(w, "invalid variables: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	case http.MethodPost:
+		if r.ContentLength > maxRequestContentLength {
+			http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		dec := json.NewDecoder(io.LimitReader(r.Body, maxRequestContentLength))
+		dec.UseNumber()
+		if err := dec.Decode(&req); err != nil {
+			http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	res := execute(r.Context(), &Query{backend: s.backend}, req.Query, req.OperationName, req.Variables)
+
+	w.Header().Set("content-type", "application/json")
+	if res.Data == nil {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	json.NewEncoder(w).Encode(res)
+}
@@ -18,6 +18,7 @@ package ethapi
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
@@ -25,12 +26,15 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/hdwallet"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -39,6 +43,7 @@ import (
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
@@ -65,6 +70,52 @@ func (s *PublicEthereumAPI) GasPrice(ctx context.Context) (*big.Int, error) {
 	return s.b.SuggestPrice(ctx)
 }
 
+// MaxPriorityFeePerGas returns a suggestion for the tip cap of dynamic fee transactions.
+func (s *PublicEthereumAPI) MaxPriorityFeePerGas(ctx context.Context) (*hexutil.Big, error) {
+	tip, err := s.b.SuggestTipCap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return (*hexutil.Big)(tip), nil
+}
+
+// feeHistoryResult is the RPC representation of a fee history.
+type feeHistoryResult struct {
+	OldestBlock  *hexutil.Big     `json:"oldestBlock"`
+	Reward       [][]*hexutil.Big `json:"reward,omitempty"`
+	BaseFee      []*hexutil.Big   `json:"baseFeePerGas,omitempty"`
+	GasUsedRatio []float64        `json:"gasUsedRatio"`
+}
+
+// FeeHistory returns the base fees, gas used ratios and requested effective tip
+// percentiles of up to blockCount blocks ending at lastBlock.
+func (s *PublicEthereumAPI) FeeHistory(ctx context.Context, blockCount hexutil.Uint, lastBlock rpc.BlockNumber, rewardPercentiles []float64) (*feeHistoryResult, error) {
+	oldest, reward, baseFee, gasUsed, err := s.b.FeeHistory(ctx, int(blockCount), lastBlock, rewardPercentiles)
+	if err != nil {
+		return nil, err
+	}
+	results := &feeHistoryResult{
+		OldestBlock:  (*hexutil.Big)(oldest),
+		GasUsedRatio: gasUsed,
+	}
+	if reward != nil {
+		results.Reward = make([][]*hexutil.Big, len(reward))
+		for i, w := range reward {
+			results.Reward[i] = make([]*hexutil.Big, len(w))
+			for j, v := range w {
+				results.Reward[i][j] = (*hexutil.Big)(v)
+			}
+		}
+	}
+	if baseFee != nil {
+		results.BaseFee = make([]*hexutil.Big, len(baseFee))
+		for i, v := range baseFee {
+			results.BaseFee[i] = (*hexutil.Big)(v)
+		}
+	}
+	return results, nil
+}
+
 // ProtocolVersion returns the current Ethereum protocol version this node supports
 func (s *PublicEthereumAPI) ProtocolVersion() hexutil.Uint {
 	return hexutil.Uint(s.b.ProtocolVersion())
@@ -116,7 +167,7 @@ func (s *PublicTxPoolAPI) Content() map[string]map[string]map[string]*RPCTransac
 	for account, txs := range pending {
 		dump := make(map[string]*RPCTransaction)
 		for _, tx := range txs {
-			dump[fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx)
+			dump[fmt.Sprintf("%d", tx.Nonce())] = NewRPCPendingTransaction(tx)
 		}
 		content["pending"][account.Hex()] = dump
 	}
@@ -124,7 +175,7 @@ func (s *PublicTxPoolAPI) Content() map[string]map[string]map[string]*RPCTransac
 	for account, txs := range queue {
 		dump := make(map[string]*RPCTransaction)
 		for _, tx := range txs {
-			dump[fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx)
+			dump[fmt.Sprintf("%d", tx.Nonce())] = NewRPCPendingTransaction(tx)
 		}
 		content["queued"][account.Hex()] = dump
 	}
@@ -140,6 +191,12 @@ func (s *PublicTxPoolAPI) Status() map[string]hexutil.Uint {
 	}
 }
 
+// Locals returns the accounts whose transactions are treated as local by the
+// pool, exempt from price based eviction and periodically rebroadcast.
+func (s *PublicTxPoolAPI) Locals() []common.Address {
+	return s.b.TxPoolLocals()
+}
+
 // Inspect retrieves the content of the transaction pool and flattens it into an
 // easily inspectable list.
 func (s *PublicTxPoolAPI) Inspect() map[string]map[string]map[string]string {
@@ -188,13 +245,7 @@ func NewPublicAccountAPI(am *accounts.Manager) *PublicAccountAPI {
 
 // Accounts returns the collection of accounts this node manages
 func (s *PublicAccountAPI) Accounts() []common.Address {
-	addresses := make([]common.Address, 0) // return [] instead of nil if empty
-	for _, wallet := range s.am.Wallets() {
-		for _, account := range wallet.Accounts() {
-			addresses = append(addresses, account.Address)
-		}
-	}
-	return addresses
+	return s.am.Accounts()
 }
 
 // PrivateAccountAPI provides an API to access accounts managed by this node.
@@ -217,13 +268,7 @@ func NewPrivateAccountAPI(b Backend, nonceLock *AddrLocker) *PrivateAccountAPI {
 
 // ListAccounts will return a list of addresses for accounts this node manages.
 func (s *PrivateAccountAPI) ListAccounts() []common.Address {
-	addresses := make([]common.Address, 0) // return [] instead of nil if empty
-	for _, wallet := range s.am.Wallets() {
-		for _, account := range wallet.Accounts() {
-			addresses = append(addresses, account.Address)
-		}
-	}
-	return addresses
+	return s.am.Accounts()
 }
 
 // rawWallet is a JSON representation of an accounts.Wallet interface, with its
@@ -247,6 +292,22 @@ func (s *PrivateAccountAPI) ListWallets() []rawWallet {
 	return wallets
 }
 
+// OpenWallet initiates a hardware wallet opening procedure, establishing a USB
+// connection and attempting to authenticate via the provided passphrase. Note,
+// the method may return an extra challenge requiring a second open (e.g. the
+// Trezor PIN matrix challenge).
+func (s *PrivateAccountAPI) OpenWallet(url string, passphrase *string) error {
+	wallet, err := s.am.Wallet(url)
+	if err != nil {
+		return err
+	}
+	pass := ""
+	if passphrase != nil {
+		pass = *passphrase
+	}
+	return wallet.Open(pass)
+}
+
 // DeriveAccount requests a HD wallet to derive a new account, optionally pinning
 // it for later reuse.
 func (s *PrivateAccountAPI) DeriveAccount(url string, path string, pin *bool) (accounts.Account, error) {
@@ -266,16 +327,24 @@ func (s *PrivateAccountAPI) DeriveAccount(url string, path string, pin *bool) (a
 
 // NewAccount will create a new account and returns the address for the new account.
 func (s *PrivateAccountAPI) NewAccount(password string) (common.Address, error) {
-	acc, err := fetchKeystore(s.am).NewAccount(password)
+	ks, err := fetchKeystore(s.am)
+	if err != nil {
+		return common.Address{}, err
+	}
+	acc, err := ks.NewAccount(password)
 	if err == nil {
 		return acc.Address, nil
 	}
 	return common.Address{}, err
 }
 
-// fetchKeystore retrives the encrypted keystore from the account manager.
-func fetchKeystore(am *accounts.Manager) *keystore.KeyStore {
-	return am.Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+// fetchKeystore retrives the encrypted keystore from the account manager, if the
+// node uses one (e.g. not when running with an external signer).
+func fetchKeystore(am *accounts.Manager) (*keystore.KeyStore, error) {
+	if ks := am.Backends(keystore.KeyStoreType); len(ks) > 0 {
+		return ks[0].(*keystore.KeyStore), nil
+	}
+	return nil, errors.New("local keystore not used")
 }
 
 // ImportRawKey stores the given hex encoded ECDSA key into the key directory,
@@ -285,10 +354,50 @@ func (s *PrivateAccountAPI) ImportRawKey(privkey string, password string) (commo
 	if err != nil {
 		return common.Address{}, err
 	}
-	acc, err := fetchKeystore(s.am).ImportECDSA(key, password)
+	ks, err := fetchKeystore(s.am)
+	if err != nil {
+		return common.Address{}, err
+	}
+	acc, err := ks.ImportECDSA(key, password)
 	return acc.Address, err
 }
 
+// ExportKDFArgs represents the scrypt parameters to encrypt an exported key with.
+type ExportKDFArgs struct {
+	N int `json:"n"`
+	P int `json:"p"`
+}
+
+// ExportAccount decrypts the key of the given account with its password and
+// returns it as a Web3 Secret Storage (version 3) JSON key, encrypted with the
+// new password. The key is encrypted with the scrypt parameters of the keystore,
+// unless custom ones are requested.
+func (s *PrivateAccountAPI) ExportAccount(addr common.Address, password string, newPassword string, kdf *ExportKDFArgs) (json.RawMessage, error) {
+	ks, err := fetchKeystore(s.am)
+	if err != nil {
+		return nil, err
+	}
+	if kdf == nil {
+		return ks.Export(accounts.Account{Address: addr}, password, newPassword)
+	}
+	return ks.ExportScrypt(accounts.Account{Address: addr}, password, newPassword, kdf.N, kdf.P)
+}
+
+// ImportMnemonic imports the HD wallet derived from the given BIP-39 mnemonic and
+// optional passphrase, returning the URL of the wallet. Once imported, the used
+// accounts of the wallet are discovered and listed alongside the others.
+func (s *PrivateAccountAPI) ImportMnemonic(mnemonic string, passphrase string) (string, error) {
+	hubs := s.am.Backends(hdwallet.HubType)
+	if len(hubs) == 0 {
+		return "", errors.New("HD wallets not supported")
+	}
+	wallet, err := hubs[0].(*hdwallet.Hub).Import(mnemonic, passphrase)
+	if err != nil {
+		return "", err
+	}
+	return wallet.URL().String(), nil
+}
+
 // UnlockAccount will unlock the account associated with the given address with
 // the given password for duration seconds. If duration is nil it will use a
 // default of 300 seconds. It returns an indication if the account was unlocked.
@@ -302,13 +411,20 @@ func (s *PrivateAccountAPI) UnlockAccount(addr common.Address, password string,
 	} else {
 		d = time.Duration(*duration) * time.Second
 	}
-	err := fetchKeystore(s.am).TimedUnlock(accounts.Account{Address: addr}, password, d)
+	ks, err := fetchKeystore(s.am)
+	if err != nil {
+		return false, err
+	}
+	err = ks.TimedUnlock(accounts.Account{Address: addr}, password, d)
 	return err == nil, err
 }
 
 // LockAccount will lock the account associated with the given address when it's unlocked.
 func (s *PrivateAccountAPI) LockAccount(addr common.Address) bool {
-	return fetchKeystore(s.am).Lock(addr) == nil
+	if ks, err := fetchKeystore(s.am); err == nil {
+		return ks.Lock(addr) == nil
+	}
+	return false
 }
 
 // SendTransaction will create a transaction from the given arguments and
@@ -397,15 +513,60 @@ func (s *PrivateAccountAPI) Sign(ctx context.Context, data hexutil.Bytes, addr c
 //
 // https://github.com/ethereum/go-ethereum/wiki/Management-APIs#personal_ecRecover
 func (s *PrivateAccountAPI) EcRecover(ctx context.Context, data, sig hexutil.Bytes) (common.Address, error) {
+	return ecRecover(signHash(data), sig)
+}
+
+// SignTypedData calculates an Ethereum ECDSA signature of EIP-712 typed data:
+// keccack256("\x19\x01" + domainSeparator + hashStruct(message))
+//
+// Note, the produced signature conforms to the secp256k1 curve R, S and V values,
+// where the V value will be 27 or 28 for legacy reasons.
+//
+// The key used to calculate the signature is decrypted with the given password.
+func (s *PrivateAccountAPI) SignTypedData(ctx context.Context, data accounts.TypedData, addr common.Address, passwd string) (hexutil.Bytes, error) {
+	hash, err := accounts.TypedDataHash(&data)
+	if err != nil {
+		return nil, err
+	}
+	// Look up the wallet containing the requested signer
+	account := accounts.Account{Address: addr}
+
+	wallet, err := s.b.AccountManager().Find(account)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := wallet.SignHashWithPassphrase(account, passwd, hash[:])
+	if err != nil {
+		return nil, err
+	}
+	signature[64] += 27 // Transform V from 0/1 to 27/28 according to the yellow paper
+	return signature, nil
+}
+
+// EcRecoverTypedData returns the address for the account that was used to sign
+// the given EIP-712 typed data. It is compatible with personal_signTypedData and
+// eth_signTypedData_v4.
+func (s *PrivateAccountAPI) EcRecoverTypedData(ctx context.Context, data accounts.TypedData, sig hexutil.Bytes) (common.Address, error) {
+	hash, err := accounts.TypedDataHash(&data)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return ecRecover(hash[:], sig)
+}
+
+// ecRecover returns the address of the key that signed the given hash. The V
+// value of the signature must be 27 or 28 for legacy reasons.
+func ecRecover(hash []byte, sig hexutil.Bytes) (common.Address, error) {
 	if len(sig) != 65 {
 		return common.Address{}, fmt.Errorf("signature must be 65 bytes long")
 	}
 	if sig[64] != 27 && sig[64] != 28 {
 		return common.Address{}, fmt.Errorf("invalid Ethereum signature (V is not 27 or 28)")
 	}
+	sig = common.CopyBytes(sig)
 	sig[64] -= 27 // Transform yellow paper V from 27/28 to 0/1
 
-	rpk, err := crypto.Ecrecover(signHash(data), sig)
+	rpk, err := crypto.Ecrecover(hash, sig)
 	if err != nil {
 		return common.Address{}, err
 	}
@@ -548,6 +709,75 @@ func (s *PublicBlockChainAPI) GetStorageAt(ctx context.Context, address common.A
 	return res[:], state.Error()
 }
 
+// AccountResult is the EIP-1186 Merkle proof of an account and some of its
+// storage slots.
+type AccountResult struct {
+	Address      common.Address  `json:"address"`
+	AccountProof []hexutil.Bytes `json:"accountProof"`
+	Balance      *hexutil.Big    `json:"balance"`
+	CodeHash     common.Hash     `json:"codeHash"`
+	Nonce        hexutil.Uint64  `json:"nonce"`
+	StorageHash  common.Hash     `json:"storageHash"`
+	StorageProof []StorageResult `json:"storageProof"`
+}
+
+// StorageResult is the Merkle proof of a storage slot, against the storage hash
+// of the account it belongs to.
+type StorageResult struct {
+	Key   common.Hash     `json:"key"`
+	Value *hexutil.Big    `json:"value"`
+	Proof []hexutil.Bytes `json:"proof"`
+}
+
+// GetProof returns the Merkle proof of the account at the given address and of
+// the requested storage slots, as specified by EIP-1186. The proofs of accounts
+// that don't exist prove their absence from the state trie.
+func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNr rpc.BlockNumber) (*AccountResult, error) {
+	state, _, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	accountProof, err := state.GetProof(address)
+	if err != nil {
+		return nil, err
+	}
+	result := &AccountResult{
+		Address:      address,
+		AccountProof: toHexSlice(accountProof),
+		Balance:      (*hexutil.Big)(state.GetBalance(address)),
+		CodeHash:     crypto.Keccak256Hash(nil),
+		Nonce:        hexutil.Uint64(state.GetNonce(address)),
+		StorageHash:  types.EmptyRootHash,
+		StorageProof: make([]StorageResult, len(storageKeys)),
+	}
+	if state.Exist(address) {
+		result.CodeHash = state.GetCodeHash(address)
+		result.StorageHash = state.GetStorageRoot(address)
+	}
+	for i, key := range storageKeys {
+		slot := common.HexToHash(key)
+		proof, err := state.GetStorageProof(address, slot)
+		if err != nil {
+			return nil, err
+		}
+		result.StorageProof[i] = StorageResult{
+			Key:   slot,
+			Value: (*hexutil.Big)(state.GetState(address, slot).Big()),
+			Proof: toHexSlice(proof),
+		}
+	}
+	return result, state.Error()
+}
+
+// toHexSlice converts the nodes of a Merkle proof into their JSON encoding.
+func toHexSlice(proof [][]byte) []hexutil.Bytes {
+	nodes := make([]hexutil.Bytes, len(proof))
+	for i, node := range proof {
+		nodes[i] = node
+	}
+	return nodes
+}
+
 // callmsg is the message type used for call transitions.
 type callmsg struct {
 	addr          common.Address
@@ -576,41 +806,232 @@ type CallArgs struct {
 	GasPrice hexutil.Big     `json:"gasPrice"`
 	Value    hexutil.Big     `json:"value"`
 	Data     hexutil.Bytes   `json:"data"`
+
+	// Introduced by AccessListTxType transaction.
+	AccessList *types.AccessList `json:"accessList,omitempty"`
 }
 
-func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, vmCfg vm.Config) ([]byte, *big.Int, error) {
-	defer func(start time.Time) { log.Debug("Executing EVM call finished", "runtime", time.Since(start)) }(time.Now())
+// OverrideAccount indicates the overriding fields of an account during the
+// execution of a message call.
+//
+// Note, state and stateDiff can't be specified at the same time. If state is
+// set, the message execution will only use the data in the given state. If
+// stateDiff is set, all the diff will be applied first and then execute the
+// call message.
+type OverrideAccount struct {
+	Nonce     *hexutil.Uint64              `json:"nonce"`
+	Code      *hexutil.Bytes               `json:"code"`
+	Balance   **hexutil.Big                `json:"balance"`
+	State     *map[common.Hash]common.Hash `json:"state"`
+	StateDiff *map[common.Hash]common.Hash `json:"stateDiff"`
+}
+
+// StateOverride is the collection of overridden accounts.
+type StateOverride map[common.Address]OverrideAccount
+
+// Apply overrides the fields of specified accounts into the given state.
+func (diff *StateOverride) Apply(state *state.StateDB) error {
+	if diff == nil {
+		return nil
+	}
+	for addr, account := range *diff {
+		// Override account nonce.
+		if account.Nonce != nil {
+			state.SetNonce(addr, uint64(*account.Nonce))
+		}
+		// Override account(contract) code.
+		if account.Code != nil {
+			state.SetCode(addr, *account.Code)
+		}
+		// Override account balance.
+		if account.Balance != nil {
+			state.SetBalance(addr, (*big.Int)(*account.Balance))
+		}
+		if account.State != nil && account.StateDiff != nil {
+			return fmt.Errorf("account %s has both 'state' and 'stateDiff'", addr.Hex())
+		}
+		// Replace entire state if caller requires.
+		if account.State != nil {
+			state.SetStorage(addr, *account.State)
+		}
+		// Apply state diff into specified accounts.
+		if account.StateDiff != nil {
+			for key, value := range *account.StateDiff {
+				state.SetState(addr, key, value)
+			}
+		}
+	}
+	return nil
+}
 
-	state, header, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
-	if state == nil || err != nil {
-		return nil, common.Big0, err
+// BlockOverrides is the set of block context fields overridden when executing a
+// call, allowing to simulate its execution in a future block.
+type BlockOverrides struct {
+	Number   *hexutil.Big    `json:"number"`
+	Time     *hexutil.Big    `json:"time"`
+	Coinbase *common.Address `json:"coinbase"`
+	BaseFee  *hexutil.Big    `json:"baseFee"`
+}
+
+// Apply returns a copy of the header with the overridden fields replaced, or the
+// header itself if there is nothing to override.
+func (o *BlockOverrides) Apply(header *types.Header) *types.Header {
+	if o == nil {
+		return header
+	}
+	header = types.CopyHeader(header)
+	if o.Number != nil {
+		header.Number = new(big.Int).Set(o.Number.ToInt())
+	}
+	if o.Time != nil {
+		header.Time = new(big.Int).Set(o.Time.ToInt())
 	}
-	// Set sender address or use a default if none specified
-	addr := args.From
-	if addr == (common.Address{}) {
-		if wallets := s.b.AccountManager().Wallets(); len(wallets) > 0 {
+	if o.Coinbase != nil {
+		header.Coinbase = *o.Coinbase
+	}
+	if o.BaseFee != nil {
+		header.BaseFee = new(big.Int).Set(o.BaseFee.ToInt())
+	}
+	return header
+}
+
+// callState returns the state and header of the block a call is executed on,
+// failing if the block is unknown or its state is not available anymore.
+func callState(ctx context.Context, b Backend, blockNr rpc.BlockNumber) (*state.StateDB, *types.Header, error) {
+	statedb, header, err := b.StateAndHeaderByNumber(ctx, blockNr)
+	if _, missing := err.(*trie.MissingNodeError); missing && header != nil {
+		return nil, nil, fmt.Errorf("state of block #%d is not available, historical calls require an archive node: %v", header.Number, err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if statedb == nil {
+		return nil, nil, fmt.Errorf("block #%d not found", blockNr)
+	}
+	return statedb, header, nil
+}
+
+// callSender returns the sender of a call, defaulting to the first account of
+// the first wallet if none was specified.
+func callSender(b Backend, from common.Address) common.Address {
+	if from == (common.Address{}) {
+		if wallets := b.AccountManager().Wallets(); len(wallets) > 0 {
 			if accounts := wallets[0].Accounts(); len(accounts) > 0 {
-				addr = accounts[0].Address
+				return accounts[0].Address
 			}
 		}
 	}
-	// Set default gas & gas price if none were set
-	gas, gasPrice := args.Gas.ToInt(), args.GasPrice.ToInt()
+	return from
+}
+
+// callGasPrice returns the gas price a call is executed with, defaulting to a
+// fixed price if none was specified. Zero priced calls are exempt from the base
+// fee, so they are kept free post London.
+func callGasPrice(args CallArgs, header *types.Header) *big.Int {
+	gasPrice := args.GasPrice.ToInt()
+	if gasPrice.Sign() == 0 && header.BaseFee == nil {
+		gasPrice = new(big.Int).SetUint64(defaultGasPrice)
+	}
+	return gasPrice
+}
+
+// ToMessage converts the call arguments into a message executed on top of the
+// given header, defaulting the sender, gas and gas price if none were set.
+func (args *CallArgs) ToMessage(b Backend, header *types.Header) types.Message {
+	gas := args.Gas.ToInt()
 	if gas.Sign() == 0 {
 		gas = big.NewInt(50000000)
 	}
-	if gasPrice.Sign() == 0 {
-		gasPrice = new(big.Int).SetUint64(defaultGasPrice)
+	var accessList types.AccessList
+	if args.AccessList != nil {
+		accessList = *args.AccessList
 	}
+	return types.NewMessage(callSender(b, args.From), args.To, 0, args.Value.ToInt(), gas, callGasPrice(*args, header), args.Data, accessList, false)
+}
+
+// CallLimits overrides the execution limits a node enforces on calls through
+// the --rpc.evmtimeout and --rpc.gascap flags. Being able to lift them, it is
+// only accepted by the private APIs.
+type CallLimits struct {
+	Timeout *string      // EVM execution timeout, zero disables it
+	GasCap  *hexutil.Big // Gas cap of the call, zero disables it
+}
+
+// callLimits are the execution limits enforced on a call.
+type callLimits struct {
+	timeout time.Duration // EVM execution timeout (0 = no timeout)
+	gasCap  *big.Int      // Gas cap of the call (nil = no cap)
+}
+
+// newCallLimits returns the node wide execution limits of the backend, with
+// the given per-call overrides, if any, applied on top.
+func newCallLimits(b Backend, overrides *CallLimits) (callLimits, error) {
+	limits := callLimits{timeout: b.RPCEVMTimeout(), gasCap: b.RPCGasCap()}
+	if overrides == nil {
+		return limits, nil
+	}
+	if overrides.Timeout != nil {
+		timeout, err := time.ParseDuration(*overrides.Timeout)
+		if err != nil {
+			return callLimits{}, err
+		}
+		limits.timeout = timeout
+	}
+	if overrides.GasCap != nil {
+		limits.gasCap = overrides.GasCap.ToInt()
+	}
+	if limits.gasCap != nil && limits.gasCap.Sign() == 0 {
+		limits.gasCap = nil
+	}
+	return limits, nil
+}
+
+// capGas lowers the gas allowance of the call arguments to the gas cap, also
+// if none was specified.
+func (limits callLimits) capGas(args *CallArgs) {
+	if limits.gasCap == nil {
+		return
+	}
+	if gas := args.Gas.ToInt(); gas.Sign() == 0 || gas.Cmp(limits.gasCap) > 0 {
+		log.Debug("Capping call gas allowance", "requested", gas, "cap", limits.gasCap)
+		args.Gas = hexutil.Big(*limits.gasCap)
+	}
+}
+
+// callTimeoutError is returned when a call is aborted for exceeding the EVM
+// execution timeout.
+type callTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e *callTimeoutError) Error() string {
+	return fmt.Sprintf("execution aborted (timeout = %v)", e.timeout)
+}
+
+// doCall executes the call on top of the given block within the execution
+// limits, capping its gas and aborting it once the timeout expires. The block
+// context may be overridden to simulate the call in another block.
+func doCall(ctx context.Context, b Backend, args CallArgs, blockNr rpc.BlockNumber, overrides *StateOverride, blockOverrides *BlockOverrides, vmCfg vm.Config, limits callLimits) ([]byte, *big.Int, bool, error) {
+	defer func(start time.Time) { log.Debug("Executing EVM call finished", "runtime", time.Since(start)) }(time.Now())
+
+	state, header, err := callState(ctx, b, blockNr)
+	if err != nil {
+		return nil, common.Big0, false, err
+	}
+	if err := overrides.Apply(state); err != nil {
+		return nil, common.Big0, false, err
+	}
+	header = blockOverrides.Apply(header)
 
 	// Create new call message
-	msg := types.NewMessage(addr, args.To, 0, args.Value.ToInt(), gas, gasPrice, args.Data, false)
+	limits.capGas(&args)
+	msg := args.ToMessage(b, header)
 
 	// Setup context so it may be cancelled the call has completed
-	// or, in case of unmetered gas, setup a context with a timeout.
+	// or, in case of an execution timeout, once it expires.
 	var cancel context.CancelFunc
-	if vmCfg.DisableGasMetering {
-		ctx, cancel = context.WithTimeout(ctx, time.Second*5)
+	if limits.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, limits.timeout)
 	} else {
 		ctx, cancel = context.WithCancel(ctx)
 	}
@@ -619,9 +1040,13 @@ func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr
 	defer func() { cancel() }()
 
 	// Get a new instance of the EVM.
-	evm, vmError, err := s.b.GetEVM(ctx, msg, state, header, vmCfg)
+	evm, vmError, err := b.GetEVM(ctx, msg, state, header, vmCfg)
 	if err != nil {
-		return nil, common.Big0, err
+		return nil, common.Big0, false, err
+	}
+	// The consensus engine may derive the coinbase from the seal instead
+	if blockOverrides != nil && blockOverrides.Coinbase != nil {
+		evm.Coinbase = *blockOverrides.Coinbase
 	}
 	// Wait for the context to be done and cancel the evm. Even if the
 	// EVM has finished, cancelling may be done (repeatedly)
@@ -635,57 +1060,275 @@ func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr
 	// Setup the gas pool (also for unmetered requests)
 	// and apply the message.
 	gp := new(core.GasPool).AddGas(math.MaxBig256)
-	res, gas, err := core.ApplyMessage(evm, msg, gp)
+	res, gas, failed, err := core.ApplyMessage(evm, msg, gp)
 	if err := vmError(); err != nil {
-		return nil, common.Big0, err
+		return nil, common.Big0, false, err
+	}
+	// If the execution was aborted by the timeout, its results are meaningless
+	if evm.Cancelled() && ctx.Err() == context.DeadlineExceeded {
+		return nil, common.Big0, false, &callTimeoutError{limits.timeout}
 	}
-	return res, gas, err
+	return res, gas, failed, err
 }
 
 // Call executes the given transaction on the state for the given block number.
 // It doesn't make and changes in the state/blockchain and is useful to execute and retrieve values.
-func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber) (hexutil.Bytes, error) {
-	result, _, err := s.doCall(ctx, args, blockNr, vm.Config{DisableGasMetering: true})
-	return (hexutil.Bytes)(result), err
+//
+// Additionally, the caller can specify a batch of contract for fields overriding,
+// as well as block context fields to simulate the call in a future block. Calls
+// on historical blocks require their state to be available.
+//
+// Note, this function doesn't make any changes in the state/blockchain and is
+// useful to execute and retrieve values.
+func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, overrides *StateOverride, blockOverrides *BlockOverrides) (hexutil.Bytes, error) {
+	limits, err := newCallLimits(s.b, nil)
+	if err != nil {
+		return nil, err
+	}
+	return call(ctx, s.b, args, blockNr, overrides, blockOverrides, limits)
+}
+
+// call executes the given call within the execution limits, surfacing the revert
+// reason of failed executions. Unless gas is capped, calls are run unmetered.
+func call(ctx context.Context, b Backend, args CallArgs, blockNr rpc.BlockNumber, overrides *StateOverride, blockOverrides *BlockOverrides, limits callLimits) (hexutil.Bytes, error) {
+	result, _, failed, err := doCall(ctx, b, args, blockNr, overrides, blockOverrides, vm.Config{DisableGasMetering: limits.gasCap == nil}, limits)
+	if err != nil {
+		return nil, err
+	}
+	// If the execution failed with revert data, surface the reason to the caller
+	if failed && len(result) > 0 {
+		return nil, newRevertError(result)
+	}
+	return (hexutil.Bytes)(result), nil
+}
+
+// revertError is an API error that carries the decoded reason and the raw
+// return data of a reverted execution.
+type revertError struct {
+	error
+	reason string // revert reason hex encoded
 }
 
-// EstimateGas returns an estimate of the amount of gas needed to execute the given transaction.
-func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (*hexutil.Big, error) {
-	// Binary search the gas requirement, as it may be higher than the amount used
-	var lo, hi uint64
+// newRevertError creates a revertError from the return data of a failed
+// execution, decoding the Solidity Error(string) reason if present.
+func newRevertError(ret []byte) *revertError {
+	err := errors.New("execution reverted")
+	if reason, errUnpack := abi.UnpackRevert(ret); errUnpack == nil {
+		err = fmt.Errorf("execution reverted: %v", reason)
+	}
+	return &revertError{
+		error:  err,
+		reason: hexutil.Encode(ret),
+	}
+}
+
+// ErrorCode returns the JSON error code for a revertal.
+// See: https://github.com/ethereum/wiki/wiki/JSON-RPC-Error-Codes-Improvement-Proposal
+func (e *revertError) ErrorCode() int {
+	return 3
+}
+
+// ErrorData returns the hex encoded revert reason.
+func (e *revertError) ErrorData() interface{} {
+	return e.reason
+}
+
+// EstimateGas returns an estimate of the amount of gas needed to execute the
+// given transaction against the pending block, or the given one if specified.
+// The state of the block may be overridden the same way as for Call.
+//
+// The estimate is found by binary searching between the intrinsic gas of a plain
+// transfer and the block gas limit (or the provided gas), capped by what the
+// sender can afford at the call's gas price.
+func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs, blockNr *rpc.BlockNumber, overrides *StateOverride) (*hexutil.Big, error) {
+	limits, err := newCallLimits(s.b, nil)
+	if err != nil {
+		return nil, err
+	}
+	return estimateGas(ctx, s.b, args, blockNr, overrides, limits)
+}
+
+// estimateGas binary searches the gas needed by the given call, executing each
+// attempt within the execution limits. The search is additionally capped by the
+// gas cap, and aborted as soon as an attempt times out.
+func estimateGas(ctx context.Context, b Backend, args CallArgs, blockNr *rpc.BlockNumber, overrides *StateOverride, limits callLimits) (*hexutil.Big, error) {
+	number := rpc.PendingBlockNumber
+	if blockNr != nil {
+		number = *blockNr
+	}
+	args.From = callSender(b, args.From)
+
+	// Determine the highest gas limit can be used during the estimation.
+	var (
+		lo  = params.TxGas - 1
+		hi  uint64
+		cap uint64
+	)
 	if (*big.Int)(&args.Gas).Sign() != 0 {
 		hi = (*big.Int)(&args.Gas).Uint64()
 	} else {
-		// Retrieve the current pending block to act as the gas ceiling
-		block, err := s.b.BlockByNumber(ctx, rpc.PendingBlockNumber)
+		// Retrieve the block to act as the gas ceiling
+		block, err := b.BlockByNumber(ctx, number)
 		if err != nil {
 			return nil, err
 		}
 		hi = block.GasLimit().Uint64()
 	}
-	for lo+1 < hi {
-		// Take a guess at the gas, and check transaction validity
-		mid := (hi + lo) / 2
-		(*big.Int)(&args.Gas).SetUint64(mid)
+	if limits.gasCap != nil && limits.gasCap.IsUint64() && hi > limits.gasCap.Uint64() {
+		log.Debug("Gas estimation capped by the gas cap", "original", hi, "cap", limits.gasCap)
+		hi = limits.gasCap.Uint64()
+	}
+	// Recap the highest gas limit with the sender's maximum allowance
+	state, header, err := b.StateAndHeaderByNumber(ctx, number)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	if err := overrides.Apply(state); err != nil {
+		return nil, err
+	}
+	if gasPrice := callGasPrice(args, header); gasPrice.Sign() != 0 {
+		available := state.GetBalance(args.From)
+		if value := args.Value.ToInt(); value.Sign() != 0 {
+			if value.Cmp(available) > 0 {
+				return nil, core.ErrInsufficientFunds
+			}
+			available.Sub(available, value)
+		}
+		allowance := new(big.Int).Div(available, gasPrice)
+		if allowance.IsUint64() && hi > allowance.Uint64() {
+			log.Debug("Gas estimation capped by limited funds", "original", hi, "balance", available, "gasprice", gasPrice, "fundable", allowance)
+			hi = allowance.Uint64()
+		}
+	}
+	cap = hi
 
-		_, gas, err := s.doCall(ctx, args, rpc.PendingBlockNumber, vm.Config{})
+	// Create a helper to check if a gas allowance results in an executable transaction
+	executable := func(gas uint64) (bool, []byte, error) {
+		(*big.Int)(&args.Gas).SetUint64(gas)
 
-		// If the transaction became invalid or used all the gas (failed), raise the gas limit
-		if err != nil || gas.Cmp((*big.Int)(&args.Gas)) == 0 {
+		ret, _, failed, err := doCall(ctx, b, args, number, overrides, nil, vm.Config{}, limits)
+		if err != nil || failed {
+			return false, ret, err
+		}
+		return true, ret, nil
+	}
+	// Execute the binary search and hone in on an executable gas limit
+	for lo+1 < hi {
+		mid := (hi + lo) / 2
+		ok, _, err := executable(mid)
+		if _, timeout := err.(*callTimeoutError); timeout {
+			return nil, err
+		}
+		if !ok {
 			lo = mid
-			continue
+		} else {
+			hi = mid
+		}
+	}
+	// Reject the transaction as invalid if it still fails at the highest allowance
+	if hi == cap {
+		ok, ret, err := executable(hi)
+		if !ok {
+			if err != nil {
+				return nil, err
+			}
+			if len(ret) > 0 {
+				return nil, newRevertError(ret)
+			}
+			return nil, fmt.Errorf("gas required exceeds allowance (%d) or always failing transaction", cap)
 		}
-		// Otherwise assume the transaction succeeded, lower the gas limit
-		hi = mid
 	}
 	return (*hexutil.Big)(new(big.Int).SetUint64(hi)), nil
 }
 
+// accessListResult is the result of eth_createAccessList, the generated access
+// list along with the gas used by the call when it is attached. It contains an
+// error if the call itself failed.
+type accessListResult struct {
+	Accesslist *types.AccessList `json:"accessList"`
+	Error      string            `json:"error,omitempty"`
+	GasUsed    *hexutil.Big      `json:"gasUsed"`
+}
+
+// CreateAccessList creates an EIP-2930 access list for the given call, executed
+// against the pending block, or the given one if specified. Any access list set
+// in the arguments is extended, never shrunk.
+func (s *PublicBlockChainAPI) CreateAccessList(ctx context.Context, args CallArgs, blockNr *rpc.BlockNumber) (*accessListResult, error) {
+	number := rpc.PendingBlockNumber
+	if blockNr != nil {
+		number = *blockNr
+	}
+	limits, err := newCallLimits(s.b, nil)
+	if err != nil {
+		return nil, err
+	}
+	acl, gasUsed, vmerr, err := accessList(ctx, s.b, args, number, limits)
+	if err != nil {
+		return nil, err
+	}
+	result := &accessListResult{Accesslist: &acl, GasUsed: (*hexutil.Big)(gasUsed)}
+	if vmerr != nil {
+		result.Error = vmerr.Error()
+	}
+	return result, nil
+}
+
+// accessList creates an access list for the given call by executing it
+// repeatedly, each time with the access list accumulated by the previous run,
+// until the list stops changing. Failures to execute the call are returned as
+// err, while a failed execution is reported through vmErr.
+func accessList(ctx context.Context, b Backend, args CallArgs, blockNr rpc.BlockNumber, limits callLimits) (acl types.AccessList, gasUsed *big.Int, vmErr error, err error) {
+	// Resolve the sender and the recipient, which don't need to be added to the
+	// access list, same as the precompiles
+	db, _, err := b.StateAndHeaderByNumber(ctx, blockNr)
+	if db == nil || err != nil {
+		return nil, nil, nil, err
+	}
+	args.From = callSender(b, args.From)
+
+	var to common.Address
+	if args.To != nil {
+		to = *args.To
+	} else {
+		to = crypto.CreateAddress(args.From, db.GetNonce(args.From))
+	}
+	// Create an initial tracer, seeded with the requested access list
+	var seed types.AccessList
+	if args.AccessList != nil {
+		seed = *args.AccessList
+	}
+	prevTracer := vm.NewAccessListTracer(seed, args.From, to)
+	for {
+		// Retrieve the current access list to expand
+		accessList := prevTracer.AccessList()
+		log.Trace("Creating access list", "input", accessList)
+
+		// Apply the transaction with the access list tracer
+		args.AccessList = &accessList
+		tracer := vm.NewAccessListTracer(accessList, args.From, to)
+		res, gas, failed, err := doCall(ctx, b, args, blockNr, nil, nil, vm.Config{Debug: true, Tracer: tracer}, limits)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to apply transaction: %v", err)
+		}
+		if tracer.Equal(prevTracer) {
+			if failed {
+				vmErr = errors.New("execution failed")
+				if len(res) > 0 {
+					vmErr = newRevertError(res)
+				}
+			}
+			return accessList, gas, vmErr, nil
+		}
+		prevTracer = tracer
+	}
+}
+
 // ExecutionResult groups all structured logs emitted by the EVM
 // while replaying a transaction in debug mode as well as the amount of
 // gas used and the return value
 type ExecutionResult struct {
 	Gas         *big.Int       `json:"gas"`
+	Failed      bool           `json:"failed"`
 	ReturnValue string         `json:"returnValue"`
 	StructLogs  []StructLogRes `json:"structLogs"`
 }
@@ -759,6 +1402,9 @@ func (s *PublicBlockChainAPI) rpcOutputBlock(b *types.Block, inclTx bool, fullTx
 		"transactionsRoot": head.TxHash,
 		"receiptsRoot":     head.ReceiptHash,
 	}
+	if head.BaseFee != nil {
+		fields["baseFeePerGas"] = (*hexutil.Big)(head.BaseFee)
+	}
 
 	if inclTx {
 		formatTx := func(tx *types.Transaction) (interface{}, error) {
@@ -808,6 +1454,12 @@ type RPCTransaction struct {
 	V                *hexutil.Big    `json:"v"`
 	R                *hexutil.Big    `json:"r"`
 	S                *hexutil.Big    `json:"s"`
+
+	Type       hexutil.Uint64    `json:"type"`
+	ChainID    *hexutil.Big      `json:"chainId,omitempty"`
+	AccessList *types.AccessList `json:"accessList,omitempty"`
+	GasFeeCap  *hexutil.Big      `json:"maxFeePerGas,omitempty"`
+	GasTipCap  *hexutil.Big      `json:"maxPriorityFeePerGas,omitempty"`
 }
 
 // newRPCTransaction returns a transaction that will serialize to the RPC
@@ -815,7 +1467,7 @@ type RPCTransaction struct {
 func newRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber uint64, index uint64) *RPCTransaction {
 	var signer types.Signer = types.FrontierSigner{}
 	if tx.Protected() {
-		signer = types.NewEIP155Signer(tx.ChainId())
+		signer = types.NewLondonSigner(tx.ChainId())
 	}
 	from, _ := types.Sender(signer, tx)
 	v, r, s := tx.RawSignatureValues()
@@ -832,6 +1484,16 @@ func newRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber
 		V:        (*hexutil.Big)(v),
 		R:        (*hexutil.Big)(r),
 		S:        (*hexutil.Big)(s),
+		Type:     hexutil.Uint64(tx.Type()),
+	}
+	if tx.Type() != types.LegacyTxType {
+		al := tx.AccessList()
+		result.ChainID = (*hexutil.Big)(tx.ChainId())
+		result.AccessList = &al
+	}
+	if tx.Type() == types.DynamicFeeTxType {
+		result.GasFeeCap = (*hexutil.Big)(tx.GasFeeCap())
+		result.GasTipCap = (*hexutil.Big)(tx.GasTipCap())
 	}
 	if blockHash != (common.Hash{}) {
 		result.BlockHash = blockHash
@@ -841,8 +1503,8 @@ func newRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber
 	return result
 }
 
-// newRPCPendingTransaction returns a pending transaction that will serialize to the RPC representation
-func newRPCPendingTransaction(tx *types.Transaction) *RPCTransaction {
+// NewRPCPendingTransaction returns a pending transaction that will serialize to the RPC representation
+func NewRPCPendingTransaction(tx *types.Transaction) *RPCTransaction {
 	return newRPCTransaction(tx, common.Hash{}, 0, 0)
 }
 
@@ -861,7 +1523,7 @@ func newRPCRawTransactionFromBlockIndex(b *types.Block, index uint64) hexutil.By
 	if index >= uint64(len(txs)) {
 		return nil
 	}
-	blob, _ := rlp.EncodeToBytes(txs[index])
+	blob, _ := txs[index].MarshalBinary()
 	return blob
 }
 
@@ -954,7 +1616,7 @@ func (s *PublicTransactionPoolAPI) GetTransactionByHash(ctx context.Context, has
 	}
 	// No finalized transaction, try to retrieve it from the pool
 	if tx := s.b.GetPoolTransaction(hash); tx != nil {
-		return newRPCPendingTransaction(tx)
+		return NewRPCPendingTransaction(tx)
 	}
 	// Transaction unknown, return as such
 	return nil
@@ -971,8 +1633,8 @@ func (s *PublicTransactionPoolAPI) GetRawTransactionByHash(ctx context.Context,
 			return nil, nil
 		}
 	}
-	// Serialize to RLP and return
-	return rlp.EncodeToBytes(tx)
+	// Serialize to the canonical encoding and return
+	return tx.MarshalBinary()
 }
 
 // GetTransactionReceipt returns the transaction receipt for the given transaction hash.
@@ -985,7 +1647,7 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(hash common.Hash) (map[
 
 	var signer types.Signer = types.FrontierSigner{}
 	if tx.Protected() {
-		signer = types.NewEIP155Signer(tx.ChainId())
+		signer = types.NewLondonSigner(tx.ChainId())
 	}
 	from, _ := types.Sender(signer, tx)
 
@@ -1039,6 +1701,13 @@ type SendTxArgs struct {
 	Value    *hexutil.Big    `json:"value"`
 	Data     hexutil.Bytes   `json:"data"`
 	Nonce    *hexutil.Uint64 `json:"nonce"`
+
+	// AccessList turns the transaction into an EIP-2930 access list transaction
+	AccessList *types.AccessList `json:"accessList"`
+
+	// Fee caps turn the transaction into an EIP-1559 dynamic fee transaction
+	MaxFeePerGas         *hexutil.Big `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big `json:"maxPriorityFeePerGas"`
 }
 
 // prepareSendTxArgs is a helper function that fills in default values for unspecified tx fields.
@@ -1046,7 +1715,30 @@ func (args *SendTxArgs) setDefaults(ctx context.Context, b Backend) error {
 	if args.Gas == nil {
 		args.Gas = (*hexutil.Big)(big.NewInt(defaultGas))
 	}
-	if args.GasPrice == nil {
+	if args.MaxFeePerGas != nil || args.MaxPriorityFeePerGas != nil {
+		if args.GasPrice != nil {
+			return errors.New("both gasPrice and (maxFeePerGas or maxPriorityFeePerGas) specified")
+		}
+		if args.MaxPriorityFeePerGas == nil {
+			tip, err := b.SuggestTipCap(ctx)
+			if err != nil {
+				return err
+			}
+			args.MaxPriorityFeePerGas = (*hexutil.Big)(tip)
+		}
+		if args.MaxFeePerGas == nil {
+			// Leave room for the base fee to double before the transaction is priced out
+			feeCap := new(big.Int).Set(args.MaxPriorityFeePerGas.ToInt())
+			if head := b.CurrentBlock().Header(); head.BaseFee != nil {
+				feeCap.Add(feeCap, new(big.Int).Mul(head.BaseFee, common.Big2))
+			}
+			args.MaxFeePerGas = (*hexutil.Big)(feeCap)
+		}
+		if args.MaxFeePerGas.ToInt().Cmp(args.MaxPriorityFeePerGas.ToInt()) < 0 {
+			return fmt.Errorf("maxFeePerGas (%v) < maxPriorityFeePerGas (%v)", args.MaxFeePerGas, args.MaxPriorityFeePerGas)
+		}
+	}
+	if args.GasPrice == nil && args.MaxFeePerGas == nil {
 		price, err := b.SuggestPrice(ctx)
 		if err != nil {
 			return err
@@ -1067,6 +1759,16 @@ func (args *SendTxArgs) setDefaults(ctx context.Context, b Backend) error {
 }
 
 func (args *SendTxArgs) toTransaction() *types.Transaction {
+	if args.MaxFeePerGas != nil {
+		var al types.AccessList
+		if args.AccessList != nil {
+			al = *args.AccessList
+		}
+		return types.NewDynamicFeeTransaction(uint64(*args.Nonce), args.To, (*big.Int)(args.Value), (*big.Int)(args.Gas), (*big.Int)(args.MaxPriorityFeePerGas), (*big.Int)(args.MaxFeePerGas), args.Data, al)
+	}
+	if args.AccessList != nil {
+		return types.NewAccessListTransaction(uint64(*args.Nonce), args.To, (*big.Int)(args.Value), (*big.Int)(args.Gas), (*big.Int)(args.GasPrice), args.Data, *args.AccessList)
+	}
 	if args.To == nil {
 		return types.NewContractCreation(uint64(*args.Nonce), (*big.Int)(args.Value), (*big.Int)(args.Gas), (*big.Int)(args.GasPrice), args.Data)
 	}
@@ -1130,7 +1832,7 @@ func (s *PublicTransactionPoolAPI) SendTransaction(ctx context.Context, args Sen
 // The sender is responsible for signing the transaction and using the correct nonce.
 func (s *PublicTransactionPoolAPI) SendRawTransaction(ctx context.Context, encodedTx hexutil.Bytes) (string, error) {
 	tx := new(types.Transaction)
-	if err := rlp.DecodeBytes(encodedTx, tx); err != nil {
+	if err := tx.UnmarshalBinary(encodedTx); err != nil {
 		return "", err
 	}
 
@@ -1178,6 +1880,32 @@ func (s *PublicTransactionPoolAPI) Sign(addr common.Address, data hexutil.Bytes)
 	return signature, err
 }
 
+// SignTypedData_v4 calculates an ECDSA signature of EIP-712 typed data:
+// keccack256("\x19\x01" + domainSeparator + hashStruct(message)).
+//
+// Note, the produced signature conforms to the secp256k1 curve R, S and V values,
+// where the V value will be 27 or 28 for legacy reasons.
+//
+// The account associated with addr must be unlocked.
+func (s *PublicTransactionPoolAPI) SignTypedData_v4(addr common.Address, data accounts.TypedData) (hexutil.Bytes, error) {
+	hash, err := accounts.TypedDataHash(&data)
+	if err != nil {
+		return nil, err
+	}
+	// Look up the wallet containing the requested signer
+	account := accounts.Account{Address: addr}
+
+	wallet, err := s.b.AccountManager().Find(account)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := wallet.SignHash(account, hash[:])
+	if err == nil {
+		signature[64] += 27 // Transform V from 0/1 to 27/28 according to the yellow paper
+	}
+	return signature, err
+}
+
 // SignTransactionResult represents a RLP encoded signed transaction.
 type SignTransactionResult struct {
 	Raw hexutil.Bytes      `json:"raw"`
@@ -1201,7 +1929,7 @@ func (s *PublicTransactionPoolAPI) SignTransaction(ctx context.Context, args Sen
 	if err != nil {
 		return nil, err
 	}
-	data, err := rlp.EncodeToBytes(tx)
+	data, err := tx.MarshalBinary()
 	if err != nil {
 		return nil, err
 	}
@@ -1220,11 +1948,11 @@ func (s *PublicTransactionPoolAPI) PendingTransactions() ([]*RPCTransaction, err
 	for _, tx := range pending {
 		var signer types.Signer = types.HomesteadSigner{}
 		if tx.Protected() {
-			signer = types.NewEIP155Signer(tx.ChainId())
+			signer = types.NewLondonSigner(tx.ChainId())
 		}
 		from, _ := types.Sender(signer, tx)
 		if _, err := s.b.AccountManager().Find(accounts.Account{Address: from}); err == nil {
-			transactions = append(transactions, newRPCPendingTransaction(tx))
+			transactions = append(transactions, NewRPCPendingTransaction(tx))
 		}
 	}
 	return transactions, nil
@@ -1248,7 +1976,7 @@ func (s *PublicTransactionPoolAPI) Resend(ctx context.Context, sendArgs SendTxAr
 	for _, p := range pending {
 		var signer types.Signer = types.HomesteadSigner{}
 		if p.Protected() {
-			signer = types.NewEIP155Signer(p.ChainId())
+			signer = types.NewLondonSigner(p.ChainId())
 		}
 		wantSigHash := signer.Hash(matchTx)
 
@@ -1330,6 +2058,26 @@ func NewPrivateDebugAPI(b Backend) *PrivateDebugAPI {
 	return &PrivateDebugAPI{b: b}
 }
 
+// Call executes the given call the same way as eth_call does, with the node wide
+// execution limits optionally overridden.
+func (api *PrivateDebugAPI) Call(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, overrides *StateOverride, blockOverrides *BlockOverrides, limits *CallLimits) (hexutil.Bytes, error) {
+	callLimits, err := newCallLimits(api.b, limits)
+	if err != nil {
+		return nil, err
+	}
+	return call(ctx, api.b, args, blockNr, overrides, blockOverrides, callLimits)
+}
+
+// EstimateGas estimates the gas needed by the given call the same way as
+// eth_estimateGas does, with the node wide execution limits optionally overridden.
+func (api *PrivateDebugAPI) EstimateGas(ctx context.Context, args CallArgs, blockNr *rpc.BlockNumber, overrides *StateOverride, limits *CallLimits) (*hexutil.Big, error) {
+	callLimits, err := newCallLimits(api.b, limits)
+	if err != nil {
+		return nil, err
+	}
+	return estimateGas(ctx, api.b, args, blockNr, overrides, callLimits)
+}
+
 // ChaindbProperty returns leveldb properties of the chain database.
 func (api *PrivateDebugAPI) ChaindbProperty(property string) (string, error) {
 	ldb, ok := api.b.ChainDb().(interface {
@@ -0,0 +1,260 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// limitsBackend is a backend only providing the node wide call execution limits.
+type limitsBackend struct {
+	Backend
+	gasCap  *big.Int
+	timeout time.Duration
+}
+
+func (b *limitsBackend) RPCGasCap() *big.Int          { return b.gasCap }
+func (b *limitsBackend) RPCEVMTimeout() time.Duration { return b.timeout }
+
+// Tests that the node wide call execution limits are enforced and that per-call
+// overrides replace them, zero values lifting them altogether.
+func TestCallLimits(t *testing.T) {
+	var (
+		backend = &limitsBackend{gasCap: big.NewInt(1000000), timeout: 5 * time.Second}
+		zero    = "0s"
+		second  = "1s"
+		invalid = "soon"
+	)
+	tests := []struct {
+		overrides *CallLimits
+		timeout   time.Duration
+		gasCap    *big.Int
+		fail      bool
+	}{
+		{nil, 5 * time.Second, big.NewInt(1000000), false},
+		{&CallLimits{}, 5 * time.Second, big.NewInt(1000000), false},
+		{&CallLimits{Timeout: &second, GasCap: (*hexutil.Big)(big.NewInt(2000000))}, time.Second, big.NewInt(2000000), false},
+		{&CallLimits{Timeout: &zero, GasCap: new(hexutil.Big)}, 0, nil, false},
+		{&CallLimits{Timeout: &invalid}, 0, nil, true},
+	}
+	for i, tt := range tests {
+		limits, err := newCallLimits(backend, tt.overrides)
+		if (err != nil) != tt.fail {
+			t.Errorf("test %d: error mismatch: have %v, want failure %v", i, err, tt.fail)
+			continue
+		}
+		if tt.fail {
+			continue
+		}
+		if limits.timeout != tt.timeout {
+			t.Errorf("test %d: timeout mismatch: have %v, want %v", i, limits.timeout, tt.timeout)
+		}
+		if (limits.gasCap == nil) != (tt.gasCap == nil) || (tt.gasCap != nil && limits.gasCap.Cmp(tt.gasCap) != 0) {
+			t.Errorf("test %d: gas cap mismatch: have %v, want %v", i, limits.gasCap, tt.gasCap)
+		}
+	}
+}
+
+// Tests that the gas allowance of calls is lowered to the gas cap, also if none
+// was requested, but never raised.
+func TestCallLimitsCapGas(t *testing.T) {
+	limits := callLimits{gasCap: big.NewInt(1000000)}
+
+	tests := []struct {
+		gas, capped int64
+	}{
+		{0, 1000000},
+		{21000, 21000},
+		{1000000, 1000000},
+		{50000000, 1000000},
+	}
+	for i, tt := range tests {
+		args := CallArgs{Gas: hexutil.Big(*big.NewInt(tt.gas))}
+		limits.capGas(&args)
+		if have := args.Gas.ToInt().Int64(); have != tt.capped {
+			t.Errorf("test %d: gas mismatch: have %d, want %d", i, have, tt.capped)
+		}
+	}
+	args := CallArgs{}
+	callLimits{}.capGas(&args)
+	if args.Gas.ToInt().Sign() != 0 {
+		t.Errorf("uncapped call gas changed to %v", args.Gas.ToInt())
+	}
+}
+
+// stateBackend is a backend only providing a fixed state.
+type stateBackend struct {
+	Backend
+	state *state.StateDB
+}
+
+func (b *stateBackend) StateAndHeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*state.StateDB, *types.Header, error) {
+	return b.state, &types.Header{}, nil
+}
+
+// Tests that account proofs report the account fields next to the proofs, and
+// the EIP-1186 defaults for non-existent accounts.
+func TestGetProof(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	addr := common.Address{0x01}
+	statedb.SetBalance(addr, big.NewInt(1000))
+	statedb.SetNonce(addr, 7)
+	statedb.SetCode(addr, []byte{0x60, 0x00})
+	statedb.SetState(addr, common.HexToHash("0x01"), common.Hash{0x02})
+	root, _ := statedb.CommitTo(db, false)
+	statedb, _ = state.New(root, state.NewDatabase(db))
+
+	api := NewPublicBlockChainAPI(&stateBackend{state: statedb})
+
+	res, err := api.GetProof(context.Background(), addr, []string{"0x01", "0x02"}, rpc.LatestBlockNumber)
+	if err != nil {
+		t.Fatalf("failed to prove account: %v", err)
+	}
+	if res.Balance.ToInt().Int64() != 1000 || res.Nonce != 7 || res.CodeHash != crypto.Keccak256Hash([]byte{0x60, 0x00}) {
+		t.Errorf("account fields mismatch: balance %v, nonce %d, code hash %x", res.Balance, res.Nonce, res.CodeHash)
+	}
+	if res.StorageHash != statedb.GetStorageRoot(addr) || len(res.AccountProof) == 0 {
+		t.Errorf("account proof mismatch: storage hash %x, %d proof nodes", res.StorageHash, len(res.AccountProof))
+	}
+	if len(res.StorageProof) != 2 || res.StorageProof[0].Value.ToInt().Cmp(common.Hash{0x02}.Big()) != 0 || res.StorageProof[1].Value.ToInt().Sign() != 0 {
+		t.Errorf("storage proofs mismatch: %+v", res.StorageProof)
+	}
+	res, err = api.GetProof(context.Background(), common.Address{0xaa}, []string{"0x01"}, rpc.LatestBlockNumber)
+	if err != nil {
+		t.Fatalf("failed to prove missing account: %v", err)
+	}
+	if res.CodeHash != crypto.Keccak256Hash(nil) || res.StorageHash != types.EmptyRootHash || len(res.AccountProof) == 0 {
+		t.Errorf("missing account mismatch: code hash %x, storage hash %x, %d proof nodes", res.CodeHash, res.StorageHash, len(res.AccountProof))
+	}
+	if len(res.StorageProof) != 1 || len(res.StorageProof[0].Proof) != 0 {
+		t.Errorf("missing account storage proofs mismatch: %+v", res.StorageProof)
+	}
+}
+
+// Tests that block overrides replace the header fields on a copy only.
+func TestBlockOverrides(t *testing.T) {
+	header := &types.Header{Number: big.NewInt(10), Time: big.NewInt(100), Coinbase: common.Address{0x01}, Difficulty: big.NewInt(1), GasLimit: big.NewInt(1), GasUsed: big.NewInt(0)}
+
+	var overrides *BlockOverrides
+	if have := overrides.Apply(header); have != header {
+		t.Errorf("nil overrides copied the header")
+	}
+	coinbase := common.Address{0x02}
+	overrides = &BlockOverrides{
+		Number:   (*hexutil.Big)(big.NewInt(20)),
+		Coinbase: &coinbase,
+		BaseFee:  (*hexutil.Big)(big.NewInt(7)),
+	}
+	have := overrides.Apply(header)
+	if have.Number.Int64() != 20 || have.Time.Int64() != 100 || have.Coinbase != coinbase || have.BaseFee.Int64() != 7 {
+		t.Errorf("overridden header mismatch: number %v, time %v, coinbase %x, base fee %v", have.Number, have.Time, have.Coinbase, have.BaseFee)
+	}
+	if header.Number.Int64() != 10 || header.Coinbase != (common.Address{0x01}) || header.BaseFee != nil {
+		t.Errorf("original header modified: number %v, coinbase %x, base fee %v", header.Number, header.Coinbase, header.BaseFee)
+	}
+}
+
+// missingStateBackend is a backend knowing the headers of a chain, but not the
+// states past its head.
+type missingStateBackend struct {
+	Backend
+	head uint64
+}
+
+func (b *missingStateBackend) StateAndHeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*state.StateDB, *types.Header, error) {
+	if uint64(blockNr) > b.head {
+		return nil, nil, nil
+	}
+	header := &types.Header{Number: big.NewInt(int64(blockNr)), Root: common.Hash{0x01}}
+	return nil, header, &trie.MissingNodeError{NodeHash: header.Root}
+}
+
+// Tests that calls on unknown blocks or pruned states fail instead of silently
+// returning empty results.
+func TestCallStateUnavailable(t *testing.T) {
+	backend := &missingStateBackend{head: 10}
+
+	if _, _, err := callState(context.Background(), backend, 11); err == nil || err.Error() != "block #11 not found" {
+		t.Errorf("unknown block error mismatch: %v", err)
+	}
+	if _, _, err := callState(context.Background(), backend, 5); err == nil || !strings.Contains(err.Error(), "state of block #5 is not available") {
+		t.Errorf("pruned state error mismatch: %v", err)
+	}
+}
+
+// Tests that signers are recovered from both prefixed messages and EIP-712 typed
+// data, without mutating the provided signature.
+func TestEcRecover(t *testing.T) {
+	var (
+		key, _ = crypto.GenerateKey()
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		api    = new(PrivateAccountAPI)
+	)
+	data := accounts.TypedData{
+		Types: map[string][]accounts.TypedDataField{
+			"EIP712Domain": {{Name: "name", Type: "string"}},
+			"Note":         {{Name: "text", Type: "string"}},
+		},
+		PrimaryType: "Note",
+		Domain:      map[string]interface{}{"name": "test"},
+		Message:     map[string]interface{}{"text": "hello"},
+	}
+	hash, err := accounts.TypedDataHash(&data)
+	if err != nil {
+		t.Fatalf("failed to hash typed data: %v", err)
+	}
+	msg := hexutil.Bytes("hello")
+	for i, digest := range [][]byte{signHash(msg), hash[:]} {
+		sig, err := crypto.Sign(digest, key)
+		if err != nil {
+			t.Fatalf("test %d: failed to sign: %v", i, err)
+		}
+		sig[64] += 27
+
+		var have common.Address
+		if i == 0 {
+			have, err = api.EcRecover(context.Background(), msg, sig)
+		} else {
+			have, err = api.EcRecoverTypedData(context.Background(), data, sig)
+		}
+		if err != nil {
+			t.Fatalf("test %d: failed to recover signer: %v", i, err)
+		}
+		if have != addr {
+			t.Errorf("test %d: signer mismatch: have %x, want %x", i, have, addr)
+		}
+		if sig[64] != 27 && sig[64] != 28 {
+			t.Errorf("test %d: signature mutated: V = %d", i, sig[64])
+		}
+	}
+}
@@ -212,12 +212,19 @@ type JavascriptTracer struct {
 	dbvalue       otto.Value             // JS view of `db`
 	contract      *contractWrapper       // Wrapper around the contract object
 	contractvalue otto.Value             // JS view of `contract`
+	ctx           map[string]interface{} // Transaction context gathered throughout execution
+	ctxvalue      otto.Value             // JS view of `ctx`
+	hasFault      bool                   // Whether the tracer exposes a fault() function
+	hasEnter      bool                   // Whether the tracer exposes an enter() function
+	hasExit       bool                   // Whether the tracer exposes an exit() function
 	err           error                  // Error, if one has occurred
 }
 
 // NewJavascriptTracer instantiates a new JavascriptTracer instance.
 // code specifies a Javascript snippet, which must evaluate to an expression
-// returning an object with 'step' and 'result' functions.
+// returning an object with 'step' and 'result' functions, and optionally a
+// 'fault' function invoked for failing steps in place of 'step', as well as
+// 'enter' and 'exit' functions invoked around nested call frames.
 func NewJavascriptTracer(code string) (*JavascriptTracer, error) {
 	vm := otto.New()
 	vm.Interrupt = make(chan func(), 1)
@@ -247,11 +254,29 @@ func NewJavascriptTracer(code string) (*JavascriptTracer, error) {
 	if !result.IsFunction() {
 		return nil, fmt.Errorf("Trace object must expose a function result()")
 	}
+	fault, err := jstracer.Get("fault")
+	if err != nil {
+		return nil, err
+	}
+	enter, err := jstracer.Get("enter")
+	if err != nil {
+		return nil, err
+	}
+	exit, err := jstracer.Get("exit")
+	if err != nil {
+		return nil, err
+	}
+	if enter.IsFunction() != exit.IsFunction() {
+		return nil, fmt.Errorf("Trace object must expose either both or none of enter() and exit()")
+	}
 
-	// Create the persistent log object
+	// Create the persistent log and context objects
 	log := make(map[string]interface{})
 	logvalue, _ := vm.ToValue(log)
 
+	ctx := make(map[string]interface{})
+	ctxvalue, _ := vm.ToValue(ctx)
+
 	// Create persistent wrappers for memory and stack
 	mem := &memoryWrapper{}
 	stack := &stackWrapper{}
@@ -271,6 +296,11 @@ func NewJavascriptTracer(code string) (*JavascriptTracer, error) {
 		dbvalue:       db.toValue(vm),
 		contract:      contract,
 		contractvalue: contract.toValue(vm),
+		ctx:           ctx,
+		ctxvalue:      ctxvalue,
+		hasFault:      fault.IsFunction(),
+		hasEnter:      enter.IsFunction(),
+		hasExit:       exit.IsFunction(),
 		err:           nil,
 	}, nil
 }
@@ -316,8 +346,41 @@ func wrapError(context string, err error) error {
 	return fmt.Errorf("%v    in server-side tracer function '%v'", message, context)
 }
 
+// CaptureStart implements the Tracer interface to record the transaction context
+// of the outermost call frame.
+func (jst *JavascriptTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	jst.ctx["type"] = "CALL"
+	if create {
+		jst.ctx["type"] = "CREATE"
+	}
+	jst.ctx["from"] = from
+	jst.ctx["to"] = to
+	jst.ctx["input"] = input
+	jst.ctx["gas"] = gas
+	jst.ctx["gasPrice"] = env.GasPrice
+	jst.ctx["value"] = value
+	jst.ctx["block"] = env.BlockNumber
+	return nil
+}
+
 // CaptureState implements the Tracer interface to trace a single step of VM execution
 func (jst *JavascriptTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	return jst.captureStep("step", env, pc, op, gas, cost, memory, stack, contract, depth, err)
+}
+
+// CaptureFault implements the Tracer interface to trace a failed step of VM
+// execution, calling the tracer's fault function if any, its step function
+// otherwise.
+func (jst *JavascriptTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	method := "step"
+	if jst.hasFault {
+		method = "fault"
+	}
+	return jst.captureStep(method, env, pc, op, gas, cost, memory, stack, contract, depth, err)
+}
+
+// captureStep exposes the VM state to the tracer and calls the given method of it.
+func (jst *JavascriptTracer) captureStep(method string, env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
 	if jst.err == nil {
 		jst.memory.memory = memory
 		jst.stack.stack = stack
@@ -337,17 +400,61 @@ func (jst *JavascriptTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode,
 		jst.log["account"] = contract.Address()
 		jst.log["err"] = err
 
-		_, err := jst.callSafely("step", jst.logvalue, jst.dbvalue)
+		_, err := jst.callSafely(method, jst.logvalue, jst.dbvalue)
 		if err != nil {
-			jst.err = wrapError("step", err)
+			jst.err = wrapError(method, err)
 		}
 	}
 	return nil
 }
 
-// CaptureEnd is called after the call finishes
-func (jst *JavascriptTracer) CaptureEnd(output []byte, gasUsed uint64, t time.Duration) error {
-	//TODO! @Arachnid please figure out of there's anything we can use this method for
+// CaptureEnter implements the Tracer interface, calling the tracer's enter
+// function, if any, when a nested call frame is entered.
+func (jst *JavascriptTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	if jst.err != nil || !jst.hasEnter {
+		return nil
+	}
+	frame := map[string]interface{}{
+		"type":  typ.String(),
+		"from":  from,
+		"to":    to,
+		"input": input,
+		"gas":   gas,
+		"value": value,
+	}
+	if _, err := jst.callSafely("enter", frame); err != nil {
+		jst.err = wrapError("enter", err)
+	}
+	return nil
+}
+
+// CaptureExit implements the Tracer interface, calling the tracer's exit
+// function, if any, when a nested call frame returns.
+func (jst *JavascriptTracer) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	if jst.err != nil || !jst.hasExit {
+		return nil
+	}
+	frame := map[string]interface{}{
+		"output":  output,
+		"gasUsed": gasUsed,
+	}
+	if err != nil {
+		frame["error"] = err.Error()
+	}
+	if _, err := jst.callSafely("exit", frame); err != nil {
+		jst.err = wrapError("exit", err)
+	}
+	return nil
+}
+
+// CaptureEnd is called after the call finishes to complete the transaction context.
+func (jst *JavascriptTracer) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
+	jst.ctx["output"] = output
+	jst.ctx["gasUsed"] = gasUsed
+	jst.ctx["time"] = t.String()
+	if err != nil {
+		jst.ctx["error"] = err.Error()
+	}
 	return nil
 }
 
@@ -357,7 +464,7 @@ func (jst *JavascriptTracer) GetResult() (result interface{}, err error) {
 		return nil, jst.err
 	}
 
-	result, err = jst.callSafely("result")
+	result, err = jst.callSafely("result", jst.ctxvalue, jst.dbvalue)
 	if err != nil {
 		err = wrapError("result", err)
 	}
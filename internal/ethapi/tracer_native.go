@@ -0,0 +1,381 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Tracer is a vm.EVMLogger whose result can be retrieved once the traced execution
+// finished, and which can be stopped from another goroutine, e.g. on timeout.
+type Tracer interface {
+	vm.EVMLogger
+
+	// GetResult returns the result of the trace, or the error it failed with.
+	GetResult() (interface{}, error)
+
+	// Stop terminates the trace, GetResult returns err afterwards.
+	Stop(err error)
+}
+
+// nativeTracers are the tracers implemented in Go, which can be requested by
+// name in place of JavaScript tracer code.
+var nativeTracers = map[string]func() Tracer{
+	"callTracer":     newCallTracer,
+	"prestateTracer": newPrestateTracer,
+	"4byteTracer":    newFourByteTracer,
+}
+
+// NewTracer creates the tracer identified by code: the native tracer of that
+// name if there is one, a JavaScript tracer evaluating code otherwise.
+func NewTracer(code string) (Tracer, error) {
+	if ctor, ok := nativeTracers[code]; ok {
+		return ctor(), nil
+	}
+	tracer, err := NewJavascriptTracer(code)
+	if err != nil {
+		return nil, err
+	}
+	return tracer, nil
+}
+
+// interruptible implements stopping a native tracer. Tracers embedding it must
+// ignore further events once stopped.
+type interruptible struct {
+	interrupt uint32 // Atomic flag signalling the tracer was stopped
+	reason    error  // Reason of the stop, reported as the trace error
+}
+
+// Stop terminates the trace, reporting err as its result.
+func (i *interruptible) Stop(err error) {
+	i.reason = err
+	atomic.StoreUint32(&i.interrupt, 1)
+}
+
+// stopped returns whether the tracer was stopped.
+func (i *interruptible) stopped() bool {
+	return atomic.LoadUint32(&i.interrupt) == 1
+}
+
+// callFrame is a single call frame reported by the call tracer.
+type callFrame struct {
+	Type    string         `json:"type"`
+	From    common.Address `json:"from"`
+	To      common.Address `json:"to"`
+	Value   *hexutil.Big   `json:"value,omitempty"`
+	Gas     hexutil.Uint64 `json:"gas"`
+	GasUsed hexutil.Uint64 `json:"gasUsed"`
+	Input   hexutil.Bytes  `json:"input"`
+	Output  hexutil.Bytes  `json:"output,omitempty"`
+	Error   string         `json:"error,omitempty"`
+	Calls   []callFrame    `json:"calls,omitempty"`
+}
+
+// newCallFrame creates a call frame, copying the VM owned input and value.
+func newCallFrame(typ string, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) callFrame {
+	frame := callFrame{
+		Type:  typ,
+		From:  from,
+		To:    to,
+		Gas:   hexutil.Uint64(gas),
+		Input: common.CopyBytes(input),
+	}
+	if value != nil {
+		frame.Value = (*hexutil.Big)(new(big.Int).Set(value))
+	}
+	return frame
+}
+
+// finish records the outcome of the call frame.
+func (f *callFrame) finish(output []byte, gasUsed uint64, err error) {
+	f.GasUsed = hexutil.Uint64(gasUsed)
+	f.Output = common.CopyBytes(output)
+	if err != nil {
+		f.Error = err.Error()
+		f.Output = nil
+	}
+}
+
+// callTracer reports the tree of calls made by the traced execution.
+type callTracer struct {
+	interruptible
+	callstack []callFrame
+}
+
+func newCallTracer() Tracer {
+	return &callTracer{}
+}
+
+// CaptureStart implements vm.EVMLogger, opening the outermost call frame.
+func (t *callTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	typ := vm.CALL
+	if create {
+		typ = vm.CREATE
+	}
+	t.callstack = []callFrame{newCallFrame(typ.String(), from, to, input, gas, value)}
+	return nil
+}
+
+// CaptureState implements vm.EVMLogger, individual steps are not reported.
+func (t *callTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureFault implements vm.EVMLogger, failures are reported by the call frames.
+func (t *callTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnter implements vm.EVMLogger, opening a nested call frame.
+func (t *callTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	if t.stopped() {
+		return nil
+	}
+	t.callstack = append(t.callstack, newCallFrame(typ.String(), from, to, input, gas, value))
+	return nil
+}
+
+// CaptureExit implements vm.EVMLogger, closing the innermost call frame and
+// attaching it to its parent.
+func (t *callTracer) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	if t.stopped() || len(t.callstack) <= 1 {
+		return nil
+	}
+	frame := t.callstack[len(t.callstack)-1]
+	frame.finish(output, gasUsed, err)
+
+	t.callstack = t.callstack[:len(t.callstack)-1]
+	parent := &t.callstack[len(t.callstack)-1]
+	parent.Calls = append(parent.Calls, frame)
+	return nil
+}
+
+// CaptureEnd implements vm.EVMLogger, closing the outermost call frame.
+func (t *callTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	if t.stopped() || len(t.callstack) != 1 {
+		return nil
+	}
+	t.callstack[0].finish(output, gasUsed, err)
+	return nil
+}
+
+// GetResult returns the outermost call frame with all its nested calls.
+func (t *callTracer) GetResult() (interface{}, error) {
+	if t.stopped() {
+		return nil, t.reason
+	}
+	if len(t.callstack) != 1 {
+		return nil, errors.New("incorrect number of top-level calls")
+	}
+	return t.callstack[0], nil
+}
+
+// prestateAccount is the state of an account before the traced execution.
+type prestateAccount struct {
+	Balance *hexutil.Big                `json:"balance"`
+	Nonce   uint64                      `json:"nonce"`
+	Code    hexutil.Bytes               `json:"code"`
+	Storage map[common.Hash]common.Hash `json:"storage"`
+}
+
+// prestateTracer reports the state, prior to the traced execution, of all the
+// accounts and storage slots the execution touched.
+type prestateTracer struct {
+	interruptible
+	env      *vm.EVM
+	prestate map[common.Address]*prestateAccount
+}
+
+func newPrestateTracer() Tracer {
+	return &prestateTracer{prestate: make(map[common.Address]*prestateAccount)}
+}
+
+// CaptureStart implements vm.EVMLogger, recording the sender and recipient. By this
+// time the sender already prepaid the gas and had its nonce increased, which is
+// undone in the reported state. Access list costs are not accounted for.
+func (t *prestateTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	t.env = env
+
+	t.lookupAccount(from)
+	intrinsic := core.IntrinsicGas(input, nil, create, env.ChainConfig().IsHomestead(env.BlockNumber))
+	if env.GasPrice != nil {
+		fee := new(big.Int).Add(intrinsic, new(big.Int).SetUint64(gas))
+		fee.Mul(fee, env.GasPrice)
+
+		sender := t.prestate[from]
+		sender.Balance = (*hexutil.Big)(new(big.Int).Add(sender.Balance.ToInt(), fee))
+	}
+	if t.prestate[from].Nonce > 0 {
+		t.prestate[from].Nonce--
+	}
+	if !create {
+		t.lookupAccount(to)
+	}
+	return nil
+}
+
+// CaptureState implements vm.EVMLogger, recording the accounts and storage slots
+// accessed by the executed operation.
+func (t *prestateTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if t.stopped() || err != nil {
+		return nil
+	}
+	size := len(stack.Data())
+	switch {
+	case (op == vm.SLOAD || op == vm.SSTORE) && size >= 1:
+		t.lookupStorage(contract.Address(), common.BigToHash(stack.Back(0)))
+	case (op == vm.BALANCE || op == vm.EXTCODESIZE || op == vm.EXTCODECOPY || op == vm.SELFDESTRUCT) && size >= 1:
+		t.lookupAccount(common.BigToAddress(stack.Back(0)))
+	case (op == vm.CALL || op == vm.CALLCODE || op == vm.DELEGATECALL) && size >= 2:
+		t.lookupAccount(common.BigToAddress(stack.Back(1)))
+	case op == vm.CREATE:
+		t.lookupAccount(crypto.CreateAddress(contract.Address(), env.StateDB.GetNonce(contract.Address())))
+	}
+	return nil
+}
+
+// CaptureFault implements vm.EVMLogger, failed operations touch no state.
+func (t *prestateTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnter implements vm.EVMLogger, accounts are recorded by the operations.
+func (t *prestateTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureExit implements vm.EVMLogger, accounts are recorded by the operations.
+func (t *prestateTracer) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	return nil
+}
+
+// CaptureEnd implements vm.EVMLogger, accounts are recorded by the operations.
+func (t *prestateTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	return nil
+}
+
+// GetResult returns the recorded accounts.
+func (t *prestateTracer) GetResult() (interface{}, error) {
+	if t.stopped() {
+		return nil, t.reason
+	}
+	return t.prestate, nil
+}
+
+// lookupAccount records the current state of the account, unless it was
+// recorded already.
+func (t *prestateTracer) lookupAccount(addr common.Address) {
+	if _, ok := t.prestate[addr]; ok {
+		return
+	}
+	t.prestate[addr] = &prestateAccount{
+		Balance: (*hexutil.Big)(new(big.Int).Set(t.env.StateDB.GetBalance(addr))),
+		Nonce:   t.env.StateDB.GetNonce(addr),
+		Code:    common.CopyBytes(t.env.StateDB.GetCode(addr)),
+		Storage: make(map[common.Hash]common.Hash),
+	}
+}
+
+// lookupStorage records the current value of the storage slot, unless it was
+// recorded already.
+func (t *prestateTracer) lookupStorage(addr common.Address, key common.Hash) {
+	t.lookupAccount(addr)
+	if _, ok := t.prestate[addr].Storage[key]; ok {
+		return
+	}
+	t.prestate[addr].Storage[key] = t.env.StateDB.GetState(addr, key)
+}
+
+// fourByteTracer counts the 4 byte method identifiers, along with the size of
+// the supplied arguments, of all the calls made by the traced execution.
+type fourByteTracer struct {
+	interruptible
+	env *vm.EVM
+	ids map[string]int
+}
+
+func newFourByteTracer() Tracer {
+	return &fourByteTracer{ids: make(map[string]int)}
+}
+
+// store counts the method identifier the input starts with, if any.
+func (t *fourByteTracer) store(input []byte) {
+	if len(input) < 4 {
+		return
+	}
+	t.ids[fmt.Sprintf("%s-%d", hexutil.Encode(input[:4]), len(input)-4)]++
+}
+
+// CaptureStart implements vm.EVMLogger, counting the identifier of the outermost call.
+func (t *fourByteTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	t.env = env
+	if !create {
+		t.store(input)
+	}
+	return nil
+}
+
+// CaptureState implements vm.EVMLogger, individual steps are not inspected.
+func (t *fourByteTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureFault implements vm.EVMLogger, individual steps are not inspected.
+func (t *fourByteTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnter implements vm.EVMLogger, counting the identifiers of nested calls
+// into contracts other than the precompiled ones.
+func (t *fourByteTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	if t.stopped() || (typ != vm.CALL && typ != vm.CALLCODE && typ != vm.DELEGATECALL) {
+		return nil
+	}
+	if t.env != nil && t.env.IsPrecompile(to) {
+		return nil
+	}
+	t.store(input)
+	return nil
+}
+
+// CaptureExit implements vm.EVMLogger, only call inputs are inspected.
+func (t *fourByteTracer) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	return nil
+}
+
+// CaptureEnd implements vm.EVMLogger, only call inputs are inspected.
+func (t *fourByteTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	return nil
+}
+
+// GetResult returns the method identifier counts.
+func (t *fourByteTracer) GetResult() (interface{}, error) {
+	if t.stopped() {
+		return nil, t.reason
+	}
+	return t.ids, nil
+}
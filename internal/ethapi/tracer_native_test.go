@@ -0,0 +1,165 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	traceSender = common.HexToAddress("0x000000000000000000000000000000000000aaaa")
+	traceCaller = common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	traceCallee = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+)
+
+// runNestedTrace executes a call into a contract which loads storage slot 1 and
+// calls another contract with the method identifier 0x12345678, with the given
+// tracer attached.
+func runNestedTrace(t *testing.T, tracer vm.EVMLogger) {
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	statedb.SetBalance(traceSender, big.NewInt(1000000))
+	statedb.SetCode(traceCaller, []byte{
+		byte(vm.PUSH1), 0x01, byte(vm.SLOAD), byte(vm.POP),
+		byte(vm.PUSH4), 0x12, 0x34, 0x56, 0x78, byte(vm.PUSH1), 0x00, byte(vm.MSTORE),
+		byte(vm.PUSH1), 0x00, byte(vm.PUSH1), 0x00, // out size and offset
+		byte(vm.PUSH1), 0x04, byte(vm.PUSH1), 0x1c, // in size and offset
+		byte(vm.PUSH1), 0x00, byte(vm.PUSH1), 0xbb, byte(vm.PUSH2), 0xff, 0xff, // value, address and gas
+		byte(vm.CALL), byte(vm.STOP),
+	})
+	statedb.SetState(traceCaller, common.BigToHash(big.NewInt(1)), common.BigToHash(big.NewInt(42)))
+	statedb.SetCode(traceCallee, []byte{byte(vm.STOP)})
+
+	context := vm.Context{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		BlockNumber: big.NewInt(1),
+		Time:        big.NewInt(0),
+		Difficulty:  big.NewInt(0),
+		GasLimit:    big.NewInt(8000000),
+		GasPrice:    big.NewInt(1),
+	}
+	env := vm.NewEVM(context, statedb, params.TestChainConfig, vm.Config{Debug: true, Tracer: tracer})
+	if _, _, err := env.Call(vm.AccountRef(traceSender), traceCaller, []byte{0xaa, 0xbb, 0xcc, 0xdd, 0x00}, 100000, new(big.Int)); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+}
+
+func TestCallTracer(t *testing.T) {
+	tracer, err := NewTracer("callTracer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runNestedTrace(t, tracer)
+
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := res.(callFrame)
+	if frame.Type != "CALL" || frame.From != traceSender || frame.To != traceCaller {
+		t.Errorf("outer frame mismatch: have %s %x -> %x", frame.Type, frame.From, frame.To)
+	}
+	if frame.GasUsed == 0 {
+		t.Errorf("outer frame used no gas")
+	}
+	if len(frame.Calls) != 1 {
+		t.Fatalf("nested call count mismatch: have %d, want %d", len(frame.Calls), 1)
+	}
+	inner := frame.Calls[0]
+	if inner.Type != "CALL" || inner.From != traceCaller || inner.To != traceCallee {
+		t.Errorf("inner frame mismatch: have %s %x -> %x", inner.Type, inner.From, inner.To)
+	}
+	if want := []byte{0x12, 0x34, 0x56, 0x78}; !reflect.DeepEqual([]byte(inner.Input), want) {
+		t.Errorf("inner frame input mismatch: have %x, want %x", inner.Input, want)
+	}
+}
+
+func TestFourByteTracer(t *testing.T) {
+	tracer, err := NewTracer("4byteTracer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runNestedTrace(t, tracer)
+
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"0xaabbccdd-1": 1, "0x12345678-0": 1}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("identifiers mismatch: have %v, want %v", res, want)
+	}
+}
+
+func TestPrestateTracer(t *testing.T) {
+	tracer, err := NewTracer("prestateTracer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runNestedTrace(t, tracer)
+
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prestate := res.(map[common.Address]*prestateAccount)
+	for _, addr := range []common.Address{traceSender, traceCaller, traceCallee} {
+		if _, ok := prestate[addr]; !ok {
+			t.Errorf("account %x missing from prestate", addr)
+		}
+	}
+	if have, want := prestate[traceCaller].Storage[common.BigToHash(big.NewInt(1))], common.BigToHash(big.NewInt(42)); have != want {
+		t.Errorf("storage slot mismatch: have %x, want %x", have, want)
+	}
+	if have, want := prestate[traceCallee].Code, []byte{byte(vm.STOP)}; !reflect.DeepEqual([]byte(have), want) {
+		t.Errorf("code mismatch: have %x, want %x", have, want)
+	}
+}
+
+func TestJavascriptTracerFrames(t *testing.T) {
+	tracer, err := NewTracer(`{
+		calls: [],
+		step: function() {},
+		enter: function(frame) { this.calls.push(frame.type + " " + toHex(frame.input)); },
+		exit: function(frame) {},
+		result: function(ctx) { return [ctx.type].concat(this.calls); }
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runNestedTrace(t, tracer)
+
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"CALL", "CALL 0x12345678"}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("result mismatch: have %#v, want %#v", res, want)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"github.com/ethereum/go-ethereum/light"
+)
+
+const (
+	// bloomServiceThreads is the number of goroutines used globally by a light
+	// client to service bloombits lookups for all running filters.
+	bloomServiceThreads = 16
+
+	// bloomRetrievalBatch is the maximum number of sections a filter filters in
+	// one batch. It must not exceed the number of bloom trie proofs a server is
+	// willing to serve in a single request.
+	bloomRetrievalBatch = 16
+)
+
+// startBloomHandlers starts a batch of goroutines to accept bloom bit retrievals
+// from possibly a range of filters, retrieving the bit vectors via ODR from the
+// light servers and proving them against the trusted bloom trie.
+func (eth *LightEthereum) startBloomHandlers() {
+	for i := 0; i < bloomServiceThreads; i++ {
+		go func() {
+			for {
+				select {
+				case <-eth.shutdownChan:
+					return
+
+				case request := <-eth.bloomRequests:
+					task := <-request
+					task.Bitsets, task.Error = light.GetBloomBits(task.Context, eth.odr, uint64(task.Bit), task.Sections)
+					request <- task
+				}
+			}
+		}()
+	}
+}
@@ -398,8 +398,14 @@ func (f *lightFetcher) nextRequest() (*distReq, uint64) {
 	bestSyncing := false
 
 	for p, fp := range f.peers {
+		if !f.trustedPeer(p) {
+			continue
+		}
 		for hash, n := range fp.nodeByHash {
 			if !f.checkKnownNode(p, n) && !n.requested && (bestTd == nil || n.td.Cmp(bestTd) >= 0) {
+				if f.pm.ulc != nil && !f.pm.ulc.enoughVotes(f.trustedVotes(hash)) {
+					continue
+				}
 				amount := f.requestAmount(p, n)
 				if bestTd == nil || n.td.Cmp(bestTd) > 0 || amount < bestAmount {
 					bestHash = hash
@@ -426,7 +432,7 @@ func (f *lightFetcher) nextRequest() (*distReq, uint64) {
 			canSend: func(dp distPeer) bool {
 				p := dp.(*peer)
 				fp := f.peers[p]
-				return fp != nil && fp.nodeByHash[bestHash] != nil
+				return fp != nil && fp.nodeByHash[bestHash] != nil && f.trustedPeer(p)
 			},
 			request: func(dp distPeer) func() {
 				go func() {
@@ -450,7 +456,7 @@ func (f *lightFetcher) nextRequest() (*distReq, uint64) {
 				defer f.lock.Unlock()
 
 				fp := f.peers[p]
-				if fp == nil {
+				if fp == nil || !f.trustedPeer(p) {
 					return false
 				}
 				n := fp.nodeByHash[bestHash]
@@ -484,6 +490,24 @@ func (f *lightFetcher) nextRequest() (*distReq, uint64) {
 	return rq, reqID
 }
 
+// trustedPeer returns whether the announcements of a peer may be acted upon. In
+// ultra light client mode only the trusted servers qualify, otherwise all peers.
+func (f *lightFetcher) trustedPeer(p *peer) bool {
+	return f.pm.ulc == nil || f.pm.ulc.trusted(p.ID())
+}
+
+// trustedVotes returns the number of trusted servers that announced the given
+// block hash.
+func (f *lightFetcher) trustedVotes(hash common.Hash) int {
+	var votes int
+	for p, fp := range f.peers {
+		if f.pm.ulc.trusted(p.ID()) && fp.nodeByHash[hash] != nil {
+			votes++
+		}
+	}
+	return votes
+}
+
 // deliverHeaders delivers header download request responses for processing
 func (f *lightFetcher) deliverHeaders(peer *peer, reqID uint64, headers []*types.Header) {
 	f.deliverChn <- fetchResponse{reqID: reqID, headers: headers, peer: peer}
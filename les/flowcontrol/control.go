@@ -39,14 +39,17 @@ type ClientNode struct {
 	cmNode   *cmNode
 }
 
-func NewClientNode(cm *ClientManager, params *ServerParams) *ClientNode {
+// NewClientNode creates the server side flow control state of a client. Requests
+// of prioritized clients are served first if the server is at full capacity, and
+// they recharge faster relative to regular ones.
+func NewClientNode(cm *ClientManager, params *ServerParams, priority bool) *ClientNode {
 	node := &ClientNode{
 		cm:       cm,
 		params:   params,
 		bufValue: params.BufLimit,
 		lastTime: mclock.Now(),
 	}
-	node.cmNode = cm.addNode(node)
+	node.cmNode = cm.addNode(node, priority)
 	return node
 }
 
@@ -26,10 +26,15 @@ import (
 
 const rcConst = 1000000
 
+// priorityWeight is the recharge weight of prioritized (trusted or paying)
+// client nodes, relative to the weight of regular ones.
+const priorityWeight = 4
+
 type cmNode struct {
 	node                         *ClientNode
 	lastUpdate                   mclock.AbsTime
 	serving, recharging          bool
+	priority                     bool
 	rcWeight                     uint64
 	rcValue, rcDelta, startValue int64
 	finishRecharge               mclock.AbsTime
@@ -74,16 +79,18 @@ type ClientManager struct {
 	maxSimReq, maxRcSum              uint64
 	rcRecharge                       uint64
 	resumeQueue                      chan chan bool
+	priorityQueue                    chan chan bool
 	time                             mclock.AbsTime
 }
 
 func NewClientManager(rcTarget, maxSimReq, maxRcSum uint64) *ClientManager {
 	cm := &ClientManager{
-		nodes:       make(map[*cmNode]struct{}),
-		resumeQueue: make(chan chan bool),
-		rcRecharge:  rcConst * rcConst / (100*rcConst/rcTarget - rcConst),
-		maxSimReq:   maxSimReq,
-		maxRcSum:    maxRcSum,
+		nodes:         make(map[*cmNode]struct{}),
+		resumeQueue:   make(chan chan bool),
+		priorityQueue: make(chan chan bool),
+		rcRecharge:    rcConst * rcConst / (100*rcConst/rcTarget - rcConst),
+		maxSimReq:     maxSimReq,
+		maxRcSum:      maxRcSum,
 	}
 	go cm.queueProc()
 	return cm
@@ -96,16 +103,21 @@ func (self *ClientManager) Stop() {
 	// signal any waiting accept routines to return false
 	self.nodes = make(map[*cmNode]struct{})
 	close(self.resumeQueue)
+	close(self.priorityQueue)
 }
 
-func (self *ClientManager) addNode(cnode *ClientNode) *cmNode {
+func (self *ClientManager) addNode(cnode *ClientNode, priority bool) *cmNode {
 	time := mclock.Now()
 	node := &cmNode{
 		node:           cnode,
 		lastUpdate:     time,
 		finishRecharge: time,
+		priority:       priority,
 		rcWeight:       1,
 	}
+	if priority {
+		node.rcWeight = priorityWeight
+	}
 	self.lock.Lock()
 	defer self.lock.Unlock()
 
@@ -168,8 +180,25 @@ func (self *ClientManager) canStartReq() bool {
 	return self.simReqCnt < self.maxSimReq && self.rcSumValue < self.maxRcSum
 }
 
+// queueProc resumes the requests waiting for the server to have free capacity,
+// always preferring the ones of prioritized nodes over regular ones.
 func (self *ClientManager) queueProc() {
-	for rc := range self.resumeQueue {
+	for {
+		var (
+			rc chan bool
+			ok bool
+		)
+		select {
+		case rc, ok = <-self.priorityQueue:
+		default:
+			select {
+			case rc, ok = <-self.priorityQueue:
+			case rc, ok = <-self.resumeQueue:
+			}
+		}
+		if !ok {
+			return
+		}
 		for {
 			time.Sleep(time.Millisecond * 10)
 			self.lock.Lock()
@@ -190,9 +219,13 @@ func (self *ClientManager) accept(node *cmNode, time mclock.AbsTime) bool {
 
 	self.update(time)
 	if !self.canStartReq() {
+		queue := self.resumeQueue
+		if node.priority {
+			queue = self.priorityQueue
+		}
 		resume := make(chan bool)
 		self.lock.Unlock()
-		self.resumeQueue <- resume
+		queue <- resume
 		<-resume
 		self.lock.Lock()
 		if _, ok := self.nodes[node]; !ok {
@@ -17,17 +17,21 @@
 package les
 
 import (
+	"bytes"
 	"math/rand"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/bitutil"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/les/flowcontrol"
+	"github.com/ethereum/go-ethereum/light"
 	"github.com/ethereum/go-ethereum/p2p"
-	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/p2p/discover"
 	"github.com/ethereum/go-ethereum/trie"
 )
 
@@ -316,7 +320,7 @@ func testGetProofs(t *testing.T, protocol int) {
 	defer peer.close()
 
 	var proofreqs []ProofReq
-	var proofs [][]rlp.RawValue
+	var proofs proofsData
 
 	accounts := []common.Address{testBankAddress, acc1Addr, acc2Addr, {}}
 	for i := uint64(0); i <= bc.CurrentBlock().NumberU64(); i++ {
@@ -331,7 +335,8 @@ func testGetProofs(t *testing.T, protocol int) {
 			}
 			proofreqs = append(proofreqs, req)
 
-			proof := trie.Prove(crypto.Keccak256(acc[:]))
+			var proof light.NodeList
+			trie.Prove(crypto.Keccak256(acc[:]), 0, &proof)
 			proofs = append(proofs, proof)
 		}
 	}
@@ -342,3 +347,119 @@ func testGetProofs(t *testing.T, protocol int) {
 		t.Errorf("proofs mismatch: %v", err)
 	}
 }
+
+// Tests that bloom trie proofs can be retrieved for the bloom bits of sections.
+func TestGetBloomBitsProofsLes2(t *testing.T) { testGetBloomBitsProofs(t, 2) }
+
+func testGetBloomBitsProofs(t *testing.T, protocol int) {
+	// Assemble the test environment
+	db, _ := ethdb.NewMemDatabase()
+	pm := newTestProtocolManagerMust(t, false, 4, testChainGen, nil, nil, db)
+	peer, _ := newTestPeer(t, "peer", protocol, pm, true)
+	defer peer.close()
+
+	// Create a bloom trie with a distinct bit vector for every bloom bit
+	vectors := make([][]byte, MaxBloomProofsFetch)
+	bloomTrie, _ := trie.New(common.Hash{}, db)
+	for i := range vectors {
+		vectors[i] = make([]byte, light.BloomTrieFrequency/8)
+		if i > 0 {
+			vectors[i][i] = byte(i)
+		}
+		bloomTrie.Update(light.BloomTrieKey(uint64(i), 0), bitutil.CompressBytes(vectors[i]))
+	}
+	root, _ := bloomTrie.Commit()
+	light.StoreBloomTrieRoot(db, 1, root)
+
+	// Collect the proofs to request, and the response to expect
+	var (
+		bloomreqs []BloomReq
+		proofs    proofsData
+	)
+	for i := range vectors {
+		bloomreqs = append(bloomreqs, BloomReq{BloomTrieNum: 1, BitIdx: uint64(i)})
+
+		var proof light.NodeList
+		bloomTrie.Prove(light.BloomTrieKey(uint64(i), 0), 0, &proof)
+		proofs = append(proofs, proof)
+	}
+	// Send the proof request and verify the response
+	cost := peer.GetRequestCost(GetBloomBitsProofsMsg, len(bloomreqs))
+	sendRequest(peer.app, GetBloomBitsProofsMsg, 42, cost, bloomreqs)
+	if err := expectResponse(peer.app, BloomBitsProofsMsg, 42, testBufLimit, proofs); err != nil {
+		t.Errorf("proofs mismatch: %v", err)
+	}
+	// Verify that the proofs validate against the bloom trie on the client side
+	for i := range vectors {
+		req := &BloomRequest{BloomTrieNum: 1, BitIdx: uint64(i), SectionIdxList: []uint64{0}, BloomTrieRoot: root}
+		if err := req.Validate(nil, &Msg{MsgType: MsgBloomBitsProofs, Obj: []light.NodeList{proofs[i]}}); err != nil {
+			t.Fatalf("bit %d: failed to validate proof: %v", i, err)
+		}
+		if !bytes.Equal(req.BloomBits[0], vectors[i]) {
+			t.Errorf("bit %d: bloom bits mismatch", i)
+		}
+		req.BloomTrieRoot = common.Hash{0x01}
+		if err := req.Validate(nil, &Msg{MsgType: MsgBloomBitsProofs, Obj: []light.NodeList{proofs[i]}}); err == nil {
+			t.Errorf("bit %d: proof validated against the wrong root", i)
+		}
+	}
+}
+
+// Tests that priority light clients are granted the priority flow control
+// parameters during the handshake, while regular ones get the defaults.
+func TestPriorityClientHandshake(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	pm := newTestProtocolManagerMust(t, false, 0, nil, nil, nil, db)
+
+	server := pm.server
+	server.priorityParams = &flowcontrol.ServerParams{
+		BufLimit:    testBufLimit * priorityBufFactor,
+		MinRecharge: priorityRechargeFactor,
+	}
+	var trusted discover.NodeID
+	rand.Read(trusted[:])
+	server.priority = map[discover.NodeID]bool{trusted: true}
+
+	for i, prio := range []bool{false, true} {
+		var id discover.NodeID
+		if prio {
+			id = trusted
+		} else {
+			rand.Read(id[:])
+		}
+		want, _ := server.clientParams(id)
+		if prio && want != server.priorityParams || !prio && want != server.defParams {
+			t.Fatalf("test %d: client params mismatch: have %v, want priority %v", i, want, prio)
+		}
+		app, net := p2p.MsgPipe()
+		peer := pm.newPeer(2, NetworkId, p2p.NewPeer(id, "peer", nil), net)
+
+		td, head, genesis := pm.blockchain.Status()
+		headNum := pm.blockchain.CurrentHeader().Number.Uint64()
+
+		errc := make(chan error, 1)
+		go func() { errc <- peer.Handshake(td, head, headNum, genesis, server) }()
+
+		msg, err := app.ReadMsg()
+		if err != nil {
+			t.Fatalf("test %d: status recv: %v", i, err)
+		}
+		var status keyValueList
+		if err := msg.Decode(&status); err != nil {
+			t.Fatalf("test %d: status decode: %v", i, err)
+		}
+		var bufLimit, minRecharge uint64
+		recv := status.decode()
+		if err := recv.get("flowControl/BL", &bufLimit); err != nil {
+			t.Fatalf("test %d: missing buffer limit: %v", i, err)
+		}
+		if err := recv.get("flowControl/MRR", &minRecharge); err != nil {
+			t.Fatalf("test %d: missing recharge rate: %v", i, err)
+		}
+		if bufLimit != want.BufLimit || minRecharge != want.MinRecharge {
+			t.Errorf("test %d: advertised params mismatch: have %d/%d, want %d/%d", i, bufLimit, minRecharge, want.BufLimit, want.MinRecharge)
+		}
+		app.Close()
+		<-errc
+	}
+}
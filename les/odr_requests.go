@@ -24,6 +24,7 @@ import (
 	"fmt"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/bitutil"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -43,6 +44,7 @@ var (
 	errReceiptHashMismatch = errors.New("receipt hash mismatch")
 	errDataHashMismatch    = errors.New("data hash mismatch")
 	errCHTHashMismatch     = errors.New("cht hash mismatch")
+	errInvalidEntryCount   = errors.New("invalid number of response entries")
 )
 
 type LesOdrRequest interface {
@@ -64,6 +66,8 @@ func LesRequest(req light.OdrRequest) LesOdrRequest {
 		return (*CodeRequest)(r)
 	case *light.ChtRequest:
 		return (*ChtRequest)(r)
+	case *light.BloomRequest:
+		return (*BloomRequest)(r)
 	default:
 		return nil
 	}
@@ -215,15 +219,17 @@ func (r *TrieRequest) Validate(db ethdb.Database, msg *Msg) error {
 	if msg.MsgType != MsgProofs {
 		return errInvalidMessageType
 	}
-	proofs := msg.Obj.([][]rlp.RawValue)
+	proofs := msg.Obj.([]light.NodeList)
 	if len(proofs) != 1 {
 		return errMultipleEntries
 	}
+	nodeSet := proofs[0].NodeSet()
+
 	// Verify the proof and store if checks out
-	if _, err := trie.VerifyProof(r.Id.Root, r.Key, proofs[0]); err != nil {
+	if _, err := trie.VerifyProof(r.Id.Root, r.Key, nodeSet); err != nil {
 		return fmt.Errorf("merkle proof verification failed: %v", err)
 	}
-	r.Proof = proofs[0]
+	r.Proof = nodeSet
 	return nil
 }
 
@@ -286,7 +292,7 @@ type ChtReq struct {
 
 type ChtResp struct {
 	Header *types.Header
-	Proof  []rlp.RawValue
+	Proof  light.NodeList
 }
 
 // ODR request type for requesting headers by Canonical Hash Trie, see LesOdrRequest interface
@@ -336,7 +342,8 @@ func (r *ChtRequest) Validate(db ethdb.Database, msg *Msg) error {
 	var encNumber [8]byte
 	binary.BigEndian.PutUint64(encNumber[:], r.BlockNum)
 
-	value, err := trie.VerifyProof(r.ChtRoot, encNumber[:], proof.Proof)
+	nodeSet := proof.Proof.NodeSet()
+	value, err := trie.VerifyProof(r.ChtRoot, encNumber[:], nodeSet)
 	if err != nil {
 		return err
 	}
@@ -349,8 +356,83 @@ func (r *ChtRequest) Validate(db ethdb.Database, msg *Msg) error {
 	}
 	// Verifications passed, store and return
 	r.Header = proof.Header
-	r.Proof = proof.Proof
+	r.Proof = nodeSet
 	r.Td = node.Td
 
 	return nil
 }
+
+type BloomReq struct {
+	BloomTrieNum, BitIdx, SectionIdx, FromLevel uint64
+}
+
+// ODR request type for requesting bloom bit vectors by bloom trie, see LesOdrRequest interface
+type BloomRequest light.BloomRequest
+
+// GetCost returns the cost of the given ODR request according to the serving
+// peer's cost table (implementation of LesOdrRequest)
+func (r *BloomRequest) GetCost(peer *peer) uint64 {
+	return peer.GetRequestCost(GetBloomBitsProofsMsg, len(r.SectionIdxList))
+}
+
+// CanSend tells if a certain peer is suitable for serving the given request
+func (r *BloomRequest) CanSend(peer *peer) bool {
+	peer.lock.RLock()
+	defer peer.lock.RUnlock()
+
+	if peer.version < lpv2 || peer.headInfo.Number < light.BloomTrieConfirmations {
+		return false
+	}
+	return r.BloomTrieNum <= (peer.headInfo.Number-light.BloomTrieConfirmations)/light.BloomTrieFrequency
+}
+
+// Request sends an ODR request to the LES network (implementation of LesOdrRequest)
+func (r *BloomRequest) Request(reqID uint64, peer *peer) error {
+	peer.Log().Debug("Requesting bloom bits", "bloomTrie", r.BloomTrieNum, "bitIdx", r.BitIdx, "sections", len(r.SectionIdxList))
+	reqs := make([]*BloomReq, len(r.SectionIdxList))
+	for i, sectionIdx := range r.SectionIdxList {
+		reqs[i] = &BloomReq{
+			BloomTrieNum: r.BloomTrieNum,
+			BitIdx:       r.BitIdx,
+			SectionIdx:   sectionIdx,
+		}
+	}
+	return peer.RequestBloomBitsProofs(reqID, r.GetCost(peer), reqs)
+}
+
+// Valid processes an ODR request reply message from the LES network
+// returns true and stores results in memory if the message was a valid reply
+// to the request (implementation of LesOdrRequest)
+func (r *BloomRequest) Validate(db ethdb.Database, msg *Msg) error {
+	log.Debug("Validating bloom bits", "bloomTrie", r.BloomTrieNum, "bitIdx", r.BitIdx, "sections", len(r.SectionIdxList))
+
+	// Ensure we have a correct message with a proof for each section
+	if msg.MsgType != MsgBloomBitsProofs {
+		return errInvalidMessageType
+	}
+	proofs := msg.Obj.([]light.NodeList)
+	if len(proofs) != len(r.SectionIdxList) {
+		return errInvalidEntryCount
+	}
+	// Verify the bloom trie proofs and decompress the bit vectors
+	var (
+		nodeSet = light.NewNodeSet()
+		bits    = make([][]byte, len(r.SectionIdxList))
+	)
+	for i, sectionIdx := range r.SectionIdxList {
+		proof := proofs[i].NodeSet()
+		value, err := trie.VerifyProof(r.BloomTrieRoot, light.BloomTrieKey(r.BitIdx, sectionIdx), proof)
+		if err != nil {
+			return err
+		}
+		if bits[i], err = bitutil.DecompressBytes(value, int(light.BloomTrieFrequency/8)); err != nil {
+			return err
+		}
+		proof.Store(nodeSet)
+	}
+	// Verifications passed, store and return
+	r.BloomBits = bits
+	r.Proofs = nodeSet
+
+	return nil
+}
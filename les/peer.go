@@ -66,6 +66,7 @@ type peer struct {
 	fcClient       *flowcontrol.ClientNode // nil if the peer is server only
 	fcServer       *flowcontrol.ServerNode // nil if the peer is client only
 	fcServerParams *flowcontrol.ServerParams
+	fcClientParams *flowcontrol.ServerParams // Parameters granted to the peer if it is a client
 	fcCosts        requestCostTable
 }
 
@@ -210,6 +211,12 @@ func (p *peer) SendHeaderProofs(reqID, bv uint64, proofs []ChtResp) error {
 	return sendResponse(p.rw, HeaderProofsMsg, reqID, bv, proofs)
 }
 
+// SendBloomBitsProofs sends a batch of bloom trie proofs, corresponding to the
+// ones requested.
+func (p *peer) SendBloomBitsProofs(reqID, bv uint64, proofs proofsData) error {
+	return sendResponse(p.rw, BloomBitsProofsMsg, reqID, bv, proofs)
+}
+
 // RequestHeadersByHash fetches a batch of blocks' headers corresponding to the
 // specified header query, based on the hash of an origin block.
 func (p *peer) RequestHeadersByHash(reqID, cost uint64, origin common.Hash, amount int, skip int, reverse bool) error {
@@ -256,6 +263,13 @@ func (p *peer) RequestHeaderProofs(reqID, cost uint64, reqs []*ChtReq) error {
 	return sendRequest(p.rw, GetHeaderProofsMsg, reqID, cost, reqs)
 }
 
+// RequestBloomBitsProofs fetches a batch of bloom trie merkle proofs from a
+// remote node.
+func (p *peer) RequestBloomBitsProofs(reqID, cost uint64, reqs []*BloomReq) error {
+	p.Log().Debug("Fetching batch of bloom bits proofs", "count", len(reqs))
+	return sendRequest(p.rw, GetBloomBitsProofsMsg, reqID, cost, reqs)
+}
+
 func (p *peer) SendTxs(reqID, cost uint64, txs types.Transactions) error {
 	p.Log().Debug("Fetching batch of transactions", "count", len(txs))
 	return p2p.Send(p.rw, SendTxMsg, txs)
@@ -341,13 +355,19 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 	send = send.add("headHash", head)
 	send = send.add("headNum", headNum)
 	send = send.add("genesisHash", genesis)
+	var (
+		params   *flowcontrol.ServerParams
+		priority bool
+	)
 	if server != nil {
+		params, priority = server.clientParams(p.ID())
+
 		send = send.add("serveHeaders", nil)
 		send = send.add("serveChainSince", uint64(0))
 		send = send.add("serveStateSince", uint64(0))
 		send = send.add("txRelay", nil)
-		send = send.add("flowControl/BL", server.defParams.BufLimit)
-		send = send.add("flowControl/MRR", server.defParams.MinRecharge)
+		send = send.add("flowControl/BL", params.BufLimit)
+		send = send.add("flowControl/MRR", params.MinRecharge)
 		list := server.fcCostStats.getCurrentList()
 		send = send.add("flowControl/MRC", list)
 		p.fcCosts = list.decode()
@@ -395,7 +415,8 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 		/*if recv.get("serveStateSince", nil) == nil {
 			return errResp(ErrUselessPeer, "wanted client, got server")
 		}*/
-		p.fcClient = flowcontrol.NewClientNode(server.fcManager, server.defParams)
+		p.fcClientParams = params
+		p.fcClient = flowcontrol.NewClientNode(server.fcManager, params, priority)
 	} else {
 		if recv.get("serveChainSince", nil) != nil {
 			return errResp(ErrUselessPeer, "peer cannot serve chain")
@@ -19,9 +19,9 @@ package les
 
 import (
 	"encoding/binary"
+	"fmt"
 	"math"
 	"sync"
-	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core"
@@ -32,24 +32,46 @@ import (
 	"github.com/ethereum/go-ethereum/light"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/discover"
 	"github.com/ethereum/go-ethereum/p2p/discv5"
 	"github.com/ethereum/go-ethereum/rlp"
-	"github.com/ethereum/go-ethereum/trie"
+)
+
+const (
+	// priorityBufFactor is the multiplier applied to the default buffer limit
+	// when serving priority clients.
+	priorityBufFactor = 4
+
+	// priorityRechargeFactor is the multiplier applied to the default minimum
+	// recharge rate when serving priority clients.
+	priorityRechargeFactor = 4
 )
 
 type LesServer struct {
 	protocolManager *ProtocolManager
 	fcManager       *flowcontrol.ClientManager // nil if our node is client only
+	chtIndexer      *core.ChainIndexer         // Generates the canonical hash tries served to clients
+	bloomIndexer    *core.ChainIndexer         // Generates the bloom tries served to clients, child of the bloom bits indexer
 	fcCostStats     *requestCostStats
 	defParams       *flowcontrol.ServerParams
+	priorityParams  *flowcontrol.ServerParams // Flow control parameters granted to priority clients
+	priority        map[discover.NodeID]bool  // Light clients to serve with priority
 	lesTopic        discv5.Topic
 	quitSync        chan struct{}
 	stopped         bool
 }
 
 func NewLesServer(eth *eth.Ethereum, config *eth.Config) (*LesServer, error) {
+	priority := make(map[discover.NodeID]bool)
+	for _, id := range config.LightPriority {
+		nodeID, err := discover.HexID(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid priority light client %q: %v", id, err)
+		}
+		priority[nodeID] = true
+	}
 	quitSync := make(chan struct{})
-	pm, err := NewProtocolManager(eth.BlockChain().Config(), false, config.NetworkId, eth.EventMux(), eth.Engine(), newPeerSet(), eth.BlockChain(), eth.TxPool(), eth.ChainDb(), nil, nil, quitSync, new(sync.WaitGroup))
+	pm, err := NewProtocolManager(eth.BlockChain().Config(), false, config.NetworkId, eth.EventMux(), eth.Engine(), newPeerSet(), eth.BlockChain(), eth.TxPool(), eth.ChainDb(), nil, nil, nil, quitSync, new(sync.WaitGroup))
 	if err != nil {
 		return nil, err
 	}
@@ -59,15 +81,27 @@ func NewLesServer(eth *eth.Ethereum, config *eth.Config) (*LesServer, error) {
 		protocolManager: pm,
 		quitSync:        quitSync,
 		lesTopic:        lesTopic(eth.BlockChain().Genesis().Hash()),
+		priority:        priority,
 	}
 	pm.server = srv
+	pm.stateDb = eth.BlockChain().TrieDB()
 
 	srv.defParams = &flowcontrol.ServerParams{
 		BufLimit:    300000000,
 		MinRecharge: 50000,
 	}
+	srv.priorityParams = &flowcontrol.ServerParams{
+		BufLimit:    srv.defParams.BufLimit * priorityBufFactor,
+		MinRecharge: srv.defParams.MinRecharge * priorityRechargeFactor,
+	}
 	srv.fcManager = flowcontrol.NewClientManager(uint64(config.LightServ), 10, 1000000000)
 	srv.fcCostStats = newCostStats(eth.ChainDb())
+
+	srv.chtIndexer = light.NewChtIndexer(eth.ChainDb())
+	srv.chtIndexer.Start(eth.EventMux())
+	srv.bloomIndexer = light.NewBloomTrieIndexer(eth.ChainDb())
+	eth.BloomIndexer().AddChildIndexer(srv.bloomIndexer)
+
 	return srv, nil
 }
 
@@ -75,6 +109,15 @@ func (s *LesServer) Protocols() []p2p.Protocol {
 	return s.protocolManager.SubProtocols
 }
 
+// clientParams returns the flow control parameters to grant to a light client
+// and whether it should be served with priority.
+func (s *LesServer) clientParams(id discover.NodeID) (*flowcontrol.ServerParams, bool) {
+	if s.priority[id] && s.priorityParams != nil {
+		return s.priorityParams, true
+	}
+	return s.defParams, false
+}
+
 // Start starts the LES server
 func (s *LesServer) Start(srvr *p2p.Server) {
 	s.protocolManager.Start()
@@ -89,6 +132,8 @@ func (s *LesServer) Start(srvr *p2p.Server) {
 
 // Stop stops the LES service
 func (s *LesServer) Stop() {
+	// The bloom trie indexer is closed together with its parent bloom bits indexer
+	s.chtIndexer.Close()
 	s.fcCostStats.store()
 	s.fcManager.Stop()
 	go func() {
@@ -283,10 +328,7 @@ func (s *requestCostStats) update(msgCode, reqCnt, cost uint64) {
 func (pm *ProtocolManager) blockLoop() {
 	pm.wg.Add(1)
 	sub := pm.eventMux.Subscribe(core.ChainHeadEvent{})
-	newCht := make(chan struct{}, 10)
-	newCht <- struct{}{}
 	go func() {
-		var mu sync.Mutex
 		var lastHead *types.Header
 		lastBroadcastTd := common.Big0
 		for {
@@ -318,17 +360,6 @@ func (pm *ProtocolManager) blockLoop() {
 						}
 					}
 				}
-				newCht <- struct{}{}
-			case <-newCht:
-				go func() {
-					mu.Lock()
-					more := makeCht(pm.chainDb)
-					mu.Unlock()
-					if more {
-						time.Sleep(time.Millisecond * 10)
-						newCht <- struct{}{}
-					}
-				}()
 			case <-pm.quitSync:
 				sub.Unsubscribe()
 				pm.wg.Done()
@@ -337,86 +368,3 @@ func (pm *ProtocolManager) blockLoop() {
 		}
 	}()
 }
-
-var (
-	lastChtKey = []byte("LastChtNumber") // chtNum (uint64 big endian)
-	chtPrefix  = []byte("cht")           // chtPrefix + chtNum (uint64 big endian) -> trie root hash
-)
-
-func getChtRoot(db ethdb.Database, num uint64) common.Hash {
-	var encNumber [8]byte
-	binary.BigEndian.PutUint64(encNumber[:], num)
-	data, _ := db.Get(append(chtPrefix, encNumber[:]...))
-	return common.BytesToHash(data)
-}
-
-func storeChtRoot(db ethdb.Database, num uint64, root common.Hash) {
-	var encNumber [8]byte
-	binary.BigEndian.PutUint64(encNumber[:], num)
-	db.Put(append(chtPrefix, encNumber[:]...), root[:])
-}
-
-func makeCht(db ethdb.Database) bool {
-	headHash := core.GetHeadBlockHash(db)
-	headNum := core.GetBlockNumber(db, headHash)
-
-	var newChtNum uint64
-	if headNum > light.ChtConfirmations {
-		newChtNum = (headNum - light.ChtConfirmations) / light.ChtFrequency
-	}
-
-	var lastChtNum uint64
-	data, _ := db.Get(lastChtKey)
-	if len(data) == 8 {
-		lastChtNum = binary.BigEndian.Uint64(data[:])
-	}
-	if newChtNum <= lastChtNum {
-		return false
-	}
-
-	var t *trie.Trie
-	if lastChtNum > 0 {
-		var err error
-		t, err = trie.New(getChtRoot(db, lastChtNum), db)
-		if err != nil {
-			lastChtNum = 0
-		}
-	}
-	if lastChtNum == 0 {
-		t, _ = trie.New(common.Hash{}, db)
-	}
-
-	for num := lastChtNum * light.ChtFrequency; num < (lastChtNum+1)*light.ChtFrequency; num++ {
-		hash := core.GetCanonicalHash(db, num)
-		if hash == (common.Hash{}) {
-			panic("Canonical hash not found")
-		}
-		td := core.GetTd(db, hash, num)
-		if td == nil {
-			panic("TD not found")
-		}
-		var encNumber [8]byte
-		binary.BigEndian.PutUint64(encNumber[:], num)
-		var node light.ChtNode
-		node.Hash = hash
-		node.Td = td
-		data, _ := rlp.EncodeToBytes(node)
-		t.Update(encNumber[:], data)
-	}
-
-	root, err := t.Commit()
-	if err != nil {
-		lastChtNum = 0
-	} else {
-		lastChtNum++
-
-		log.Trace("Generated CHT", "number", lastChtNum, "root", root.Hex())
-
-		storeChtRoot(db, lastChtNum, root)
-		var data [8]byte
-		binary.BigEndian.PutUint64(data[:], lastChtNum)
-		db.Put(lastChtKey, data[:])
-	}
-
-	return newChtNum > lastChtNum
-}
@@ -0,0 +1,80 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+)
+
+// defaultULCMinTrustedFraction is the percentage of trusted servers that need
+// to announce a head if the configuration doesn't specify it.
+const defaultULCMinTrustedFraction = 75
+
+// ulc holds the trusted servers of an ultra light client, which skips verifying
+// the announced heads itself and instead only accepts heads announced by a
+// sufficient fraction of the trusted servers.
+type ulc struct {
+	trustedNodes       []*discover.Node
+	trustedKeys        map[discover.NodeID]struct{}
+	minTrustedFraction int
+}
+
+// newULC creates the ultra light client settings from the configuration, or
+// returns nil if no trusted servers are configured.
+func newULC(config *eth.ULCConfig) (*ulc, error) {
+	if config == nil || len(config.TrustedServers) == 0 {
+		return nil, nil
+	}
+	fraction := config.MinTrustedFraction
+	if fraction == 0 {
+		fraction = defaultULCMinTrustedFraction
+	}
+	if fraction < 0 || fraction > 100 {
+		return nil, fmt.Errorf("invalid trusted server fraction %d%%, must be in range 1-100", fraction)
+	}
+	u := &ulc{
+		trustedKeys:        make(map[discover.NodeID]struct{}),
+		minTrustedFraction: fraction,
+	}
+	for _, url := range config.TrustedServers {
+		node, err := discover.ParseNode(url)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted server %q: %v", url, err)
+		}
+		if _, ok := u.trustedKeys[node.ID]; ok {
+			continue
+		}
+		u.trustedNodes = append(u.trustedNodes, node)
+		u.trustedKeys[node.ID] = struct{}{}
+	}
+	return u, nil
+}
+
+// trusted returns whether the server with the given node ID is trusted.
+func (u *ulc) trusted(id discover.NodeID) bool {
+	_, ok := u.trustedKeys[id]
+	return ok
+}
+
+// enoughVotes returns whether the given number of trusted servers announcing a
+// head is sufficient to accept it.
+func (u *ulc) enoughVotes(votes int) bool {
+	return votes*100 >= u.minTrustedFraction*len(u.trustedKeys)
+}
@@ -0,0 +1,110 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+)
+
+// newTestServerURLs generates the enode URLs and node IDs of random servers.
+func newTestServerURLs(n int) ([]string, []discover.NodeID) {
+	var (
+		urls []string
+		ids  []discover.NodeID
+	)
+	for i := 0; i < n; i++ {
+		key, _ := crypto.GenerateKey()
+		id := discover.PubkeyID(&key.PublicKey)
+
+		urls = append(urls, fmt.Sprintf("enode://%x@127.0.0.1:%d", id[:], 30303+i))
+		ids = append(ids, id)
+	}
+	return urls, ids
+}
+
+// Tests that the ultra light client configuration is validated and parsed.
+func TestULCConfig(t *testing.T) {
+	urls, ids := newTestServerURLs(2)
+
+	// Ultra light client mode should be disabled without trusted servers
+	if u, err := newULC(nil); u != nil || err != nil {
+		t.Errorf("nil config: have %v/%v, want nil/nil", u, err)
+	}
+	if u, err := newULC(&eth.ULCConfig{MinTrustedFraction: 50}); u != nil || err != nil {
+		t.Errorf("empty config: have %v/%v, want nil/nil", u, err)
+	}
+	// Invalid fractions and servers should be rejected
+	for _, fraction := range []int{-1, 101} {
+		if _, err := newULC(&eth.ULCConfig{TrustedServers: urls, MinTrustedFraction: fraction}); err == nil {
+			t.Errorf("fraction %d: invalid fraction accepted", fraction)
+		}
+	}
+	if _, err := newULC(&eth.ULCConfig{TrustedServers: append(urls, "enode://invalid")}); err == nil {
+		t.Errorf("invalid server accepted")
+	}
+	// Valid configs should default the fraction and deduplicate the servers
+	u, err := newULC(&eth.ULCConfig{TrustedServers: append(urls, urls[0])})
+	if err != nil {
+		t.Fatalf("failed to create ultra light client: %v", err)
+	}
+	if u.minTrustedFraction != defaultULCMinTrustedFraction {
+		t.Errorf("fraction mismatch: have %d, want %d", u.minTrustedFraction, defaultULCMinTrustedFraction)
+	}
+	if len(u.trustedNodes) != len(urls) {
+		t.Errorf("trusted server count mismatch: have %d, want %d", len(u.trustedNodes), len(urls))
+	}
+	for i, id := range ids {
+		if !u.trusted(id) {
+			t.Errorf("server %d: not trusted", i)
+		}
+	}
+	if _, others := newTestServerURLs(1); u.trusted(others[0]) {
+		t.Errorf("unknown server trusted")
+	}
+}
+
+// Tests that heads are only accepted if announced by enough trusted servers.
+func TestULCVotes(t *testing.T) {
+	tests := []struct {
+		servers, fraction, votes int
+		accept                   bool
+	}{
+		{servers: 1, fraction: 100, votes: 0, accept: false},
+		{servers: 1, fraction: 100, votes: 1, accept: true},
+		{servers: 4, fraction: 75, votes: 2, accept: false},
+		{servers: 4, fraction: 75, votes: 3, accept: true},
+		{servers: 4, fraction: 50, votes: 2, accept: true},
+		{servers: 3, fraction: 50, votes: 1, accept: false},
+		{servers: 3, fraction: 50, votes: 2, accept: true},
+		{servers: 5, fraction: 1, votes: 1, accept: true},
+	}
+	for i, tt := range tests {
+		urls, _ := newTestServerURLs(tt.servers)
+		u, err := newULC(&eth.ULCConfig{TrustedServers: urls, MinTrustedFraction: tt.fraction})
+		if err != nil {
+			t.Fatalf("test %d: failed to create ultra light client: %v", i, err)
+		}
+		if accept := u.enoughVotes(tt.votes); accept != tt.accept {
+			t.Errorf("test %d: %d/%d votes at %d%%: have accept %v, want %v", i, tt.votes, tt.servers, tt.fraction, accept, tt.accept)
+		}
+	}
+}
@@ -19,26 +19,31 @@ package light
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"errors"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/bitutil"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
 )
 
 var sha3_nil = crypto.Keccak256Hash(nil)
 
 var (
-	ErrNoTrustedCht = errors.New("No trusted canonical hash trie")
-	ErrNoHeader     = errors.New("Header not found")
+	ErrNoTrustedCht       = errors.New("No trusted canonical hash trie")
+	ErrNoTrustedBloomTrie = errors.New("No trusted bloom trie")
+	ErrNoHeader           = errors.New("Header not found")
 
 	ChtFrequency     = uint64(4096)
 	ChtConfirmations = uint64(2048)
 	trustedChtKey    = []byte("TrustedCHT")
+	chtPrefix        = []byte("cht") // chtPrefix + chtNum (uint64 big endian) -> trie root hash
 )
 
 type ChtNode struct {
@@ -51,6 +56,36 @@ type TrustedCht struct {
 	Root   common.Hash
 }
 
+// GetChtRoot retrieves the root hash of the canonical hash trie with the given
+// section number, or the zero hash if it's not available.
+func GetChtRoot(db ethdb.Database, num uint64) common.Hash {
+	var encNumber [8]byte
+	binary.BigEndian.PutUint64(encNumber[:], num)
+	data, _ := db.Get(append(chtPrefix, encNumber[:]...))
+	return common.BytesToHash(data)
+}
+
+// StoreChtRoot stores the root hash of the canonical hash trie with the given
+// section number.
+func StoreChtRoot(db ethdb.Database, num uint64, root common.Hash) {
+	var encNumber [8]byte
+	binary.BigEndian.PutUint64(encNumber[:], num)
+	db.Put(append(chtPrefix, encNumber[:]...), root[:])
+}
+
+// GetChtRoots retrieves the root hashes of all the consecutive canonical hash
+// tries stored in the database, starting from the first section.
+func GetChtRoots(db ethdb.Database) []common.Hash {
+	var roots []common.Hash
+	for num := uint64(1); ; num++ {
+		root := GetChtRoot(db, num)
+		if root == (common.Hash{}) {
+			return roots
+		}
+		roots = append(roots, root)
+	}
+}
+
 func GetTrustedCht(db ethdb.Database) TrustedCht {
 	data, _ := db.Get(trustedChtKey)
 	var res TrustedCht
@@ -162,3 +197,42 @@ func GetBlockReceipts(ctx context.Context, odr OdrBackend, hash common.Hash, num
 	}
 	return r.Receipts, nil
 }
+
+// GetBloomBits retrieves the bit vectors of the given bloom bit for a batch of
+// sections, proven against the trusted bloom trie. Vectors available locally
+// are served from the database, the rest are retrieved from the network.
+func GetBloomBits(ctx context.Context, odr OdrBackend, bitIdx uint64, sectionIdxList []uint64) ([][]byte, error) {
+	db := odr.Database()
+	blt := GetTrustedBloomTrie(db)
+
+	var (
+		result  = make([][]byte, len(sectionIdxList))
+		reqList []uint64
+		reqIdx  []int
+	)
+	for i, sectionIdx := range sectionIdxList {
+		if sectionIdx >= blt.Number {
+			return nil, ErrNoTrustedBloomTrie
+		}
+		if t, err := trie.New(blt.Root, db); err == nil {
+			if data, err := t.TryGet(BloomTrieKey(bitIdx, sectionIdx)); err == nil {
+				if result[i], err = bitutil.DecompressBytes(data, int(BloomTrieFrequency/8)); err == nil {
+					continue
+				}
+			}
+		}
+		reqList = append(reqList, sectionIdx)
+		reqIdx = append(reqIdx, i)
+	}
+	if reqList == nil {
+		return result, nil
+	}
+	r := &BloomRequest{BloomTrieRoot: blt.Root, BloomTrieNum: blt.Number, BitIdx: bitIdx, SectionIdxList: reqList}
+	if err := odr.Retrieve(ctx, r); err != nil {
+		return nil, err
+	}
+	for i, idx := range reqIdx {
+		result[idx] = r.BloomBits[i]
+	}
+	return result, nil
+}
@@ -0,0 +1,226 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+var (
+	BloomTrieFrequency     = params.BloomBitsBlocks // Bloom tries are built over the bloom bits index sections
+	BloomTrieConfirmations = uint64(2048)
+	trustedBloomTrieKey    = []byte("TrustedBloomTrie")
+	bloomTriePrefix        = []byte("bltRoot-") // bloomTriePrefix + bloomTrieNum (uint64 big endian) -> trie root hash
+)
+
+// ChtIndexerBackend implements core.ChainIndexerBackend, generating the
+// canonical hash tries mapping block numbers to header hashes and total
+// difficulties.
+type ChtIndexerBackend struct {
+	db      ethdb.Database
+	section uint64
+	trie    *trie.Trie
+}
+
+// NewChtIndexer creates a chain indexer generating a new CHT for every
+// ChtFrequency blocks of the canonical chain.
+func NewChtIndexer(db ethdb.Database) *core.ChainIndexer {
+	backend := &ChtIndexerBackend{db: db}
+	return core.NewChainIndexer(db, ethdb.NewTable(db, "chtIndex-"), backend, ChtFrequency, ChtConfirmations, 10*time.Millisecond, "cht")
+}
+
+// Reset implements core.ChainIndexerBackend, opening the CHT containing all the
+// previous sections.
+func (c *ChtIndexerBackend) Reset(section uint64, lastSectionHead common.Hash) error {
+	var root common.Hash
+	if section > 0 {
+		root = GetChtRoot(c.db, section)
+	}
+	t, err := trie.New(root, c.db)
+	if err != nil {
+		return err
+	}
+	c.section, c.trie = section, t
+	return nil
+}
+
+// Process implements core.ChainIndexerBackend, inserting the hash and total
+// difficulty of the header into the CHT.
+func (c *ChtIndexerBackend) Process(header *types.Header) error {
+	hash, num := header.Hash(), header.Number.Uint64()
+
+	td := core.GetTd(c.db, hash, num)
+	if td == nil {
+		return fmt.Errorf("total difficulty of block #%d [%x…] not found", num, hash[:4])
+	}
+	var encNumber [8]byte
+	binary.BigEndian.PutUint64(encNumber[:], num)
+	data, _ := rlp.EncodeToBytes(ChtNode{Hash: hash, Td: td})
+	c.trie.Update(encNumber[:], data)
+	return nil
+}
+
+// Commit implements core.ChainIndexerBackend, storing the root of the CHT
+// covering all sections up to and including the current one.
+func (c *ChtIndexerBackend) Commit() error {
+	root, err := c.trie.Commit()
+	if err != nil {
+		return err
+	}
+	StoreChtRoot(c.db, c.section+1, root)
+	log.Info("Storing CHT", "section", c.section, "root", root)
+	return nil
+}
+
+// BloomTrieIndexerBackend implements core.ChainIndexerBackend, generating the
+// bloom tries mapping bloom bit indices and section numbers to the compressed
+// bit vectors of the bloom bits index.
+type BloomTrieIndexerBackend struct {
+	db      ethdb.Database
+	section uint64
+	head    common.Hash
+	trie    *trie.Trie
+}
+
+// NewBloomTrieIndexer creates a chain indexer generating a new bloom trie for
+// every BloomTrieFrequency blocks of the canonical chain. The indexer needs to
+// be added as a child of the bloom bits indexer, whose output it is built from.
+func NewBloomTrieIndexer(db ethdb.Database) *core.ChainIndexer {
+	backend := &BloomTrieIndexerBackend{db: db}
+	return core.NewChainIndexer(db, ethdb.NewTable(db, "bltIndex-"), backend, BloomTrieFrequency, 0, 10*time.Millisecond, "bloomtrie")
+}
+
+// Reset implements core.ChainIndexerBackend, opening the bloom trie containing
+// all the previous sections.
+func (b *BloomTrieIndexerBackend) Reset(section uint64, lastSectionHead common.Hash) error {
+	var root common.Hash
+	if section > 0 {
+		root = GetBloomTrieRoot(b.db, section)
+	}
+	t, err := trie.New(root, b.db)
+	if err != nil {
+		return err
+	}
+	b.section, b.head, b.trie = section, common.Hash{}, t
+	return nil
+}
+
+// Process implements core.ChainIndexerBackend, tracking the head of the section
+// the bloom bits index vectors are stored under.
+func (b *BloomTrieIndexerBackend) Process(header *types.Header) error {
+	b.head = header.Hash()
+	return nil
+}
+
+// Commit implements core.ChainIndexerBackend, inserting the compressed bit
+// vectors of the section into the bloom trie and storing its root.
+func (b *BloomTrieIndexerBackend) Commit() error {
+	for i := uint(0); i < types.BloomBitLength; i++ {
+		bits, err := core.GetBloomBits(b.db, i, b.section, b.head)
+		if err != nil {
+			return fmt.Errorf("bloom bits of bit %d, section %d not found: %v", i, b.section, err)
+		}
+		b.trie.Update(BloomTrieKey(uint64(i), b.section), bits)
+	}
+	root, err := b.trie.Commit()
+	if err != nil {
+		return err
+	}
+	StoreBloomTrieRoot(b.db, b.section+1, root)
+	log.Info("Storing bloom trie", "section", b.section, "root", root)
+	return nil
+}
+
+// BloomTrieKey returns the bloom trie key of the bit vector belonging to the
+// given bloom bit index and section.
+func BloomTrieKey(bitIdx, section uint64) []byte {
+	var key [10]byte
+	binary.BigEndian.PutUint16(key[0:2], uint16(bitIdx))
+	binary.BigEndian.PutUint64(key[2:10], section)
+	return key[:]
+}
+
+// GetBloomTrieRoot retrieves the root hash of the bloom trie with the given
+// number, or the zero hash if it's not available.
+func GetBloomTrieRoot(db ethdb.Database, num uint64) common.Hash {
+	var encNumber [8]byte
+	binary.BigEndian.PutUint64(encNumber[:], num)
+	data, _ := db.Get(append(bloomTriePrefix, encNumber[:]...))
+	return common.BytesToHash(data)
+}
+
+// StoreBloomTrieRoot stores the root hash of the bloom trie with the given
+// number.
+func StoreBloomTrieRoot(db ethdb.Database, num uint64, root common.Hash) {
+	var encNumber [8]byte
+	binary.BigEndian.PutUint64(encNumber[:], num)
+	db.Put(append(bloomTriePrefix, encNumber[:]...), root[:])
+}
+
+// GetBloomTrieRoots retrieves the root hashes of all the consecutive bloom tries
+// stored in the database, starting from the first one.
+func GetBloomTrieRoots(db ethdb.Database) []common.Hash {
+	var roots []common.Hash
+	for num := uint64(1); ; num++ {
+		root := GetBloomTrieRoot(db, num)
+		if root == (common.Hash{}) {
+			return roots
+		}
+		roots = append(roots, root)
+	}
+}
+
+// TrustedBloomTrie is a bloom trie a light client considers trustworthy, covering
+// the first Number*BloomTrieFrequency blocks of the chain.
+type TrustedBloomTrie struct {
+	Number uint64
+	Root   common.Hash
+}
+
+// GetTrustedBloomTrie retrieves the trusted bloom trie from the database, or an
+// empty one if none is configured.
+func GetTrustedBloomTrie(db ethdb.Database) TrustedBloomTrie {
+	data, _ := db.Get(trustedBloomTrieKey)
+	var res TrustedBloomTrie
+	if err := rlp.DecodeBytes(data, &res); err != nil {
+		return TrustedBloomTrie{0, common.Hash{}}
+	}
+	return res
+}
+
+// WriteTrustedBloomTrie stores the trusted bloom trie into the database.
+func WriteTrustedBloomTrie(db ethdb.Database, blt TrustedBloomTrie) {
+	data, _ := rlp.EncodeToBytes(blt)
+	db.Put(trustedBloomTrieKey, data)
+}
+
+// GetHelperTrieRoots retrieves the roots of all the CHTs and bloom tries stored
+// in the database, which need to be retained when pruning the state.
+func GetHelperTrieRoots(db ethdb.Database) []common.Hash {
+	return append(GetChtRoots(db), GetBloomTrieRoots(db)...)
+}
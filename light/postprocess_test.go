@@ -0,0 +1,166 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/bitutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/bloombits"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// writeIndexTestChain inserts a canonical header chain with distinct blooms and
+// total difficulties into the database.
+func writeIndexTestChain(db ethdb.Database, n int) []*types.Header {
+	var (
+		headers []*types.Header
+		parent  common.Hash
+	)
+	for i := 0; i < n; i++ {
+		header := &types.Header{Number: big.NewInt(int64(i)), ParentHash: parent, Difficulty: big.NewInt(1)}
+		header.Bloom.Add(big.NewInt(int64(i + 1)))
+
+		core.WriteHeader(db, header)
+		core.WriteTd(db, header.Hash(), uint64(i), big.NewInt(int64(i+1)))
+		core.WriteCanonicalHash(db, header.Hash(), uint64(i))
+
+		headers = append(headers, header)
+		parent = header.Hash()
+	}
+	return headers
+}
+
+// Tests that consecutive CHTs contain the hashes and total difficulties of all
+// the headers up to the end of their sections.
+func TestChtIndexerBackend(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	headers := writeIndexTestChain(db, 8)
+
+	backend := &ChtIndexerBackend{db: db}
+	for section := uint64(0); section < 2; section++ {
+		if err := backend.Reset(section, common.Hash{}); err != nil {
+			t.Fatalf("section %d: failed to reset backend: %v", section, err)
+		}
+		for _, header := range headers[section*4 : (section+1)*4] {
+			if err := backend.Process(header); err != nil {
+				t.Fatalf("section %d: failed to process header: %v", section, err)
+			}
+		}
+		if err := backend.Commit(); err != nil {
+			t.Fatalf("section %d: failed to commit: %v", section, err)
+		}
+		// Verify all the headers indexed so far
+		cht, err := trie.New(GetChtRoot(db, section+1), db)
+		if err != nil {
+			t.Fatalf("section %d: failed to open CHT: %v", section, err)
+		}
+		for i, header := range headers {
+			var encNumber [8]byte
+			binary.BigEndian.PutUint64(encNumber[:], uint64(i))
+
+			data := cht.Get(encNumber[:])
+			if uint64(i) >= (section+1)*4 {
+				if data != nil {
+					t.Errorf("section %d: header #%d indexed too early", section, i)
+				}
+				continue
+			}
+			var node ChtNode
+			if err := rlp.DecodeBytes(data, &node); err != nil {
+				t.Fatalf("section %d: header #%d: failed to decode CHT node: %v", section, i, err)
+			}
+			if node.Hash != header.Hash() || node.Td.Int64() != int64(i+1) {
+				t.Errorf("section %d: header #%d: CHT node mismatch: have %x/%v, want %x/%d", section, i, node.Hash, node.Td, header.Hash(), i+1)
+			}
+		}
+	}
+	if roots := GetChtRoots(db); len(roots) != 2 {
+		t.Errorf("CHT root count mismatch: have %d, want %d", len(roots), 2)
+	}
+}
+
+// Tests that the bloom trie contains the bloom bits index of the sections and
+// that light clients can retrieve and verify them against a trusted bloom trie.
+func TestBloomTrieIndexerBackend(t *testing.T) {
+	sdb, _ := ethdb.NewMemDatabase()
+	ldb, _ := ethdb.NewMemDatabase()
+	headers := writeIndexTestChain(sdb, 16)
+
+	// Rotate the header blooms into the bloom bits index the trie is built from
+	gen, _ := bloombits.NewGenerator(uint(BloomTrieFrequency))
+	for i := uint64(0); i < BloomTrieFrequency; i++ {
+		var bloom types.Bloom
+		if i < uint64(len(headers)) {
+			bloom = headers[i].Bloom
+		}
+		gen.AddBloom(uint(i), bloom)
+	}
+	head := headers[len(headers)-1].Hash()
+	for i := 0; i < types.BloomBitLength; i++ {
+		bits, _ := gen.Bitset(uint(i))
+		core.WriteBloomBits(sdb, uint(i), 0, head, bitutil.CompressBytes(bits))
+	}
+	backend := &BloomTrieIndexerBackend{db: sdb}
+	if err := backend.Reset(0, common.Hash{}); err != nil {
+		t.Fatalf("failed to reset backend: %v", err)
+	}
+	for _, header := range headers {
+		if err := backend.Process(header); err != nil {
+			t.Fatalf("failed to process header: %v", err)
+		}
+	}
+	if err := backend.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	WriteTrustedBloomTrie(ldb, TrustedBloomTrie{Number: 1, Root: GetBloomTrieRoot(sdb, 1)})
+
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+	for bit := 0; bit < types.BloomBitLength; bit++ {
+		// Assemble the expected bit vector of the bloom bit
+		want := make([]byte, BloomTrieFrequency/8)
+		for i, header := range headers {
+			if header.Bloom.Big().Bit(bit) == 1 {
+				want[i/8] |= 1 << uint(7-i%8)
+			}
+		}
+		// Retrieve it from the network, and again from the local proofs
+		for _, disable := range []bool{false, true} {
+			odr.disable = disable
+
+			bits, err := GetBloomBits(context.Background(), odr, uint64(bit), []uint64{0})
+			if err != nil {
+				t.Fatalf("bit %d: failed to retrieve bloom bits (odr disabled: %v): %v", bit, disable, err)
+			}
+			if !bytes.Equal(bits[0], want) {
+				t.Fatalf("bit %d: bloom bits mismatch (odr disabled: %v): have %x, want %x", bit, disable, bits[0][:2], want[:2])
+			}
+		}
+	}
+	if _, err := GetBloomBits(context.Background(), odr, 0, []uint64{1}); err != ErrNoTrustedBloomTrie {
+		t.Errorf("untrusted section error mismatch: have %v, want %v", err, ErrNoTrustedBloomTrie)
+	}
+}
@@ -135,6 +135,13 @@ func (t *odrTrie) GetKey(sha []byte) []byte {
 	return nil
 }
 
+func (t *odrTrie) Prove(key []byte, fromLevel uint, proofDb trie.DatabaseWriter) error {
+	key = crypto.Keccak256(key)
+	return t.do(key, func() error {
+		return t.trie.Prove(key, fromLevel, proofDb)
+	})
+}
+
 // do tries and retries to execute a function until it returns with no error or
 // an error type other than MissingNodeError
 func (t *odrTrie) do(key []byte, fn func() error) error {
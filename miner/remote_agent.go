@@ -17,8 +17,11 @@
 package miner
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"math/big"
+	"net/http"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -30,6 +33,10 @@ import (
 	"github.com/ethereum/go-ethereum/log"
 )
 
+// notifyClient is the HTTP client used to push new work packages to remote
+// miners. Slow or unreachable miners must not hold up the notifications.
+var notifyClient = &http.Client{Timeout: time.Second}
+
 type hashrate struct {
 	ping time.Time
 	rate uint64
@@ -50,15 +57,20 @@ type RemoteAgent struct {
 	hashrateMu sync.RWMutex
 	hashrate   map[common.Hash]hashrate
 
+	notify []string // HTTP URLs to push new work packages to
+
 	running int32 // running indicates whether the agent is active. Call atomically
 }
 
-func NewRemoteAgent(chain consensus.ChainReader, engine consensus.Engine) *RemoteAgent {
+// NewRemoteAgent creates an agent serving work to external miners. Any new work
+// is also pushed to the given notification URLs as it becomes available.
+func NewRemoteAgent(chain consensus.ChainReader, engine consensus.Engine, notify []string) *RemoteAgent {
 	return &RemoteAgent{
 		chain:    chain,
 		engine:   engine,
 		work:     make(map[common.Hash]*Work),
 		hashrate: make(map[common.Hash]hashrate),
+		notify:   notify,
 	}
 }
 
@@ -110,25 +122,47 @@ func (a *RemoteAgent) GetWork() ([3]string, error) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	var res [3]string
-
 	if a.currentWork != nil {
 		block := a.currentWork.Block
 
-		res[0] = block.HashNoNonce().Hex()
-		seedHash := ethash.SeedHash(block.NumberU64())
-		res[1] = common.BytesToHash(seedHash).Hex()
-		// Calculate the "target" to be returned to the external miner
-		n := big.NewInt(1)
-		n.Lsh(n, 255)
-		n.Div(n, block.Difficulty())
-		n.Lsh(n, 1)
-		res[2] = common.BytesToHash(n.Bytes()).Hex()
-
 		a.work[block.HashNoNonce()] = a.currentWork
-		return res, nil
+		return workPackage(block), nil
+	}
+	return [3]string{}, errors.New("No work available yet, don't panic.")
+}
+
+// workPackage assembles the work package of a block handed out to external
+// miners: the pow-hash of the header, the seed hash of the DAG and the target.
+func workPackage(block *types.Block) [3]string {
+	var res [3]string
+
+	res[0] = block.HashNoNonce().Hex()
+	seedHash := ethash.SeedHash(block.NumberU64())
+	res[1] = common.BytesToHash(seedHash).Hex()
+	// Calculate the "target" to be returned to the external miner
+	n := big.NewInt(1)
+	n.Lsh(n, 255)
+	n.Div(n, block.Difficulty())
+	n.Lsh(n, 1)
+	res[2] = common.BytesToHash(n.Bytes()).Hex()
+
+	return res
+}
+
+// notifyWork pushes a work package to all the notification URLs as a JSON array,
+// so remote miners can start on new work right away instead of polling for it.
+func (a *RemoteAgent) notifyWork(work [3]string) {
+	blob, _ := json.Marshal(work)
+	for _, url := range a.notify {
+		go func(url string) {
+			resp, err := notifyClient.Post(url, "application/json", bytes.NewReader(blob))
+			if err != nil {
+				log.Warn("Failed to notify remote miner", "url", url, "err", err)
+				return
+			}
+			resp.Body.Close()
+		}(url)
 	}
-	return res, errors.New("No work available yet, don't panic.")
 }
 
 // SubmitWork tries to inject a pow solution into the remote agent, returning
@@ -178,6 +212,11 @@ func (a *RemoteAgent) loop(workCh chan *Work, quitCh chan struct{}) {
 		case work := <-workCh:
 			a.mu.Lock()
 			a.currentWork = work
+			if len(a.notify) > 0 {
+				// Track the pushed work so solutions to it are accepted
+				a.work[work.Block.HashNoNonce()] = work
+				a.notifyWork(workPackage(work.Block))
+			}
 			a.mu.Unlock()
 		case <-ticker:
 			// cleanup
@@ -0,0 +1,64 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that new work is pushed to the notification URLs and that the pushed
+// work is tracked for accepting solutions.
+func TestRemoteAgentNotify(t *testing.T) {
+	sink := make(chan [3]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var work [3]string
+		if err := json.NewDecoder(req.Body).Decode(&work); err != nil {
+			t.Errorf("failed to decode notification: %v", err)
+		}
+		sink <- work
+	}))
+	defer server.Close()
+
+	agent := NewRemoteAgent(nil, nil, []string{server.URL})
+	agent.Start()
+	defer agent.Stop()
+
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(100)})
+	agent.Work() <- &Work{Block: block, createdAt: time.Now()}
+
+	select {
+	case work := <-sink:
+		if want := workPackage(block); work != want {
+			t.Fatalf("work package mismatch: have %v, want %v", work, want)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("notification timeout")
+	}
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	if agent.work[block.HashNoNonce()] == nil {
+		t.Errorf("pushed work not tracked")
+	}
+}
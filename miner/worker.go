@@ -42,6 +42,18 @@ import (
 const (
 	resultQueueSize  = 10
 	miningLogAtDepth = 5
+
+	// txChanSize is the size of channel listening to NewTxsEvent.
+	// The number is referenced from the size of tx pool.
+	txChanSize = 4096
+
+	// minRecommitInterval is the minimal time interval to recreate the block being
+	// mined with any newly arrived transactions.
+	minRecommitInterval = time.Second
+
+	// maxRecommitInterval is the maximal time interval the recommits are backed off
+	// to if they keep failing to make the block being mined more profitable.
+	maxRecommitInterval = 15 * time.Second
 )
 
 // Agent can register themself with the worker
@@ -90,6 +102,8 @@ type worker struct {
 	// update loop
 	mux    *event.TypeMux
 	events *event.TypeMuxSubscription
+	txsCh  chan core.NewTxsEvent
+	txsSub event.Subscription
 	wg     sync.WaitGroup
 
 	agents map[Agent]struct{}
@@ -118,10 +132,13 @@ type worker struct {
 	mining int32
 	atWork int32
 
+	recommit   time.Duration      // Initial base interval to recreate the block being mined at
+	recommitCh chan time.Duration // Channel to notify the update loop of a changed recommit interval
+
 	fullValidation bool
 }
 
-func newWorker(config *params.ChainConfig, engine consensus.Engine, coinbase common.Address, eth Backend, mux *event.TypeMux) *worker {
+func newWorker(config *params.ChainConfig, engine consensus.Engine, coinbase common.Address, eth Backend, mux *event.TypeMux, recommit time.Duration) *worker {
 	worker := &worker{
 		config:         config,
 		engine:         engine,
@@ -137,8 +154,14 @@ func newWorker(config *params.ChainConfig, engine consensus.Engine, coinbase com
 		agents:         make(map[Agent]struct{}),
 		unconfirmed:    newUnconfirmedBlocks(eth.BlockChain(), 5),
 		fullValidation: false,
-	}
-	worker.events = worker.mux.Subscribe(core.ChainHeadEvent{}, core.ChainSideEvent{}, core.TxPreEvent{})
+		recommit:       recommit,
+		recommitCh:     make(chan time.Duration),
+		txsCh:          make(chan core.NewTxsEvent, txChanSize),
+	}
+	// Subscribe NewTxsEvent for tx pool
+	worker.txsSub = eth.TxPool().SubscribeNewTxsEvent(worker.txsCh)
+	// Subscribe events for blockchain
+	worker.events = worker.mux.Subscribe(core.ChainHeadEvent{}, core.ChainSideEvent{})
 	go worker.update()
 
 	go worker.wait()
@@ -159,6 +182,21 @@ func (self *worker) setExtra(extra []byte) {
 	self.extra = extra
 }
 
+// setRecommitInterval updates the base interval to recreate the block being mined
+// at, to include any better paying transactions.
+func (self *worker) setRecommitInterval(interval time.Duration) {
+	self.recommitCh <- interval
+}
+
+// sanitizeRecommit caps the recommit interval to the allowed minimum.
+func sanitizeRecommit(interval time.Duration) time.Duration {
+	if interval < minRecommitInterval {
+		log.Warn("Sanitizing miner recommit interval", "provided", interval, "updated", minRecommitInterval)
+		interval = minRecommitInterval
+	}
+	return interval
+}
+
 func (self *worker) pending() (*types.Block, *state.StateDB) {
 	self.currentMu.Lock()
 	defer self.currentMu.Unlock()
@@ -229,32 +267,165 @@ func (self *worker) unregister(agent Agent) {
 	agent.Stop()
 }
 
+// update reacts to chain and transaction pool events, recreating the block being
+// mined whenever it can be improved.
+//
+// New heads and usable uncles are committed right away. Better paying transactions
+// are accumulated and committed on the next recommit tick. Every recommit that
+// fails to make the block more profitable backs the interval off, until a new head
+// or a successful recommit resets it to the configured base.
 func (self *worker) update() {
-	for event := range self.events.Chan() {
-		// A real event arrived, process interesting content
-		switch ev := event.Data.(type) {
-		case core.ChainHeadEvent:
-			self.commitNewWork()
-		case core.ChainSideEvent:
-			self.uncleMu.Lock()
-			self.possibleUncles[ev.Block.Hash()] = ev.Block
-			self.uncleMu.Unlock()
-		case core.TxPreEvent:
-			// Apply transaction to the pending state if we're not mining
+	defer self.txsSub.Unsubscribe()
+
+	var (
+		base     = sanitizeRecommit(self.recommit)
+		interval = base
+		timer    = time.NewTimer(interval)
+		dirty    bool // Whether better paying transactions arrived since the last commit
+	)
+	defer timer.Stop()
+
+	for {
+		select {
+		case event, ok := <-self.events.Chan():
+			if !ok {
+				return
+			}
+			// A real event arrived, process interesting content
+			switch ev := event.Data.(type) {
+			case core.ChainHeadEvent:
+				self.commitNewWork()
+				dirty, interval = false, base
+
+			case core.ChainSideEvent:
+				self.uncleMu.Lock()
+				self.possibleUncles[ev.Block.Hash()] = ev.Block
+				self.uncleMu.Unlock()
+
+				// Include the uncle right away if the block being mined has room for it
+				if atomic.LoadInt32(&self.mining) == 1 && self.acceptsUncle(ev.Block.Header()) {
+					self.commitNewWork()
+					dirty = false
+				}
+			}
+		case ev := <-self.txsCh:
+			// Apply transactions to the pending state if we're not mining
 			if atomic.LoadInt32(&self.mining) == 0 {
 				self.currentMu.Lock()
 
-				acc, _ := types.Sender(self.current.signer, ev.Tx)
-				txs := map[common.Address]types.Transactions{acc: {ev.Tx}}
-				txset := types.NewTransactionsByPriceAndNonce(txs)
+				txs := make(map[common.Address]types.Transactions)
+				for _, tx := range ev.Txs {
+					acc, _ := types.Sender(self.current.signer, tx)
+					txs[acc] = append(txs[acc], tx)
+				}
+				txset := types.NewTransactionsByPriceAndNonce(txs, self.current.header.BaseFee)
 
 				self.current.commitTransactions(self.mux, txset, self.chain, self.coinbase)
 				self.currentMu.Unlock()
+			} else {
+				// Instant chains don't seal empty blocks, restart sealing with the new transactions
+				if self.config.Clique != nil && self.config.Clique.Period == 0 {
+					self.commitNewWork()
+					continue
+				}
+				for _, tx := range ev.Txs {
+					if self.acceptsTransaction(tx) {
+						dirty = true
+						break
+					}
+				}
+			}
+		// System stopped
+		case <-self.txsSub.Err():
+			return
+		case <-timer.C:
+			if dirty && atomic.LoadInt32(&self.mining) == 1 && !self.sealingClose(interval) {
+				fees := self.currentFees()
+				self.commitNewWork()
+
+				if self.currentFees().Cmp(fees) > 0 {
+					interval = base
+				} else if interval = interval * 3 / 2; interval > maxRecommitInterval {
+					interval = maxRecommitInterval
+				}
+				dirty = false
 			}
+			timer.Reset(interval)
+
+		case recommit := <-self.recommitCh:
+			base = sanitizeRecommit(recommit)
+			log.Info("Miner recommit interval update", "from", interval, "to", base)
+			interval = base
 		}
 	}
 }
 
+// acceptsUncle checks whether the block being mined has room for one more uncle
+// and the given header qualifies as such.
+func (self *worker) acceptsUncle(uncle *types.Header) bool {
+	self.currentMu.Lock()
+	defer self.currentMu.Unlock()
+
+	work := self.current
+	if work == nil || work.uncles.Size() >= 2 {
+		return false
+	}
+	hash := uncle.Hash()
+	return work.ancestors.Has(uncle.ParentHash) && !work.family.Has(hash) && !work.uncles.Has(hash)
+}
+
+// acceptsTransaction checks whether the given transaction could make the block
+// being mined more profitable: either it still fits into the block, or it pays
+// more than the cheapest transaction already included.
+func (self *worker) acceptsTransaction(tx *types.Transaction) bool {
+	self.currentMu.Lock()
+	defer self.currentMu.Unlock()
+
+	work := self.current
+	if work == nil {
+		return false
+	}
+	if new(big.Int).Sub(work.header.GasLimit, work.header.GasUsed).Cmp(tx.Gas()) >= 0 {
+		return true
+	}
+	for _, included := range work.txs {
+		if included.GasPrice().Cmp(tx.GasPrice()) < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// currentFees returns the total transaction fees collected by the block being
+// mined.
+func (self *worker) currentFees() *big.Int {
+	self.currentMu.Lock()
+	defer self.currentMu.Unlock()
+
+	fees := new(big.Int)
+	if self.current == nil {
+		return fees
+	}
+	for i, tx := range self.current.txs {
+		fees.Add(fees, new(big.Int).Mul(self.current.receipts[i].GasUsed, tx.GasPrice()))
+	}
+	return fees
+}
+
+// sealingClose checks whether the block being mined is due to be sealed within
+// the given interval, in which case recreating it would only risk missing the
+// slot. This is only ever the case for engines sealing at the header timestamp.
+func (self *worker) sealingClose(interval time.Duration) bool {
+	self.currentMu.Lock()
+	defer self.currentMu.Unlock()
+
+	if self.config.Clique == nil || self.current == nil {
+		return false
+	}
+	delay := time.Unix(self.current.header.Time.Int64(), 0).Sub(time.Now())
+	return delay < interval
+}
+
 func (self *worker) wait() {
 	for {
 		mustCommitNewWork := true
@@ -294,8 +465,6 @@ func (self *worker) wait() {
 				if stat == core.CanonStatTy {
 					// This puts transactions in a extra db for rpc
 					core.WriteTxLookupEntries(self.chainDb, block)
-					// Write map map bloom filters
-					core.WriteMipmapBloom(self.chainDb, block.NumberU64(), work.receipts)
 					// implicit by posting ChainHeadEvent
 					mustCommitNewWork = false
 				}
@@ -404,6 +573,14 @@ func (self *worker) commitNewWork() {
 		Extra:      self.extra,
 		Time:       big.NewInt(tstamp),
 	}
+	// Set the base fee post London, doubling the gas limit at the fork to keep
+	// the gas target of the parent
+	if self.config.IsLondon(header.Number) {
+		header.BaseFee = misc.CalcBaseFee(self.config, parent.Header())
+		if !self.config.IsLondon(parent.Number()) {
+			header.GasLimit.Mul(header.GasLimit, new(big.Int).SetUint64(params.ElasticityMultiplier))
+		}
+	}
 	// Only set the coinbase if we are mining (avoid spurious block rewards)
 	if atomic.LoadInt32(&self.mining) == 1 {
 		header.Coinbase = self.coinbase
@@ -441,7 +618,7 @@ func (self *worker) commitNewWork() {
 		log.Error("Failed to fetch pending transactions", "err", err)
 		return
 	}
-	txs := types.NewTransactionsByPriceAndNonce(pending)
+	txs := types.NewTransactionsByPriceAndNonce(pending, header.BaseFee)
 	work.commitTransactions(self.mux, txs, self.chain, self.coinbase)
 
 	self.eth.TxPool().RemoveBatch(work.failedTxs)
@@ -18,17 +18,23 @@ package node
 
 import (
 	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/external"
+	"github.com/ethereum/go-ethereum/accounts/hdwallet"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/accounts/usbwallet"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p"
@@ -41,6 +47,7 @@ var (
 	datadirStaticNodes     = "static-nodes.json"  // Path within the datadir to the static node list
 	datadirTrustedNodes    = "trusted-nodes.json" // Path within the datadir to the trusted node list
 	datadirNodeDatabase    = "nodes"              // Path within the datadir to store the node infos
+	datadirJWTSecret       = "jwtsecret"          // Path within the datadir to the authenticated RPC secret
 )
 
 // Config represents a small collection of configuration values to fine tune the
@@ -82,9 +89,20 @@ type Config struct {
 	// scrypt KDF at the expense of security.
 	UseLightweightKDF bool `toml:",omitempty"`
 
+	// KeyStoreScryptN and KeyStoreScryptP override the scrypt parameters used to
+	// encrypt newly stored keys. If both are zero, the standard or lightweight
+	// preset is used, as selected by UseLightweightKDF. N may not exceed the
+	// standard preset.
+	KeyStoreScryptN int `toml:",omitempty"`
+	KeyStoreScryptP int `toml:",omitempty"`
+
 	// NoUSB disables hardware wallet monitoring and connectivity.
 	NoUSB bool `toml:",omitempty"`
 
+	// ExternalSigner is the IPC path or HTTP URL of an external signer. If set, all
+	// accounts are managed and signed by it instead of the local key store.
+	ExternalSigner string `toml:",omitempty"`
+
 	// IPCPath is the requested location to place the IPC endpoint. If the path is
 	// a simple file name, it is placed inside the data directory (or on the root
 	// pipe path on Windows), whereas if it's a resolvable path name (absolute or
@@ -110,6 +128,18 @@ type Config struct {
 	// exposed.
 	HTTPModules []string `toml:",omitempty"`
 
+	// HTTPVirtualHosts is the list of virtual hostnames allowed in the Host header
+	// of incoming HTTP requests, '*' allowing any. Checking the Host header
+	// prevents DNS rebinding attacks, which bypass the same-origin policy of
+	// browsers by pointing a malicious domain at the node. Requests addressing an
+	// IP directly are always allowed. An empty list disables the check.
+	HTTPVirtualHosts []string `toml:",omitempty"`
+
+	// HTTPPaths maps additional paths of the HTTP RPC endpoint to the API modules
+	// exposed on them, e.g. to serve the debug module under /debug to local
+	// clients only.
+	HTTPPaths map[string]HTTPPath `toml:",omitempty"`
+
 	// WSHost is the host interface on which to start the websocket RPC server. If
 	// this field is empty, no websocket API endpoint will be started.
 	WSHost string `toml:",omitempty"`
@@ -128,6 +158,54 @@ type Config struct {
 	// If the module list is empty, all RPC API endpoints designated public will be
 	// exposed.
 	WSModules []string `toml:",omitempty"`
+
+	// AuthHost is the host interface on which to start the authenticated RPC
+	// server, serving both HTTP and websocket requests. If this field is empty,
+	// no authenticated API endpoint will be started.
+	AuthHost string `toml:",omitempty"`
+
+	// AuthPort is the TCP port number on which to start the authenticated RPC
+	// server. The default zero value is valid and will pick a port number randomly
+	// (useful for ephemeral nodes).
+	AuthPort int `toml:",omitempty"`
+
+	// AuthModules is a list of API modules to expose via the authenticated RPC
+	// interface. Unlike the public endpoints, non-public APIs may be listed.
+	AuthModules []string `toml:",omitempty"`
+
+	// JWTSecret is the path to the hex encoded 32 byte secret authenticating the
+	// requests of the authenticated RPC interface. If empty, the secret is kept in
+	// the instance directory. A new secret is generated if the file doesn't exist.
+	JWTSecret string `toml:",omitempty"`
+
+	// BatchRequestLimit is the maximum number of requests in a batch accepted by
+	// the IPC, HTTP and websocket RPC servers. Zero means no limit.
+	BatchRequestLimit int `toml:",omitempty"`
+
+	// BatchResponseMaxSize is the maximum total size in bytes of the responses to
+	// a batch, further requests of the batch being answered with an error. Zero
+	// means no limit.
+	BatchResponseMaxSize int `toml:",omitempty"`
+
+	// MethodConcurrencyLimit is the maximum number of concurrent executions of any
+	// single RPC method, further calls being rejected until one finishes. Zero
+	// means no limit.
+	MethodConcurrencyLimit int `toml:",omitempty"`
+
+	// SlowCallThreshold is the execution time beyond which RPC method calls are
+	// logged as slow by the IPC, HTTP, websocket and authenticated RPC servers.
+	// Zero disables logging.
+	SlowCallThreshold time.Duration `toml:",omitempty"`
+}
+
+// HTTPPath is the exposure policy of an additional path of the HTTP RPC endpoint.
+type HTTPPath struct {
+	// Modules is the list of API modules to expose on the path. If the list is
+	// empty, all RPC API endpoints designated public will be exposed.
+	Modules []string `toml:",omitempty"`
+
+	// LocalOnly restricts access to the path to clients on the loopback interface.
+	LocalOnly bool `toml:",omitempty"`
 }
 
 // IPCEndpoint resolves an IPC endpoint based on a configured value, taking into
@@ -205,6 +283,21 @@ func DefaultWSEndpoint() string {
 	return config.WSEndpoint()
 }
 
+// AuthEndpoint resolves the authenticated RPC endpoint based on the configured
+// host interface and port parameters.
+func (c *Config) AuthEndpoint() string {
+	if c.AuthHost == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", c.AuthHost, c.AuthPort)
+}
+
+// DefaultAuthEndpoint returns the authenticated RPC endpoint used by default.
+func DefaultAuthEndpoint() string {
+	config := &Config{AuthHost: DefaultAuthHost, AuthPort: DefaultAuthPort}
+	return config.AuthEndpoint()
+}
+
 // NodeName returns the devp2p node identifier.
 func (c *Config) NodeName() string {
 	name := c.name()
@@ -311,6 +404,51 @@ func (c *Config) NodeKey() *ecdsa.PrivateKey {
 	return key
 }
 
+// AuthSecret retrieves the secret authenticating the requests of the
+// authenticated RPC interface, loading it from the configured file or the
+// instance directory. If no secret can be found, a new one is generated and
+// persisted.
+func (c *Config) AuthSecret() ([]byte, error) {
+	path := c.JWTSecret
+	if path == "" {
+		path = c.resolvePath(datadirJWTSecret)
+	}
+	// Generate an ephemeral secret if no datadir is being used.
+	if path == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		log.Warn("Generated ephemeral JWT secret", "secret", hexutil.Encode(secret))
+		return secret, nil
+	}
+	if blob, err := ioutil.ReadFile(path); err == nil {
+		secret, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(blob)), "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT secret %s: %v", path, err)
+		}
+		if len(secret) != 32 {
+			return nil, fmt.Errorf("invalid JWT secret %s: have %d bytes, want 32", path, len(secret))
+		}
+		return secret, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	// No persistent secret found, generate and store a new one.
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path, []byte(hexutil.Encode(secret)), 0600); err != nil {
+		return nil, err
+	}
+	log.Info("Generated JWT secret", "path", path)
+	return secret, nil
+}
+
 // StaticNodes returns a list of node enode URLs configured as static nodes.
 func (c *Config) StaticNodes() []*discover.Node {
 	return c.parsePersistentNodes(c.resolvePath(datadirStaticNodes))
@@ -360,6 +498,17 @@ func makeAccountManager(conf *Config) (*accounts.Manager, string, error) {
 		scryptN = keystore.LightScryptN
 		scryptP = keystore.LightScryptP
 	}
+	if conf.KeyStoreScryptN != 0 || conf.KeyStoreScryptP != 0 {
+		if conf.KeyStoreScryptN != 0 {
+			scryptN = conf.KeyStoreScryptN
+		}
+		if conf.KeyStoreScryptP != 0 {
+			scryptP = conf.KeyStoreScryptP
+		}
+		if err := keystore.ValidateScryptParams(scryptN, scryptP); err != nil {
+			return nil, "", err
+		}
+	}
 
 	var (
 		keydir    string
@@ -388,16 +537,33 @@ func makeAccountManager(conf *Config) (*accounts.Manager, string, error) {
 	if err := os.MkdirAll(keydir, 0700); err != nil {
 		return nil, "", err
 	}
-	// Assemble the account manager and supported backends
+	// Assemble the account manager and supported backends, an external signer
+	// replacing all local ones
+	if conf.ExternalSigner != "" {
+		log.Info("Using external signer", "endpoint", conf.ExternalSigner)
+		extapi, err := external.NewBackend(conf.ExternalSigner)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to connect to external signer: %v", err)
+		}
+		return accounts.NewManager(extapi), ephemeral, nil
+	}
 	backends := []accounts.Backend{
 		keystore.NewKeyStore(keydir, scryptN, scryptP),
+		hdwallet.NewHub(),
 	}
 	if !conf.NoUSB {
+		// Start a USB hub for Ledger hardware wallets
 		if ledgerhub, err := usbwallet.NewLedgerHub(); err != nil {
 			log.Warn(fmt.Sprintf("Failed to start Ledger hub, disabling: %v", err))
 		} else {
 			backends = append(backends, ledgerhub)
 		}
+		// Start a USB hub for Trezor hardware wallets
+		if trezorhub, err := usbwallet.NewTrezorHub(); err != nil {
+			log.Warn(fmt.Sprintf("Failed to start Trezor hub, disabling: %v", err))
+		} else {
+			backends = append(backends, trezorhub)
+		}
 	}
 	return accounts.NewManager(backends...), ephemeral, nil
 }
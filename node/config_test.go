@@ -22,6 +22,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/crypto"
@@ -148,3 +149,49 @@ func TestNodeKeyPersistency(t *testing.T) {
 		t.Fatalf("ephemeral node key persisted to disk")
 	}
 }
+
+// Tests that JWT secrets can be correctly created, persisted, loaded and
+// rejected if malformed.
+func TestAuthSecretPersistency(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node-test")
+	if err != nil {
+		t.Fatalf("failed to create temporary data directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Ensure a missing secret is generated and persisted into the instance directory
+	config := &Config{Name: "unit-test", DataDir: dir}
+	secret1, err := config.AuthSecret()
+	if err != nil {
+		t.Fatalf("failed to generate secret: %v", err)
+	}
+	if len(secret1) != 32 {
+		t.Fatalf("secret length mismatch: have %d, want 32", len(secret1))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "unit-test", datadirJWTSecret)); err != nil {
+		t.Fatalf("secret not persisted to data directory: %v", err)
+	}
+	// Ensure the previously persisted secret is loaded
+	secret2, err := config.AuthSecret()
+	if err != nil {
+		t.Fatalf("failed to load persisted secret: %v", err)
+	}
+	if !bytes.Equal(secret1, secret2) {
+		t.Fatalf("persisted secret mismatch: have %x, want %x", secret2, secret1)
+	}
+	// Ensure explicitly configured secrets are used and validated
+	path := filepath.Join(dir, "custom")
+	if err := ioutil.WriteFile(path, []byte("0x"+strings.Repeat("ab", 32)+"\n"), 0600); err != nil {
+		t.Fatalf("failed to write secret: %v", err)
+	}
+	config = &Config{Name: "unit-test", DataDir: dir, JWTSecret: path}
+	if secret, err := config.AuthSecret(); err != nil || !bytes.Equal(secret, bytes.Repeat([]byte{0xab}, 32)) {
+		t.Fatalf("configured secret mismatch: have %x, %v", secret, err)
+	}
+	if err := ioutil.WriteFile(path, []byte("abab"), 0600); err != nil {
+		t.Fatalf("failed to write secret: %v", err)
+	}
+	if _, err := config.AuthSecret(); err == nil {
+		t.Fatalf("short secret accepted")
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -68,15 +69,21 @@ type Node struct {
 	ipcListener net.Listener // IPC RPC listener socket to serve API requests
 	ipcHandler  *rpc.Server  // IPC RPC request handler to process the API requests
 
-	httpEndpoint  string       // HTTP endpoint (interface + port) to listen at (empty = HTTP disabled)
-	httpWhitelist []string     // HTTP RPC modules to allow through this endpoint
-	httpListener  net.Listener // HTTP RPC listener socket to server API requests
-	httpHandler   *rpc.Server  // HTTP RPC request handler to process the API requests
+	httpEndpoint  string                  // HTTP endpoint (interface + port) to listen at (empty = HTTP disabled)
+	httpWhitelist []string                // HTTP RPC modules to allow through this endpoint
+	httpListener  net.Listener            // HTTP RPC listener socket to server API requests
+	httpHandler   *rpc.Server             // HTTP RPC request handler to process the API requests
+	httpPaths     []*rpc.Server           // HTTP RPC request handlers of the additional paths
+	httpHandlers  map[string]http.Handler // Custom HTTP handlers mounted by the services
 
 	wsEndpoint string       // Websocket endpoint (interface + port) to listen at (empty = websocket disabled)
 	wsListener net.Listener // Websocket RPC listener socket to server API requests
 	wsHandler  *rpc.Server  // Websocket RPC request handler to process the API requests
 
+	authEndpoint string       // Authenticated RPC endpoint (interface + port) to listen at (empty = disabled)
+	authListener net.Listener // Authenticated RPC listener socket to serve API requests
+	authHandler  *rpc.Server  // Authenticated RPC request handler to process the API requests
+
 	stop chan struct{} // Channel to wait for termination notifications
 	lock sync.RWMutex
 }
@@ -121,6 +128,7 @@ func New(conf *Config) (*Node, error) {
 		ipcEndpoint:       conf.IPCEndpoint(),
 		httpEndpoint:      conf.HTTPEndpoint(),
 		wsEndpoint:        conf.WSEndpoint(),
+		authEndpoint:      conf.AuthEndpoint(),
 		eventmux:          new(event.TypeMux),
 	}, nil
 }
@@ -170,11 +178,13 @@ func (n *Node) Start() error {
 
 	// Otherwise copy and specialize the P2P configuration
 	services := make(map[reflect.Type]Service)
+	handlers := make(map[string]http.Handler)
 	for _, constructor := range n.serviceFuncs {
 		// Create a new context for the particular service
 		ctx := &ServiceContext{
 			config:         n.config,
 			services:       make(map[reflect.Type]Service),
+			handlers:       handlers,
 			EventMux:       n.eventmux,
 			AccountManager: n.accman,
 		}
@@ -218,6 +228,7 @@ func (n *Node) Start() error {
 		started = append(started, kind)
 	}
 	// Lastly start the configured RPC interfaces
+	n.httpHandlers = handlers
 	if err := n.startRPC(services); err != nil {
 		for _, service := range services {
 			service.Stop()
@@ -270,7 +281,7 @@ func (n *Node) startRPC(services map[reflect.Type]Service) error {
 		n.stopInProc()
 		return err
 	}
-	if err := n.startHTTP(n.httpEndpoint, apis, n.config.HTTPModules, n.config.HTTPCors); err != nil {
+	if err := n.startHTTP(n.httpEndpoint, apis, n.config.HTTPModules, n.config.HTTPCors, n.config.HTTPVirtualHosts); err != nil {
 		n.stopIPC()
 		n.stopInProc()
 		return err
@@ -281,11 +292,28 @@ func (n *Node) startRPC(services map[reflect.Type]Service) error {
 		n.stopInProc()
 		return err
 	}
+	if err := n.startAuth(n.authEndpoint, apis, n.config.AuthModules); err != nil {
+		n.stopWS()
+		n.stopHTTP()
+		n.stopIPC()
+		n.stopInProc()
+		return err
+	}
 	// All API endpoints started successfully
 	n.rpcAPIs = apis
 	return nil
 }
 
+// newRPCServer creates an RPC server for an external endpoint, enforcing the
+// configured request limits and slow call logging.
+func (n *Node) newRPCServer() *rpc.Server {
+	handler := rpc.NewServer()
+	handler.SetBatchLimits(n.config.BatchRequestLimit, n.config.BatchResponseMaxSize)
+	handler.SetMethodConcurrency(n.config.MethodConcurrencyLimit)
+	handler.SetSlowCallThreshold(n.config.SlowCallThreshold)
+	return handler
+}
+
 // startInProc initializes an in-process RPC endpoint.
 func (n *Node) startInProc(apis []rpc.API) error {
 	// Register all the APIs exposed by the services
@@ -315,7 +343,7 @@ func (n *Node) startIPC(apis []rpc.API) error {
 		return nil
 	}
 	// Register all the APIs exposed by the services
-	handler := rpc.NewServer()
+	handler := n.newRPCServer()
 	for _, api := range apis {
 		if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
 			return err
@@ -372,45 +400,76 @@ func (n *Node) stopIPC() {
 }
 
 // startHTTP initializes and starts the HTTP RPC endpoint.
-func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors []string) error {
+func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors []string, vhosts []string) error {
 	// Short circuit if the HTTP endpoint isn't being exposed
 	if endpoint == "" {
 		return nil
 	}
-	// Generate the whitelist based on the allowed modules
-	whitelist := make(map[string]bool)
-	for _, module := range modules {
-		whitelist[module] = true
+	// Register all the APIs exposed by the services, on the root and the additional paths
+	handler, err := n.newHTTPHandler(apis, modules)
+	if err != nil {
+		return err
 	}
-	// Register all the APIs exposed by the services
-	handler := rpc.NewServer()
-	for _, api := range apis {
-		if whitelist[api.Namespace] || (len(whitelist) == 0 && api.Public) {
-			if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
-				return err
-			}
-			log.Debug(fmt.Sprintf("HTTP registered %T under '%s'", api.Service, api.Namespace))
+	mux := http.NewServeMux()
+	mux.Handle("/", handler)
+
+	var paths []*rpc.Server
+	for path, policy := range n.config.HTTPPaths {
+		pathHandler, err := n.newHTTPHandler(apis, policy.Modules)
+		if err != nil {
+			return err
 		}
+		var served http.Handler = pathHandler
+		if policy.LocalOnly {
+			served = rpc.NewLocalHandler(pathHandler)
+		}
+		mux.Handle(path, served)
+		paths = append(paths, pathHandler)
+
+		log.Debug(fmt.Sprintf("HTTP exposed %v under '%s' (local only: %v)", policy.Modules, path, policy.LocalOnly))
+	}
+	// Mount the custom handlers of the services next to the RPC API
+	for path, custom := range n.httpHandlers {
+		mux.Handle(path, custom)
+		log.Debug(fmt.Sprintf("HTTP registered %T under '%s'", custom, path))
 	}
 	// All APIs registered, start the HTTP listener
-	var (
-		listener net.Listener
-		err      error
-	)
-	if listener, err = net.Listen("tcp", endpoint); err != nil {
+	listener, err := net.Listen("tcp", endpoint)
+	if err != nil {
 		return err
 	}
-	go rpc.NewHTTPServer(cors, handler).Serve(listener)
+	go rpc.NewHTTPServer(cors, vhosts, mux).Serve(listener)
 	log.Info(fmt.Sprintf("HTTP endpoint opened: http://%s", endpoint))
 
 	// All listeners booted successfully
 	n.httpEndpoint = endpoint
 	n.httpListener = listener
 	n.httpHandler = handler
+	n.httpPaths = paths
 
 	return nil
 }
 
+// newHTTPHandler creates an HTTP RPC request handler serving the APIs of the
+// given modules, or all public ones if no modules are given.
+func (n *Node) newHTTPHandler(apis []rpc.API, modules []string) (*rpc.Server, error) {
+	// Generate the whitelist based on the allowed modules
+	whitelist := make(map[string]bool)
+	for _, module := range modules {
+		whitelist[module] = true
+	}
+	handler := n.newRPCServer()
+	for _, api := range apis {
+		if whitelist[api.Namespace] || (len(whitelist) == 0 && api.Public) {
+			if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
+				return nil, err
+			}
+			log.Debug(fmt.Sprintf("HTTP registered %T under '%s'", api.Service, api.Namespace))
+		}
+	}
+	return handler, nil
+}
+
 // stopHTTP terminates the HTTP RPC endpoint.
 func (n *Node) stopHTTP() {
 	if n.httpListener != nil {
@@ -423,6 +482,10 @@ func (n *Node) stopHTTP() {
 		n.httpHandler.Stop()
 		n.httpHandler = nil
 	}
+	for _, handler := range n.httpPaths {
+		handler.Stop()
+	}
+	n.httpPaths = nil
 }
 
 // startWS initializes and starts the websocket RPC endpoint.
@@ -437,7 +500,7 @@ func (n *Node) startWS(endpoint string, apis []rpc.API, modules []string, wsOrig
 		whitelist[module] = true
 	}
 	// Register all the APIs exposed by the services
-	handler := rpc.NewServer()
+	handler := n.newRPCServer()
 	for _, api := range apis {
 		if whitelist[api.Namespace] || (len(whitelist) == 0 && api.Public) {
 			if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
@@ -479,6 +542,71 @@ func (n *Node) stopWS() {
 	}
 }
 
+// startAuth initializes and starts the authenticated RPC endpoint, serving both
+// HTTP and websocket requests signed with the shared JWT secret.
+func (n *Node) startAuth(endpoint string, apis []rpc.API, modules []string) error {
+	// Short circuit if the authenticated endpoint isn't being exposed
+	if endpoint == "" {
+		return nil
+	}
+	secret, err := n.config.AuthSecret()
+	if err != nil {
+		return err
+	}
+	// Register the whitelisted APIs, regardless of them being public
+	whitelist := make(map[string]bool)
+	for _, module := range modules {
+		whitelist[module] = true
+	}
+	handler := n.newRPCServer()
+	for _, api := range apis {
+		if whitelist[api.Namespace] {
+			if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
+				return err
+			}
+			log.Debug(fmt.Sprintf("Auth registered %T under '%s'", api.Service, api.Namespace))
+		}
+	}
+	// Dispatch websocket upgrades and plain HTTP requests to the same server.
+	// Origins aren't checked, the token authenticates the client.
+	ws := handler.WebsocketHandler([]string{"*"})
+	dispatch := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			ws.ServeHTTP(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+	// All APIs registered, start the listener
+	listener, err := net.Listen("tcp", endpoint)
+	if err != nil {
+		return err
+	}
+	go (&http.Server{Handler: rpc.NewJWTHandler(secret, dispatch)}).Serve(listener)
+	log.Info(fmt.Sprintf("Authenticated RPC endpoint opened: http://%s", endpoint))
+
+	// All listeners booted successfully
+	n.authEndpoint = endpoint
+	n.authListener = listener
+	n.authHandler = handler
+
+	return nil
+}
+
+// stopAuth terminates the authenticated RPC endpoint.
+func (n *Node) stopAuth() {
+	if n.authListener != nil {
+		n.authListener.Close()
+		n.authListener = nil
+
+		log.Info(fmt.Sprintf("Authenticated RPC endpoint closed: http://%s", n.authEndpoint))
+	}
+	if n.authHandler != nil {
+		n.authHandler.Stop()
+		n.authHandler = nil
+	}
+}
+
 // Stop terminates a running node along with all it's services. In the node was
 // not started, an error is returned.
 func (n *Node) Stop() error {
@@ -491,6 +619,7 @@ func (n *Node) Stop() error {
 	}
 
 	// Terminate the API, services and the p2p server.
+	n.stopAuth()
 	n.stopWS()
 	n.stopHTTP()
 	n.stopIPC()
@@ -627,6 +756,12 @@ func (n *Node) WSEndpoint() string {
 	return n.wsEndpoint
 }
 
+// AuthEndpoint retrieves the current authenticated RPC endpoint used by the
+// protocol stack.
+func (n *Node) AuthEndpoint() string {
+	return n.authEndpoint
+}
+
 // EventMux retrieves the event multiplexer used by all the network services in
 // the current protocol stack.
 func (n *Node) EventMux() *event.TypeMux {
@@ -643,6 +778,29 @@ func (n *Node) OpenDatabase(name string, cache, handles int) (ethdb.Database, er
 	return ethdb.NewLDBDatabase(n.config.resolvePath(name), cache, handles)
 }
 
+// OpenDatabaseWithFreezer opens an existing database with the given name (or
+// creates one if no previous can be found) from within the node's instance
+// directory, also attaching a chain freezer to it that moves ancient chain data
+// from the database to immutable append-only files. If the freezer directory is
+// empty, it defaults to the "ancient" folder within the database. If the node is
+// ephemeral, a memory database is returned.
+func (n *Node) OpenDatabaseWithFreezer(name string, cache, handles int, freezer string) (ethdb.Database, error) {
+	if n.config.DataDir == "" {
+		return ethdb.NewMemDatabase()
+	}
+	root := n.config.resolvePath(name)
+	if freezer == "" {
+		freezer = filepath.Join(root, "ancient")
+	} else {
+		freezer = n.config.resolvePath(freezer)
+	}
+	db, err := ethdb.NewLDBDatabaseWithFreezer(root, cache, handles, freezer)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
 // ResolvePath returns the absolute path of a resource in the instance directory.
 func (n *Node) ResolvePath(x string) string {
 	return n.config.resolvePath(x)
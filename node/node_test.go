@@ -17,16 +17,24 @@
 package node
 
 import (
+	"bytes"
 	"errors"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/net/websocket"
 )
 
 var (
@@ -573,3 +581,200 @@ func TestAPIGather(t *testing.T) {
 		}
 	}
 }
+
+// Tests that custom HTTP handlers registered by the services are served next to
+// the JSON-RPC API on the HTTP endpoint.
+func TestHTTPHandlerGather(t *testing.T) {
+	config := testNodeConfig()
+	config.HTTPHost = "127.0.0.1"
+
+	stack, err := New(config)
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	constructor := func(ctx *ServiceContext) (Service, error) {
+		ctx.RegisterHTTPHandler("/custom", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "custom")
+		}))
+		return new(NoopService), nil
+	}
+	if err := stack.Register(constructor); err != nil {
+		t.Fatalf("failed to register service: %v", err)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start protocol stack: %v", err)
+	}
+	defer stack.Stop()
+
+	endpoint := "http://" + stack.httpListener.Addr().String()
+
+	// Ensure the custom handler is reachable on its own path
+	res, err := http.Get(endpoint + "/custom")
+	if err != nil {
+		t.Fatalf("failed to query custom handler: %v", err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "custom" {
+		t.Errorf("custom handler response mismatch: have %q, want %q", body, "custom")
+	}
+	// Ensure the JSON-RPC API is still served on the root
+	client, err := rpc.Dial(endpoint)
+	if err != nil {
+		t.Fatalf("failed to connect to the HTTP API server: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.SupportedModules(); err != nil {
+		t.Errorf("failed to query the HTTP API server: %v", err)
+	}
+}
+
+// Tests that additional HTTP paths expose only their own modules.
+func TestHTTPPaths(t *testing.T) {
+	config := testNodeConfig()
+	config.HTTPHost = "127.0.0.1"
+	config.HTTPModules = []string{"single"}
+	config.HTTPPaths = map[string]HTTPPath{
+		"/multi": {Modules: []string{"multi"}, LocalOnly: true},
+	}
+	stack, err := New(config)
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	constructor := func(*ServiceContext) (Service, error) {
+		return &InstrumentedService{apis: []rpc.API{
+			{Namespace: "single", Version: "1", Service: &OneMethodApi{fun: func() {}}},
+			{Namespace: "multi", Version: "1", Service: &OneMethodApi{fun: func() {}}},
+		}}, nil
+	}
+	if err := stack.Register(constructor); err != nil {
+		t.Fatalf("failed to register service: %v", err)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start protocol stack: %v", err)
+	}
+	defer stack.Stop()
+
+	endpoint := "http://" + stack.httpListener.Addr().String()
+	tests := []struct {
+		path   string
+		method string
+		fail   bool
+	}{
+		{"", "single_theOneMethod", false},
+		{"", "multi_theOneMethod", true},
+		{"/multi", "multi_theOneMethod", false},
+		{"/multi", "single_theOneMethod", true},
+	}
+	for i, tt := range tests {
+		client, err := rpc.Dial(endpoint + tt.path)
+		if err != nil {
+			t.Fatalf("test %d: failed to connect to the HTTP API server: %v", i, err)
+		}
+		if err := client.Call(nil, tt.method); (err != nil) != tt.fail {
+			t.Errorf("test %d: call failure mismatch: have %v, want failure %v", i, err, tt.fail)
+		}
+		client.Close()
+	}
+}
+
+// Tests that the authenticated endpoint serves its non-public modules over HTTP
+// and websocket to clients holding the shared secret only.
+func TestAuthEndpoint(t *testing.T) {
+	secret := bytes.Repeat([]byte{0x42}, 32)
+	config := testNodeConfig()
+	config.AuthHost = "127.0.0.1"
+	config.AuthModules = []string{"private"}
+	config.JWTSecret = filepath.Join(os.TempDir(), "auth-endpoint-test.jwtsecret")
+	if err := ioutil.WriteFile(config.JWTSecret, []byte(hexutil.Encode(secret)), 0600); err != nil {
+		t.Fatalf("failed to write secret: %v", err)
+	}
+	defer os.Remove(config.JWTSecret)
+
+	stack, err := New(config)
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	constructor := func(*ServiceContext) (Service, error) {
+		return &InstrumentedService{apis: []rpc.API{
+			{Namespace: "private", Version: "1", Service: &OneMethodApi{fun: func() {}}},
+			{Namespace: "public", Version: "1", Service: &OneMethodApi{fun: func() {}}, Public: true},
+		}}, nil
+	}
+	if err := stack.Register(constructor); err != nil {
+		t.Fatalf("failed to register service: %v", err)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start protocol stack: %v", err)
+	}
+	defer stack.Stop()
+
+	token := func(key []byte) string {
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iat": time.Now().Unix()}).SignedString(key)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return "Bearer " + signed
+	}
+	endpoint := stack.authListener.Addr().String()
+
+	// Check the HTTP requests against the modules and the authentication
+	tests := []struct {
+		auth   string
+		method string
+		code   int
+		result string
+	}{
+		{"", "private_theOneMethod", http.StatusUnauthorized, ""},
+		{token([]byte("wrong secret")), "private_theOneMethod", http.StatusUnauthorized, ""},
+		{token(secret), "private_theOneMethod", http.StatusOK, `"result":null`},
+		{token(secret), "public_theOneMethod", http.StatusOK, `"error"`},
+	}
+	for i, tt := range tests {
+		body := `{"jsonrpc":"2.0","id":1,"method":"` + tt.method + `"}`
+		req, _ := http.NewRequest("POST", "http://"+endpoint, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("test %d: request failed: %v", i, err)
+		}
+		blob, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+
+		if res.StatusCode != tt.code {
+			t.Errorf("test %d: status mismatch: have %d, want %d", i, res.StatusCode, tt.code)
+		}
+		if !strings.Contains(string(blob), tt.result) {
+			t.Errorf("test %d: response mismatch: have %s, want %s", i, blob, tt.result)
+		}
+	}
+	// Check that websocket upgrades are served on the same port
+	wsconfig, err := websocket.NewConfig("ws://"+endpoint, "http://localhost")
+	if err != nil {
+		t.Fatalf("failed to create websocket config: %v", err)
+	}
+	if _, err := websocket.DialConfig(wsconfig); err == nil {
+		t.Fatalf("unauthenticated websocket connection accepted")
+	}
+	wsconfig.Header.Set("Authorization", token(secret))
+	conn, err := websocket.DialConfig(wsconfig)
+	if err != nil {
+		t.Fatalf("failed to connect to the websocket endpoint: %v", err)
+	}
+	defer conn.Close()
+
+	if err := websocket.Message.Send(conn, `{"jsonrpc":"2.0","id":1,"method":"private_theOneMethod"}`); err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	var reply string
+	if err := websocket.Message.Receive(conn, &reply); err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	if !strings.Contains(reply, `"result":null`) {
+		t.Errorf("websocket response mismatch: have %s", reply)
+	}
+}
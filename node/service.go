@@ -17,6 +17,8 @@
 package node
 
 import (
+	"net/http"
+	"path/filepath"
 	"reflect"
 
 	"github.com/ethereum/go-ethereum/accounts"
@@ -32,6 +34,7 @@ import (
 type ServiceContext struct {
 	config         *Config
 	services       map[reflect.Type]Service // Index of the already constructed services
+	handlers       map[string]http.Handler  // Custom HTTP handlers mounted by the services
 	EventMux       *event.TypeMux           // Event multiplexer used for decoupled notifications
 	AccountManager *accounts.Manager        // Account manager created by the node.
 }
@@ -50,6 +53,29 @@ func (ctx *ServiceContext) OpenDatabase(name string, cache int, handles int) (et
 	return db, nil
 }
 
+// OpenDatabaseWithFreezer opens an existing database with the given name (or
+// creates one if no previous can be found) from within the node's data directory,
+// also attaching a chain freezer to it that moves ancient chain data from the
+// database to immutable append-only files. If the freezer directory is empty, it
+// defaults to the "ancient" folder within the database. If the node is an
+// ephemeral one, a memory database is returned.
+func (ctx *ServiceContext) OpenDatabaseWithFreezer(name string, cache int, handles int, freezer string) (ethdb.Database, error) {
+	if ctx.config.DataDir == "" {
+		return ethdb.NewMemDatabase()
+	}
+	root := ctx.config.resolvePath(name)
+	if freezer == "" {
+		freezer = filepath.Join(root, "ancient")
+	} else {
+		freezer = ctx.config.resolvePath(freezer)
+	}
+	db, err := ethdb.NewLDBDatabaseWithFreezer(root, cache, handles, freezer)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
 // ResolvePath resolves a user path into the data directory if that was relative
 // and if the user actually uses persistent storage. It will return an empty string
 // for emphemeral storage and the user's own input for absolute paths.
@@ -57,6 +83,13 @@ func (ctx *ServiceContext) ResolvePath(path string) string {
 	return ctx.config.resolvePath(path)
 }
 
+// RegisterHTTPHandler mounts a custom handler on the given path of the node's
+// HTTP endpoint, served alongside the JSON-RPC API. The handler is ignored if
+// the HTTP endpoint is disabled.
+func (ctx *ServiceContext) RegisterHTTPHandler(path string, handler http.Handler) {
+	ctx.handlers[path] = handler
+}
+
 // Service retrieves a currently running service registered of a specific type.
 func (ctx *ServiceContext) Service(service interface{}) error {
 	element := reflect.ValueOf(service).Elem()
@@ -41,6 +41,8 @@ var (
 		EIP155Block:     big.NewInt(2675000),
 		EIP158Block:     big.NewInt(2675000),
 		MetropolisBlock: big.NewInt(math.MaxInt64), // Don't enable yet
+		BerlinBlock:     nil,
+		LondonBlock:     nil,
 
 		Ethash: new(EthashConfig),
 	}
@@ -56,6 +58,8 @@ var (
 		EIP155Block:     big.NewInt(10),
 		EIP158Block:     big.NewInt(10),
 		MetropolisBlock: big.NewInt(math.MaxInt64), // Don't enable yet
+		BerlinBlock:     nil,
+		LondonBlock:     nil,
 
 		Ethash: new(EthashConfig),
 	}
@@ -71,6 +75,8 @@ var (
 		EIP155Block:     big.NewInt(3),
 		EIP158Block:     big.NewInt(3),
 		MetropolisBlock: big.NewInt(math.MaxInt64), // Don't enable yet
+		BerlinBlock:     nil,
+		LondonBlock:     nil,
 
 		Clique: &CliqueConfig{
 			Period: 15,
@@ -86,9 +92,16 @@ var (
 	// means that all fields must be set at all times. This forces
 	// anyone adding flags to the config to also have to set these
 	// fields.
-	AllProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(math.MaxInt64) /*disabled*/, new(EthashConfig), nil}
-	TestChainConfig    = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), nil, new(EthashConfig), nil}
-	TestRules          = TestChainConfig.Rules(new(big.Int))
+	AllProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(math.MaxInt64) /*disabled*/, big.NewInt(math.MaxInt64) /*disabled*/, big.NewInt(math.MaxInt64) /*disabled*/, nil, new(EthashConfig), nil}
+
+	// AllCliqueProtocolChanges contains every protocol change (EIPs) introduced
+	// and accepted by the Ethereum core developers into the Clique consensus.
+	//
+	// This configuration is intentionally not using keyed fields.
+	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(math.MaxInt64) /*disabled*/, big.NewInt(math.MaxInt64) /*disabled*/, big.NewInt(math.MaxInt64) /*disabled*/, nil, nil, &CliqueConfig{Period: 0, Epoch: 30000}}
+
+	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, new(EthashConfig), nil}
+	TestRules       = TestChainConfig.Rules(new(big.Int))
 )
 
 // ChainConfig is the core config which determines the blockchain settings.
@@ -111,12 +124,24 @@ type ChainConfig struct {
 	EIP158Block *big.Int `json:"eip158Block,omitempty"` // EIP158 HF block
 
 	MetropolisBlock *big.Int `json:"metropolisBlock,omitempty"` // Metropolis switch block (nil = no fork, 0 = alraedy on homestead)
+	BerlinBlock     *big.Int `json:"berlinBlock,omitempty"`     // Berlin switch block (nil = no fork, 0 = already on berlin)
+	LondonBlock     *big.Int `json:"londonBlock,omitempty"`     // London switch block (nil = no fork, 0 = already on london)
+
+	// Precompiles activates additional precompiled contracts, registered in the
+	// virtual machine by name, at custom addresses. Intended for private networks.
+	Precompiles map[common.Address]*PrecompileConfig `json:"precompiles,omitempty"`
 
 	// Various consensus engines
 	Ethash *EthashConfig `json:"ethash,omitempty"`
 	Clique *CliqueConfig `json:"clique,omitempty"`
 }
 
+// PrecompileConfig is the activation schedule of a custom precompiled contract.
+type PrecompileConfig struct {
+	Name  string   `json:"name"`  // Name the contract implementation was registered with
+	Block *big.Int `json:"block"` // Activation block (nil = disabled, 0 = active from genesis)
+}
+
 // EthashConfig is the consensus engine configs for proof-of-work based sealing.
 type EthashConfig struct{}
 
@@ -147,7 +172,7 @@ func (c *ChainConfig) String() string {
 	default:
 		engine = "unknown"
 	}
-	return fmt.Sprintf("{ChainID: %v Homestead: %v DAO: %v DAOSupport: %v EIP150: %v EIP155: %v EIP158: %v Metropolis: %v Engine: %v}",
+	return fmt.Sprintf("{ChainID: %v Homestead: %v DAO: %v DAOSupport: %v EIP150: %v EIP155: %v EIP158: %v Metropolis: %v Berlin: %v London: %v Engine: %v}",
 		c.ChainId,
 		c.HomesteadBlock,
 		c.DAOForkBlock,
@@ -156,6 +181,8 @@ func (c *ChainConfig) String() string {
 		c.EIP155Block,
 		c.EIP158Block,
 		c.MetropolisBlock,
+		c.BerlinBlock,
+		c.LondonBlock,
 		engine,
 	)
 }
@@ -186,6 +213,31 @@ func (c *ChainConfig) IsMetropolis(num *big.Int) bool {
 	return isForked(c.MetropolisBlock, num)
 }
 
+// IsBerlin returns whether num is either equal to the Berlin fork block or greater.
+func (c *ChainConfig) IsBerlin(num *big.Int) bool {
+	return isForked(c.BerlinBlock, num)
+}
+
+// IsLondon returns whether num is either equal to the London fork block or greater.
+func (c *ChainConfig) IsLondon(num *big.Int) bool {
+	return isForked(c.LondonBlock, num)
+}
+
+// ActivePrecompiles returns the custom precompiled contracts active at the given
+// block, mapping their addresses to the names of their implementations.
+func (c *ChainConfig) ActivePrecompiles(num *big.Int) map[common.Address]string {
+	if len(c.Precompiles) == 0 {
+		return nil
+	}
+	active := make(map[common.Address]string)
+	for addr, precompile := range c.Precompiles {
+		if precompile != nil && isForked(precompile.Block, num) {
+			active[addr] = precompile.Name
+		}
+	}
+	return active
+}
+
 // GasTable returns the gas table corresponding to the current phase (homestead or homestead reprice).
 //
 // The returned GasTable's fields shouldn't, under any circumstances, be changed.
@@ -246,6 +298,41 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *Confi
 	if isForkIncompatible(c.MetropolisBlock, newcfg.MetropolisBlock, head) {
 		return newCompatError("Metropolis fork block", c.MetropolisBlock, newcfg.MetropolisBlock)
 	}
+	if isForkIncompatible(c.BerlinBlock, newcfg.BerlinBlock, head) {
+		return newCompatError("Berlin fork block", c.BerlinBlock, newcfg.BerlinBlock)
+	}
+	if isForkIncompatible(c.LondonBlock, newcfg.LondonBlock, head) {
+		return newCompatError("London fork block", c.LondonBlock, newcfg.LondonBlock)
+	}
+	for addr, old := range c.Precompiles {
+		if err := checkPrecompileCompatible(addr, old, newcfg.Precompiles[addr], head); err != nil {
+			return err
+		}
+	}
+	for addr, updated := range newcfg.Precompiles {
+		if _, ok := c.Precompiles[addr]; !ok {
+			if err := checkPrecompileCompatible(addr, nil, updated, head); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkPrecompileCompatible checks whether the activation of a custom precompiled
+// contract can be changed from old to updated without rewinding past head.
+// Swapping the implementation is treated as disabling the old one.
+func checkPrecompileCompatible(addr common.Address, old, updated *PrecompileConfig, head *big.Int) *ConfigCompatError {
+	var oldBlock, newBlock *big.Int
+	if old != nil {
+		oldBlock = old.Block
+	}
+	if updated != nil && (old == nil || old.Name == updated.Name) {
+		newBlock = updated.Block
+	}
+	if isForkIncompatible(oldBlock, newBlock, head) {
+		return newCompatError(fmt.Sprintf("precompile %x activation block", addr), oldBlock, newBlock)
+	}
 	return nil
 }
 
@@ -312,7 +399,7 @@ func (err *ConfigCompatError) Error() string {
 type Rules struct {
 	ChainId                                   *big.Int
 	IsHomestead, IsEIP150, IsEIP155, IsEIP158 bool
-	IsMetropolis                              bool
+	IsMetropolis, IsBerlin, IsLondon          bool
 }
 
 func (c *ChainConfig) Rules(num *big.Int) Rules {
@@ -320,5 +407,5 @@ func (c *ChainConfig) Rules(num *big.Int) Rules {
 	if chainId == nil {
 		chainId = new(big.Int)
 	}
-	return Rules{ChainId: new(big.Int).Set(chainId), IsHomestead: c.IsHomestead(num), IsEIP150: c.IsEIP150(num), IsEIP155: c.IsEIP155(num), IsEIP158: c.IsEIP158(num), IsMetropolis: c.IsMetropolis(num)}
+	return Rules{ChainId: new(big.Int).Set(chainId), IsHomestead: c.IsHomestead(num), IsEIP150: c.IsEIP150(num), IsEIP155: c.IsEIP155(num), IsEIP158: c.IsEIP158(num), IsMetropolis: c.IsMetropolis(num), IsBerlin: c.IsBerlin(num), IsLondon: c.IsLondon(num)}
 }
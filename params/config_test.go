@@ -20,6 +20,8 @@ import (
 	"math/big"
 	"reflect"
 	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
 )
 
 func TestCheckCompatible(t *testing.T) {
@@ -70,6 +72,23 @@ func TestCheckCompatible(t *testing.T) {
 				RewindTo:     9,
 			},
 		},
+		{
+			stored:  &ChainConfig{Precompiles: map[common.Address]*PrecompileConfig{{0xff}: {Name: "bls", Block: big.NewInt(10)}}},
+			new:     &ChainConfig{Precompiles: map[common.Address]*PrecompileConfig{{0xff}: {Name: "bls", Block: big.NewInt(20)}}},
+			head:    9,
+			wantErr: nil,
+		},
+		{
+			stored: &ChainConfig{Precompiles: map[common.Address]*PrecompileConfig{{0xff}: {Name: "bls", Block: big.NewInt(10)}}},
+			new:    &ChainConfig{Precompiles: map[common.Address]*PrecompileConfig{{0xff}: {Name: "secp256r1", Block: big.NewInt(10)}}},
+			head:   15,
+			wantErr: &ConfigCompatError{
+				What:         "precompile ff00000000000000000000000000000000000000 activation block",
+				StoredConfig: big.NewInt(10),
+				NewConfig:    nil,
+				RewindTo:     9,
+			},
+		},
 	}
 
 	for _, test := range tests {
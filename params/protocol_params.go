@@ -60,6 +60,16 @@ const (
 	MemoryGas        uint64 = 3     // Times the address of the (highest referenced byte in memory + 1). NOTE: referencing happens on read, write and in instructions such as RETURN and CALL.
 	TxDataNonZeroGas uint64 = 68    // Per byte of data attached to a transaction that is not equal to zero. NOTE: Not payable on data of calls between transactions.
 
+	TxAccessListAddressGas    uint64 = 2400 // Per address specified in an access list transaction.
+	TxAccessListStorageKeyGas uint64 = 1900 // Per storage key specified in an access list transaction.
+	ColdAccountAccessCost     uint64 = 2600 // Paid for the first access to an account within a transaction (Berlin).
+	ColdSloadCost             uint64 = 2100 // Paid for the first access to a storage slot within a transaction (Berlin).
+	WarmStorageReadCost       uint64 = 100  // Paid for accessing an account or storage slot already touched within a transaction (Berlin).
+
+	BaseFeeChangeDenominator uint64 = 8          // Bounds the amount the base fee can change between blocks (London).
+	ElasticityMultiplier     uint64 = 2          // Bounds the maximum gas limit a block may have relative to its gas target (London).
+	InitialBaseFee           uint64 = 1000000000 // Initial base fee of the first London block.
+
 	MaxCodeSize = 24576
 )
 
@@ -0,0 +1,141 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rlp
+
+import (
+	"io"
+	"math/big"
+)
+
+// EncoderBuffer is a buffer for incremental encoding. It lets types write their
+// encoding piece by piece, without going through reflection or building
+// intermediate values, and can be reused for many encodings.
+//
+// The zero value is not ready for use. Buffers are created with
+// NewEncoderBuffer, or readied with Reset.
+type EncoderBuffer struct {
+	buf       *encbuf
+	dst       io.Writer
+	ownBuffer bool
+}
+
+// NewEncoderBuffer creates an encoder buffer writing into dst when flushed. dst
+// may be nil if the encoding is retrieved with ToBytes or AppendToBytes.
+//
+// If dst is the writer passed to an EncodeRLP method, the buffer writes into the
+// outer encoder directly and Flush is not needed.
+func NewEncoderBuffer(dst io.Writer) EncoderBuffer {
+	var w EncoderBuffer
+	if outer, ok := dst.(*encbuf); ok {
+		w.buf = outer
+		return w
+	}
+	w.Reset(dst)
+	return w
+}
+
+// Reset discards the buffered encoding and sets the writer the next encoding is
+// flushed into. Buffers writing into an outer encoder can't be reset.
+func (w *EncoderBuffer) Reset(dst io.Writer) {
+	if w.buf != nil && !w.ownBuffer {
+		panic("rlp: can't reset encoder buffer writing into an outer encoder")
+	}
+	if w.buf == nil {
+		w.buf = encbufPool.Get().(*encbuf)
+		w.ownBuffer = true
+	}
+	w.buf.reset()
+	w.dst = dst
+}
+
+// Flush writes the encoding into the destination writer and releases the
+// buffer. The buffer can't be used afterwards, unless it's Reset.
+func (w *EncoderBuffer) Flush() error {
+	var err error
+	if w.dst != nil {
+		err = w.buf.toWriter(w.dst)
+	}
+	if w.ownBuffer {
+		encbufPool.Put(w.buf)
+	}
+	*w = EncoderBuffer{}
+	return err
+}
+
+// ToBytes returns a copy of the encoding.
+func (w *EncoderBuffer) ToBytes() []byte {
+	return w.buf.toBytes()
+}
+
+// AppendToBytes appends the encoding to dst, reusing its capacity if possible.
+func (w *EncoderBuffer) AppendToBytes(dst []byte) []byte {
+	size := w.buf.size()
+	if cap(dst)-len(dst) < size {
+		grown := make([]byte, len(dst), len(dst)+size)
+		copy(grown, dst)
+		dst = grown
+	}
+	out := dst[:len(dst)+size]
+	w.buf.copyTo(out[len(dst):])
+	return out
+}
+
+// Write appends raw, already encoded data to the buffer.
+func (w EncoderBuffer) Write(b []byte) (int, error) {
+	return w.buf.Write(b)
+}
+
+// List starts a list, returning the handle to pass to ListEnd once all of its
+// elements are written.
+func (w EncoderBuffer) List() int {
+	return w.buf.list()
+}
+
+// ListEnd finishes the list started by the List call that returned index.
+func (w EncoderBuffer) ListEnd(index int) {
+	w.buf.listEnd(index)
+}
+
+// WriteBool encodes b as an integer, 0 or 1.
+func (w EncoderBuffer) WriteBool(b bool) {
+	w.buf.encodeBool(b)
+}
+
+// WriteUint64 encodes an unsigned integer.
+func (w EncoderBuffer) WriteUint64(i uint64) {
+	w.buf.encodeUint(i)
+}
+
+// WriteBigInt encodes a big integer, which must not be negative. A nil integer
+// is encoded as zero.
+func (w EncoderBuffer) WriteBigInt(i *big.Int) error {
+	if i == nil {
+		w.buf.str = append(w.buf.str, 0x80)
+		return nil
+	}
+	return writeBigInt(i, w.buf)
+}
+
+// WriteBytes encodes b as an RLP string.
+func (w EncoderBuffer) WriteBytes(b []byte) {
+	w.buf.encodeString(b)
+}
+
+// WriteString encodes s as an RLP string.
+func (w EncoderBuffer) WriteString(s string) {
+	w.buf.encodeStr(s)
+}
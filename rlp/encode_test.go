@@ -339,3 +339,86 @@ func TestEncodeToReaderReturnToPool(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+type encoderBufferType struct {
+	A    uint64
+	B    string
+	C    []byte
+	D    bool
+	E    *big.Int
+	List []uint64
+}
+
+// EncodeRLP writes the value through an EncoderBuffer, producing the same output
+// as the reflection based encoder.
+func (v *encoderBufferType) EncodeRLP(w io.Writer) error {
+	buf := NewEncoderBuffer(w)
+	outer := buf.List()
+	buf.WriteUint64(v.A)
+	buf.WriteString(v.B)
+	buf.WriteBytes(v.C)
+	buf.WriteBool(v.D)
+	if err := buf.WriteBigInt(v.E); err != nil {
+		return err
+	}
+	inner := buf.List()
+	for _, x := range v.List {
+		buf.WriteUint64(x)
+	}
+	buf.ListEnd(inner)
+	buf.ListEnd(outer)
+	return buf.Flush()
+}
+
+func TestEncoderBuffer(t *testing.T) {
+	val := &encoderBufferType{
+		A:    1024,
+		B:    "a string long enough to need a multi byte string header, over 55 bytes",
+		C:    []byte{0x7f},
+		D:    true,
+		E:    big.NewInt(0xFFFFFF),
+		List: []uint64{0, 1, 127, 128, 1 << 40},
+	}
+	type plain encoderBufferType
+	want, err := EncodeToBytes((*plain)(val))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Encode directly, going through Flush
+	b := new(bytes.Buffer)
+	if err := val.EncodeRLP(b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Bytes(), want) {
+		t.Errorf("flushed encoding mismatch:\ngot  %x\nwant %x", b.Bytes(), want)
+	}
+	// Encode nested into an outer encoder
+	nested, err := EncodeToBytes([]interface{}{val, val})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNested, _ := EncodeToBytes([]interface{}{(*plain)(val), (*plain)(val)})
+	if !bytes.Equal(nested, wantNested) {
+		t.Errorf("nested encoding mismatch:\ngot  %x\nwant %x", nested, wantNested)
+	}
+	// Reuse a buffer for multiple encodings, appending them to a slice
+	buf := NewEncoderBuffer(nil)
+	defer buf.Flush()
+
+	var out []byte
+	for i := 0; i < 3; i++ {
+		buf.Reset(nil)
+		buf.WriteString("prefix")
+		out = buf.AppendToBytes(out)
+	}
+	if want := bytes.Repeat(append([]byte{0x86}, "prefix"...), 3); !bytes.Equal(out, want) {
+		t.Errorf("appended encoding mismatch:\ngot  %x\nwant %x", out, want)
+	}
+	if enc := buf.ToBytes(); !bytes.Equal(enc, out[:7]) {
+		t.Errorf("ToBytes mismatch: got %x, want %x", enc, out[:7])
+	}
+	// Negative big integers are rejected
+	if err := buf.WriteBigInt(big.NewInt(-1)); err == nil {
+		t.Error("expected error for negative big integer")
+	}
+}
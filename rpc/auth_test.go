@@ -0,0 +1,72 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// Tests that only requests carrying fresh tokens signed with the shared secret
+// are let through.
+func TestJWTHandler(t *testing.T) {
+	var (
+		secret = []byte("0123456789abcdef0123456789abcdef")
+		now    = time.Unix(1500000000, 0)
+	)
+	sign := func(method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return "Bearer " + token
+	}
+	tests := []struct {
+		header string
+		code   int
+	}{
+		{sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{"iat": now.Unix()}), http.StatusOK},
+		{sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{"iat": now.Add(-59 * time.Second).Unix()}), http.StatusOK},
+		{sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{"iat": now.Add(59 * time.Second).Unix()}), http.StatusOK},
+		{sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{"iat": now.Add(-61 * time.Second).Unix()}), http.StatusUnauthorized},
+		{sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{"iat": now.Add(61 * time.Second).Unix()}), http.StatusUnauthorized},
+		{sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{}), http.StatusUnauthorized},
+		{sign(jwt.SigningMethodHS256, []byte("wrong secret"), jwt.MapClaims{"iat": now.Unix()}), http.StatusUnauthorized},
+		{sign(jwt.SigningMethodHS512, secret, jwt.MapClaims{"iat": now.Unix()}), http.StatusUnauthorized},
+		{sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, jwt.MapClaims{"iat": now.Unix()}), http.StatusUnauthorized},
+		{"Bearer garbage", http.StatusUnauthorized},
+		{"", http.StatusUnauthorized},
+	}
+	handler := NewJWTHandler(secret, okHandler).(*jwtHandler)
+	handler.now = func() time.Time { return now }
+
+	for i, tt := range tests {
+		req := httptest.NewRequest("POST", "/", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.code {
+			t.Errorf("test %d: status mismatch: have %d, want %d", i, rec.Code, tt.code)
+		}
+	}
+}
@@ -47,6 +47,10 @@ const (
 	defaultDialTimeout   = 10 * time.Second // used when dialing if the context has no deadline
 	defaultWriteTimeout  = 10 * time.Second // used for calls if the context has no deadline
 	subscribeTimeout     = 5 * time.Second  // overall timeout eth_subscribe, rpc_modules calls
+
+	// Automatic reconnection
+	minReconnectBackoff = 100 * time.Millisecond // delay before retrying a failed reconnection
+	maxReconnectBackoff = 10 * time.Second       // upper bound of the exponentially growing delay
 )
 
 const (
@@ -106,6 +110,9 @@ func (msg *jsonrpcMessage) String() string {
 
 // Client represents a connection to an RPC server.
 type Client struct {
+	callTimeout   int64 // default deadline of calls without one (atomic, first for alignment)
+	autoReconnect int32 // non-zero if lost connections are re-established in the background (atomic)
+
 	idCounter   uint32
 	connectFunc func(ctx context.Context) (net.Conn, error)
 	isHTTP      bool
@@ -128,10 +135,11 @@ type Client struct {
 }
 
 type requestOp struct {
-	ids  []json.RawMessage
-	err  error
-	resp chan *jsonrpcMessage // receives up to len(ids) responses
-	sub  *ClientSubscription  // only set for EthSubscribe requests
+	ids   []json.RawMessage
+	err   error
+	resp  chan *jsonrpcMessage // receives up to len(ids) responses
+	sub   *ClientSubscription  // only set for EthSubscribe requests
+	resub bool                 // set if sub is renewed after a reconnection
 }
 
 func (op *requestOp) wait(ctx context.Context) (*jsonrpcMessage, error) {
@@ -220,6 +228,30 @@ func (c *Client) SupportedModules() (map[string]string, error) {
 	return result, err
 }
 
+// EnableAutoReconnect makes the client re-establish lost IPC, websocket and
+// in-process connections in the background, retrying with an exponentially
+// growing delay, and renew its active subscriptions once reconnected. Calls in
+// flight when the connection is lost still fail, as do subscriptions the server
+// refuses to renew. Notifications sent while disconnected are lost.
+func (c *Client) EnableAutoReconnect() {
+	atomic.StoreInt32(&c.autoReconnect, 1)
+}
+
+// SetCallTimeout sets the deadline of calls made with a context that has none.
+// Zero, the default, lets such calls wait for their response indefinitely.
+func (c *Client) SetCallTimeout(timeout time.Duration) {
+	atomic.StoreInt64(&c.callTimeout, int64(timeout))
+}
+
+// callContext applies the default call timeout to a context without deadline.
+func (c *Client) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := time.Duration(atomic.LoadInt64(&c.callTimeout))
+	if _, ok := ctx.Deadline(); ok || timeout == 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
 // Close closes the client, aborting any in-flight requests.
 func (c *Client) Close() {
 	if c.isHTTP {
@@ -244,10 +276,14 @@ func (c *Client) Call(result interface{}, method string, args ...interface{}) er
 
 // CallContext performs a JSON-RPC call with the given arguments. If the context is
 // canceled before the call has successfully returned, CallContext returns immediately.
+// Contexts without deadline are bounded by the call timeout of the client, if set.
 //
 // The result must be a pointer so that package json can unmarshal into it. You
 // can also pass nil, in which case the result is ignored.
 func (c *Client) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	ctx, cancel := c.callContext(ctx)
+	defer cancel()
+
 	msg, err := c.newMessage(method, args...)
 	if err != nil {
 		return err
@@ -290,7 +326,7 @@ func (c *Client) BatchCall(b []BatchElem) error {
 
 // BatchCall sends all given requests as a single batch and waits for the server
 // to return a response for all of them. The wait duration is bounded by the
-// context's deadline.
+// context's deadline, or the call timeout of the client if it has none.
 //
 // In contrast to CallContext, BatchCallContext only returns errors that have occurred
 // while sending the request. Any error specific to a request is reported through the
@@ -298,6 +334,9 @@ func (c *Client) BatchCall(b []BatchElem) error {
 //
 // Note that batch calls may not be executed atomically on the server side.
 func (c *Client) BatchCallContext(ctx context.Context, b []BatchElem) error {
+	ctx, cancel := c.callContext(ctx)
+	defer cancel()
+
 	msgs := make([]*jsonrpcMessage, len(b))
 	op := &requestOp{
 		ids:  make([]json.RawMessage, len(b)),
@@ -381,7 +420,7 @@ func (c *Client) ShhSubscribe(ctx context.Context, channel interface{}, args ...
 	op := &requestOp{
 		ids:  []json.RawMessage{msg.ID},
 		resp: make(chan *jsonrpcMessage),
-		sub:  newClientSubscription(c, "shh", chanVal),
+		sub:  newClientSubscription(c, "shh", chanVal, msg.Params),
 	}
 
 	// Send the subscription request.
@@ -427,7 +466,7 @@ func (c *Client) EthSubscribe(ctx context.Context, channel interface{}, args ...
 	op := &requestOp{
 		ids:  []json.RawMessage{msg.ID},
 		resp: make(chan *jsonrpcMessage),
-		sub:  newClientSubscription(c, "eth", chanVal),
+		sub:  newClientSubscription(c, "eth", chanVal, msg.Params),
 	}
 
 	// Send the subscription request.
@@ -488,6 +527,75 @@ func (c *Client) write(ctx context.Context, msg interface{}) error {
 	return err
 }
 
+// redial re-establishes a lost connection in the background, retrying with an
+// exponentially growing delay until it succeeds, a call reconnects the client
+// first or the client is closed.
+func (c *Client) redial(lost net.Conn) {
+	backoff := minReconnectBackoff
+	for {
+		// Take the write lock like send does, the connection is swapped under it
+		select {
+		case c.requestOp <- new(requestOp):
+		case <-c.didQuit:
+			return
+		}
+		if c.writeConn != nil && c.writeConn != lost {
+			c.sendDone <- nil
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), defaultDialTimeout)
+		err := c.reconnect(ctx)
+		cancel()
+		c.sendDone <- nil
+		if err == nil || err == ErrClientQuit {
+			return
+		}
+		log.Debug(fmt.Sprintf("reconnect failed, retrying in %v: %v", backoff, err))
+		select {
+		case <-time.After(backoff):
+		case <-c.didQuit:
+			return
+		}
+		if backoff *= 2; backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+}
+
+// resubscribe renews subscriptions on a re-established connection, ending the
+// ones which cannot be renewed with the error.
+func (c *Client) resubscribe(subs []*ClientSubscription) {
+	for _, sub := range subs {
+		select {
+		case <-sub.quit:
+			continue // unsubscribed while disconnected
+		default:
+		}
+		msg := &jsonrpcMessage{Version: "2.0", ID: c.nextID(), Method: sub.namespace + subscribeMethodSuffix, Params: sub.params}
+		op := &requestOp{
+			ids:   []json.RawMessage{msg.ID},
+			resp:  make(chan *jsonrpcMessage),
+			sub:   sub,
+			resub: true,
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), subscribeTimeout)
+		err := c.send(ctx, op, msg)
+		if err == nil {
+			_, err = op.wait(ctx)
+		}
+		cancel()
+		if err != nil {
+			sub.quitWithError(err, false)
+			continue
+		}
+		select {
+		case <-sub.quit:
+			sub.requestUnsubscribe() // unsubscribed while renewing
+		default:
+		}
+	}
+}
+
 func (c *Client) reconnect(ctx context.Context) error {
 	newconn, err := c.connectFunc(ctx)
 	if err != nil {
@@ -512,13 +620,18 @@ func (c *Client) dispatch(conn net.Conn) {
 	go c.read(conn)
 
 	var (
-		lastOp        *requestOp    // tracks last send operation
-		requestOpLock = c.requestOp // nil while the send lock is held
-		reading       = true        // if true, a read loop is running
+		lastOp        *requestOp            // tracks last send operation
+		requestOpLock = c.requestOp         // nil while the send lock is held
+		reading       = true                // if true, a read loop is running
+		lost          []*ClientSubscription // subscriptions to renew once reconnected
 	)
 	defer close(c.didQuit)
 	defer func() {
 		c.closeRequestOps(ErrClientQuit)
+		c.closeSubscriptions(ErrClientQuit)
+		for _, sub := range lost {
+			sub.quitWithError(ErrClientQuit, false)
+		}
 		conn.Close()
 		if reading {
 			// Empty read channels until read is dead.
@@ -562,6 +675,16 @@ func (c *Client) dispatch(conn net.Conn) {
 		case err := <-c.readErr:
 			log.Debug(fmt.Sprintf("<-readErr: %v", err))
 			c.closeRequestOps(err)
+			if atomic.LoadInt32(&c.autoReconnect) != 0 {
+				// Keep the subscriptions for renewal and reconnect in the background
+				for id, sub := range c.subs {
+					delete(c.subs, id)
+					lost = append(lost, sub)
+				}
+				go c.redial(conn)
+			} else {
+				c.closeSubscriptions(err)
+			}
 			conn.Close()
 			reading = false
 
@@ -576,6 +699,11 @@ func (c *Client) dispatch(conn net.Conn) {
 			reading = true
 			conn = newconn
 
+			if len(lost) > 0 {
+				go c.resubscribe(lost)
+				lost = nil
+			}
+
 		// Send path.
 		case op := <-requestOpLock:
 			// Stop listening for further send ops until the current one is done.
@@ -601,7 +729,7 @@ func (c *Client) dispatch(conn net.Conn) {
 	}
 }
 
-// closeRequestOps unblocks pending send ops and active subscriptions.
+// closeRequestOps unblocks pending send ops.
 func (c *Client) closeRequestOps(err error) {
 	didClose := make(map[*requestOp]bool)
 
@@ -615,6 +743,10 @@ func (c *Client) closeRequestOps(err error) {
 			didClose[op] = true
 		}
 	}
+}
+
+// closeSubscriptions ends the active subscriptions with the given error.
+func (c *Client) closeSubscriptions(err error) {
 	for id, sub := range c.subs {
 		delete(c.subs, id)
 		sub.quitWithError(err, false)
@@ -659,10 +791,15 @@ func (c *Client) handleResponse(msg *jsonrpcMessage) {
 		op.err = msg.Error
 		return
 	}
-	if op.err = json.Unmarshal(msg.Result, &op.sub.subid); op.err == nil {
+	var subid string
+	if op.err = json.Unmarshal(msg.Result, &subid); op.err != nil {
+		return
+	}
+	op.sub.setID(subid)
+	if !op.resub {
 		go op.sub.start()
-		c.subs[op.sub.subid] = op.sub
 	}
+	c.subs[subid] = op.sub
 }
 
 // Reading happens on a dedicated goroutine.
@@ -704,19 +841,23 @@ type ClientSubscription struct {
 	etype     reflect.Type
 	channel   reflect.Value
 	namespace string
-	subid     string
+	params    json.RawMessage // subscription arguments, sent again on renewal
 	in        chan json.RawMessage
 
+	idLock sync.Mutex // protects subid, which changes on renewal
+	subid  string
+
 	quitOnce sync.Once     // ensures quit is closed once
 	quit     chan struct{} // quit is closed when the subscription exits
 	errOnce  sync.Once     // ensures err is closed once
 	err      chan error
 }
 
-func newClientSubscription(c *Client, namespace string, channel reflect.Value) *ClientSubscription {
+func newClientSubscription(c *Client, namespace string, channel reflect.Value, params json.RawMessage) *ClientSubscription {
 	sub := &ClientSubscription{
 		client:    c,
 		namespace: namespace,
+		params:    params,
 		etype:     channel.Type().Elem(),
 		channel:   channel,
 		quit:      make(chan struct{}),
@@ -821,7 +962,17 @@ func (sub *ClientSubscription) unmarshal(result json.RawMessage) (interface{}, e
 	return val.Elem().Interface(), err
 }
 
+func (sub *ClientSubscription) setID(id string) {
+	sub.idLock.Lock()
+	defer sub.idLock.Unlock()
+	sub.subid = id
+}
+
 func (sub *ClientSubscription) requestUnsubscribe() error {
+	sub.idLock.Lock()
+	subid := sub.subid
+	sub.idLock.Unlock()
+
 	var result interface{}
-	return sub.client.Call(&result, sub.namespace+unsubscribeMethodSuffix, sub.subid)
+	return sub.client.Call(&result, sub.namespace+unsubscribeMethodSuffix, subid)
 }
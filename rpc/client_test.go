@@ -453,6 +453,112 @@ func TestClientReconnect(t *testing.T) {
 	}
 }
 
+// TickerService sends increasing numbers to its subscribers until they leave.
+type TickerService struct{}
+
+func (s *TickerService) Ticker(ctx context.Context, from int) (*Subscription, error) {
+	notifier, supported := NotifierFromContext(ctx)
+	if !supported {
+		return nil, ErrNotificationsUnsupported
+	}
+	sub := notifier.CreateSubscription()
+	go func() {
+		for i := from; ; i++ {
+			select {
+			case <-time.After(10 * time.Millisecond):
+			case <-sub.Err():
+				return
+			}
+			if err := notifier.Notify(sub.ID, i); err != nil {
+				return
+			}
+		}
+	}()
+	return sub, nil
+}
+
+// Tests that a client with automatic reconnection enabled re-establishes a lost
+// connection by itself and renews its subscriptions.
+func TestClientAutoReconnect(t *testing.T) {
+	startServer := func(addr string) (*Server, net.Listener) {
+		srv := newTestServer("eth", new(TickerService))
+		var (
+			l   net.Listener
+			err error
+		)
+		// Retry listening, the address may be briefly unavailable after a restart
+		for i := 0; i < 50; i++ {
+			if l, err = net.Listen("tcp", addr); err == nil {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		go http.Serve(l, srv.WebsocketHandler([]string{"*"}))
+		return srv, l
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	s1, l1 := startServer("127.0.0.1:0")
+	client, err := DialContext(ctx, "ws://"+l1.Addr().String())
+	if err != nil {
+		t.Fatal("can't dial", err)
+	}
+	defer client.Close()
+	client.EnableAutoReconnect()
+
+	nc := make(chan int, 100)
+	sub, err := client.EthSubscribe(ctx, nc, "ticker", 0)
+	if err != nil {
+		t.Fatal("can't subscribe:", err)
+	}
+	if val := <-nc; val != 0 {
+		t.Fatalf("value mismatch: have %d, want 0", val)
+	}
+	// Restart the server and wait for notifications to resume without any calls
+	l1.Close()
+	s1.Stop()
+
+	s2, l2 := startServer(l1.Addr().String())
+	defer l2.Close()
+	defer s2.Stop()
+
+	timeout := time.After(10 * time.Second)
+	for resumed := false; !resumed; {
+		select {
+		case val := <-nc:
+			// The renewed subscription starts over from zero
+			resumed = val == 0
+		case err := <-sub.Err():
+			t.Fatalf("subscription ended: %v", err)
+		case <-timeout:
+			t.Fatalf("subscription not renewed within 10s")
+		}
+	}
+	sub.Unsubscribe()
+}
+
+// Tests that calls without deadline are bounded by the call timeout.
+func TestClientCallTimeout(t *testing.T) {
+	server := newTestServer("service", new(Service))
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	client.SetCallTimeout(50 * time.Millisecond)
+	if err := client.Call(nil, "service_sleep", time.Second); err != context.DeadlineExceeded {
+		t.Fatalf("error mismatch: have %v, want %v", err, context.DeadlineExceeded)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := client.CallContext(ctx, nil, "service_sleep", 100*time.Millisecond); err != nil {
+		t.Fatalf("call with explicit deadline failed: %v", err)
+	}
+}
+
 func newTestServer(serviceName string, service interface{}) *Server {
 	server := NewServer()
 	if err := server.RegisterName(serviceName, service); err != nil {
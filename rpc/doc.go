@@ -92,7 +92,8 @@ An example method:
 Subscriptions are deleted when:
  - the user sends an unsubscribe request
  - the connection which was used to create the subscription is closed. This can be initiated
-   by the client and server. The server will close the connection on an write error or when
-   the queue of buffered notifications gets too big.
+   by the client and server. The server will close the connection on an write error.
+ - the client doesn't keep up with the notifications and the queue of notifications buffered
+   for its connection gets too big.
 */
 package rpc
@@ -64,3 +64,33 @@ type shutdownError struct{}
 func (e *shutdownError) ErrorCode() int { return -32000 }
 
 func (e *shutdownError) Error() string { return "server is shutting down" }
+
+// issued when a batch contains more requests than allowed.
+type batchTooLargeError struct{ limit int }
+
+func (e *batchTooLargeError) ErrorCode() int { return -32600 }
+
+func (e *batchTooLargeError) Error() string {
+	return fmt.Sprintf("batch too large, limit is %d requests", e.limit)
+}
+
+// issued for the requests of a batch once its responses grow too large.
+type responseTooLargeError struct{ limit int }
+
+func (e *responseTooLargeError) ErrorCode() int { return -32003 }
+
+func (e *responseTooLargeError) Error() string {
+	return fmt.Sprintf("batch response too large, limit is %d bytes", e.limit)
+}
+
+// issued when a method is already executing as many times as allowed.
+type methodBusyError struct {
+	method string
+	limit  int
+}
+
+func (e *methodBusyError) ErrorCode() int { return -32005 }
+
+func (e *methodBusyError) Error() string {
+	return fmt.Sprintf("too many concurrent %s requests, limit is %d", e.method, e.limit)
+}
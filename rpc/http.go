@@ -25,6 +25,7 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -136,11 +137,10 @@ func (t *httpReadWriteNopCloser) Close() error {
 	return nil
 }
 
-// NewHTTPServer creates a new HTTP RPC server around an API provider.
-//
-// Deprecated: Server implements http.Handler
-func NewHTTPServer(cors []string, srv *Server) *http.Server {
-	return &http.Server{Handler: newCorsHandler(srv, cors)}
+// NewHTTPServer creates a new HTTP RPC server around an API provider, enforcing
+// the given CORS origins and virtual hosts.
+func NewHTTPServer(cors []string, vhosts []string, srv http.Handler) *http.Server {
+	return &http.Server{Handler: newVHostHandler(vhosts, newCorsHandler(srv, cors))}
 }
 
 // ServeHTTP serves JSON-RPC requests over HTTP.
@@ -161,7 +161,7 @@ func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	srv.ServeSingleRequest(codec, OptionMethodInvocation)
 }
 
-func newCorsHandler(srv *Server, allowedOrigins []string) http.Handler {
+func newCorsHandler(srv http.Handler, allowedOrigins []string) http.Handler {
 	// disable CORS support if user has not specified a custom CORS configuration
 	if len(allowedOrigins) == 0 {
 		return srv
@@ -175,3 +175,68 @@ func newCorsHandler(srv *Server, allowedOrigins []string) http.Handler {
 	})
 	return c.Handler(srv)
 }
+
+// virtualHostHandler is a handler which validates the Host header of incoming
+// requests, preventing DNS rebinding attacks which circumvent same-origin
+// protections of browsers.
+type virtualHostHandler struct {
+	vhosts map[string]struct{}
+	next   http.Handler
+}
+
+// newVHostHandler wraps a handler with a virtual host check, disabled if no
+// virtual hosts are specified.
+func newVHostHandler(vhosts []string, next http.Handler) http.Handler {
+	if len(vhosts) == 0 {
+		return next
+	}
+	allowed := make(map[string]struct{})
+	for _, vhost := range vhosts {
+		allowed[strings.ToLower(vhost)] = struct{}{}
+	}
+	return &virtualHostHandler{allowed, next}
+}
+
+// ServeHTTP serves JSON-RPC requests over HTTP, implements http.Handler
+func (h *virtualHostHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// If no Host header was provided, accept the request (HTTP/1.0 clients)
+	if r.Host == "" {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		// Either an invalid (rejected by the stdlib) or missing port
+		host = r.Host
+	}
+	// Requests to an IP address can't be subject to DNS rebinding
+	if net.ParseIP(host) != nil {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	if _, ok := h.vhosts["*"]; ok {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	if _, ok := h.vhosts[strings.ToLower(host)]; ok {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	http.Error(w, "invalid host specified", http.StatusForbidden)
+}
+
+// NewLocalHandler wraps a handler, only letting through requests originating
+// from the loopback interface.
+func NewLocalHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			http.Error(w, "access restricted to local clients", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+// Tests that requests are only let through for the allowed virtual hosts.
+func TestVirtualHostHandler(t *testing.T) {
+	tests := []struct {
+		vhosts []string
+		host   string
+		code   int
+	}{
+		{nil, "evil.com", http.StatusOK},
+		{[]string{"localhost"}, "", http.StatusOK},
+		{[]string{"localhost"}, "localhost:8545", http.StatusOK},
+		{[]string{"localhost"}, "LocalHost", http.StatusOK},
+		{[]string{"localhost"}, "127.0.0.1:8545", http.StatusOK},
+		{[]string{"localhost"}, "[::1]:8545", http.StatusOK},
+		{[]string{"localhost"}, "evil.com", http.StatusForbidden},
+		{[]string{"localhost"}, "evil.com:8545", http.StatusForbidden},
+		{[]string{"localhost", "node.example"}, "node.example", http.StatusOK},
+		{[]string{"*"}, "evil.com", http.StatusOK},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Host = tt.host
+
+		rec := httptest.NewRecorder()
+		newVHostHandler(tt.vhosts, okHandler).ServeHTTP(rec, req)
+		if rec.Code != tt.code {
+			t.Errorf("test %d: status mismatch: have %d, want %d", i, rec.Code, tt.code)
+		}
+	}
+}
+
+// Tests that local handlers only let through requests from the loopback interface.
+func TestLocalHandler(t *testing.T) {
+	tests := []struct {
+		remote string
+		code   int
+	}{
+		{"127.0.0.1:45678", http.StatusOK},
+		{"[::1]:45678", http.StatusOK},
+		{"192.168.1.10:45678", http.StatusForbidden},
+		{"[2001:db8::1]:45678", http.StatusForbidden},
+		{"garbage", http.StatusForbidden},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.RemoteAddr = tt.remote
+
+		rec := httptest.NewRecorder()
+		NewLocalHandler(okHandler).ServeHTTP(rec, req)
+		if rec.Code != tt.code {
+			t.Errorf("test %d: status mismatch: have %d, want %d", i, rec.Code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	rpcCallMeter    = metrics.NewMeter("rpc/calls")
+	rpcFailureMeter = metrics.NewMeter("rpc/failures")
+	rpcCallTimer    = metrics.NewTimer("rpc/duration")
+)
+
+// updateMethodMetrics records the execution of a method call, both in the
+// totals of the server and in the meters and latency timer of the method.
+func updateMethodMetrics(method string, failed bool, elapsed time.Duration) {
+	if !metrics.Enabled {
+		return
+	}
+	rpcCallMeter.Mark(1)
+	rpcCallTimer.Update(elapsed)
+	metrics.NewMeter("rpc/calls/" + method).Mark(1)
+	metrics.NewTimer("rpc/duration/" + method).Update(elapsed)
+
+	if failed {
+		rpcFailureMeter.Mark(1)
+		metrics.NewMeter("rpc/failures/" + method).Mark(1)
+	}
+}
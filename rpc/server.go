@@ -18,19 +18,22 @@ package rpc
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"runtime"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
 	"gopkg.in/fatih/set.v0"
 )
 
 const (
-	notificationBufferSize = 10000 // max buffered notifications before codec is closed
+	notificationBufferSize = 10000 // max buffered notifications per connection before subscriptions are dropped
 
 	MetadataApi = "rpc"
 )
@@ -63,6 +66,56 @@ func NewServer() *Server {
 	return server
 }
 
+// SetBatchLimits sets the limits applied to batch requests: the maximum number
+// of requests in a batch and the maximum total size in bytes of their responses.
+// Once the responses reach the size limit, the remaining requests are not executed
+// but answered with an error. The response crossing the limit is still delivered,
+// as its request has already been executed. Zero disables a limit.
+func (s *Server) SetBatchLimits(itemLimit, maxResponseSize int) {
+	s.batchItemLimit = itemLimit
+	s.batchResponseMaxSize = maxResponseSize
+}
+
+// SetMethodConcurrency limits the number of concurrent executions of every
+// method, further calls being rejected with an error until one finishes. Zero
+// disables the limit.
+func (s *Server) SetMethodConcurrency(limit int) {
+	s.methodMu.Lock()
+	defer s.methodMu.Unlock()
+
+	s.methodLimit = limit
+	s.methodSlots = make(map[string]chan struct{})
+}
+
+// SetSlowCallThreshold sets the execution time beyond which method calls are
+// logged as slow. Zero disables logging.
+func (s *Server) SetSlowCallThreshold(threshold time.Duration) {
+	s.slowCallThreshold = threshold
+}
+
+// acquireMethod reserves an execution slot of the given method, returning the
+// function to release it or nil if all slots are taken.
+func (s *Server) acquireMethod(method string) func() {
+	s.methodMu.Lock()
+	if s.methodLimit == 0 {
+		s.methodMu.Unlock()
+		return func() {}
+	}
+	slots, ok := s.methodSlots[method]
+	if !ok {
+		slots = make(chan struct{}, s.methodLimit)
+		s.methodSlots[method] = slots
+	}
+	s.methodMu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }
+	default:
+		return nil
+	}
+}
+
 // RPCService gives meta information about the server.
 // e.g. gives information about the loaded modules.
 type RPCService struct {
@@ -308,7 +361,15 @@ func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverReque
 		return codec.CreateResponse(req.id, subid), activateSub
 	}
 
-	// regular RPC call, prepare arguments
+	// regular RPC call, ensure the method isn't overloaded
+	method := req.svcname + serviceMethodSeparator + formatName(req.callb.method.Name)
+	release := s.acquireMethod(method)
+	if release == nil {
+		return codec.CreateErrorResponse(&req.id, &methodBusyError{method, s.methodLimit}), nil
+	}
+	defer release()
+
+	// prepare arguments
 	if len(req.args) != len(req.callb.argTypes) {
 		rpcErr := &invalidParamsError{fmt.Sprintf("%s%s%s expects %d parameters, got %d",
 			req.svcname, serviceMethodSeparator, req.callb.method.Name,
@@ -325,21 +386,42 @@ func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverReque
 	}
 
 	// execute RPC method and return result
+	start := time.Now()
 	reply := req.callb.method.Func.Call(arguments)
+	elapsed := time.Since(start)
+
+	var failure error
+	if req.callb.errPos >= 0 && !reply[req.callb.errPos].IsNil() {
+		failure = reply[req.callb.errPos].Interface().(error)
+	}
+	updateMethodMetrics(method, failure != nil, elapsed)
+	if s.slowCallThreshold > 0 && elapsed >= s.slowCallThreshold {
+		log.Warn("Slow RPC call", "method", method, "elapsed", common.PrettyDuration(elapsed), "err", failure)
+	}
+
 	if len(reply) == 0 {
 		return codec.CreateResponse(req.id, nil), nil
 	}
-
-	if req.callb.errPos >= 0 { // test if method returned an error
-		if !reply[req.callb.errPos].IsNil() {
-			e := reply[req.callb.errPos].Interface().(error)
-			res := codec.CreateErrorResponse(&req.id, &callbackError{e.Error()})
-			return res, nil
-		}
+	if failure != nil {
+		return createCallbackErrorResponse(codec, req, failure), nil
 	}
 	return codec.CreateResponse(req.id, reply[0].Interface()), nil
 }
 
+// createCallbackErrorResponse converts an error returned by a callback into a
+// JSON-RPC error response. Errors carrying their own code are reported with it,
+// and the data of errors implementing DataError is added to the response.
+func createCallbackErrorResponse(codec ServerCodec, req *serverRequest, e error) interface{} {
+	rpcErr, ok := e.(Error)
+	if !ok {
+		rpcErr = &callbackError{e.Error()}
+	}
+	if de, ok := e.(DataError); ok {
+		return codec.CreateErrorResponseWithInfo(&req.id, rpcErr, de.ErrorData())
+	}
+	return codec.CreateErrorResponse(&req.id, rpcErr)
+}
+
 // exec executes the given request and writes the result back using the codec.
 func (s *Server) exec(ctx context.Context, codec ServerCodec, req *serverRequest) {
 	var response interface{}
@@ -364,16 +446,45 @@ func (s *Server) exec(ctx context.Context, codec ServerCodec, req *serverRequest
 // execBatch executes the given requests and writes the result back using the codec.
 // It will only write the response back when the last request is processed.
 func (s *Server) execBatch(ctx context.Context, codec ServerCodec, requests []*serverRequest) {
+	// Reject the whole batch if it contains too many requests
+	if s.batchItemLimit > 0 && len(requests) > s.batchItemLimit {
+		if err := codec.Write(codec.CreateErrorResponse(nil, &batchTooLargeError{s.batchItemLimit})); err != nil {
+			log.Error(fmt.Sprintf("%v\n", err))
+			codec.Close()
+		}
+		return
+	}
 	responses := make([]interface{}, len(requests))
-	var callbacks []func()
+	var (
+		callbacks []func()
+		size      int
+	)
 	for i, req := range requests {
-		if req.err != nil {
+		var callback func()
+		switch {
+		case s.batchResponseMaxSize > 0 && size >= s.batchResponseMaxSize:
+			// The responses reached their cap, don't execute the remaining requests
+			responses[i] = codec.CreateErrorResponse(&req.id, &responseTooLargeError{s.batchResponseMaxSize})
+		case req.err != nil:
 			responses[i] = codec.CreateErrorResponse(&req.id, req.err)
-		} else {
-			var callback func()
-			if responses[i], callback = s.handle(ctx, codec, req); callback != nil {
-				callbacks = append(callbacks, callback)
+		default:
+			responses[i], callback = s.handle(ctx, codec, req)
+		}
+		// If the responses are capped, track their size. An executed request's
+		// response is never dropped, even if it overflows the cap, as the client
+		// would be told the call failed while its effects remain.
+		if s.batchResponseMaxSize > 0 {
+			blob, err := json.Marshal(responses[i])
+			if err != nil {
+				log.Error(fmt.Sprintf("%v\n", err))
+				codec.Close()
+				return
 			}
+			size += len(blob)
+			responses[i] = json.RawMessage(blob)
+		}
+		if callback != nil {
+			callbacks = append(callbacks, callback)
 		}
 	}
 
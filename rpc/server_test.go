@@ -23,6 +23,9 @@ import (
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	gometrics "github.com/rcrowley/go-metrics"
 )
 
 type Service struct{}
@@ -160,3 +163,266 @@ func TestServerMethodExecution(t *testing.T) {
 func TestServerMethodWithCtx(t *testing.T) {
 	testServerMethodExecution(t, "echoWithCtx")
 }
+
+type testDataError struct{}
+
+func (e *testDataError) Error() string          { return "test error" }
+func (e *testDataError) ErrorCode() int         { return 3 }
+func (e *testDataError) ErrorData() interface{} { return "0x01" }
+
+type DataErrorService struct{}
+
+func (s *DataErrorService) Fail() error {
+	return &testDataError{}
+}
+
+func TestServerCallbackErrorData(t *testing.T) {
+	server := NewServer()
+	if err := server.RegisterName("test", new(DataErrorService)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	go server.ServeCodec(NewJSONCodec(serverConn), OptionMethodInvocation)
+
+	request := map[string]interface{}{"id": 1, "method": "test_fail", "version": "2.0", "params": []interface{}{}}
+	if err := json.NewEncoder(clientConn).Encode(request); err != nil {
+		t.Fatal(err)
+	}
+	var response jsonErrResponse
+	if err := json.NewDecoder(clientConn).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Error.Code != 3 {
+		t.Errorf("error code mismatch: have %d, want %d", response.Error.Code, 3)
+	}
+	if response.Error.Message != "test error" {
+		t.Errorf("error message mismatch: have %q, want %q", response.Error.Message, "test error")
+	}
+	if response.Error.Data != "0x01" {
+		t.Errorf("error data mismatch: have %v, want %v", response.Error.Data, "0x01")
+	}
+}
+
+// Tests that batches exceeding the request limit are rejected as a whole and
+// that requests after the response size limit is reached are answered with
+// errors.
+func TestServerBatchLimits(t *testing.T) {
+	server := NewServer()
+	if err := server.RegisterName("test", new(Service)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	go server.ServeCodec(NewJSONCodec(serverConn), OptionMethodInvocation)
+
+	out := json.NewEncoder(clientConn)
+	in := json.NewDecoder(clientConn)
+
+	batch := make([]map[string]interface{}, 4)
+	for i := range batch {
+		batch[i] = map[string]interface{}{
+			"id":      i,
+			"method":  "test_echo",
+			"version": "2.0",
+			"params":  []interface{}{string(make([]byte, 100)), i, &Args{}},
+		}
+	}
+	// Ensure oversized batches are rejected with a single error
+	server.SetBatchLimits(3, 0)
+	if err := out.Encode(batch); err != nil {
+		t.Fatal(err)
+	}
+	var rejected jsonErrResponse
+	if err := in.Decode(&rejected); err != nil {
+		t.Fatal(err)
+	}
+	if rejected.Error.Code != -32600 {
+		t.Errorf("batch rejection code mismatch: have %d, want %d", rejected.Error.Code, -32600)
+	}
+	// Ensure requests after the response size limit is crossed are not answered
+	server.SetBatchLimits(4, 1000)
+	if err := out.Encode(batch[:3]); err != nil {
+		t.Fatal(err)
+	}
+	var responses []map[string]interface{}
+	if err := in.Decode(&responses); err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 3 {
+		t.Fatalf("response count mismatch: have %d, want %d", len(responses), 3)
+	}
+	for i, res := range responses {
+		_, failed := res["error"]
+		if want := i > 1; failed != want {
+			t.Errorf("response %d: failure mismatch: have %v, want %v", i, failed, want)
+		}
+	}
+}
+
+type CounterService struct {
+	count int
+}
+
+func (s *CounterService) Inc() int {
+	s.count++
+	return s.count
+}
+
+// Tests that the response of a batch request crossing the response size limit
+// is still delivered, so the effects of every executed call are reported.
+func TestServerBatchResponseCap(t *testing.T) {
+	service := new(CounterService)
+
+	server := NewServer()
+	if err := server.RegisterName("test", service); err != nil {
+		t.Fatalf("%v", err)
+	}
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	go server.ServeCodec(NewJSONCodec(serverConn), OptionMethodInvocation)
+
+	out := json.NewEncoder(clientConn)
+	in := json.NewDecoder(clientConn)
+
+	// Allow room for a bit more than a single response
+	server.SetBatchLimits(0, 50)
+
+	batch := make([]map[string]interface{}, 4)
+	for i := range batch {
+		batch[i] = map[string]interface{}{"id": i, "method": "test_inc", "version": "2.0"}
+	}
+	if err := out.Encode(batch); err != nil {
+		t.Fatal(err)
+	}
+	var responses []jsonErrResponse
+	if err := in.Decode(&responses); err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != len(batch) {
+		t.Fatalf("response count mismatch: have %d, want %d", len(responses), len(batch))
+	}
+	var succeeded int
+	for i, res := range responses {
+		if res.Error.Code == 0 {
+			succeeded++
+			continue
+		}
+		if res.Error.Code != -32003 {
+			t.Errorf("response %d: error code mismatch: have %d, want %d", i, res.Error.Code, -32003)
+		}
+	}
+	if succeeded != 2 {
+		t.Errorf("delivered response count mismatch: have %d, want %d", succeeded, 2)
+	}
+	if service.count != succeeded {
+		t.Errorf("executed call count mismatch: have %d, want %d", service.count, succeeded)
+	}
+}
+
+type BlockingService struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *BlockingService) Block() {
+	s.entered <- struct{}{}
+	<-s.release
+}
+
+// Tests that concurrent executions of a method beyond the limit are rejected.
+func TestServerMethodConcurrency(t *testing.T) {
+	service := &BlockingService{entered: make(chan struct{}), release: make(chan struct{})}
+
+	server := NewServer()
+	server.SetMethodConcurrency(1)
+	if err := server.RegisterName("test", service); err != nil {
+		t.Fatalf("%v", err)
+	}
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	go server.ServeCodec(NewJSONCodec(serverConn), OptionMethodInvocation)
+
+	out := json.NewEncoder(clientConn)
+	in := json.NewDecoder(clientConn)
+
+	// Start a call occupying the single execution slot
+	if err := out.Encode(map[string]interface{}{"id": 1, "method": "test_block", "version": "2.0"}); err != nil {
+		t.Fatal(err)
+	}
+	<-service.entered
+
+	// Ensure a second call is rejected, and allowed again once the first is done
+	if err := out.Encode(map[string]interface{}{"id": 2, "method": "test_block", "version": "2.0"}); err != nil {
+		t.Fatal(err)
+	}
+	var rejected jsonErrResponse
+	if err := in.Decode(&rejected); err != nil {
+		t.Fatal(err)
+	}
+	if rejected.Error.Code != -32005 {
+		t.Errorf("rejection code mismatch: have %d, want %d", rejected.Error.Code, -32005)
+	}
+	service.release <- struct{}{}
+
+	var done jsonSuccessResponse
+	if err := in.Decode(&done); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Encode(map[string]interface{}{"id": 3, "method": "test_block", "version": "2.0"}); err != nil {
+		t.Fatal(err)
+	}
+	<-service.entered
+	service.release <- struct{}{}
+}
+
+// Tests that calls and failures are metered per method.
+func TestServerMethodMetrics(t *testing.T) {
+	defer func(enabled bool) { metrics.Enabled = enabled }(metrics.Enabled)
+	metrics.Enabled = true
+
+	server := NewServer()
+	if err := server.RegisterName("metered", new(Service)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := server.RegisterName("meteredfail", new(DataErrorService)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	client := DialInProc(server)
+	defer client.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := client.Call(nil, "metered_rets"); err != nil {
+			t.Fatalf("call failed: %v", err)
+		}
+	}
+	if err := client.Call(nil, "meteredfail_fail"); err == nil {
+		t.Fatalf("failing call succeeded")
+	}
+	tests := []struct {
+		name  string
+		count int64
+	}{
+		{"rpc/calls/metered_rets", 3},
+		{"rpc/failures/metered_rets", 0},
+		{"rpc/calls/meteredfail_fail", 1},
+		{"rpc/failures/meteredfail_fail", 1},
+	}
+	for _, tt := range tests {
+		var count int64
+		if meter, ok := gometrics.DefaultRegistry.Get(tt.name).(gometrics.Meter); ok {
+			count = meter.Count()
+		}
+		if count != tt.count {
+			t.Errorf("%s: count mismatch: have %d, want %d", tt.name, count, tt.count)
+		}
+	}
+	timer, ok := gometrics.DefaultRegistry.Get("rpc/duration/metered_rets").(gometrics.Timer)
+	if !ok || timer.Count() != 3 {
+		t.Errorf("latency timer not updated")
+	}
+}
@@ -20,6 +20,8 @@ import (
 	"context"
 	"errors"
 	"sync"
+
+	"github.com/ethereum/go-ethereum/log"
 )
 
 var (
@@ -56,15 +58,35 @@ type Notifier struct {
 	stopped  bool
 	active   map[ID]*Subscription
 	inactive map[ID]*Subscription
+	queue    chan interface{} // notifications buffered for writing to the connection
 }
 
 // newNotifier creates a new notifier that can be used to send subscription
 // notifications to the client.
 func newNotifier(codec ServerCodec) *Notifier {
-	return &Notifier{
+	n := &Notifier{
 		codec:    codec,
 		active:   make(map[ID]*Subscription),
 		inactive: make(map[ID]*Subscription),
+		queue:    make(chan interface{}, notificationBufferSize),
+	}
+	go n.loop()
+	return n
+}
+
+// loop writes the buffered notifications to the connection until it's closed,
+// decoupling the subscription producers from slow consumers.
+func (n *Notifier) loop() {
+	for {
+		select {
+		case notification := <-n.queue:
+			if err := n.codec.Write(notification); err != nil {
+				n.codec.Close()
+				return
+			}
+		case <-n.codec.Closed():
+			return
+		}
 	}
 }
 
@@ -86,21 +108,27 @@ func (n *Notifier) CreateSubscription() *Subscription {
 	return s
 }
 
-// Notify sends a notification to the client with the given data as payload.
-// If an error occurs the RPC connection is closed and the error is returned.
+// Notify queues a notification to the client with the given data as payload.
+// If the connection can't keep up and its notification buffer is full, the
+// subscription is dropped and ErrSubscriptionQueueOverflow is returned.
 func (n *Notifier) Notify(id ID, data interface{}) error {
-	n.subMu.RLock()
-	defer n.subMu.RUnlock()
+	n.subMu.Lock()
+	defer n.subMu.Unlock()
 
 	sub, active := n.active[id]
-	if active {
-		notification := n.codec.CreateNotification(string(id), sub.namespace, data)
-		if err := n.codec.Write(notification); err != nil {
-			n.codec.Close()
-			return err
-		}
+	if !active {
+		return nil
+	}
+	notification := n.codec.CreateNotification(string(id), sub.namespace, data)
+	select {
+	case n.queue <- notification:
+		return nil
+	default:
+		log.Warn("Dropping slow RPC subscription", "id", id, "namespace", sub.namespace)
+		close(sub.err)
+		delete(n.active, id)
+		return ErrSubscriptionQueueOverflow
 	}
-	return nil
 }
 
 // Closed returns a channel that is closed when the RPC connection is closed.
@@ -322,3 +322,106 @@ func TestSubscriptionMultipleNamespaces(t *testing.T) {
 		}
 	}
 }
+
+// Tests that subscriptions of connections not keeping up with the notifications
+// are dropped once the connection's notification buffer fills up, without the
+// notifying producer being blocked.
+func TestNotifierOverflow(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	codec := NewJSONCodec(serverConn)
+	defer codec.Close()
+
+	// Nobody reads from the client side, stalling all writes
+	notifier := newNotifier(codec)
+	sub := notifier.CreateSubscription()
+	notifier.activate(sub.ID, "eth")
+
+	var err error
+	for i := 0; i < 2*notificationBufferSize && err == nil; i++ {
+		err = notifier.Notify(sub.ID, i)
+	}
+	if err != ErrSubscriptionQueueOverflow {
+		t.Fatalf("notification error mismatch: have %v, want %v", err, ErrSubscriptionQueueOverflow)
+	}
+	select {
+	case <-sub.Err():
+	default:
+		t.Fatalf("overflowing subscription not dropped")
+	}
+	if err := notifier.Notify(sub.ID, 0); err != nil {
+		t.Errorf("notification of dropped subscription failed: %v", err)
+	}
+}
+
+// CreatedSubscriptionService creates subscriptions reporting their IDs.
+type CreatedSubscriptionService struct {
+	created chan ID
+}
+
+func (s *CreatedSubscriptionService) Sub(ctx context.Context) (*Subscription, error) {
+	notifier, supported := NotifierFromContext(ctx)
+	if !supported {
+		return nil, ErrNotificationsUnsupported
+	}
+	subscription := notifier.CreateSubscription()
+	s.created <- subscription.ID
+	return subscription, nil
+}
+
+// Tests that the subscription crossing the response size limit of a batch is
+// delivered, while the ones after it are not created at all.
+func TestSubscriptionBatchResponseCap(t *testing.T) {
+	server := NewServer()
+	service := &CreatedSubscriptionService{created: make(chan ID, 3)}
+	if err := server.RegisterName("eth", service); err != nil {
+		t.Fatalf("unable to register test service %v", err)
+	}
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	go server.ServeCodec(NewJSONCodec(serverConn), OptionMethodInvocation|OptionSubscriptions)
+
+	out := json.NewEncoder(clientConn)
+	in := json.NewDecoder(clientConn)
+
+	// Allow room for a bit more than a single subscription response
+	server.SetBatchLimits(3, 100)
+
+	batch := make([]map[string]interface{}, 3)
+	for i := range batch {
+		batch[i] = map[string]interface{}{
+			"id":      i,
+			"method":  "eth_subscribe",
+			"version": "2.0",
+			"params":  []interface{}{"sub"},
+		}
+	}
+	if err := out.Encode(batch); err != nil {
+		t.Fatal(err)
+	}
+	var responses []map[string]interface{}
+	if err := in.Decode(&responses); err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 3 {
+		t.Fatalf("response count mismatch: have %d, want %d", len(responses), 3)
+	}
+	for i, res := range responses[:2] {
+		if _, failed := res["error"]; failed {
+			t.Fatalf("subscription %d failed: %v", i, res)
+		}
+		if id := <-service.created; id != ID(res["result"].(string)) {
+			t.Errorf("subscription %d: id mismatch: have %s, want %s", i, res["result"], id)
+		}
+	}
+	if _, failed := responses[2]["error"]; !failed {
+		t.Fatalf("third subscription not rejected: %v", responses[2])
+	}
+	select {
+	case id := <-service.created:
+		t.Errorf("rejected subscription %s created", id)
+	default:
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"gopkg.in/fatih/set.v0"
@@ -79,6 +80,15 @@ type Server struct {
 	run      int32
 	codecsMu sync.Mutex
 	codecs   *set.Set
+
+	batchItemLimit       int // Maximum number of requests in a batch (0 = unlimited)
+	batchResponseMaxSize int // Maximum total response bytes of a batch (0 = unlimited)
+
+	methodLimit int                      // Maximum concurrent executions per method (0 = unlimited)
+	methodSlots map[string]chan struct{} // Execution slots of the methods, created on demand
+	methodMu    sync.Mutex               // Protects the method slots
+
+	slowCallThreshold time.Duration // Execution time beyond which method calls are logged (0 = disabled)
 }
 
 // rpcRequest represents a raw incoming RPC request
@@ -97,6 +107,13 @@ type Error interface {
 	ErrorCode() int // returns the code
 }
 
+// DataError is implemented by errors that carry additional information which is
+// returned to the caller in the data field of the JSON-RPC error object.
+type DataError interface {
+	Error() string          // returns the message
+	ErrorData() interface{} // returns the error data
+}
+
 // ServerCodec implements reading, parsing and writing RPC messages for the server side of
 // a RPC session. Implementations must be go-routine safe since the codec can be called in
 // multiple go-routines concurrently.
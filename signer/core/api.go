@@ -0,0 +1,266 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package core implements an embeddable signer, serving the accounts of a local
+// account manager to nodes using them as an external signer. Every request has
+// to be approved by a UI, which may be a human or a rule engine.
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/signer/fourbyte"
+)
+
+// Version is the version of the external signer API served.
+const Version = "1.0.0"
+
+// ErrRequestDenied is returned if a request is rejected by the UI.
+var ErrRequestDenied = errors.New("request denied")
+
+// ExternalAPI is the API an external signer serves to nodes in the "account"
+// namespace.
+type ExternalAPI interface {
+	// Version returns the version of the signer API.
+	Version(ctx context.Context) (string, error)
+
+	// List returns the addresses of the accounts available for signing.
+	List(ctx context.Context) ([]common.Address, error)
+
+	// SignData signs a hash with the given account, returning the signature in
+	// [R || S || V] format where V is 27 or 28.
+	SignData(ctx context.Context, addr common.Address, hash hexutil.Bytes) (hexutil.Bytes, error)
+
+	// SignTransaction signs a transaction, returning it RLP encoded.
+	SignTransaction(ctx context.Context, args SendTxArgs) (*SignTxResult, error)
+}
+
+// UI approves the requests made to the signer, either by prompting a user or
+// based on rules. Requests not approved are rejected.
+type UI interface {
+	// ApproveListing is called when the accounts of the signer are listed.
+	ApproveListing(req *ListRequest) (bool, error)
+
+	// ApproveSignData is called when a hash is requested to be signed.
+	ApproveSignData(req *SignDataRequest) (bool, error)
+
+	// ApproveTx is called when a transaction is requested to be signed.
+	ApproveTx(req *SignTxRequest) (bool, error)
+}
+
+// SendTxArgs are the fields of a transaction to sign.
+type SendTxArgs struct {
+	From                 common.Address    `json:"from"`
+	To                   *common.Address   `json:"to"`
+	Gas                  *hexutil.Big      `json:"gas"`
+	GasPrice             *hexutil.Big      `json:"gasPrice,omitempty"`
+	MaxFeePerGas         *hexutil.Big      `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *hexutil.Big      `json:"maxPriorityFeePerGas,omitempty"`
+	Value                *hexutil.Big      `json:"value"`
+	Nonce                hexutil.Uint64    `json:"nonce"`
+	Data                 hexutil.Bytes     `json:"data"`
+	AccessList           *types.AccessList `json:"accessList,omitempty"`
+	ChainID              *hexutil.Big      `json:"chainId,omitempty"`
+}
+
+// toTransaction creates the unsigned transaction described by the arguments.
+func (args *SendTxArgs) toTransaction() (*types.Transaction, error) {
+	if args.Gas == nil || args.Value == nil {
+		return nil, errors.New("gas and value must be specified")
+	}
+	switch {
+	case args.MaxFeePerGas != nil || args.MaxPriorityFeePerGas != nil:
+		if args.MaxFeePerGas == nil || args.MaxPriorityFeePerGas == nil || args.GasPrice != nil {
+			return nil, errors.New("both maxFeePerGas and maxPriorityFeePerGas must be specified, without gasPrice")
+		}
+		var list types.AccessList
+		if args.AccessList != nil {
+			list = *args.AccessList
+		}
+		return types.NewDynamicFeeTransaction(uint64(args.Nonce), args.To, args.Value.ToInt(), args.Gas.ToInt(), args.MaxPriorityFeePerGas.ToInt(), args.MaxFeePerGas.ToInt(), args.Data, list), nil
+
+	case args.GasPrice == nil:
+		return nil, errors.New("gasPrice must be specified")
+
+	case args.AccessList != nil:
+		return types.NewAccessListTransaction(uint64(args.Nonce), args.To, args.Value.ToInt(), args.Gas.ToInt(), args.GasPrice.ToInt(), args.Data, *args.AccessList), nil
+
+	case args.To == nil:
+		return types.NewContractCreation(uint64(args.Nonce), args.Value.ToInt(), args.Gas.ToInt(), args.GasPrice.ToInt(), args.Data), nil
+
+	default:
+		return types.NewTransaction(uint64(args.Nonce), *args.To, args.Value.ToInt(), args.Gas.ToInt(), args.GasPrice.ToInt(), args.Data), nil
+	}
+}
+
+// SignTxResult is a signed transaction, RLP encoded.
+type SignTxResult struct {
+	Raw hexutil.Bytes `json:"raw"`
+}
+
+// ListRequest is a request to list the accounts of the signer.
+type ListRequest struct {
+	Accounts []common.Address `json:"accounts"`
+}
+
+// SignDataRequest is a request to sign a hash.
+type SignDataRequest struct {
+	Address common.Address `json:"address"`
+	Hash    hexutil.Bytes  `json:"hash"`
+}
+
+// SignTxRequest is a request to sign a transaction, along with a human readable
+// form of the contract call it makes, if any.
+type SignTxRequest struct {
+	Transaction SendTxArgs    `json:"transaction"`
+	Selector    hexutil.Bytes `json:"selector,omitempty"` // Method selector of the call data, if any
+	Call        string        `json:"call,omitempty"`     // Decoded call, if the selector is known
+	Warnings    []string      `json:"warnings,omitempty"` // Reasons the call couldn't be decoded
+}
+
+// SignerAPI is an external signer backed by the wallets of an account manager,
+// meant to be served in the "account" RPC namespace. The signing accounts must
+// be unlocked, or not require a passphrase.
+type SignerAPI struct {
+	am      *accounts.Manager
+	chainID *big.Int
+	ui      UI
+	methods *fourbyte.Database
+}
+
+// NewSignerAPI creates a signer of transactions for the given chain, asking the
+// UI to approve all requests. The method database is used to decode contract
+// calls for the UI.
+func NewSignerAPI(am *accounts.Manager, chainID *big.Int, ui UI, methods *fourbyte.Database) *SignerAPI {
+	return &SignerAPI{am: am, chainID: chainID, ui: ui, methods: methods}
+}
+
+// Version implements ExternalAPI, returning the version of the signer API.
+func (api *SignerAPI) Version(ctx context.Context) (string, error) {
+	return Version, nil
+}
+
+// List implements ExternalAPI, returning the accounts of all wallets once the UI
+// approves listing them.
+func (api *SignerAPI) List(ctx context.Context) ([]common.Address, error) {
+	var addrs []common.Address
+	for _, wallet := range api.am.Wallets() {
+		for _, account := range wallet.Accounts() {
+			addrs = append(addrs, account.Address)
+		}
+	}
+	if err := approve(api.ui.ApproveListing(&ListRequest{Accounts: addrs})); err != nil {
+		return nil, err
+	}
+	return addrs, nil
+}
+
+// SignData implements ExternalAPI, signing a hash once the UI approves it.
+func (api *SignerAPI) SignData(ctx context.Context, addr common.Address, hash hexutil.Bytes) (hexutil.Bytes, error) {
+	if len(hash) != common.HashLength {
+		return nil, fmt.Errorf("hash must be %d bytes long", common.HashLength)
+	}
+	account := accounts.Account{Address: addr}
+	wallet, err := api.am.Find(account)
+	if err != nil {
+		return nil, err
+	}
+	if err := approve(api.ui.ApproveSignData(&SignDataRequest{Address: addr, Hash: hash})); err != nil {
+		return nil, err
+	}
+	sig, err := wallet.SignHash(account, hash)
+	if err != nil {
+		return nil, err
+	}
+	sig[64] += 27 // Transform V from 0/1 to 27/28 according to the yellow paper
+	return sig, nil
+}
+
+// SignTransaction implements ExternalAPI, signing a transaction once the UI
+// approves it.
+func (api *SignerAPI) SignTransaction(ctx context.Context, args SendTxArgs) (*SignTxResult, error) {
+	if args.ChainID != nil && args.ChainID.ToInt().Cmp(api.chainID) != 0 {
+		return nil, fmt.Errorf("chain id mismatch: have %v, want %v", args.ChainID.ToInt(), api.chainID)
+	}
+	tx, err := args.toTransaction()
+	if err != nil {
+		return nil, err
+	}
+	account := accounts.Account{Address: args.From}
+	wallet, err := api.am.Find(account)
+	if err != nil {
+		return nil, err
+	}
+	if err := approve(api.ui.ApproveTx(api.describe(args))); err != nil {
+		return nil, err
+	}
+	signed, err := wallet.SignTx(account, tx, api.chainID)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := signed.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &SignTxResult{Raw: raw}, nil
+}
+
+// describe creates the approval request for a transaction, decoding the call it
+// makes if possible.
+func (api *SignerAPI) describe(args SendTxArgs) *SignTxRequest {
+	req := &SignTxRequest{Transaction: args}
+	switch {
+	case len(args.Data) == 0:
+		return req
+	case args.To == nil:
+		req.Warnings = append(req.Warnings, "contract creation, code not decoded")
+		return req
+	case len(args.Data) < 4:
+		req.Warnings = append(req.Warnings, "call data too short for a method selector")
+		return req
+	}
+	req.Selector = args.Data[:4]
+	if api.methods == nil {
+		req.Warnings = append(req.Warnings, "no method database to decode the call")
+		return req
+	}
+	call, err := api.methods.Describe(args.Data)
+	if err != nil {
+		req.Warnings = append(req.Warnings, err.Error())
+		return req
+	}
+	req.Call = call
+	return req
+}
+
+// approve converts the result of a UI approval into the error to return from a
+// request.
+func approve(approved bool, err error) error {
+	if err != nil {
+		return err
+	}
+	if !approved {
+		return ErrRequestDenied
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/external"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/fourbyte"
+)
+
+// testUI is a UI recording the last transaction request, approving requests
+// unless told to reject them.
+type testUI struct {
+	reject bool
+	last   *SignTxRequest
+}
+
+func (ui *testUI) ApproveListing(req *ListRequest) (bool, error)      { return !ui.reject, nil }
+func (ui *testUI) ApproveSignData(req *SignDataRequest) (bool, error) { return !ui.reject, nil }
+
+func (ui *testUI) ApproveTx(req *SignTxRequest) (bool, error) {
+	ui.last = req
+	return !ui.reject, nil
+}
+
+// newTestSigner creates a signer over a keystore with a single unlocked account,
+// audited into a log in the given directory and connected to a node side wallet.
+func newTestSigner(t *testing.T, dir string) (accounts.Wallet, accounts.Account, *testUI) {
+	ks := keystore.NewKeyStore(filepath.Join(dir, "keystore"), keystore.LightScryptN, keystore.LightScryptP)
+	account, err := ks.NewAccount("")
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	if err := ks.Unlock(account, ""); err != nil {
+		t.Fatalf("failed to unlock account: %v", err)
+	}
+	ui := new(testUI)
+	api, err := NewAuditLogger(filepath.Join(dir, "audit.log"), NewSignerAPI(accounts.NewManager(ks), big.NewInt(1), ui, fourbyte.New()))
+	if err != nil {
+		t.Fatalf("failed to create audit log: %v", err)
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", api); err != nil {
+		t.Fatalf("failed to register signer: %v", err)
+	}
+	backend, err := external.NewBackendFromClient(rpc.DialInProc(server), "test")
+	if err != nil {
+		t.Fatalf("failed to connect to signer: %v", err)
+	}
+	return backend.Wallets()[0], accounts.Account{Address: account.Address}, ui
+}
+
+// Tests that requests are served to nodes once approved, with contract calls
+// decoded for the UI and every request recorded in the audit log.
+func TestSignerAPI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signer-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	wallet, account, ui := newTestSigner(t, dir)
+	defer wallet.Close()
+
+	if !wallet.Contains(account) {
+		t.Fatalf("signer account not listed")
+	}
+	// Sign a token transfer, which is decoded for the UI
+	var (
+		token   = common.Address{0x0a}
+		chainID = big.NewInt(1)
+		data    = common.FromHex("0xa9059cbb000000000000000000000000000000000000000000000000000000000000000b00000000000000000000000000000000000000000000000000000000000003e8")
+		tx      = types.NewTransaction(0, token, new(big.Int), big.NewInt(50000), big.NewInt(1), data)
+	)
+	signed, err := wallet.SignTx(account, tx, chainID)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	if from, _ := types.Sender(types.NewLondonSigner(chainID), signed); from != account.Address {
+		t.Errorf("sender mismatch: have %x, want %x", from, account.Address)
+	}
+	if want := "transfer(0x000000000000000000000000000000000000000b, 1000)"; ui.last.Call != want {
+		t.Errorf("decoded call mismatch: have %q, want %q", ui.last.Call, want)
+	}
+	// Sign a hash, then reject both kinds of requests
+	hash := crypto.Keccak256([]byte("hello"))
+	sig, err := wallet.SignHash(account, hash)
+	if err != nil {
+		t.Fatalf("failed to sign hash: %v", err)
+	}
+	if pub, err := crypto.SigToPub(hash, sig); err != nil || crypto.PubkeyToAddress(*pub) != account.Address {
+		t.Errorf("hash signer mismatch: %v", err)
+	}
+	ui.reject = true
+	if _, err := wallet.SignTx(account, tx, chainID); err == nil || err.Error() != ErrRequestDenied.Error() {
+		t.Errorf("rejected transaction error mismatch: %v", err)
+	}
+	if _, err := wallet.SignHash(account, hash); err == nil || err.Error() != ErrRequestDenied.Error() {
+		t.Errorf("rejected hash error mismatch: %v", err)
+	}
+	// Transactions for other chains are refused
+	ui.reject = false
+	if _, err := wallet.SignTx(account, tx, big.NewInt(2)); err == nil || !strings.Contains(err.Error(), "chain id mismatch") {
+		t.Errorf("foreign chain error mismatch: %v", err)
+	}
+	// Check that all requests were audited
+	blob, err := ioutil.ReadFile(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatalf("failed to read audit log: %v", err)
+	}
+	audit := string(blob)
+	for _, want := range []string{"msg=SignTransaction", "msg=SignData", "error=\"request denied\"", "chainid=0x2"} {
+		if !strings.Contains(audit, want) {
+			t.Errorf("audit log missing %s:\n%s", want, audit)
+		}
+	}
+}
+
+// Tests that the UI is warned about calls it can't be shown.
+func TestSignerDescribe(t *testing.T) {
+	api := NewSignerAPI(nil, big.NewInt(1), nil, fourbyte.New())
+	to := common.Address{0x0a}
+
+	tests := []struct {
+		args SendTxArgs
+		call string
+		warn string
+	}{
+		{args: SendTxArgs{To: &to}},
+		{args: SendTxArgs{Data: []byte{0x60}}, warn: "contract creation"},
+		{args: SendTxArgs{To: &to, Data: []byte{0x01}}, warn: "too short"},
+		{args: SendTxArgs{To: &to, Data: common.FromHex("0x12345678")}, warn: "unknown method selector"},
+		{args: SendTxArgs{To: &to, Data: common.FromHex("0xd0e30db0")}, call: "deposit()"},
+	}
+	for i, tt := range tests {
+		req := api.describe(tt.args)
+		if req.Call != tt.call {
+			t.Errorf("test %d: call mismatch: have %q, want %q", i, req.Call, tt.call)
+		}
+		if warns := strings.Join(req.Warnings, "\n"); !strings.Contains(warns, tt.warn) || (tt.warn == "" && warns != "") {
+			t.Errorf("test %d: warnings mismatch: have %q, want %q", i, warns, tt.warn)
+		}
+	}
+}
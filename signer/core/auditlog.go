@@ -0,0 +1,89 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// AuditLogger is an external signer API recording every request made to an
+// underlying API, along with its outcome, into an audit log.
+type AuditLogger struct {
+	log log.Logger
+	api ExternalAPI
+}
+
+// NewAuditLogger wraps an API, appending a record of each request to the file at
+// the given path.
+func NewAuditLogger(path string, api ExternalAPI) (*AuditLogger, error) {
+	handler, err := log.FileHandler(path, log.LogfmtFormat())
+	if err != nil {
+		return nil, err
+	}
+	logger := log.New("api", "signer")
+	logger.SetHandler(handler)
+
+	logger.Info("Audit log opened", "path", path)
+	return &AuditLogger{log: logger, api: api}, nil
+}
+
+// Version implements ExternalAPI, it is not audited.
+func (l *AuditLogger) Version(ctx context.Context) (string, error) {
+	return l.api.Version(ctx)
+}
+
+// List implements ExternalAPI, logging the request and the listed accounts.
+func (l *AuditLogger) List(ctx context.Context) ([]common.Address, error) {
+	l.log.Info("List", "type", "request")
+	addrs, err := l.api.List(ctx)
+	if err != nil {
+		l.log.Info("List", "type", "response", "error", err)
+	} else {
+		l.log.Info("List", "type", "response", "accounts", addrs)
+	}
+	return addrs, err
+}
+
+// SignData implements ExternalAPI, logging the request and the signature.
+func (l *AuditLogger) SignData(ctx context.Context, addr common.Address, hash hexutil.Bytes) (hexutil.Bytes, error) {
+	l.log.Info("SignData", "type", "request", "addr", addr, "hash", hash)
+	sig, err := l.api.SignData(ctx, addr, hash)
+	if err != nil {
+		l.log.Info("SignData", "type", "response", "error", err)
+	} else {
+		l.log.Info("SignData", "type", "response", "signature", sig)
+	}
+	return sig, err
+}
+
+// SignTransaction implements ExternalAPI, logging the request and the signed
+// transaction.
+func (l *AuditLogger) SignTransaction(ctx context.Context, args SendTxArgs) (*SignTxResult, error) {
+	l.log.Info("SignTransaction", "type", "request", "from", args.From, "to", args.To, "value", args.Value,
+		"nonce", args.Nonce, "gas", args.Gas, "data", args.Data, "chainid", args.ChainID)
+	res, err := l.api.SignTransaction(ctx, args)
+	if err != nil {
+		l.log.Info("SignTransaction", "type", "response", "error", err)
+	} else {
+		l.log.Info("SignTransaction", "type", "response", "raw", res.Raw)
+	}
+	return res, err
+}
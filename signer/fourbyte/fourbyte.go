@@ -0,0 +1,209 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package fourbyte contains a database of contract method signatures indexed by
+// their 4-byte selector, used to show the calls made by transactions in a human
+// readable form.
+package fourbyte
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// builtin are the signatures of the standard token methods, known to every
+// database.
+var builtin = []string{
+	"transfer(address,uint256)",
+	"transferFrom(address,address,uint256)",
+	"approve(address,uint256)",
+	"safeTransferFrom(address,address,uint256)",
+	"safeTransferFrom(address,address,uint256,bytes)",
+	"setApprovalForAll(address,bool)",
+	"deposit()",
+	"withdraw(uint256)",
+}
+
+// Database maps 4-byte selectors to the signatures of the methods they select.
+type Database struct {
+	lock    sync.RWMutex
+	methods map[[4]byte]abi.Method
+}
+
+// New creates a database knowing the signatures of the standard token methods.
+func New() *Database {
+	db := &Database{methods: make(map[[4]byte]abi.Method)}
+	for _, sig := range builtin {
+		if err := db.Add(sig); err != nil {
+			panic(fmt.Sprintf("invalid builtin signature %q: %v", sig, err))
+		}
+	}
+	return db
+}
+
+// NewFromFile creates a database with the standard token methods, extended with
+// the signatures in the given JSON file. The file holds an object mapping hex
+// selectors to signatures, which are checked to match.
+func NewFromFile(path string) (*Database, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var sigs map[string]string
+	if err := json.Unmarshal(blob, &sigs); err != nil {
+		return nil, err
+	}
+	db := New()
+	for selector, sig := range sigs {
+		id, err := hexutil.Decode(selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %v", selector, err)
+		}
+		if !bytes.Equal(id, crypto.Keccak256([]byte(sig))[:4]) {
+			return nil, fmt.Errorf("selector %s doesn't match signature %q", selector, sig)
+		}
+		if err := db.Add(sig); err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// Add parses a canonical method signature such as "transfer(address,uint256)"
+// and adds it to the database.
+func (db *Database) Add(sig string) error {
+	method, err := parseSignature(sig)
+	if err != nil {
+		return err
+	}
+	var id [4]byte
+	copy(id[:], method.Id())
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.methods[id] = method
+	return nil
+}
+
+// Signature returns the signature of the method selected by the first 4 bytes
+// of some call data, if known.
+func (db *Database) Signature(data []byte) (string, bool) {
+	method, ok := db.method(data)
+	if !ok {
+		return "", false
+	}
+	return method.Sig(), true
+}
+
+// method returns the method selected by the first 4 bytes of some call data.
+func (db *Database) method(data []byte) (abi.Method, bool) {
+	if len(data) < 4 {
+		return abi.Method{}, false
+	}
+	var id [4]byte
+	copy(id[:], data)
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	method, ok := db.methods[id]
+	return method, ok
+}
+
+// Describe returns a human readable form of the call made by some call data,
+// such as "transfer(0x9a9f…, 1000)". An error is returned if the selector is
+// unknown or the arguments don't match the method signature.
+func (db *Database) Describe(data []byte) (string, error) {
+	if len(data) < 4 {
+		return "", fmt.Errorf("call data too short for a selector: %d bytes", len(data))
+	}
+	method, ok := db.method(data)
+	if !ok {
+		return "", fmt.Errorf("unknown method selector %x", data[:4])
+	}
+	args, err := method.UnpackInputs(data[4:])
+	if err != nil {
+		return "", fmt.Errorf("invalid arguments for %s: %v", method.Sig(), err)
+	}
+	// Fixed size byte arrays are unpacked as whole words, cut them to size
+	for i, input := range method.Inputs {
+		if word, ok := args[i].([]byte); ok && input.Type.T == abi.FixedBytesTy {
+			array := reflect.New(reflect.ArrayOf(input.Type.SliceSize, reflect.TypeOf(byte(0)))).Elem()
+			reflect.Copy(array, reflect.ValueOf(word))
+			args[i] = array.Interface()
+		}
+	}
+	// Make sure the arguments are canonically encoded, so nothing can be hidden in
+	// the call data outside of what's shown
+	packed, err := abi.ABI{Methods: map[string]abi.Method{method.Name: method}}.Pack(method.Name, args...)
+	if err != nil || !bytes.Equal(packed, data) {
+		return "", fmt.Errorf("call data doesn't match %s", method.Sig())
+	}
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		strs[i] = formatValue(arg)
+	}
+	return fmt.Sprintf("%s(%s)", method.Name, strings.Join(strs, ", ")), nil
+}
+
+// formatValue returns a human readable form of an unpacked argument.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case common.Address:
+		return v.Hex()
+	case []byte:
+		return hexutil.Encode(v)
+	case *big.Int:
+		return v.String()
+	case string:
+		return fmt.Sprintf("%q", v)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// parseSignature creates a method from its canonical signature.
+func parseSignature(sig string) (abi.Method, error) {
+	open := strings.Index(sig, "(")
+	if open <= 0 || !strings.HasSuffix(sig, ")") {
+		return abi.Method{}, fmt.Errorf("invalid method signature %q", sig)
+	}
+	method := abi.Method{Name: sig[:open]}
+	if params := sig[open+1 : len(sig)-1]; params != "" {
+		for _, param := range strings.Split(params, ",") {
+			typ, err := abi.NewType(param)
+			if err != nil {
+				return abi.Method{}, fmt.Errorf("invalid method signature %q: %v", sig, err)
+			}
+			method.Inputs = append(method.Inputs, abi.Argument{Type: typ})
+		}
+	}
+	if method.Sig() != sig {
+		return abi.Method{}, fmt.Errorf("non-canonical method signature %q", sig)
+	}
+	return method, nil
+}
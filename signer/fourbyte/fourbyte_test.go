@@ -0,0 +1,112 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package fourbyte
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Tests that calls are described from their call data, rejecting unknown
+// selectors and malformed arguments.
+func TestDescribe(t *testing.T) {
+	db := New()
+	if err := db.Add("setName(string,bytes4)"); err != nil {
+		t.Fatalf("failed to add signature: %v", err)
+	}
+	tests := []struct {
+		data string
+		want string
+		fail bool
+	}{
+		{
+			data: "0xa9059cbb0000000000000000000000009a9f2ccfde556a7e9ff0848998aa4a0cfd8863ae00000000000000000000000000000000000000000000000000000000000003e8",
+			want: "transfer(0x9a9f2ccfde556a7e9ff0848998aa4a0cfd8863ae, 1000)",
+		},
+		{
+			data: "0xd0e30db0",
+			want: "deposit()",
+		},
+		{
+			data: "0x5a7f274e" +
+				"0000000000000000000000000000000000000000000000000000000000000040" +
+				"0102030400000000000000000000000000000000000000000000000000000000" +
+				"0000000000000000000000000000000000000000000000000000000000000003" +
+				"626f620000000000000000000000000000000000000000000000000000000000",
+			want: `setName("bob", [1 2 3 4])`,
+		},
+		// Unknown selector
+		{data: "0x12345678", fail: true},
+		// Missing selector
+		{data: "0xa905", fail: true},
+		// Truncated arguments
+		{data: "0xa9059cbb0000000000000000000000009a9f2ccfde556a7e9ff0848998aa4a0cfd8863ae", fail: true},
+		// Trailing data not covered by the arguments
+		{data: "0xd0e30db00000000000000000000000000000000000000000000000000000000000000001", fail: true},
+		// Non-canonical address encoding
+		{
+			data: "0xa9059cbbff0000000000000000000000009a9f2ccfde556a7e9ff0848998aa4a0cfd8863ae00000000000000000000000000000000000000000000000000000000000003e8",
+			fail: true,
+		},
+	}
+	for i, tt := range tests {
+		have, err := db.Describe(common.FromHex(tt.data))
+		if (err != nil) != tt.fail {
+			t.Errorf("test %d: error mismatch: have %v, want failure %v", i, err, tt.fail)
+			continue
+		}
+		if have != tt.want {
+			t.Errorf("test %d: description mismatch: have %s, want %s", i, have, tt.want)
+		}
+	}
+}
+
+// Tests that signatures are loaded from files, checking them against their
+// selectors.
+func TestNewFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fourbyte-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "4byte.json")
+	ioutil.WriteFile(path, []byte(`{"0x70a08231": "balanceOf(address)"}`), 0600)
+
+	db, err := NewFromFile(path)
+	if err != nil {
+		t.Fatalf("failed to load database: %v", err)
+	}
+	if sig, ok := db.Signature(common.FromHex("0x70a08231")); !ok || sig != "balanceOf(address)" {
+		t.Errorf("loaded signature mismatch: have %q, %v", sig, ok)
+	}
+	if sig, ok := db.Signature(common.FromHex("0xa9059cbb")); !ok || sig != "transfer(address,uint256)" {
+		t.Errorf("builtin signature mismatch: have %q, %v", sig, ok)
+	}
+	ioutil.WriteFile(path, []byte(`{"0x12345678": "balanceOf(address)"}`), 0600)
+	if _, err := NewFromFile(path); err == nil {
+		t.Errorf("mismatching selector accepted")
+	}
+	ioutil.WriteFile(path, []byte(`{"0xa5395601": "add(uint)"}`), 0600)
+	if _, err := NewFromFile(path); err == nil {
+		t.Errorf("non-canonical signature accepted")
+	}
+}
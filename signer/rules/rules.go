@@ -0,0 +1,161 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package rules implements a signer UI deciding on requests with rules written
+// in JavaScript.
+//
+// A rule set defines any of the functions ApproveListing, ApproveSignData and
+// ApproveTx, each taking the request as a JSON object. Returning "Approve" or
+// "Reject" decides on the request, while returning anything else, throwing or
+// not defining the function leaves the decision to the manual UI. Transaction
+// values are hex strings, which big() converts into a BigNumber:
+//
+//	function ApproveTx(req) {
+//		if (req.transaction.to == "0xae967917c465db8578ca9024c205720b1a3651a9") {
+//			return big(req.transaction.value).lt(big("1e18")) ? "Approve" : "Reject"
+//		}
+//	}
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/internal/jsre/deps"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/signer/core"
+	"github.com/robertkrimen/otto"
+)
+
+// Decisions a rule can take on a request.
+const (
+	Approve = "Approve"
+	Reject  = "Reject"
+)
+
+// bigHelper defines big(), converting decimal and 0x prefixed hex strings into
+// BigNumbers.
+const bigHelper = `
+function big(value) {
+	if (typeof value == "string" && value.indexOf("0x") == 0) {
+		return new BigNumber(value.substr(2) || "0", 16);
+	}
+	return new BigNumber(value);
+}
+`
+
+// RuleEvaluator is a signer UI deciding on requests with a JavaScript rule set,
+// deferring to a manual UI on the requests the rules don't decide on.
+type RuleEvaluator struct {
+	vm     *otto.Otto
+	manual core.UI
+	lock   sync.Mutex // The JavaScript VM is not safe for concurrent use
+}
+
+// NewRuleEvaluator creates a UI evaluating the given rule set. Requests left
+// undecided by the rules are passed on to the manual UI, or rejected if nil.
+func NewRuleEvaluator(rules string, manual core.UI) (*RuleEvaluator, error) {
+	vm := otto.New()
+	if _, err := vm.Run(deps.MustAsset("bignumber.js")); err != nil {
+		return nil, err
+	}
+	if _, err := vm.Run(bigHelper); err != nil {
+		return nil, err
+	}
+	console, _ := vm.Object("console = {}")
+	console.Set("log", func(call otto.FunctionCall) otto.Value {
+		args := make([]interface{}, len(call.ArgumentList))
+		for i, arg := range call.ArgumentList {
+			args[i] = arg.String()
+		}
+		log.Info("Signer rule output", "msg", fmt.Sprint(args...))
+		return otto.UndefinedValue()
+	})
+	if _, err := vm.Run(rules); err != nil {
+		return nil, fmt.Errorf("invalid rules: %v", err)
+	}
+	return &RuleEvaluator{vm: vm, manual: manual}, nil
+}
+
+// ApproveListing implements core.UI, evaluating the ApproveListing rule.
+func (r *RuleEvaluator) ApproveListing(req *core.ListRequest) (bool, error) {
+	if approved, decided := r.evaluate("ApproveListing", req); decided {
+		return approved, nil
+	}
+	if r.manual == nil {
+		return false, nil
+	}
+	return r.manual.ApproveListing(req)
+}
+
+// ApproveSignData implements core.UI, evaluating the ApproveSignData rule.
+func (r *RuleEvaluator) ApproveSignData(req *core.SignDataRequest) (bool, error) {
+	if approved, decided := r.evaluate("ApproveSignData", req); decided {
+		return approved, nil
+	}
+	if r.manual == nil {
+		return false, nil
+	}
+	return r.manual.ApproveSignData(req)
+}
+
+// ApproveTx implements core.UI, evaluating the ApproveTx rule.
+func (r *RuleEvaluator) ApproveTx(req *core.SignTxRequest) (bool, error) {
+	if approved, decided := r.evaluate("ApproveTx", req); decided {
+		return approved, nil
+	}
+	if r.manual == nil {
+		return false, nil
+	}
+	return r.manual.ApproveTx(req)
+}
+
+// evaluate calls a rule with a request, returning whether the rule approved it
+// and whether it decided on it at all.
+func (r *RuleEvaluator) evaluate(rule string, req interface{}) (approved bool, decided bool) {
+	blob, err := json.Marshal(req)
+	if err != nil {
+		log.Warn("Failed to encode signer request", "rule", rule, "err", err)
+		return false, false
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	fn, err := r.vm.Get(rule)
+	if err != nil || !fn.IsFunction() {
+		return false, false
+	}
+	obj, err := r.vm.Call("JSON.parse", nil, string(blob))
+	if err != nil {
+		log.Warn("Failed to decode signer request", "rule", rule, "err", err)
+		return false, false
+	}
+	res, err := fn.Call(otto.NullValue(), obj)
+	if err != nil {
+		log.Warn("Signer rule failed", "rule", rule, "err", err)
+		return false, false
+	}
+	switch res.String() {
+	case Approve:
+		log.Info("Signer rule approved request", "rule", rule)
+		return true, true
+	case Reject:
+		log.Info("Signer rule rejected request", "rule", rule)
+		return false, true
+	}
+	return false, false
+}
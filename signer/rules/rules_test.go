@@ -0,0 +1,132 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rules
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/signer/core"
+)
+
+// manualUI is a UI counting the requests it is asked about, approving them all.
+type manualUI struct {
+	asked int
+}
+
+func (ui *manualUI) ApproveListing(req *core.ListRequest) (bool, error) {
+	ui.asked++
+	return true, nil
+}
+
+func (ui *manualUI) ApproveSignData(req *core.SignDataRequest) (bool, error) {
+	ui.asked++
+	return true, nil
+}
+
+func (ui *manualUI) ApproveTx(req *core.SignTxRequest) (bool, error) {
+	ui.asked++
+	return true, nil
+}
+
+const testRules = `
+var trusted = "0x000000000000000000000000000000000000000a";
+
+function ApproveTx(req) {
+	var tx = req.transaction;
+	if (tx.to == trusted && big(tx.value).lte(big("1000"))) {
+		return "Approve";
+	}
+	if (req.selector == "0x095ea7b3") {
+		return "Reject"; // Never approve token allowances
+	}
+	if (tx.to == "0x000000000000000000000000000000000000000b") {
+		throw new Error("broken rule");
+	}
+}
+
+function ApproveSignData(req) {
+	return "Reject";
+}
+`
+
+func newTxRequest(to byte, value int64, selector string) *core.SignTxRequest {
+	addr := common.Address{19: to}
+	return &core.SignTxRequest{
+		Transaction: core.SendTxArgs{To: &addr, Value: (*hexutil.Big)(big.NewInt(value))},
+		Selector:    common.FromHex(selector),
+	}
+}
+
+// Tests that rules approve or reject requests, deferring to the manual UI when
+// they don't decide.
+func TestRuleEvaluator(t *testing.T) {
+	manual := new(manualUI)
+	rules, err := NewRuleEvaluator(testRules, manual)
+	if err != nil {
+		t.Fatalf("failed to create rule evaluator: %v", err)
+	}
+	tests := []struct {
+		req      *core.SignTxRequest
+		approved bool
+		manual   bool
+	}{
+		{req: newTxRequest(0x0a, 1000, ""), approved: true},
+		{req: newTxRequest(0x0a, 1001, ""), approved: true, manual: true},
+		{req: newTxRequest(0x0c, 0, "0x095ea7b3"), approved: false},
+		{req: newTxRequest(0x0c, 0, "0xa9059cbb"), approved: true, manual: true},
+		{req: newTxRequest(0x0b, 0, ""), approved: true, manual: true},
+	}
+	for i, tt := range tests {
+		asked := manual.asked
+		approved, err := rules.ApproveTx(tt.req)
+		if err != nil {
+			t.Fatalf("test %d: failed to evaluate: %v", i, err)
+		}
+		if approved != tt.approved {
+			t.Errorf("test %d: approval mismatch: have %v, want %v", i, approved, tt.approved)
+		}
+		if (manual.asked > asked) != tt.manual {
+			t.Errorf("test %d: manual approval mismatch: have %v, want %v", i, manual.asked > asked, tt.manual)
+		}
+	}
+	// Requests without rules are decided manually, rejected rules aren't
+	asked := manual.asked
+	if approved, _ := rules.ApproveListing(&core.ListRequest{}); !approved || manual.asked != asked+1 {
+		t.Errorf("listing without rule not deferred to manual UI")
+	}
+	if approved, _ := rules.ApproveSignData(&core.SignDataRequest{}); approved || manual.asked != asked+1 {
+		t.Errorf("rejected data signing not rejected")
+	}
+}
+
+// Tests that undecided requests are rejected without a manual UI, and that
+// invalid rule sets are refused.
+func TestRuleEvaluatorNoManual(t *testing.T) {
+	rules, err := NewRuleEvaluator(testRules, nil)
+	if err != nil {
+		t.Fatalf("failed to create rule evaluator: %v", err)
+	}
+	if approved, _ := rules.ApproveTx(newTxRequest(0x0c, 0, "")); approved {
+		t.Errorf("undecided request approved without manual UI")
+	}
+	if _, err := NewRuleEvaluator("function ApproveTx(req) {", nil); err == nil {
+		t.Errorf("invalid rules accepted")
+	}
+}
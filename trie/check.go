@@ -0,0 +1,99 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// CheckReport summarizes the problems found while checking the consistency of
+// tries stored in a database.
+type CheckReport struct {
+	Nodes   int           `json:"nodes"`   // Number of nodes verified
+	Missing []common.Hash `json:"missing"` // Referenced nodes absent from the database
+	Corrupt []common.Hash `json:"corrupt"` // Nodes whose content doesn't match their hash
+}
+
+// Check walks the Keccak256 hashed trie with the given root, verifying that all
+// its nodes are present in the database and match their hashes. The findings
+// are added to the report. Subtries below missing or corrupt nodes can't be
+// reached and are skipped.
+//
+// The values stored in the trie are passed to onLeaf, which may be nil. The walk
+// is aborted if it returns an error.
+func Check(root common.Hash, db DatabaseReader, report *CheckReport, onLeaf func(value []byte) error) error {
+	if root == emptyRoot {
+		return nil
+	}
+	c := &checker{db: db, report: report, onLeaf: onLeaf}
+	return c.checkHash(root[:])
+}
+
+// checker is the state of a single trie consistency check.
+type checker struct {
+	db     DatabaseReader
+	report *CheckReport
+	onLeaf func(value []byte) error
+}
+
+// checkHash loads and verifies the node with the given hash, walking its
+// children afterwards.
+func (c *checker) checkHash(hash []byte) error {
+	blob, _ := c.db.Get(hash)
+	if len(blob) == 0 {
+		c.report.Missing = append(c.report.Missing, common.BytesToHash(hash))
+		return nil
+	}
+	if !bytes.Equal(crypto.Keccak256(blob), hash) {
+		c.report.Corrupt = append(c.report.Corrupt, common.BytesToHash(hash))
+		return nil
+	}
+	n, err := decodeNode(hash, blob, 0)
+	if err != nil {
+		c.report.Corrupt = append(c.report.Corrupt, common.BytesToHash(hash))
+		return nil
+	}
+	c.report.Nodes++
+	return c.checkNode(n)
+}
+
+// checkNode walks the children of a decoded node, including the ones embedded
+// into their parents.
+func (c *checker) checkNode(n node) error {
+	switch n := n.(type) {
+	case *shortNode:
+		return c.checkNode(n.Val)
+	case *fullNode:
+		for _, child := range n.Children {
+			if child != nil {
+				if err := c.checkNode(child); err != nil {
+					return err
+				}
+			}
+		}
+	case hashNode:
+		return c.checkHash(n)
+	case valueNode:
+		if c.onLeaf != nil {
+			return c.onLeaf(n)
+		}
+	}
+	return nil
+}
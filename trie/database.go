@@ -0,0 +1,568 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// trieJournalKey is the database key of the journal holding the nodes cached by
+// a node database during its last shutdown.
+var trieJournalKey = []byte("TrieJournal")
+
+// cachedNode is all the information we know about a single cached trie node
+// in the memory database write layer.
+type cachedNode struct {
+	blob     []byte              // Encoded node blob (immutable)
+	parents  int                 // Number of live nodes referencing this one
+	children map[common.Hash]int // Children referenced by this nodes
+
+	flushPrev common.Hash // Previous node in the flush-list
+	flushNext common.Hash // Next node in the flush-list
+}
+
+// NodeDatabase is an intermediate write layer between the trie data structures
+// and the disk database. The aim is to accumulate trie writes in-memory and only
+// periodically flush a couple tries to disk, garbage collecting the remainder.
+//
+// Every node written into the database tracks the nodes it references, and
+// every node keeps count of how many live parents reference it. Tries that are
+// no longer needed can be dereferenced, which deletes all of their nodes not
+// shared with other live tries. The root of a trie must be referenced from the
+// zero hash (the metaroot) to keep it alive.
+//
+// NodeDatabase implements the Database interface, so tries can be opened on
+// top of it and committed into it directly. Values with keys that aren't 32
+// byte hashes (e.g. preimages of secure trie keys) are written through to disk.
+// Contract code must be written to the disk database directly: no trie node
+// references it, so it would never be committed from the cache.
+//
+// Leaves may reference other tries too (e.g. the storage tries of accounts in
+// the state trie). These references are only known to the user of the trie,
+// which can expose them through a LeafResolver.
+//
+// Nodes are kept in a flush-list in insertion order, which always places them
+// after their children. If the cache grows too large, the oldest nodes can be
+// flushed to disk without ever persisting a node whose children are missing.
+type NodeDatabase struct {
+	diskdb   ethdb.Database // Persistent storage for matured trie nodes
+	resolver LeafResolver   // Resolver for the tries referenced from leaves, nil if none
+
+	nodes  map[common.Hash]*cachedNode // Data and references relationships of a node
+	oldest common.Hash                 // Oldest tracked node, flush-list head
+	newest common.Hash                 // Newest tracked node, flush-list tail
+
+	gcnodes uint64             // Nodes garbage collected since last commit
+	gcsize  common.StorageSize // Data storage garbage collected since last commit
+	gctime  time.Duration      // Time spent on garbage collection since last commit
+
+	flushnodes uint64             // Nodes flushed since last commit
+	flushsize  common.StorageSize // Data storage flushed since last commit
+	flushtime  time.Duration      // Time spent on data flushing since last commit
+
+	nodesSize common.StorageSize // Storage size of the nodes cache
+	limit     common.StorageSize // Memory allowance after which nodes are flushed, zero for none
+
+	lock sync.RWMutex
+}
+
+// LeafResolver returns the roots of the tries referenced from the value of a
+// trie leaf, so that the node database keeps them alive along with the leaf.
+type LeafResolver func(leaf []byte) []common.Hash
+
+// NewNodeDatabase creates a new trie node database to store ephemeral trie
+// content before it is written out to disk or garbage collected. If a journal
+// was left in the disk database by an earlier shutdown, the cached nodes and
+// root references are restored from it. The resolver may be nil if the leaves
+// of the stored tries don't reference other tries.
+func NewNodeDatabase(diskdb ethdb.Database, resolver LeafResolver) *NodeDatabase {
+	db := &NodeDatabase{
+		diskdb:   diskdb,
+		resolver: resolver,
+		nodes: map[common.Hash]*cachedNode{
+			{}: {children: make(map[common.Hash]int)},
+		},
+	}
+	db.loadJournal()
+	return db
+}
+
+// DiskDB retrieves the persistent storage backing the trie node database.
+func (db *NodeDatabase) DiskDB() ethdb.Database {
+	return db.diskdb
+}
+
+// Put inserts a trie node into the memory database. All direct references to
+// other trie nodes contained in the blob are tracked, so that the children
+// are kept alive by this node.
+func (db *NodeDatabase) Put(key []byte, value []byte) error {
+	if len(key) != common.HashLength {
+		return db.diskdb.Put(key, value)
+	}
+	hash := common.BytesToHash(key)
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	// If the node's already cached, skip
+	if _, ok := db.nodes[hash]; ok {
+		return nil
+	}
+	entry := &cachedNode{
+		blob:      common.CopyBytes(value),
+		children:  make(map[common.Hash]int),
+		flushPrev: db.newest,
+	}
+	db.nodes[hash] = entry
+	db.nodesSize += common.StorageSize(common.HashLength + len(value))
+
+	// Track all direct parent->child node references, including the tries
+	// referenced from leaves
+	for _, child := range nodeChildren(hash, value, db.resolver) {
+		db.reference(child, hash)
+	}
+	// Append the node to the end of the flush-list
+	if db.oldest == (common.Hash{}) {
+		db.oldest, db.newest = hash, hash
+	} else {
+		db.nodes[db.newest].flushNext, db.newest = hash, hash
+	}
+	// Flush the oldest nodes if the memory allowance was exceeded
+	if db.limit > 0 && db.nodesSize > db.limit {
+		return db.cap(db.limit)
+	}
+	return nil
+}
+
+// SetLimit sets the memory allowance of the cached nodes. Whenever inserting a
+// node exceeds it, the oldest nodes are flushed to disk until the cache fits
+// into it again. A zero limit disables the automatic flushing.
+func (db *NodeDatabase) SetLimit(limit common.StorageSize) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.limit = limit
+}
+
+// removeFromFlushList unlinks a cached node from the flush-list.
+func (db *NodeDatabase) removeFromFlushList(hash common.Hash, node *cachedNode) {
+	switch hash {
+	case db.oldest:
+		db.oldest = node.flushNext
+		if db.oldest != (common.Hash{}) {
+			db.nodes[node.flushNext].flushPrev = common.Hash{}
+		}
+	case db.newest:
+		db.newest = node.flushPrev
+		db.nodes[node.flushPrev].flushNext = common.Hash{}
+	default:
+		db.nodes[node.flushPrev].flushNext = node.flushNext
+		db.nodes[node.flushNext].flushPrev = node.flushPrev
+	}
+	if db.oldest == (common.Hash{}) {
+		db.newest = common.Hash{}
+	}
+}
+
+// nodeChildren decodes a trie node blob and returns the hashes of all the
+// nodes directly referenced from it, along with the roots of the tries its
+// leaves reference according to the resolver.
+func nodeChildren(hash common.Hash, blob []byte, resolver LeafResolver) []common.Hash {
+	n, err := decodeNode(hash[:], blob, 0)
+	if err != nil {
+		return nil
+	}
+	return gatherChildren(n, resolver, nil)
+}
+
+// gatherChildren appends the references of a decoded node to children, walking
+// into the nodes embedded in it.
+func gatherChildren(n node, resolver LeafResolver, children []common.Hash) []common.Hash {
+	switch n := n.(type) {
+	case *shortNode:
+		return gatherChildren(n.Val, resolver, children)
+	case *fullNode:
+		for i := 0; i < 17; i++ {
+			children = gatherChildren(n.Children[i], resolver, children)
+		}
+	case hashNode:
+		children = append(children, common.BytesToHash(n))
+	case valueNode:
+		if resolver != nil {
+			children = append(children, resolver(n)...)
+		}
+	}
+	return children
+}
+
+// Get retrieves a trie node from the memory cache, or from the persistent
+// database if it's not cached.
+func (db *NodeDatabase) Get(key []byte) ([]byte, error) {
+	if len(key) == common.HashLength {
+		db.lock.RLock()
+		node := db.nodes[common.BytesToHash(key)]
+		db.lock.RUnlock()
+
+		if node != nil {
+			return node.blob, nil
+		}
+	}
+	return db.diskdb.Get(key)
+}
+
+// Nodes retrieves the hashes of all the nodes cached within the memory database.
+// This method is extremely expensive and should only be used to validate internal
+// states in test code.
+func (db *NodeDatabase) Nodes() []common.Hash {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var hashes = make([]common.Hash, 0, len(db.nodes))
+	for hash := range db.nodes {
+		if hash != (common.Hash{}) { // Special case for "root" references/nodes
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes
+}
+
+// Roots returns the roots of the tries currently kept alive by references from
+// the metaroot.
+func (db *NodeDatabase) Roots() []common.Hash {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	roots := make([]common.Hash, 0, len(db.nodes[common.Hash{}].children))
+	for root := range db.nodes[common.Hash{}].children {
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+// Reference adds a new reference from a parent node to a child node. Use the
+// zero hash as the parent to keep the root of a trie alive.
+func (db *NodeDatabase) Reference(child common.Hash, parent common.Hash) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.reference(child, parent)
+}
+
+// reference is the private locked version of Reference.
+func (db *NodeDatabase) reference(child common.Hash, parent common.Hash) {
+	// If the node does not exist, it's a node pulled from disk, skip
+	node, ok := db.nodes[child]
+	if !ok {
+		return
+	}
+	// If the parent is a flushed node, it can't keep anything alive
+	pnode, ok := db.nodes[parent]
+	if !ok {
+		return
+	}
+	// If the reference already exists, only duplicate for roots
+	if _, ok = pnode.children[child]; ok && parent != (common.Hash{}) {
+		return
+	}
+	node.parents++
+	pnode.children[child]++
+}
+
+// Dereference removes an existing reference from the metaroot to a trie root,
+// deleting all the nodes of the trie that are no longer referenced.
+func (db *NodeDatabase) Dereference(root common.Hash) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	nodes, storage, start := len(db.nodes), db.nodesSize, time.Now()
+	db.dereference(root, common.Hash{})
+
+	db.gcnodes += uint64(nodes - len(db.nodes))
+	db.gcsize += storage - db.nodesSize
+	db.gctime += time.Since(start)
+
+	log.Debug("Dereferenced trie from memory database", "nodes", nodes-len(db.nodes), "size", storage-db.nodesSize, "time", time.Since(start),
+		"gcnodes", db.gcnodes, "gcsize", db.gcsize, "gctime", db.gctime, "livenodes", len(db.nodes), "livesize", db.nodesSize)
+}
+
+// dereference is the private locked version of Dereference.
+func (db *NodeDatabase) dereference(child common.Hash, parent common.Hash) {
+	// Dereference the parent-child
+	if node, ok := db.nodes[parent]; ok {
+		if _, ok := node.children[child]; !ok {
+			return
+		}
+		node.children[child]--
+		if node.children[child] == 0 {
+			delete(node.children, child)
+		}
+	}
+	// If the node does not exist, it's a previously committed node.
+	node, ok := db.nodes[child]
+	if !ok {
+		return
+	}
+	// If there are no more references to the child, delete it and cascade
+	node.parents--
+	if node.parents == 0 {
+		for hash := range node.children {
+			db.dereference(hash, child)
+		}
+		db.removeFromFlushList(child, node)
+		delete(db.nodes, child)
+		db.nodesSize -= common.StorageSize(common.HashLength + len(node.blob))
+	}
+}
+
+// Commit iterates over all the children of a particular node, writes them out
+// to disk, forcefully tearing down all references in both directions. The
+// flushed nodes are removed from the memory cache.
+func (db *NodeDatabase) Commit(node common.Hash) error {
+	// Create a database batch to flush persistent data out. It is important that
+	// outside code doesn't see an inconsistent state (referenced data removed from
+	// memory cache during commit but not yet in persistent storage). This is ensured
+	// by only uncaching existing data when the database write finalizes.
+	db.lock.RLock()
+
+	start := time.Now()
+	batch := db.diskdb.NewBatch()
+
+	nodes, storage := len(db.nodes), db.nodesSize
+	if err := db.commit(node, batch); err != nil {
+		log.Error("Failed to commit trie from trie database", "err", err)
+		db.lock.RUnlock()
+		return err
+	}
+	// Write batch ready, unlock for readers during persistence
+	if err := batch.Write(); err != nil {
+		log.Error("Failed to write trie to disk", "err", err)
+		db.lock.RUnlock()
+		return err
+	}
+	db.lock.RUnlock()
+
+	// Write successful, clear out the flushed data
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.uncache(node)
+
+	log.Debug("Persisted trie from memory database", "nodes", nodes-len(db.nodes), "size", storage-db.nodesSize, "time", time.Since(start),
+		"gcnodes", db.gcnodes, "gcsize", db.gcsize, "gctime", db.gctime, "livenodes", len(db.nodes), "livesize", db.nodesSize)
+
+	// Reset the garbage collection and flushing statistics
+	db.gcnodes, db.gcsize, db.gctime = 0, 0, 0
+	db.flushnodes, db.flushsize, db.flushtime = 0, 0, 0
+
+	return nil
+}
+
+// Cap flushes the oldest cached nodes to disk until the memory cache shrinks
+// below the given limit. As nodes are always flushed after their children, the
+// persisted data is consistent even if the remaining nodes are lost. Flushed
+// nodes are removed from the cache, but the tries referencing them stay usable.
+func (db *NodeDatabase) Cap(limit common.StorageSize) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return db.cap(limit)
+}
+
+// cap is the private locked version of Cap.
+func (db *NodeDatabase) cap(limit common.StorageSize) error {
+	var (
+		start   = time.Now()
+		nodes   = len(db.nodes)
+		storage = db.nodesSize
+		batch   = db.diskdb.NewBatch()
+		size    = db.nodesSize
+	)
+	// Write out the oldest nodes until the rest fits into the limit
+	for oldest := db.oldest; size > limit && oldest != (common.Hash{}); {
+		node := db.nodes[oldest]
+		if err := batch.Put(oldest[:], node.blob); err != nil {
+			return err
+		}
+		size -= common.StorageSize(common.HashLength + len(node.blob))
+		oldest = node.flushNext
+	}
+	if err := batch.Write(); err != nil {
+		log.Error("Failed to write flush list to disk", "err", err)
+		return err
+	}
+	// Write successful, clear out the flushed data
+	for db.nodesSize > size {
+		node := db.nodes[db.oldest]
+		delete(db.nodes, db.oldest)
+		db.nodesSize -= common.StorageSize(common.HashLength + len(node.blob))
+
+		db.oldest = node.flushNext
+		if db.oldest != (common.Hash{}) {
+			db.nodes[db.oldest].flushPrev = common.Hash{}
+		}
+	}
+	if db.oldest == (common.Hash{}) {
+		db.newest = common.Hash{}
+	}
+	db.flushnodes += uint64(nodes - len(db.nodes))
+	db.flushsize += storage - db.nodesSize
+	db.flushtime += time.Since(start)
+
+	log.Debug("Persisted nodes from memory database", "nodes", nodes-len(db.nodes), "size", storage-db.nodesSize, "time", time.Since(start),
+		"flushnodes", db.flushnodes, "flushsize", db.flushsize, "flushtime", db.flushtime, "livenodes", len(db.nodes), "livesize", db.nodesSize)
+
+	return nil
+}
+
+// commit is the private locked version of Commit.
+func (db *NodeDatabase) commit(hash common.Hash, batch ethdb.Batch) error {
+	// If the node does not exist, it's a previously committed node
+	node, ok := db.nodes[hash]
+	if !ok {
+		return nil
+	}
+	for child := range node.children {
+		if err := db.commit(child, batch); err != nil {
+			return err
+		}
+	}
+	return batch.Put(hash[:], node.blob)
+}
+
+// uncache is the post-processing step of a commit operation where the already
+// persisted trie is removed from the cache. The reason behind the two-phase
+// commit is to ensure consistent data availability while moving from memory
+// to disk.
+func (db *NodeDatabase) uncache(hash common.Hash) {
+	// If the node does not exist, we're done on this path
+	node, ok := db.nodes[hash]
+	if !ok {
+		return
+	}
+	// Otherwise uncache the node's subtries and remove the node itself too
+	for child := range node.children {
+		db.uncache(child)
+	}
+	db.removeFromFlushList(hash, node)
+	delete(db.nodes, hash)
+	db.nodesSize -= common.StorageSize(common.HashLength + len(node.blob))
+}
+
+// Size returns the current storage size of the memory cache in front of the
+// persistent database layer.
+func (db *NodeDatabase) Size() common.StorageSize {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.nodesSize
+}
+
+// journalNode is a cached trie node as stored in the journal.
+type journalNode struct {
+	Hash common.Hash
+	Blob []byte
+}
+
+// journalRoot is a trie root reference from the metaroot as stored in the
+// journal.
+type journalRoot struct {
+	Hash  common.Hash
+	Count uint64
+}
+
+// nodeJournal is the content of the journal persisted on shutdown.
+type nodeJournal struct {
+	Nodes []journalNode // Cached nodes, children ordered before their parents
+	Roots []journalRoot // References from the metaroot
+}
+
+// Journal writes all the nodes kept alive by a root reference into the disk
+// database, so they can be restored by the next node database created on top
+// of it instead of being lost. It is meant to be called on shutdown, the cache
+// itself is left untouched. Unreferenced nodes are not journaled.
+func (db *NodeDatabase) Journal() error {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var (
+		journal nodeJournal
+		done    = make(map[common.Hash]struct{})
+	)
+	for root, count := range db.nodes[common.Hash{}].children {
+		journal.Roots = append(journal.Roots, journalRoot{Hash: root, Count: uint64(count)})
+		db.journalNodes(root, done, &journal)
+	}
+	blob, err := rlp.EncodeToBytes(&journal)
+	if err != nil {
+		return err
+	}
+	if err := db.diskdb.Put(trieJournalKey, blob); err != nil {
+		return err
+	}
+	log.Info("Journaled trie node cache", "nodes", len(journal.Nodes), "roots", len(journal.Roots), "size", common.StorageSize(len(blob)))
+	return nil
+}
+
+// journalNodes appends the cached subtrie of a node to the journal, children
+// first, so that references are restored correctly when reloaded.
+func (db *NodeDatabase) journalNodes(hash common.Hash, done map[common.Hash]struct{}, journal *nodeJournal) {
+	node, ok := db.nodes[hash]
+	if !ok {
+		return
+	}
+	if _, ok := done[hash]; ok {
+		return
+	}
+	done[hash] = struct{}{}
+
+	for child := range node.children {
+		db.journalNodes(child, done, journal)
+	}
+	journal.Nodes = append(journal.Nodes, journalNode{Hash: hash, Blob: node.blob})
+}
+
+// loadJournal restores the nodes and root references journaled by an earlier
+// node database, deleting the journal afterwards so it's not replayed twice.
+func (db *NodeDatabase) loadJournal() {
+	blob, err := db.diskdb.Get(trieJournalKey)
+	if err != nil || len(blob) == 0 {
+		return
+	}
+	var journal nodeJournal
+	if err := rlp.DecodeBytes(blob, &journal); err != nil {
+		log.Warn("Failed to decode trie node journal", "err", err)
+	} else {
+		for _, node := range journal.Nodes {
+			db.Put(node.Hash[:], node.Blob)
+		}
+		for _, root := range journal.Roots {
+			for i := uint64(0); i < root.Count; i++ {
+				db.Reference(root.Hash, common.Hash{})
+			}
+		}
+		log.Info("Loaded trie node journal", "nodes", len(journal.Nodes), "roots", len(journal.Roots))
+	}
+	if err := db.diskdb.Delete(trieJournalKey); err != nil {
+		log.Warn("Failed to delete trie node journal", "err", err)
+	}
+}
@@ -0,0 +1,307 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// makeNodeDatabaseTries creates two tries on top of a node database, with the
+// second one being a modified version of the first so they share nodes.
+func makeNodeDatabaseTries(t *testing.T) (*NodeDatabase, *ethdb.MemDatabase, common.Hash, common.Hash) {
+	diskdb, _ := ethdb.NewMemDatabase()
+	triedb := NewNodeDatabase(diskdb, nil)
+
+	trie, _ := New(common.Hash{}, triedb)
+	for i := byte(0); i < 255; i++ {
+		trie.Update(common.LeftPadBytes([]byte{i}, 32), []byte{i, i, i})
+	}
+	root1, err := trie.Commit()
+	if err != nil {
+		t.Fatalf("failed to commit first trie: %v", err)
+	}
+	triedb.Reference(root1, common.Hash{})
+
+	trie.Update(common.LeftPadBytes([]byte{1}, 32), []byte{0xff})
+	root2, err := trie.Commit()
+	if err != nil {
+		t.Fatalf("failed to commit second trie: %v", err)
+	}
+	triedb.Reference(root2, common.Hash{})
+
+	return triedb, diskdb, root1, root2
+}
+
+func checkNodeDatabaseTrie(t *testing.T, db Database, root common.Hash, modified bool) {
+	trie, err := New(root, db)
+	if err != nil {
+		t.Fatalf("failed to open trie %x: %v", root, err)
+	}
+	for i := byte(0); i < 255; i++ {
+		want := []byte{i, i, i}
+		if modified && i == 1 {
+			want = []byte{0xff}
+		}
+		val, err := trie.TryGet(common.LeftPadBytes([]byte{i}, 32))
+		if err != nil {
+			t.Fatalf("failed to retrieve key %x from trie %x: %v", i, root, err)
+		}
+		if !bytes.Equal(val, want) {
+			t.Fatalf("value mismatch for key %x in trie %x: have %x, want %x", i, root, val, want)
+		}
+	}
+}
+
+// Tests that dereferencing a trie only garbage collects nodes that are not
+// shared with other live tries.
+func TestNodeDatabaseDereference(t *testing.T) {
+	triedb, diskdb, root1, root2 := makeNodeDatabaseTries(t)
+	if len(diskdb.Keys()) != 0 {
+		t.Fatalf("disk database written before commit: %d entries", len(diskdb.Keys()))
+	}
+	size := triedb.Size()
+
+	triedb.Dereference(root1)
+	if triedb.Size() >= size {
+		t.Fatalf("no nodes collected: size before %v, after %v", size, triedb.Size())
+	}
+	if _, err := triedb.Get(root1[:]); err == nil {
+		t.Fatalf("dereferenced root still available")
+	}
+	checkNodeDatabaseTrie(t, triedb, root2, true)
+
+	triedb.Dereference(root2)
+	if nodes := triedb.Nodes(); len(nodes) != 0 {
+		t.Fatalf("nodes leaked after dereferencing all tries: %d", len(nodes))
+	}
+	if triedb.Size() != 0 {
+		t.Fatalf("size leaked after dereferencing all tries: %v", triedb.Size())
+	}
+}
+
+// Tests that committing a trie flushes it to disk and removes it from memory,
+// while leaving unrelated live nodes in the cache.
+func TestNodeDatabaseCommit(t *testing.T) {
+	triedb, diskdb, root1, root2 := makeNodeDatabaseTries(t)
+
+	if err := triedb.Commit(root2); err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	checkNodeDatabaseTrie(t, diskdb, root2, true)
+
+	// Nodes unique to the first trie must still be in memory only
+	if len(triedb.Nodes()) == 0 {
+		t.Fatalf("unrelated nodes flushed from memory")
+	}
+	checkNodeDatabaseTrie(t, triedb, root1, false)
+
+	triedb.Dereference(root1)
+	triedb.Dereference(root2)
+	if nodes := triedb.Nodes(); len(nodes) != 0 {
+		t.Fatalf("nodes leaked after dereferencing all tries: %d", len(nodes))
+	}
+	checkNodeDatabaseTrie(t, diskdb, root2, true)
+}
+
+// Tests that tries referenced from the leaves of another trie are kept alive
+// and committed along with it, if the node database can resolve them.
+func TestNodeDatabaseLeafReferences(t *testing.T) {
+	diskdb, _ := ethdb.NewMemDatabase()
+	triedb := NewNodeDatabase(diskdb, func(leaf []byte) []common.Hash {
+		if len(leaf) != common.HashLength {
+			return nil
+		}
+		return []common.Hash{common.BytesToHash(leaf)}
+	})
+	// Create a few subtries and a main trie with leaves pointing to them
+	main, _ := New(common.Hash{}, triedb)
+	for i := byte(0); i < 4; i++ {
+		sub, _ := New(common.Hash{}, triedb)
+		for j := byte(0); j < 16; j++ {
+			sub.Update(common.LeftPadBytes([]byte{i, j}, 32), []byte{i, j, i, j})
+		}
+		subroot, err := sub.Commit()
+		if err != nil {
+			t.Fatalf("failed to commit subtrie %d: %v", i, err)
+		}
+		main.Update(common.LeftPadBytes([]byte{i}, 32), subroot[:])
+	}
+	root, err := main.Commit()
+	if err != nil {
+		t.Fatalf("failed to commit main trie: %v", err)
+	}
+	triedb.Reference(root, common.Hash{})
+
+	// Committing the main trie must flush the subtries too
+	if err := triedb.Commit(root); err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	if nodes := triedb.Nodes(); len(nodes) != 0 {
+		t.Fatalf("nodes left in memory after commit: %d", len(nodes))
+	}
+	main, err = New(root, diskdb)
+	if err != nil {
+		t.Fatalf("failed to open committed trie: %v", err)
+	}
+	for i := byte(0); i < 4; i++ {
+		subroot := main.Get(common.LeftPadBytes([]byte{i}, 32))
+		sub, err := New(common.BytesToHash(subroot), diskdb)
+		if err != nil {
+			t.Fatalf("failed to open committed subtrie %d: %v", i, err)
+		}
+		if val := sub.Get(common.LeftPadBytes([]byte{i, 15}, 32)); !bytes.Equal(val, []byte{i, 15, i, 15}) {
+			t.Fatalf("subtrie %d value mismatch: have %x", i, val)
+		}
+	}
+}
+
+// Tests that the live nodes of a node database are restored from its journal
+// by a new database, along with the root references keeping them alive.
+func TestNodeDatabaseJournal(t *testing.T) {
+	triedb, diskdb, root1, root2 := makeNodeDatabaseTries(t)
+	triedb.Reference(root2, common.Hash{})
+
+	if err := triedb.Journal(); err != nil {
+		t.Fatalf("failed to journal node database: %v", err)
+	}
+	restored := NewNodeDatabase(diskdb, nil)
+	if have, want := restored.Size(), triedb.Size(); have != want {
+		t.Fatalf("restored size mismatch: have %v, want %v", have, want)
+	}
+	checkNodeDatabaseTrie(t, restored, root1, false)
+	checkNodeDatabaseTrie(t, restored, root2, true)
+
+	// The journal must be consumed, and the references restored intact
+	if _, err := diskdb.Get(trieJournalKey); err == nil {
+		t.Fatalf("journal not deleted after loading")
+	}
+	if again := NewNodeDatabase(diskdb, nil); len(again.Nodes()) != 0 {
+		t.Fatalf("journal replayed twice: %d nodes", len(again.Nodes()))
+	}
+	restored.Dereference(root1)
+	restored.Dereference(root2)
+	checkNodeDatabaseTrie(t, restored, root2, true)
+
+	restored.Dereference(root2)
+	if nodes := restored.Nodes(); len(nodes) != 0 {
+		t.Fatalf("nodes leaked after dereferencing all tries: %d", len(nodes))
+	}
+	if restored.Size() != 0 {
+		t.Fatalf("size leaked after dereferencing all tries: %v", restored.Size())
+	}
+}
+
+// checkFlushList verifies that the flush-list links all the cached nodes.
+func checkFlushList(t *testing.T, db *NodeDatabase) {
+	count := 0
+	for hash, prev := db.oldest, (common.Hash{}); hash != (common.Hash{}); hash = db.nodes[hash].flushNext {
+		if db.nodes[hash].flushPrev != prev {
+			t.Fatalf("flush-list broken at %x: have prev %x, want %x", hash, db.nodes[hash].flushPrev, prev)
+		}
+		if db.nodes[hash].flushNext == (common.Hash{}) && hash != db.newest {
+			t.Fatalf("flush-list tail mismatch: have %x, want %x", hash, db.newest)
+		}
+		prev = hash
+		count++
+	}
+	if count != len(db.Nodes()) {
+		t.Fatalf("flush-list length mismatch: have %d, want %d", count, len(db.Nodes()))
+	}
+}
+
+// checkDiskChildren verifies that all the children of the trie nodes flushed to
+// disk were flushed too.
+func checkDiskChildren(t *testing.T, diskdb *ethdb.MemDatabase) {
+	for _, key := range diskdb.Keys() {
+		blob, _ := diskdb.Get(key)
+		for _, child := range nodeChildren(common.BytesToHash(key), blob, nil) {
+			if _, err := diskdb.Get(child[:]); err != nil {
+				t.Fatalf("node %x flushed without child %x", key, child)
+			}
+		}
+	}
+}
+
+// Tests that capping the node database flushes the oldest nodes to disk, with
+// children always before their parents, keeping the tries accessible.
+func TestNodeDatabaseCap(t *testing.T) {
+	triedb, diskdb, root1, root2 := makeNodeDatabaseTries(t)
+	checkFlushList(t, triedb)
+
+	limit := triedb.Size() / 2
+	if err := triedb.Cap(limit); err != nil {
+		t.Fatalf("failed to cap node database: %v", err)
+	}
+	if triedb.Size() > limit {
+		t.Fatalf("cache not capped: have %v, limit %v", triedb.Size(), limit)
+	}
+	if len(diskdb.Keys()) == 0 {
+		t.Fatalf("no nodes flushed to disk")
+	}
+	checkFlushList(t, triedb)
+	checkDiskChildren(t, diskdb)
+	checkNodeDatabaseTrie(t, triedb, root1, false)
+	checkNodeDatabaseTrie(t, triedb, root2, true)
+
+	// Garbage collecting and committing must work with partially flushed tries
+	triedb.Dereference(root1)
+	checkFlushList(t, triedb)
+	if err := triedb.Commit(root2); err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	checkFlushList(t, triedb)
+	checkNodeDatabaseTrie(t, diskdb, root2, true)
+
+	triedb.Dereference(root2)
+	if nodes := triedb.Nodes(); len(nodes) != 0 {
+		t.Fatalf("nodes leaked after dereferencing all tries: %d", len(nodes))
+	}
+	if triedb.Size() != 0 {
+		t.Fatalf("size leaked after dereferencing all tries: %v", triedb.Size())
+	}
+}
+
+// Tests that a node database with a memory limit flushes nodes automatically
+// when tries are committed into it.
+func TestNodeDatabaseLimit(t *testing.T) {
+	diskdb, _ := ethdb.NewMemDatabase()
+	triedb := NewNodeDatabase(diskdb, nil)
+
+	limit := common.StorageSize(4096)
+	triedb.SetLimit(limit)
+
+	trie, _ := New(common.Hash{}, triedb)
+	for i := byte(0); i < 255; i++ {
+		trie.Update(common.LeftPadBytes([]byte{i}, 32), []byte{i, i, i})
+	}
+	root, err := trie.Commit()
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	triedb.Reference(root, common.Hash{})
+
+	if triedb.Size() > limit {
+		t.Fatalf("memory limit exceeded: have %v, limit %v", triedb.Size(), limit)
+	}
+	checkFlushList(t, triedb)
+	checkDiskChildren(t, diskdb)
+	checkNodeDatabaseTrie(t, triedb, root, false)
+}
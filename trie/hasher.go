@@ -17,8 +17,8 @@
 package trie
 
 import (
-	"bytes"
 	"hash"
+	"runtime"
 	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -26,27 +26,68 @@ import (
 	"github.com/ethereum/go-ethereum/rlp"
 )
 
+// parallelHashThreshold is the number of trie updates since the last commit
+// above which hashing is spread across multiple threads. Below it, the cost of
+// the goroutines outweighs the gains.
+const parallelHashThreshold = 100
+
+// NodeHasher is the hash function deriving the references of trie nodes from
+// their encodings, as well as the hashed keys of secure tries. The digests it
+// produces must be 32 bytes long.
+type NodeHasher interface {
+	// NewHash creates a new hash state of the node hash function.
+	NewHash() hash.Hash
+}
+
+// Keccak256Hasher is the default node hasher, as used by Ethereum.
+var Keccak256Hasher NodeHasher = keccakHasher{}
+
+type keccakHasher struct{}
+
+func (keccakHasher) NewHash() hash.Hash { return sha3.NewKeccak256() }
+
 type hasher struct {
-	tmp                  *bytes.Buffer
+	tmp                  []byte            // Scratch space holding the last node encoding
+	encbuf               rlp.EncoderBuffer // Streaming encoder of the nodes
 	sha                  hash.Hash
+	nodeHasher           NodeHasher // Custom node hash function, nil for the pooled Keccak256
 	cachegen, cachelimit uint16
+	parallel             bool // Whether to hash the children of the next full node concurrently
 }
 
 // hashers live in a global pool.
 var hasherPool = sync.Pool{
 	New: func() interface{} {
-		return &hasher{tmp: new(bytes.Buffer), sha: sha3.NewKeccak256()}
+		return &hasher{encbuf: rlp.NewEncoderBuffer(nil), sha: sha3.NewKeccak256()}
 	},
 }
 
 func newHasher(cachegen, cachelimit uint16) *hasher {
 	h := hasherPool.Get().(*hasher)
 	h.cachegen, h.cachelimit = cachegen, cachelimit
+	h.parallel = false
 	return h
 }
 
+// newTrieHasher creates a hasher using the given node hash function. Hashers of
+// the default Keccak256 function are retrieved from the global pool.
+func newTrieHasher(nodeHasher NodeHasher, cachegen, cachelimit uint16) *hasher {
+	if nodeHasher == nil || nodeHasher == Keccak256Hasher {
+		return newHasher(cachegen, cachelimit)
+	}
+	return &hasher{
+		encbuf:     rlp.NewEncoderBuffer(nil),
+		sha:        nodeHasher.NewHash(),
+		nodeHasher: nodeHasher,
+		cachegen:   cachegen,
+		cachelimit: cachelimit,
+	}
+}
+
 func returnHasherToPool(h *hasher) {
-	hasherPool.Put(h)
+	if h.nodeHasher == nil {
+		hasherPool.Put(h)
+	}
 }
 
 // hash collapses a node down into a hash node, also returning a copy of the
@@ -123,14 +164,20 @@ func (h *hasher) hashChildren(original node, db DatabaseWriter) (node, node, err
 		// Hash the full node's children, caching the newly hashed subtrees
 		collapsed, cached := n.copy(), n.copy()
 
-		for i := 0; i < 16; i++ {
-			if n.Children[i] != nil {
-				collapsed.Children[i], cached.Children[i], err = h.hash(n.Children[i], db, false)
-				if err != nil {
-					return original, original, err
+		if h.parallel {
+			if err := h.hashChildrenParallel(n, collapsed, cached, db); err != nil {
+				return original, original, err
+			}
+		} else {
+			for i := 0; i < 16; i++ {
+				if n.Children[i] != nil {
+					collapsed.Children[i], cached.Children[i], err = h.hash(n.Children[i], db, false)
+					if err != nil {
+						return original, original, err
+					}
+				} else {
+					collapsed.Children[i] = valueNode(nil) // Ensure that nil children are encoded as empty strings.
 				}
-			} else {
-				collapsed.Children[i] = valueNode(nil) // Ensure that nil children are encoded as empty strings.
 			}
 		}
 		cached.Children[16] = n.Children[16]
@@ -145,29 +192,112 @@ func (h *hasher) hashChildren(original node, db DatabaseWriter) (node, node, err
 	}
 }
 
+// hashChildrenParallel hashes the children of a full node concurrently, each on
+// its own hasher, with the number of active threads bounded by GOMAXPROCS. The
+// nodes stored by the threads are buffered and flushed into the database in
+// the same order as sequential hashing would, keeping the results deterministic.
+func (h *hasher) hashChildrenParallel(n, collapsed, cached *fullNode, db DatabaseWriter) error {
+	var (
+		buffers [16]*writeBuffer
+		errs    [16]error
+		limit   = make(chan struct{}, runtime.GOMAXPROCS(0))
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < 16; i++ {
+		if n.Children[i] == nil {
+			collapsed.Children[i] = valueNode(nil) // Ensure that nil children are encoded as empty strings.
+			continue
+		}
+		var writer DatabaseWriter
+		if db != nil {
+			buffers[i] = new(writeBuffer)
+			writer = buffers[i]
+		}
+		wg.Add(1)
+		limit <- struct{}{}
+		go func(i int, writer DatabaseWriter) {
+			defer func() { <-limit; wg.Done() }()
+
+			hasher := newTrieHasher(h.nodeHasher, h.cachegen, h.cachelimit)
+			defer returnHasherToPool(hasher)
+
+			collapsed.Children[i], cached.Children[i], errs[i] = hasher.hash(n.Children[i], writer, false)
+		}(i, writer)
+	}
+	wg.Wait()
+
+	for i := 0; i < 16; i++ {
+		if buffers[i] != nil {
+			if err := buffers[i].flush(db); err != nil {
+				return err
+			}
+		}
+		if errs[i] != nil {
+			return errs[i]
+		}
+	}
+	return nil
+}
+
+// writeBuffer is a DatabaseWriter accumulating the trie nodes stored by a
+// parallel hashing thread, to be flushed into the real database afterwards.
+type writeBuffer struct {
+	keys   [][]byte
+	values [][]byte
+}
+
+// Put appends a copy of the node to the buffer.
+func (b *writeBuffer) Put(key []byte, value []byte) error {
+	b.keys = append(b.keys, common.CopyBytes(key))
+	b.values = append(b.values, common.CopyBytes(value))
+	return nil
+}
+
+// flush writes all buffered nodes into db in insertion order.
+func (b *writeBuffer) flush(db DatabaseWriter) error {
+	for i, key := range b.keys {
+		if err := db.Put(key, b.values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (h *hasher) store(n node, db DatabaseWriter, force bool) (node, error) {
 	// Don't store hashes or empty nodes.
 	if _, isHash := n.(hashNode); n == nil || isHash {
 		return n, nil
 	}
 	// Generate the RLP encoding of the node
-	h.tmp.Reset()
-	if err := rlp.Encode(h.tmp, n); err != nil {
-		panic("encode error: " + err.Error())
-	}
-
-	if h.tmp.Len() < 32 && !force {
+	enc := h.encode(n)
+	if len(enc) < 32 && !force {
 		return n, nil // Nodes smaller than 32 bytes are stored inside their parent
 	}
 	// Larger nodes are replaced by their hash and stored in the database.
 	hash, _ := n.cache()
 	if hash == nil {
 		h.sha.Reset()
-		h.sha.Write(h.tmp.Bytes())
+		h.sha.Write(enc)
 		hash = hashNode(h.sha.Sum(nil))
 	}
 	if db != nil {
-		return hash, db.Put(hash, h.tmp.Bytes())
+		return hash, db.Put(hash, enc)
 	}
 	return hash, nil
 }
+
+// encode streams the RLP encoding of a node into the hasher's scratch space. The
+// returned slice is only valid until the next encoding.
+func (h *hasher) encode(n node) []byte {
+	n.encode(h.encbuf)
+	return h.encodedBytes()
+}
+
+// encodedBytes returns the encoding streamed into the hasher's encoder buffer
+// and resets the buffer. The returned slice is only valid until the next
+// encoding.
+func (h *hasher) encodedBytes() []byte {
+	h.tmp = h.encbuf.AppendToBytes(h.tmp[:0])
+	h.encbuf.Reset(nil)
+	return h.tmp
+}
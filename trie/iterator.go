@@ -62,6 +62,10 @@ type NodeIterator interface {
 	Next(bool) bool
 	// Error returns the error status of the iterator.
 	Error() error
+	// Seek repositions the iterator just before the first node positioned at or
+	// after the given key prefix, so that Next moves onto it. Seek may be called
+	// at any time, also after the iteration has finished.
+	Seek(prefix []byte) error
 
 	// Hash returns the hash of the current node.
 	Hash() common.Hash
@@ -171,6 +175,15 @@ func (it *nodeIterator) Error() error {
 	return it.err
 }
 
+func (it *nodeIterator) Seek(prefix []byte) error {
+	if it.trie == nil {
+		return nil // Iterating an empty trie, nothing to position on
+	}
+	it.stack, it.path = it.stack[:0], it.path[:0]
+	it.err = it.seek(prefix)
+	return it.Error()
+}
+
 // Next moves the iterator to the next node, returning whether there are any
 // further nodes. In case of an internal error this method returns false and
 // sets the Error field to the encountered failure. If `descend` is false,
@@ -218,7 +231,7 @@ func (it *nodeIterator) peek(descend bool) (*nodeIteratorState, *int, []byte, er
 		// Initialize the iterator if we've just started.
 		root := it.trie.Hash()
 		state := &nodeIteratorState{node: it.trie.root, index: -1}
-		if root != emptyRoot {
+		if root != it.trie.emptyRoot() {
 			state.hash = root
 		}
 		err := state.resolve(it.trie, nil)
@@ -349,6 +362,62 @@ func NewDifferenceIterator(a, b NodeIterator) (NodeIterator, *int) {
 	return it, &it.count
 }
 
+// Diff returns the sorted list of keys whose values differ between the tries
+// with roots a and b stored in db: keys that were added, updated or deleted.
+// For secure tries the returned keys are the hashes of the original keys.
+func Diff(db Database, a, b common.Hash) ([][]byte, error) {
+	triea, err := New(a, db)
+	if err != nil {
+		return nil, err
+	}
+	trieb, err := New(b, db)
+	if err != nil {
+		return nil, err
+	}
+	// Collect the leaves unique to each trie, both are sorted by key
+	added, err := diffLeaves(triea, trieb)
+	if err != nil {
+		return nil, err
+	}
+	removed, err := diffLeaves(trieb, triea)
+	if err != nil {
+		return nil, err
+	}
+	// Merge the two lists, updated keys being present in both
+	keys := make([][]byte, 0, len(added)+len(removed))
+	for len(added) > 0 || len(removed) > 0 {
+		switch {
+		case len(removed) == 0:
+			keys, added = append(keys, added...), nil
+		case len(added) == 0:
+			keys, removed = append(keys, removed...), nil
+		default:
+			switch cmp := bytes.Compare(added[0], removed[0]); {
+			case cmp < 0:
+				keys, added = append(keys, added[0]), added[1:]
+			case cmp > 0:
+				keys, removed = append(keys, removed[0]), removed[1:]
+			default:
+				keys, added, removed = append(keys, added[0]), added[1:], removed[1:]
+			}
+		}
+	}
+	return keys, nil
+}
+
+// diffLeaves returns the keys of all the leaves in trie b that are not present
+// with the same value in trie a.
+func diffLeaves(a, b *Trie) ([][]byte, error) {
+	var keys [][]byte
+
+	nodeIt, _ := NewDifferenceIterator(a.NodeIterator(nil), b.NodeIterator(nil))
+	it := NewIterator(nodeIt)
+	for it.Next() {
+		keys = append(keys, it.Key)
+	}
+	return keys, it.Err
+}
+
 func (it *differenceIterator) Hash() common.Hash {
 	return it.b.Hash()
 }
@@ -373,6 +442,17 @@ func (it *differenceIterator) Path() []byte {
 	return it.b.Path()
 }
 
+func (it *differenceIterator) Seek(prefix []byte) error {
+	if err := it.a.Seek(prefix); err != nil {
+		return err
+	}
+	if err := it.b.Seek(prefix); err != nil {
+		return err
+	}
+	it.eof = !it.a.Next(true)
+	return it.a.Error()
+}
+
 func (it *differenceIterator) Next(bool) bool {
 	// Invariants:
 	// - We always advance at least one element in b.
@@ -436,6 +516,7 @@ func (h *nodeIteratorHeap) Pop() interface{} {
 }
 
 type unionIterator struct {
+	iters []NodeIterator    // All the iterators being merged, needed for seeking
 	items *nodeIteratorHeap // Nodes returned are the union of the ones in these iterators
 	count int               // Number of nodes scanned across all tries
 }
@@ -448,7 +529,7 @@ func NewUnionIterator(iters []NodeIterator) (NodeIterator, *int) {
 	copy(h, iters)
 	heap.Init(&h)
 
-	ui := &unionIterator{items: &h}
+	ui := &unionIterator{iters: iters, items: &h}
 	return ui, &ui.count
 }
 
@@ -476,6 +557,20 @@ func (it *unionIterator) Path() []byte {
 	return (*it.items)[0].Path()
 }
 
+func (it *unionIterator) Seek(prefix []byte) error {
+	for _, iter := range it.iters {
+		if err := iter.Seek(prefix); err != nil {
+			return err
+		}
+	}
+	h := make(nodeIteratorHeap, len(it.iters))
+	copy(h, it.iters)
+	heap.Init(&h)
+
+	it.items = &h
+	return nil
+}
+
 // Next returns the next node in the union of tries being iterated over.
 //
 // It does this by maintaining a heap of iterators, sorted by the iteration
@@ -526,3 +621,37 @@ func (it *unionIterator) Error() error {
 	}
 	return nil
 }
+
+type boundaryIterator struct {
+	NodeIterator        // Wrapped iterator producing the nodes
+	end          []byte // Hex encoded path at which to stop (without terminator)
+	done         bool   // Whether the iterator moved past the boundary
+}
+
+// NewBoundaryIterator wraps a NodeIterator, stopping the iteration at the first
+// node positioned at or after the given end key. Together with a start key set
+// at construction it restricts iteration to a contiguous key range, allowing a
+// trie (or the union of several) to be traversed in independent chunks.
+func NewBoundaryIterator(it NodeIterator, end []byte) NodeIterator {
+	key := keybytesToHex(end)
+	return &boundaryIterator{
+		NodeIterator: it,
+		end:          key[:len(key)-1],
+	}
+}
+
+func (it *boundaryIterator) Next(descend bool) bool {
+	if it.done || !it.NodeIterator.Next(descend) {
+		return false
+	}
+	if bytes.Compare(it.NodeIterator.Path(), it.end) >= 0 {
+		it.done = true
+		return false
+	}
+	return true
+}
+
+func (it *boundaryIterator) Seek(prefix []byte) error {
+	it.done = false
+	return it.NodeIterator.Seek(prefix)
+}
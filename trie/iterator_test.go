@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"fmt"
 	"math/rand"
+	"reflect"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -170,6 +171,44 @@ func TestIteratorSeek(t *testing.T) {
 	}
 }
 
+// Tests that existing iterators can be repositioned, also after they've been
+// fully exhausted.
+func TestIteratorReseek(t *testing.T) {
+	triea, trieb := newEmpty(), newEmpty()
+	for i, val := range testdata1 {
+		if i%2 == 0 {
+			triea.Update([]byte(val.k), []byte(val.v))
+		} else {
+			trieb.Update([]byte(val.k), []byte(val.v))
+		}
+	}
+	full := newEmpty()
+	for _, val := range testdata1 {
+		full.Update([]byte(val.k), []byte(val.v))
+	}
+	union, _ := NewUnionIterator([]NodeIterator{triea.NodeIterator(nil), trieb.NodeIterator(nil)})
+	diff, _ := NewDifferenceIterator(newEmpty().NodeIterator(nil), full.NodeIterator(nil))
+
+	for name, nodeIt := range map[string]NodeIterator{"plain": full.NodeIterator(nil), "union": union, "difference": diff} {
+		// Exhaust the iterator, then seek to the middle and to a non-existent key
+		if err := checkIteratorOrder(testdata1, NewIterator(nodeIt)); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := nodeIt.Seek([]byte("fab")); err != nil {
+			t.Fatalf("%s: failed to seek: %v", name, err)
+		}
+		if err := checkIteratorOrder(testdata1[4:], NewIterator(nodeIt)); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := nodeIt.Seek([]byte("barc")); err != nil {
+			t.Fatalf("%s: failed to seek: %v", name, err)
+		}
+		if err := checkIteratorOrder(testdata1[1:], NewIterator(nodeIt)); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+}
+
 func checkIteratorOrder(want []kvs, it *Iterator) error {
 	for it.Next() {
 		if len(want) == 0 {
@@ -222,6 +261,41 @@ func TestDifferenceIterator(t *testing.T) {
 	}
 }
 
+func TestDiff(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+
+	triea, _ := New(common.Hash{}, db)
+	for _, val := range testdata1 {
+		triea.Update([]byte(val.k), []byte(val.v))
+	}
+	roota, _ := triea.Commit()
+
+	trieb, _ := New(roota, db)
+	trieb.Update([]byte("bars"), []byte("changed")) // updated
+	trieb.Delete([]byte("foo"))                     // deleted
+	trieb.Update([]byte("aardvark"), []byte("c"))   // added
+	rootb, _ := trieb.Commit()
+
+	want := []string{"aardvark", "bars", "foo"}
+	for _, roots := range [][2]common.Hash{{roota, rootb}, {rootb, roota}} {
+		keys, err := Diff(db, roots[0], roots[1])
+		if err != nil {
+			t.Fatalf("diff failed: %v", err)
+		}
+		if len(keys) != len(want) {
+			t.Fatalf("changed key count mismatch: have %d, want %d", len(keys), len(want))
+		}
+		for i, key := range keys {
+			if string(key) != want[i] {
+				t.Errorf("changed key %d mismatch: have %q, want %q", i, key, want[i])
+			}
+		}
+	}
+	if keys, _ := Diff(db, roota, roota); len(keys) != 0 {
+		t.Errorf("identical tries reported changes: %q", keys)
+	}
+}
+
 func TestUnionIterator(t *testing.T) {
 	triea := newEmpty()
 	for _, val := range testdata1 {
@@ -269,6 +343,45 @@ func TestUnionIterator(t *testing.T) {
 	}
 }
 
+func TestBoundaryIterator(t *testing.T) {
+	trie := newEmpty()
+	for _, val := range testdata1 {
+		trie.Update([]byte(val.k), []byte(val.v))
+	}
+	// Iterate a range in the middle, then one extending past the last key
+	it := NewIterator(NewBoundaryIterator(trie.NodeIterator([]byte("bard")), []byte("food")))
+	if err := checkIteratorOrder(testdata1[1:5], it); err != nil {
+		t.Fatal(err)
+	}
+	it = NewIterator(NewBoundaryIterator(trie.NodeIterator([]byte("fab")), []byte("z")))
+	if err := checkIteratorOrder(testdata1[4:], it); err != nil {
+		t.Fatal(err)
+	}
+	// Ensure that chunked iteration over a union visits every key exactly once
+	triea, trieb := newEmpty(), newEmpty()
+	for i, val := range testdata1 {
+		if i%2 == 0 {
+			triea.Update([]byte(val.k), []byte(val.v))
+		} else {
+			trieb.Update([]byte(val.k), []byte(val.v))
+		}
+	}
+	var (
+		bounds = []string{"", "bars", "fab", "z"}
+		found  []kvs
+	)
+	for i := 0; i < len(bounds)-1; i++ {
+		start, end := []byte(bounds[i]), []byte(bounds[i+1])
+		union, _ := NewUnionIterator([]NodeIterator{triea.NodeIterator(start), trieb.NodeIterator(start)})
+		for it := NewIterator(NewBoundaryIterator(union, end)); it.Next(); {
+			found = append(found, kvs{string(it.Key), string(it.Value)})
+		}
+	}
+	if !reflect.DeepEqual(found, testdata1) {
+		t.Errorf("chunked union iteration mismatch:\nhave %v\nwant %v", found, testdata1)
+	}
+}
+
 func TestIteratorNoDups(t *testing.T) {
 	var tr Trie
 	for _, val := range testdata1 {
@@ -16,7 +16,14 @@
 
 package trie
 
-import "testing"
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+)
 
 func TestCanUnload(t *testing.T) {
 	tests := []struct {
@@ -56,3 +63,94 @@ func TestCanUnload(t *testing.T) {
 		}
 	}
 }
+
+// Tests that the streaming node encoders produce the same output as the
+// reflection based RLP encoder of collapsed nodes.
+func TestNodeEncoding(t *testing.T) {
+	short := &shortNode{Key: []byte{0x20, 0x01}, Val: valueNode("value")}
+	long := &shortNode{Key: bytes.Repeat([]byte{0x11}, 40), Val: valueNode(bytes.Repeat([]byte{0xaa}, 60))}
+	hash := hashNode(bytes.Repeat([]byte{0xff}, 32))
+
+	full := &fullNode{}
+	full.Children[0] = short
+	full.Children[3] = hash
+	full.Children[7] = valueNode(nil)
+	full.Children[16] = valueNode("x")
+
+	// Missing children are encoded as empty strings
+	children := full.Children
+	for i, child := range children {
+		if child == nil {
+			children[i] = valueNode(nil)
+		}
+	}
+
+	tests := []struct {
+		n    node
+		want interface{} // Value to encode with reflection
+	}{
+		{valueNode(nil), []byte(nil)},
+		{valueNode{0x01}, []byte{0x01}},
+		{hash, []byte(hash)},
+		{short, short},
+		{long, long},
+		{&shortNode{Key: []byte{0x00}, Val: hash}, &shortNode{Key: []byte{0x00}, Val: hash}},
+		{full, children},
+	}
+	for i, test := range tests {
+		want, err := rlp.EncodeToBytes(test.want)
+		if err != nil {
+			t.Fatalf("test %d: reflection encoding failed: %v", i, err)
+		}
+		h := newHasher(0, 0)
+		if got := h.encode(test.n); !bytes.Equal(got, want) {
+			t.Errorf("test %d: encoding mismatch:\ngot  %x\nwant %x", i, got, want)
+		}
+		returnHasherToPool(h)
+	}
+}
+
+// compactKeys converts the keys of a decoded node and its embedded children back
+// into the compact encoding used in the database.
+func compactKeys(n node) node {
+	switch n := n.(type) {
+	case *shortNode:
+		return &shortNode{Key: hexToCompact(n.Key), Val: compactKeys(n.Val)}
+	case *fullNode:
+		cpy := n.copy()
+		for i, child := range cpy.Children {
+			if child != nil {
+				cpy.Children[i] = compactKeys(child)
+			}
+		}
+		return cpy
+	default:
+		return n
+	}
+}
+
+// Tests that all nodes stored by a commit re-encode to their stored blobs after
+// decoding.
+func TestNodeEncodingRoundtrip(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	trie, _ := New(common.Hash{}, db)
+	for i := 0; i < 500; i++ {
+		trie.Update(randBytes(32), randBytes(1+i%64))
+	}
+	if _, err := trie.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	h := newHasher(0, 0)
+	defer returnHasherToPool(h)
+
+	for _, key := range db.Keys() {
+		blob, _ := db.Get(key)
+		n, err := decodeNode(key, blob, 0)
+		if err != nil {
+			t.Fatalf("node %x: decoding failed: %v", key, err)
+		}
+		if enc := h.encode(compactKeys(n)); !bytes.Equal(enc, blob) {
+			t.Errorf("node %x: re-encoding mismatch:\ngot  %x\nwant %x", key, enc, blob)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// SafeTrie wraps a trie with a read-write lock, making it safe for concurrent
+// use. Any number of readers may access the trie while it is being modified.
+//
+// Trie nodes are never modified in place: lookups that load nodes from the
+// database build new copies along the resolved path, and updates copy every
+// node they change. Lookups can thus run in parallel under the read lock, and
+// the resolved nodes are cached back into the trie only if no writer replaced
+// the root in the meantime.
+type SafeTrie struct {
+	trie    Trie
+	version uint64 // Incremented on every root change, guards reader write-backs
+	lock    sync.RWMutex
+}
+
+// NewSafe creates a concurrency safe trie with an existing root node from db.
+// See New for the semantics of root and db.
+func NewSafe(root common.Hash, db Database) (*SafeTrie, error) {
+	trie, err := New(root, db)
+	if err != nil {
+		return nil, err
+	}
+	return &SafeTrie{trie: *trie}, nil
+}
+
+// SetCacheLimit sets the number of 'cache generations' to keep.
+// A cache generation is created by a call to Commit.
+func (t *SafeTrie) SetCacheLimit(l uint16) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.trie.SetCacheLimit(l)
+}
+
+// Get returns the value for key stored in the trie.
+// The value bytes must not be modified by the caller.
+func (t *SafeTrie) Get(key []byte) []byte {
+	res, err := t.TryGet(key)
+	if err != nil {
+		log.Error(fmt.Sprintf("Unhandled trie error: %v", err))
+	}
+	return res
+}
+
+// TryGet returns the value for key stored in the trie.
+// The value bytes must not be modified by the caller.
+// If a node was not found in the database, a MissingNodeError is returned.
+func (t *SafeTrie) TryGet(key []byte) ([]byte, error) {
+	t.lock.RLock()
+	value, newroot, didResolve, err := t.trie.tryGet(t.trie.root, keybytesToHex(key), 0)
+	version := t.version
+	t.lock.RUnlock()
+
+	if err == nil && didResolve {
+		t.lock.Lock()
+		if t.version == version {
+			t.trie.root = newroot
+		}
+		t.lock.Unlock()
+	}
+	return value, err
+}
+
+// Update associates key with value in the trie. Subsequent calls to
+// Get will return value. If value has length zero, any existing value
+// is deleted from the trie and calls to Get will return nil.
+//
+// The value bytes must not be modified by the caller while they are
+// stored in the trie.
+func (t *SafeTrie) Update(key, value []byte) {
+	if err := t.TryUpdate(key, value); err != nil {
+		log.Error(fmt.Sprintf("Unhandled trie error: %v", err))
+	}
+}
+
+// TryUpdate associates key with value in the trie. Subsequent calls to
+// Get will return value. If value has length zero, any existing value
+// is deleted from the trie and calls to Get will return nil.
+//
+// The value bytes must not be modified by the caller while they are
+// stored in the trie.
+//
+// If a node was not found in the database, a MissingNodeError is returned.
+func (t *SafeTrie) TryUpdate(key, value []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.version++
+	return t.trie.TryUpdate(key, value)
+}
+
+// Delete removes any existing value for key from the trie.
+func (t *SafeTrie) Delete(key []byte) {
+	if err := t.TryDelete(key); err != nil {
+		log.Error(fmt.Sprintf("Unhandled trie error: %v", err))
+	}
+}
+
+// TryDelete removes any existing value for key from the trie.
+// If a node was not found in the database, a MissingNodeError is returned.
+func (t *SafeTrie) TryDelete(key []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.version++
+	return t.trie.TryDelete(key)
+}
+
+// Hash returns the root hash of the trie. It does not write to the
+// database and can be used even if the trie doesn't have one.
+func (t *SafeTrie) Hash() common.Hash {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.version++
+	return t.trie.Hash()
+}
+
+// Commit writes all nodes to the trie's database.
+// Nodes are stored with their sha3 hash as the key.
+//
+// Committing flushes nodes from memory.
+// Subsequent Get calls will load nodes from the database.
+func (t *SafeTrie) Commit() (root common.Hash, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.version++
+	return t.trie.Commit()
+}
+
+// CommitTo writes all nodes to the given database.
+// Nodes are stored with their sha3 hash as the key.
+//
+// Committing flushes nodes from memory. Subsequent Get calls will
+// load nodes from the trie's database. Calling code must ensure that
+// the changes made to db are written back to the trie's attached
+// database before using the trie.
+func (t *SafeTrie) CommitTo(db DatabaseWriter) (root common.Hash, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.version++
+	return t.trie.CommitTo(db)
+}
+
+// Prove constructs a merkle proof for key, see Trie.Prove for details.
+func (t *SafeTrie) Prove(key []byte, fromLevel uint, proofDb DatabaseWriter) error {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.trie.Prove(key, fromLevel, proofDb)
+}
+
+// NodeIterator returns an iterator over a snapshot of the trie taken at the
+// time of the call. Later modifications of the trie are not reflected by the
+// iterator.
+func (t *SafeTrie) NodeIterator(start []byte) NodeIterator {
+	t.lock.RLock()
+	cpy := t.trie
+	t.lock.RUnlock()
+
+	return cpy.NodeIterator(start)
+}
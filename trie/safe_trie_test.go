@@ -0,0 +1,85 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// Tests that concurrent readers always see the committed values of a safe trie
+// while a writer keeps modifying an unrelated key range. Run with -race.
+func TestSafeTrieConcurrentAccess(t *testing.T) {
+	diskdb, _ := ethdb.NewMemDatabase()
+	base, _ := New(common.Hash{}, diskdb)
+	for i := byte(0); i < 100; i++ {
+		base.Update([]byte{0x00, i}, []byte{i, i})
+	}
+	root, _ := base.Commit()
+
+	trie, err := NewSafe(root, diskdb)
+	if err != nil {
+		t.Fatalf("failed to open safe trie: %v", err)
+	}
+	var (
+		pend sync.WaitGroup
+		fail = make(chan string, 8)
+	)
+	for r := 0; r < 8; r++ {
+		pend.Add(1)
+		go func() {
+			defer pend.Done()
+			for n := 0; n < 10; n++ {
+				for i := byte(0); i < 100; i++ {
+					val, err := trie.TryGet([]byte{0x00, i})
+					if err != nil {
+						fail <- err.Error()
+						return
+					}
+					if !bytes.Equal(val, []byte{i, i}) {
+						fail <- "value mismatch"
+						return
+					}
+				}
+			}
+		}()
+	}
+	for i := byte(0); i < 100; i++ {
+		trie.Update([]byte{0xff, i}, []byte{i})
+		if i%10 == 0 {
+			if _, err := trie.Commit(); err != nil {
+				t.Fatalf("failed to commit trie: %v", err)
+			}
+		}
+	}
+	pend.Wait()
+
+	select {
+	case err := <-fail:
+		t.Fatalf("concurrent read failed: %s", err)
+	default:
+	}
+	for i := byte(0); i < 100; i++ {
+		if val := trie.Get([]byte{0xff, i}); !bytes.Equal(val, []byte{i}) {
+			t.Fatalf("written value mismatch for key %x: have %x, want %x", i, val, []byte{i})
+		}
+	}
+}
@@ -20,7 +20,9 @@ import (
 	"fmt"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
 )
 
 var secureKeyPrefix = []byte("secure-key-")
@@ -43,6 +45,7 @@ type SecureTrie struct {
 	secKeyBuf        [200]byte
 	secKeyCache      map[string][]byte
 	secKeyCacheOwner *SecureTrie // Pointer to self, replace the key cache on mismatch
+	noPreimages      bool        // Whether to skip recording the preimages of hashed keys
 }
 
 // NewSecure creates a trie with an existing root node from db.
@@ -56,10 +59,17 @@ type SecureTrie struct {
 // A new cache generation is created by each call to Commit.
 // cachelimit sets the number of past cache generations to keep.
 func NewSecure(root common.Hash, db Database, cachelimit uint16) (*SecureTrie, error) {
+	return NewSecureWithHasher(root, db, cachelimit, nil)
+}
+
+// NewSecureWithHasher creates a secure trie with an existing root node from db,
+// which hashes both its keys and nodes using the given hash function instead of
+// Keccak256. See NewSecure for the semantics of the other arguments.
+func NewSecureWithHasher(root common.Hash, db Database, cachelimit uint16, nodeHasher NodeHasher) (*SecureTrie, error) {
 	if db == nil {
 		panic("NewSecure called with nil database")
 	}
-	trie, err := New(root, db)
+	trie, err := NewWithHasher(root, db, nodeHasher)
 	if err != nil {
 		return nil, err
 	}
@@ -110,7 +120,9 @@ func (t *SecureTrie) TryUpdate(key, value []byte) error {
 	if err != nil {
 		return err
 	}
-	t.getSecKeyCache()[string(hk)] = common.CopyBytes(key)
+	if !t.noPreimages {
+		t.getSecKeyCache()[string(hk)] = common.CopyBytes(key)
+	}
 	return nil
 }
 
@@ -129,6 +141,16 @@ func (t *SecureTrie) TryDelete(key []byte) error {
 	return t.trie.TryDelete(hk)
 }
 
+// SetPreimages enables or disables recording the preimages of the hashed keys
+// into the database on commit. Recording is enabled by default. Preimages that
+// were already recorded remain retrievable via GetKey.
+func (t *SecureTrie) SetPreimages(enabled bool) {
+	t.noPreimages = !enabled
+	if !enabled {
+		t.secKeyCache = make(map[string][]byte)
+	}
+}
+
 // GetKey returns the sha3 preimage of a hashed key that was
 // previously used to store a value.
 func (t *SecureTrie) GetKey(shaKey []byte) []byte {
@@ -156,9 +178,33 @@ func (t *SecureTrie) Root() []byte {
 	return t.trie.Root()
 }
 
+// Copy returns an independent copy of the trie, sharing all the unmodified
+// nodes with the original. The preimages of the keys inserted since the last
+// commit are copied too, so that both tries persist them when committed.
 func (t *SecureTrie) Copy() *SecureTrie {
-	cpy := *t
-	return &cpy
+	cpy := &SecureTrie{
+		trie:        *t.trie.Copy(),
+		noPreimages: t.noPreimages,
+	}
+	if cache := t.getSecKeyCache(); len(cache) > 0 {
+		keys := cpy.getSecKeyCache()
+		for hk, key := range cache {
+			keys[hk] = key
+		}
+	}
+	return cpy
+}
+
+// Stats walks the entire underlying trie and gathers statistics about its
+// structure.
+func (t *SecureTrie) Stats() (*Stats, error) {
+	return t.trie.Stats()
+}
+
+// EstimateValues estimates the number of values stored in the trie by sampling
+// the given number of random paths.
+func (t *SecureTrie) EstimateValues(samples int) (float64, error) {
+	return t.trie.EstimateValues(samples)
 }
 
 // NodeIterator returns an iterator that returns nodes of the underlying trie. Iteration
@@ -198,7 +244,7 @@ func (t *SecureTrie) secKey(key []byte) []byte {
 // The caller must not hold onto the return value because it will become
 // invalid on the next call to hashKey or secKey.
 func (t *SecureTrie) hashKey(key []byte) []byte {
-	h := newHasher(0, 0)
+	h := newTrieHasher(t.trie.nodeHasher, 0, 0)
 	h.sha.Reset()
 	h.sha.Write(key)
 	buf := h.sha.Sum(t.hashKeyBuf[:0])
@@ -216,3 +262,40 @@ func (t *SecureTrie) getSecKeyCache() map[string][]byte {
 	}
 	return t.secKeyCache
 }
+
+// PreimageIterator iterates over the preimages of the hashed secure trie keys
+// recorded in a database, in the order of the hashes.
+type PreimageIterator struct {
+	it iterator.Iterator
+
+	Hash     common.Hash // Hashed key the iterator is positioned on
+	Preimage []byte      // Preimage of the hashed key
+	Err      error
+}
+
+// NewPreimageIterator creates an iterator over the secure trie key preimages in
+// db, starting at the given hash.
+func NewPreimageIterator(db ethdb.Iteratee, start common.Hash) *PreimageIterator {
+	return &PreimageIterator{it: db.NewIterator(secureKeyPrefix, start[:])}
+}
+
+// Next moves the iterator to the next preimage, returning whether there are any
+// further preimages.
+func (it *PreimageIterator) Next() bool {
+	it.Hash, it.Preimage = common.Hash{}, nil
+
+	for it.it.Next() {
+		if key := it.it.Key(); len(key) == secureKeyLength {
+			it.Hash = common.BytesToHash(key[len(secureKeyPrefix):])
+			it.Preimage = common.CopyBytes(it.it.Value())
+			return true
+		}
+	}
+	it.Err = it.it.Error()
+	return false
+}
+
+// Release releases the resources held by the iterator.
+func (it *PreimageIterator) Release() {
+	it.it.Release()
+}
@@ -106,6 +106,71 @@ func TestSecureGetKey(t *testing.T) {
 	}
 }
 
+// Tests that preimage recording can be disabled, without affecting the already
+// recorded ones.
+func TestSecureDisablePreimages(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	trie, _ := NewSecure(common.Hash{}, db, 0)
+
+	trie.Update([]byte("foo"), []byte("bar"))
+	trie.Commit()
+
+	trie.SetPreimages(false)
+	trie.Update([]byte("baz"), []byte("qux"))
+	trie.Commit()
+
+	if k := trie.GetKey(crypto.Keccak256([]byte("foo"))); !bytes.Equal(k, []byte("foo")) {
+		t.Errorf("recorded preimage mismatch: have %q, want %q", k, "foo")
+	}
+	if k := trie.GetKey(crypto.Keccak256([]byte("baz"))); k != nil {
+		t.Errorf("preimage recorded while disabled: %q", k)
+	}
+	if !bytes.Equal(trie.Get([]byte("baz")), []byte("qux")) {
+		t.Errorf("value missing with preimages disabled")
+	}
+}
+
+// Tests that the preimage iterator returns all recorded preimages in hash order,
+// starting at the requested position.
+func TestPreimageIterator(t *testing.T) {
+	db, _, content := makeTestSecureTrie()
+	db.Put([]byte("secure-key-"), []byte("ignored")) // Malformed entry, must be skipped
+
+	var hashes []common.Hash
+	it := NewPreimageIterator(db.(ethdb.Iteratee), common.Hash{})
+	for it.Next() {
+		if _, ok := content[string(it.Preimage)]; !ok {
+			t.Fatalf("unknown preimage %x", it.Preimage)
+		}
+		if hash := crypto.Keccak256Hash(it.Preimage); hash != it.Hash {
+			t.Fatalf("preimage hash mismatch: have %x, want %x", hash, it.Hash)
+		}
+		if len(hashes) > 0 && bytes.Compare(hashes[len(hashes)-1][:], it.Hash[:]) >= 0 {
+			t.Fatalf("preimages out of order: %x after %x", it.Hash, hashes[len(hashes)-1])
+		}
+		hashes = append(hashes, it.Hash)
+	}
+	it.Release()
+	if it.Err != nil {
+		t.Fatalf("iteration failed: %v", it.Err)
+	}
+	if len(hashes) != len(content) {
+		t.Fatalf("preimage count mismatch: have %d, want %d", len(hashes), len(content))
+	}
+	// Restart the iteration from the middle
+	it = NewPreimageIterator(db.(ethdb.Iteratee), hashes[len(hashes)/2])
+	defer it.Release()
+
+	for i := len(hashes) / 2; i < len(hashes); i++ {
+		if !it.Next() || it.Hash != hashes[i] {
+			t.Fatalf("preimage %d mismatch: have %x, want %x", i, it.Hash, hashes[i])
+		}
+	}
+	if it.Next() {
+		t.Fatalf("iterator didn't end, positioned at %x", it.Hash)
+	}
+}
+
 func TestSecureTrieConcurrency(t *testing.T) {
 	// Create an initial trie and copy if for concurrent access
 	_, trie, _ := makeTestSecureTrie()
@@ -143,3 +208,52 @@ func TestSecureTrieConcurrency(t *testing.T) {
 	// Wait for all threads to finish
 	pend.Wait()
 }
+
+// Tests that copies of a secure trie can be modified independently, and that
+// both of them persist the preimages of the keys inserted before copying.
+func TestSecureTrieCopy(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	trie, _ := NewSecure(common.Hash{}, db, 0)
+	for i := byte(0); i < 100; i++ {
+		trie.Update([]byte{i}, []byte{i, i})
+	}
+	cpy := trie.Copy()
+	cpy.Update([]byte{1}, []byte{0xff})
+	cpy.Delete([]byte{2})
+	trie.Update([]byte{200}, []byte{200})
+
+	for i := byte(0); i < 100; i++ {
+		if have := trie.Get([]byte{i}); !bytes.Equal(have, []byte{i, i}) {
+			t.Fatalf("original value %d mismatch: have %x, want %x", i, have, []byte{i, i})
+		}
+	}
+	if have := trie.Get([]byte{200}); !bytes.Equal(have, []byte{200}) {
+		t.Fatalf("original value 200 mismatch: have %x", have)
+	}
+	if have := cpy.Get([]byte{200}); have != nil {
+		t.Fatalf("original change leaked into the copy: %x", have)
+	}
+	if have := cpy.Get([]byte{1}); !bytes.Equal(have, []byte{0xff}) {
+		t.Fatalf("copy value mismatch: have %x, want ff", have)
+	}
+	if have := cpy.Get([]byte{2}); have != nil {
+		t.Fatalf("deleted value still in copy: %x", have)
+	}
+	// Commit the copy into a separate database, checking the preimages
+	cpydb, _ := ethdb.NewMemDatabase()
+	if _, err := cpy.CommitTo(cpydb); err != nil {
+		t.Fatalf("failed to commit copy: %v", err)
+	}
+	restored, _ := NewSecure(cpy.Hash(), cpydb, 0)
+	for i := byte(0); i < 100; i++ {
+		if i == 2 {
+			continue
+		}
+		if key := restored.GetKey(crypto.Keccak256([]byte{i})); !bytes.Equal(key, []byte{i}) {
+			t.Fatalf("preimage %d mismatch: have %x", i, key)
+		}
+	}
+	if len(trie.getSecKeyCache()) != 101 {
+		t.Fatalf("original preimage cache changed: have %d entries, want 101", len(trie.getSecKeyCache()))
+	}
+}
@@ -0,0 +1,399 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// ErrCommitDisabled is returned when a stack trie without a database is committed.
+var ErrCommitDisabled = errors.New("no database for committing")
+
+// stPool is a pool of stack trie nodes, reused to cut down on allocations
+// while building large tries.
+var stPool = sync.Pool{
+	New: func() interface{} {
+		return NewStackTrie(nil)
+	},
+}
+
+func stackTrieFromPool(db DatabaseWriter) *StackTrie {
+	st := stPool.Get().(*StackTrie)
+	st.db = db
+	return st
+}
+
+func returnToPool(st *StackTrie) {
+	st.Reset()
+	stPool.Put(st)
+}
+
+// Node types of the stack trie.
+const (
+	emptyNode = iota
+	branchNode
+	extNode
+	leafNode
+	hashedNode
+)
+
+// StackTrie is a trie implementation that expects keys to be inserted in
+// order. Once it determines that a subtree will no longer be inserted into,
+// it will hash it and free up the memory it uses, keeping only O(depth) nodes
+// alive. If a database is attached, hashed nodes are also written into it.
+//
+// The root hash produced by a StackTrie is identical to the one of a Trie
+// filled with the same key/value pairs. Deletions and overwrites are not
+// supported, and no key may be a prefix of another one (which always holds for
+// the fixed length keys of the state and storage tries).
+type StackTrie struct {
+	nodeType  uint8          // node type (as in branch, ext, leaf)
+	val       []byte         // value contained by this node if it's a leaf, encoding or hash otherwise
+	key       []byte         // key chunk covered by this (full|ext) node
+	keyOffset int            // offset of the key chunk inside a full key
+	children  [16]*StackTrie // list of children (for fullnodes and exts)
+
+	db DatabaseWriter // pointer to the commit db, can be nil
+}
+
+// NewStackTrie allocates and initializes an empty trie. If db is non-nil, the
+// completed nodes are written into it as soon as they are hashed.
+func NewStackTrie(db DatabaseWriter) *StackTrie {
+	return &StackTrie{
+		nodeType: emptyNode,
+		db:       db,
+	}
+}
+
+func newLeaf(ko int, key, val []byte, db DatabaseWriter) *StackTrie {
+	st := stackTrieFromPool(db)
+	st.nodeType = leafNode
+	st.keyOffset = ko
+	st.key = append(st.key, key[ko:]...)
+	st.val = val
+	return st
+}
+
+func newExt(ko int, key []byte, child *StackTrie, db DatabaseWriter) *StackTrie {
+	st := stackTrieFromPool(db)
+	st.nodeType = extNode
+	st.keyOffset = ko
+	st.key = append(st.key, key[ko:]...)
+	st.children[0] = child
+	return st
+}
+
+// Update inserts a (key, value) pair into the stack trie. Keys must be
+// inserted in strictly increasing order.
+func (st *StackTrie) Update(key, value []byte) {
+	if err := st.TryUpdate(key, value); err != nil {
+		log.Error(fmt.Sprintf("Unhandled trie error: %v", err))
+	}
+}
+
+// TryUpdate inserts a (key, value) pair into the stack trie. Keys must be
+// inserted in strictly increasing order and the value must not be empty.
+//
+// The value bytes must not be modified by the caller while they are
+// stored in the trie.
+func (st *StackTrie) TryUpdate(key, value []byte) error {
+	if len(value) == 0 {
+		return errors.New("stack trie does not support deletion")
+	}
+	k := keybytesToHex(key)
+	st.insert(k[:len(k)-1], value)
+	return nil
+}
+
+// Reset clears the stack trie, making it ready for reuse.
+func (st *StackTrie) Reset() {
+	st.db = nil
+	st.key = st.key[:0]
+	st.val = nil
+	for i := range st.children {
+		st.children[i] = nil
+	}
+	st.nodeType = emptyNode
+	st.keyOffset = 0
+}
+
+// getDiffIndex determines, given a full key, the index at which the chunk
+// pointed by st.keyOffset is different from the same chunk in the full key.
+func (st *StackTrie) getDiffIndex(key []byte) int {
+	diffindex := 0
+	for ; diffindex < len(st.key) && st.key[diffindex] == key[st.keyOffset+diffindex]; diffindex++ {
+	}
+	return diffindex
+}
+
+// insert inserts a (key, value) pair into the trie, hashing every subtree
+// to the left of the new key since it can no longer be modified.
+func (st *StackTrie) insert(key, value []byte) {
+	switch st.nodeType {
+	case branchNode:
+		idx := int(key[st.keyOffset])
+
+		// Hash the elder sibling, nothing will be inserted into it anymore
+		for i := idx - 1; i >= 0; i-- {
+			if st.children[i] != nil {
+				if st.children[i].nodeType != hashedNode {
+					st.children[i].hash()
+				}
+				break
+			}
+		}
+		// Add new child
+		if st.children[idx] == nil {
+			st.children[idx] = stackTrieFromPool(st.db)
+			st.children[idx].keyOffset = st.keyOffset + 1
+		}
+		st.children[idx].insert(key, value)
+
+	case extNode:
+		// Compare both key chunks and see where they differ
+		diffidx := st.getDiffIndex(key)
+
+		// Check if chunks are identical. If so, recurse into the child node.
+		// Otherwise, the key has to be split into 1) an optional common prefix,
+		// 2) the fullnode representing the two differing path, and 3) a leaf
+		// for each of the differentiated subtrees.
+		if diffidx == len(st.key) {
+			st.children[0].insert(key, value)
+			return
+		}
+		// Save the original part. Depending if the break is at the extension's
+		// last byte or not, create an intermediate extension or use the
+		// extension's child node directly.
+		var n *StackTrie
+		if diffidx < len(st.key)-1 {
+			n = newExt(diffidx+1, st.key, st.children[0], st.db)
+		} else {
+			n = st.children[0]
+		}
+		// The original part is complete, hash it
+		n.hash()
+
+		var p *StackTrie
+		if diffidx == 0 {
+			// The break is on the first byte, so the current node is
+			// converted into a branch node.
+			st.children[0] = nil
+			p = st
+			st.nodeType = branchNode
+		} else {
+			// The common prefix is at least one byte long, insert a new
+			// intermediate branch node.
+			st.children[0] = stackTrieFromPool(st.db)
+			st.children[0].nodeType = branchNode
+			st.children[0].keyOffset = st.keyOffset + diffidx
+			p = st.children[0]
+		}
+		// Create a leaf for the inserted part
+		o := newLeaf(st.keyOffset+diffidx+1, key, value, st.db)
+
+		// Insert both child leaves where they belong
+		origIdx := st.key[diffidx]
+		newIdx := key[diffidx+st.keyOffset]
+		p.children[origIdx] = n
+		p.children[newIdx] = o
+		st.key = st.key[:diffidx]
+
+	case leafNode:
+		// Compare both key chunks and see where they differ
+		diffidx := st.getDiffIndex(key)
+
+		// Overwriting a key isn't supported, which means that the current leaf
+		// is expected to be split into 1) an optional extension for the common
+		// prefix of these 2 keys, 2) a fullnode selecting the path on which the
+		// keys differ, and 3) one leaf for the differentiated component of each
+		// key.
+		if diffidx >= len(st.key) {
+			panic("trying to insert into existing key")
+		}
+		// Check if the split occurs at the first nibble of the chunk. In that
+		// case, no prefix extnode is necessary. Otherwise, create that.
+		var p *StackTrie
+		if diffidx == 0 {
+			// Convert current leaf into a branch
+			st.nodeType = branchNode
+			p = st
+			st.children[0] = nil
+		} else {
+			// Convert current node into an ext, and insert a child branch node.
+			st.nodeType = extNode
+			st.children[0] = stackTrieFromPool(st.db)
+			st.children[0].nodeType = branchNode
+			st.children[0].keyOffset = st.keyOffset + diffidx
+			p = st.children[0]
+		}
+		// Create the two child leaves: the one containing the original value
+		// and the one containing the new value. The original leaf is hashed
+		// directly in order to free up some memory.
+		origIdx := st.key[diffidx]
+		p.children[origIdx] = newLeaf(diffidx+1, st.key, st.val, st.db)
+		p.children[origIdx].hash()
+
+		newIdx := key[diffidx+st.keyOffset]
+		p.children[newIdx] = newLeaf(p.keyOffset+1, key, value, st.db)
+
+		// Finally, cut off the key part that has been passed over to the children.
+		st.key = st.key[:diffidx]
+		st.val = nil
+
+	case emptyNode:
+		st.nodeType = leafNode
+		st.key = key[st.keyOffset:]
+		st.val = value
+
+	case hashedNode:
+		panic("trying to insert into hash")
+
+	default:
+		panic("invalid type")
+	}
+}
+
+// hash converts st into a hashedNode. After this call, st.val holds either
+// the RLP encoding of the node if it is smaller than 32 bytes (and will thus
+// be embedded into its parent), or the hash of the encoding otherwise.
+func (st *StackTrie) hash() {
+	if st.nodeType == hashedNode {
+		return
+	}
+	h := newHasher(0, 0)
+	defer returnHasherToPool(h)
+
+	w := h.encbuf
+	switch st.nodeType {
+	case branchNode:
+		offset := w.List()
+		for i, child := range st.children {
+			if child == nil {
+				w.WriteBytes(nil)
+				continue
+			}
+			child.hash()
+			child.encodeRef(w)
+			st.children[i] = nil // Reclaim mem from subtree
+			returnToPool(child)
+		}
+		w.WriteBytes(nil)
+		w.ListEnd(offset)
+
+	case extNode:
+		child := st.children[0]
+		child.hash()
+
+		offset := w.List()
+		w.WriteBytes(hexToCompact(st.key))
+		child.encodeRef(w)
+		w.ListEnd(offset)
+		st.children[0] = nil // Reclaim mem from subtree
+		returnToPool(child)
+
+	case leafNode:
+		offset := w.List()
+		w.WriteBytes(hexToCompact(append(st.key, 16)))
+		w.WriteBytes(st.val)
+		w.ListEnd(offset)
+
+	case emptyNode:
+		st.val = emptyRoot.Bytes()
+		st.key = st.key[:0]
+		st.nodeType = hashedNode
+		return
+
+	default:
+		panic("invalid node type")
+	}
+	enc := h.encodedBytes()
+
+	st.key = st.key[:0]
+	st.nodeType = hashedNode
+	if len(enc) < 32 {
+		st.val = common.CopyBytes(enc)
+		return
+	}
+	h.sha.Reset()
+	h.sha.Write(enc)
+	st.val = h.sha.Sum(nil)
+
+	if st.db != nil {
+		st.db.Put(st.val, enc)
+	}
+}
+
+// encodeRef writes the reference of a hashed node as it should be embedded in
+// its parent: the raw encoding for small nodes and the hash for all others.
+func (st *StackTrie) encodeRef(w rlp.EncoderBuffer) {
+	if len(st.val) < 32 {
+		w.Write(st.val)
+		return
+	}
+	w.WriteBytes(st.val)
+}
+
+// Hash returns the hash of the current node.
+func (st *StackTrie) Hash() common.Hash {
+	st.hash()
+	if len(st.val) != 32 {
+		// If the node's RLP isn't 32 bytes long, the node will not be hashed,
+		// and instead contain the rlp-encoding of the node. For the top level
+		// node, we need to force the hashing.
+		h := newHasher(0, 0)
+		defer returnHasherToPool(h)
+
+		h.sha.Reset()
+		h.sha.Write(st.val)
+		return common.BytesToHash(h.sha.Sum(nil))
+	}
+	return common.BytesToHash(st.val)
+}
+
+// Commit will firstly hash the entire trie if it's still not hashed and then
+// commit all nodes to the associated database. Actually most of the trie nodes
+// have already been committed during insertion, only the remaining top-level
+// nodes are written here.
+//
+// If the trie has no database, ErrCommitDisabled is returned.
+func (st *StackTrie) Commit() (common.Hash, error) {
+	if st.db == nil {
+		return common.Hash{}, ErrCommitDisabled
+	}
+	st.hash()
+	if len(st.val) != 32 {
+		// The root node is smaller than a hash, force it into the database
+		// like Trie.Commit does.
+		h := newHasher(0, 0)
+		defer returnHasherToPool(h)
+
+		h.sha.Reset()
+		h.sha.Write(st.val)
+		hash := h.sha.Sum(nil)
+		if err := st.db.Put(hash, st.val); err != nil {
+			return common.Hash{}, err
+		}
+		return common.BytesToHash(hash), nil
+	}
+	return common.BytesToHash(st.val), nil
+}
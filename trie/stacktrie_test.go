@@ -0,0 +1,122 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+func TestStackTrieEmpty(t *testing.T) {
+	st := NewStackTrie(nil)
+	if have := st.Hash(); have != emptyRoot {
+		t.Fatalf("empty root mismatch: have %x, want %x", have, emptyRoot)
+	}
+	if _, err := st.Commit(); err != ErrCommitDisabled {
+		t.Fatalf("commit error mismatch: have %v, want %v", err, ErrCommitDisabled)
+	}
+}
+
+// Tests that the stack trie produces the same root hash as the regular trie for
+// various key/value shapes, including ones that result in embedded nodes.
+func TestStackTrieHashes(t *testing.T) {
+	tests := [][]*kv{
+		// Single small value, root node is embedded
+		{{k: []byte("a"), v: []byte("b")}},
+		// Short keys and values, lots of embedded nodes
+		{
+			{k: []byte("doe"), v: []byte("reindeer")},
+			{k: []byte("dog"), v: []byte("puppy")},
+			{k: []byte("dot"), v: []byte("point")},
+			{k: []byte("hog"), v: []byte("swine")},
+		},
+		// Shared prefixes split at different depths
+		{
+			{k: common.FromHex("0x00000001"), v: []byte{1}},
+			{k: common.FromHex("0x00000010"), v: []byte{2}},
+			{k: common.FromHex("0x00000100"), v: []byte{3}},
+			{k: common.FromHex("0x00001000"), v: []byte{4}},
+			{k: common.FromHex("0x10000000"), v: []byte{5}},
+		},
+	}
+	for i, kvs := range tests {
+		trie, st := new(Trie), NewStackTrie(nil)
+		for _, kv := range kvs {
+			trie.Update(kv.k, kv.v)
+			st.Update(kv.k, kv.v)
+		}
+		if have, want := st.Hash(), trie.Hash(); have != want {
+			t.Errorf("test %d: root mismatch: have %x, want %x", i, have, want)
+		}
+	}
+}
+
+func TestStackTrieRandom(t *testing.T) {
+	for _, n := range []int{1, 10, 100, 1000} {
+		trie, entries := sortedRandomTrie(n)
+
+		diskdb, _ := ethdb.NewMemDatabase()
+		st := NewStackTrie(diskdb)
+		for _, kv := range entries {
+			st.Update(kv.k, kv.v)
+		}
+		root, err := st.Commit()
+		if err != nil {
+			t.Fatalf("n=%d: failed to commit stack trie: %v", n, err)
+		}
+		if want := trie.Hash(); root != want {
+			t.Fatalf("n=%d: root mismatch: have %x, want %x", n, root, want)
+		}
+		// Ensure all nodes made it into the database
+		loaded, err := New(root, diskdb)
+		if err != nil {
+			t.Fatalf("n=%d: failed to load committed trie: %v", n, err)
+		}
+		for _, kv := range entries {
+			val, err := loaded.TryGet(kv.k)
+			if err != nil {
+				t.Fatalf("n=%d: failed to retrieve key %x: %v", n, kv.k, err)
+			}
+			if !bytes.Equal(val, kv.v) {
+				t.Fatalf("n=%d: value mismatch for key %x: have %x, want %x", n, kv.k, val, kv.v)
+			}
+		}
+	}
+}
+
+func TestStackTrieDeletion(t *testing.T) {
+	st := NewStackTrie(nil)
+	if err := st.TryUpdate([]byte("a"), nil); err == nil {
+		t.Fatal("expected error for deletion")
+	}
+}
+
+func BenchmarkStackTrieUpdateHash(b *testing.B) {
+	_, entries := sortedRandomTrie(1000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		st := NewStackTrie(nil)
+		for _, kv := range entries {
+			st.Update(kv.k, kv.v)
+		}
+		st.Hash()
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+)
+
+// Stats contains the node counts of a trie, along with the distribution of the
+// depths its values are stored at.
+type Stats struct {
+	FullNodes  uint64 `json:"fullNodes"`  // Number of branch nodes
+	ShortNodes uint64 `json:"shortNodes"` // Number of extension and leaf nodes
+	HashNodes  uint64 `json:"hashNodes"`  // Number of nodes stored separately in the database
+	ValueNodes uint64 `json:"valueNodes"` // Number of values stored in the trie
+
+	// Depths counts the values by depth, the depth being the number of nodes
+	// on the path from the root to the value, excluding the value itself.
+	Depths []uint64 `json:"depths"`
+}
+
+// Stats walks the entire trie, loading all its nodes from the database, and
+// gathers statistics about its structure. The trie itself is not modified.
+func (t *Trie) Stats() (*Stats, error) {
+	stats := new(Stats)
+	if err := t.stats(t.root, nil, 0, stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// stats adds the statistics of the subtrie rooted at the given node, located
+// at the given path and depth.
+func (t *Trie) stats(n node, prefix []byte, depth int, stats *Stats) error {
+	switch n := n.(type) {
+	case nil:
+		return nil
+	case *shortNode:
+		stats.ShortNodes++
+		return t.stats(n.Val, append(prefix, n.Key...), depth+1, stats)
+	case *fullNode:
+		stats.FullNodes++
+		for i, child := range n.Children {
+			if err := t.stats(child, append(prefix, byte(i)), depth+1, stats); err != nil {
+				return err
+			}
+		}
+		return nil
+	case hashNode:
+		stats.HashNodes++
+		child, err := t.resolveHash(n, prefix)
+		if err != nil {
+			return err
+		}
+		return t.stats(child, prefix, depth, stats)
+	case valueNode:
+		stats.ValueNodes++
+		for len(stats.Depths) <= depth {
+			stats.Depths = append(stats.Depths, 0)
+		}
+		stats.Depths[depth]++
+		return nil
+	default:
+		panic(fmt.Sprintf("%T: invalid node: %v", n, n))
+	}
+}
+
+// EstimateValues estimates the number of values stored in the trie without
+// walking all of it. It descends from the root along the given number of random
+// paths, choosing uniformly between the children of each branch node, and
+// averages the products of the branching factors met along them. The estimate
+// is unbiased, and exact for perfectly balanced tries.
+func (t *Trie) EstimateValues(samples int) (float64, error) {
+	if samples <= 0 {
+		return 0, errors.New("no samples requested")
+	}
+	if t.root == nil {
+		return 0, nil
+	}
+	var total float64
+	for i := 0; i < samples; i++ {
+		estimate, err := t.sampleValues(t.root)
+		if err != nil {
+			return 0, err
+		}
+		total += estimate
+	}
+	return total / float64(samples), nil
+}
+
+// sampleValues descends along a single random path from the given node,
+// returning the estimated number of values below it.
+func (t *Trie) sampleValues(n node) (float64, error) {
+	var (
+		prefix   []byte
+		estimate = 1.0
+	)
+	for {
+		switch nn := n.(type) {
+		case *shortNode:
+			n, prefix = nn.Val, append(prefix, nn.Key...)
+
+		case *fullNode:
+			var children []int
+			for i, child := range nn.Children {
+				if child != nil {
+					children = append(children, i)
+				}
+			}
+			pick := children[rand.Intn(len(children))]
+			estimate *= float64(len(children))
+			n, prefix = nn.Children[pick], append(prefix, byte(pick))
+
+		case hashNode:
+			child, err := t.resolveHash(nn, prefix)
+			if err != nil {
+				return 0, err
+			}
+			n = child
+
+		case valueNode:
+			return estimate, nil
+
+		default:
+			panic(fmt.Sprintf("%T: invalid node: %v", n, n))
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// Tests the statistics gathered from a balanced trie, both from memory and
+// after loading it back from the database.
+func TestStats(t *testing.T) {
+	diskdb, _ := ethdb.NewMemDatabase()
+	trie, _ := New(common.Hash{}, diskdb)
+
+	// 256 keys differing in their last byte: an extension to a branch of 16
+	// branches with 16 leaves each
+	for i := 0; i < 256; i++ {
+		trie.Update(common.LeftPadBytes([]byte{byte(i)}, 32), []byte{byte(i)})
+	}
+	want := &Stats{
+		FullNodes:  17,
+		ShortNodes: 1 + 256,
+		ValueNodes: 256,
+		Depths:     []uint64{0, 0, 0, 0, 256},
+	}
+	stats, err := trie.Stats()
+	if err != nil {
+		t.Fatalf("failed to gather stats: %v", err)
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Fatalf("stats mismatch: have %+v, want %+v", stats, want)
+	}
+	if estimate, err := trie.EstimateValues(10); err != nil || estimate != 256 {
+		t.Fatalf("estimate mismatch: have %v/%v, want 256", estimate, err)
+	}
+	// Load the trie from disk, where the small leaves are embedded
+	root, _ := trie.Commit()
+	trie, _ = New(root, diskdb)
+
+	stats, err = trie.Stats()
+	if err != nil {
+		t.Fatalf("failed to gather stats: %v", err)
+	}
+	want.HashNodes = 17
+	if !reflect.DeepEqual(stats, want) {
+		t.Fatalf("stats mismatch: have %+v, want %+v", stats, want)
+	}
+	if estimate, err := trie.EstimateValues(10); err != nil || estimate != 256 {
+		t.Fatalf("estimate mismatch: have %v/%v, want 256", estimate, err)
+	}
+	// Missing nodes must be reported
+	diskdb.Delete(root[:])
+	trie, _ = New(common.Hash{}, diskdb)
+	trie.root = hashNode(root[:])
+	if _, err := trie.Stats(); err == nil {
+		t.Fatalf("missing root not reported by stats")
+	}
+	if _, err := trie.EstimateValues(1); err == nil {
+		t.Fatalf("missing root not reported by estimate")
+	}
+}
+
+// Tests that the value count estimate of a random trie is close to the actual.
+func TestEstimateValues(t *testing.T) {
+	trie, vals := randomTrie(5000)
+
+	estimate, err := trie.EstimateValues(2000)
+	if err != nil {
+		t.Fatalf("failed to estimate values: %v", err)
+	}
+	if diff := math.Abs(estimate-float64(len(vals))) / float64(len(vals)); diff > 0.2 {
+		t.Fatalf("estimate too far off: have %v, want %d", estimate, len(vals))
+	}
+	empty := new(Trie)
+	if estimate, err := empty.EstimateValues(1); err != nil || estimate != 0 {
+		t.Fatalf("empty trie estimate mismatch: have %v/%v, want 0", estimate, err)
+	}
+}
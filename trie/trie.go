@@ -91,6 +91,12 @@ type Trie struct {
 	// new nodes are tagged with the current generation and unloaded
 	// when their generation is older than than cachegen-cachelimit.
 	cachegen, cachelimit uint16
+
+	// unhashed counts the updates since the last commit, used to decide whether
+	// hashing the trie is worth spreading across multiple threads.
+	unhashed int
+
+	nodeHasher NodeHasher // Hash function of the trie nodes, nil for Keccak256
 }
 
 // SetCacheLimit sets the number of 'cache generations' to keep.
@@ -111,8 +117,16 @@ func (t *Trie) newFlag() nodeFlag {
 // New will panic if db is nil and returns a MissingNodeError if root does
 // not exist in the database. Accessing the trie loads nodes from db on demand.
 func New(root common.Hash, db Database) (*Trie, error) {
-	trie := &Trie{db: db, originalRoot: root}
-	if (root != common.Hash{}) && root != emptyRoot {
+	return NewWithHasher(root, db, nil)
+}
+
+// NewWithHasher creates a trie with an existing root node from db, which hashes
+// its nodes using the given hash function instead of Keccak256. The root must
+// have been produced with the same hash function. See New for the semantics of
+// root and db.
+func NewWithHasher(root common.Hash, db Database, nodeHasher NodeHasher) (*Trie, error) {
+	trie := &Trie{db: db, originalRoot: root, nodeHasher: nodeHasher}
+	if (root != common.Hash{}) && root != trie.emptyRoot() {
 		if db == nil {
 			panic("trie.New: cannot use existing root without a database")
 		}
@@ -125,6 +139,16 @@ func New(root common.Hash, db Database) (*Trie, error) {
 	return trie, nil
 }
 
+// emptyRoot returns the root hash of an empty trie for the hash function in use.
+func (t *Trie) emptyRoot() common.Hash {
+	if t.nodeHasher == nil || t.nodeHasher == Keccak256Hasher {
+		return emptyRoot
+	}
+	h := t.nodeHasher.NewHash()
+	h.Write([]byte{0x80}) // RLP encoding of the empty string
+	return common.BytesToHash(h.Sum(nil))
+}
+
 // NodeIterator returns an iterator that returns nodes of the trie. Iteration starts at
 // the key after the given start key.
 func (t *Trie) NodeIterator(start []byte) NodeIterator {
@@ -212,6 +236,7 @@ func (t *Trie) Update(key, value []byte) {
 //
 // If a node was not found in the database, a MissingNodeError is returned.
 func (t *Trie) TryUpdate(key, value []byte) error {
+	t.unhashed++
 	k := keybytesToHex(key)
 	if len(value) != 0 {
 		_, n, err := t.insert(t.root, nil, k, valueNode(value))
@@ -308,6 +333,7 @@ func (t *Trie) Delete(key []byte) {
 // TryDelete removes any existing value for key from the trie.
 // If a node was not found in the database, a MissingNodeError is returned.
 func (t *Trie) TryDelete(key []byte) error {
+	t.unhashed++
 	k := keybytesToHex(key)
 	_, n, err := t.delete(t.root, nil, k)
 	if err != nil {
@@ -454,6 +480,15 @@ func (t *Trie) resolveHash(n hashNode, prefix []byte) (node, error) {
 	return dec, nil
 }
 
+// Copy returns an independent copy of the trie. Trie nodes are never modified
+// in place, so the copy shares all of them with the original, and both tries
+// only allocate the nodes on the paths they modify afterwards (copy-on-write).
+// The copies are safe to use concurrently.
+func (t *Trie) Copy() *Trie {
+	cpy := *t
+	return &cpy
+}
+
 // Root returns the root hash of the trie.
 // Deprecated: use Hash instead.
 func (t *Trie) Root() []byte { return t.Hash().Bytes() }
@@ -492,14 +527,18 @@ func (t *Trie) CommitTo(db DatabaseWriter) (root common.Hash, err error) {
 	}
 	t.root = cached
 	t.cachegen++
+	t.unhashed = 0
 	return common.BytesToHash(hash.(hashNode)), nil
 }
 
 func (t *Trie) hashRoot(db DatabaseWriter) (node, node, error) {
 	if t.root == nil {
-		return hashNode(emptyRoot.Bytes()), nil, nil
+		return hashNode(t.emptyRoot().Bytes()), nil, nil
 	}
-	h := newHasher(t.cachegen, t.cachelimit)
+	h := newTrieHasher(t.nodeHasher, t.cachegen, t.cachelimit)
 	defer returnHasherToPool(h)
+
+	// Spread the hashing of large tries across multiple threads
+	h.parallel = t.unhashed >= parallelHashThreshold
 	return h.hash(t.root, db, true)
 }
@@ -18,9 +18,11 @@ package trie
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash"
 	"io/ioutil"
 	"math/rand"
 	"os"
@@ -30,6 +32,7 @@ import (
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 )
 
@@ -310,6 +313,104 @@ func TestLargeValue(t *testing.T) {
 	trie.Hash()
 }
 
+// recordingDB is a database writer that records the order of all writes.
+type recordingDB struct {
+	keys [][]byte
+}
+
+func (db *recordingDB) Put(key []byte, value []byte) error {
+	db.keys = append(db.keys, common.CopyBytes(key))
+	return nil
+}
+
+// Tests that hashing and committing a large trie in parallel yields the same
+// root hash and database writes, in the same order, as doing it sequentially.
+func TestParallelHashing(t *testing.T) {
+	parallel, sequential := newEmpty(), newEmpty()
+	for i := 0; i < 4*parallelHashThreshold; i++ {
+		key, value := crypto.Keccak256([]byte{byte(i), byte(i >> 8)}), bytes.Repeat([]byte{byte(i)}, 40)
+		parallel.Update(key, value)
+		sequential.Update(key, value)
+	}
+	sequential.unhashed = 0
+
+	if phash, shash := parallel.Hash(), sequential.Hash(); phash != shash {
+		t.Fatalf("hash mismatch: parallel %x, sequential %x", phash, shash)
+	}
+	pdb, sdb := new(recordingDB), new(recordingDB)
+	proot, err := parallel.CommitTo(pdb)
+	if err != nil {
+		t.Fatalf("parallel commit failed: %v", err)
+	}
+	sroot, _ := sequential.CommitTo(sdb)
+	if proot != sroot {
+		t.Fatalf("root mismatch: parallel %x, sequential %x", proot, sroot)
+	}
+	if len(pdb.keys) != len(sdb.keys) {
+		t.Fatalf("write count mismatch: parallel %d, sequential %d", len(pdb.keys), len(sdb.keys))
+	}
+	for i := range pdb.keys {
+		if !bytes.Equal(pdb.keys[i], sdb.keys[i]) {
+			t.Fatalf("write %d mismatch: parallel %x, sequential %x", i, pdb.keys[i], sdb.keys[i])
+		}
+	}
+	if parallel.unhashed != 0 {
+		t.Errorf("update counter not reset after commit: %d", parallel.unhashed)
+	}
+}
+
+// sha256Hasher is a node hasher using SHA-256 instead of Keccak256.
+type sha256Hasher struct{}
+
+func (sha256Hasher) NewHash() hash.Hash { return sha256.New() }
+
+// Tests that tries can be built, committed and reopened using a custom node
+// hash function, with all node references derived with it.
+func TestCustomNodeHasher(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+
+	empty, _ := NewWithHasher(common.Hash{}, db, sha256Hasher{})
+	if have, want := empty.Hash(), common.Hash(sha256.Sum256([]byte{0x80})); have != want {
+		t.Fatalf("empty root mismatch: have %x, want %x", have, want)
+	}
+	trie, keccak := empty, newEmpty()
+	for i := byte(0); i < 100; i++ {
+		key, value := []byte{i, 0xff}, bytes.Repeat([]byte{i}, 40)
+		trie.Update(key, value)
+		keccak.Update(key, value)
+	}
+	root, err := trie.Commit()
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	if root == keccak.Hash() {
+		t.Fatalf("custom hasher root matches Keccak256 root")
+	}
+	for _, key := range db.Keys() {
+		blob, _ := db.Get(key)
+		if hash := sha256.Sum256(blob); !bytes.Equal(hash[:], key) {
+			t.Errorf("node %x stored under mismatching key %x", hash, key)
+		}
+	}
+	// Reopen the trie and check its contents, both directly and via a proof
+	trie, err = NewWithHasher(root, db, sha256Hasher{})
+	if err != nil {
+		t.Fatalf("failed to reopen trie: %v", err)
+	}
+	for i := byte(0); i < 100; i++ {
+		if value := trie.Get([]byte{i, 0xff}); !bytes.Equal(value, bytes.Repeat([]byte{i}, 40)) {
+			t.Fatalf("value %d mismatch: have %x", i, value)
+		}
+	}
+	proof, _ := ethdb.NewMemDatabase()
+	if err := trie.Prove([]byte{42, 0xff}, 0, proof); err != nil {
+		t.Fatalf("failed to prove key: %v", err)
+	}
+	if value, err := VerifyProof(root, []byte{42, 0xff}, proof); err != nil || !bytes.Equal(value, bytes.Repeat([]byte{42}, 40)) {
+		t.Fatalf("proof verification failed: value %x, err %v", value, err)
+	}
+}
+
 type countingDB struct {
 	Database
 	gets map[string]int
@@ -563,6 +664,24 @@ func benchHash(b *testing.B, e binary.ByteOrder) {
 	}
 }
 
+// BenchmarkCommitUncached measures hashing and committing a freshly updated trie,
+// where none of the node hashes are cached yet.
+func BenchmarkCommitUncached(b *testing.B) {
+	k := make([]byte, 32)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		trie := newEmpty()
+		for j := 0; j < 1000; j++ {
+			binary.LittleEndian.PutUint64(k, uint64(j))
+			trie.Update(k, k)
+		}
+		b.StartTimer()
+
+		trie.Commit()
+	}
+}
+
 func tempDB() (string, Database) {
 	dir, err := ioutil.TempDir("", "trie-bench")
 	if err != nil {